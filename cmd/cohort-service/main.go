@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -16,6 +21,8 @@ import (
 	"github.com/pjhul/intent/internal/api"
 	"github.com/pjhul/intent/internal/api/handlers"
 	"github.com/pjhul/intent/internal/api/middleware"
+	"github.com/pjhul/intent/internal/api/rpc"
+	"github.com/pjhul/intent/internal/api/rpc/membershipv1"
 	"github.com/pjhul/intent/internal/config"
 	"github.com/pjhul/intent/internal/db"
 	"github.com/pjhul/intent/internal/domain/cohort"
@@ -28,6 +35,8 @@ import (
 	"github.com/pjhul/intent/internal/infrastructure/flink"
 	"github.com/pjhul/intent/internal/infrastructure/kafka"
 	"github.com/pjhul/intent/internal/infrastructure/migrations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -36,6 +45,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -66,14 +78,21 @@ func main() {
 		log.Fatalf("failed to connect to ClickHouse: %v", err)
 	}
 	defer chClient.Close()
+	chClient.SetProjectIsolation(cfg.ClickHouse.ProjectIsolation)
+	chClient.SetSlowQueryThreshold(cfg.ClickHouse.SlowQueryThreshold)
 
 	// Initialize Redis client
 	redisClient := cache.NewRedisClient(cfg.Redis)
-	if err := redisClient.Ping(ctx); err != nil {
-		log.Printf("warning: failed to connect to Redis: %v", err)
-	}
 	defer redisClient.Close()
 
+	// Fail fast if no Kafka broker is reachable
+	checkCtx, checkCancel := context.WithTimeout(ctx, cfg.Kafka.ConnectTimeout)
+	err = kafka.NewBrokerChecker(cfg.Kafka.ConnectTimeout).Check(checkCtx, cfg.Kafka.Brokers)
+	checkCancel()
+	if err != nil {
+		log.Fatalf("failed to connect to Kafka: %v", err)
+	}
+
 	// Initialize Kafka producer
 	kafkaProducer := kafka.NewProducer(cfg.Kafka)
 	defer kafkaProducer.Close()
@@ -81,15 +100,51 @@ func main() {
 	// Initialize Flink job manager
 	flinkJobManager := flink.NewJobManager(cfg.Flink)
 
+	// Fail fast on critical dependencies; optional ones only degrade features
+	healthHandler := handlers.NewHealthHandler()
+	healthHandler.AddDependency(handlers.Dependency{Name: "postgres", Critical: true, Check: pgPool.Ping})
+	healthHandler.AddDependency(handlers.Dependency{Name: "clickhouse", Critical: true, Check: chClient.Conn().Ping})
+	healthHandler.AddDependency(handlers.Dependency{
+		Name:     "kafka",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			return kafka.NewBrokerChecker(cfg.Kafka.ConnectTimeout).Check(ctx, cfg.Kafka.Brokers)
+		},
+	})
+	healthHandler.AddDependency(handlers.Dependency{
+		Name:     "redis",
+		Features: []string{"membership cache"},
+		Check:    redisClient.Ping,
+	})
+	healthHandler.AddDependency(handlers.Dependency{
+		Name:     "flink",
+		Features: []string{"flink job management"},
+		Check: func(ctx context.Context) error {
+			_, err := flinkJobManager.GetClusterOverview(ctx)
+			return err
+		},
+	})
+	if err := healthHandler.CheckStartup(ctx, cfg.Server.AllowDegradedStart); err != nil {
+		log.Fatalf("startup dependency check failed: %v", err)
+	}
+
 	// Initialize repositories
 	queries := db.New(pgPool)
 	eventRepo := clickhouse.NewEventRepository(chClient)
 	membershipRepo := clickhouse.NewMembershipRepository(chClient)
+	membershipRepo.SetMembershipModel(cfg.ClickHouse.MembershipModel)
 	membershipCache := cache.NewMembershipCache(redisClient)
+	membershipCache.SetCompressionThreshold(cfg.Redis.CompressionThreshold)
 
 	// Initialize services
 	organizationService := organization.NewService(queries)
 	projectService := project.NewService(queries)
+	projectService.SetDefaultEventRetention(cfg.ClickHouse.EventRetentionDays)
+	if cfg.ClickHouse.ProjectIsolation {
+		runner := migrations.NewMigrationRunner(nil, chClient.Conn())
+		projectService.SetProvisioner(runner)
+		projectService.SetRetentionEnforcer(runner)
+	}
 	cohortService := cohort.NewService(queries, &kafkaProducerAdapter{kafkaProducer})
 
 	// Initialize recompute worker
@@ -97,19 +152,212 @@ func main() {
 		&clickhouseClientAdapter{chClient},
 		cohortService,
 	)
+	recomputeWorker.SetQueueCapacity(cfg.Recompute.QueueCapacity)
+	recomputeWorker.SetSQLDebug(cohort.SQLDebug{
+		Enabled:     cfg.Recompute.DebugSQL,
+		RedactArgs:  cfg.Recompute.DebugSQLRedactArgs,
+		AttachToJob: cfg.Recompute.DebugSQLOnJobs,
+	})
+	recomputeWorker.SetApproxSampleRate(cfg.Recompute.ApproxSampleRate)
+	recomputeWorker.SetPreviewSampleSize(cfg.Recompute.PreviewSampleSize)
+	aggregateFunctions, err := cohort.ParseAggregateFunctions(cfg.Cohort.AggregateFunctions)
+	if err != nil {
+		log.Fatalf("invalid COHORT_AGGREGATE_FUNCTIONS: %v", err)
+	}
+	recomputeWorker.SetAggregateFunctions(aggregateFunctions)
+	recomputeWorker.SetHysteresis(cfg.Recompute.Hysteresis)
+	recomputeWorker.SetJobRetention(cfg.Recompute.JobRetention)
+	recomputeWorker.SetMembershipOverrideSource(&membershipOverrideAdapter{membershipRepo})
+	if cfg.Recompute.ProduceChanges {
+		recomputeWorker.SetChangeProducer(&membershipChangeProducerAdapter{kafkaProducer}, cfg.Recompute.ProduceBatchSize)
+	}
 	cohortService.SetRecomputeWorker(recomputeWorker)
+	recomputeWorker.SetJobRecorder(cohortService)
+
+	// Hash user IDs for consumers that request them, and in every output of
+	// projects that require it
+	var anonymizer *membership.Anonymizer
+	if cfg.Privacy.UserIDHashSecret != "" {
+		anonymizeOverrides := make(map[uuid.UUID]bool, len(cfg.Privacy.AnonymizeUserIDsOverrides))
+		for id, enabled := range cfg.Privacy.AnonymizeUserIDsOverrides {
+			projectID, err := uuid.Parse(id)
+			if err != nil {
+				log.Fatalf("invalid project ID %q in PRIVACY_ANONYMIZE_USER_IDS_OVERRIDES: %v", id, err)
+			}
+			anonymizeOverrides[projectID] = enabled
+		}
+		anonymizer = membership.NewAnonymizer([]byte(cfg.Privacy.UserIDHashSecret), &cohortGetterAdapter{cohortService})
+		anonymizer.SetRequired(cfg.Privacy.AnonymizeUserIDs, anonymizeOverrides)
+	}
+	var changelogExporter *changelogExporterAdapter
+	if cfg.Kafka.ChangelogExportEnabled {
+		exporter := kafka.NewChangelogExporter(cfg.Kafka.Brokers, cfg.Kafka.ChangelogExportTopic)
+		defer exporter.Close()
+		changelogExporter = &changelogExporterAdapter{exporter, anonymizer}
+		recomputeWorker.SetChangelogExporter(changelogExporter)
+	}
+	cohortService.SetSyncRecomputeThreshold(cfg.Recompute.SyncThreshold)
+	cohortService.SetMinRecomputeInterval(cfg.Recompute.MinInterval)
+	cohortLimitOverrides := make(map[uuid.UUID]int, len(cfg.Cohort.MaxPerProjectOverrides))
+	for id, limit := range cfg.Cohort.MaxPerProjectOverrides {
+		projectID, err := uuid.Parse(id)
+		if err != nil {
+			log.Fatalf("invalid project ID %q in COHORT_MAX_PER_PROJECT_OVERRIDES: %v", id, err)
+		}
+		cohortLimitOverrides[projectID] = limit
+	}
+	cohortService.SetMaxCohortsPerProject(cfg.Cohort.MaxPerProject, cohortLimitOverrides)
+	uniqueNameOverrides := make(map[uuid.UUID]bool, len(cfg.Cohort.UniqueNamesOverrides))
+	for id, enabled := range cfg.Cohort.UniqueNamesOverrides {
+		projectID, err := uuid.Parse(id)
+		if err != nil {
+			log.Fatalf("invalid project ID %q in COHORT_UNIQUE_NAMES_OVERRIDES: %v", id, err)
+		}
+		uniqueNameOverrides[projectID] = enabled
+	}
+	cohortService.SetUniqueNames(cfg.Cohort.UniqueNames, uniqueNameOverrides)
+	lowercaseKeyOverrides := make(map[uuid.UUID]bool, len(cfg.Ingest.LowercasePropertyKeysOverrides))
+	for id, enabled := range cfg.Ingest.LowercasePropertyKeysOverrides {
+		projectID, err := uuid.Parse(id)
+		if err != nil {
+			log.Fatalf("invalid project ID %q in INGEST_LOWERCASE_PROPERTY_KEYS_OVERRIDES: %v", id, err)
+		}
+		lowercaseKeyOverrides[projectID] = enabled
+	}
+	cohortService.SetLowercasePropertyKeys(cfg.Ingest.LowercasePropertyKeys, lowercaseKeyOverrides)
+	cohortService.SetRequireProjectScope(cfg.ClickHouse.ProjectIsolation)
+	cohortService.SetDefinitionDedup(cfg.Cohort.DedupDefinitions)
+	cohortService.SetEventNameCatalog(eventRepo)
+	cohortService.SetEventRetentionSource(projectService)
+	cohortService.SetRuleLimits(cohort.RuleLimits{
+		MaxPropertyFilters: cfg.Cohort.MaxPropertyFilters,
+		MaxExcludedUserIDs: cfg.Cohort.MaxExcludedUserIDs,
+	})
+	// Exports may only write to their own topics, never to one the services use
+	exportTopics := cohort.ExportTopicPolicy{
+		Prefix: cfg.Cohort.ExportTopicPrefix,
+		Reserved: []string{
+			cfg.Kafka.EventsTopic,
+			cfg.Kafka.CohortsTopic,
+			cfg.Kafka.ChangesTopic,
+			cfg.Kafka.MembershipTopic,
+			cfg.Kafka.ChangelogExportTopic,
+			cfg.Kafka.DLQTopic,
+		},
+	}
+	cohortService.SetExportTopicPolicy(exportTopics)
 	recomputeWorker.Start(ctx)
 
+	// Initialize membership consistency checker
+	consistencyChecker := cohort.NewConsistencyChecker(
+		&clickhouseClientAdapter{chClient},
+		cohortService,
+		cfg.Recompute.ConsistencyMaxUsers,
+		cfg.Recompute.ConsistencyRepairThrottle,
+	)
+
+	// Initialize per-cohort recompute scheduler
+	recomputeScheduler := cohort.NewRecomputeScheduler(cohortService, cohortService, cfg.Recompute.ScheduleTick)
+	recomputeScheduler.SetMembershipExpirer(recomputeWorker)
+	recomputeScheduler.SetRecomputeHistory(cohortService)
+	recomputeScheduler.Start(ctx)
+
+	// Scheduled and on-demand exports share a bound on concurrent member scans
+	memberExporter := kafka.NewMemberExporter(cfg.Kafka.Brokers)
+	defer memberExporter.Close()
+	exportQueue := cohort.NewExportQueue(
+		&cohortExporterAdapter{membershipRepo, memberExporter, anonymizer},
+		cfg.Cohort.MaxConcurrentExports,
+	)
+	exportQueue.SetTopicPolicy(exportTopics)
+	exportQueue.SetJobRetention(cfg.Cohort.ExportJobRetention)
+
+	// Run scheduled cohort exports
+	if cfg.Cohort.ExportScheduleTick > 0 {
+		exportScheduler := cohort.NewExportScheduler(
+			cohortService,
+			cohortService,
+			exportQueue,
+			cfg.Cohort.ExportScheduleTick,
+		)
+		exportScheduler.Start(ctx)
+	}
+
+	// Compute per-user scores for score conditions
+	if cfg.Cohort.RFMScoreEvent != "" {
+		scoreWorker := cohort.NewScoreWorker(&clickhouseClientAdapter{chClient}, cfg.Cohort.ScoreInterval)
+		scoreWorker.AddRFMScore(cohort.RFMScore{
+			Name:          "rfm",
+			EventName:     cfg.Cohort.RFMScoreEvent,
+			ValueProperty: cfg.Cohort.RFMScoreValueProperty,
+			Window:        cfg.Cohort.RFMScoreWindow,
+		})
+		scoreWorker.Start(ctx)
+	}
+
+	// Recompute cohorts once rapid rule edits have settled
+	if cfg.Recompute.RuleChangeDebounce > 0 {
+		recomputeDebouncer := cohort.NewRecomputeDebouncer(cohortService, cfg.Recompute.RuleChangeDebounce)
+		cohortService.SetRecomputeDebouncer(recomputeDebouncer)
+		recomputeDebouncer.Start(ctx)
+	}
+
 	// Event service no longer writes to ClickHouse directly - inserter-service handles that
 	eventService := event.NewService(&eventRepoAdapter{eventRepo}, &eventProducerAdapter{kafkaProducer})
+	if cfg.Ingest.MissingUserID == "anonymous" {
+		eventService.SetAnonymousUserID(cfg.Ingest.AnonymousUserID)
+	}
+	eventService.SetPropertyLimits(cfg.Ingest.MaxPropertyDepth, cfg.Ingest.MaxPropertyBytes)
+	eventService.SetMaxPropertyCount(cfg.Ingest.MaxPropertyCount)
+	eventService.SetPropertyValueLimits(cfg.Ingest.MaxPropertyValueLength, cfg.Ingest.PropertyValueLengthOverrides, event.OversizedValueAction(cfg.Ingest.OversizedPropertyValues))
+	propertyPolicies, err := event.ParsePropertyPolicies(cfg.Ingest.PropertyPolicies)
+	if err != nil {
+		log.Fatalf("invalid INGEST_PROPERTY_POLICIES: %v", err)
+	}
+	eventService.SetPropertyPolicies(propertyPolicies)
+	eventService.SetLowercaseKeys(cfg.Ingest.LowercasePropertyKeys, lowercaseKeyOverrides)
+	eventService.SetRequireProjectScope(cfg.ClickHouse.ProjectIsolation)
+	if cfg.Ingest.SequenceEvents {
+		eventService.SetSequencer(event.NewSequencer())
+	}
+	eventService.SetAckMode(event.AckMode(cfg.Ingest.AckMode))
+	eventService.SetPersistenceChecker(&eventRepoAdapter{eventRepo}, cfg.Ingest.AckTimeout, cfg.Ingest.AckPollInterval)
+	if cfg.Ingest.LiveEvaluation {
+		liveEvaluator := cohort.NewLiveEvaluator(
+			&clickhouseClientAdapter{chClient},
+			cohortService,
+			&membershipChangeProducerAdapter{kafkaProducer},
+		)
+		liveEvaluator.SetMaxCohorts(cfg.Ingest.LiveEvaluationMaxCohorts)
+		liveEvaluator.SetPropertyFastPath(cfg.Ingest.PropertyFastPath)
+		liveEvaluator.SetAggregateFunctions(aggregateFunctions)
+		if changelogExporter != nil {
+			liveEvaluator.SetChangelogExporter(changelogExporter)
+		}
+		eventService.SetLiveEvaluator(&liveEvaluatorAdapter{liveEvaluator})
+	}
 	membershipService := membership.NewService(
 		&membershipRepoAdapter{membershipRepo},
 		&cohortGetterAdapter{cohortService},
 		&membershipCacheAdapter{membershipCache},
 	)
+	membershipService.SetUserEventDeleter(eventRepo)
+	membershipService.SetProjectCohortLister(&cohortGetterAdapter{cohortService})
+	membershipService.SetMembershipTTLGetter(&cohortGetterAdapter{cohortService})
+	membershipService.SetVariantAssigner(&cohortGetterAdapter{cohortService})
+	membershipService.SetVersionResolver(&cohortGetterAdapter{cohortService})
+	membershipService.SetRequireProjectScope(cfg.ClickHouse.ProjectIsolation)
+	membershipService.SetFallbackPolicy(membership.FallbackPolicy(cfg.ClickHouse.MembershipFallback), cfg.ClickHouse.MembershipFallbackDefault)
+
+	// Snapshot membership so point-in-time checks replay little changelog
+	if cfg.Cohort.MembershipSnapshotInterval > 0 {
+		membership.NewSnapshotter(membershipRepo, cfg.Cohort.MembershipSnapshotInterval).Start(ctx)
+	}
 
 	// Initialize change broadcaster
 	broadcaster := kafka.NewChangesBroadcaster()
+	broadcaster.SetReapThreshold(cfg.Server.StreamReapThreshold)
+	broadcaster.SetStreamGate(cohort.NewStreamSettings(cohortService, cfg.Server.StreamSettingsTTL))
 	go broadcaster.Run(ctx)
 
 	// Initialize Kafka consumer for membership changes
@@ -127,9 +375,32 @@ func main() {
 	membershipHandler := handlers.NewMembershipHandler(membershipService)
 	wsHandler := handlers.NewWebSocketHandler(&broadcasterAdapter{broadcaster})
 	sseHandler := handlers.NewSSEHandler(&broadcasterAdapter{broadcaster})
+	sseHandler.SetRetry(cfg.Server.SSERetry)
+	sseHandler.SetKeepaliveInterval(cfg.Server.SSEKeepaliveInterval)
+	streams := handlers.NewStreamTracker()
+	wsHandler.SetStreamTracker(streams)
+	sseHandler.SetStreamTracker(streams)
 	flinkHandler := handlers.NewFlinkHandler(flinkJobManager)
 	organizationHandler := handlers.NewOrganizationHandler(organizationService)
 	projectHandler := handlers.NewProjectHandler(projectService, organizationService)
+	templateHandler := handlers.NewTemplateHandler(cohortService)
+	exportScheduleHandler := handlers.NewExportScheduleHandler(cohortService)
+	exportScheduleHandler.SetExportQueue(exportQueue)
+	adminHandler := handlers.NewAdminHandler(consistencyChecker)
+	adminHandler.SetOffsetResetter(kafka.NewOffsetResetter(cfg.Kafka.Brokers))
+	adminHandler.SetFailedJobLister(recomputeWorker)
+	adminHandler.SetDriftChecker(cohort.NewDriftChecker(cohortService, recomputeWorker, membershipRepo))
+	adminHandler.SetEventImporter(event.NewImporter(eventService, cfg.Ingest.ImportBatchSize, cfg.Ingest.ImportBatchInterval))
+	adminHandler.SetRawMembershipReader(membershipRepo)
+	adminHandler.SetIngestStatsReader(eventService)
+	adminHandler.SetMembershipOptimizer(cohort.NewMembershipOptimizer(membershipRepo, cohortService, cfg.ClickHouse.OptimizeMinInterval))
+
+	if anonymizer != nil {
+		membershipHandler.SetAnonymizer(anonymizer)
+		cohortHandler.SetAnonymizer(anonymizer)
+		wsHandler.SetAnonymizer(anonymizer)
+		sseHandler.SetAnonymizer(anonymizer)
+	}
 
 	// Initialize context middleware
 	contextMiddleware := middleware.NewContextMiddleware(organizationService, projectService)
@@ -144,8 +415,14 @@ func main() {
 		flinkHandler,
 		organizationHandler,
 		projectHandler,
+		templateHandler,
+		adminHandler,
 		contextMiddleware,
 	)
+	router.SetRequestTimeouts(cfg.Server.RequestTimeout, cfg.Server.AdminRequestTimeout)
+	router.SetAdminToken(cfg.Server.AdminToken)
+	router.SetHealthHandler(healthHandler)
+	router.SetExportScheduleHandler(exportScheduleHandler)
 
 	// Setup Gin engine
 	gin.SetMode(gin.ReleaseMode)
@@ -171,6 +448,33 @@ func main() {
 		}
 	}()
 
+	// Serve membership change streams over gRPC
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort))
+		if err != nil {
+			log.Fatalf("failed to listen for gRPC: %v", err)
+		}
+		grpcOpts := []grpc.ServerOption{grpc.StreamInterceptor(rpc.TokenAuth(cfg.Server.GRPCToken))}
+		if cfg.Server.GRPCTLSCertFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(cfg.Server.GRPCTLSCertFile, cfg.Server.GRPCTLSKeyFile)
+			if err != nil {
+				log.Fatalf("failed to load gRPC TLS certificate: %v", err)
+			}
+			grpcOpts = append(grpcOpts, grpc.Creds(creds))
+		}
+		grpcServer = grpc.NewServer(grpcOpts...)
+		streamServer := rpc.NewMembershipStreamServer(&broadcasterAdapter{broadcaster}, &cohortGetterAdapter{cohortService})
+		streamServer.SetAnonymizer(anonymizer)
+		membershipv1.RegisterMembershipStreamServer(grpcServer, streamServer)
+		go func() {
+			log.Printf("starting gRPC server on %s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -178,13 +482,23 @@ func main() {
 
 	log.Println("shutting down server...")
 
-	// Give outstanding requests 30 seconds to complete
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Give outstanding requests until the shutdown timeout to complete
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
 
+	// Close streaming connections first: the HTTP server doesn't track
+	// hijacked WebSocket connections and would wait out the deadline on SSE
+	if err := streams.Shutdown(shutdownCtx); err != nil {
+		log.Printf("%d streaming connections still open at shutdown: %v", streams.Active(), err)
+	}
+
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server forced to shutdown: %v", err)
 	}
+	// Streams never complete on their own, so they're closed rather than drained
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
 
 	log.Println("server stopped")
 }
@@ -222,11 +536,13 @@ type eventRepoAdapter struct {
 func (a *eventRepoAdapter) Insert(ctx context.Context, e *event.ClickHouseEvent) error {
 	chEvent := &clickhouse.Event{
 		ID:         e.ID,
+		ProjectID:  e.ProjectID,
 		UserID:     e.UserID,
 		EventName:  e.EventName,
 		Properties: e.Properties,
 		Timestamp:  e.Timestamp,
 		ReceivedAt: e.ReceivedAt,
+		Sequence:   e.Sequence,
 	}
 	return a.repo.Insert(ctx, chEvent)
 }
@@ -236,11 +552,13 @@ func (a *eventRepoAdapter) InsertBatch(ctx context.Context, events []*event.Clic
 	for i, e := range events {
 		chEvents[i] = &clickhouse.Event{
 			ID:         e.ID,
+			ProjectID:  e.ProjectID,
 			UserID:     e.UserID,
 			EventName:  e.EventName,
 			Properties: e.Properties,
 			Timestamp:  e.Timestamp,
 			ReceivedAt: e.ReceivedAt,
+			Sequence:   e.Sequence,
 		}
 	}
 	return a.repo.InsertBatch(ctx, chEvents)
@@ -260,6 +578,7 @@ func (a *eventRepoAdapter) GetByUserID(ctx context.Context, userID string, limit
 			Properties: e.Properties,
 			Timestamp:  e.Timestamp,
 			ReceivedAt: e.ReceivedAt,
+			Sequence:   e.Sequence,
 		}
 	}
 	return events, nil
@@ -279,6 +598,7 @@ func (a *eventRepoAdapter) GetByUserIDAndEventName(ctx context.Context, userID,
 			Properties: e.Properties,
 			Timestamp:  e.Timestamp,
 			ReceivedAt: e.ReceivedAt,
+			Sequence:   e.Sequence,
 		}
 	}
 	return events, nil
@@ -288,6 +608,10 @@ func (a *eventRepoAdapter) HasEventInWindow(ctx context.Context, userID, eventNa
 	return a.repo.HasEventInWindow(ctx, userID, eventName, startTime, endTime)
 }
 
+func (a *eventRepoAdapter) EventPersisted(ctx context.Context, userID, eventName string, id uuid.UUID) (bool, error) {
+	return a.repo.EventPersisted(ctx, userID, eventName, id)
+}
+
 func (a *eventRepoAdapter) GetAggregates(ctx context.Context, userID, eventName, propertyPath string, startTime, endTime time.Time) (*event.AggregateResult, error) {
 	result, err := a.repo.GetAggregates(ctx, userID, eventName, propertyPath, startTime, endTime)
 	if err != nil {
@@ -307,8 +631,11 @@ type membershipRepoAdapter struct {
 	repo *clickhouse.MembershipRepository
 }
 
-func (a *membershipRepoAdapter) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string) (*membership.StoredMembership, error) {
-	m, err := a.repo.GetByCohortAndUser(ctx, cohortID, userID)
+func (a *membershipRepoAdapter) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*membership.StoredMembership, error) {
+	m, err := a.repo.GetByCohortAndUser(ctx, cohortID, userID, ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, membership.ErrMembershipNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -323,6 +650,7 @@ func (a *membershipRepoAdapter) GetByCohortAndUser(ctx context.Context, cohortID
 		JoinedAt:  m.JoinedAt,
 		UpdatedAt: m.JoinedAt, // CollapsingMergeTree doesn't track updated_at
 		Version:   0,
+		Variant:   m.Variant,
 	}, nil
 }
 
@@ -330,16 +658,22 @@ func (a *membershipRepoAdapter) GetUserCohorts(ctx context.Context, userID strin
 	return a.repo.GetUserCohorts(ctx, userID)
 }
 
-func (a *membershipRepoAdapter) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int) ([]membership.StoredMember, int64, error) {
-	members, total, err := a.repo.GetCohortMembers(ctx, cohortID, limit, offset)
+func (a *membershipRepoAdapter) GetSharedCohorts(ctx context.Context, userIDs []string) ([]uuid.UUID, error) {
+	return a.repo.GetSharedCohorts(ctx, userIDs)
+}
+
+func (a *membershipRepoAdapter) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int, ttl time.Duration, lastActive bool, variant string) ([]membership.StoredMember, int64, error) {
+	members, total, err := a.repo.GetCohortMembers(ctx, cohortID, limit, offset, ttl, lastActive, variant)
 	if err != nil {
 		return nil, 0, err
 	}
 	storedMembers := make([]membership.StoredMember, len(members))
 	for i, m := range members {
 		storedMembers[i] = membership.StoredMember{
-			UserID:   m.UserID,
-			JoinedAt: m.JoinedAt,
+			UserID:       m.UserID,
+			JoinedAt:     m.JoinedAt,
+			Variant:      m.Variant,
+			LastActiveAt: m.LastActiveAt,
 		}
 	}
 	return storedMembers, total, nil
@@ -349,6 +683,108 @@ func (a *membershipRepoAdapter) GetCohortMemberCount(ctx context.Context, cohort
 	return a.repo.GetCohortMemberCount(ctx, cohortID)
 }
 
+func (a *membershipRepoAdapter) CountMembersByProperty(ctx context.Context, cohortID uuid.UUID, property string, limit int) ([]membership.PropertyValueCount, error) {
+	counts, err := a.repo.CountMembersByProperty(ctx, cohortID, property, limit)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]membership.PropertyValueCount, len(counts))
+	for i, pc := range counts {
+		values[i] = membership.PropertyValueCount{
+			Value:   pc.Value,
+			Members: int64(pc.Members),
+		}
+	}
+	return values, nil
+}
+
+func (a *membershipRepoAdapter) WasMemberAt(ctx context.Context, cohortID uuid.UUID, userID string, at time.Time) (bool, error) {
+	return a.repo.WasMemberAt(ctx, cohortID, userID, at)
+}
+
+func (a *membershipRepoAdapter) GetCohortMembersAt(ctx context.Context, cohortID uuid.UUID, at time.Time, limit, offset int) ([]string, int64, error) {
+	return a.repo.GetCohortMembersAt(ctx, cohortID, at, limit, offset)
+}
+
+func (a *membershipRepoAdapter) CountMembersByPropertyRange(ctx context.Context, cohortID uuid.UUID, property string, boundaries []float64) ([]membership.BucketCount, error) {
+	counts, err := a.repo.CountMembersByPropertyRange(ctx, cohortID, property, boundaries)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]membership.BucketCount, len(counts))
+	for i, bc := range counts {
+		buckets[i] = membership.BucketCount{
+			Bucket:  int(bc.Bucket),
+			Members: int64(bc.Members),
+		}
+	}
+	return buckets, nil
+}
+
+func (a *membershipRepoAdapter) GetUsersInAllCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	return a.repo.GetUsersInAllCohorts(ctx, cohortIDs, limit, offset)
+}
+
+func (a *membershipRepoAdapter) GetUsersInNoCohorts(ctx context.Context, cohortIDs, universe []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	return a.repo.GetUsersInNoCohorts(ctx, cohortIDs, universe, limit, offset)
+}
+
+func (a *membershipRepoAdapter) GetMembersInCohorts(ctx context.Context, cohortIDs []uuid.UUID, intersect bool, limit, offset int) ([]string, int64, error) {
+	return a.repo.GetMembersInCohorts(ctx, cohortIDs, intersect, limit, offset)
+}
+
+func (a *membershipRepoAdapter) DeleteUserMemberships(ctx context.Context, userID string, cohortIDs []uuid.UUID) error {
+	return a.repo.DeleteUserMemberships(ctx, userID, cohortIDs)
+}
+
+func (a *membershipRepoAdapter) ForEachCohortMember(ctx context.Context, cohortID uuid.UUID, fn func(userID string) error) error {
+	return a.repo.ForEachCohortMember(ctx, cohortID, fn)
+}
+
+func (a *membershipRepoAdapter) SetOverride(ctx context.Context, cohortID uuid.UUID, userID string, status int8, at time.Time) error {
+	return a.repo.SetOverride(ctx, &clickhouse.MembershipOverride{
+		CohortID:  cohortID,
+		UserID:    userID,
+		Status:    clickhouse.MembershipStatus(status),
+		CreatedAt: at,
+	})
+}
+
+func (a *membershipRepoAdapter) ApplyChange(ctx context.Context, change *membership.MembershipChange) error {
+	return a.repo.ApplyChange(ctx, &clickhouse.MembershipChange{
+		CohortID:     change.CohortID,
+		CohortName:   change.CohortName,
+		UserID:       change.UserID,
+		PrevStatus:   clickhouse.MembershipStatus(change.PrevStatus),
+		NewStatus:    clickhouse.MembershipStatus(change.NewStatus),
+		ChangedAt:    change.ChangedAt,
+		TriggerEvent: change.TriggerEvent,
+		Reason:       string(change.Reason),
+		Variant:      change.Variant,
+	})
+}
+
+// membershipOverrideAdapter adapts the membership repository for the recompute worker
+type membershipOverrideAdapter struct {
+	repo *clickhouse.MembershipRepository
+}
+
+func (a *membershipOverrideAdapter) GetOverrides(ctx context.Context, cohortID uuid.UUID) (map[string]int8, error) {
+	overrides, err := a.repo.GetOverrides(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int8, len(overrides))
+	for _, o := range overrides {
+		result[o.UserID] = int8(o.Status)
+	}
+	return result, nil
+}
+
+func (a *membershipOverrideAdapter) ClearOverrides(ctx context.Context, cohortID uuid.UUID) error {
+	return a.repo.ClearOverrides(ctx, cohortID)
+}
+
 type cohortGetterAdapter struct {
 	service *cohort.Service
 }
@@ -361,6 +797,67 @@ func (a *cohortGetterAdapter) GetCohortName(ctx context.Context, id uuid.UUID) (
 	return c.Name, nil
 }
 
+func (a *cohortGetterAdapter) ListProjectCohortIDs(ctx context.Context, projectID uuid.UUID, includeArchived bool) ([]uuid.UUID, error) {
+	cohorts, err := a.service.List(ctx, projectID, math.MaxInt32, 0, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(cohorts))
+	for i, c := range cohorts {
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+func (a *cohortGetterAdapter) GetCohortSummary(ctx context.Context, id uuid.UUID) (*membership.CohortSummary, error) {
+	c, err := a.service.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &membership.CohortSummary{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+		Status:      string(c.Status),
+		Version:     c.Version,
+	}, nil
+}
+
+func (a *cohortGetterAdapter) GetMembershipTTL(ctx context.Context, id uuid.UUID) (time.Duration, error) {
+	c, err := a.service.GetByID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return c.MembershipLifetime(), nil
+}
+
+func (a *cohortGetterAdapter) AssignVariant(ctx context.Context, id uuid.UUID, userID string) (string, error) {
+	c, err := a.service.GetByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return cohort.AssignVariant(c.ID, userID, c.Variants), nil
+}
+
+func (a *cohortGetterAdapter) VersionRecomputedAt(ctx context.Context, id uuid.UUID, version int64) (time.Time, error) {
+	at, err := a.service.VersionRecomputedAt(ctx, id, version)
+	if errors.Is(err, cohort.ErrCohortNotFound) {
+		return time.Time{}, membership.ErrCohortNotFound
+	}
+	if errors.Is(err, cohort.ErrVersionNotRecomputed) {
+		return time.Time{}, membership.ErrVersionNotRecomputed
+	}
+	return at, err
+}
+
+func (a *cohortGetterAdapter) GetCohortProjectID(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	c, err := a.service.GetByID(ctx, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return c.ProjectID, nil
+}
+
 type membershipCacheAdapter struct {
 	cache *cache.MembershipCache
 }
@@ -373,6 +870,7 @@ func (a *membershipCacheAdapter) GetMembership(ctx context.Context, cohortID uui
 	return &membership.CachedMembership{
 		IsMember: cached.IsMember,
 		JoinedAt: cached.JoinedAt,
+		Variant:  cached.Variant,
 	}, true
 }
 
@@ -380,6 +878,7 @@ func (a *membershipCacheAdapter) SetMembership(ctx context.Context, cohortID uui
 	return a.cache.SetMembership(ctx, cohortID, userID, &cache.CachedMembership{
 		IsMember: m.IsMember,
 		JoinedAt: m.JoinedAt,
+		Variant:  m.Variant,
 	})
 }
 
@@ -433,6 +932,8 @@ func (a *broadcasterAdapter) Subscribe(id string, sub *membership.StreamSubscrip
 				NewStatus:    membership.MembershipStatus(change.NewStatus),
 				ChangedAt:    change.ChangedAt,
 				TriggerEvent: change.TriggerEvent,
+				Reason:       membership.ChangeReason(change.Reason),
+				Variant:      change.Variant,
 			}
 		}
 		close(ch)
@@ -445,6 +946,144 @@ func (a *broadcasterAdapter) Unsubscribe(id string) {
 	a.broadcaster.Unsubscribe(id)
 }
 
+// changelogExporterAdapter adapts the Kafka changelog exporter for the
+// recompute worker, hashing user IDs of projects that require it
+type changelogExporterAdapter struct {
+	exporter   *kafka.ChangelogExporter
+	anonymizer *membership.Anonymizer
+}
+
+func (a *changelogExporterAdapter) ExportChangelog(ctx context.Context, entries []cohort.ChangelogEntry) error {
+	kafkaEntries := make([]kafka.ChangelogEntry, len(entries))
+	for i, e := range entries {
+		change, err := a.anonymizer.ProtectChange(ctx, &membership.MembershipChange{CohortID: e.CohortID, UserID: e.UserID}, false)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize changelog entry: %w", err)
+		}
+		kafkaEntries[i] = kafka.ChangelogEntry{
+			CohortID:   e.CohortID,
+			UserID:     change.UserID,
+			PrevStatus: e.PrevStatus,
+			NewStatus:  e.NewStatus,
+			ChangedAt:  e.ChangedAt,
+			Reason:     string(e.Reason),
+			Variant:    e.Variant,
+		}
+	}
+	return a.exporter.Export(ctx, kafkaEntries)
+}
+
+// cohortExporterAdapter streams a cohort's members from ClickHouse to the
+// Kafka topic named by a kafka:// export destination, hashing user IDs of
+// projects that require it
+type cohortExporterAdapter struct {
+	repo       *clickhouse.MembershipRepository
+	exporter   *kafka.MemberExporter
+	anonymizer *membership.Anonymizer
+}
+
+// memberExportBatchSize is how many members are produced per Kafka write
+const memberExportBatchSize = 1000
+
+func (a *cohortExporterAdapter) ExportCohort(ctx context.Context, c *cohort.Cohort, destination string) (int64, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme != "kafka" {
+		return 0, fmt.Errorf("unsupported export destination %q", destination)
+	}
+	topic := u.Host + u.Path
+
+	exportedAt := time.Now().UTC()
+	var exported int64
+	batch := make([]kafka.MemberExportRecord, 0, memberExportBatchSize)
+	flush := func() error {
+		if err := a.exporter.Export(ctx, topic, batch); err != nil {
+			return err
+		}
+		exported += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	anonymize := a.anonymizer.Required(c.ProjectID)
+	err = a.repo.ForEachCohortMember(ctx, c.ID, func(userID string) error {
+		if anonymize {
+			userID = a.anonymizer.Token(c.ProjectID, userID)
+		}
+		batch = append(batch, kafka.MemberExportRecord{
+			CohortID:   c.ID,
+			CohortName: c.Name,
+			UserID:     userID,
+			ExportedAt: exportedAt,
+		})
+		if len(batch) < memberExportBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, flush()
+}
+
+// membershipChangeProducerAdapter adapts the Kafka producer for the live evaluator
+type membershipChangeProducerAdapter struct {
+	producer *kafka.Producer
+}
+
+func (a *membershipChangeProducerAdapter) ProduceMembershipChange(ctx context.Context, change cohort.LiveMembershipChange) error {
+	triggerEvent := change.TriggerEventID
+	return a.producer.ProduceMembershipChange(ctx, &membership.MembershipChange{
+		CohortID:     change.CohortID,
+		CohortName:   change.CohortName,
+		UserID:       change.UserID,
+		PrevStatus:   membership.MembershipStatus(change.PrevStatus),
+		NewStatus:    membership.MembershipStatus(change.NewStatus),
+		ChangedAt:    change.ChangedAt,
+		TriggerEvent: &triggerEvent,
+		Reason:       membership.ChangeReason(change.Reason),
+		Variant:      change.Variant,
+	})
+}
+
+func (a *membershipChangeProducerAdapter) ProduceMembershipChanges(ctx context.Context, cohortName string, changes []cohort.ChangelogEntry) error {
+	kafkaChanges := make([]*membership.MembershipChange, len(changes))
+	for i, c := range changes {
+		kafkaChanges[i] = &membership.MembershipChange{
+			CohortID:   c.CohortID,
+			CohortName: cohortName,
+			UserID:     c.UserID,
+			PrevStatus: membership.MembershipStatus(c.PrevStatus),
+			NewStatus:  membership.MembershipStatus(c.NewStatus),
+			ChangedAt:  c.ChangedAt,
+			Reason:     membership.ChangeReason(c.Reason),
+			Variant:    c.Variant,
+		}
+	}
+	return a.producer.ProduceMembershipChanges(ctx, kafkaChanges)
+}
+
+// liveEvaluatorAdapter adapts the cohort live evaluator for the event service
+type liveEvaluatorAdapter struct {
+	evaluator *cohort.LiveEvaluator
+}
+
+func (a *liveEvaluatorAdapter) EvaluateEvent(ctx context.Context, e *event.Event) error {
+	_, err := a.evaluator.Evaluate(ctx, cohort.LiveEvent{
+		ID:         e.ID,
+		ProjectID:  e.ProjectID,
+		UserID:     e.UserID,
+		EventName:  e.EventName,
+		Properties: e.Properties,
+		Timestamp:  e.Timestamp,
+		Sequence:   e.Sequence,
+	})
+	return err
+}
+
 // clickhouseClientAdapter adapts the clickhouse.Client for the recompute worker
 type clickhouseClientAdapter struct {
 	client *clickhouse.Client
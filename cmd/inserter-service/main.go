@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
 	"github.com/pjhul/intent/internal/inserter"
 )
 
@@ -20,6 +21,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -30,6 +34,16 @@ func main() {
 		log.Fatalf("failed to connect to ClickHouse: %v", err)
 	}
 	defer chClient.Close()
+	chClient.SetProjectIsolation(cfg.ClickHouse.ProjectIsolation)
+	chClient.SetSlowQueryThreshold(cfg.ClickHouse.SlowQueryThreshold)
+
+	// Fail fast if no Kafka broker is reachable
+	checkCtx, checkCancel := context.WithTimeout(ctx, cfg.KafkaConnectTimeout)
+	err = kafka.NewBrokerChecker(cfg.KafkaConnectTimeout).Check(checkCtx, cfg.KafkaBrokers)
+	checkCancel()
+	if err != nil {
+		log.Fatalf("failed to connect to Kafka: %v", err)
+	}
 
 	// Create and start service
 	service := inserter.NewService(cfg, chClient)
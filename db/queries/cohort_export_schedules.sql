@@ -0,0 +1,29 @@
+-- name: GetCohortExportSchedule :one
+SELECT id, cohort_id, destination, cron, last_run_at, last_status, last_error, last_exported_count, created_at, updated_at
+FROM cohort_export_schedules
+WHERE id = $1;
+
+-- name: ListCohortExportSchedules :many
+SELECT id, cohort_id, destination, cron, last_run_at, last_status, last_error, last_exported_count, created_at, updated_at
+FROM cohort_export_schedules
+WHERE cohort_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListAllCohortExportSchedules :many
+SELECT id, cohort_id, destination, cron, last_run_at, last_status, last_error, last_exported_count, created_at, updated_at
+FROM cohort_export_schedules
+ORDER BY created_at ASC;
+
+-- name: CreateCohortExportSchedule :one
+INSERT INTO cohort_export_schedules (cohort_id, destination, cron)
+VALUES ($1, $2, $3)
+RETURNING id, cohort_id, destination, cron, last_run_at, last_status, last_error, last_exported_count, created_at, updated_at;
+
+-- name: RecordCohortExportRun :exec
+UPDATE cohort_export_schedules
+SET last_run_at = $2, last_status = $3, last_error = $4, last_exported_count = $5
+WHERE id = $1;
+
+-- name: DeleteCohortExportSchedule :exec
+DELETE FROM cohort_export_schedules
+WHERE id = $1;
@@ -0,0 +1,19 @@
+-- name: GetCohortTemplate :one
+SELECT id, project_id, name, description, rules, parameters, created_at, updated_at
+FROM cohort_templates
+WHERE id = $1;
+
+-- name: ListCohortTemplates :many
+SELECT id, project_id, name, description, rules, parameters, created_at, updated_at
+FROM cohort_templates
+WHERE project_id = $1
+ORDER BY name ASC;
+
+-- name: CreateCohortTemplate :one
+INSERT INTO cohort_templates (project_id, name, description, rules, parameters)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, project_id, name, description, rules, parameters, created_at, updated_at;
+
+-- name: DeleteCohortTemplate :exec
+DELETE FROM cohort_templates
+WHERE id = $1;
@@ -1,68 +1,90 @@
 -- name: GetCohort :one
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
 WHERE id = $1;
 
 -- name: GetCohortByName :one
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE project_id = $1 AND name = $2;
 
 -- name: ListCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
-WHERE project_id = $1
+WHERE project_id = $1 AND (status <> 'archived' OR sqlc.arg(include_archived)::boolean)
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3;
 
 -- name: ListCohortsByStatus :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
 WHERE project_id = $1 AND status = $2
 ORDER BY created_at DESC
 LIMIT $3 OFFSET $4;
 
 -- name: ListActiveCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE project_id = $1 AND status = 'active'
 ORDER BY created_at DESC;
 
 -- name: ListAllActiveCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE status = 'active'
 ORDER BY created_at DESC;
 
 -- name: CreateCohort :one
-INSERT INTO cohorts (project_id, name, description, rules, status, version)
-VALUES ($1, $2, $3, $4, $5, 1)
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at;
+INSERT INTO cohorts (project_id, name, description, rules, status, version, recompute_interval, membership_ttl, stream_enabled, variants, cohort_type)
+VALUES ($1, $2, $3, $4, $5, 1, $6, $7, $8, $9, $10)
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type;
 
 -- name: UpdateCohort :one
 UPDATE cohorts
-SET name = $2, description = $3, rules = $4, version = version + 1
+SET name = $2, description = $3, rules = $4, recompute_interval = $5, needs_recompute = $6, membership_ttl = $7, stream_enabled = $8, variants = $9, version = version + 1
 WHERE id = $1
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at;
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type;
 
 -- name: UpdateCohortStatus :one
 UPDATE cohorts
 SET status = $2
 WHERE id = $1
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at;
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type;
 
--- name: DeleteCohort :exec
-DELETE FROM cohorts
+-- name: ClearCohortNeedsRecompute :exec
+UPDATE cohorts
+SET needs_recompute = FALSE
+WHERE id = $1 AND version = $2;
+
+-- name: ArchiveCohort :exec
+UPDATE cohorts
+SET status = 'archived', deleted_at = NOW()
 WHERE id = $1;
 
+-- name: RestoreCohort :exec
+UPDATE cohorts
+SET status = 'inactive', deleted_at = NULL
+WHERE id = $1 AND status = 'archived';
+
 -- name: CountCohorts :one
-SELECT COUNT(*) FROM cohorts WHERE project_id = $1;
+SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND status <> 'archived';
+
+-- name: CountCohortsByName :one
+SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND name = $2 AND id IS DISTINCT FROM $3 AND status <> 'archived';
+
+-- name: ListCohortNameCollisions :many
+SELECT name, COUNT(*) AS count
+FROM cohorts
+WHERE project_id = $1 AND status <> 'archived'
+GROUP BY name
+HAVING COUNT(*) > 1
+ORDER BY name;
 
 -- name: CountCohortsByStatus :one
 SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND status = $2;
 
 -- name: GetCohortsUpdatedAfter :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE updated_at > $1
 ORDER BY updated_at ASC;
@@ -1,22 +1,22 @@
 -- name: GetProject :one
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE id = $1;
 
 -- name: GetProjectBySlug :one
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE organization_id = $1 AND slug = $2;
 
 -- name: ListProjects :many
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE organization_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3;
 
 -- name: ListAllProjects :many
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2;
@@ -24,13 +24,13 @@ LIMIT $1 OFFSET $2;
 -- name: CreateProject :one
 INSERT INTO projects (organization_id, name, slug, description)
 VALUES ($1, $2, $3, $4)
-RETURNING id, organization_id, name, slug, description, created_at, updated_at;
+RETURNING id, organization_id, name, slug, description, created_at, updated_at, event_retention_days;
 
 -- name: UpdateProject :one
 UPDATE projects
-SET name = $2, slug = $3, description = $4
+SET name = $2, slug = $3, description = $4, event_retention_days = $5
 WHERE id = $1
-RETURNING id, organization_id, name, slug, description, created_at, updated_at;
+RETURNING id, organization_id, name, slug, description, created_at, updated_at, event_retention_days;
 
 -- name: DeleteProject :exec
 DELETE FROM projects
@@ -0,0 +1,18 @@
+-- name: RecordRecomputeJob :exec
+INSERT INTO recompute_job_history (id, cohort_id, status, reason, members_found, members_added, members_removed, error, started_at, completed_at, cohort_version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetVersionRecomputedAt :one
+SELECT completed_at
+FROM recompute_job_history
+WHERE cohort_id = $1 AND cohort_version = $2 AND status = 'completed'
+ORDER BY completed_at DESC
+LIMIT 1;
+
+-- name: ListRecomputeJobHistory :many
+SELECT id, cohort_id, status, reason, members_found, members_added, members_removed, error, started_at, completed_at, created_at, cohort_version
+FROM recompute_job_history
+WHERE cohort_id = $1
+ORDER BY completed_at DESC
+LIMIT $2;
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/domain/event"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+)
+
+// FailedJobLister lists failed recompute jobs across all cohorts
+type FailedJobLister interface {
+	FailedJobs(since time.Time, limit int) []*cohort.RecomputeJob
+}
+
+// RawMembershipReader reads the unmerged rows stored for a membership
+type RawMembershipReader interface {
+	GetRawMembership(ctx context.Context, cohortID uuid.UUID, userID string) (*clickhouse.RawMembership, error)
+}
+
+// IngestStatsReader reports counters kept by event ingestion
+type IngestStatsReader interface {
+	PropertyValueLimitStats() event.PropertyValueLimitStats
+}
+
+// AdminHandler handles operational HTTP requests
+type AdminHandler struct {
+	consistencyChecker *cohort.ConsistencyChecker
+	offsetResetter     *kafka.OffsetResetter
+	failedJobs         FailedJobLister
+	driftChecker       *cohort.DriftChecker
+	optimizer          *cohort.MembershipOptimizer
+	importer           *event.Importer
+	rawMembership      RawMembershipReader
+	ingestStats        IngestStatsReader
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(consistencyChecker *cohort.ConsistencyChecker) *AdminHandler {
+	return &AdminHandler{consistencyChecker: consistencyChecker}
+}
+
+// SetOffsetResetter enables resetting consumer group offsets
+func (h *AdminHandler) SetOffsetResetter(resetter *kafka.OffsetResetter) {
+	h.offsetResetter = resetter
+}
+
+// SetFailedJobLister enables listing failed recompute jobs
+func (h *AdminHandler) SetFailedJobLister(lister FailedJobLister) {
+	h.failedJobs = lister
+}
+
+// ListRecomputeFailures returns recent failed recompute jobs across all
+// cohorts, newest first. since is an RFC 3339 timestamp defaulting to 24 hours ago.
+// GET /admin/recompute/failures
+func (h *AdminHandler) ListRecomputeFailures(c *gin.Context) {
+	if h.failedJobs == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "recompute failures are not available"})
+		return
+	}
+
+	since := time.Now().UTC().Add(-24 * time.Hour)
+	if raw := c.Query("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		since = parsed
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	jobs := h.failedJobs.FailedJobs(since, limit)
+	if jobs == nil {
+		jobs = []*cohort.RecomputeJob{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"since": since,
+	})
+}
+
+// SetDriftChecker enables reporting drift between cohort rules and stored membership
+func (h *AdminHandler) SetDriftChecker(checker *cohort.DriftChecker) {
+	h.driftChecker = checker
+}
+
+// GetDrift compares how many users a cohort's rules match now with its
+// stored member count, signaling whether a recompute is needed
+// GET /admin/cohorts/:id/drift
+func (h *AdminHandler) GetDrift(c *gin.Context) {
+	if h.driftChecker == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "drift checks are not available"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	report, err := h.driftChecker.Check(c.Request.Context(), id)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// SetMembershipOptimizer enables force-merging cohort membership partitions
+func (h *AdminHandler) SetMembershipOptimizer(optimizer *cohort.MembershipOptimizer) {
+	h.optimizer = optimizer
+}
+
+// OptimizeMembership force-merges the membership partitions holding a
+// cohort's rows, reclaiming space after large recomputes
+// POST /admin/cohorts/:id/optimize
+func (h *AdminHandler) OptimizeMembership(c *gin.Context) {
+	if h.optimizer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "membership optimize is not available"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	report, err := h.optimizer.Optimize(c.Request.Context(), id)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if err == cohort.ErrOptimizeInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err == cohort.ErrOptimizeThrottled {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// SetRawMembershipReader enables inspecting the raw rows stored for a membership
+func (h *AdminHandler) SetRawMembershipReader(reader RawMembershipReader) {
+	h.rawMembership = reader
+}
+
+// GetRawMembership returns every row stored for a user's membership in a
+// cohort, with their signs, versions, timestamps and parts, to diagnose
+// overcounting from rows merges haven't collapsed yet. It is served with the
+// other operator endpoints under /api/v1/admin rather than the project's
+// cohort routes, so it needs the admin token and no project scope.
+// GET /admin/cohorts/:id/members/:userId/raw
+func (h *AdminHandler) GetRawMembership(c *gin.Context) {
+	if h.rawMembership == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "raw membership is not available"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	raw, err := h.rawMembership.GetRawMembership(c.Request.Context(), id, c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, raw)
+}
+
+// SetEventImporter enables bulk importing historical events
+func (h *AdminHandler) SetEventImporter(importer *event.Importer) {
+	h.importer = importer
+}
+
+// ImportEvents starts importing newline-delimited JSON events into a project,
+// either uploaded as the multipart field "file" or downloaded from the "url"
+// in a JSON body, such as a presigned object storage URL. The import runs in
+// the background; its progress is polled with GetImport.
+// POST /admin/projects/:id/events/import
+func (h *AdminHandler) ImportEvents(c *gin.Context) {
+	if h.importer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "event import is not available"})
+		return
+	}
+
+	projectID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project ID"})
+		return
+	}
+
+	if c.ContentType() == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		upload, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer upload.Close()
+
+		// Uploads are removed once the request ends, so the background
+		// import reads its own copy
+		file, err := spoolUpload(upload)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, h.importer.Start(c.Request.Context(), projectID, header.Filename, file))
+		return
+	}
+
+	var req struct {
+		URL string `json:"url" binding:"required,url"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	imp, err := h.importer.StartURL(c.Request.Context(), projectID, req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, imp)
+}
+
+// GetImport reports the progress of an event import
+// GET /admin/imports/:id
+func (h *AdminHandler) GetImport(c *gin.Context) {
+	if h.importer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "event import is not available"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import ID"})
+		return
+	}
+
+	imp, err := h.importer.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, imp)
+}
+
+// SetIngestStatsReader enables reporting ingestion counters
+func (h *AdminHandler) SetIngestStatsReader(reader IngestStatsReader) {
+	h.ingestStats = reader
+}
+
+// GetIngestStats reports how many property values ingestion has truncated or
+// rejected for exceeding their length limit
+// GET /admin/ingest/stats
+func (h *AdminHandler) GetIngestStats(c *gin.Context) {
+	if h.ingestStats == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "ingest stats are not available"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"property_values": h.ingestStats.PropertyValueLimitStats()})
+}
+
+// spooledFile is a temporary copy of an upload, removed when closed
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// spoolUpload copies an upload to a temporary file
+func spoolUpload(upload io.Reader) (io.ReadCloser, error) {
+	file, err := os.CreateTemp("", "event-import-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	spooled := spooledFile{file}
+	if _, err := io.Copy(file, upload); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+// CheckConsistency compares a cohort's changelog with its current membership,
+// repairing discrepancies when ?repair=true
+// POST /admin/cohorts/:id/consistency-check
+func (h *AdminHandler) CheckConsistency(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	repair := c.Query("repair") == "true"
+
+	report, err := h.consistencyChecker.Check(c.Request.Context(), id, repair)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if err == cohort.ErrConsistencyCheckInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ResetConsumerOffsets moves a consumer group's offsets for a topic to the
+// earliest or latest offset, a timestamp, or a specific offset. The group's
+// consumers must be stopped first.
+// POST /admin/kafka/consumer-groups/:group/offsets
+func (h *AdminHandler) ResetConsumerOffsets(c *gin.Context) {
+	if h.offsetResetter == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "offset reset is not configured"})
+		return
+	}
+
+	var req kafka.OffsetReset
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.GroupID = c.Param("group")
+
+	offsets, err := h.offsetResetter.Reset(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, kafka.ErrInvalidOffsetReset) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, kafka.ErrTopicNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_id": req.GroupID,
+		"topic":    req.Topic,
+		"offsets":  offsets,
+	})
+}
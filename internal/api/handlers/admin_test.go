@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/handlers"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAdminHandler_ListRecomputeFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockGetter := mocks.NewMockCohortGetter(ctrl)
+	mockGetter.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")).AnyTimes()
+	worker := cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), mockGetter)
+
+	// Two recent failures, one failure outside the window and one pending job
+	older := cohort.NewRecomputeJob(uuid.New())
+	newer := cohort.NewRecomputeJob(uuid.New())
+	stale := cohort.NewRecomputeJob(uuid.New())
+	for _, job := range []*cohort.RecomputeJob{older, newer, stale} {
+		worker.RunJob(context.Background(), job)
+	}
+	now := time.Now().UTC()
+	olderAt, newerAt, staleAt := now.Add(-time.Hour), now.Add(-time.Minute), now.Add(-48*time.Hour)
+	older.CompletedAt, newer.CompletedAt, stale.CompletedAt = &olderAt, &newerAt, &staleAt
+	if err := worker.SubmitJob(cohort.NewRecomputeJob(uuid.New())); err != nil {
+		t.Fatalf("SubmitJob() returned error: %v", err)
+	}
+
+	h := handlers.NewAdminHandler(nil)
+	h.SetFailedJobLister(worker)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/admin/recompute/failures", h.ListRecomputeFailures)
+
+	since := url.QueryEscape(now.Add(-24 * time.Hour).Format(time.RFC3339))
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/recompute/failures?since="+since, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var body struct {
+		Jobs []cohort.RecomputeJob `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expected := []uuid.UUID{newer.ID, older.ID}
+	if len(body.Jobs) != len(expected) {
+		t.Fatalf("jobs = %d, expected %d", len(body.Jobs), len(expected))
+	}
+	for i, job := range body.Jobs {
+		if job.ID != expected[i] {
+			t.Errorf("jobs[%d].ID = %s, expected %s", i, job.ID, expected[i])
+		}
+		if job.Status != cohort.RecomputeStatusFailed || job.Error == "" {
+			t.Errorf("jobs[%d] = %s with error %q, expected a failed job with an error", i, job.Status, job.Error)
+		}
+	}
+
+	t.Run("invalid since", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/recompute/failures?since=yesterday", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, expected %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
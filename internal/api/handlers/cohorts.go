@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -8,11 +9,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/pjhul/intent/internal/api/middleware"
 	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/domain/membership"
 )
 
 // CohortHandler handles cohort-related HTTP requests
 type CohortHandler struct {
-	service *cohort.Service
+	service    *cohort.Service
+	anonymizer *membership.Anonymizer
 }
 
 // NewCohortHandler creates a new cohort handler
@@ -20,7 +23,14 @@ func NewCohortHandler(service *cohort.Service) *CohortHandler {
 	return &CohortHandler{service: service}
 }
 
-// List returns all cohorts for a project with pagination
+// SetAnonymizer enables ?anonymize=true on the user sample of rules previews,
+// and hashes it regardless for projects that require it
+func (h *CohortHandler) SetAnonymizer(anonymizer *membership.Anonymizer) {
+	h.anonymizer = anonymizer
+}
+
+// List returns all cohorts for a project with pagination. Archived cohorts
+// are left out unless ?include_archived=true.
 // GET /organizations/:orgSlug/projects/:projectSlug/cohorts
 func (h *CohortHandler) List(c *gin.Context) {
 	projectID, ok := middleware.GetProjectID(c)
@@ -36,7 +46,36 @@ func (h *CohortHandler) List(c *gin.Context) {
 		limit = 100
 	}
 
-	cohorts, err := h.service.List(c.Request.Context(), projectID, limit, offset)
+	cohorts, err := h.service.List(c.Request.Context(), projectID, limit, offset, c.Query("include_archived") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cohorts": cohorts,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// ListArchived returns a project's archived cohorts with pagination
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/archived
+func (h *CohortHandler) ListArchived(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	if limit > 100 {
+		limit = 100
+	}
+
+	cohorts, err := h.service.ListArchived(c.Request.Context(), projectID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -49,7 +88,70 @@ func (h *CohortHandler) List(c *gin.Context) {
 	})
 }
 
-// Get retrieves a specific cohort by ID
+// NameCollisions lists cohort names used by more than one cohort in a project
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/name-collisions
+func (h *CohortHandler) NameCollisions(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	collisions, err := h.service.ListNameCollisions(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collisions": collisions})
+}
+
+// Preview counts the users a set of rules would match now, without saving a
+// cohort, with a capped sample of their IDs flagged as truncated when more
+// users match, along with lint warnings about the rules. The sample goes
+// through the same anonymization as membership listings; this is the only
+// endpoint that lists users matched by unsaved rules.
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/preview
+func (h *CohortHandler) Preview(c *gin.Context) {
+	var rules cohort.Rules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	preview, err := h.service.Preview(c.Request.Context(), rules)
+	if err != nil {
+		if errors.Is(err, cohort.ErrInvalidRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if anonymizer != nil {
+		projectID, _ := middleware.GetProjectID(c)
+		preview.SampleUserIDs = anonymizer.Tokens(projectID, preview.SampleUserIDs)
+	}
+
+	resp := gin.H{
+		"count":           preview.Count,
+		"sample_user_ids": preview.SampleUserIDs,
+		"truncated":       preview.Truncated,
+	}
+	if lint := rules.Lint(); len(lint) > 0 {
+		resp["lint"] = lint
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Get retrieves a specific cohort by ID. Archived cohorts are reported as not
+// found unless ?include_archived=true.
 // GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id
 func (h *CohortHandler) Get(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -58,7 +160,11 @@ func (h *CohortHandler) Get(c *gin.Context) {
 		return
 	}
 
-	coh, err := h.service.GetByID(c.Request.Context(), id)
+	get := h.service.GetByID
+	if c.Query("include_archived") == "true" {
+		get = h.service.GetByIDIncludingArchived
+	}
+	coh, err := get(c.Request.Context(), id)
 	if err != nil {
 		if err == cohort.ErrCohortNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
@@ -88,8 +194,54 @@ func (h *CohortHandler) Create(c *gin.Context) {
 
 	coh, err := h.service.Create(c.Request.Context(), projectID, req)
 	if err != nil {
-		if err == cohort.ErrInvalidRules {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort rules"})
+		if errors.Is(err, cohort.ErrInvalidRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrInvalidRecomputeInterval) || errors.Is(err, cohort.ErrInvalidMembershipTTL) || errors.Is(err, cohort.ErrInvalidVariants) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if respondCohortLimit(c, err) {
+			return
+		}
+		if errors.Is(err, cohort.ErrDuplicateCohortName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.withWarnings(c, coh))
+}
+
+// CreateStatic creates a static cohort from an uploaded list of users
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/static
+func (h *CohortHandler) CreateStatic(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	var req cohort.CreateStaticCohortRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coh, err := h.service.CreateStatic(c.Request.Context(), projectID, req)
+	if err != nil {
+		if errors.Is(err, cohort.ErrInvalidStaticMembers) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if respondCohortLimit(c, err) {
+			return
+		}
+		if errors.Is(err, cohort.ErrDuplicateCohortName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -99,6 +251,109 @@ func (h *CohortHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, coh)
 }
 
+// UpdateStaticMembers adds and removes users of a static cohort
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/static-members
+func (h *CohortHandler) UpdateStaticMembers(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	var req cohort.StaticMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.UpdateStaticMembers(c.Request.Context(), id, req)
+	if err != nil {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrInvalidStaticMembers) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrNotStaticCohort) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// cohortResponse is a cohort with non-fatal warnings about its rules
+type cohortResponse struct {
+	*cohort.Cohort
+	Warnings []string         `json:"warnings,omitempty"`
+	Lint     []cohort.Warning `json:"lint,omitempty"`
+}
+
+// withWarnings attaches warnings about the cohort's rules, such as conditions
+// on events that have never been ingested, and their lint warnings
+func (h *CohortHandler) withWarnings(c *gin.Context, coh *cohort.Cohort) cohortResponse {
+	return cohortResponse{
+		Cohort:   coh,
+		Warnings: h.service.RuleWarnings(c.Request.Context(), coh.Rules),
+		Lint:     coh.Rules.Lint(),
+	}
+}
+
+// respondCohortLimit writes a 409 with the project's limit if err is a
+// CohortLimitError and reports whether it did
+func respondCohortLimit(c *gin.Context, err error) bool {
+	var limitErr *cohort.CohortLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "limit": limitErr.Limit})
+	return true
+}
+
+// CreateFromTemplate creates a new cohort by substituting parameters into a template
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/from-template
+func (h *CohortHandler) CreateFromTemplate(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	var req cohort.CreateFromTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coh, err := h.service.CreateFromTemplate(c.Request.Context(), projectID, req)
+	if err != nil {
+		if err == cohort.ErrTemplateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort template not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrMissingTemplateParameter) || errors.Is(err, cohort.ErrInvalidRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if respondCohortLimit(c, err) {
+			return
+		}
+		if errors.Is(err, cohort.ErrDuplicateCohortName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.withWarnings(c, coh))
+}
+
 // Update updates an existing cohort
 // PUT /organizations/:orgSlug/projects/:projectSlug/cohorts/:id
 func (h *CohortHandler) Update(c *gin.Context) {
@@ -120,18 +375,26 @@ func (h *CohortHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
 			return
 		}
-		if err == cohort.ErrInvalidRules {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort rules"})
+		if errors.Is(err, cohort.ErrInvalidRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrInvalidRecomputeInterval) || errors.Is(err, cohort.ErrInvalidMembershipTTL) || errors.Is(err, cohort.ErrInvalidVariants) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrDuplicateCohortName) || errors.Is(err, cohort.ErrStaticCohort) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, coh)
+	c.JSON(http.StatusOK, h.withWarnings(c, coh))
 }
 
-// Delete deletes a cohort
+// Delete archives a cohort, which Restore can bring back
 // DELETE /organizations/:orgSlug/projects/:projectSlug/cohorts/:id
 func (h *CohortHandler) Delete(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -152,6 +415,35 @@ func (h *CohortHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// Restore brings back an archived cohort as inactive
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/restore
+func (h *CohortHandler) Restore(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	coh, err := h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrCohortNotArchived) || errors.Is(err, cohort.ErrDuplicateCohortName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if respondCohortLimit(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, coh)
+}
+
 // Activate activates a cohort
 // POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/activate
 func (h *CohortHandler) Activate(c *gin.Context) {
@@ -196,7 +488,36 @@ func (h *CohortHandler) Deactivate(c *gin.Context) {
 	c.JSON(http.StatusOK, coh)
 }
 
-// Recompute triggers a recompute job for a cohort
+// Size returns how many users currently match a cohort's rules. With
+// ?approx=true the size is estimated from a sample of users when possible.
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/size
+func (h *CohortHandler) Size(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	estimate, err := h.service.EstimateSize(c.Request.Context(), id, c.Query("approx") == "true")
+	if err != nil {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrStaticCohort) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// Recompute triggers a recompute job for a cohort. With ?wait=true, small
+// cohorts are recomputed inline and the final counts are returned. With
+// ?respect_overrides=false, manual membership overrides are reverted.
 // POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/recompute
 func (h *CohortHandler) Recompute(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -210,28 +531,90 @@ func (h *CohortHandler) Recompute(c *gin.Context) {
 		// Allow empty body - force defaults to false
 		req = cohort.RecomputeRequest{Force: false}
 	}
+	if v := c.Query("respect_overrides"); v != "" {
+		respect := v != "false"
+		req.RespectOverrides = &respect
+	}
 
-	resp, err := h.service.TriggerRecompute(c.Request.Context(), id, req.Force)
+	var resp *cohort.RecomputeResponse
+	if req.Since != nil {
+		resp, err = h.service.TriggerIncrementalRecompute(c.Request.Context(), id, *req.Since)
+	} else if c.Query("wait") == "true" {
+		resp, err = h.service.TriggerRecomputeAndWait(c.Request.Context(), id, req)
+	} else {
+		resp, err = h.service.TriggerRecompute(c.Request.Context(), id, req)
+	}
 	if err != nil {
 		if err == cohort.ErrCohortNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
 			return
 		}
+		if errors.Is(err, cohort.ErrInvalidRecomputeSince) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrStaticCohort) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		if err == cohort.ErrRecomputeInProgress {
 			c.JSON(http.StatusConflict, gin.H{"error": "recompute already in progress"})
 			return
 		}
+		if err == cohort.ErrRecomputeQueueFull {
+			c.Header("Retry-After", "30")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "recompute queue full, retry later"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusAccepted, resp)
+	switch resp.Status {
+	case cohort.RecomputeStatusCompleted:
+		c.JSON(http.StatusOK, resp)
+	case cohort.RecomputeStatusFailed:
+		c.JSON(http.StatusInternalServerError, resp)
+	default:
+		c.JSON(http.StatusAccepted, resp)
+	}
+}
+
+// EstimateRecompute estimates how long a recompute would take from the
+// cohort's recent recompute durations and its current approximate size
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/recompute/estimate
+func (h *CohortHandler) EstimateRecompute(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	estimate, err := h.service.EstimateRecomputeDuration(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrNoRecomputeHistory) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrStaticCohort) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
 }
 
 // GetRecomputeStatus retrieves the status of a recompute job
 // GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/recompute/:jobId
 func (h *CohortHandler) GetRecomputeStatus(c *gin.Context) {
-	_, err := uuid.Parse(c.Param("id"))
+	cohortID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
 		return
@@ -243,9 +626,13 @@ func (h *CohortHandler) GetRecomputeStatus(c *gin.Context) {
 		return
 	}
 
-	job, err := h.service.GetRecomputeJob(c.Request.Context(), jobID)
+	job, err := h.service.GetRecomputeJob(c.Request.Context(), cohortID, jobID)
 	if err != nil {
-		if err == cohort.ErrRecomputeJobNotFound {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrRecomputeJobNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "recompute job not found"})
 			return
 		}
@@ -255,3 +642,39 @@ func (h *CohortHandler) GetRecomputeStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, job)
 }
+
+// CancelRecompute cancels a pending or running recompute job
+// DELETE /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/recompute/:jobId
+func (h *CohortHandler) CancelRecompute(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.service.CancelRecompute(c.Request.Context(), cohortID, jobID)
+	if err != nil {
+		if errors.Is(err, cohort.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrRecomputeJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recompute job not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrRecomputeJobFinished) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
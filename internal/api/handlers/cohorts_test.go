@@ -0,0 +1,175 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/handlers"
+	"github.com/pjhul/intent/internal/api/middleware"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"github.com/pjhul/intent/internal/domain/project"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCohortHandler_Preview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	svc := cohort.NewService(mocks.NewMockQuerier(ctrl), nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+	worker.SetPreviewSampleSize(3)
+	svc.SetRecomputeWorker(worker)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/cohorts/preview", handlers.NewCohortHandler(svc).Preview)
+
+	preview := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/cohorts/preview", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	rules := `{"operator": "AND", "conditions": [{"type": "event", "event_name": "purchase"}]}`
+
+	t.Run("returns the count", func(t *testing.T) {
+		rows := mocks.NewMockRowScanner(ctrl)
+		rows.EXPECT().Next().Return(true)
+		rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*uint64) = 2
+			*dest[1].(*[]string) = []string{"user-1", "user-2"}
+			return nil
+		})
+		rows.EXPECT().Close().Return(nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).Return(rows, nil)
+
+		w := preview(rules)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var body struct {
+			Count         int64    `json:"count"`
+			SampleUserIDs []string `json:"sample_user_ids"`
+			Truncated     bool     `json:"truncated"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		if body.Count != 2 || len(body.SampleUserIDs) != 2 || body.Truncated {
+			t.Errorf("body = %+v, expected 2 users listed in full", body)
+		}
+	})
+
+	t.Run("caps and flags the sample", func(t *testing.T) {
+		rows := mocks.NewMockRowScanner(ctrl)
+		rows.EXPECT().Next().Return(true)
+		rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*uint64) = 50
+			*dest[1].(*[]string) = []string{"user-1", "user-2", "user-3"}
+			return nil
+		})
+		rows.EXPECT().Close().Return(nil)
+		var query string
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, q string, args ...any) (cohort.RowScanner, error) {
+				query = q
+				return rows, nil
+			})
+
+		w := preview(rules)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var body struct {
+			Count         int64    `json:"count"`
+			SampleUserIDs []string `json:"sample_user_ids"`
+			Truncated     bool     `json:"truncated"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		if !strings.Contains(query, "groupArray(3)(user_id)") {
+			t.Errorf("query = %q, expected the sample capped at 3", query)
+		}
+		if body.Count != 50 || len(body.SampleUserIDs) != 3 || !body.Truncated {
+			t.Errorf("body = %+v, expected 50 users with a truncated sample of 3", body)
+		}
+	})
+
+	t.Run("samples of projects requiring anonymization are hashed", func(t *testing.T) {
+		projectID := uuid.New()
+		anonymizer := membership.NewAnonymizer([]byte("secret"), staticProjectResolver{projectID})
+		anonymizer.SetRequired(false, map[uuid.UUID]bool{projectID: true})
+
+		h := handlers.NewCohortHandler(svc)
+		h.SetAnonymizer(anonymizer)
+		engine := gin.New()
+		engine.Use(func(c *gin.Context) {
+			c.Set(middleware.ProjectKey, &project.Project{ID: projectID})
+		})
+		engine.POST("/cohorts/preview", h.Preview)
+
+		rows := mocks.NewMockRowScanner(ctrl)
+		rows.EXPECT().Next().Return(true)
+		rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*uint64) = 1
+			*dest[1].(*[]string) = []string{"alice@example.com"}
+			return nil
+		})
+		rows.EXPECT().Close().Return(nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).Return(rows, nil)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/cohorts/preview", strings.NewReader(rules))
+		req.Header.Set("Content-Type", "application/json")
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var body struct {
+			SampleUserIDs []string `json:"sample_user_ids"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		expected := anonymizer.Token(projectID, "alice@example.com")
+		if len(body.SampleUserIDs) != 1 || body.SampleUserIDs[0] != expected {
+			t.Errorf("sample_user_ids = %v, expected [%s]", body.SampleUserIDs, expected)
+		}
+	})
+
+	t.Run("anonymize=true without an anonymizer is rejected", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/cohorts/preview?anonymize=true", strings.NewReader(rules))
+		req.Header.Set("Content-Type", "application/json")
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, expected %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	})
+
+	t.Run("rejects rules without conditions", func(t *testing.T) {
+		if w := preview(`{"operator": "AND", "conditions": []}`); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, expected %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	})
+
+	t.Run("ClickHouse errors are server errors", func(t *testing.T) {
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		if w := preview(rules); w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, expected %d: %s", w.Code, http.StatusInternalServerError, w.Body.String())
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pjhul/intent/internal/api/middleware"
 	"github.com/pjhul/intent/internal/domain/event"
 )
 
@@ -20,14 +22,34 @@ func NewEventHandler(service *event.Service) *EventHandler {
 // Ingest ingests a single event
 // POST /events
 func (h *EventHandler) Ingest(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
 	var req event.IngestEventRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	resp, err := h.service.Ingest(c.Request.Context(), req)
+	resp, err := h.service.Ingest(c.Request.Context(), projectID, req)
 	if err != nil {
+		if err == event.ErrMissingUserID ||
+			errors.Is(err, event.ErrPropertiesTooDeep) ||
+			errors.Is(err, event.ErrPropertiesTooLarge) ||
+			errors.Is(err, event.ErrTooManyProperties) ||
+			errors.Is(err, event.ErrPropertyNotAllowed) ||
+			errors.Is(err, event.ErrInvalidAckMode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, event.ErrPersistTimeout) {
+			// The event was produced and may still be persisted
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -38,6 +60,12 @@ func (h *EventHandler) Ingest(c *gin.Context) {
 // IngestBatch ingests multiple events
 // POST /events/batch
 func (h *EventHandler) IngestBatch(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
 	var req event.IngestBatchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -54,7 +82,7 @@ func (h *EventHandler) IngestBatch(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.IngestBatch(c.Request.Context(), req)
+	resp, err := h.service.IngestBatch(c.Request.Context(), projectID, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
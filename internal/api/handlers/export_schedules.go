@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+// ExportScheduleHandler handles cohort export schedule and on-demand export
+// HTTP requests
+type ExportScheduleHandler struct {
+	service *cohort.Service
+	queue   *cohort.ExportQueue
+}
+
+// NewExportScheduleHandler creates a new export schedule handler
+func NewExportScheduleHandler(service *cohort.Service) *ExportScheduleHandler {
+	return &ExportScheduleHandler{service: service}
+}
+
+// SetExportQueue enables on-demand exports, run through the queue
+func (h *ExportScheduleHandler) SetExportQueue(queue *cohort.ExportQueue) {
+	h.queue = queue
+}
+
+// List returns a cohort's export schedules with their last run status
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/export-schedules
+func (h *ExportScheduleHandler) List(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	schedules, err := h.service.ListExportSchedules(c.Request.Context(), cohortID)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// Create schedules a recurring export of a cohort's members
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/export-schedules
+func (h *ExportScheduleHandler) Create(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	var req cohort.CreateExportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := h.service.CreateExportSchedule(c.Request.Context(), cohortID, req)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if errors.Is(err, cohort.ErrInvalidCronExpression) || errors.Is(err, cohort.ErrInvalidExportDestination) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// Delete removes one of a cohort's export schedules
+// DELETE /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/export-schedules/:scheduleId
+func (h *ExportScheduleHandler) Delete(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+	scheduleID, err := uuid.Parse(c.Param("scheduleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export schedule ID"})
+		return
+	}
+
+	if err := h.service.DeleteExportSchedule(c.Request.Context(), cohortID, scheduleID); err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		if err == cohort.ErrExportScheduleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "export schedule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Export starts a one-off export of a cohort's members. Exports past the
+// concurrency limit are queued and report their position.
+// POST /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/exports
+func (h *ExportScheduleHandler) Export(c *gin.Context) {
+	if h.queue == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "exports are not available"})
+		return
+	}
+
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	var req cohort.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	co, err := h.service.GetByID(c.Request.Context(), cohortID)
+	if err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.queue.Submit(c.Request.Context(), co, req.Destination)
+	if err != nil {
+		if errors.Is(err, cohort.ErrInvalidExportDestination) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetExport returns the progress of a one-off export
+// GET /organizations/:orgSlug/projects/:projectSlug/cohorts/:id/exports/:exportId
+func (h *ExportScheduleHandler) GetExport(c *gin.Context) {
+	if h.queue == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "exports are not available"})
+		return
+	}
+
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+	exportID, err := uuid.Parse(c.Param("exportId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export ID"})
+		return
+	}
+
+	if _, err := h.service.GetByID(c.Request.Context(), cohortID); err != nil {
+		if err == cohort.ErrCohortNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.queue.Get(exportID)
+	if err != nil || job.CohortID != cohortID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultHealthCheckTimeout bounds each dependency check
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// Dependency is an external service the cohort service relies on. The
+// service can't run without a critical dependency; without an optional one it
+// keeps serving with Features unavailable or slower.
+type Dependency struct {
+	Name     string
+	Critical bool
+	Features []string
+	Check    func(ctx context.Context) error
+}
+
+// DependencyStatus is the state of a dependency as reported by /health/ready
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessReport is the response of /health/ready
+type ReadinessReport struct {
+	// Status is ready, degraded when an optional dependency is down, or
+	// unavailable when a critical one is
+	Status           string                      `json:"status"`
+	Dependencies     map[string]DependencyStatus `json:"dependencies"`
+	DegradedFeatures []string                    `json:"degraded_features,omitempty"`
+}
+
+// HealthHandler reports liveness and dependency readiness
+type HealthHandler struct {
+	dependencies []Dependency
+	timeout      time.Duration
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{timeout: defaultHealthCheckTimeout}
+}
+
+// AddDependency registers a dependency checked at startup and by /health/ready
+func (h *HealthHandler) AddDependency(dep Dependency) {
+	h.dependencies = append(h.dependencies, dep)
+}
+
+// CheckStartup checks every dependency once. A critical dependency that's
+// down is an error. An optional one is logged and its features degraded when
+// allowDegraded is set, and is an error otherwise.
+func (h *HealthHandler) CheckStartup(ctx context.Context, allowDegraded bool) error {
+	report := h.check(ctx)
+	for _, dep := range h.dependencies {
+		status := report.Dependencies[dep.Name]
+		if status.Status == "up" {
+			continue
+		}
+		if dep.Critical || !allowDegraded {
+			return fmt.Errorf("%s is unavailable: %s", dep.Name, status.Error)
+		}
+		log.Printf("warning: %s is unavailable, starting without %v: %s", dep.Name, dep.Features, status.Error)
+	}
+	return nil
+}
+
+// Ready checks every dependency. It responds 200 when the service can serve,
+// listing features degraded by optional dependencies that are down, and 503
+// when a critical dependency is down.
+// GET /health/ready
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.check(c.Request.Context())
+	code := http.StatusOK
+	if report.Status == "unavailable" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
+// check runs every dependency check and summarizes the results
+func (h *HealthHandler) check(ctx context.Context) *ReadinessReport {
+	report := &ReadinessReport{
+		Status:       "ready",
+		Dependencies: make(map[string]DependencyStatus, len(h.dependencies)),
+	}
+
+	for _, dep := range h.dependencies {
+		checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		err := dep.Check(checkCtx)
+		cancel()
+
+		status := DependencyStatus{Status: "up", Critical: dep.Critical}
+		if err != nil {
+			status.Status = "down"
+			status.Error = err.Error()
+			if dep.Critical {
+				report.Status = "unavailable"
+			} else {
+				if report.Status == "ready" {
+					report.Status = "degraded"
+				}
+				report.DegradedFeatures = append(report.DegradedFeatures, dep.Features...)
+			}
+		}
+		report.Dependencies[dep.Name] = status
+	}
+
+	return report
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pjhul/intent/internal/api/handlers"
+)
+
+func up(ctx context.Context) error { return nil }
+
+func TestHealthHandler_RedisAbsent(t *testing.T) {
+	redisDown := func(ctx context.Context) error {
+		return errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+	}
+
+	h := handlers.NewHealthHandler()
+	h.AddDependency(handlers.Dependency{Name: "postgres", Critical: true, Check: up})
+	h.AddDependency(handlers.Dependency{Name: "redis", Features: []string{"membership cache"}, Check: redisDown})
+
+	t.Run("starts degraded when allowed", func(t *testing.T) {
+		if err := h.CheckStartup(context.Background(), true); err != nil {
+			t.Errorf("CheckStartup() = %v, expected nil", err)
+		}
+	})
+
+	t.Run("fails startup in strict mode", func(t *testing.T) {
+		if err := h.CheckStartup(context.Background(), false); err == nil {
+			t.Error("CheckStartup() = nil, expected an error for Redis")
+		}
+	})
+
+	t.Run("reports degraded features", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.GET("/health/ready", h.Ready)
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var report handlers.ReadinessReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		if report.Status != "degraded" {
+			t.Errorf("status = %q, expected degraded", report.Status)
+		}
+		if !reflect.DeepEqual(report.DegradedFeatures, []string{"membership cache"}) {
+			t.Errorf("degraded features = %v, expected [membership cache]", report.DegradedFeatures)
+		}
+		if got := report.Dependencies["redis"]; got.Status != "down" || got.Error == "" {
+			t.Errorf("redis = %+v, expected down with an error", got)
+		}
+		if got := report.Dependencies["postgres"]; got.Status != "up" {
+			t.Errorf("postgres = %+v, expected up", got)
+		}
+	})
+}
+
+func TestHealthHandler_CriticalDependencyDown(t *testing.T) {
+	h := handlers.NewHealthHandler()
+	h.AddDependency(handlers.Dependency{
+		Name:     "clickhouse",
+		Critical: true,
+		Check:    func(ctx context.Context) error { return errors.New("connection refused") },
+	})
+
+	if err := h.CheckStartup(context.Background(), true); err == nil {
+		t.Error("CheckStartup() = nil, expected an error for a critical dependency")
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/health/ready", h.Ready)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, expected %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -1,17 +1,25 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/middleware"
 	"github.com/pjhul/intent/internal/domain/membership"
 )
 
 // MembershipHandler handles membership-related HTTP requests
 type MembershipHandler struct {
-	service *membership.Service
+	service    *membership.Service
+	anonymizer *membership.Anonymizer
 }
 
 // NewMembershipHandler creates a new membership handler
@@ -19,7 +27,36 @@ func NewMembershipHandler(service *membership.Service) *MembershipHandler {
 	return &MembershipHandler{service: service}
 }
 
-// CheckMembership checks if a user is a member of a cohort
+// SetAnonymizer enables ?anonymize=true on endpoints returning user IDs, and
+// hashes them regardless for projects that require it
+func (h *MembershipHandler) SetAnonymizer(anonymizer *membership.Anonymizer) {
+	h.anonymizer = anonymizer
+}
+
+// requestAnonymizer returns the anonymizer when the request asks for hashed
+// user IDs or its project requires them. It writes an error response and
+// returns ok=false if anonymization is unavailable.
+func requestAnonymizer(c *gin.Context, anonymizer *membership.Anonymizer) (*membership.Anonymizer, bool) {
+	if projectID, ok := middleware.GetProjectID(c); ok && anonymizer.Required(projectID) {
+		return anonymizer, true
+	}
+	if c.Query("anonymize") != "true" {
+		return nil, true
+	}
+	if anonymizer == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": membership.ErrAnonymizationDisabled.Error()})
+		return nil, false
+	}
+	return anonymizer, true
+}
+
+// includes reports whether the comma-separated ?include list names expansion
+func includes(c *gin.Context, expansion string) bool {
+	return slices.Contains(strings.Split(c.Query("include"), ","), expansion)
+}
+
+// CheckMembership checks if a user is a member of a cohort, or was one at
+// the RFC 3339 time in "at". ?include=cohort embeds the cohort's summary.
 // POST /cohorts/:id/check
 func (h *MembershipHandler) CheckMembership(c *gin.Context) {
 	cohortID, err := uuid.Parse(c.Param("id"))
@@ -29,23 +66,50 @@ func (h *MembershipHandler) CheckMembership(c *gin.Context) {
 	}
 
 	var req struct {
-		UserID string `json:"user_id" binding:"required"`
+		UserID string     `json:"user_id" binding:"required"`
+		At     *time.Time `json:"at"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	resp, err := h.service.CheckMembership(c.Request.Context(), cohortID, req.UserID)
+	var resp *membership.CheckMembershipResponse
+	if req.At != nil {
+		resp, err = h.service.CheckMembershipAt(c.Request.Context(), cohortID, req.UserID, req.At.UTC())
+	} else {
+		resp, err = h.service.CheckMembership(c.Request.Context(), cohortID, req.UserID)
+	}
+	if errors.Is(err, membership.ErrStorageUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, membership.ErrCohortNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if includes(c, "cohort") {
+		if err := h.service.IncludeCohort(c.Request.Context(), resp); err != nil {
+			if errors.Is(err, membership.ErrCohortNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
-// GetCohortMembers returns members of a cohort
+// GetCohortMembers returns members of a cohort. ?include=last_active adds
+// each member's latest event time, and ?variant= keeps only the members
+// assigned that experiment variant.
 // GET /cohorts/:id/members
 func (h *MembershipHandler) GetCohortMembers(c *gin.Context) {
 	cohortID, err := uuid.Parse(c.Param("id"))
@@ -61,15 +125,195 @@ func (h *MembershipHandler) GetCohortMembers(c *gin.Context) {
 		limit = 1000
 	}
 
-	resp, err := h.service.GetCohortMembers(c.Request.Context(), cohortID, limit, offset)
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.GetCohortMembers(c.Request.Context(), cohortID, limit, offset, includes(c, "last_active"), c.Query("variant"))
+	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if anonymizer != nil {
+		projectID, _ := middleware.GetProjectID(c)
+		c.JSON(http.StatusOK, anonymizer.AnonymizeMembers(projectID, resp))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetCohortMembersAtVersion returns a cohort's members, and their count, as
+// of the latest completed recompute of a cohort version
+// GET /cohorts/:id/versions/:version/members
+func (h *MembershipHandler) GetCohortMembersAtVersion(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort version"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	if limit > 1000 {
+		limit = 1000
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.GetCohortMembersAtVersion(c.Request.Context(), cohortID, version, limit, offset)
 	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) || errors.Is(err, membership.ErrVersionNotRecomputed) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, membership.ErrVersionHistoryUnavailable) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if anonymizer != nil {
+		projectID, _ := middleware.GetProjectID(c)
+		resp.UserIDs = anonymizer.Tokens(projectID, resp.UserIDs)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
+// CountMembersByProperty segments a cohort's current members by a property
+// on their most recent event, e.g. ?property=country
+// GET /cohorts/:id/members/count-by-property
+func (h *MembershipHandler) CountMembersByProperty(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	breakdown, err := h.service.CountMembersByProperty(c.Request.Context(), cohortID, c.Query("property"), limit)
+	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, membership.ErrInvalidBreakdownProperty) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// CountMembersByPropertyRange buckets a cohort's current members by a numeric
+// property on their most recent event, e.g. ?property=ltv&boundaries=0,100,1000
+// GET /cohorts/:id/members/count-by-range
+func (h *MembershipHandler) CountMembersByPropertyRange(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	var boundaries []float64
+	if raw := c.Query("boundaries"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			boundary, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid boundary %q", part)})
+				return
+			}
+			boundaries = append(boundaries, boundary)
+		}
+	}
+
+	breakdown, err := h.service.CountMembersByPropertyRange(c.Request.Context(), cohortID, c.Query("property"), boundaries)
+	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, membership.ErrInvalidBreakdownProperty) || errors.Is(err, membership.ErrInvalidBucketBoundaries) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// GetCohortMembersBitmap returns a cohort's current members as a serialized
+// roaring bitmap. ?id_mapping selects how user IDs map to bitmap values:
+// hash (default) or integer; see membership.IDMapping.
+// GET /cohorts/:id/members/bitmap
+func (h *MembershipHandler) GetCohortMembersBitmap(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	// Bitmap values are derived from raw user IDs
+	if projectID, ok := middleware.GetProjectID(c); ok && h.anonymizer.Required(projectID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": membership.ErrRawUserIDsForbidden.Error()})
+		return
+	}
+
+	mapping := membership.IDMapping(c.DefaultQuery("id_mapping", string(membership.IDMappingHash)))
+
+	bitmap, err := h.service.GetCohortMembersBitmap(c.Request.Context(), cohortID, mapping)
+	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, membership.ErrInvalidIDMapping) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("X-Id-Mapping", string(bitmap.IDMapping))
+	c.Header("X-Member-Count", strconv.FormatInt(bitmap.Members, 10))
+	c.Header("X-Skipped-Members", strconv.FormatInt(bitmap.Skipped, 10))
+	c.Data(http.StatusOK, "application/octet-stream", bitmap.Data)
+}
+
 // GetCohortStats returns statistics for a cohort
 // GET /cohorts/:id/stats
 func (h *MembershipHandler) GetCohortStats(c *gin.Context) {
@@ -81,6 +325,10 @@ func (h *MembershipHandler) GetCohortStats(c *gin.Context) {
 
 	stats, err := h.service.GetCohortStats(c.Request.Context(), cohortID)
 	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -105,3 +353,200 @@ func (h *MembershipHandler) GetUserCohorts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// EraseUser deletes a user's events and memberships
+// DELETE /users/:id
+func (h *MembershipHandler) EraseUser(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	job, err := h.service.EraseUser(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, membership.ErrErasureDisabled) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// AddCohortMember forces a user into a cohort regardless of its rules
+// POST /cohorts/:id/members
+func (h *MembershipHandler) AddCohortMember(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondOverride(c, h.service.AddMember, cohortID, req.UserID)
+}
+
+// RemoveCohortMember forces a user out of a cohort regardless of its rules
+// DELETE /cohorts/:id/members/:userId
+func (h *MembershipHandler) RemoveCohortMember(c *gin.Context) {
+	cohortID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cohort ID"})
+		return
+	}
+
+	h.respondOverride(c, h.service.RemoveMember, cohortID, c.Param("userId"))
+}
+
+// respondOverride applies a manual membership override and writes the result
+func (h *MembershipHandler) respondOverride(
+	c *gin.Context,
+	apply func(ctx context.Context, cohortID uuid.UUID, userID string) (*membership.MembershipOverride, error),
+	cohortID uuid.UUID,
+	userID string,
+) {
+	override, err := apply(c.Request.Context(), cohortID, userID)
+	if err != nil {
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// GetSharedCohorts returns the cohorts of the project every one of the given
+// users belongs to
+// POST /users/shared-cohorts
+func (h *MembershipHandler) GetSharedCohorts(c *gin.Context) {
+	var req struct {
+		UserIDs []string `json:"user_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.GetSharedCohorts(c.Request.Context(), req.UserIDs)
+	if err != nil {
+		if errors.Is(err, membership.ErrInvalidUserSet) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// cohortSetRequest is the request body for cohort set queries
+type cohortSetRequest struct {
+	CohortIDs []uuid.UUID `json:"cohort_ids" binding:"required"`
+	Limit     int         `json:"limit"`
+	Offset    int         `json:"offset"`
+}
+
+// GetUsersInAllCohorts returns users that are members of every given cohort
+// POST /users/all-of
+func (h *MembershipHandler) GetUsersInAllCohorts(c *gin.Context) {
+	h.queryCohortSet(c, h.service.GetUsersInAllCohorts)
+}
+
+// GetUsersInNoCohorts returns users that are members of none of the given cohorts
+// POST /users/none-of
+func (h *MembershipHandler) GetUsersInNoCohorts(c *gin.Context) {
+	h.queryCohortSet(c, h.service.GetUsersInNoCohorts)
+}
+
+// GetMembersInCohorts returns the members of the given cohorts, those in every
+// cohort when intersect is set and those in any of them otherwise
+// POST /cohorts/members/combined
+func (h *MembershipHandler) GetMembersInCohorts(c *gin.Context) {
+	var req combinedMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.clampPage()
+
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	resp, err := h.service.GetMembersInCohorts(c.Request.Context(), req.CohortIDs, req.Intersect, req.Limit, req.Offset)
+	respondCohortSet(c, anonymizer, resp, err)
+}
+
+// combinedMembersRequest is the request body for combined member queries
+type combinedMembersRequest struct {
+	cohortSetRequest
+	Intersect bool `json:"intersect"`
+}
+
+func (h *MembershipHandler) queryCohortSet(
+	c *gin.Context,
+	query func(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) (*membership.CohortSetResponse, error),
+) {
+	var req cohortSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.clampPage()
+
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	resp, err := query(c.Request.Context(), req.CohortIDs, req.Limit, req.Offset)
+	respondCohortSet(c, anonymizer, resp, err)
+}
+
+// clampPage caps the page size and clamps a negative offset to zero
+func (r *cohortSetRequest) clampPage() {
+	if r.Limit > 1000 {
+		r.Limit = 1000
+	}
+	if r.Offset < 0 {
+		r.Offset = 0
+	}
+}
+
+func respondCohortSet(c *gin.Context, anonymizer *membership.Anonymizer, resp *membership.CohortSetResponse, err error) {
+	if err != nil {
+		if errors.Is(err, membership.ErrInvalidCohortSet) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, membership.ErrCohortNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if anonymizer != nil {
+		projectID, _ := middleware.GetProjectID(c)
+		c.JSON(http.StatusOK, anonymizer.AnonymizeCohortSet(projectID, resp))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
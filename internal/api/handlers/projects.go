@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -204,6 +205,10 @@ func (h *ProjectHandler) Update(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "project slug already exists in this organization"})
 			return
 		}
+		if errors.Is(err, project.ErrInvalidRetention) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
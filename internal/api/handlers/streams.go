@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// StreamTracker tracks open SSE and WebSocket connections so shutdown can
+// tell each one to close before the server stops
+type StreamTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	active   int
+	closing  chan struct{}
+	shutdown bool
+}
+
+// NewStreamTracker creates a new stream tracker
+func NewStreamTracker() *StreamTracker {
+	return &StreamTracker{closing: make(chan struct{})}
+}
+
+// track registers a stream. It returns a channel closed when the server
+// starts shutting down and a func the stream calls once it has ended. ok is
+// false when shutdown has already begun and the stream should be refused.
+func (t *StreamTracker) track() (closing <-chan struct{}, done func(), ok bool) {
+	if t == nil {
+		return nil, func() {}, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.shutdown {
+		return nil, nil, false
+	}
+	t.active++
+	t.wg.Add(1)
+
+	var once sync.Once
+	return t.closing, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.active--
+			t.mu.Unlock()
+			t.wg.Done()
+		})
+	}, true
+}
+
+// Active returns the number of open streams
+func (t *StreamTracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// Shutdown tells every open stream to send a shutting_down event and close,
+// and waits until they have or ctx is done. New streams are refused.
+func (t *StreamTracker) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.shutdown {
+		t.shutdown = true
+		close(t.closing)
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pjhul/intent/internal/api/handlers"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+func TestStreamTracker_Shutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	streams := handlers.NewStreamTracker()
+	sseHandler := handlers.NewSSEHandler(&fakeBroadcaster{changes: make(chan *membership.MembershipChange)})
+	sseHandler.SetStreamTracker(streams)
+	wsHandler := handlers.NewWebSocketHandler(&fakeBroadcaster{changes: make(chan *membership.MembershipChange)})
+	wsHandler.SetStreamTracker(streams)
+
+	engine := gin.New()
+	engine.GET("/stream", sseHandler.HandleSSE)
+	engine.GET("/ws", wsHandler.HandleWebSocket)
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	// Open an SSE stream and wait for it to connect
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatalf("failed to open SSE stream: %v", err)
+	}
+	defer resp.Body.Close()
+	sse := bufio.NewReader(resp.Body)
+	if line, _ := sse.ReadString('\n'); line != "event:connected\n" {
+		t.Fatalf("first SSE line = %q, expected connected event", line)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to open WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	if got := streams.Active(); got != 2 {
+		t.Fatalf("Active() = %d, expected 2", got)
+	}
+
+	timeout := 2 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := streams.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("server Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Errorf("shutdown took %v, expected under %v", elapsed, timeout)
+	}
+
+	t.Run("SSE client receives shutting_down", func(t *testing.T) {
+		var events []string
+		for {
+			line, err := sse.ReadString('\n')
+			if strings.HasPrefix(line, "event:") {
+				events = append(events, strings.TrimSpace(strings.TrimPrefix(line, "event:")))
+			}
+			if err != nil {
+				break
+			}
+		}
+		if len(events) == 0 || events[len(events)-1] != "shutting_down" {
+			t.Errorf("events = %v, expected a final shutting_down event", events)
+		}
+	})
+
+	t.Run("WebSocket client receives shutting_down", func(t *testing.T) {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		if string(msg) != `{"event":"shutting_down"}` {
+			t.Errorf("message = %s, expected shutting_down event", msg)
+		}
+		if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("ReadMessage() error = %v, expected going away close", err)
+		}
+	})
+
+	if got := streams.Active(); got != 0 {
+		t.Errorf("Active() = %d after shutdown, expected 0", got)
+	}
+}
+
+func TestStreamTracker_RefusesStreamsAfterShutdown(t *testing.T) {
+	streams := handlers.NewStreamTracker()
+	if err := streams.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	h := handlers.NewSSEHandler(&fakeBroadcaster{changes: make(chan *membership.MembershipChange)})
+	h.SetStreamTracker(streams)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/stream", h.HandleSSE)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, expected %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
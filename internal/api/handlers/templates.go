@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/middleware"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+// TemplateHandler handles cohort template HTTP requests
+type TemplateHandler struct {
+	service *cohort.Service
+}
+
+// NewTemplateHandler creates a new template handler
+func NewTemplateHandler(service *cohort.Service) *TemplateHandler {
+	return &TemplateHandler{service: service}
+}
+
+// List returns all templates for a project
+// GET /organizations/:orgSlug/projects/:projectSlug/templates
+func (h *TemplateHandler) List(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	templates, err := h.service.ListTemplates(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// Get retrieves a specific template by ID
+// GET /organizations/:orgSlug/projects/:projectSlug/templates/:id
+func (h *TemplateHandler) Get(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	tmpl, err := h.service.GetTemplate(c.Request.Context(), projectID, id)
+	if err != nil {
+		if err == cohort.ErrTemplateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// Create creates a new template
+// POST /organizations/:orgSlug/projects/:projectSlug/templates
+func (h *TemplateHandler) Create(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	var req cohort.CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, err := h.service.CreateTemplate(c.Request.Context(), projectID, req)
+	if err != nil {
+		if errors.Is(err, cohort.ErrInvalidRules) || errors.Is(err, cohort.ErrUndeclaredTemplateParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, cohort.ErrDuplicateTemplateName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// Delete deletes a template
+// DELETE /organizations/:orgSlug/projects/:projectSlug/templates/:id
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	projectID, ok := middleware.GetProjectID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "project not resolved"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	if err := h.service.DeleteTemplate(c.Request.Context(), projectID, id); err != nil {
+		if err == cohort.ErrTemplateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cohort template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
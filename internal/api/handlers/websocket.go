@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -29,6 +30,8 @@ type Broadcaster interface {
 // WebSocketHandler handles WebSocket connections for real-time updates
 type WebSocketHandler struct {
 	broadcaster Broadcaster
+	anonymizer  *membership.Anonymizer
+	streams     *StreamTracker
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
@@ -36,15 +39,40 @@ func NewWebSocketHandler(broadcaster Broadcaster) *WebSocketHandler {
 	return &WebSocketHandler{broadcaster: broadcaster}
 }
 
+// SetAnonymizer enables ?anonymize=true for hashed user IDs in streamed
+// changes, and hashes them regardless for projects that require it
+func (h *WebSocketHandler) SetAnonymizer(anonymizer *membership.Anonymizer) {
+	h.anonymizer = anonymizer
+}
+
+// SetStreamTracker enables closing connections cleanly on shutdown
+func (h *WebSocketHandler) SetStreamTracker(streams *StreamTracker) {
+	h.streams = streams
+}
+
 // subscribeRequest represents a subscription request from the client
 type subscribeRequest struct {
-	CohortIDs []string `json:"cohort_ids,omitempty"`
-	UserIDs   []string `json:"user_ids,omitempty"`
+	CohortIDs []string                   `json:"cohort_ids,omitempty"`
+	UserIDs   []string                   `json:"user_ids,omitempty"`
+	Direction membership.ChangeDirection `json:"direction,omitempty"`
+	Variant   string                     `json:"variant,omitempty"`
 }
 
 // HandleWebSocket handles WebSocket connections
 // WS /ws/cohort-changes
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
+	closing, done, ok := h.streams.track()
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+	defer done()
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("failed to upgrade WebSocket: %v", err)
@@ -90,41 +118,105 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			}
 			subscription.CohortIDs = cohortIDs
 			subscription.UserIDs = req.UserIDs
+			subscription.Direction = req.Direction
+			subscription.Variant = req.Variant
 		}
 	}()
 
 	// Send changes to client
-	for change := range changeChan {
-		// Check if change matches subscription filters
-		if !subscription.MatchesChange(change) {
-			continue
-		}
+	for {
+		select {
+		case <-closing:
+			// Tell the client why the connection is closing so it can reconnect elsewhere
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"shutting_down"}`))
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(time.Second))
+			return
+		case change, ok := <-changeChan:
+			if !ok {
+				return
+			}
 
-		data, err := json.Marshal(change)
-		if err != nil {
-			continue
-		}
+			// Check if change matches subscription filters
+			if !subscription.MatchesChange(change) {
+				continue
+			}
 
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			log.Printf("failed to write WebSocket message: %v", err)
-			return
+			protected, err := h.anonymizer.ProtectChange(c.Request.Context(), change, anonymizer != nil)
+			if err != nil {
+				log.Printf("failed to anonymize change for cohort %s: %v", change.CohortID, err)
+				continue
+			}
+			change = protected
+
+			data, err := json.Marshal(change)
+			if err != nil {
+				continue
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("failed to write WebSocket message: %v", err)
+				return
+			}
 		}
 	}
 }
 
+// Default SSE reconnection and keepalive intervals
+const (
+	DefaultSSERetry             = 3 * time.Second
+	DefaultSSEKeepaliveInterval = 30 * time.Second
+)
+
 // SSEHandler handles Server-Sent Events for real-time updates
 type SSEHandler struct {
-	broadcaster Broadcaster
+	broadcaster       Broadcaster
+	anonymizer        *membership.Anonymizer
+	retry             time.Duration
+	keepaliveInterval time.Duration
+	streams           *StreamTracker
 }
 
 // NewSSEHandler creates a new SSE handler
 func NewSSEHandler(broadcaster Broadcaster) *SSEHandler {
-	return &SSEHandler{broadcaster: broadcaster}
+	return &SSEHandler{
+		broadcaster:       broadcaster,
+		retry:             DefaultSSERetry,
+		keepaliveInterval: DefaultSSEKeepaliveInterval,
+	}
+}
+
+// SetRetry sets the reconnection delay sent to clients in the retry directive
+func (h *SSEHandler) SetRetry(retry time.Duration) {
+	h.retry = retry
+}
+
+// SetAnonymizer enables ?anonymize=true for hashed user IDs in streamed
+// changes, and hashes them regardless for projects that require it
+func (h *SSEHandler) SetAnonymizer(anonymizer *membership.Anonymizer) {
+	h.anonymizer = anonymizer
+}
+
+// SetKeepaliveInterval sets how often keepalive events are sent
+func (h *SSEHandler) SetKeepaliveInterval(interval time.Duration) {
+	h.keepaliveInterval = interval
 }
 
-// HandleSSE handles SSE connections
+// SetStreamTracker enables closing connections cleanly on shutdown
+func (h *SSEHandler) SetStreamTracker(streams *StreamTracker) {
+	h.streams = streams
+}
+
+// HandleSSE handles SSE connections. Changes are filtered with repeated
+// ?cohort_id= and ?user_id= params and ?direction=entry|exit.
 // GET /stream/cohort-changes
 func (h *SSEHandler) HandleSSE(c *gin.Context) {
+	anonymizer, ok := requestAnonymizer(c, h.anonymizer)
+	if !ok {
+		return
+	}
+
 	// Parse query params for filtering
 	cohortIDsParam := c.QueryArray("cohort_id")
 	userIDsParam := c.QueryArray("user_id")
@@ -136,11 +228,20 @@ func (h *SSEHandler) HandleSSE(c *gin.Context) {
 		}
 	}
 
+	closing, done, ok := h.streams.track()
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+	defer done()
+
 	subscriptionID := uuid.New().String()
 	subscription := &membership.StreamSubscription{
 		ID:        subscriptionID,
 		CohortIDs: cohortIDs,
 		UserIDs:   userIDsParam,
+		Direction: membership.ChangeDirection(c.Query("direction")),
+		Variant:   c.Query("variant"),
 		CreatedAt: time.Now(),
 	}
 
@@ -153,12 +254,16 @@ func (h *SSEHandler) HandleSSE(c *gin.Context) {
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
 
-	// Send initial connection event
-	c.SSEvent("connected", gin.H{"subscription_id": subscriptionID})
+	// Send initial connection event with the client reconnection delay
+	c.Render(-1, sse.Event{
+		Event: "connected",
+		Retry: uint(h.retry.Milliseconds()),
+		Data:  gin.H{"subscription_id": subscriptionID},
+	})
 	c.Writer.Flush()
 
 	// Create a ticker for keepalive
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(h.keepaliveInterval)
 	defer ticker.Stop()
 
 	clientGone := c.Request.Context().Done()
@@ -167,6 +272,10 @@ func (h *SSEHandler) HandleSSE(c *gin.Context) {
 		select {
 		case <-clientGone:
 			return
+		case <-closing:
+			c.SSEvent("shutting_down", gin.H{"timestamp": time.Now().Unix()})
+			c.Writer.Flush()
+			return
 		case <-ticker.C:
 			c.SSEvent("keepalive", gin.H{"timestamp": time.Now().Unix()})
 			c.Writer.Flush()
@@ -180,7 +289,20 @@ func (h *SSEHandler) HandleSSE(c *gin.Context) {
 				continue
 			}
 
-			c.SSEvent("membership_change", change)
+			protected, err := h.anonymizer.ProtectChange(c.Request.Context(), change, anonymizer != nil)
+			if err != nil {
+				log.Printf("failed to anonymize change for cohort %s: %v", change.CohortID, err)
+				continue
+			}
+			change = protected
+
+			// Changes carry no id: changes of one batch share a timestamp and
+			// there is no replay to resume from, so clients reconnecting after
+			// a gap should resync from the membership endpoints
+			c.Render(-1, sse.Event{
+				Event: "membership_change",
+				Data:  change,
+			})
 			c.Writer.Flush()
 		}
 	}
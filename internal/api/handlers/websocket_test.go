@@ -0,0 +1,152 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/handlers"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+type fakeBroadcaster struct {
+	changes chan *membership.MembershipChange
+}
+
+func (b *fakeBroadcaster) Subscribe(id string, sub *membership.StreamSubscription) chan *membership.MembershipChange {
+	return b.changes
+}
+
+func (b *fakeBroadcaster) Unsubscribe(id string) {}
+
+// syncRecorder guards the recorder body so it can be read while the handler streams
+type syncRecorder struct {
+	*httptest.ResponseRecorder
+	mu sync.Mutex
+}
+
+func (r *syncRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *syncRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Body.String()
+}
+
+func serveSSE(t *testing.T, h *handlers.SSEHandler, duration time.Duration, before func()) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/stream", h.HandleSSE)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	w := &syncRecorder{ResponseRecorder: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		engine.ServeHTTP(w, req)
+		close(done)
+	}()
+	if before != nil {
+		before()
+	}
+	<-done
+
+	return w.String()
+}
+
+func TestSSEHandler_HandleSSE(t *testing.T) {
+	t.Run("connect event carries retry directive", func(t *testing.T) {
+		h := handlers.NewSSEHandler(&fakeBroadcaster{changes: make(chan *membership.MembershipChange)})
+		h.SetRetry(1500 * time.Millisecond)
+
+		body := serveSSE(t, h, 20*time.Millisecond, nil)
+
+		if !strings.HasPrefix(body, "event:connected\n") {
+			t.Errorf("body = %q, expected connected event first", body)
+		}
+		if !strings.Contains(body, "retry:1500\n") {
+			t.Errorf("body = %q, expected retry:1500", body)
+		}
+	})
+
+	t.Run("keepalives follow the configured interval", func(t *testing.T) {
+		h := handlers.NewSSEHandler(&fakeBroadcaster{changes: make(chan *membership.MembershipChange)})
+		h.SetKeepaliveInterval(20 * time.Millisecond)
+
+		body := serveSSE(t, h, 110*time.Millisecond, nil)
+
+		count := strings.Count(body, "event:keepalive\n")
+		if count < 3 || count > 6 {
+			t.Errorf("keepalive count = %d, expected about 5", count)
+		}
+	})
+
+	t.Run("membership changes carry no id", func(t *testing.T) {
+		changes := make(chan *membership.MembershipChange, 1)
+		h := handlers.NewSSEHandler(&fakeBroadcaster{changes: changes})
+		changedAt := time.Unix(1700000000, 123).UTC()
+
+		body := serveSSE(t, h, 50*time.Millisecond, func() {
+			changes <- &membership.MembershipChange{
+				CohortID:   uuid.New(),
+				UserID:     "user-1",
+				PrevStatus: membership.MembershipStatusOut,
+				NewStatus:  membership.MembershipStatusIn,
+				ChangedAt:  changedAt,
+			}
+		})
+
+		if !strings.Contains(body, "event:membership_change\n") {
+			t.Errorf("body = %q, expected a membership_change event", body)
+		}
+		if strings.Contains(body, "id:") {
+			t.Errorf("body = %q, expected no event id without resumption", body)
+		}
+	})
+	t.Run("changes of projects requiring anonymization are hashed", func(t *testing.T) {
+		projectID := uuid.New()
+		anonymizer := membership.NewAnonymizer([]byte("secret"), staticProjectResolver{projectID})
+		anonymizer.SetRequired(true, nil)
+
+		changes := make(chan *membership.MembershipChange, 1)
+		h := handlers.NewSSEHandler(&fakeBroadcaster{changes: changes})
+		h.SetAnonymizer(anonymizer)
+
+		body := serveSSE(t, h, 50*time.Millisecond, func() {
+			changes <- &membership.MembershipChange{
+				CohortID:  uuid.New(),
+				UserID:    "alice@example.com",
+				NewStatus: membership.MembershipStatusIn,
+			}
+		})
+
+		if strings.Contains(body, "alice@example.com") {
+			t.Errorf("body = %q, expected no raw user ID", body)
+		}
+		if token := anonymizer.Token(projectID, "alice@example.com"); !strings.Contains(body, token) {
+			t.Errorf("body = %q, expected token %q", body, token)
+		}
+	})
+}
+
+type staticProjectResolver struct {
+	projectID uuid.UUID
+}
+
+func (r staticProjectResolver) GetCohortProjectID(ctx context.Context, cohortID uuid.UUID) (uuid.UUID, error) {
+	return r.projectID, nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pjhul/intent/internal/domain/organization"
 	"github.com/pjhul/intent/internal/domain/project"
+	"github.com/pjhul/intent/internal/tenant"
 )
 
 // Context keys for storing org and project in the request context
@@ -52,6 +53,7 @@ func (m *ContextMiddleware) ResolveOrganization() gin.HandlerFunc {
 		}
 
 		c.Set(OrganizationKey, org)
+		c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), org.ID))
 		c.Next()
 	}
 }
@@ -89,6 +91,7 @@ func (m *ContextMiddleware) ResolveProject() gin.HandlerFunc {
 		}
 
 		c.Set(ProjectKey, proj)
+		c.Request = c.Request.WithContext(tenant.WithProject(c.Request.Context(), proj.ID))
 		c.Next()
 	}
 }
@@ -0,0 +1,87 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pjhul/intent/internal/api/middleware"
+)
+
+func newTimeoutEngine(timeout time.Duration, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/slow", middleware.Timeout(timeout), handler)
+	return engine
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("slow handler observing the deadline returns 504", func(t *testing.T) {
+		engine := newTimeoutEngine(20*time.Millisecond, func(c *gin.Context) {
+			select {
+			case <-time.After(time.Second):
+				c.JSON(http.StatusOK, gin.H{"status": "ok"})
+			case <-c.Request.Context().Done():
+				c.JSON(http.StatusInternalServerError, gin.H{"error": c.Request.Context().Err().Error()})
+			}
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("status = %v, expected %v", w.Code, http.StatusGatewayTimeout)
+		}
+	})
+
+	t.Run("response written after the deadline is discarded", func(t *testing.T) {
+		engine := newTimeoutEngine(10*time.Millisecond, func(c *gin.Context) {
+			time.Sleep(30 * time.Millisecond)
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("status = %v, expected %v", w.Code, http.StatusGatewayTimeout)
+		}
+		if body := w.Body.String(); body != `{"error":"request timed out"}` {
+			t.Errorf("body = %v, expected timeout error", body)
+		}
+	})
+
+	t.Run("fast handler is unaffected", func(t *testing.T) {
+		engine := newTimeoutEngine(time.Second, func(c *gin.Context) {
+			if _, ok := c.Request.Context().Deadline(); !ok {
+				t.Error("request context has no deadline")
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %v, expected %v", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("zero timeout disables the deadline", func(t *testing.T) {
+		engine := newTimeoutEngine(0, func(c *gin.Context) {
+			if _, ok := c.Request.Context().Deadline(); ok {
+				t.Error("request context has a deadline")
+			}
+			c.Status(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("status = %v, expected %v", w.Code, http.StatusNoContent)
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/pjhul/intent/internal/api/handlers"
 	"github.com/pjhul/intent/internal/api/middleware"
@@ -16,7 +18,14 @@ type Router struct {
 	flinkHandler        *handlers.FlinkHandler
 	organizationHandler *handlers.OrganizationHandler
 	projectHandler      *handlers.ProjectHandler
+	templateHandler     *handlers.TemplateHandler
+	exportHandler       *handlers.ExportScheduleHandler
+	adminHandler        *handlers.AdminHandler
+	healthHandler       *handlers.HealthHandler
 	contextMiddleware   *middleware.ContextMiddleware
+	requestTimeout      time.Duration
+	adminRequestTimeout time.Duration
+	adminToken          string
 }
 
 // NewRouter creates a new router with all handlers
@@ -29,6 +38,8 @@ func NewRouter(
 	flinkHandler *handlers.FlinkHandler,
 	organizationHandler *handlers.OrganizationHandler,
 	projectHandler *handlers.ProjectHandler,
+	templateHandler *handlers.TemplateHandler,
+	adminHandler *handlers.AdminHandler,
 	contextMiddleware *middleware.ContextMiddleware,
 ) *Router {
 	return &Router{
@@ -40,16 +51,45 @@ func NewRouter(
 		flinkHandler:        flinkHandler,
 		organizationHandler: organizationHandler,
 		projectHandler:      projectHandler,
+		templateHandler:     templateHandler,
+		adminHandler:        adminHandler,
 		contextMiddleware:   contextMiddleware,
 	}
 }
 
+// SetRequestTimeouts sets the request timeouts for API and admin route groups.
+// Streaming routes are never subject to a timeout.
+func (r *Router) SetRequestTimeouts(requestTimeout, adminRequestTimeout time.Duration) {
+	r.requestTimeout = requestTimeout
+	r.adminRequestTimeout = adminRequestTimeout
+}
+
+// SetAdminToken sets the bearer token required by the admin endpoints
+func (r *Router) SetAdminToken(token string) {
+	r.adminToken = token
+}
+
+// SetHealthHandler enables dependency readiness checks at /health/ready
+func (r *Router) SetHealthHandler(h *handlers.HealthHandler) {
+	r.healthHandler = h
+}
+
+// SetExportScheduleHandler enables the cohort export schedule endpoints
+func (r *Router) SetExportScheduleHandler(h *handlers.ExportScheduleHandler) {
+	r.exportHandler = h
+}
+
 // SetupRoutes configures all API routes
 func (r *Router) SetupRoutes(engine *gin.Engine) {
 	// Health check
 	engine.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	if r.healthHandler != nil {
+		engine.GET("/health/ready", r.healthHandler.Ready)
+	}
+
+	timeout := middleware.Timeout(r.requestTimeout)
 
 	// API v1 routes
 	v1 := engine.Group("/api/v1")
@@ -76,33 +116,70 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 				projectScoped := projects.Group("/:projectSlug", r.contextMiddleware.ResolveProject())
 				{
 					// Cohort endpoints
-					cohorts := projectScoped.Group("/cohorts")
+					cohorts := projectScoped.Group("/cohorts", timeout)
 					{
 						cohorts.GET("", r.cohortHandler.List)
 						cohorts.POST("", r.cohortHandler.Create)
+						cohorts.POST("/from-template", r.cohortHandler.CreateFromTemplate)
+						cohorts.POST("/static", r.cohortHandler.CreateStatic)
+						cohorts.GET("/name-collisions", r.cohortHandler.NameCollisions)
+						cohorts.GET("/archived", r.cohortHandler.ListArchived)
+						cohorts.POST("/preview", r.cohortHandler.Preview)
+						cohorts.POST("/members/combined", r.membershipHandler.GetMembersInCohorts)
 						cohorts.GET("/:id", r.cohortHandler.Get)
 						cohorts.PUT("/:id", r.cohortHandler.Update)
 						cohorts.DELETE("/:id", r.cohortHandler.Delete)
 						cohorts.POST("/:id/activate", r.cohortHandler.Activate)
 						cohorts.POST("/:id/deactivate", r.cohortHandler.Deactivate)
+						cohorts.POST("/:id/restore", r.cohortHandler.Restore)
+						cohorts.POST("/:id/static-members", r.cohortHandler.UpdateStaticMembers)
+						cohorts.GET("/:id/size", r.cohortHandler.Size)
 						cohorts.POST("/:id/recompute", r.cohortHandler.Recompute)
+						cohorts.GET("/:id/recompute/estimate", r.cohortHandler.EstimateRecompute)
 						cohorts.GET("/:id/recompute/:jobId", r.cohortHandler.GetRecomputeStatus)
+						cohorts.DELETE("/:id/recompute/:jobId", r.cohortHandler.CancelRecompute)
 						cohorts.POST("/:id/check", r.membershipHandler.CheckMembership)
 						cohorts.GET("/:id/members", r.membershipHandler.GetCohortMembers)
+						cohorts.POST("/:id/members", r.membershipHandler.AddCohortMember)
+						cohorts.DELETE("/:id/members/:userId", r.membershipHandler.RemoveCohortMember)
+						cohorts.GET("/:id/members/bitmap", r.membershipHandler.GetCohortMembersBitmap)
+						cohorts.GET("/:id/members/count-by-property", r.membershipHandler.CountMembersByProperty)
+						cohorts.GET("/:id/members/count-by-range", r.membershipHandler.CountMembersByPropertyRange)
 						cohorts.GET("/:id/stats", r.membershipHandler.GetCohortStats)
+						cohorts.GET("/:id/versions/:version/members", r.membershipHandler.GetCohortMembersAtVersion)
+						if r.exportHandler != nil {
+							cohorts.GET("/:id/export-schedules", r.exportHandler.List)
+							cohorts.POST("/:id/export-schedules", r.exportHandler.Create)
+							cohorts.DELETE("/:id/export-schedules/:scheduleId", r.exportHandler.Delete)
+							cohorts.POST("/:id/exports", r.exportHandler.Export)
+							cohorts.GET("/:id/exports/:exportId", r.exportHandler.GetExport)
+						}
+					}
+
+					// Cohort template endpoints
+					templates := projectScoped.Group("/templates", timeout)
+					{
+						templates.GET("", r.templateHandler.List)
+						templates.POST("", r.templateHandler.Create)
+						templates.GET("/:id", r.templateHandler.Get)
+						templates.DELETE("/:id", r.templateHandler.Delete)
 					}
 
 					// Event endpoints under project
-					events := projectScoped.Group("/events")
+					events := projectScoped.Group("/events", timeout)
 					{
 						events.POST("", r.eventHandler.Ingest)
 						events.POST("/batch", r.eventHandler.IngestBatch)
 					}
 
 					// User endpoints under project
-					users := projectScoped.Group("/users")
+					users := projectScoped.Group("/users", timeout)
 					{
 						users.GET("/:id/cohorts", r.membershipHandler.GetUserCohorts)
+						users.DELETE("/:id", r.membershipHandler.EraseUser)
+						users.POST("/all-of", r.membershipHandler.GetUsersInAllCohorts)
+						users.POST("/none-of", r.membershipHandler.GetUsersInNoCohorts)
+						users.POST("/shared-cohorts", r.membershipHandler.GetSharedCohorts)
 					}
 
 					// Real-time streaming endpoints under project
@@ -115,7 +192,7 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		}
 
 		// Flink management endpoints (global, not project-scoped)
-		flink := v1.Group("/flink")
+		flink := v1.Group("/flink", timeout)
 		{
 			flink.GET("/overview", r.flinkHandler.GetClusterOverview)
 			flink.GET("/jobs", r.flinkHandler.ListJobs)
@@ -126,6 +203,20 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 			flink.GET("/jars", r.flinkHandler.ListJars)
 			flink.POST("/jars/:id/run", r.flinkHandler.SubmitJob)
 		}
+
+		// Admin endpoints (global, not project-scoped)
+		admin := v1.Group("/admin", middleware.AdminToken(r.adminToken), middleware.Timeout(r.adminRequestTimeout))
+		{
+			admin.POST("/cohorts/:id/consistency-check", r.adminHandler.CheckConsistency)
+			admin.GET("/cohorts/:id/drift", r.adminHandler.GetDrift)
+			admin.POST("/cohorts/:id/optimize", r.adminHandler.OptimizeMembership)
+			admin.GET("/cohorts/:id/members/:userId/raw", r.adminHandler.GetRawMembership)
+			admin.GET("/recompute/failures", r.adminHandler.ListRecomputeFailures)
+			admin.POST("/projects/:id/events/import", r.adminHandler.ImportEvents)
+			admin.GET("/imports/:id", r.adminHandler.GetImport)
+			admin.GET("/ingest/stats", r.adminHandler.GetIngestStats)
+			admin.POST("/kafka/consumer-groups/:group/offsets", r.adminHandler.ResetConsumerOffsets)
+		}
 	}
 
 	// WebSocket endpoint (outside /api/v1 for cleaner URL)
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ProjectMetadataKey is the metadata key carrying the ID of the project a
+// call is scoped to
+const ProjectMetadataKey = "x-project-id"
+
+// TokenAuth requires every stream to carry "authorization: Bearer <token>"
+// metadata. An empty token rejects every call, so the server stays closed
+// until a token is configured.
+func TokenAuth(token string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if token == "" {
+			return status.Error(codes.PermissionDenied, "token not configured")
+		}
+
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return status.Error(codes.Unauthenticated, "invalid token")
+		}
+		provided, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// projectFromMetadata returns the project a call is scoped to
+func projectFromMetadata(ctx context.Context) (uuid.UUID, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ProjectMetadataKey)
+	if len(values) == 0 {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "%s metadata is required", ProjectMetadataKey)
+	}
+	projectID, err := uuid.Parse(values[0])
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid project ID %q", values[0])
+	}
+	return projectID, nil
+}
@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/rpc/membershipv1"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Broadcaster interface for receiving membership changes
+type Broadcaster interface {
+	Subscribe(id string, sub *membership.StreamSubscription) chan *membership.MembershipChange
+	Unsubscribe(id string)
+}
+
+// MembershipStreamServer streams membership changes to gRPC clients
+type MembershipStreamServer struct {
+	membershipv1.UnimplementedMembershipStreamServer
+	broadcaster Broadcaster
+	projects    membership.CohortProjectResolver
+	anonymizer  *membership.Anonymizer
+}
+
+// NewMembershipStreamServer creates a new membership stream server. Streams
+// only carry changes of cohorts in the project named by the call's
+// ProjectMetadataKey metadata, resolved with projects.
+func NewMembershipStreamServer(broadcaster Broadcaster, projects membership.CohortProjectResolver) *MembershipStreamServer {
+	return &MembershipStreamServer{broadcaster: broadcaster, projects: projects}
+}
+
+// SetAnonymizer hashes user IDs in changes of projects that require it
+func (s *MembershipStreamServer) SetAnonymizer(anonymizer *membership.Anonymizer) {
+	s.anonymizer = anonymizer
+}
+
+// SubscribeMembershipChanges streams the project's changes matching the
+// request's cohort, user and direction filters until the client cancels
+func (s *MembershipStreamServer) SubscribeMembershipChanges(req *membershipv1.SubscribeMembershipChangesRequest, stream membershipv1.MembershipStream_SubscribeMembershipChangesServer) error {
+	ctx := stream.Context()
+	projectID, err := projectFromMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := newSubscription(req)
+	if err != nil {
+		return err
+	}
+
+	// Cohorts never move between projects, so each is resolved once per stream
+	inProject := make(map[uuid.UUID]bool, len(subscription.CohortIDs))
+	for _, cohortID := range subscription.CohortIDs {
+		owner, err := s.projects.GetCohortProjectID(ctx, cohortID)
+		if errors.Is(err, cohort.ErrCohortNotFound) || (err == nil && owner != projectID) {
+			return status.Errorf(codes.NotFound, "cohort %s not found", cohortID)
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to resolve cohort %s: %v", cohortID, err)
+		}
+		inProject[cohortID] = true
+	}
+
+	changeChan := s.broadcaster.Subscribe(subscription.ID, subscription)
+	defer s.broadcaster.Unsubscribe(subscription.ID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change, ok := <-changeChan:
+			if !ok {
+				return nil
+			}
+			if !subscription.MatchesChange(change) || !s.inProject(ctx, projectID, change.CohortID, inProject) {
+				continue
+			}
+			protected, err := s.anonymizer.ProtectChange(ctx, change, false)
+			if err != nil {
+				log.Printf("failed to anonymize change for cohort %s: %v", change.CohortID, err)
+				continue
+			}
+			if err := stream.Send(changeToProto(protected)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// inProject reports whether a cohort belongs to the project, caching the
+// answer in seen
+func (s *MembershipStreamServer) inProject(ctx context.Context, projectID, cohortID uuid.UUID, seen map[uuid.UUID]bool) bool {
+	if owned, ok := seen[cohortID]; ok {
+		return owned
+	}
+	owner, err := s.projects.GetCohortProjectID(ctx, cohortID)
+	if err != nil && !errors.Is(err, cohort.ErrCohortNotFound) {
+		log.Printf("failed to resolve project of cohort %s: %v", cohortID, err)
+		return false
+	}
+	seen[cohortID] = err == nil && owner == projectID
+	return seen[cohortID]
+}
+
+// newSubscription converts a subscribe request into a stream subscription
+func newSubscription(req *membershipv1.SubscribeMembershipChangesRequest) (*membership.StreamSubscription, error) {
+	cohortIDs := make([]uuid.UUID, 0, len(req.GetCohortIds()))
+	for _, id := range req.GetCohortIds() {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid cohort ID %q", id)
+		}
+		cohortIDs = append(cohortIDs, parsed)
+	}
+
+	var direction membership.ChangeDirection
+	switch req.GetDirection() {
+	case membershipv1.Direction_DIRECTION_UNSPECIFIED:
+	case membershipv1.Direction_DIRECTION_ENTRY:
+		direction = membership.ChangeDirectionEntry
+	case membershipv1.Direction_DIRECTION_EXIT:
+		direction = membership.ChangeDirectionExit
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid direction %v", req.GetDirection())
+	}
+
+	return &membership.StreamSubscription{
+		ID:        uuid.New().String(),
+		CohortIDs: cohortIDs,
+		UserIDs:   req.GetUserIds(),
+		Direction: direction,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func changeToProto(change *membership.MembershipChange) *membershipv1.MembershipChange {
+	msg := &membershipv1.MembershipChange{
+		CohortId:   change.CohortID.String(),
+		CohortName: change.CohortName,
+		UserId:     change.UserID,
+		PrevStatus: int32(change.PrevStatus),
+		NewStatus:  int32(change.NewStatus),
+		ChangedAt:  timestamppb.New(change.ChangedAt),
+		Reason:     string(change.Reason),
+	}
+	if change.TriggerEvent != nil {
+		msg.TriggerEvent = change.TriggerEvent.String()
+	}
+	return msg
+}
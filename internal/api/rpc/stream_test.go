@@ -0,0 +1,276 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/api/rpc"
+	"github.com/pjhul/intent/internal/api/rpc/membershipv1"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeBroadcaster struct {
+	subscribed chan chan *membership.MembershipChange
+}
+
+func (f *fakeBroadcaster) Subscribe(id string, sub *membership.StreamSubscription) chan *membership.MembershipChange {
+	ch := make(chan *membership.MembershipChange, 10)
+	f.subscribed <- ch
+	return ch
+}
+
+func (f *fakeBroadcaster) Unsubscribe(id string) {}
+
+// cohortProjects maps each known cohort to its project
+type cohortProjects map[uuid.UUID]uuid.UUID
+
+func (p cohortProjects) GetCohortProjectID(ctx context.Context, cohortID uuid.UUID) (uuid.UUID, error) {
+	projectID, ok := p[cohortID]
+	if !ok {
+		return uuid.Nil, cohort.ErrCohortNotFound
+	}
+	return projectID, nil
+}
+
+const testToken = "stream-token"
+
+// projectContext carries the test token and scopes calls to the project
+func projectContext(ctx context.Context, projectID uuid.UUID) context.Context {
+	return metadata.AppendToOutgoingContext(ctx,
+		"authorization", "Bearer "+testToken,
+		rpc.ProjectMetadataKey, projectID.String(),
+	)
+}
+
+func newClient(t *testing.T, streamServer *rpc.MembershipStreamServer) membershipv1.MembershipStreamClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.StreamInterceptor(rpc.TokenAuth(testToken)))
+	membershipv1.RegisterMembershipStreamServer(server, streamServer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return membershipv1.NewMembershipStreamClient(conn)
+}
+
+func TestMembershipStreamServer_SubscribeMembershipChanges(t *testing.T) {
+	projectID := uuid.New()
+	cohortID := uuid.New()
+	otherCohortID := uuid.New()
+	changedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	broadcaster := &fakeBroadcaster{subscribed: make(chan chan *membership.MembershipChange, 1)}
+	projects := cohortProjects{cohortID: projectID, otherCohortID: projectID}
+	client := newClient(t, rpc.NewMembershipStreamServer(broadcaster, projects))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SubscribeMembershipChanges(projectContext(ctx, projectID), &membershipv1.SubscribeMembershipChangesRequest{
+		CohortIds: []string{cohortID.String()},
+		Direction: membershipv1.Direction_DIRECTION_ENTRY,
+	})
+	if err != nil {
+		t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+	}
+
+	var changes chan *membership.MembershipChange
+	select {
+	case changes = <-broadcaster.subscribed:
+	case <-ctx.Done():
+		t.Fatal("server never subscribed to the broadcaster")
+	}
+
+	entry := func(cohortID uuid.UUID, userID string) *membership.MembershipChange {
+		return &membership.MembershipChange{
+			CohortID:   cohortID,
+			CohortName: "buyers",
+			UserID:     userID,
+			PrevStatus: membership.MembershipStatusOut,
+			NewStatus:  membership.MembershipStatusIn,
+			ChangedAt:  changedAt,
+			Reason:     membership.ChangeReasonEvent,
+		}
+	}
+	changes <- entry(otherCohortID, "user-1") // other cohort
+	changes <- &membership.MembershipChange{  // exit
+		CohortID:   cohortID,
+		UserID:     "user-2",
+		PrevStatus: membership.MembershipStatusIn,
+		NewStatus:  membership.MembershipStatusOut,
+		ChangedAt:  changedAt,
+	}
+	changes <- entry(cohortID, "user-3")
+
+	got, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if got.GetUserId() != "user-3" {
+		t.Errorf("UserId = %q, expected %q", got.GetUserId(), "user-3")
+	}
+	if got.GetCohortId() != cohortID.String() {
+		t.Errorf("CohortId = %q, expected %q", got.GetCohortId(), cohortID)
+	}
+	if got.GetNewStatus() != int32(membership.MembershipStatusIn) {
+		t.Errorf("NewStatus = %d, expected %d", got.GetNewStatus(), membership.MembershipStatusIn)
+	}
+	if !got.GetChangedAt().AsTime().Equal(changedAt) {
+		t.Errorf("ChangedAt = %v, expected %v", got.GetChangedAt().AsTime(), changedAt)
+	}
+	if got.GetReason() != string(membership.ChangeReasonEvent) {
+		t.Errorf("Reason = %q, expected %q", got.GetReason(), membership.ChangeReasonEvent)
+	}
+}
+
+func TestMembershipStreamServer_InvalidCohortID(t *testing.T) {
+	client := newClient(t, rpc.NewMembershipStreamServer(&fakeBroadcaster{subscribed: make(chan chan *membership.MembershipChange, 1)}, cohortProjects{}))
+
+	stream, err := client.SubscribeMembershipChanges(projectContext(context.Background(), uuid.New()), &membershipv1.SubscribeMembershipChangesRequest{
+		CohortIds: []string{"not-a-uuid"},
+	})
+	if err != nil {
+		t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Recv() error = %v, expected InvalidArgument", err)
+	}
+}
+
+func TestMembershipStreamServer_AnonymizesRequiredProjects(t *testing.T) {
+	projectID := uuid.New()
+	cohortID := uuid.New()
+	projects := cohortProjects{cohortID: projectID}
+	anonymizer := membership.NewAnonymizer([]byte("secret"), projects)
+	anonymizer.SetRequired(false, map[uuid.UUID]bool{projectID: true})
+
+	broadcaster := &fakeBroadcaster{subscribed: make(chan chan *membership.MembershipChange, 1)}
+	server := rpc.NewMembershipStreamServer(broadcaster, projects)
+	server.SetAnonymizer(anonymizer)
+	client := newClient(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SubscribeMembershipChanges(projectContext(ctx, projectID), &membershipv1.SubscribeMembershipChangesRequest{})
+	if err != nil {
+		t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+	}
+
+	var changes chan *membership.MembershipChange
+	select {
+	case changes = <-broadcaster.subscribed:
+	case <-ctx.Done():
+		t.Fatal("server never subscribed to the broadcaster")
+	}
+	changes <- &membership.MembershipChange{
+		CohortID:  cohortID,
+		UserID:    "alice@example.com",
+		NewStatus: membership.MembershipStatusIn,
+	}
+
+	got, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if expected := anonymizer.Token(projectID, "alice@example.com"); got.GetUserId() != expected {
+		t.Errorf("UserId = %q, expected token %q", got.GetUserId(), expected)
+	}
+}
+
+func TestMembershipStreamServer_Auth(t *testing.T) {
+	projectID := uuid.New()
+	client := newClient(t, rpc.NewMembershipStreamServer(&fakeBroadcaster{subscribed: make(chan chan *membership.MembershipChange, 1)}, cohortProjects{}))
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected codes.Code
+	}{
+		{"no token", metadata.AppendToOutgoingContext(context.Background(), rpc.ProjectMetadataKey, projectID.String()), codes.Unauthenticated},
+		{"wrong token", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong", rpc.ProjectMetadataKey, projectID.String()), codes.Unauthenticated},
+		{"no project", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken), codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.SubscribeMembershipChanges(tt.ctx, &membershipv1.SubscribeMembershipChangesRequest{})
+			if err != nil {
+				t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+			}
+			if _, err := stream.Recv(); status.Code(err) != tt.expected {
+				t.Errorf("Recv() error = %v, expected %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMembershipStreamServer_ProjectScope(t *testing.T) {
+	projectA, projectB := uuid.New(), uuid.New()
+	cohortA, cohortB := uuid.New(), uuid.New()
+	projects := cohortProjects{cohortA: projectA, cohortB: projectB}
+
+	broadcaster := &fakeBroadcaster{subscribed: make(chan chan *membership.MembershipChange, 1)}
+	client := newClient(t, rpc.NewMembershipStreamServer(broadcaster, projects))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("rejects another project's cohort", func(t *testing.T) {
+		stream, err := client.SubscribeMembershipChanges(projectContext(ctx, projectA), &membershipv1.SubscribeMembershipChangesRequest{
+			CohortIds: []string{cohortB.String()},
+		})
+		if err != nil {
+			t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+			t.Errorf("Recv() error = %v, expected NotFound", err)
+		}
+	})
+
+	t.Run("unfiltered stream carries only the project's changes", func(t *testing.T) {
+		stream, err := client.SubscribeMembershipChanges(projectContext(ctx, projectA), &membershipv1.SubscribeMembershipChangesRequest{})
+		if err != nil {
+			t.Fatalf("SubscribeMembershipChanges() error = %v", err)
+		}
+
+		var changes chan *membership.MembershipChange
+		select {
+		case changes = <-broadcaster.subscribed:
+		case <-ctx.Done():
+			t.Fatal("server never subscribed to the broadcaster")
+		}
+		changes <- &membership.MembershipChange{CohortID: cohortB, UserID: "user-b", NewStatus: membership.MembershipStatusIn}
+		changes <- &membership.MembershipChange{CohortID: uuid.New(), UserID: "user-deleted", NewStatus: membership.MembershipStatusIn}
+		changes <- &membership.MembershipChange{CohortID: cohortA, UserID: "user-a", NewStatus: membership.MembershipStatusIn}
+
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		if got.GetUserId() != "user-a" {
+			t.Errorf("UserId = %q, expected the change of project A's cohort", got.GetUserId())
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -14,6 +15,10 @@ type Config struct {
 	Kafka      KafkaConfig
 	Redis      RedisConfig
 	Flink      FlinkConfig
+	Ingest     IngestConfig
+	Recompute  RecomputeConfig
+	Privacy    PrivacyConfig
+	Cohort     CohortConfig
 }
 
 // ServerConfig holds HTTP server configuration
@@ -22,6 +27,37 @@ type ServerConfig struct {
 	Port         int           `envconfig:"SERVER_PORT" default:"8080"`
 	ReadTimeout  time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"30s"`
 	WriteTimeout time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	// RequestTimeout bounds API request handling; streaming routes are exempt and 0 disables it
+	RequestTimeout time.Duration `envconfig:"SERVER_REQUEST_TIMEOUT" default:"25s"`
+	// AdminRequestTimeout bounds admin endpoints, which may run long maintenance queries
+	AdminRequestTimeout time.Duration `envconfig:"SERVER_ADMIN_REQUEST_TIMEOUT" default:"5m"`
+	// AdminToken is the bearer token for the admin endpoints, which are disabled when empty
+	AdminToken string `envconfig:"SERVER_ADMIN_TOKEN" default:""`
+	// SSERetry is the reconnection delay advertised to SSE clients
+	SSERetry time.Duration `envconfig:"SERVER_SSE_RETRY" default:"3s"`
+	// SSEKeepaliveInterval is how often SSE keepalive events are sent
+	SSEKeepaliveInterval time.Duration `envconfig:"SERVER_SSE_KEEPALIVE_INTERVAL" default:"30s"`
+	// StreamReapThreshold is how long a stream subscriber's buffer may stay
+	// full before the subscriber is dropped; 0 disables reaping
+	StreamReapThreshold time.Duration `envconfig:"SERVER_STREAM_REAP_THRESHOLD" default:"1m"`
+	// StreamSettingsTTL is how long a cohort's stream_enabled setting is cached
+	// by the broadcaster before it's read again
+	StreamSettingsTTL time.Duration `envconfig:"SERVER_STREAM_SETTINGS_TTL" default:"30s"`
+	// ShutdownTimeout bounds how long shutdown waits for streaming connections
+	// to close and outstanding requests to complete
+	ShutdownTimeout time.Duration `envconfig:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+	// GRPCPort serves membership change streams over gRPC; 0 disables the gRPC server
+	GRPCPort int `envconfig:"SERVER_GRPC_PORT" default:"0"`
+	// GRPCToken is the bearer token gRPC clients must send; it is required
+	// when the gRPC server is enabled
+	GRPCToken string `envconfig:"SERVER_GRPC_TOKEN" default:""`
+	// GRPCTLSCertFile and GRPCTLSKeyFile serve gRPC over TLS when both are set
+	GRPCTLSCertFile string `envconfig:"SERVER_GRPC_TLS_CERT_FILE" default:""`
+	GRPCTLSKeyFile  string `envconfig:"SERVER_GRPC_TLS_KEY_FILE" default:""`
+	// AllowDegradedStart starts the service while optional dependencies (Redis,
+	// Flink) are down, reporting their features as degraded in /health/ready.
+	// Critical dependencies fail startup either way.
+	AllowDegradedStart bool `envconfig:"SERVER_ALLOW_DEGRADED_START" default:"true"`
 }
 
 // PostgreSQLConfig holds PostgreSQL configuration
@@ -57,6 +93,102 @@ type ClickHouseConfig struct {
 	MaxOpenConns int           `envconfig:"CLICKHOUSE_MAX_OPEN_CONNS" default:"10"`
 	MaxIdleConns int           `envconfig:"CLICKHOUSE_MAX_IDLE_CONNS" default:"5"`
 	DialTimeout  time.Duration `envconfig:"CLICKHOUSE_DIAL_TIMEOUT" default:"10s"`
+	// Protocol is native (port 9000), http (8123) or https; set Port to match
+	Protocol ClickHouseProtocol `envconfig:"CLICKHOUSE_PROTOCOL" default:"native"`
+	// TLS enables TLS for the native protocol; https always uses TLS
+	TLS bool `envconfig:"CLICKHOUSE_TLS" default:"false"`
+	// TLSCAFile is a PEM bundle trusted in addition to the system roots
+	TLSCAFile string `envconfig:"CLICKHOUSE_TLS_CA_FILE" default:""`
+	// TLSServerName overrides the server name verified against the certificate
+	TLSServerName string `envconfig:"CLICKHOUSE_TLS_SERVER_NAME" default:""`
+	// TLSInsecureSkipVerify disables certificate verification; for testing only
+	TLSInsecureSkipVerify bool `envconfig:"CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY" default:"false"`
+	// MembershipModel is the table membership reads use: collapsing sums signs in
+	// cohort_membership_current, replacing reads the latest status from cohort_membership_state
+	MembershipModel MembershipModel `envconfig:"CLICKHOUSE_MEMBERSHIP_MODEL" default:"collapsing"`
+	// ProjectIsolation stores each project's events and membership in its own
+	// database, provisioned when the project is created, instead of sharing
+	// tables keyed by project_id
+	ProjectIsolation bool `envconfig:"CLICKHOUSE_PROJECT_ISOLATION" default:"false"`
+	// EventRetentionDays is how long events are kept in projects that don't
+	// set their own retention. It should match the events_raw TTL; projects
+	// can override it, which changes their table's TTL under ProjectIsolation.
+	EventRetentionDays int `envconfig:"CLICKHOUSE_EVENT_RETENTION_DAYS" default:"365"`
+	// SlowQueryThreshold logs reads that take longer; 0 disables the slow query log
+	SlowQueryThreshold time.Duration `envconfig:"CLICKHOUSE_SLOW_QUERY_THRESHOLD" default:"2s"`
+	// OptimizeMinInterval is the least time between admin-triggered membership
+	// optimizes, which rewrite whole partitions
+	OptimizeMinInterval time.Duration `envconfig:"CLICKHOUSE_OPTIMIZE_MIN_INTERVAL" default:"10m"`
+	// MembershipFallback is how membership checks answer when ClickHouse fails:
+	// fail_closed reports non-membership, fail_open the last cached membership
+	// or MembershipFallbackDefault, and error responds 503
+	MembershipFallback MembershipFallback `envconfig:"CLICKHOUSE_MEMBERSHIP_FALLBACK" default:"fail_closed"`
+	// MembershipFallbackDefault is the fail_open answer for users with no cached membership
+	MembershipFallbackDefault bool `envconfig:"CLICKHOUSE_MEMBERSHIP_FALLBACK_DEFAULT" default:"true"`
+}
+
+// MembershipModel is the storage model current membership is read from
+type MembershipModel string
+
+const (
+	MembershipModelCollapsing MembershipModel = "collapsing"
+	MembershipModelReplacing  MembershipModel = "replacing"
+)
+
+// Decode validates the membership model when loaded from the environment
+func (m *MembershipModel) Decode(value string) error {
+	switch MembershipModel(value) {
+	case MembershipModelCollapsing, MembershipModelReplacing:
+		*m = MembershipModel(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid membership model %q: must be collapsing or replacing", value)
+	}
+}
+
+// MembershipFallback is the policy for membership checks ClickHouse fails on
+type MembershipFallback string
+
+const (
+	MembershipFallbackFailClosed MembershipFallback = "fail_closed"
+	MembershipFallbackFailOpen   MembershipFallback = "fail_open"
+	MembershipFallbackError      MembershipFallback = "error"
+)
+
+// Decode validates the membership fallback when loaded from the environment
+func (f *MembershipFallback) Decode(value string) error {
+	switch MembershipFallback(value) {
+	case MembershipFallbackFailClosed, MembershipFallbackFailOpen, MembershipFallbackError:
+		*f = MembershipFallback(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid membership fallback %q: must be fail_closed, fail_open or error", value)
+	}
+}
+
+// ClickHouseProtocol is the interface the ClickHouse client connects over
+type ClickHouseProtocol string
+
+const (
+	ClickHouseNative ClickHouseProtocol = "native"
+	ClickHouseHTTP   ClickHouseProtocol = "http"
+	ClickHouseHTTPS  ClickHouseProtocol = "https"
+)
+
+// Decode validates the protocol when loaded from the environment
+func (p *ClickHouseProtocol) Decode(value string) error {
+	switch ClickHouseProtocol(value) {
+	case ClickHouseNative, ClickHouseHTTP, ClickHouseHTTPS:
+		*p = ClickHouseProtocol(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid ClickHouse protocol %q: must be native, http or https", value)
+	}
+}
+
+// UseTLS reports whether connections are encrypted
+func (c ClickHouseConfig) UseTLS() bool {
+	return c.Protocol == ClickHouseHTTPS || c.TLS
 }
 
 // KafkaConfig holds Kafka configuration
@@ -65,9 +197,69 @@ type KafkaConfig struct {
 	EventsTopic      string        `envconfig:"KAFKA_EVENTS_TOPIC" default:"events.raw"`
 	CohortsTopic     string        `envconfig:"KAFKA_COHORTS_TOPIC" default:"cohort.definitions"`
 	ChangesTopic     string        `envconfig:"KAFKA_CHANGES_TOPIC" default:"cohort.changes"`
+	MembershipTopic  string        `envconfig:"KAFKA_MEMBERSHIP_TOPIC" default:"cohort.membership"`
 	ConsumerGroup    string        `envconfig:"KAFKA_CONSUMER_GROUP" default:"cohort-service"`
 	SessionTimeout   time.Duration `envconfig:"KAFKA_SESSION_TIMEOUT" default:"30s"`
 	HeartbeatTimeout time.Duration `envconfig:"KAFKA_HEARTBEAT_TIMEOUT" default:"3s"`
+	// ConnectTimeout bounds the startup check that at least one broker is reachable
+	ConnectTimeout time.Duration `envconfig:"KAFKA_CONNECT_TIMEOUT" default:"10s"`
+	// WriteMaxAttempts is how many times a produce is tried, reconnecting to
+	// another broker between attempts, before it fails
+	WriteMaxAttempts int `envconfig:"KAFKA_WRITE_MAX_ATTEMPTS" default:"10"`
+	// ChangelogExportEnabled produces every changelog entry to ChangelogExportTopic
+	ChangelogExportEnabled bool   `envconfig:"KAFKA_CHANGELOG_EXPORT_ENABLED" default:"false"`
+	ChangelogExportTopic   string `envconfig:"KAFKA_CHANGELOG_EXPORT_TOPIC" default:"cohort.changelog"`
+	// StartOffset is where a new consumer group starts reading; existing groups resume from their commits
+	StartOffset StartOffset `envconfig:"KAFKA_START_OFFSET" default:"earliest"`
+	// ConsumerErrorPolicy decides what happens to a change the consumer's
+	// handler still fails on after ConsumerMaxRetries retries
+	ConsumerErrorPolicy  ConsumerErrorPolicy `envconfig:"KAFKA_CONSUMER_ERROR_POLICY" default:"dlq"`
+	ConsumerMaxRetries   int                 `envconfig:"KAFKA_CONSUMER_MAX_RETRIES" default:"3"`
+	ConsumerRetryBackoff time.Duration       `envconfig:"KAFKA_CONSUMER_RETRY_BACKOFF" default:"1s"`
+	// DLQTopic receives changes the consumer gave up on under the dlq policy
+	DLQTopic string `envconfig:"KAFKA_DLQ_TOPIC" default:"cohort.changes.dlq"`
+}
+
+// StartOffset is the offset a new consumer group starts from: earliest or latest
+type StartOffset string
+
+const (
+	StartOffsetEarliest StartOffset = "earliest"
+	StartOffsetLatest   StartOffset = "latest"
+)
+
+// Decode validates the offset policy when loaded from the environment
+func (o *StartOffset) Decode(value string) error {
+	switch StartOffset(value) {
+	case StartOffsetEarliest, StartOffsetLatest:
+		*o = StartOffset(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid start offset %q: must be earliest or latest", value)
+	}
+}
+
+// ConsumerErrorPolicy is how the consumer handles a message its handler keeps
+// failing on: skip commits past it, dlq forwards it to the dead-letter topic
+// and commits, and block stops consuming without committing so it's retried
+// after a restart
+type ConsumerErrorPolicy string
+
+const (
+	ConsumerErrorSkip  ConsumerErrorPolicy = "skip"
+	ConsumerErrorDLQ   ConsumerErrorPolicy = "dlq"
+	ConsumerErrorBlock ConsumerErrorPolicy = "block"
+)
+
+// Decode validates the error policy when loaded from the environment
+func (p *ConsumerErrorPolicy) Decode(value string) error {
+	switch ConsumerErrorPolicy(value) {
+	case ConsumerErrorSkip, ConsumerErrorDLQ, ConsumerErrorBlock:
+		*p = ConsumerErrorPolicy(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid consumer error policy %q: must be skip, dlq or block", value)
+	}
 }
 
 // RedisConfig holds Redis configuration
@@ -79,6 +271,9 @@ type RedisConfig struct {
 	PoolSize     int           `envconfig:"REDIS_POOL_SIZE" default:"10"`
 	MinIdleConns int           `envconfig:"REDIS_MIN_IDLE_CONNS" default:"5"`
 	CacheTTL     time.Duration `envconfig:"REDIS_CACHE_TTL" default:"5m"`
+	// CompressionThreshold gzips cached user cohort lists of at least this many
+	// bytes; 0 disables compression
+	CompressionThreshold int `envconfig:"REDIS_COMPRESSION_THRESHOLD" default:"0"`
 }
 
 // FlinkConfig holds Flink REST API configuration
@@ -92,6 +287,160 @@ func (c FlinkConfig) URL() string {
 	return "http://" + c.Host + ":" + intToStr(c.Port)
 }
 
+// IngestConfig holds event ingestion configuration
+type IngestConfig struct {
+	// MissingUserID controls events without a user_id: "reject" or "anonymous"
+	MissingUserID   string `envconfig:"INGEST_MISSING_USER_ID" default:"reject"`
+	AnonymousUserID string `envconfig:"INGEST_ANONYMOUS_USER_ID" default:"anonymous"`
+	// MaxPropertyDepth and MaxPropertyBytes bound event properties; 0 disables the check
+	MaxPropertyDepth int `envconfig:"INGEST_MAX_PROPERTY_DEPTH" default:"10"`
+	MaxPropertyBytes int `envconfig:"INGEST_MAX_PROPERTY_BYTES" default:"32768"`
+	// MaxPropertyCount is the most top-level property keys an event may have; 0 disables the check
+	MaxPropertyCount int `envconfig:"INGEST_MAX_PROPERTY_COUNT" default:"500"`
+	// MaxPropertyValueLength is the longest string property value in bytes,
+	// including values nested under a key; 0 disables the check
+	MaxPropertyValueLength int `envconfig:"INGEST_MAX_PROPERTY_VALUE_LENGTH" default:"8192"`
+	// PropertyValueLengthOverrides sets MaxPropertyValueLength for individual
+	// top-level keys as "<key>:<bytes>" pairs separated by commas
+	PropertyValueLengthOverrides map[string]int `envconfig:"INGEST_PROPERTY_VALUE_LENGTH_OVERRIDES" default:""`
+	// OversizedPropertyValues controls values over their length limit:
+	// "reject" fails the event and "truncate" cuts the value to the limit
+	OversizedPropertyValues string `envconfig:"INGEST_OVERSIZED_PROPERTY_VALUES" default:"reject"`
+	// PropertyPolicies is a JSON object of project ID to property policy,
+	// e.g. {"<project-id>": {"mode": "deny", "keys": ["email"], "action": "strip"}}
+	PropertyPolicies string `envconfig:"INGEST_PROPERTY_POLICIES" default:""`
+	// LowercasePropertyKeys lowercases top-level event property keys at ingest
+	// and property keys in cohort rules when they're saved
+	LowercasePropertyKeys bool `envconfig:"INGEST_LOWERCASE_PROPERTY_KEYS" default:"false"`
+	// LowercasePropertyKeysOverrides sets LowercasePropertyKeys for individual
+	// projects as "<project-id>:<true|false>" pairs separated by commas
+	LowercasePropertyKeysOverrides map[string]bool `envconfig:"INGEST_LOWERCASE_PROPERTY_KEYS_OVERRIDES" default:""`
+	// LiveEvaluation writes cohort joins as soon as a single ingested event qualifies a user
+	LiveEvaluation bool `envconfig:"INGEST_LIVE_EVALUATION" default:"false"`
+	// LiveEvaluationMaxCohorts bounds the cohorts evaluated per live event
+	LiveEvaluationMaxCohorts int `envconfig:"INGEST_LIVE_EVALUATION_MAX_COHORTS" default:"10"`
+	// PropertyFastPath decides cohorts made only of untimed property conditions
+	// from the ingested event itself instead of querying ClickHouse
+	PropertyFastPath bool `envconfig:"INGEST_PROPERTY_FAST_PATH" default:"true"`
+	// SequenceEvents stamps ingested events with an increasing sequence number
+	// that orders events sharing a timestamp
+	SequenceEvents bool `envconfig:"INGEST_SEQUENCE_EVENTS" default:"true"`
+	// ImportBatchSize is the number of events a bulk import publishes at a time
+	ImportBatchSize int `envconfig:"INGEST_IMPORT_BATCH_SIZE" default:"500"`
+	// ImportBatchInterval spaces out a bulk import's batches; 0 disables throttling
+	ImportBatchInterval time.Duration `envconfig:"INGEST_IMPORT_BATCH_INTERVAL" default:"100ms"`
+	// AckMode is when single event ingests are acknowledged unless the request
+	// chooses: "produced" to Kafka or "persisted" to ClickHouse
+	AckMode string `envconfig:"INGEST_ACK_MODE" default:"produced"`
+	// AckTimeout bounds how long a persisted ack waits for the event to reach ClickHouse
+	AckTimeout time.Duration `envconfig:"INGEST_ACK_TIMEOUT" default:"5s"`
+	// AckPollInterval is how often a persisted ack checks ClickHouse for the event
+	AckPollInterval time.Duration `envconfig:"INGEST_ACK_POLL_INTERVAL" default:"100ms"`
+}
+
+// RecomputeConfig holds cohort recompute configuration
+type RecomputeConfig struct {
+	// SyncThreshold is the largest expected cohort size recomputed inline for ?wait=true
+	SyncThreshold int64 `envconfig:"RECOMPUTE_SYNC_THRESHOLD" default:"10000"`
+	// MinInterval is the shortest per-cohort recompute_interval accepted
+	MinInterval time.Duration `envconfig:"RECOMPUTE_MIN_INTERVAL" default:"5m"`
+	// ScheduleTick is how often the scheduler checks for cohorts due a recompute
+	// and sweeps members past their cohort's membership TTL
+	ScheduleTick time.Duration `envconfig:"RECOMPUTE_SCHEDULE_TICK" default:"1m"`
+	// QueueCapacity is the most pending recompute jobs; further submissions are rejected
+	QueueCapacity int `envconfig:"RECOMPUTE_QUEUE_CAPACITY" default:"100"`
+	// ConsistencyMaxUsers bounds the users read per table by the consistency checker
+	ConsistencyMaxUsers int `envconfig:"RECOMPUTE_CONSISTENCY_MAX_USERS" default:"100000"`
+	// ConsistencyRepairThrottle is the pause between consistency repair batches
+	ConsistencyRepairThrottle time.Duration `envconfig:"RECOMPUTE_CONSISTENCY_REPAIR_THROTTLE" default:"100ms"`
+	// DebugSQL logs the SQL and args generated for recomputes and previews
+	DebugSQL bool `envconfig:"RECOMPUTE_DEBUG_SQL" default:"false"`
+	// DebugSQLRedactArgs logs placeholders instead of bound values when DebugSQL is on
+	DebugSQLRedactArgs bool `envconfig:"RECOMPUTE_DEBUG_SQL_REDACT_ARGS" default:"false"`
+	// DebugSQLOnJobs also records the SQL on recompute jobs when DebugSQL is on
+	DebugSQLOnJobs bool `envconfig:"RECOMPUTE_DEBUG_SQL_ON_JOBS" default:"false"`
+	// ProduceChanges produces each membership change a recompute writes to the changes topic
+	ProduceChanges bool `envconfig:"RECOMPUTE_PRODUCE_CHANGES" default:"false"`
+	// ProduceBatchSize is how many changes are produced per Kafka write; 0 matches the ClickHouse batch size
+	ProduceBatchSize int `envconfig:"RECOMPUTE_PRODUCE_BATCH_SIZE" default:"0"`
+	// ApproxSampleRate is the fraction of users sampled for ?approx=true cohort sizes
+	ApproxSampleRate float64 `envconfig:"RECOMPUTE_APPROX_SAMPLE_RATE" default:"0.1"`
+	// PreviewSampleSize caps how many matching user IDs a rules preview lists; 0 lists none
+	PreviewSampleSize int `envconfig:"RECOMPUTE_PREVIEW_SAMPLE_SIZE" default:"20"`
+	// Hysteresis is how many consecutive recomputes must find a join or leave
+	// before it's applied; 1 applies changes immediately
+	Hysteresis int `envconfig:"RECOMPUTE_HYSTERESIS" default:"1"`
+	// RuleChangeDebounce is how long a cohort's rules must go unedited before
+	// the update is recomputed; 0 leaves rule updates to scheduled and manual recomputes
+	RuleChangeDebounce time.Duration `envconfig:"RECOMPUTE_RULE_CHANGE_DEBOUNCE" default:"30s"`
+	// JobRetention is how long finished recompute jobs are kept, always
+	// keeping each cohort's latest; 0 keeps them forever
+	JobRetention time.Duration `envconfig:"RECOMPUTE_JOB_RETENTION" default:"168h"`
+}
+
+// CohortConfig holds cohort definition configuration
+type CohortConfig struct {
+	// MaxPerProject is how many cohorts a project may hold; 0 means unlimited
+	MaxPerProject int `envconfig:"COHORT_MAX_PER_PROJECT" default:"1000"`
+	// MaxPerProjectOverrides sets the limit for individual projects as
+	// "<project-id>:<limit>" pairs separated by commas
+	MaxPerProjectOverrides map[string]int `envconfig:"COHORT_MAX_PER_PROJECT_OVERRIDES" default:""`
+	// UniqueNames rejects cohorts whose name is already used in the project
+	UniqueNames bool `envconfig:"COHORT_UNIQUE_NAMES" default:"false"`
+	// UniqueNamesOverrides sets UniqueNames for individual projects as
+	// "<project-id>:<true|false>" pairs separated by commas
+	UniqueNamesOverrides map[string]bool `envconfig:"COHORT_UNIQUE_NAMES_OVERRIDES" default:""`
+	// DedupDefinitions skips producing a cohort definition identical to the
+	// last one produced, e.g. when activating an already active cohort
+	DedupDefinitions bool `envconfig:"COHORT_DEDUP_DEFINITIONS" default:"true"`
+	// MaxPropertyFilters is the most property filters a condition may have; 0 means unlimited
+	MaxPropertyFilters int `envconfig:"COHORT_MAX_PROPERTY_FILTERS" default:"50"`
+	// MaxExcludedUserIDs is the most user IDs a cohort's rules may exclude; 0 means unlimited
+	MaxExcludedUserIDs int `envconfig:"COHORT_MAX_EXCLUDED_USER_IDS" default:"1000"`
+	// AggregateFunctions overrides the ClickHouse function used for an
+	// aggregation as "<aggregation>:<function>" pairs separated by commas,
+	// e.g. "distinct_count:uniq" to trade exact distinct counts for speed
+	AggregateFunctions map[string]string `envconfig:"COHORT_AGGREGATE_FUNCTIONS" default:""`
+	// MembershipSnapshotInterval is how often current membership is
+	// snapshotted for point-in-time checks; 0 disables snapshots
+	MembershipSnapshotInterval time.Duration `envconfig:"COHORT_MEMBERSHIP_SNAPSHOT_INTERVAL" default:"24h"`
+	// ExportScheduleTick is how often scheduled exports are checked for being
+	// due; 0 disables scheduled exports
+	ExportScheduleTick time.Duration `envconfig:"COHORT_EXPORT_SCHEDULE_TICK" default:"1m"`
+	// MaxConcurrentExports is how many scheduled and on-demand exports run
+	// at once; further exports are queued
+	MaxConcurrentExports int `envconfig:"COHORT_MAX_CONCURRENT_EXPORTS" default:"2"`
+	// ExportJobRetention is how long finished on-demand exports can be read
+	// back; 0 keeps them forever
+	ExportJobRetention time.Duration `envconfig:"COHORT_EXPORT_JOB_RETENTION" default:"24h"`
+	// ExportTopicPrefix is what the topic of every kafka:// export destination
+	// must start with; the service's own topics are always refused
+	ExportTopicPrefix string `envconfig:"COHORT_EXPORT_TOPIC_PREFIX" default:"cohort-exports"`
+	// RFMScoreEvent is the event the "rfm" user score is computed from, e.g.
+	// purchase; empty disables score computation
+	RFMScoreEvent string `envconfig:"COHORT_RFM_SCORE_EVENT"`
+	// RFMScoreValueProperty is the numeric event property summed for the
+	// monetary part of the RFM score
+	RFMScoreValueProperty string `envconfig:"COHORT_RFM_SCORE_VALUE_PROPERTY" default:"amount"`
+	// RFMScoreWindow bounds how far back events count towards the RFM score
+	RFMScoreWindow time.Duration `envconfig:"COHORT_RFM_SCORE_WINDOW" default:"8760h"`
+	// ScoreInterval is how often user scores are recomputed
+	ScoreInterval time.Duration `envconfig:"COHORT_SCORE_INTERVAL" default:"24h"`
+}
+
+// PrivacyConfig holds user data privacy configuration
+type PrivacyConfig struct {
+	// UserIDHashSecret derives the per-project HMAC keys used for ?anonymize=true;
+	// anonymization is unavailable when empty
+	UserIDHashSecret string `envconfig:"PRIVACY_USER_ID_HASH_SECRET" default:""`
+	// AnonymizeUserIDs hashes user IDs in every API response, stream and
+	// export whether or not the consumer asks for it
+	AnonymizeUserIDs bool `envconfig:"PRIVACY_ANONYMIZE_USER_IDS" default:"false"`
+	// AnonymizeUserIDsOverrides sets AnonymizeUserIDs for individual projects
+	// as "<project-id>:<true|false>" pairs separated by commas
+	AnonymizeUserIDsOverrides map[string]bool `envconfig:"PRIVACY_ANONYMIZE_USER_IDS_OVERRIDES" default:""`
+}
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	var cfg Config
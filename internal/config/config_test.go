@@ -0,0 +1,153 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pjhul/intent/internal/config"
+)
+
+func validConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	return cfg
+}
+
+func TestConfig_Validate_Defaults(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Errorf("Validate() = %v, expected nil for the defaults", err)
+	}
+}
+
+func TestConfig_Validate_AggregatesProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		mutate   func(*config.Config)
+		expected []string
+	}{
+		{
+			name: "ports and brokers",
+			mutate: func(c *config.Config) {
+				c.Server.Port = 0
+				c.PostgreSQL.Port = 70000
+				c.Kafka.Brokers = nil
+			},
+			expected: []string{
+				"SERVER_PORT must be between 1 and 65535, got 0",
+				"POSTGRES_PORT must be between 1 and 65535, got 70000",
+				"KAFKA_BROKERS must list at least one broker",
+			},
+		},
+		{
+			name: "pool sizes",
+			mutate: func(c *config.Config) {
+				c.PostgreSQL.MaxOpenConns = -1
+				c.ClickHouse.MaxOpenConns = 2
+				c.ClickHouse.MaxIdleConns = 5
+				c.Redis.PoolSize = -3
+			},
+			expected: []string{
+				"POSTGRES_MAX_OPEN_CONNS must not be negative, got -1",
+				"CLICKHOUSE_MAX_IDLE_CONNS (5) must not exceed CLICKHOUSE_MAX_OPEN_CONNS (2)",
+				"REDIS_POOL_SIZE must not be negative, got -3",
+			},
+		},
+		{
+			name: "required fields",
+			mutate: func(c *config.Config) {
+				c.Kafka.Brokers = []string{"localhost:9092", " "}
+				c.Kafka.EventsTopic = ""
+				c.Kafka.ChangelogExportEnabled = true
+				c.Kafka.ChangelogExportTopic = ""
+				c.ClickHouse.Database = ""
+			},
+			expected: []string{
+				"CLICKHOUSE_DATABASE is required",
+				"KAFKA_BROKERS entry 1 is empty",
+				"KAFKA_EVENTS_TOPIC is required",
+				"KAFKA_CHANGELOG_EXPORT_TOPIC is required",
+			},
+		},
+		{
+			name: "ranges",
+			mutate: func(c *config.Config) {
+				c.Kafka.HeartbeatTimeout = c.Kafka.SessionTimeout
+				c.Ingest.MissingUserID = "drop"
+				c.Recompute.ScheduleTick = 0
+				c.Recompute.ApproxSampleRate = 1.5
+				c.Recompute.Hysteresis = 0
+			},
+			expected: []string{
+				"KAFKA_HEARTBEAT_TIMEOUT (30s) must be less than KAFKA_SESSION_TIMEOUT (30s)",
+				`INGEST_MISSING_USER_ID must be reject or anonymous, got "drop"`,
+				"RECOMPUTE_SCHEDULE_TICK must be positive, got 0s",
+				"RECOMPUTE_APPROX_SAMPLE_RATE must be greater than 0 and at most 1, got 1.5",
+				"RECOMPUTE_HYSTERESIS must be at least 1, got 0",
+			},
+		},
+		{
+			name: "anonymization without a secret",
+			mutate: func(c *config.Config) {
+				c.Privacy.AnonymizeUserIDsOverrides = map[string]bool{"0b7e3c5a-9a0e-4d8e-8f43-2d5c7f1b6a10": true}
+			},
+			expected: []string{
+				"PRIVACY_USER_ID_HASH_SECRET is required to anonymize user IDs",
+			},
+		},
+		{
+			name: "grpc without a token",
+			mutate: func(c *config.Config) {
+				c.Server.GRPCPort = 9090
+				c.Server.GRPCTLSCertFile = "/etc/tls/tls.crt"
+			},
+			expected: []string{
+				"SERVER_GRPC_TOKEN is required",
+				"SERVER_GRPC_TLS_CERT_FILE and SERVER_GRPC_TLS_KEY_FILE must be set together",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.mutate(cfg)
+
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("Validate() = nil, expected an error")
+			}
+
+			problems := config.Problems(err)
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("problems = %q, expected %q", problems, tt.expected)
+			}
+			for i, want := range tt.expected {
+				if problems[i] != want {
+					t.Errorf("problems[%d] = %q, expected %q", i, problems[i], want)
+				}
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Error() = %q, expected it to contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestClickHouseConfig_Validate(t *testing.T) {
+	cfg := validConfig(t).ClickHouse
+	cfg.Host = ""
+	cfg.DialTimeout = -time.Second
+
+	problems := config.Problems(cfg.Validate())
+	expected := []string{
+		"CLICKHOUSE_HOST is required",
+		"CLICKHOUSE_DIAL_TIMEOUT must be positive, got -1s",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("problems = %q, expected %q", problems, expected)
+	}
+}
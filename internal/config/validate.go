@@ -0,0 +1,370 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// problems collects validation failures so they're reported together
+type problems []string
+
+func (p *problems) addf(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p *problems) port(name string, port int) {
+	if port < 1 || port > 65535 {
+		p.addf("%s must be between 1 and 65535, got %d", name, port)
+	}
+}
+
+func (p *problems) required(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		p.addf("%s is required", name)
+	}
+}
+
+func (p *problems) err() error {
+	if len(*p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: *p}
+}
+
+// Validate checks ranges and required fields, returning a *ValidationError
+// listing every problem so misconfigurations fail at startup
+func (c *Config) Validate() error {
+	var p problems
+	c.Server.validate(&p)
+	c.PostgreSQL.validate(&p)
+	c.ClickHouse.validate(&p)
+	c.Kafka.validate(&p)
+	c.Redis.validate(&p)
+	c.Flink.validate(&p)
+	c.Ingest.validate(&p)
+	c.Recompute.validate(&p)
+	c.Cohort.validate(&p)
+	c.Privacy.validate(&p)
+	return p.err()
+}
+
+func (c ServerConfig) validate(p *problems) {
+	p.port("SERVER_PORT", c.Port)
+	if c.ReadTimeout <= 0 {
+		p.addf("SERVER_READ_TIMEOUT must be positive, got %s", c.ReadTimeout)
+	}
+	if c.WriteTimeout <= 0 {
+		p.addf("SERVER_WRITE_TIMEOUT must be positive, got %s", c.WriteTimeout)
+	}
+	if c.RequestTimeout < 0 {
+		p.addf("SERVER_REQUEST_TIMEOUT must not be negative, got %s", c.RequestTimeout)
+	}
+	if c.AdminRequestTimeout < 0 {
+		p.addf("SERVER_ADMIN_REQUEST_TIMEOUT must not be negative, got %s", c.AdminRequestTimeout)
+	}
+	if c.SSERetry < 0 {
+		p.addf("SERVER_SSE_RETRY must not be negative, got %s", c.SSERetry)
+	}
+	if c.SSEKeepaliveInterval <= 0 {
+		p.addf("SERVER_SSE_KEEPALIVE_INTERVAL must be positive, got %s", c.SSEKeepaliveInterval)
+	}
+	if c.StreamReapThreshold < 0 {
+		p.addf("SERVER_STREAM_REAP_THRESHOLD must not be negative, got %s", c.StreamReapThreshold)
+	}
+	if c.StreamSettingsTTL < 0 {
+		p.addf("SERVER_STREAM_SETTINGS_TTL must not be negative, got %s", c.StreamSettingsTTL)
+	}
+	if c.ShutdownTimeout <= 0 {
+		p.addf("SERVER_SHUTDOWN_TIMEOUT must be positive, got %s", c.ShutdownTimeout)
+	}
+	if c.GRPCPort != 0 {
+		p.port("SERVER_GRPC_PORT", c.GRPCPort)
+		p.required("SERVER_GRPC_TOKEN", c.GRPCToken)
+	}
+	if (c.GRPCTLSCertFile == "") != (c.GRPCTLSKeyFile == "") {
+		p.addf("SERVER_GRPC_TLS_CERT_FILE and SERVER_GRPC_TLS_KEY_FILE must be set together")
+	}
+}
+
+func (c PostgreSQLConfig) validate(p *problems) {
+	p.required("POSTGRES_HOST", c.Host)
+	p.port("POSTGRES_PORT", c.Port)
+	p.required("POSTGRES_USER", c.User)
+	p.required("POSTGRES_DATABASE", c.Database)
+	poolSizes(p, "POSTGRES", c.MaxOpenConns, c.MaxIdleConns)
+}
+
+// Validate checks the ClickHouse settings on their own, for services that
+// embed ClickHouseConfig in their own configuration
+func (c ClickHouseConfig) Validate() error {
+	var p problems
+	c.validate(&p)
+	return p.err()
+}
+
+func (c ClickHouseConfig) validate(p *problems) {
+	p.required("CLICKHOUSE_HOST", c.Host)
+	p.port("CLICKHOUSE_PORT", c.Port)
+	p.required("CLICKHOUSE_DATABASE", c.Database)
+	poolSizes(p, "CLICKHOUSE", c.MaxOpenConns, c.MaxIdleConns)
+	if c.DialTimeout <= 0 {
+		p.addf("CLICKHOUSE_DIAL_TIMEOUT must be positive, got %s", c.DialTimeout)
+	}
+	if c.SlowQueryThreshold < 0 {
+		p.addf("CLICKHOUSE_SLOW_QUERY_THRESHOLD must not be negative, got %s", c.SlowQueryThreshold)
+	}
+	if c.OptimizeMinInterval < 0 {
+		p.addf("CLICKHOUSE_OPTIMIZE_MIN_INTERVAL must not be negative, got %s", c.OptimizeMinInterval)
+	}
+	if c.EventRetentionDays <= 0 {
+		p.addf("CLICKHOUSE_EVENT_RETENTION_DAYS must be positive, got %d", c.EventRetentionDays)
+	}
+}
+
+// poolSizes checks a connection pool's open and idle limits
+func poolSizes(p *problems, prefix string, maxOpen, maxIdle int) {
+	if maxOpen < 0 {
+		p.addf("%s_MAX_OPEN_CONNS must not be negative, got %d", prefix, maxOpen)
+	}
+	if maxIdle < 0 {
+		p.addf("%s_MAX_IDLE_CONNS must not be negative, got %d", prefix, maxIdle)
+	}
+	if maxOpen > 0 && maxIdle > maxOpen {
+		p.addf("%s_MAX_IDLE_CONNS (%d) must not exceed %s_MAX_OPEN_CONNS (%d)", prefix, maxIdle, prefix, maxOpen)
+	}
+}
+
+func (c KafkaConfig) validate(p *problems) {
+	*p = append(*p, ValidateBrokers(c.Brokers)...)
+	p.required("KAFKA_EVENTS_TOPIC", c.EventsTopic)
+	p.required("KAFKA_COHORTS_TOPIC", c.CohortsTopic)
+	p.required("KAFKA_CHANGES_TOPIC", c.ChangesTopic)
+	p.required("KAFKA_CONSUMER_GROUP", c.ConsumerGroup)
+	if c.SessionTimeout <= 0 {
+		p.addf("KAFKA_SESSION_TIMEOUT must be positive, got %s", c.SessionTimeout)
+	}
+	if c.HeartbeatTimeout <= 0 {
+		p.addf("KAFKA_HEARTBEAT_TIMEOUT must be positive, got %s", c.HeartbeatTimeout)
+	} else if c.SessionTimeout > 0 && c.HeartbeatTimeout >= c.SessionTimeout {
+		p.addf("KAFKA_HEARTBEAT_TIMEOUT (%s) must be less than KAFKA_SESSION_TIMEOUT (%s)", c.HeartbeatTimeout, c.SessionTimeout)
+	}
+	if c.ConnectTimeout <= 0 {
+		p.addf("KAFKA_CONNECT_TIMEOUT must be positive, got %s", c.ConnectTimeout)
+	}
+	if c.WriteMaxAttempts < 1 {
+		p.addf("KAFKA_WRITE_MAX_ATTEMPTS must be at least 1, got %d", c.WriteMaxAttempts)
+	}
+	if c.ChangelogExportEnabled {
+		p.required("KAFKA_CHANGELOG_EXPORT_TOPIC", c.ChangelogExportTopic)
+	}
+	if c.ConsumerMaxRetries < 0 {
+		p.addf("KAFKA_CONSUMER_MAX_RETRIES must not be negative, got %d", c.ConsumerMaxRetries)
+	}
+	if c.ConsumerRetryBackoff < 0 {
+		p.addf("KAFKA_CONSUMER_RETRY_BACKOFF must not be negative, got %s", c.ConsumerRetryBackoff)
+	}
+	if c.ConsumerErrorPolicy == ConsumerErrorDLQ {
+		p.required("KAFKA_DLQ_TOPIC", c.DLQTopic)
+	}
+}
+
+// ValidateBrokers returns the problems with a KAFKA_BROKERS list: it must
+// name at least one broker and none may be blank
+func ValidateBrokers(brokers []string) []string {
+	var p problems
+	if len(brokers) == 0 {
+		p.addf("KAFKA_BROKERS must list at least one broker")
+	}
+	for i, broker := range brokers {
+		if strings.TrimSpace(broker) == "" {
+			p.addf("KAFKA_BROKERS entry %d is empty", i)
+		}
+	}
+	return p
+}
+
+func (c RedisConfig) validate(p *problems) {
+	p.required("REDIS_HOST", c.Host)
+	p.port("REDIS_PORT", c.Port)
+	if c.DB < 0 {
+		p.addf("REDIS_DB must not be negative, got %d", c.DB)
+	}
+	if c.PoolSize < 0 {
+		p.addf("REDIS_POOL_SIZE must not be negative, got %d", c.PoolSize)
+	}
+	if c.MinIdleConns < 0 {
+		p.addf("REDIS_MIN_IDLE_CONNS must not be negative, got %d", c.MinIdleConns)
+	}
+	if c.CacheTTL < 0 {
+		p.addf("REDIS_CACHE_TTL must not be negative, got %s", c.CacheTTL)
+	}
+	if c.CompressionThreshold < 0 {
+		p.addf("REDIS_COMPRESSION_THRESHOLD must not be negative, got %d", c.CompressionThreshold)
+	}
+}
+
+func (c FlinkConfig) validate(p *problems) {
+	p.required("FLINK_HOST", c.Host)
+	p.port("FLINK_PORT", c.Port)
+}
+
+func (c IngestConfig) validate(p *problems) {
+	switch c.MissingUserID {
+	case "reject":
+	case "anonymous":
+		p.required("INGEST_ANONYMOUS_USER_ID", c.AnonymousUserID)
+	default:
+		p.addf("INGEST_MISSING_USER_ID must be reject or anonymous, got %q", c.MissingUserID)
+	}
+	if c.MaxPropertyDepth < 0 {
+		p.addf("INGEST_MAX_PROPERTY_DEPTH must not be negative, got %d", c.MaxPropertyDepth)
+	}
+	if c.MaxPropertyBytes < 0 {
+		p.addf("INGEST_MAX_PROPERTY_BYTES must not be negative, got %d", c.MaxPropertyBytes)
+	}
+	if c.MaxPropertyCount < 0 {
+		p.addf("INGEST_MAX_PROPERTY_COUNT must not be negative, got %d", c.MaxPropertyCount)
+	}
+	if c.MaxPropertyValueLength < 0 {
+		p.addf("INGEST_MAX_PROPERTY_VALUE_LENGTH must not be negative, got %d", c.MaxPropertyValueLength)
+	}
+	for key, length := range c.PropertyValueLengthOverrides {
+		if length < 0 {
+			p.addf("INGEST_PROPERTY_VALUE_LENGTH_OVERRIDES length for %q must not be negative, got %d", key, length)
+		}
+	}
+	switch c.OversizedPropertyValues {
+	case "reject", "truncate":
+	default:
+		p.addf("INGEST_OVERSIZED_PROPERTY_VALUES must be reject or truncate, got %q", c.OversizedPropertyValues)
+	}
+	if c.LiveEvaluation && c.LiveEvaluationMaxCohorts <= 0 {
+		p.addf("INGEST_LIVE_EVALUATION_MAX_COHORTS must be positive, got %d", c.LiveEvaluationMaxCohorts)
+	}
+	if c.ImportBatchSize <= 0 {
+		p.addf("INGEST_IMPORT_BATCH_SIZE must be positive, got %d", c.ImportBatchSize)
+	}
+	if c.ImportBatchInterval < 0 {
+		p.addf("INGEST_IMPORT_BATCH_INTERVAL must not be negative, got %s", c.ImportBatchInterval)
+	}
+	switch c.AckMode {
+	case "produced", "persisted":
+	default:
+		p.addf("INGEST_ACK_MODE must be produced or persisted, got %q", c.AckMode)
+	}
+	if c.AckTimeout <= 0 {
+		p.addf("INGEST_ACK_TIMEOUT must be positive, got %s", c.AckTimeout)
+	}
+	if c.AckPollInterval <= 0 {
+		p.addf("INGEST_ACK_POLL_INTERVAL must be positive, got %s", c.AckPollInterval)
+	}
+}
+
+func (c RecomputeConfig) validate(p *problems) {
+	if c.SyncThreshold < 0 {
+		p.addf("RECOMPUTE_SYNC_THRESHOLD must not be negative, got %d", c.SyncThreshold)
+	}
+	if c.MinInterval < 0 {
+		p.addf("RECOMPUTE_MIN_INTERVAL must not be negative, got %s", c.MinInterval)
+	}
+	if c.ScheduleTick <= 0 {
+		p.addf("RECOMPUTE_SCHEDULE_TICK must be positive, got %s", c.ScheduleTick)
+	}
+	if c.QueueCapacity <= 0 {
+		p.addf("RECOMPUTE_QUEUE_CAPACITY must be positive, got %d", c.QueueCapacity)
+	}
+	if c.ConsistencyMaxUsers <= 0 {
+		p.addf("RECOMPUTE_CONSISTENCY_MAX_USERS must be positive, got %d", c.ConsistencyMaxUsers)
+	}
+	if c.ConsistencyRepairThrottle < 0 {
+		p.addf("RECOMPUTE_CONSISTENCY_REPAIR_THROTTLE must not be negative, got %s", c.ConsistencyRepairThrottle)
+	}
+	if c.ProduceBatchSize < 0 {
+		p.addf("RECOMPUTE_PRODUCE_BATCH_SIZE must not be negative, got %d", c.ProduceBatchSize)
+	}
+	if c.ApproxSampleRate <= 0 || c.ApproxSampleRate > 1 {
+		p.addf("RECOMPUTE_APPROX_SAMPLE_RATE must be greater than 0 and at most 1, got %g", c.ApproxSampleRate)
+	}
+	if c.PreviewSampleSize < 0 {
+		p.addf("RECOMPUTE_PREVIEW_SAMPLE_SIZE must not be negative, got %d", c.PreviewSampleSize)
+	}
+	if c.RuleChangeDebounce < 0 {
+		p.addf("RECOMPUTE_RULE_CHANGE_DEBOUNCE must not be negative, got %s", c.RuleChangeDebounce)
+	}
+	if c.JobRetention < 0 {
+		p.addf("RECOMPUTE_JOB_RETENTION must not be negative, got %s", c.JobRetention)
+	}
+	if c.Hysteresis < 1 {
+		p.addf("RECOMPUTE_HYSTERESIS must be at least 1, got %d", c.Hysteresis)
+	}
+}
+
+func (c CohortConfig) validate(p *problems) {
+	if c.MaxPerProject < 0 {
+		p.addf("COHORT_MAX_PER_PROJECT must not be negative, got %d", c.MaxPerProject)
+	}
+	if c.MaxPropertyFilters < 0 {
+		p.addf("COHORT_MAX_PROPERTY_FILTERS must not be negative, got %d", c.MaxPropertyFilters)
+	}
+	if c.MaxExcludedUserIDs < 0 {
+		p.addf("COHORT_MAX_EXCLUDED_USER_IDS must not be negative, got %d", c.MaxExcludedUserIDs)
+	}
+	if c.MembershipSnapshotInterval < 0 {
+		p.addf("COHORT_MEMBERSHIP_SNAPSHOT_INTERVAL must not be negative, got %s", c.MembershipSnapshotInterval)
+	}
+	if c.ExportScheduleTick < 0 {
+		p.addf("COHORT_EXPORT_SCHEDULE_TICK must not be negative, got %s", c.ExportScheduleTick)
+	}
+	if c.MaxConcurrentExports <= 0 {
+		p.addf("COHORT_MAX_CONCURRENT_EXPORTS must be positive, got %d", c.MaxConcurrentExports)
+	}
+	if c.ExportJobRetention < 0 {
+		p.addf("COHORT_EXPORT_JOB_RETENTION must not be negative, got %s", c.ExportJobRetention)
+	}
+	if c.RFMScoreEvent != "" {
+		if c.RFMScoreWindow <= 0 {
+			p.addf("COHORT_RFM_SCORE_WINDOW must be positive, got %s", c.RFMScoreWindow)
+		}
+		if c.ScoreInterval <= 0 {
+			p.addf("COHORT_SCORE_INTERVAL must be positive, got %s", c.ScoreInterval)
+		}
+	}
+	for project, limit := range c.MaxPerProjectOverrides {
+		if limit < 0 {
+			p.addf("COHORT_MAX_PER_PROJECT_OVERRIDES limit for %s must not be negative, got %d", project, limit)
+		}
+	}
+}
+
+func (c PrivacyConfig) validate(p *problems) {
+	if c.UserIDHashSecret != "" {
+		return
+	}
+	anonymized := c.AnonymizeUserIDs
+	for _, enabled := range c.AnonymizeUserIDsOverrides {
+		anonymized = anonymized || enabled
+	}
+	if anonymized {
+		p.addf("PRIVACY_USER_ID_HASH_SECRET is required to anonymize user IDs")
+	}
+}
+
+// Problems returns the individual problems in err, or nil when err isn't a
+// *ValidationError
+func Problems(err error) []string {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Problems
+	}
+	return nil
+}
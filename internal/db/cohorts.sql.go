@@ -11,8 +11,35 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const archiveCohort = `-- name: ArchiveCohort :exec
+UPDATE cohorts
+SET status = 'archived', deleted_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ArchiveCohort(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, archiveCohort, id)
+	return err
+}
+
+const clearCohortNeedsRecompute = `-- name: ClearCohortNeedsRecompute :exec
+UPDATE cohorts
+SET needs_recompute = FALSE
+WHERE id = $1 AND version = $2
+`
+
+type ClearCohortNeedsRecomputeParams struct {
+	ID      pgtype.UUID `json:"id"`
+	Version int64       `json:"version"`
+}
+
+func (q *Queries) ClearCohortNeedsRecompute(ctx context.Context, arg ClearCohortNeedsRecomputeParams) error {
+	_, err := q.db.Exec(ctx, clearCohortNeedsRecompute, arg.ID, arg.Version)
+	return err
+}
+
 const countCohorts = `-- name: CountCohorts :one
-SELECT COUNT(*) FROM cohorts WHERE project_id = $1
+SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND status <> 'archived'
 `
 
 func (q *Queries) CountCohorts(ctx context.Context, projectID pgtype.UUID) (int64, error) {
@@ -22,6 +49,23 @@ func (q *Queries) CountCohorts(ctx context.Context, projectID pgtype.UUID) (int6
 	return count, err
 }
 
+const countCohortsByName = `-- name: CountCohortsByName :one
+SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND name = $2 AND id IS DISTINCT FROM $3 AND status <> 'archived'
+`
+
+type CountCohortsByNameParams struct {
+	ProjectID pgtype.UUID `json:"project_id"`
+	Name      string      `json:"name"`
+	ID        pgtype.UUID `json:"id"`
+}
+
+func (q *Queries) CountCohortsByName(ctx context.Context, arg CountCohortsByNameParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countCohortsByName, arg.ProjectID, arg.Name, arg.ID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countCohortsByStatus = `-- name: CountCohortsByStatus :one
 SELECT COUNT(*) FROM cohorts WHERE project_id = $1 AND status = $2
 `
@@ -39,29 +83,40 @@ func (q *Queries) CountCohortsByStatus(ctx context.Context, arg CountCohortsBySt
 }
 
 const createCohort = `-- name: CreateCohort :one
-INSERT INTO cohorts (project_id, name, description, rules, status, version)
-VALUES ($1, $2, $3, $4, $5, 1)
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at
+INSERT INTO cohorts (project_id, name, description, rules, status, version, recompute_interval, membership_ttl, stream_enabled, variants, cohort_type)
+VALUES ($1, $2, $3, $4, $5, 1, $6, $7, $8, $9, $10)
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 `
 
 type CreateCohortParams struct {
-	ProjectID   pgtype.UUID `json:"project_id"`
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	Rules       []byte      `json:"rules"`
-	Status      string      `json:"status"`
+	ProjectID         pgtype.UUID     `json:"project_id"`
+	Name              string          `json:"name"`
+	Description       pgtype.Text     `json:"description"`
+	Rules             []byte          `json:"rules"`
+	Status            string          `json:"status"`
+	RecomputeInterval pgtype.Interval `json:"recompute_interval"`
+	MembershipTtl     pgtype.Interval `json:"membership_ttl"`
+	StreamEnabled     bool            `json:"stream_enabled"`
+	Variants          []byte          `json:"variants"`
+	CohortType        string          `json:"cohort_type"`
 }
 
 type CreateCohortRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) CreateCohort(ctx context.Context, arg CreateCohortParams) (CreateCohortRow, error) {
@@ -71,6 +126,11 @@ func (q *Queries) CreateCohort(ctx context.Context, arg CreateCohortParams) (Cre
 		arg.Description,
 		arg.Rules,
 		arg.Status,
+		arg.RecomputeInterval,
+		arg.MembershipTtl,
+		arg.StreamEnabled,
+		arg.Variants,
+		arg.CohortType,
 	)
 	var i CreateCohortRow
 	err := row.Scan(
@@ -83,36 +143,39 @@ func (q *Queries) CreateCohort(ctx context.Context, arg CreateCohortParams) (Cre
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RecomputeInterval,
+		&i.NeedsRecompute,
+		&i.MembershipTtl,
+		&i.StreamEnabled,
+		&i.Variants,
+		&i.CohortType,
 	)
 	return i, err
 }
 
-const deleteCohort = `-- name: DeleteCohort :exec
-DELETE FROM cohorts
-WHERE id = $1
-`
-
-func (q *Queries) DeleteCohort(ctx context.Context, id pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deleteCohort, id)
-	return err
-}
-
 const getCohort = `-- name: GetCohort :one
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
 WHERE id = $1
 `
 
 type GetCohortRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
 }
 
 func (q *Queries) GetCohort(ctx context.Context, id pgtype.UUID) (GetCohortRow, error) {
@@ -128,12 +191,19 @@ func (q *Queries) GetCohort(ctx context.Context, id pgtype.UUID) (GetCohortRow,
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RecomputeInterval,
+		&i.NeedsRecompute,
+		&i.MembershipTtl,
+		&i.StreamEnabled,
+		&i.Variants,
+		&i.CohortType,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getCohortByName = `-- name: GetCohortByName :one
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE project_id = $1 AND name = $2
 `
@@ -144,15 +214,21 @@ type GetCohortByNameParams struct {
 }
 
 type GetCohortByNameRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) GetCohortByName(ctx context.Context, arg GetCohortByNameParams) (GetCohortByNameRow, error) {
@@ -168,27 +244,39 @@ func (q *Queries) GetCohortByName(ctx context.Context, arg GetCohortByNameParams
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RecomputeInterval,
+		&i.NeedsRecompute,
+		&i.MembershipTtl,
+		&i.StreamEnabled,
+		&i.Variants,
+		&i.CohortType,
 	)
 	return i, err
 }
 
 const getCohortsUpdatedAfter = `-- name: GetCohortsUpdatedAfter :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE updated_at > $1
 ORDER BY updated_at ASC
 `
 
 type GetCohortsUpdatedAfterRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) GetCohortsUpdatedAfter(ctx context.Context, updatedAt pgtype.Timestamptz) ([]GetCohortsUpdatedAfterRow, error) {
@@ -210,6 +298,12 @@ func (q *Queries) GetCohortsUpdatedAfter(ctx context.Context, updatedAt pgtype.T
 			&i.Version,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RecomputeInterval,
+			&i.NeedsRecompute,
+			&i.MembershipTtl,
+			&i.StreamEnabled,
+			&i.Variants,
+			&i.CohortType,
 		); err != nil {
 			return nil, err
 		}
@@ -222,22 +316,28 @@ func (q *Queries) GetCohortsUpdatedAfter(ctx context.Context, updatedAt pgtype.T
 }
 
 const listActiveCohorts = `-- name: ListActiveCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE project_id = $1 AND status = 'active'
 ORDER BY created_at DESC
 `
 
 type ListActiveCohortsRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) ListActiveCohorts(ctx context.Context, projectID pgtype.UUID) ([]ListActiveCohortsRow, error) {
@@ -259,6 +359,12 @@ func (q *Queries) ListActiveCohorts(ctx context.Context, projectID pgtype.UUID)
 			&i.Version,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RecomputeInterval,
+			&i.NeedsRecompute,
+			&i.MembershipTtl,
+			&i.StreamEnabled,
+			&i.Variants,
+			&i.CohortType,
 		); err != nil {
 			return nil, err
 		}
@@ -271,22 +377,28 @@ func (q *Queries) ListActiveCohorts(ctx context.Context, projectID pgtype.UUID)
 }
 
 const listAllActiveCohorts = `-- name: ListAllActiveCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 FROM cohorts
 WHERE status = 'active'
 ORDER BY created_at DESC
 `
 
 type ListAllActiveCohortsRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) ListAllActiveCohorts(ctx context.Context) ([]ListAllActiveCohortsRow, error) {
@@ -308,6 +420,12 @@ func (q *Queries) ListAllActiveCohorts(ctx context.Context) ([]ListAllActiveCoho
 			&i.Version,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RecomputeInterval,
+			&i.NeedsRecompute,
+			&i.MembershipTtl,
+			&i.StreamEnabled,
+			&i.Variants,
+			&i.CohortType,
 		); err != nil {
 			return nil, err
 		}
@@ -319,34 +437,81 @@ func (q *Queries) ListAllActiveCohorts(ctx context.Context) ([]ListAllActiveCoho
 	return items, nil
 }
 
+const listCohortNameCollisions = `-- name: ListCohortNameCollisions :many
+SELECT name, COUNT(*) AS count
+FROM cohorts
+WHERE project_id = $1 AND status <> 'archived'
+GROUP BY name
+HAVING COUNT(*) > 1
+ORDER BY name
+`
+
+type ListCohortNameCollisionsRow struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+func (q *Queries) ListCohortNameCollisions(ctx context.Context, projectID pgtype.UUID) ([]ListCohortNameCollisionsRow, error) {
+	rows, err := q.db.Query(ctx, listCohortNameCollisions, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListCohortNameCollisionsRow{}
+	for rows.Next() {
+		var i ListCohortNameCollisionsRow
+		if err := rows.Scan(&i.Name, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listCohorts = `-- name: ListCohorts :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
-WHERE project_id = $1
+WHERE project_id = $1 AND (status <> 'archived' OR $4::boolean)
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
 `
 
 type ListCohortsParams struct {
-	ProjectID pgtype.UUID `json:"project_id"`
-	Limit     int32       `json:"limit"`
-	Offset    int32       `json:"offset"`
+	ProjectID       pgtype.UUID `json:"project_id"`
+	Limit           int32       `json:"limit"`
+	Offset          int32       `json:"offset"`
+	IncludeArchived bool        `json:"include_archived"`
 }
 
 type ListCohortsRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
 }
 
 func (q *Queries) ListCohorts(ctx context.Context, arg ListCohortsParams) ([]ListCohortsRow, error) {
-	rows, err := q.db.Query(ctx, listCohorts, arg.ProjectID, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listCohorts,
+		arg.ProjectID,
+		arg.Limit,
+		arg.Offset,
+		arg.IncludeArchived,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -364,6 +529,13 @@ func (q *Queries) ListCohorts(ctx context.Context, arg ListCohortsParams) ([]Lis
 			&i.Version,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RecomputeInterval,
+			&i.NeedsRecompute,
+			&i.MembershipTtl,
+			&i.StreamEnabled,
+			&i.Variants,
+			&i.CohortType,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -376,7 +548,7 @@ func (q *Queries) ListCohorts(ctx context.Context, arg ListCohortsParams) ([]Lis
 }
 
 const listCohortsByStatus = `-- name: ListCohortsByStatus :many
-SELECT id, project_id, name, description, rules, status, version, created_at, updated_at
+SELECT id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type, deleted_at
 FROM cohorts
 WHERE project_id = $1 AND status = $2
 ORDER BY created_at DESC
@@ -391,15 +563,22 @@ type ListCohortsByStatusParams struct {
 }
 
 type ListCohortsByStatusRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
 }
 
 func (q *Queries) ListCohortsByStatus(ctx context.Context, arg ListCohortsByStatusParams) ([]ListCohortsByStatusRow, error) {
@@ -426,6 +605,13 @@ func (q *Queries) ListCohortsByStatus(ctx context.Context, arg ListCohortsByStat
 			&i.Version,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.RecomputeInterval,
+			&i.NeedsRecompute,
+			&i.MembershipTtl,
+			&i.StreamEnabled,
+			&i.Variants,
+			&i.CohortType,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -437,30 +623,52 @@ func (q *Queries) ListCohortsByStatus(ctx context.Context, arg ListCohortsByStat
 	return items, nil
 }
 
+const restoreCohort = `-- name: RestoreCohort :exec
+UPDATE cohorts
+SET status = 'inactive', deleted_at = NULL
+WHERE id = $1 AND status = 'archived'
+`
+
+func (q *Queries) RestoreCohort(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, restoreCohort, id)
+	return err
+}
+
 const updateCohort = `-- name: UpdateCohort :one
 UPDATE cohorts
-SET name = $2, description = $3, rules = $4, version = version + 1
+SET name = $2, description = $3, rules = $4, recompute_interval = $5, needs_recompute = $6, membership_ttl = $7, stream_enabled = $8, variants = $9, version = version + 1
 WHERE id = $1
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 `
 
 type UpdateCohortParams struct {
-	ID          pgtype.UUID `json:"id"`
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	Rules       []byte      `json:"rules"`
+	ID                pgtype.UUID     `json:"id"`
+	Name              string          `json:"name"`
+	Description       pgtype.Text     `json:"description"`
+	Rules             []byte          `json:"rules"`
+	RecomputeInterval pgtype.Interval `json:"recompute_interval"`
+	NeedsRecompute    bool            `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval `json:"membership_ttl"`
+	StreamEnabled     bool            `json:"stream_enabled"`
+	Variants          []byte          `json:"variants"`
 }
 
 type UpdateCohortRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) UpdateCohort(ctx context.Context, arg UpdateCohortParams) (UpdateCohortRow, error) {
@@ -469,6 +677,11 @@ func (q *Queries) UpdateCohort(ctx context.Context, arg UpdateCohortParams) (Upd
 		arg.Name,
 		arg.Description,
 		arg.Rules,
+		arg.RecomputeInterval,
+		arg.NeedsRecompute,
+		arg.MembershipTtl,
+		arg.StreamEnabled,
+		arg.Variants,
 	)
 	var i UpdateCohortRow
 	err := row.Scan(
@@ -481,6 +694,12 @@ func (q *Queries) UpdateCohort(ctx context.Context, arg UpdateCohortParams) (Upd
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RecomputeInterval,
+		&i.NeedsRecompute,
+		&i.MembershipTtl,
+		&i.StreamEnabled,
+		&i.Variants,
+		&i.CohortType,
 	)
 	return i, err
 }
@@ -489,7 +708,7 @@ const updateCohortStatus = `-- name: UpdateCohortStatus :one
 UPDATE cohorts
 SET status = $2
 WHERE id = $1
-RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at
+RETURNING id, project_id, name, description, rules, status, version, created_at, updated_at, recompute_interval, needs_recompute, membership_ttl, stream_enabled, variants, cohort_type
 `
 
 type UpdateCohortStatusParams struct {
@@ -498,15 +717,21 @@ type UpdateCohortStatusParams struct {
 }
 
 type UpdateCohortStatusRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	CohortType        string             `json:"cohort_type"`
 }
 
 func (q *Queries) UpdateCohortStatus(ctx context.Context, arg UpdateCohortStatusParams) (UpdateCohortStatusRow, error) {
@@ -522,6 +747,12 @@ func (q *Queries) UpdateCohortStatus(ctx context.Context, arg UpdateCohortStatus
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RecomputeInterval,
+		&i.NeedsRecompute,
+		&i.MembershipTtl,
+		&i.StreamEnabled,
+		&i.Variants,
+		&i.CohortType,
 	)
 	return i, err
 }
@@ -9,15 +9,46 @@ import (
 )
 
 type Cohort struct {
+	ID                pgtype.UUID        `json:"id"`
+	Name              string             `json:"name"`
+	Description       pgtype.Text        `json:"description"`
+	Rules             []byte             `json:"rules"`
+	Status            string             `json:"status"`
+	Version           int64              `json:"version"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	ProjectID         pgtype.UUID        `json:"project_id"`
+	RecomputeInterval pgtype.Interval    `json:"recompute_interval"`
+	NeedsRecompute    bool               `json:"needs_recompute"`
+	MembershipTtl     pgtype.Interval    `json:"membership_ttl"`
+	StreamEnabled     bool               `json:"stream_enabled"`
+	Variants          []byte             `json:"variants"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
+	CohortType        string             `json:"cohort_type"`
+}
+
+type CohortExportSchedule struct {
+	ID                pgtype.UUID        `json:"id"`
+	CohortID          pgtype.UUID        `json:"cohort_id"`
+	Destination       string             `json:"destination"`
+	Cron              string             `json:"cron"`
+	LastRunAt         pgtype.Timestamptz `json:"last_run_at"`
+	LastStatus        pgtype.Text        `json:"last_status"`
+	LastError         pgtype.Text        `json:"last_error"`
+	LastExportedCount int64              `json:"last_exported_count"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+}
+
+type CohortTemplate struct {
 	ID          pgtype.UUID        `json:"id"`
+	ProjectID   pgtype.UUID        `json:"project_id"`
 	Name        string             `json:"name"`
 	Description pgtype.Text        `json:"description"`
 	Rules       []byte             `json:"rules"`
-	Status      string             `json:"status"`
-	Version     int64              `json:"version"`
+	Parameters  []byte             `json:"parameters"`
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
-	ProjectID   pgtype.UUID        `json:"project_id"`
 }
 
 type Organization struct {
@@ -30,11 +61,27 @@ type Organization struct {
 }
 
 type Project struct {
+	ID                 pgtype.UUID        `json:"id"`
+	OrganizationID     pgtype.UUID        `json:"organization_id"`
+	Name               string             `json:"name"`
+	Slug               string             `json:"slug"`
+	Description        pgtype.Text        `json:"description"`
+	CreatedAt          pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
+	EventRetentionDays pgtype.Int4        `json:"event_retention_days"`
+}
+
+type RecomputeJobHistory struct {
 	ID             pgtype.UUID        `json:"id"`
-	OrganizationID pgtype.UUID        `json:"organization_id"`
-	Name           string             `json:"name"`
-	Slug           string             `json:"slug"`
-	Description    pgtype.Text        `json:"description"`
+	CohortID       pgtype.UUID        `json:"cohort_id"`
+	Status         string             `json:"status"`
+	Reason         string             `json:"reason"`
+	MembersFound   int64              `json:"members_found"`
+	MembersAdded   int64              `json:"members_added"`
+	MembersRemoved int64              `json:"members_removed"`
+	Error          pgtype.Text        `json:"error"`
+	StartedAt      pgtype.Timestamptz `json:"started_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	CohortVersion  int64              `json:"cohort_version"`
 }
@@ -36,7 +36,7 @@ func (q *Queries) CountProjects(ctx context.Context, organizationID pgtype.UUID)
 const createProject = `-- name: CreateProject :one
 INSERT INTO projects (organization_id, name, slug, description)
 VALUES ($1, $2, $3, $4)
-RETURNING id, organization_id, name, slug, description, created_at, updated_at
+RETURNING id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 `
 
 type CreateProjectParams struct {
@@ -62,6 +62,7 @@ func (q *Queries) CreateProject(ctx context.Context, arg CreateProjectParams) (P
 		&i.Description,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EventRetentionDays,
 	)
 	return i, err
 }
@@ -77,7 +78,7 @@ func (q *Queries) DeleteProject(ctx context.Context, id pgtype.UUID) error {
 }
 
 const getProject = `-- name: GetProject :one
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE id = $1
 `
@@ -93,12 +94,13 @@ func (q *Queries) GetProject(ctx context.Context, id pgtype.UUID) (Project, erro
 		&i.Description,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EventRetentionDays,
 	)
 	return i, err
 }
 
 const getProjectBySlug = `-- name: GetProjectBySlug :one
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE organization_id = $1 AND slug = $2
 `
@@ -119,12 +121,13 @@ func (q *Queries) GetProjectBySlug(ctx context.Context, arg GetProjectBySlugPara
 		&i.Description,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EventRetentionDays,
 	)
 	return i, err
 }
 
 const listAllProjects = `-- name: ListAllProjects :many
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2
@@ -152,6 +155,7 @@ func (q *Queries) ListAllProjects(ctx context.Context, arg ListAllProjectsParams
 			&i.Description,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.EventRetentionDays,
 		); err != nil {
 			return nil, err
 		}
@@ -164,7 +168,7 @@ func (q *Queries) ListAllProjects(ctx context.Context, arg ListAllProjectsParams
 }
 
 const listProjects = `-- name: ListProjects :many
-SELECT id, organization_id, name, slug, description, created_at, updated_at
+SELECT id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 FROM projects
 WHERE organization_id = $1
 ORDER BY created_at DESC
@@ -194,6 +198,7 @@ func (q *Queries) ListProjects(ctx context.Context, arg ListProjectsParams) ([]P
 			&i.Description,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.EventRetentionDays,
 		); err != nil {
 			return nil, err
 		}
@@ -207,16 +212,17 @@ func (q *Queries) ListProjects(ctx context.Context, arg ListProjectsParams) ([]P
 
 const updateProject = `-- name: UpdateProject :one
 UPDATE projects
-SET name = $2, slug = $3, description = $4
+SET name = $2, slug = $3, description = $4, event_retention_days = $5
 WHERE id = $1
-RETURNING id, organization_id, name, slug, description, created_at, updated_at
+RETURNING id, organization_id, name, slug, description, created_at, updated_at, event_retention_days
 `
 
 type UpdateProjectParams struct {
-	ID          pgtype.UUID `json:"id"`
-	Name        string      `json:"name"`
-	Slug        string      `json:"slug"`
-	Description pgtype.Text `json:"description"`
+	ID                 pgtype.UUID `json:"id"`
+	Name               string      `json:"name"`
+	Slug               string      `json:"slug"`
+	Description        pgtype.Text `json:"description"`
+	EventRetentionDays pgtype.Int4 `json:"event_retention_days"`
 }
 
 func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (Project, error) {
@@ -225,6 +231,7 @@ func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (P
 		arg.Name,
 		arg.Slug,
 		arg.Description,
+		arg.EventRetentionDays,
 	)
 	var i Project
 	err := row.Scan(
@@ -235,6 +242,7 @@ func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (P
 		&i.Description,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EventRetentionDays,
 	)
 	return i, err
 }
@@ -11,31 +11,48 @@ import (
 )
 
 type Querier interface {
+	ArchiveCohort(ctx context.Context, id pgtype.UUID) error
+	ClearCohortNeedsRecompute(ctx context.Context, arg ClearCohortNeedsRecomputeParams) error
 	CountAllProjects(ctx context.Context) (int64, error)
 	CountCohorts(ctx context.Context, projectID pgtype.UUID) (int64, error)
+	CountCohortsByName(ctx context.Context, arg CountCohortsByNameParams) (int64, error)
 	CountCohortsByStatus(ctx context.Context, arg CountCohortsByStatusParams) (int64, error)
 	CountOrganizations(ctx context.Context) (int64, error)
 	CountProjects(ctx context.Context, organizationID pgtype.UUID) (int64, error)
 	CreateCohort(ctx context.Context, arg CreateCohortParams) (CreateCohortRow, error)
+	CreateCohortExportSchedule(ctx context.Context, arg CreateCohortExportScheduleParams) (CohortExportSchedule, error)
+	CreateCohortTemplate(ctx context.Context, arg CreateCohortTemplateParams) (CohortTemplate, error)
 	CreateOrganization(ctx context.Context, arg CreateOrganizationParams) (Organization, error)
 	CreateProject(ctx context.Context, arg CreateProjectParams) (Project, error)
-	DeleteCohort(ctx context.Context, id pgtype.UUID) error
+	DeleteCohortExportSchedule(ctx context.Context, id pgtype.UUID) error
+	DeleteCohortTemplate(ctx context.Context, id pgtype.UUID) error
 	DeleteOrganization(ctx context.Context, id pgtype.UUID) error
 	DeleteProject(ctx context.Context, id pgtype.UUID) error
 	GetCohort(ctx context.Context, id pgtype.UUID) (GetCohortRow, error)
 	GetCohortByName(ctx context.Context, arg GetCohortByNameParams) (GetCohortByNameRow, error)
+	GetCohortExportSchedule(ctx context.Context, id pgtype.UUID) (CohortExportSchedule, error)
+	GetCohortTemplate(ctx context.Context, id pgtype.UUID) (CohortTemplate, error)
 	GetCohortsUpdatedAfter(ctx context.Context, updatedAt pgtype.Timestamptz) ([]GetCohortsUpdatedAfterRow, error)
 	GetOrganization(ctx context.Context, id pgtype.UUID) (Organization, error)
 	GetOrganizationBySlug(ctx context.Context, slug string) (Organization, error)
 	GetProject(ctx context.Context, id pgtype.UUID) (Project, error)
 	GetProjectBySlug(ctx context.Context, arg GetProjectBySlugParams) (Project, error)
+	GetVersionRecomputedAt(ctx context.Context, arg GetVersionRecomputedAtParams) (pgtype.Timestamptz, error)
 	ListActiveCohorts(ctx context.Context, projectID pgtype.UUID) ([]ListActiveCohortsRow, error)
 	ListAllActiveCohorts(ctx context.Context) ([]ListAllActiveCohortsRow, error)
+	ListAllCohortExportSchedules(ctx context.Context) ([]CohortExportSchedule, error)
 	ListAllProjects(ctx context.Context, arg ListAllProjectsParams) ([]Project, error)
+	ListCohortExportSchedules(ctx context.Context, cohortID pgtype.UUID) ([]CohortExportSchedule, error)
+	ListCohortNameCollisions(ctx context.Context, projectID pgtype.UUID) ([]ListCohortNameCollisionsRow, error)
+	ListCohortTemplates(ctx context.Context, projectID pgtype.UUID) ([]CohortTemplate, error)
 	ListCohorts(ctx context.Context, arg ListCohortsParams) ([]ListCohortsRow, error)
 	ListCohortsByStatus(ctx context.Context, arg ListCohortsByStatusParams) ([]ListCohortsByStatusRow, error)
 	ListOrganizations(ctx context.Context, arg ListOrganizationsParams) ([]Organization, error)
 	ListProjects(ctx context.Context, arg ListProjectsParams) ([]Project, error)
+	ListRecomputeJobHistory(ctx context.Context, arg ListRecomputeJobHistoryParams) ([]RecomputeJobHistory, error)
+	RecordCohortExportRun(ctx context.Context, arg RecordCohortExportRunParams) error
+	RecordRecomputeJob(ctx context.Context, arg RecordRecomputeJobParams) error
+	RestoreCohort(ctx context.Context, id pgtype.UUID) error
 	UpdateCohort(ctx context.Context, arg UpdateCohortParams) (UpdateCohortRow, error)
 	UpdateCohortStatus(ctx context.Context, arg UpdateCohortStatusParams) (UpdateCohortStatusRow, error)
 	UpdateOrganization(ctx context.Context, arg UpdateOrganizationParams) (Organization, error)
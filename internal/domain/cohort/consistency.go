@@ -0,0 +1,262 @@
+package cohort
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrConsistencyCheckInProgress = errors.New("consistency check already in progress")
+
+// ConsistencyReport describes differences between the changelog and the current membership table
+type ConsistencyReport struct {
+	CohortID uuid.UUID `json:"cohort_id"`
+	// MissingFromCurrent are users the changelog says are members but cohort_membership_current does not
+	MissingFromCurrent []string `json:"missing_from_current"`
+	// UnexpectedInCurrent are users in cohort_membership_current that the changelog says are not members
+	UnexpectedInCurrent []string `json:"unexpected_in_current"`
+	// MiscountedInCurrent are users whose signs in cohort_membership_current
+	// sum to something other than 0 or 1, so a single later join or leave
+	// would not flip their membership
+	MiscountedInCurrent []string `json:"miscounted_in_current"`
+	ChangelogMembers    int64    `json:"changelog_members"`
+	CurrentMembers      int64    `json:"current_members"`
+	// Truncated is set when either side exceeded the scan limit and the comparison is partial
+	Truncated bool      `json:"truncated"`
+	Repaired  bool      `json:"repaired"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Consistent reports whether no discrepancies were found
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.MissingFromCurrent) == 0 && len(r.UnexpectedInCurrent) == 0 && len(r.MiscountedInCurrent) == 0
+}
+
+// ConsistencyChecker reconstructs cohort membership from the changelog and
+// compares it to cohort_membership_current, optionally repairing drift
+type ConsistencyChecker struct {
+	chClient     ClickHouseClient
+	cohortGetter CohortGetter
+	maxUsers     int
+	batchSize    int
+	throttle     time.Duration
+	running      sync.Mutex
+}
+
+// NewConsistencyChecker creates a new consistency checker.
+// maxUsers bounds how many users are read from each table per check, and
+// throttle is the pause between repair batches.
+func NewConsistencyChecker(chClient ClickHouseClient, cohortGetter CohortGetter, maxUsers int, throttle time.Duration) *ConsistencyChecker {
+	return &ConsistencyChecker{
+		chClient:     chClient,
+		cohortGetter: cohortGetter,
+		maxUsers:     maxUsers,
+		batchSize:    1000,
+		throttle:     throttle,
+	}
+}
+
+// Check compares changelog-derived membership with the current table for a cohort.
+// When repair is set, the current table is corrected to match the changelog.
+// Only one check runs at a time.
+func (c *ConsistencyChecker) Check(ctx context.Context, cohortID uuid.UUID, repair bool) (*ConsistencyReport, error) {
+	if !c.running.TryLock() {
+		return nil, ErrConsistencyCheckInProgress
+	}
+	defer c.running.Unlock()
+
+	if _, err := c.cohortGetter.GetByID(ctx, cohortID); err != nil {
+		return nil, err
+	}
+
+	expected, err := c.queryUsers(ctx, `
+		SELECT user_id
+		FROM cohort_membership_changelog
+		WHERE cohort_id = ?
+		GROUP BY user_id
+		HAVING argMax(new_status, changed_at) = 1
+		LIMIT ?
+	`, cohortID)
+	if err != nil {
+		return nil, err
+	}
+
+	signs, err := c.querySigns(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]struct{}, len(signs))
+	for userID, sum := range signs {
+		if sum > 0 {
+			current[userID] = struct{}{}
+		}
+	}
+
+	report := &ConsistencyReport{
+		CohortID:            cohortID,
+		MissingFromCurrent:  []string{},
+		UnexpectedInCurrent: []string{},
+		MiscountedInCurrent: []string{},
+		ChangelogMembers:    int64(len(expected)),
+		CurrentMembers:      int64(len(current)),
+		Truncated:           len(expected) >= c.maxUsers || len(signs) >= c.maxUsers,
+		CheckedAt:           time.Now().UTC(),
+	}
+
+	// Each user's sign sum is corrected to 1 for members and 0 otherwise
+	var adds, removes []signCorrection
+	correct := func(userID string, target int64) {
+		switch delta := target - signs[userID]; {
+		case delta > 0:
+			adds = append(adds, signCorrection{userID: userID, delta: delta})
+		case delta < 0:
+			removes = append(removes, signCorrection{userID: userID, delta: delta})
+		}
+	}
+
+	for userID := range expected {
+		if _, ok := current[userID]; !ok {
+			report.MissingFromCurrent = append(report.MissingFromCurrent, userID)
+		} else if signs[userID] != 1 {
+			report.MiscountedInCurrent = append(report.MiscountedInCurrent, userID)
+		}
+		correct(userID, 1)
+	}
+	for userID, sum := range signs {
+		if _, ok := expected[userID]; ok {
+			continue
+		}
+		if sum > 0 {
+			report.UnexpectedInCurrent = append(report.UnexpectedInCurrent, userID)
+		} else {
+			report.MiscountedInCurrent = append(report.MiscountedInCurrent, userID)
+		}
+		correct(userID, 0)
+	}
+	sort.Strings(report.MissingFromCurrent)
+	sort.Strings(report.UnexpectedInCurrent)
+	sort.Strings(report.MiscountedInCurrent)
+
+	// A partial scan can't distinguish drift from users beyond the limit
+	if !repair || report.Consistent() || report.Truncated {
+		return report, nil
+	}
+
+	now := time.Now().UTC()
+	if err := c.repair(ctx, cohortID, adds, now); err != nil {
+		return nil, err
+	}
+	if err := c.repair(ctx, cohortID, removes, now); err != nil {
+		return nil, err
+	}
+	report.Repaired = true
+
+	log.Printf("consistency check repaired cohort %s: added=%d, removed=%d, recounted=%d",
+		cohortID, len(report.MissingFromCurrent), len(report.UnexpectedInCurrent), len(report.MiscountedInCurrent))
+
+	return report, nil
+}
+
+// queryUsers runs a bounded single-column user query for a cohort
+func (c *ConsistencyChecker) queryUsers(ctx context.Context, query string, cohortID uuid.UUID) (map[string]struct{}, error) {
+	rows, err := c.chClient.Query(ctx, query, cohortID, c.maxUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]struct{})
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users[userID] = struct{}{}
+	}
+
+	return users, nil
+}
+
+// querySigns returns the sign sum of every user of a cohort in
+// cohort_membership_current whose signs don't cancel out, bounded by maxUsers
+func (c *ConsistencyChecker) querySigns(ctx context.Context, cohortID uuid.UUID) (map[string]int64, error) {
+	rows, err := c.chClient.Query(ctx, `
+		SELECT user_id, toInt64(sum(sign)) AS signs
+		FROM cohort_membership_current
+		WHERE cohort_id = ?
+		GROUP BY user_id
+		HAVING signs != 0
+		LIMIT ?
+	`, cohortID, c.maxUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signs := make(map[string]int64)
+	for rows.Next() {
+		var (
+			userID string
+			sum    int64
+		)
+		if err := rows.Scan(&userID, &sum); err != nil {
+			return nil, err
+		}
+		signs[userID] = sum
+	}
+
+	return signs, nil
+}
+
+// signCorrection is how far a user's sign sum must move to match the changelog
+type signCorrection struct {
+	userID string
+	delta  int64
+}
+
+// repair writes corrective rows to cohort_membership_current in throttled
+// batches. Each correction is written as |delta| rows of sign ±1, since
+// collapsing merges only accept those signs.
+func (c *ConsistencyChecker) repair(ctx context.Context, cohortID uuid.UUID, corrections []signCorrection, now time.Time) error {
+	for i := 0; i < len(corrections); i += c.batchSize {
+		if i > 0 && c.throttle > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.throttle):
+			}
+		}
+
+		end := min(i+c.batchSize, len(corrections))
+
+		batch, err := c.chClient.PrepareBatch(ctx, `
+			INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at)
+		`)
+		if err != nil {
+			return err
+		}
+
+		for _, corr := range corrections[i:end] {
+			sign, n := int8(1), corr.delta
+			if n < 0 {
+				sign, n = -1, -n
+			}
+			for ; n > 0; n-- {
+				if err := batch.Append(cohortID, corr.userID, sign, now); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := batch.Send(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
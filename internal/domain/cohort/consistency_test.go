@@ -0,0 +1,182 @@
+package cohort_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pjhul/intent/internal/db"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestConsistencyChecker_Check(t *testing.T) {
+	cohortID := uuid.New()
+	cohortRow := db.GetCohortRow{
+		ID:     pgtype.UUID{Bytes: cohortID, Valid: true},
+		Rules:  []byte(`{"operator":"AND","conditions":[]}`),
+		Status: string(cohort.CohortStatusActive),
+	}
+
+	// Changelog says user1-3 are members; the current table lost user1,
+	// counts user3 twice and kept a stale user4
+	expectDriftedData := func(ctrl *gomock.Controller, mockCHClient *mocks.MockClickHouseClient) {
+		gomock.InOrder(
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 100).
+				Return(newRowScanner(ctrl, "user1", "user2", "user3"), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 100).
+				Return(newSignScanner(ctrl, []string{"user2", "user3", "user4"}, []int64{1, 2, 1}), nil),
+		)
+	}
+
+	t.Run("detects discrepancies", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		checker := cohort.NewConsistencyChecker(mockCHClient, cohort.NewService(mockQuerier, nil), 100, 0)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil)
+		expectDriftedData(ctrl, mockCHClient)
+
+		report, err := checker.Check(context.Background(), cohortID, false)
+		if err != nil {
+			t.Fatalf("Check() unexpected error: %v", err)
+		}
+		if report.Consistent() {
+			t.Error("Consistent() = true, expected false")
+		}
+		if !reflect.DeepEqual(report.MissingFromCurrent, []string{"user1"}) {
+			t.Errorf("MissingFromCurrent = %v, expected [user1]", report.MissingFromCurrent)
+		}
+		if !reflect.DeepEqual(report.UnexpectedInCurrent, []string{"user4"}) {
+			t.Errorf("UnexpectedInCurrent = %v, expected [user4]", report.UnexpectedInCurrent)
+		}
+		if !reflect.DeepEqual(report.MiscountedInCurrent, []string{"user3"}) {
+			t.Errorf("MiscountedInCurrent = %v, expected [user3]", report.MiscountedInCurrent)
+		}
+		if report.Repaired {
+			t.Error("Repaired = true, expected false without repair")
+		}
+	})
+
+	t.Run("repairs drift", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		checker := cohort.NewConsistencyChecker(mockCHClient, cohort.NewService(mockQuerier, nil), 100, time.Millisecond)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil)
+		expectDriftedData(ctrl, mockCHClient)
+
+		addBatch := mocks.NewMockBatch(ctrl)
+		removeBatch := mocks.NewMockBatch(ctrl)
+		gomock.InOrder(
+			mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(addBatch, nil),
+			mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(removeBatch, nil),
+		)
+		addBatch.EXPECT().Append(cohortID, "user1", int8(1), gomock.Any()).Return(nil)
+		addBatch.EXPECT().Send().Return(nil)
+		removeBatch.EXPECT().Append(cohortID, "user3", int8(-1), gomock.Any()).Return(nil)
+		removeBatch.EXPECT().Append(cohortID, "user4", int8(-1), gomock.Any()).Return(nil)
+		removeBatch.EXPECT().Send().Return(nil)
+
+		report, err := checker.Check(context.Background(), cohortID, true)
+		if err != nil {
+			t.Fatalf("Check() unexpected error: %v", err)
+		}
+		if !report.Repaired {
+			t.Error("Repaired = false, expected true")
+		}
+	})
+
+	t.Run("repairs users counted several times", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		checker := cohort.NewConsistencyChecker(mockCHClient, cohort.NewService(mockQuerier, nil), 100, 0)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil)
+		gomock.InOrder(
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 100).
+				Return(newRowScanner(ctrl, "user1"), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 100).
+				Return(newSignScanner(ctrl, []string{"user1", "user2"}, []int64{3, 2}), nil),
+		)
+
+		// Members are brought down to a sum of 1 and non-members to 0
+		batch := mocks.NewMockBatch(ctrl)
+		mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(batch, nil)
+		batch.EXPECT().Append(cohortID, "user1", int8(-1), gomock.Any()).Return(nil).Times(2)
+		batch.EXPECT().Append(cohortID, "user2", int8(-1), gomock.Any()).Return(nil).Times(2)
+		batch.EXPECT().Send().Return(nil)
+
+		report, err := checker.Check(context.Background(), cohortID, true)
+		if err != nil {
+			t.Fatalf("Check() unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(report.MiscountedInCurrent, []string{"user1"}) {
+			t.Errorf("MiscountedInCurrent = %v, expected [user1]", report.MiscountedInCurrent)
+		}
+		if !reflect.DeepEqual(report.UnexpectedInCurrent, []string{"user2"}) {
+			t.Errorf("UnexpectedInCurrent = %v, expected [user2]", report.UnexpectedInCurrent)
+		}
+		if !report.Repaired {
+			t.Error("Repaired = false, expected true")
+		}
+	})
+
+	t.Run("truncated scan is not repaired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		checker := cohort.NewConsistencyChecker(mockCHClient, cohort.NewService(mockQuerier, nil), 2, 0)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil)
+		gomock.InOrder(
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 2).
+				Return(newRowScanner(ctrl, "user1", "user2"), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID, 2).
+				Return(newSignScanner(ctrl, []string{"user2"}, []int64{1}), nil),
+		)
+
+		report, err := checker.Check(context.Background(), cohortID, true)
+		if err != nil {
+			t.Fatalf("Check() unexpected error: %v", err)
+		}
+		if !report.Truncated {
+			t.Error("Truncated = false, expected true")
+		}
+		if report.Repaired {
+			t.Error("Repaired = true, expected truncated scans to skip repair")
+		}
+	})
+}
+
+// newSignScanner returns a mock result set yielding a user ID and sign sum per row
+func newSignScanner(ctrl *gomock.Controller, userIDs []string, sums []int64) *mocks.MockRowScanner {
+	rows := mocks.NewMockRowScanner(ctrl)
+	i := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool {
+		i++
+		return i <= len(userIDs)
+	}).AnyTimes()
+	rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+		*dest[0].(*string) = userIDs[i-1]
+		*dest[1].(*int64) = sums[i-1]
+		return nil
+	}).AnyTimes()
+	rows.EXPECT().Close().Return(nil).AnyTimes()
+	return rows
+}
@@ -0,0 +1,103 @@
+package cohort
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ManualRecomputeTrigger submits high priority recompute jobs
+type ManualRecomputeTrigger interface {
+	TriggerRecompute(ctx context.Context, cohortID uuid.UUID, req RecomputeRequest) (*RecomputeResponse, error)
+}
+
+// RecomputeDebouncer recomputes cohorts once their rules have stopped
+// changing for a quiet period, coalescing rapid edits into a single job. The
+// job loads the cohort when it runs, so it always uses the latest rules.
+type RecomputeDebouncer struct {
+	trigger ManualRecomputeTrigger
+	quiet   time.Duration
+	clock   Clock
+	// lastEdit is when each cohort with a pending recompute was last edited
+	lastEdit map[uuid.UUID]time.Time
+	mu       sync.Mutex
+}
+
+// NewRecomputeDebouncer creates a debouncer that recomputes a cohort once
+// quiet has passed since its last rule edit
+func NewRecomputeDebouncer(trigger ManualRecomputeTrigger, quiet time.Duration) *RecomputeDebouncer {
+	return &RecomputeDebouncer{
+		trigger:  trigger,
+		quiet:    quiet,
+		clock:    systemClock{},
+		lastEdit: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// SetClock replaces the debouncer's clock
+func (d *RecomputeDebouncer) SetClock(clock Clock) {
+	d.clock = clock
+}
+
+// RulesChanged records a rule edit, postponing the cohort's recompute until
+// the quiet period has passed without further edits
+func (d *RecomputeDebouncer) RulesChanged(cohortID uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastEdit[cohortID] = d.clock.Now()
+}
+
+// Start begins submitting recomputes for cohorts whose quiet period has passed
+func (d *RecomputeDebouncer) Start(ctx context.Context) {
+	go func() {
+		// Check often enough that a recompute starts at most a quarter of the
+		// quiet period late
+		ticker := time.NewTicker(max(d.quiet/4, 100*time.Millisecond))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.Tick(ctx)
+			}
+		}
+	}()
+}
+
+// Tick submits a recompute for every cohort whose last edit is at least the
+// quiet period ago. Cohorts with a job already pending or running stay
+// pending, since that job may have loaded earlier rules.
+func (d *RecomputeDebouncer) Tick(ctx context.Context) {
+	d.mu.Lock()
+	now := d.clock.Now()
+	var due []uuid.UUID
+	for id, edited := range d.lastEdit {
+		if now.Sub(edited) >= d.quiet {
+			due = append(due, id)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, id := range due {
+		_, err := d.trigger.TriggerRecompute(ctx, id, RecomputeRequest{})
+		if err == ErrRecomputeInProgress {
+			continue
+		}
+		if err != nil && err != ErrCohortNotFound {
+			log.Printf("recompute debouncer: failed to enqueue cohort %s: %v", id, err)
+			continue
+		}
+
+		d.mu.Lock()
+		// An edit that arrived while the job was submitted starts a new quiet period
+		if d.lastEdit[id].Sub(now) <= 0 {
+			delete(d.lastEdit, id)
+		}
+		d.mu.Unlock()
+	}
+}
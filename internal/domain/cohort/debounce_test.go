@@ -0,0 +1,146 @@
+package cohort_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pjhul/intent/internal/db"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeManualTrigger struct {
+	clock    *fakeClock
+	running  bool
+	enqueued []time.Time
+}
+
+func (f *fakeManualTrigger) TriggerRecompute(ctx context.Context, cohortID uuid.UUID, req cohort.RecomputeRequest) (*cohort.RecomputeResponse, error) {
+	if f.running {
+		return nil, cohort.ErrRecomputeInProgress
+	}
+	f.enqueued = append(f.enqueued, f.clock.Now())
+	return &cohort.RecomputeResponse{CohortID: cohortID, Status: cohort.RecomputeStatusPending}, nil
+}
+
+func TestRecomputeDebouncer_Tick(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cohortID := uuid.New()
+
+	t.Run("rapid edits coalesce into one recompute", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		trigger := &fakeManualTrigger{clock: clock}
+		debouncer := cohort.NewRecomputeDebouncer(trigger, 30*time.Second)
+		debouncer.SetClock(clock)
+
+		// Five edits 10s apart, ticking every 5s throughout
+		for i := 0; i < 5; i++ {
+			debouncer.RulesChanged(cohortID)
+			for j := 0; j < 2; j++ {
+				clock.Advance(5 * time.Second)
+				debouncer.Tick(context.Background())
+			}
+		}
+		if len(trigger.enqueued) != 0 {
+			t.Fatalf("enqueues during edits = %d, expected 0", len(trigger.enqueued))
+		}
+
+		for i := 0; i < 20; i++ {
+			clock.Advance(5 * time.Second)
+			debouncer.Tick(context.Background())
+		}
+
+		if len(trigger.enqueued) != 1 {
+			t.Fatalf("enqueues = %d, expected 1", len(trigger.enqueued))
+		}
+		lastEdit := start.Add(40 * time.Second)
+		if expected := lastEdit.Add(30 * time.Second); !trigger.enqueued[0].Equal(expected) {
+			t.Errorf("enqueued at %v, expected %v", trigger.enqueued[0], expected)
+		}
+	})
+
+	t.Run("stays pending while a job is running", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		trigger := &fakeManualTrigger{clock: clock, running: true}
+		debouncer := cohort.NewRecomputeDebouncer(trigger, 30*time.Second)
+		debouncer.SetClock(clock)
+
+		debouncer.RulesChanged(cohortID)
+		clock.Advance(time.Minute)
+		debouncer.Tick(context.Background())
+
+		trigger.running = false
+		clock.Advance(5 * time.Second)
+		debouncer.Tick(context.Background())
+		debouncer.Tick(context.Background())
+
+		if len(trigger.enqueued) != 1 {
+			t.Errorf("enqueues = %d, expected 1 once the running job finished", len(trigger.enqueued))
+		}
+	})
+}
+
+func TestService_Update_DebouncesRecompute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	trigger := &fakeManualTrigger{clock: clock}
+	debouncer := cohort.NewRecomputeDebouncer(trigger, 30*time.Second)
+	debouncer.SetClock(clock)
+	svc.SetRecomputeDebouncer(debouncer)
+
+	cohortID := uuid.New()
+	stored := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}}}
+	update := func(req cohort.UpdateCohortRequest) {
+		t.Helper()
+		storedJSON, _ := json.Marshal(stored)
+		mockQuerier.EXPECT().
+			GetCohort(gomock.Any(), gomock.Any()).
+			Return(db.GetCohortRow{ID: pgtype.UUID{Bytes: cohortID, Valid: true}, Name: "Buyers", Rules: storedJSON}, nil)
+		mockQuerier.EXPECT().
+			UpdateCohort(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, arg db.UpdateCohortParams) (db.UpdateCohortRow, error) {
+				json.Unmarshal(arg.Rules, &stored)
+				return db.UpdateCohortRow{ID: arg.ID, Name: arg.Name, Rules: arg.Rules}, nil
+			})
+		if _, err := svc.Update(context.Background(), cohortID, req); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+	}
+
+	for _, eventName := range []string{"checkout", "checkout_started", "checkout_completed"} {
+		rules := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: eventName}}}
+		update(cohort.UpdateCohortRequest{Rules: &rules})
+		clock.Advance(10 * time.Second)
+		debouncer.Tick(context.Background())
+	}
+	if len(trigger.enqueued) != 0 {
+		t.Fatalf("enqueues during edits = %d, expected 0", len(trigger.enqueued))
+	}
+
+	clock.Advance(20 * time.Second)
+	debouncer.Tick(context.Background())
+	if len(trigger.enqueued) != 1 {
+		t.Fatalf("enqueues = %d, expected 1 after the quiet period", len(trigger.enqueued))
+	}
+	if stored.Conditions[0].EventName != "checkout_completed" {
+		t.Errorf("stored rules = %q, expected the final edit", stored.Conditions[0].EventName)
+	}
+
+	// Renaming without touching the rules doesn't recompute
+	update(cohort.UpdateCohortRequest{Name: "Checkout"})
+	clock.Advance(time.Minute)
+	debouncer.Tick(context.Background())
+	if len(trigger.enqueued) != 1 {
+		t.Errorf("enqueues after rename = %d, expected 1", len(trigger.enqueued))
+	}
+}
@@ -0,0 +1,86 @@
+package cohort
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// SizePreviewer counts the users currently matching a set of rules
+type SizePreviewer interface {
+	PreviewCount(ctx context.Context, rules Rules) (int64, error)
+}
+
+// MemberCounter counts a cohort's stored members
+type MemberCounter interface {
+	GetCohortMemberCount(ctx context.Context, cohortID uuid.UUID) (int64, error)
+}
+
+// DriftReport compares how many users a cohort's rules match right now with
+// how many members are stored for it
+type DriftReport struct {
+	CohortID      uuid.UUID `json:"cohort_id"`
+	RuleMatches   int64     `json:"rule_matches"`
+	StoredMembers int64     `json:"stored_members"`
+	// Drift is RuleMatches minus StoredMembers; non-zero means the stored
+	// membership is stale and a recompute would change it
+	Drift          int64     `json:"drift"`
+	NeedsRecompute bool      `json:"needs_recompute"`
+	Message        string    `json:"message"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// DriftChecker reports drift between a cohort's definition and its stored membership
+type DriftChecker struct {
+	cohortGetter CohortGetter
+	previewer    SizePreviewer
+	counter      MemberCounter
+}
+
+// NewDriftChecker creates a new drift checker
+func NewDriftChecker(cohortGetter CohortGetter, previewer SizePreviewer, counter MemberCounter) *DriftChecker {
+	return &DriftChecker{
+		cohortGetter: cohortGetter,
+		previewer:    previewer,
+		counter:      counter,
+	}
+}
+
+// Check evaluates a cohort's rules and compares the match count with its
+// stored member count. Counts only differ by net change, so users entering
+// and leaving in equal numbers aren't reported; use a consistency check for a
+// user-level comparison.
+func (d *DriftChecker) Check(ctx context.Context, cohortID uuid.UUID) (*DriftReport, error) {
+	c, err := d.cohortGetter.GetByID(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, c.ProjectID), c.ID)
+
+	matches, err := d.previewer.PreviewCount(ctx, c.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate cohort rules: %w", err)
+	}
+	stored, err := d.counter.GetCohortMemberCount(ctx, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stored members: %w", err)
+	}
+
+	report := &DriftReport{
+		CohortID:       c.ID,
+		RuleMatches:    matches,
+		StoredMembers:  stored,
+		Drift:          matches - stored,
+		NeedsRecompute: matches != stored,
+		CheckedAt:      time.Now().UTC(),
+	}
+	if report.NeedsRecompute {
+		report.Message = fmt.Sprintf("rule currently matches %d but stored membership is %d", matches, stored)
+	} else {
+		report.Message = "stored membership matches the rule"
+	}
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package cohort_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+type fakeSizePreviewer struct {
+	count int64
+}
+
+func (f *fakeSizePreviewer) PreviewCount(ctx context.Context, rules cohort.Rules) (int64, error) {
+	return f.count, nil
+}
+
+type fakeMemberCounter struct {
+	counts map[uuid.UUID]int64
+}
+
+func (f *fakeMemberCounter) GetCohortMemberCount(ctx context.Context, cohortID uuid.UUID) (int64, error) {
+	return f.counts[cohortID], nil
+}
+
+func TestDriftChecker_Check(t *testing.T) {
+	c := &cohort.Cohort{ID: uuid.New(), ProjectID: uuid.New(), Status: cohort.CohortStatusActive}
+	getter := &fakeCohortGetter{cohorts: map[uuid.UUID]*cohort.Cohort{c.ID: c}}
+
+	tests := []struct {
+		name           string
+		matches        int64
+		stored         int64
+		expectedDrift  int64
+		needsRecompute bool
+		message        string
+	}{
+		{"more matches than members", 1050, 1000, 50, true, "rule currently matches 1050 but stored membership is 1000"},
+		{"fewer matches than members", 900, 1000, -100, true, "rule currently matches 900 but stored membership is 1000"},
+		{"in sync", 1000, 1000, 0, false, "stored membership matches the rule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := cohort.NewDriftChecker(
+				getter,
+				&fakeSizePreviewer{count: tt.matches},
+				&fakeMemberCounter{counts: map[uuid.UUID]int64{c.ID: tt.stored}},
+			)
+
+			report, err := checker.Check(context.Background(), c.ID)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if report.RuleMatches != tt.matches || report.StoredMembers != tt.stored {
+				t.Errorf("counts = %d/%d, expected %d/%d", report.RuleMatches, report.StoredMembers, tt.matches, tt.stored)
+			}
+			if report.Drift != tt.expectedDrift {
+				t.Errorf("Drift = %d, expected %d", report.Drift, tt.expectedDrift)
+			}
+			if report.NeedsRecompute != tt.needsRecompute {
+				t.Errorf("NeedsRecompute = %v, expected %v", report.NeedsRecompute, tt.needsRecompute)
+			}
+			if report.Message != tt.message {
+				t.Errorf("Message = %q, expected %q", report.Message, tt.message)
+			}
+		})
+	}
+
+	t.Run("unknown cohort", func(t *testing.T) {
+		checker := cohort.NewDriftChecker(getter, &fakeSizePreviewer{}, &fakeMemberCounter{})
+		if _, err := checker.Check(context.Background(), uuid.New()); err != cohort.ErrCohortNotFound {
+			t.Errorf("Check() error = %v, expected %v", err, cohort.ErrCohortNotFound)
+		}
+	})
+}
@@ -1,7 +1,11 @@
 package cohort
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,6 +26,19 @@ const (
 	ConditionTypeEvent     ConditionType = "event"
 	ConditionTypeProperty  ConditionType = "property"
 	ConditionTypeAggregate ConditionType = "aggregate"
+	// ConditionTypeGrowth compares an aggregate over TimeWindow against the same
+	// aggregate over CompareWindow, e.g. spent more this month than last
+	ConditionTypeGrowth ConditionType = "growth"
+	// ConditionTypeUserAttribute compares PropertyName on the user's profile in
+	// user_attributes, e.g. plan or signup date, rather than on their events
+	ConditionTypeUserAttribute ConditionType = "user_attribute"
+	// ConditionTypeScore compares a precomputed per-user score in user_scores,
+	// e.g. an RFM score of 8 or more, against Value
+	ConditionTypeScore ConditionType = "score"
+	// ConditionTypeSequence matches users who did each of Steps in order,
+	// each within SequenceWindow of the step before it, e.g. signup then
+	// purchase within 7 days
+	ConditionTypeSequence ConditionType = "sequence"
 )
 
 // AggregationType defines the type of aggregation for aggregate conditions
@@ -34,6 +51,9 @@ const (
 	AggregationMin           AggregationType = "min"
 	AggregationMax           AggregationType = "max"
 	AggregationDistinctCount AggregationType = "distinct_count"
+	// AggregationLast is the field's value on the user's most recent event.
+	// Events with the same timestamp are ordered by their ingest sequence.
+	AggregationLast AggregationType = "last"
 )
 
 // Operator defines logical operators for combining conditions
@@ -58,12 +78,39 @@ const (
 	ComparisonNIN ComparisonOperator = "nin"
 )
 
+// ValueType selects how a property value is extracted from event properties
+type ValueType string
+
+const (
+	ValueTypeString ValueType = "string"
+	ValueTypeInt    ValueType = "int"
+	ValueTypeFloat  ValueType = "float"
+	ValueTypeBool   ValueType = "bool"
+	ValueTypeDate   ValueType = "date"
+)
+
+// MissingProperty selects how a property filter treats events without the
+// property. By default the filter compares the value ClickHouse extracts for
+// an absent key, "" or 0, so "!= ''" excludes such events and "< 10" includes
+// them.
+type MissingProperty string
+
+const (
+	// MissingPropertyExclude makes events without the property never match
+	MissingPropertyExclude MissingProperty = "exclude"
+	// MissingPropertyInclude makes events without the property always match
+	MissingPropertyInclude MissingProperty = "include"
+)
+
 // TimeWindow defines a time-based constraint for conditions
 type TimeWindow struct {
 	Type     TimeWindowType `json:"type"`
 	Duration string         `json:"duration,omitempty"` // e.g., "30d", "7d", "24h"
 	Start    *time.Time     `json:"start,omitempty"`
 	End      *time.Time     `json:"end,omitempty"`
+	// Offset shifts a sliding window back in time, e.g. duration "30d" with
+	// offset "30d" covers the 30 days before the most recent 30
+	Offset string `json:"offset,omitempty"`
 }
 
 // PropertyFilter allows filtering events by property values
@@ -71,6 +118,16 @@ type PropertyFilter struct {
 	Key      string             `json:"key"`
 	Operator ComparisonOperator `json:"operator"`
 	Value    interface{}        `json:"value"`
+	// ValueType overrides inferring the property type from Value
+	ValueType ValueType `json:"value_type,omitempty"`
+	// Missing selects how events without the property are treated
+	Missing MissingProperty `json:"missing,omitempty"`
+}
+
+// SequenceStep is one event of a sequence condition
+type SequenceStep struct {
+	EventName       string           `json:"event_name"`
+	PropertyFilters []PropertyFilter `json:"property_filters,omitempty"`
 }
 
 // Condition represents a single cohort membership condition
@@ -84,12 +141,126 @@ type Condition struct {
 	Operator         ComparisonOperator `json:"operator,omitempty"`
 	Value            interface{}        `json:"value,omitempty"`
 	PropertyFilters  []PropertyFilter   `json:"property_filters,omitempty"`
+	// CompareWindow is the baseline window for growth conditions
+	CompareWindow *TimeWindow `json:"compare_window,omitempty"`
+	// DedupEvents counts events with the same id once in aggregate and growth
+	// conditions. It costs extra memory per user since event ids must be kept
+	// to deduplicate, so enable it only where clients resend events.
+	DedupEvents bool `json:"dedup_events,omitempty"`
+	// ValueType overrides inferring the property type from Value, e.g. for
+	// in/nin arrays or numbers sent as strings
+	ValueType ValueType `json:"value_type,omitempty"`
+	// Score names the user_scores score compared by score conditions
+	Score string `json:"score,omitempty"`
+	// Negate matches the users who have events but don't satisfy the
+	// condition. See QueryBuilder.BuildQuery for how negated conditions
+	// combine under AND and OR.
+	Negate bool `json:"negate,omitempty"`
+	// Steps are the ordered events of a sequence condition
+	Steps []SequenceStep `json:"steps,omitempty"`
+	// SequenceWindow is the most time allowed between consecutive steps of
+	// a sequence, e.g. "7d". Steps with the same timestamp are ordered by the
+	// sequence stamped at ingest.
+	SequenceWindow string `json:"sequence_window,omitempty"`
+}
+
+// eventNames returns the event names the condition reads, the step events
+// for sequence conditions
+func (c Condition) eventNames() []string {
+	if c.Type != ConditionTypeSequence {
+		if c.EventName == "" {
+			return nil
+		}
+		return []string{c.EventName}
+	}
+	names := make([]string, 0, len(c.Steps))
+	for _, step := range c.Steps {
+		names = append(names, step.EventName)
+	}
+	return names
 }
 
-// Rules defines the cohort membership rules
+// RuleGroup combines conditions and nested groups with one operator, so
+// (A AND B) OR C is an OR group holding C and an AND group of A and B
+type RuleGroup struct {
+	Operator   Operator    `json:"operator"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Groups     []RuleGroup `json:"groups,omitempty"`
+}
+
+// mapConditions returns a copy of the group with fn applied to every
+// condition, including those of nested groups
+func (g RuleGroup) mapConditions(fn func(Condition) Condition) RuleGroup {
+	mapped := RuleGroup{Operator: g.Operator}
+	if g.Conditions != nil {
+		mapped.Conditions = make([]Condition, len(g.Conditions))
+		for i, cond := range g.Conditions {
+			mapped.Conditions[i] = fn(cond)
+		}
+	}
+	if g.Groups != nil {
+		mapped.Groups = make([]RuleGroup, len(g.Groups))
+		for i, sub := range g.Groups {
+			mapped.Groups[i] = sub.mapConditions(fn)
+		}
+	}
+	return mapped
+}
+
+// allConditions returns the group's conditions followed by those of its
+// nested groups, depth first
+func (g RuleGroup) allConditions() []Condition {
+	conditions := append([]Condition(nil), g.Conditions...)
+	for _, sub := range g.Groups {
+		conditions = append(conditions, sub.allConditions()...)
+	}
+	return conditions
+}
+
+// Rules defines the cohort membership rules. The rules are the top-level
+// group, so rules stored before groups existed decode as a single flat group.
 type Rules struct {
 	Operator   Operator    `json:"operator"`
 	Conditions []Condition `json:"conditions"`
+	// Groups are nested groups combined with Conditions under Operator
+	Groups []RuleGroup `json:"groups,omitempty"`
+	// DefaultTimeWindow applies to event, property and aggregate conditions
+	// that don't set their own TimeWindow
+	DefaultTimeWindow *TimeWindow `json:"default_time_window,omitempty"`
+	// ExcludeUserIDs are never members whatever the conditions match, e.g.
+	// test and internal accounts
+	ExcludeUserIDs []string `json:"exclude_user_ids,omitempty"`
+}
+
+// Group returns the rules as their top-level group
+func (r Rules) Group() RuleGroup {
+	return RuleGroup{Operator: r.Operator, Conditions: r.Conditions, Groups: r.Groups}
+}
+
+// withGroup returns a copy of the rules with the top-level group replaced
+func (r Rules) withGroup(g RuleGroup) Rules {
+	r.Operator, r.Conditions, r.Groups = g.Operator, g.Conditions, g.Groups
+	return r
+}
+
+// ResolveTimeWindows returns a copy of the rules in which conditions without
+// a TimeWindow, in any group, inherit DefaultTimeWindow. Explicit windows are kept.
+func (r Rules) ResolveTimeWindows() Rules {
+	if r.DefaultTimeWindow == nil {
+		return r
+	}
+
+	resolved := r.Group().mapConditions(func(cond Condition) Condition {
+		switch cond.Type {
+		case ConditionTypeEvent, ConditionTypeProperty, ConditionTypeAggregate:
+			if cond.TimeWindow == nil {
+				window := *r.DefaultTimeWindow
+				cond.TimeWindow = &window
+			}
+		}
+		return cond
+	})
+	return Rules{ExcludeUserIDs: r.ExcludeUserIDs}.withGroup(resolved)
 }
 
 // CohortStatus represents the current status of a cohort
@@ -99,19 +270,155 @@ const (
 	CohortStatusActive   CohortStatus = "active"
 	CohortStatusInactive CohortStatus = "inactive"
 	CohortStatusDraft    CohortStatus = "draft"
+	CohortStatusArchived CohortStatus = "archived"
+)
+
+// CohortType says where a cohort's membership comes from
+type CohortType string
+
+const (
+	// CohortTypeRules cohorts are computed from their rules
+	CohortTypeRules CohortType = "rules"
+	// CohortTypeStatic cohorts hold an uploaded list of users, changed only
+	// by adding and removing users explicitly
+	CohortTypeStatic CohortType = "static"
 )
 
 // Cohort represents a cohort definition
 type Cohort struct {
-	ID          uuid.UUID    `json:"id"`
-	ProjectID   uuid.UUID    `json:"project_id"`
-	Name        string       `json:"name"`
-	Description string       `json:"description,omitempty"`
-	Rules       Rules        `json:"rules"`
-	Status      CohortStatus `json:"status"`
-	Version     int64        `json:"version"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID                uuid.UUID    `json:"id"`
+	ProjectID         uuid.UUID    `json:"project_id"`
+	Name              string       `json:"name"`
+	Description       string       `json:"description,omitempty"`
+	Rules             Rules        `json:"rules"`
+	Status            CohortStatus `json:"status"`
+	Type              CohortType   `json:"type"`
+	Version           int64        `json:"version"`
+	RecomputeInterval string       `json:"recompute_interval,omitempty"` // e.g., "1h", "1d"
+	// MembershipTTL drops members this long after they joined, e.g. "7d".
+	// Members don't expire when it's empty, see MembershipLifetime.
+	MembershipTTL string `json:"membership_ttl,omitempty"`
+	// NeedsRecompute is set when the rules changed since the last completed recompute
+	NeedsRecompute bool `json:"needs_recompute"`
+	// StreamEnabled sends the cohort's membership changes to stream
+	// subscribers. Batch-only cohorts disable it to spare the broadcaster.
+	StreamEnabled bool `json:"stream_enabled"`
+	// Variants splits members between experiment variants, each member
+	// assigned one at join time by AssignVariant
+	Variants  []Variant `json:"variants,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is when the cohort was archived by Delete
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// MembershipLifetime returns how long members stay in the cohort after
+// joining, or zero if they don't expire. Only an explicit MembershipTTL
+// expires members: a lifetime derived from the rules' sliding windows would
+// drop members who are still qualifying through newer events, only for the
+// next recompute to add them back.
+func (c *Cohort) MembershipLifetime() time.Duration {
+	if c.MembershipTTL == "" {
+		return 0
+	}
+	d, err := parseDuration(c.MembershipTTL)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// RuleLimits bounds the size of rules accepted for a cohort; zero fields are unlimited
+type RuleLimits struct {
+	// MaxPropertyFilters is the most property filters a single condition may have
+	MaxPropertyFilters int
+	// MaxExcludedUserIDs is the most user IDs the rules may exclude
+	MaxExcludedUserIDs int
+}
+
+// Validate checks the rules against limits and for unknown property filter
+// modes, returning an error wrapping ErrInvalidRules that names the first
+// offending condition or list. Conditions in nested groups are numbered after
+// the top-level ones, depth first.
+func (r Rules) Validate(limits RuleLimits) error {
+	if limits.MaxExcludedUserIDs > 0 && len(r.ExcludeUserIDs) > limits.MaxExcludedUserIDs {
+		return fmt.Errorf("%w: %d excluded user IDs, more than the limit of %d",
+			ErrInvalidRules, len(r.ExcludeUserIDs), limits.MaxExcludedUserIDs)
+	}
+	for i, cond := range r.Group().allConditions() {
+		if limits.MaxPropertyFilters > 0 && len(cond.PropertyFilters) > limits.MaxPropertyFilters {
+			return fmt.Errorf("%w: condition %d has %d property filters, more than the limit of %d",
+				ErrInvalidRules, i, len(cond.PropertyFilters), limits.MaxPropertyFilters)
+		}
+		if err := validateMissingProperty(cond.PropertyFilters); err != nil {
+			return fmt.Errorf("%w: condition %d: %v", ErrInvalidRules, i, err)
+		}
+		for j, step := range cond.Steps {
+			if limits.MaxPropertyFilters > 0 && len(step.PropertyFilters) > limits.MaxPropertyFilters {
+				return fmt.Errorf("%w: step %d of condition %d has %d property filters, more than the limit of %d",
+					ErrInvalidRules, j, i, len(step.PropertyFilters), limits.MaxPropertyFilters)
+			}
+			if err := validateMissingProperty(step.PropertyFilters); err != nil {
+				return fmt.Errorf("%w: step %d of condition %d: %v", ErrInvalidRules, j, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LowercaseKeys returns a copy of the rules with the event property keys they
+// reference lowercased, matching events ingested with lowercased keys. User
+// attribute names aren't event properties and are left as they are.
+func (r Rules) LowercaseKeys() Rules {
+	normalized := r.Group().mapConditions(func(cond Condition) Condition {
+		if cond.Type != ConditionTypeUserAttribute {
+			cond.PropertyName = strings.ToLower(cond.PropertyName)
+		}
+		cond.AggregationField = strings.ToLower(cond.AggregationField)
+		cond.PropertyFilters = lowercaseFilterKeys(cond.PropertyFilters)
+		if len(cond.Steps) > 0 {
+			steps := make([]SequenceStep, len(cond.Steps))
+			for j, step := range cond.Steps {
+				step.PropertyFilters = lowercaseFilterKeys(step.PropertyFilters)
+				steps[j] = step
+			}
+			cond.Steps = steps
+		}
+		return cond
+	})
+	return r.withGroup(normalized)
+}
+
+// validateMissingProperty checks the missing property mode of each filter
+func validateMissingProperty(filters []PropertyFilter) error {
+	for _, f := range filters {
+		switch f.Missing {
+		case "", MissingPropertyExclude, MissingPropertyInclude:
+		default:
+			return fmt.Errorf("filter on %q has missing mode %q, expected %s or %s",
+				f.Key, f.Missing, MissingPropertyExclude, MissingPropertyInclude)
+		}
+	}
+	return nil
+}
+
+// lowercaseFilterKeys returns a copy of filters with their keys lowercased
+func lowercaseFilterKeys(filters []PropertyFilter) []PropertyFilter {
+	if len(filters) == 0 {
+		return filters
+	}
+	lowered := make([]PropertyFilter, len(filters))
+	for i, f := range filters {
+		f.Key = strings.ToLower(f.Key)
+		lowered[i] = f
+	}
+	return lowered
+}
+
+// NameCollision is a cohort name shared by more than one cohort in a project
+type NameCollision struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
 }
 
 // NewCohort creates a new cohort with the given name and rules
@@ -155,6 +462,21 @@ func (c *Cohort) ToJSON() ([]byte, error) {
 	return json.Marshal(c)
 }
 
+// DefinitionHash returns a hash of the cohort's definition. Bookkeeping that
+// changes on every write, such as the version and timestamps, is left out, so
+// two writes producing the same definition hash the same.
+func (c *Cohort) DefinitionHash() string {
+	def := *c
+	def.Version = 0
+	def.NeedsRecompute = false
+	def.CreatedAt = time.Time{}
+	def.UpdatedAt = time.Time{}
+
+	data, _ := json.Marshal(def)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // CohortFromJSON deserializes a cohort from JSON
 func CohortFromJSON(data []byte) (*Cohort, error) {
 	var cohort Cohort
@@ -166,9 +488,37 @@ func CohortFromJSON(data []byte) (*Cohort, error) {
 
 // CreateCohortRequest represents the request to create a new cohort
 type CreateCohortRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	Rules       Rules  `json:"rules" binding:"required"`
+	Name              string `json:"name" binding:"required"`
+	Description       string `json:"description"`
+	Rules             Rules  `json:"rules" binding:"required"`
+	RecomputeInterval string `json:"recompute_interval"`
+	MembershipTTL     string `json:"membership_ttl"`
+	// StreamEnabled defaults to true when omitted
+	StreamEnabled *bool     `json:"stream_enabled"`
+	Variants      []Variant `json:"variants"`
+}
+
+// CreateStaticCohortRequest represents the request to create a static cohort
+// from a list of users
+type CreateStaticCohortRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	UserIDs     []string `json:"user_ids" binding:"required"`
+}
+
+// StaticMembersRequest represents the request to change a static cohort's
+// members. A user listed in both is removed.
+type StaticMembersRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// StaticMembersResponse reports how many users a static cohort write added
+// and removed. Users already in the state asked for aren't counted.
+type StaticMembersResponse struct {
+	CohortID uuid.UUID `json:"cohort_id"`
+	Added    int       `json:"added"`
+	Removed  int       `json:"removed"`
 }
 
 // UpdateCohortRequest represents the request to update an existing cohort
@@ -177,6 +527,16 @@ type UpdateCohortRequest struct {
 	Description string       `json:"description"`
 	Rules       *Rules       `json:"rules"`
 	Status      CohortStatus `json:"status"`
+	// RecomputeInterval replaces the schedule when set; an empty string disables it
+	RecomputeInterval *string `json:"recompute_interval"`
+	// MembershipTTL replaces the membership lifetime when set; an empty string
+	// derives it from the rules again
+	MembershipTTL *string `json:"membership_ttl"`
+	// StreamEnabled turns streaming of membership changes on or off when set
+	StreamEnabled *bool `json:"stream_enabled"`
+	// Variants replaces the experiment variants when set; an empty list
+	// removes them. Existing members keep the variant they joined with.
+	Variants *[]Variant `json:"variants"`
 }
 
 // CheckMembershipRequest represents the request to check if a user is in a cohort
@@ -290,6 +290,60 @@ func TestCohort_JSONRoundTrip(t *testing.T) {
 	}
 }
 
+func TestCondition_NegateJSON(t *testing.T) {
+	cond := Condition{Type: ConditionTypeEvent, EventName: "cancel", Negate: true}
+
+	data, err := json.Marshal(cond)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+
+	var parsed Condition
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if !parsed.Negate {
+		t.Errorf("Negate = %v, expected true after round trip of %s", parsed.Negate, data)
+	}
+
+	data, err = json.Marshal(Condition{Type: ConditionTypeEvent, EventName: "cancel"})
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if _, ok := fields["negate"]; ok {
+		t.Errorf("unnegated condition JSON = %s, expected negate to be omitted", data)
+	}
+}
+
+func TestRules_GroupsJSON(t *testing.T) {
+	var flat Rules
+	if err := json.Unmarshal([]byte(`{"operator": "AND", "conditions": [{"type": "event", "event_name": "signup"}]}`), &flat); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	group := flat.Group()
+	if group.Operator != OperatorAND || len(group.Conditions) != 1 || len(group.Groups) != 0 {
+		t.Errorf("flat rules Group() = %+v, expected a single AND group of one condition", group)
+	}
+
+	var nested Rules
+	data := `{"operator": "OR", "conditions": [{"type": "event", "event_name": "upgrade"}], "groups": [
+		{"operator": "AND", "conditions": [{"type": "event", "event_name": "signup"}, {"type": "event", "event_name": "purchase"}]}
+	]}`
+	if err := json.Unmarshal([]byte(data), &nested); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if len(nested.Groups) != 1 || nested.Groups[0].Operator != OperatorAND || len(nested.Groups[0].Conditions) != 2 {
+		t.Errorf("Groups = %+v, expected one AND group of two conditions", nested.Groups)
+	}
+	if names := len(nested.Group().allConditions()); names != 3 {
+		t.Errorf("allConditions() = %d conditions, expected 3", names)
+	}
+}
+
 func TestTimeWindowType_Constants(t *testing.T) {
 	if TimeWindowSliding != "sliding" {
 		t.Errorf("TimeWindowSliding = %q, expected sliding", TimeWindowSliding)
@@ -379,3 +433,57 @@ func TestComparisonOperator_Constants(t *testing.T) {
 		t.Errorf("ComparisonNIN = %q, expected nin", ComparisonNIN)
 	}
 }
+
+func TestCohort_MembershipLifetime(t *testing.T) {
+	purchased := Rules{Operator: OperatorAND, Conditions: []Condition{
+		{Type: ConditionTypeEvent, EventName: "purchase", TimeWindow: &TimeWindow{Type: TimeWindowSliding, Duration: "7d"}},
+	}}
+
+	tests := []struct {
+		name     string
+		cohort   Cohort
+		expected time.Duration
+	}{
+		{
+			name:     "explicit TTL",
+			cohort:   Cohort{MembershipTTL: "1d", Rules: purchased},
+			expected: 24 * time.Hour,
+		},
+		{
+			// Members still qualifying through newer events would flap out
+			// and back in on the next recompute
+			name:   "sliding window alone never expires",
+			cohort: Cohort{Rules: purchased},
+		},
+		{
+			name:   "invalid TTL never expires",
+			cohort: Cohort{MembershipTTL: "soon", Rules: purchased},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cohort.MembershipLifetime(); got != tt.expected {
+				t.Errorf("MembershipLifetime() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCohort_DefinitionHash(t *testing.T) {
+	c := NewCohort("buyers", "", Rules{Operator: OperatorAND, Conditions: []Condition{{Type: ConditionTypeEvent, EventName: "purchase"}}})
+	hash := c.DefinitionHash()
+
+	bumped := *c
+	bumped.Version++
+	bumped.UpdatedAt = bumped.UpdatedAt.Add(time.Minute)
+	if bumped.DefinitionHash() != hash {
+		t.Error("DefinitionHash() changed with only the version and timestamp")
+	}
+
+	activated := *c
+	activated.Activate()
+	if activated.DefinitionHash() == hash {
+		t.Error("DefinitionHash() unchanged after a status change")
+	}
+}
@@ -0,0 +1,233 @@
+package cohort
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// DefaultMaxConcurrentExports is the default number of cohort exports run at once
+const DefaultMaxConcurrentExports = 2
+
+// DefaultExportJobRetention is how long finished exports stay readable by
+// default
+const DefaultExportJobRetention = 24 * time.Hour
+
+var ErrExportNotFound = errors.New("export not found")
+
+// On-demand export statuses before the export finishes with one of the export
+// run statuses
+const (
+	ExportStatusQueued  = "queued"
+	ExportStatusRunning = "running"
+)
+
+// ExportJob reports the progress of an on-demand cohort export
+type ExportJob struct {
+	ID          uuid.UUID `json:"id"`
+	CohortID    uuid.UUID `json:"cohort_id"`
+	Destination string    `json:"destination"`
+	Status      string    `json:"status"`
+	// Position is the export's place in the queue while it is queued, 1
+	// being the next to run
+	Position    int        `json:"position,omitempty"`
+	Exported    int64      `json:"exported"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// exportTask is an export waiting for or holding a slot
+type exportTask struct {
+	ctx    context.Context
+	cohort *Cohort
+	job    *ExportJob
+	done   chan struct{}
+}
+
+// ExportQueue bounds how many cohort exports run at once, as each scans the
+// cohort's full membership. Exports past the limit wait their turn in
+// submission order. Scheduled exports share the limit by running through
+// the queue's ExportCohort.
+type ExportQueue struct {
+	exporter      CohortExporter
+	maxConcurrent int
+	topics        ExportTopicPolicy
+	// jobRetention is how long finished exports are kept; 0 keeps them forever
+	jobRetention time.Duration
+
+	mu      sync.Mutex
+	running int
+	waiting []*exportTask
+	jobs    map[uuid.UUID]*ExportJob
+}
+
+// NewExportQueue creates a new export queue running at most maxConcurrent
+// exports with exporter
+func NewExportQueue(exporter CohortExporter, maxConcurrent int) *ExportQueue {
+	return &ExportQueue{
+		exporter:      exporter,
+		maxConcurrent: maxConcurrent,
+		jobRetention:  DefaultExportJobRetention,
+		jobs:          make(map[uuid.UUID]*ExportJob),
+	}
+}
+
+// SetJobRetention sets how long finished exports can be read with Get after
+// completing. 0 keeps them forever.
+func (q *ExportQueue) SetJobRetention(retention time.Duration) {
+	q.jobRetention = retention
+}
+
+// SetTopicPolicy restricts the topics exports may write to. Scheduled exports
+// are checked again when they run, so schedules created before a tighter
+// policy fail instead of writing to a topic it no longer allows.
+func (q *ExportQueue) SetTopicPolicy(policy ExportTopicPolicy) {
+	q.topics = policy
+}
+
+// Submit starts exporting a cohort's members to destination in the
+// background and returns the export, queued if every slot is taken. Get
+// reports its progress.
+func (q *ExportQueue) Submit(ctx context.Context, c *Cohort, destination string) (*ExportJob, error) {
+	if err := q.topics.validateExportDestination(destination); err != nil {
+		return nil, err
+	}
+
+	// The export outlives the request that started it
+	ctx = tenant.WithCohort(tenant.WithProject(context.WithoutCancel(ctx), c.ProjectID), c.ID)
+	task := q.newTask(ctx, c, destination)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.purgeJobs()
+	q.jobs[task.job.ID] = task.job
+	q.enqueue(task)
+	return q.snapshot(task.job), nil
+}
+
+// ExportCohort exports a cohort's members once a slot is free, waiting for
+// the export to finish
+func (q *ExportQueue) ExportCohort(ctx context.Context, c *Cohort, destination string) (int64, error) {
+	if err := q.topics.validateExportDestination(destination); err != nil {
+		return 0, err
+	}
+	task := q.newTask(ctx, c, destination)
+
+	q.mu.Lock()
+	q.enqueue(task)
+	q.mu.Unlock()
+
+	<-task.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if task.job.Status == ExportStatusFailed {
+		return task.job.Exported, errors.New(task.job.Error)
+	}
+	return task.job.Exported, nil
+}
+
+// Get returns the progress of an export started with Submit
+func (q *ExportQueue) Get(id uuid.UUID) (*ExportJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+	return q.snapshot(job), nil
+}
+
+func (q *ExportQueue) newTask(ctx context.Context, c *Cohort, destination string) *exportTask {
+	return &exportTask{
+		ctx:    ctx,
+		cohort: c,
+		job: &ExportJob{
+			ID:          uuid.New(),
+			CohortID:    c.ID,
+			Destination: destination,
+			Status:      ExportStatusQueued,
+			CreatedAt:   time.Now().UTC(),
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// enqueue adds a task behind those waiting and starts it if a slot is free.
+// q.mu must be held.
+func (q *ExportQueue) enqueue(task *exportTask) {
+	q.waiting = append(q.waiting, task)
+	q.dispatch()
+}
+
+// dispatch starts waiting tasks while slots are free. q.mu must be held.
+func (q *ExportQueue) dispatch() {
+	for q.running < q.maxConcurrent && len(q.waiting) > 0 {
+		task := q.waiting[0]
+		q.waiting[0] = nil
+		q.waiting = q.waiting[1:]
+
+		now := time.Now().UTC()
+		task.job.Status = ExportStatusRunning
+		task.job.StartedAt = &now
+		q.running++
+		go q.run(task)
+	}
+}
+
+// run exports a task's cohort and hands its slot to the next waiting task
+func (q *ExportQueue) run(task *exportTask) {
+	exported, err := q.exporter.ExportCohort(task.ctx, task.cohort, task.job.Destination)
+	if err != nil {
+		log.Printf("export %s of cohort %s to %s failed: %v", task.job.ID, task.cohort.ID, task.job.Destination, err)
+	}
+
+	q.mu.Lock()
+	now := time.Now().UTC()
+	task.job.Exported = exported
+	task.job.CompletedAt = &now
+	task.job.Status = ExportStatusSucceeded
+	if err != nil {
+		task.job.Status = ExportStatusFailed
+		task.job.Error = err.Error()
+	}
+	q.running--
+	q.dispatch()
+	q.mu.Unlock()
+
+	close(task.done)
+}
+
+// purgeJobs removes finished exports that completed longer ago than the job
+// retention. Submit is the only way exports are added, so purging there
+// bounds the jobs kept. q.mu must be held.
+func (q *ExportQueue) purgeJobs() {
+	if q.jobRetention <= 0 {
+		return
+	}
+	cutoff := time.Now().UTC().Add(-q.jobRetention)
+	for id, job := range q.jobs {
+		if job.CompletedAt != nil && job.CompletedAt.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// snapshot copies a job, filling in its queue position. q.mu must be held.
+func (q *ExportQueue) snapshot(job *ExportJob) *ExportJob {
+	copied := *job
+	for i, task := range q.waiting {
+		if task.job == job {
+			copied.Position = i + 1
+			break
+		}
+	}
+	return &copied
+}
@@ -0,0 +1,172 @@
+package cohort_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+// blockingExporter reports each export it starts and holds it until released
+type blockingExporter struct {
+	started chan uuid.UUID
+	release chan struct{}
+}
+
+func (b *blockingExporter) ExportCohort(ctx context.Context, c *cohort.Cohort, destination string) (int64, error) {
+	b.started <- c.ID
+	<-b.release
+	return 7, nil
+}
+
+func TestExportQueue_Submit(t *testing.T) {
+	exporter := &blockingExporter{started: make(chan uuid.UUID, 3), release: make(chan struct{})}
+	queue := cohort.NewExportQueue(exporter, 1)
+
+	cohorts := []*cohort.Cohort{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+	jobs := make([]*cohort.ExportJob, len(cohorts))
+	for i, c := range cohorts {
+		job, err := queue.Submit(context.Background(), c, "kafka://cohort-exports")
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		jobs[i] = job
+	}
+
+	waitStarted := func(expected uuid.UUID) {
+		t.Helper()
+		select {
+		case id := <-exporter.started:
+			if id != expected {
+				t.Errorf("started export of cohort %v, expected %v", id, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for export of cohort %v", expected)
+		}
+	}
+
+	waitStarted(cohorts[0].ID)
+	if jobs[0].Status != cohort.ExportStatusRunning {
+		t.Errorf("first export status = %s, expected %s", jobs[0].Status, cohort.ExportStatusRunning)
+	}
+	for i, job := range jobs[1:] {
+		if job.Status != cohort.ExportStatusQueued || job.Position != i+1 {
+			t.Errorf("export %d status = %s at position %d, expected %s at position %d",
+				i+1, job.Status, job.Position, cohort.ExportStatusQueued, i+1)
+		}
+	}
+	select {
+	case id := <-exporter.started:
+		t.Fatalf("export of cohort %v started beyond the limit", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Finishing the running export starts the next one and moves the last up
+	exporter.release <- struct{}{}
+	waitStarted(cohorts[1].ID)
+
+	last, err := queue.Get(jobs[2].ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if last.Status != cohort.ExportStatusQueued || last.Position != 1 {
+		t.Errorf("last export status = %s at position %d, expected %s at position 1", last.Status, last.Position, cohort.ExportStatusQueued)
+	}
+
+	exporter.release <- struct{}{}
+	waitStarted(cohorts[2].ID)
+	exporter.release <- struct{}{}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		first, err := queue.Get(jobs[0].ID)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if first.Status == cohort.ExportStatusSucceeded {
+			if first.Exported != 7 || first.Position != 0 {
+				t.Errorf("first export = %+v, expected 7 exported and no position", first)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first export status = %s, expected %s", first.Status, cohort.ExportStatusSucceeded)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := queue.Get(uuid.New()); err != cohort.ErrExportNotFound {
+		t.Errorf("Get() error = %v, expected %v", err, cohort.ErrExportNotFound)
+	}
+}
+
+func TestExportQueue_TopicPolicy(t *testing.T) {
+	exporter := &blockingExporter{started: make(chan uuid.UUID, 1), release: make(chan struct{})}
+	close(exporter.release)
+	queue := cohort.NewExportQueue(exporter, 1)
+	queue.SetTopicPolicy(cohort.ExportTopicPolicy{
+		Prefix:   "cohort-exports",
+		Reserved: []string{"events.raw", "cohort.membership"},
+	})
+	c := &cohort.Cohort{ID: uuid.New()}
+
+	for _, destination := range []string{"kafka://events.raw", "kafka://cohort.membership", "kafka://billing", "kafka://"} {
+		if _, err := queue.Submit(context.Background(), c, destination); !errors.Is(err, cohort.ErrInvalidExportDestination) {
+			t.Errorf("Submit(%q) error = %v, expected ErrInvalidExportDestination", destination, err)
+		}
+		if _, err := queue.ExportCohort(context.Background(), c, destination); !errors.Is(err, cohort.ErrInvalidExportDestination) {
+			t.Errorf("ExportCohort(%q) error = %v, expected ErrInvalidExportDestination", destination, err)
+		}
+	}
+
+	if _, err := queue.ExportCohort(context.Background(), c, "kafka://cohort-exports.vip"); err != nil {
+		t.Errorf("ExportCohort() error = %v, expected the prefixed topic to be allowed", err)
+	}
+}
+
+func TestExportQueue_JobRetention(t *testing.T) {
+	exporter := &blockingExporter{started: make(chan uuid.UUID, 2), release: make(chan struct{})}
+	close(exporter.release)
+	queue := cohort.NewExportQueue(exporter, 1)
+	queue.SetJobRetention(time.Millisecond)
+
+	waitFinished := func(id uuid.UUID) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			job, err := queue.Get(id)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if job.CompletedAt != nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("export status = %s, expected it finished", job.Status)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	first, err := queue.Submit(context.Background(), &cohort.Cohort{ID: uuid.New()}, "kafka://cohort-exports")
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	waitFinished(first.ID)
+	time.Sleep(5 * time.Millisecond)
+
+	// Submitting purges finished exports past the retention
+	second, err := queue.Submit(context.Background(), &cohort.Cohort{ID: uuid.New()}, "kafka://cohort-exports")
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := queue.Get(first.ID); err != cohort.ErrExportNotFound {
+		t.Errorf("Get() error = %v for an export past the retention, expected %v", err, cohort.ErrExportNotFound)
+	}
+	if _, err := queue.Get(second.ID); err != nil {
+		t.Errorf("Get() error = %v for the new export", err)
+	}
+}
@@ -0,0 +1,204 @@
+package cohort
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// ExportDestinationSchemes lists the destination URL schemes scheduled exports support
+var ExportDestinationSchemes = []string{"kafka"}
+
+// Export run statuses
+const (
+	ExportStatusSucceeded = "succeeded"
+	ExportStatusFailed    = "failed"
+	ExportStatusSkipped   = "skipped"
+)
+
+// ExportSchedule exports a cohort's members to a destination on a cron
+// cadence. Destinations are URLs such as kafka://cohort-exports, whose topic
+// the service's ExportTopicPolicy must allow.
+type ExportSchedule struct {
+	ID                uuid.UUID  `json:"id"`
+	CohortID          uuid.UUID  `json:"cohort_id"`
+	Destination       string     `json:"destination"`
+	Cron              string     `json:"cron"`
+	NextRunAt         *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt         *time.Time `json:"last_run_at,omitempty"`
+	LastStatus        string     `json:"last_status,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastExportedCount int64      `json:"last_exported_count"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// CreateExportScheduleRequest represents a request to schedule a recurring export
+type CreateExportScheduleRequest struct {
+	Destination string `json:"destination" binding:"required"`
+	Cron        string `json:"cron" binding:"required"`
+}
+
+// ExportRequest represents a request to export a cohort's members once
+type ExportRequest struct {
+	Destination string `json:"destination" binding:"required"`
+}
+
+// ExportRun records the outcome of a scheduled export
+type ExportRun struct {
+	At       time.Time
+	Status   string
+	Error    string
+	Exported int64
+}
+
+// nextRun returns when the schedule is next due: the first cron match after
+// its last run, or after its creation if it hasn't run yet
+func (s *ExportSchedule) nextRun() (time.Time, error) {
+	schedule, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	base := s.CreatedAt
+	if s.LastRunAt != nil {
+		base = *s.LastRunAt
+	}
+	return schedule.Next(base), nil
+}
+
+// ExportTopicPolicy restricts the Kafka topics exports may write to
+type ExportTopicPolicy struct {
+	// Prefix is what every export topic must start with; empty allows any
+	// topic that isn't reserved
+	Prefix string
+	// Reserved lists the topics the service itself reads or writes, which
+	// exports may never write to
+	Reserved []string
+}
+
+// validateExportDestination checks the destination is a URL with a supported
+// scheme whose topic the policy allows
+func (p ExportTopicPolicy) validateExportDestination(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExportDestination, err)
+	}
+	if !slices.Contains(ExportDestinationSchemes, u.Scheme) {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrInvalidExportDestination, u.Scheme)
+	}
+	topic := u.Host + u.Path
+	if topic == "" {
+		return fmt.Errorf("%w: %s destination needs a target", ErrInvalidExportDestination, u.Scheme)
+	}
+	if slices.Contains(p.Reserved, topic) {
+		return fmt.Errorf("%w: topic %q is used by the service", ErrInvalidExportDestination, topic)
+	}
+	if !strings.HasPrefix(topic, p.Prefix) {
+		return fmt.Errorf("%w: topic %q must start with %q", ErrInvalidExportDestination, topic, p.Prefix)
+	}
+	return nil
+}
+
+// ExportScheduleStore persists export schedules and their run status
+type ExportScheduleStore interface {
+	ListAllExportSchedules(ctx context.Context) ([]*ExportSchedule, error)
+	RecordExportRun(ctx context.Context, id uuid.UUID, run ExportRun) error
+}
+
+// CohortExporter writes a cohort's current members to a destination and
+// returns how many were exported
+type CohortExporter interface {
+	ExportCohort(ctx context.Context, c *Cohort, destination string) (int64, error)
+}
+
+// ExportScheduler runs cohort exports whose cron schedule has come due
+type ExportScheduler struct {
+	store    ExportScheduleStore
+	cohorts  CohortGetter
+	exporter CohortExporter
+	clock    Clock
+	tick     time.Duration
+}
+
+// NewExportScheduler creates a new export scheduler that checks for due exports every tick
+func NewExportScheduler(store ExportScheduleStore, cohorts CohortGetter, exporter CohortExporter, tick time.Duration) *ExportScheduler {
+	return &ExportScheduler{
+		store:    store,
+		cohorts:  cohorts,
+		exporter: exporter,
+		clock:    systemClock{},
+		tick:     tick,
+	}
+}
+
+// SetClock replaces the scheduler's clock
+func (s *ExportScheduler) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// Start begins checking for due exports
+func (s *ExportScheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Tick(ctx)
+			}
+		}
+	}()
+}
+
+// Tick runs every export whose next cron match has passed. Runs missed while
+// the service was down are caught up with a single export.
+func (s *ExportScheduler) Tick(ctx context.Context) {
+	schedules, err := s.store.ListAllExportSchedules(ctx)
+	if err != nil {
+		log.Printf("export scheduler: failed to list schedules: %v", err)
+		return
+	}
+
+	now := s.clock.Now()
+	for _, schedule := range schedules {
+		next, err := schedule.nextRun()
+		if err != nil || next.IsZero() || now.Before(next) {
+			continue
+		}
+
+		run := s.run(ctx, schedule)
+		run.At = now
+		if err := s.store.RecordExportRun(ctx, schedule.ID, run); err != nil {
+			log.Printf("export scheduler: failed to record run of schedule %s: %v", schedule.ID, err)
+		}
+	}
+}
+
+// run exports the schedule's cohort, skipping cohorts that aren't active
+func (s *ExportScheduler) run(ctx context.Context, schedule *ExportSchedule) ExportRun {
+	c, err := s.cohorts.GetByID(ctx, schedule.CohortID)
+	if err != nil {
+		return ExportRun{Status: ExportStatusFailed, Error: err.Error()}
+	}
+	if c.Status != CohortStatusActive {
+		return ExportRun{Status: ExportStatusSkipped, Error: "cohort is not active"}
+	}
+
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, c.ProjectID), c.ID)
+	exported, err := s.exporter.ExportCohort(ctx, c, schedule.Destination)
+	if err != nil {
+		log.Printf("export scheduler: failed to export cohort %s to %s: %v", c.ID, schedule.Destination, err)
+		return ExportRun{Status: ExportStatusFailed, Error: err.Error(), Exported: exported}
+	}
+	return ExportRun{Status: ExportStatusSucceeded, Exported: exported}
+}
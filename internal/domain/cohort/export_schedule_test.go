@@ -0,0 +1,190 @@
+package cohort_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+type fakeExportScheduleStore struct {
+	schedules []*cohort.ExportSchedule
+	runs      []cohort.ExportRun
+}
+
+func (f *fakeExportScheduleStore) ListAllExportSchedules(ctx context.Context) ([]*cohort.ExportSchedule, error) {
+	return f.schedules, nil
+}
+
+func (f *fakeExportScheduleStore) RecordExportRun(ctx context.Context, id uuid.UUID, run cohort.ExportRun) error {
+	for _, s := range f.schedules {
+		if s.ID == id {
+			at := run.At
+			s.LastRunAt = &at
+			s.LastStatus = run.Status
+			s.LastError = run.Error
+			s.LastExportedCount = run.Exported
+		}
+	}
+	f.runs = append(f.runs, run)
+	return nil
+}
+
+type fakeCohortGetter struct {
+	cohorts map[uuid.UUID]*cohort.Cohort
+}
+
+func (f *fakeCohortGetter) GetByID(ctx context.Context, id uuid.UUID) (*cohort.Cohort, error) {
+	c, ok := f.cohorts[id]
+	if !ok {
+		return nil, cohort.ErrCohortNotFound
+	}
+	return c, nil
+}
+
+type fakeCohortExporter struct {
+	clock    *fakeClock
+	err      error
+	exported []time.Time
+}
+
+func (f *fakeCohortExporter) ExportCohort(ctx context.Context, c *cohort.Cohort, destination string) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.exported = append(f.exported, f.clock.Now())
+	return 42, nil
+}
+
+func TestExportScheduler_Tick(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newScheduler := func(c *cohort.Cohort, cron string, exporter *fakeCohortExporter, clock *fakeClock) (*cohort.ExportScheduler, *fakeExportScheduleStore) {
+		store := &fakeExportScheduleStore{schedules: []*cohort.ExportSchedule{{
+			ID:          uuid.New(),
+			CohortID:    c.ID,
+			Destination: "kafka://cohort-exports",
+			Cron:        cron,
+			CreatedAt:   start,
+		}}}
+		getter := &fakeCohortGetter{cohorts: map[uuid.UUID]*cohort.Cohort{c.ID: c}}
+		scheduler := cohort.NewExportScheduler(store, getter, exporter, time.Minute)
+		scheduler.SetClock(clock)
+		return scheduler, store
+	}
+
+	t.Run("fires nightly", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		exporter := &fakeCohortExporter{clock: clock}
+		active := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive}
+		scheduler, store := newScheduler(active, "0 2 * * *", exporter, clock)
+
+		// Tick every 15 minutes for two days
+		for i := 0; i < 48*4; i++ {
+			scheduler.Tick(context.Background())
+			clock.Advance(15 * time.Minute)
+		}
+
+		expected := []time.Time{start.Add(2 * time.Hour), start.Add(26 * time.Hour)}
+		if len(exporter.exported) != len(expected) {
+			t.Fatalf("exports = %v, expected %v", exporter.exported, expected)
+		}
+		for i, at := range expected {
+			if !exporter.exported[i].Equal(at) {
+				t.Errorf("export %d at %v, expected %v", i, exporter.exported[i], at)
+			}
+		}
+
+		schedule := store.schedules[0]
+		if schedule.LastStatus != cohort.ExportStatusSucceeded {
+			t.Errorf("LastStatus = %q, expected %q", schedule.LastStatus, cohort.ExportStatusSucceeded)
+		}
+		if schedule.LastExportedCount != 42 {
+			t.Errorf("LastExportedCount = %d, expected 42", schedule.LastExportedCount)
+		}
+	})
+
+	t.Run("catches up missed runs once", func(t *testing.T) {
+		clock := &fakeClock{now: start.Add(72 * time.Hour)}
+		exporter := &fakeCohortExporter{clock: clock}
+		active := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive}
+		scheduler, _ := newScheduler(active, "@hourly", exporter, clock)
+
+		scheduler.Tick(context.Background())
+		scheduler.Tick(context.Background())
+
+		if len(exporter.exported) != 1 {
+			t.Errorf("exports = %d, expected 1", len(exporter.exported))
+		}
+	})
+
+	t.Run("records failures", func(t *testing.T) {
+		clock := &fakeClock{now: start.Add(3 * time.Hour)}
+		exporter := &fakeCohortExporter{clock: clock, err: errors.New("broker unavailable")}
+		active := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive}
+		scheduler, store := newScheduler(active, "0 2 * * *", exporter, clock)
+
+		scheduler.Tick(context.Background())
+
+		schedule := store.schedules[0]
+		if schedule.LastStatus != cohort.ExportStatusFailed {
+			t.Errorf("LastStatus = %q, expected %q", schedule.LastStatus, cohort.ExportStatusFailed)
+		}
+		if schedule.LastError != "broker unavailable" {
+			t.Errorf("LastError = %q, expected %q", schedule.LastError, "broker unavailable")
+		}
+	})
+
+	t.Run("skips inactive cohorts", func(t *testing.T) {
+		clock := &fakeClock{now: start.Add(3 * time.Hour)}
+		exporter := &fakeCohortExporter{clock: clock}
+		inactive := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusInactive}
+		scheduler, store := newScheduler(inactive, "0 2 * * *", exporter, clock)
+
+		scheduler.Tick(context.Background())
+
+		if len(exporter.exported) != 0 {
+			t.Errorf("exports = %d, expected 0", len(exporter.exported))
+		}
+		if got := store.schedules[0].LastStatus; got != cohort.ExportStatusSkipped {
+			t.Errorf("LastStatus = %q, expected %q", got, cohort.ExportStatusSkipped)
+		}
+	})
+}
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := cohort.ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("Next() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := cohort.ParseCron(expr); !errors.Is(err, cohort.ErrInvalidCronExpression) {
+			t.Errorf("ParseCron(%q) error = %v, expected ErrInvalidCronExpression", expr, err)
+		}
+	}
+}
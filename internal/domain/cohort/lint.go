@@ -0,0 +1,99 @@
+package cohort
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Lint warning codes
+const (
+	LintUnboundedWindow      = "unbounded_window"
+	LintUnfilteredSum        = "unfiltered_sum"
+	LintRedundantOrCondition = "redundant_or_condition"
+)
+
+// Warning is an advisory finding about rules that are valid but likely not
+// what was intended
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Path locates the condition, e.g. "groups[1].conditions[0]"
+	Path string `json:"path"`
+}
+
+// Lint returns advisory warnings about the rules, such as conditions that
+// scan all history or are made redundant by a broader one. Unlike Validate it
+// never rejects rules. Conditions without a TimeWindow are linted with
+// DefaultTimeWindow applied.
+func (r Rules) Lint() []Warning {
+	return r.ResolveTimeWindows().Group().lint("")
+}
+
+func (g RuleGroup) lint(prefix string) []Warning {
+	var warnings []Warning
+	for i, cond := range g.Conditions {
+		warnings = append(warnings, cond.lint(fmt.Sprintf("%sconditions[%d]", prefix, i))...)
+	}
+	if g.Operator == OperatorOR {
+		warnings = append(warnings, g.lintRedundant(prefix)...)
+	}
+	for i, sub := range g.Groups {
+		warnings = append(warnings, sub.lint(fmt.Sprintf("%sgroups[%d].", prefix, i))...)
+	}
+	return warnings
+}
+
+func (c Condition) lint(path string) []Warning {
+	var warnings []Warning
+	switch c.Type {
+	case ConditionTypeEvent, ConditionTypeProperty, ConditionTypeAggregate:
+		if c.TimeWindow == nil {
+			warnings = append(warnings, Warning{
+				Code:    LintUnboundedWindow,
+				Message: fmt.Sprintf("%s condition has no time window, so it scans all history", c.Type),
+				Path:    path,
+			})
+		}
+	}
+	if c.Type == ConditionTypeAggregate && c.Aggregation == AggregationSum && len(c.PropertyFilters) == 0 {
+		warnings = append(warnings, Warning{
+			Code:    LintUnfilteredSum,
+			Message: fmt.Sprintf("sum of %q has no property filters, so it may include refunds or other negative amounts", c.AggregationField),
+			Path:    path,
+		})
+	}
+	return warnings
+}
+
+// lintRedundant warns about event conditions of an OR group that match a
+// subset of another's users: the same event with extra property filters over
+// a window the broader condition covers
+func (g RuleGroup) lintRedundant(prefix string) []Warning {
+	var warnings []Warning
+	for i, narrow := range g.Conditions {
+		for j, broad := range g.Conditions {
+			if i == j || !subsumes(broad, narrow) {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Code:    LintRedundantOrCondition,
+				Message: fmt.Sprintf("condition on %q is covered by the broader %sconditions[%d] in this OR, so it changes nothing", narrow.EventName, prefix, j),
+				Path:    fmt.Sprintf("%sconditions[%d]", prefix, i),
+			})
+			break
+		}
+	}
+	return warnings
+}
+
+// subsumes reports whether every user matching the event condition narrow
+// also matches broad
+func subsumes(broad, narrow Condition) bool {
+	if broad.Type != ConditionTypeEvent || narrow.Type != ConditionTypeEvent || broad.Negate || narrow.Negate {
+		return false
+	}
+	if broad.EventName != narrow.EventName || len(broad.PropertyFilters) > 0 || len(narrow.PropertyFilters) == 0 {
+		return false
+	}
+	return broad.TimeWindow == nil || reflect.DeepEqual(broad.TimeWindow, narrow.TimeWindow)
+}
@@ -0,0 +1,94 @@
+package cohort_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+func lintCodes(warnings []cohort.Warning) map[string][]string {
+	codes := make(map[string][]string)
+	for _, w := range warnings {
+		codes[w.Code] = append(codes[w.Code], w.Path)
+	}
+	return codes
+}
+
+func TestRules_Lint(t *testing.T) {
+	week := &cohort.TimeWindow{Type: cohort.TimeWindowSliding, Duration: "7d"}
+	paid := []cohort.PropertyFilter{{Key: "plan", Operator: cohort.ComparisonEQ, Value: "paid"}}
+
+	t.Run("event condition without a time window", func(t *testing.T) {
+		rules := cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeEvent, EventName: "signup"},
+				{Type: cohort.ConditionTypeEvent, EventName: "login", TimeWindow: week},
+			},
+		}
+		expected := map[string][]string{cohort.LintUnboundedWindow: {"conditions[0]"}}
+		if codes := lintCodes(rules.Lint()); !reflect.DeepEqual(codes, expected) {
+			t.Errorf("Lint() = %v, expected %v", codes, expected)
+		}
+
+		rules.DefaultTimeWindow = week
+		if warnings := rules.Lint(); len(warnings) != 0 {
+			t.Errorf("Lint() = %v, expected the default window to bound the condition", warnings)
+		}
+	})
+
+	t.Run("sum without property filters", func(t *testing.T) {
+		rules := cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeAggregate, EventName: "purchase", Aggregation: cohort.AggregationSum, AggregationField: "amount", TimeWindow: week, Operator: cohort.ComparisonGT, Value: 100},
+				{Type: cohort.ConditionTypeAggregate, EventName: "purchase", Aggregation: cohort.AggregationSum, AggregationField: "amount", TimeWindow: week, Operator: cohort.ComparisonGT, Value: 100, PropertyFilters: paid},
+				{Type: cohort.ConditionTypeAggregate, EventName: "purchase", Aggregation: cohort.AggregationCount, TimeWindow: week, Operator: cohort.ComparisonGT, Value: 1},
+			},
+		}
+		expected := map[string][]string{cohort.LintUnfilteredSum: {"conditions[0]"}}
+		if codes := lintCodes(rules.Lint()); !reflect.DeepEqual(codes, expected) {
+			t.Errorf("Lint() = %v, expected %v", codes, expected)
+		}
+	})
+
+	t.Run("OR of a broad and narrow condition", func(t *testing.T) {
+		rules := cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeEvent, EventName: "login", TimeWindow: week},
+			},
+			Groups: []cohort.RuleGroup{{
+				Operator: cohort.OperatorOR,
+				Conditions: []cohort.Condition{
+					{Type: cohort.ConditionTypeEvent, EventName: "purchase", TimeWindow: week, PropertyFilters: paid},
+					{Type: cohort.ConditionTypeEvent, EventName: "purchase", TimeWindow: week},
+				},
+			}},
+		}
+		expected := map[string][]string{cohort.LintRedundantOrCondition: {"groups[0].conditions[0]"}}
+		if codes := lintCodes(rules.Lint()); !reflect.DeepEqual(codes, expected) {
+			t.Errorf("Lint() = %v, expected %v", codes, expected)
+		}
+
+		// Under AND the filtered condition narrows the match
+		rules.Groups[0].Operator = cohort.OperatorAND
+		if warnings := rules.Lint(); len(warnings) != 0 {
+			t.Errorf("Lint() = %v, expected no warnings under AND", warnings)
+		}
+	})
+
+	t.Run("broad condition over a shorter window", func(t *testing.T) {
+		rules := cohort.Rules{
+			Operator: cohort.OperatorOR,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeEvent, EventName: "purchase", TimeWindow: &cohort.TimeWindow{Type: cohort.TimeWindowSliding, Duration: "30d"}, PropertyFilters: paid},
+				{Type: cohort.ConditionTypeEvent, EventName: "purchase", TimeWindow: week},
+			},
+		}
+		if warnings := rules.Lint(); len(warnings) != 0 {
+			t.Errorf("Lint() = %v, expected no warnings when the windows differ", warnings)
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package cohort
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxLiveCohorts is the default number of cohorts evaluated per live event
+	DefaultMaxLiveCohorts = 10
+	// DefaultLiveCohortRefreshInterval is how long the active cohort list is cached
+	DefaultLiveCohortRefreshInterval = 30 * time.Second
+)
+
+// liveEventSource scopes condition queries to a single user's stored events
+// in the event's project plus the event being evaluated, which may not have
+// reached ClickHouse yet
+const liveEventSource = `(
+	SELECT id, user_id, event_name, properties, timestamp, sequence FROM events_raw WHERE project_id = ? AND user_id = ? AND id != ?
+	UNION ALL
+	SELECT toUUID(?) AS id, ? AS user_id, ? AS event_name, ? AS properties, toDateTime64(?, 3, 'UTC') AS timestamp, toUInt64(?) AS sequence
+)`
+
+// MembershipChangeProducer publishes membership changes made by live evaluation
+type MembershipChangeProducer interface {
+	ProduceMembershipChange(ctx context.Context, change LiveMembershipChange) error
+}
+
+// LiveEvent is a just-ingested event evaluated against active cohorts
+type LiveEvent struct {
+	ID         uuid.UUID
+	ProjectID  uuid.UUID
+	UserID     string
+	EventName  string
+	Properties map[string]any
+	Timestamp  time.Time
+	// Sequence is the order stamped at ingest among events with the same timestamp
+	Sequence uint64
+}
+
+// LiveMembershipChange is a join written by live evaluation
+type LiveMembershipChange struct {
+	ChangelogEntry
+	CohortName     string
+	TriggerEventID uuid.UUID
+}
+
+// LiveEvaluator writes cohort joins as soon as an ingested event qualifies a
+// user, instead of waiting for the next recompute. Only joins are written:
+// leaving a cohort depends on time passing and is left to recompute.
+type LiveEvaluator struct {
+	chClient   ClickHouseClient
+	lister     ActiveCohortLister
+	producer   MembershipChangeProducer
+	exporter   ChangelogExporter
+	maxCohorts int
+	fastPath   bool
+	aggFuncs   map[AggregationType]string
+
+	refreshInterval time.Duration
+	cohorts         []*Cohort
+	refreshedAt     time.Time
+	mu              sync.Mutex
+}
+
+// NewLiveEvaluator creates a new live evaluator. The producer may be nil.
+func NewLiveEvaluator(chClient ClickHouseClient, lister ActiveCohortLister, producer MembershipChangeProducer) *LiveEvaluator {
+	return &LiveEvaluator{
+		chClient:        chClient,
+		lister:          lister,
+		producer:        producer,
+		maxCohorts:      DefaultMaxLiveCohorts,
+		refreshInterval: DefaultLiveCohortRefreshInterval,
+	}
+}
+
+// SetMaxCohorts sets how many cohorts are evaluated per event. Cohorts beyond
+// the limit pick the event up on their next recompute.
+func (e *LiveEvaluator) SetMaxCohorts(max int) {
+	e.maxCohorts = max
+}
+
+// SetRefreshInterval sets how long the active cohort list is cached
+func (e *LiveEvaluator) SetRefreshInterval(interval time.Duration) {
+	e.refreshInterval = interval
+}
+
+// SetPropertyFastPath enables deciding cohorts made only of untimed property
+// conditions from the event itself, without querying the user's events
+func (e *LiveEvaluator) SetPropertyFastPath(enabled bool) {
+	e.fastPath = enabled
+}
+
+// SetAggregateFunctions overrides the ClickHouse functions used for
+// aggregations such as distinct_count
+func (e *LiveEvaluator) SetAggregateFunctions(funcs map[AggregationType]string) {
+	e.aggFuncs = funcs
+}
+
+// SetChangelogExporter enables exporting the changelog entries written by live evaluation
+func (e *LiveEvaluator) SetChangelogExporter(exporter ChangelogExporter) {
+	e.exporter = exporter
+}
+
+// Evaluate checks the active cohorts of the event's project referencing the
+// event and writes a join for each one the user now qualifies for. It returns
+// the joins written.
+func (e *LiveEvaluator) Evaluate(ctx context.Context, evt LiveEvent) ([]LiveMembershipChange, error) {
+	cohorts, err := e.affectedCohorts(ctx, evt.ProjectID, evt.EventName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active cohorts: %w", err)
+	}
+
+	props, err := json.Marshal(evt.Properties)
+	if err != nil {
+		return nil, err
+	}
+	if evt.Properties == nil {
+		props = []byte("{}")
+	}
+
+	var joins []LiveMembershipChange
+	for _, c := range cohorts {
+		var qualifies, decided bool
+		if e.fastPath && propertyOnly(c.Rules) {
+			qualifies, decided = matchProperties(c.Rules, evt)
+			if decided && !qualifies {
+				continue
+			}
+		}
+
+		member, err := e.isMember(ctx, c.ID, evt.UserID)
+		if err != nil {
+			return joins, fmt.Errorf("failed to check membership of cohort %s: %w", c.ID, err)
+		}
+		if member {
+			continue
+		}
+
+		if !decided {
+			qualifies, err = e.qualifies(ctx, c.Rules, evt, string(props))
+			if err != nil {
+				return joins, fmt.Errorf("failed to evaluate cohort %s: %w", c.ID, err)
+			}
+		}
+		if !qualifies {
+			continue
+		}
+
+		change := LiveMembershipChange{
+			ChangelogEntry: ChangelogEntry{
+				CohortID:   c.ID,
+				UserID:     evt.UserID,
+				PrevStatus: -1,
+				NewStatus:  1,
+				ChangedAt:  time.Now().UTC(),
+				Reason:     ChangeReasonEvent,
+				Variant:    AssignVariant(c.ID, evt.UserID, c.Variants),
+			},
+			CohortName:     c.Name,
+			TriggerEventID: evt.ID,
+		}
+		if err := e.writeJoin(ctx, change); err != nil {
+			return joins, fmt.Errorf("failed to write join for cohort %s: %w", c.ID, err)
+		}
+		joins = append(joins, change)
+	}
+
+	return joins, nil
+}
+
+// affectedCohorts returns the project's active cohorts with a condition on
+// the event, bounded by maxCohorts. With the property fast path, property-only
+// cohorts with a condition on any event are included too since they're cheap
+// to check.
+func (e *LiveEvaluator) affectedCohorts(ctx context.Context, projectID uuid.UUID, eventName string) ([]*Cohort, error) {
+	all, err := e.activeCohorts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []*Cohort
+	skipped := 0
+	for _, c := range all {
+		if c.ProjectID != projectID {
+			continue
+		}
+		if !referencesEvent(c.Rules, eventName) && !(e.fastPath && propertyOnly(c.Rules) && matchesAnyEvent(c.Rules)) {
+			continue
+		}
+		if len(affected) >= e.maxCohorts {
+			skipped++
+			continue
+		}
+		affected = append(affected, c)
+	}
+
+	if skipped > 0 {
+		log.Printf("Live evaluation of %q in project %s skipped %d cohorts over the limit of %d", eventName, projectID, skipped, e.maxCohorts)
+	}
+
+	return affected, nil
+}
+
+// activeCohorts returns the cached active cohorts, refreshing them when stale
+func (e *LiveEvaluator) activeCohorts(ctx context.Context) ([]*Cohort, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cohorts != nil && time.Since(e.refreshedAt) < e.refreshInterval {
+		return e.cohorts, nil
+	}
+
+	cohorts, err := e.lister.ListAllActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.cohorts = cohorts
+	e.refreshedAt = time.Now()
+
+	return cohorts, nil
+}
+
+// referencesEvent reports whether any condition of the rules, in any group,
+// is on the event
+func referencesEvent(rules Rules, eventName string) bool {
+	for _, cond := range rules.Group().allConditions() {
+		if slices.Contains(cond.eventNames(), eventName) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMember checks whether the user is currently a member of the cohort
+func (e *LiveEvaluator) isMember(ctx context.Context, cohortID uuid.UUID, userID string) (bool, error) {
+	rows, err := e.chClient.Query(ctx, `
+		SELECT user_id
+		FROM cohort_membership_current
+		WHERE cohort_id = ? AND user_id = ?
+		GROUP BY user_id
+		HAVING sum(sign) > 0
+	`, cohortID, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), nil
+}
+
+// qualifies runs the cohort rules over the user's events including evt
+func (e *LiveEvaluator) qualifies(ctx context.Context, rules Rules, evt LiveEvent, props string) (bool, error) {
+	qb := NewQueryBuilder()
+	qb.SetAggregateFunctions(e.aggFuncs)
+	qb.SetEventSource(liveEventSource, evt.ProjectID, evt.UserID, evt.ID, evt.ID.String(), evt.UserID, evt.EventName, props, evt.Timestamp, evt.Sequence)
+
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := e.chClient.Query(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return false, err
+		}
+		if userID == evt.UserID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// writeJoin records the join in the membership and changelog tables and
+// publishes it
+func (e *LiveEvaluator) writeJoin(ctx context.Context, change LiveMembershipChange) error {
+	batch, err := e.chClient.PrepareBatch(ctx, `
+		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at, variant)
+	`)
+	if err != nil {
+		return err
+	}
+	if err := batch.Append(change.CohortID, change.UserID, int8(1), change.ChangedAt, change.Variant); err != nil {
+		return err
+	}
+	if err := batch.Send(); err != nil {
+		return err
+	}
+
+	batch, err = e.chClient.PrepareBatch(ctx, `
+		INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id, reason, variant)
+	`)
+	if err != nil {
+		return err
+	}
+	if err := batch.Append(change.CohortID, change.UserID, change.PrevStatus, change.NewStatus, change.ChangedAt, change.TriggerEventID, string(change.Reason), change.Variant); err != nil {
+		return err
+	}
+	if err := batch.Send(); err != nil {
+		return err
+	}
+
+	if e.exporter != nil {
+		if err := e.exporter.ExportChangelog(ctx, []ChangelogEntry{change.ChangelogEntry}); err != nil {
+			return fmt.Errorf("failed to export changelog: %w", err)
+		}
+	}
+
+	if e.producer != nil {
+		if err := e.producer.ProduceMembershipChange(ctx, change); err != nil {
+			return fmt.Errorf("failed to produce membership change: %w", err)
+		}
+	}
+
+	return nil
+}
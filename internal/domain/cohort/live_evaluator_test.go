@@ -0,0 +1,391 @@
+package cohort_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeChangeProducer struct {
+	changes []cohort.LiveMembershipChange
+}
+
+func (p *fakeChangeProducer) ProduceMembershipChange(ctx context.Context, change cohort.LiveMembershipChange) error {
+	p.changes = append(p.changes, change)
+	return nil
+}
+
+func purchaseCohort(name string) *cohort.Cohort {
+	return &cohort.Cohort{
+		ID:     uuid.New(),
+		Name:   name,
+		Status: cohort.CohortStatusActive,
+		Rules: cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeEvent, EventName: "purchase"},
+			},
+		},
+	}
+}
+
+// expectLiveQueries serves membership lookups from members and rule
+// evaluations from qualifying, keyed by whether the user matches
+func expectLiveQueries(ctrl *gomock.Controller, client *mocks.MockClickHouseClient, member, qualifying bool) {
+	client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+			if strings.Contains(query, "cohort_membership_current") {
+				if member {
+					return newRowScanner(ctrl, "user-1"), nil
+				}
+				return newRowScanner(ctrl), nil
+			}
+			if qualifying {
+				return newRowScanner(ctrl, "user-1"), nil
+			}
+			return newRowScanner(ctrl), nil
+		}).AnyTimes()
+}
+
+func TestLiveEvaluator_Evaluate(t *testing.T) {
+	evt := cohort.LiveEvent{
+		ID:         uuid.New(),
+		UserID:     "user-1",
+		EventName:  "purchase",
+		Properties: map[string]any{"amount": 10},
+	}
+
+	t.Run("qualifying event produces an immediate join", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		c := purchaseCohort("buyers")
+		client := mocks.NewMockClickHouseClient(ctrl)
+		expectLiveQueries(ctrl, client, false, true)
+
+		var inserted []string
+		client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, query string) (cohort.Batch, error) {
+				batch := mocks.NewMockBatch(ctrl)
+				batch.EXPECT().Append(gomock.Any()).DoAndReturn(func(args ...any) error {
+					if strings.Contains(query, "cohort_membership_changelog") && args[5] != evt.ID {
+						t.Errorf("trigger_event_id = %v, expected %v", args[5], evt.ID)
+					}
+					if strings.Contains(query, "cohort_membership_changelog") && args[6] != string(cohort.ChangeReasonEvent) {
+						t.Errorf("reason = %v, expected %v", args[6], cohort.ChangeReasonEvent)
+					}
+					inserted = append(inserted, strings.TrimSpace(query))
+					return nil
+				})
+				batch.EXPECT().Send().Return(nil)
+				return batch, nil
+			}).Times(2)
+
+		producer := &fakeChangeProducer{}
+		evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{c}}, producer)
+
+		joins, err := evaluator.Evaluate(context.Background(), evt)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if len(joins) != 1 || joins[0].CohortID != c.ID || joins[0].NewStatus != 1 {
+			t.Fatalf("joins = %+v, expected a join of %v", joins, c.ID)
+		}
+		if len(inserted) != 2 {
+			t.Errorf("inserted rows = %d, expected membership and changelog", len(inserted))
+		}
+		if len(producer.changes) != 1 || producer.changes[0].CohortName != "buyers" || producer.changes[0].TriggerEventID != evt.ID {
+			t.Errorf("produced changes = %+v, expected the join", producer.changes)
+		}
+		if joins[0].Reason != cohort.ChangeReasonEvent {
+			t.Errorf("join reason = %v, expected %v", joins[0].Reason, cohort.ChangeReasonEvent)
+		}
+	})
+
+	t.Run("existing member is not rejoined", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		client := mocks.NewMockClickHouseClient(ctrl)
+		expectLiveQueries(ctrl, client, true, true)
+
+		producer := &fakeChangeProducer{}
+		evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{purchaseCohort("buyers")}}, producer)
+
+		joins, err := evaluator.Evaluate(context.Background(), evt)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if len(joins) != 0 || len(producer.changes) != 0 {
+			t.Errorf("joins = %+v, expected none", joins)
+		}
+	})
+
+	t.Run("non-qualifying event writes nothing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		client := mocks.NewMockClickHouseClient(ctrl)
+		expectLiveQueries(ctrl, client, false, false)
+
+		evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{purchaseCohort("buyers")}}, nil)
+
+		joins, err := evaluator.Evaluate(context.Background(), evt)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if len(joins) != 0 {
+			t.Errorf("joins = %+v, expected none", joins)
+		}
+	})
+
+	t.Run("only referencing cohorts up to the limit are evaluated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		unrelated := purchaseCohort("signups")
+		unrelated.Rules.Conditions[0].EventName = "signup"
+		cohorts := []*cohort.Cohort{unrelated, purchaseCohort("a"), purchaseCohort("b"), purchaseCohort("c")}
+
+		client := mocks.NewMockClickHouseClient(ctrl)
+		expectLiveQueries(ctrl, client, false, true)
+		client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, query string) (cohort.Batch, error) {
+				batch := mocks.NewMockBatch(ctrl)
+				batch.EXPECT().Append(gomock.Any()).Return(nil)
+				batch.EXPECT().Send().Return(nil)
+				return batch, nil
+			}).Times(4)
+
+		evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: cohorts}, nil)
+		evaluator.SetMaxCohorts(2)
+
+		joins, err := evaluator.Evaluate(context.Background(), evt)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if len(joins) != 2 {
+			t.Fatalf("joins = %d, expected 2", len(joins))
+		}
+		for _, j := range joins {
+			if j.CohortID == unrelated.ID {
+				t.Errorf("joined %v, which doesn't reference the event", unrelated.ID)
+			}
+		}
+	})
+}
+
+func TestLiveEvaluator_ProjectScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	projectID := uuid.New()
+	own := purchaseCohort("buyers")
+	own.ProjectID = projectID
+	foreign := purchaseCohort("buyers")
+	foreign.ProjectID = uuid.New()
+
+	client := mocks.NewMockClickHouseClient(ctrl)
+	client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+			if strings.Contains(query, "cohort_membership_current") {
+				if args[0] != own.ID {
+					t.Errorf("membership checked for cohort %v, expected only %v", args[0], own.ID)
+				}
+				return newRowScanner(ctrl), nil
+			}
+			if !strings.Contains(query, "project_id = ?") || args[0] != projectID {
+				t.Errorf("rule query args = %v, expected events scoped to project %v", args, projectID)
+			}
+			return newRowScanner(ctrl, "user-1"), nil
+		}).AnyTimes()
+	client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			batch := mocks.NewMockBatch(ctrl)
+			batch.EXPECT().Append(gomock.Any()).Return(nil)
+			batch.EXPECT().Send().Return(nil)
+			return batch, nil
+		}).Times(2)
+
+	evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{foreign, own}}, nil)
+
+	joins, err := evaluator.Evaluate(context.Background(), cohort.LiveEvent{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		UserID:    "user-1",
+		EventName: "purchase",
+	})
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if len(joins) != 1 || joins[0].CohortID != own.ID {
+		t.Errorf("joins = %+v, expected only a join of the project's cohort %v", joins, own.ID)
+	}
+}
+
+func TestLiveEvaluator_LastAggregate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	bigCart := &cohort.Cohort{
+		ID:     uuid.New(),
+		Name:   "big carts",
+		Status: cohort.CohortStatusActive,
+		Rules: cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{{
+				Type:             cohort.ConditionTypeAggregate,
+				EventName:        "checkout",
+				Aggregation:      cohort.AggregationLast,
+				AggregationField: "cart_value",
+				Operator:         cohort.ComparisonGT,
+				Value:            100,
+			}},
+		},
+	}
+
+	client := mocks.NewMockClickHouseClient(ctrl)
+	client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+			if strings.Contains(query, "cohort_membership_current") {
+				return newRowScanner(ctrl), nil
+			}
+			// Both arms of the event source must select the column the
+			// aggregate orders by, the in-flight event with its stamped sequence
+			if !strings.Contains(query, "timestamp, sequence FROM events_raw") || !strings.Contains(query, "toUInt64(?) AS sequence") {
+				t.Errorf("rule query %q, expected sequence selected from both event arms", query)
+			}
+			if !slices.Contains(args, any(uint64(7))) {
+				t.Errorf("rule query args = %v, expected the event's sequence 7", args)
+			}
+			return newRowScanner(ctrl, "user-1"), nil
+		}).AnyTimes()
+	client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			batch := mocks.NewMockBatch(ctrl)
+			batch.EXPECT().Append(gomock.Any()).Return(nil)
+			batch.EXPECT().Send().Return(nil)
+			return batch, nil
+		}).Times(2)
+
+	evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{bigCart}}, nil)
+
+	joins, err := evaluator.Evaluate(context.Background(), cohort.LiveEvent{
+		ID:         uuid.New(),
+		UserID:     "user-1",
+		EventName:  "checkout",
+		Properties: map[string]any{"cart_value": 150},
+		Sequence:   7,
+	})
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if len(joins) != 1 || joins[0].CohortID != bigCart.ID {
+		t.Errorf("joins = %+v, expected a join of %v", joins, bigCart.ID)
+	}
+}
+
+func TestLiveEvaluator_PropertyFastPath(t *testing.T) {
+	planCohort := func(eventName string, window *cohort.TimeWindow) *cohort.Cohort {
+		return &cohort.Cohort{
+			ID:     uuid.New(),
+			Name:   "pro",
+			Status: cohort.CohortStatusActive,
+			Rules: cohort.Rules{
+				Operator: cohort.OperatorAND,
+				Conditions: []cohort.Condition{
+					{Type: cohort.ConditionTypeProperty, EventName: eventName, PropertyName: "plan", Operator: cohort.ComparisonEQ, Value: "pro", TimeWindow: window},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		cohort        *cohort.Cohort
+		properties    map[string]any
+		expectJoin    bool
+		expectQueries int
+	}{
+		{
+			name:          "matching property-only cohort joins without a rule query",
+			cohort:        planCohort("", nil),
+			properties:    map[string]any{"plan": "pro"},
+			expectJoin:    true,
+			expectQueries: 1,
+		},
+		{
+			name:          "non-matching property-only cohort skips every query",
+			cohort:        planCohort("", nil),
+			properties:    map[string]any{"plan": "free"},
+			expectQueries: 0,
+		},
+		{
+			name:          "time-windowed property cohort runs the rule query",
+			cohort:        planCohort("page_view", &cohort.TimeWindow{Type: cohort.TimeWindowSliding, Duration: "30d"}),
+			properties:    map[string]any{"plan": "pro"},
+			expectJoin:    true,
+			expectQueries: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := mocks.NewMockClickHouseClient(ctrl)
+			var ruleQueries, queries int
+			client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+					queries++
+					if strings.Contains(query, "cohort_membership_current") {
+						return newRowScanner(ctrl), nil
+					}
+					ruleQueries++
+					return newRowScanner(ctrl, "user-1"), nil
+				}).AnyTimes()
+			client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, query string) (cohort.Batch, error) {
+					batch := mocks.NewMockBatch(ctrl)
+					batch.EXPECT().Append(gomock.Any()).Return(nil)
+					batch.EXPECT().Send().Return(nil)
+					return batch, nil
+				}).AnyTimes()
+
+			evaluator := cohort.NewLiveEvaluator(client, &fakeCohortLister{cohorts: []*cohort.Cohort{tt.cohort}}, nil)
+			evaluator.SetPropertyFastPath(true)
+
+			// Property-only cohorts without an event name are evaluated
+			// for every event
+			joins, err := evaluator.Evaluate(context.Background(), cohort.LiveEvent{
+				ID:         uuid.New(),
+				UserID:     "user-1",
+				EventName:  "page_view",
+				Properties: tt.properties,
+			})
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if (len(joins) == 1) != tt.expectJoin {
+				t.Errorf("joins = %+v, expected join %v", joins, tt.expectJoin)
+			}
+			if queries != tt.expectQueries {
+				t.Errorf("queries = %d, expected %d", queries, tt.expectQueries)
+			}
+			fast := tt.cohort.Rules.Conditions[0].TimeWindow == nil
+			if fast && ruleQueries != 0 {
+				t.Errorf("rule queries = %d, expected the fast path to skip them", ruleQueries)
+			}
+			if !fast && ruleQueries != 1 {
+				t.Errorf("rule queries = %d, expected the time-windowed cohort to be queried", ruleQueries)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package cohort
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+var (
+	ErrOptimizeInProgress = errors.New("membership optimize already in progress")
+	ErrOptimizeThrottled  = errors.New("membership optimize ran too recently")
+)
+
+// MembershipPartitionOptimizer force-merges partitions of the current
+// membership table
+type MembershipPartitionOptimizer interface {
+	MembershipPartitions(ctx context.Context, cohortID uuid.UUID) ([]string, error)
+	OptimizeMembershipPartition(ctx context.Context, partitionID string) error
+}
+
+// OptimizeReport describes a completed membership optimize
+type OptimizeReport struct {
+	CohortID   uuid.UUID `json:"cohort_id"`
+	Partitions []string  `json:"partitions"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// MembershipOptimizer merges a cohort's membership parts after large
+// recomputes, reclaiming space and making sign-summing reads cheaper
+type MembershipOptimizer struct {
+	optimizer    MembershipPartitionOptimizer
+	cohortGetter CohortGetter
+	clock        Clock
+	minInterval  time.Duration
+
+	running sync.Mutex
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// NewMembershipOptimizer creates a new membership optimizer. minInterval is
+// the least time between optimizes, as each rewrites whole partitions.
+func NewMembershipOptimizer(optimizer MembershipPartitionOptimizer, cohortGetter CohortGetter, minInterval time.Duration) *MembershipOptimizer {
+	return &MembershipOptimizer{
+		optimizer:    optimizer,
+		cohortGetter: cohortGetter,
+		clock:        systemClock{},
+		minInterval:  minInterval,
+	}
+}
+
+// SetClock replaces the optimizer's clock
+func (o *MembershipOptimizer) SetClock(clock Clock) {
+	o.clock = clock
+}
+
+// Optimize force-merges the partitions holding a cohort's membership. Only
+// one optimize runs at a time, and runs closer together than the minimum
+// interval are refused.
+func (o *MembershipOptimizer) Optimize(ctx context.Context, cohortID uuid.UUID) (*OptimizeReport, error) {
+	if !o.running.TryLock() {
+		return nil, ErrOptimizeInProgress
+	}
+	defer o.running.Unlock()
+
+	now := o.clock.Now()
+	o.mu.Lock()
+	throttled := !o.lastRun.IsZero() && now.Sub(o.lastRun) < o.minInterval
+	o.mu.Unlock()
+	if throttled {
+		return nil, ErrOptimizeThrottled
+	}
+
+	c, err := o.cohortGetter.GetByID(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, c.ProjectID), c.ID)
+
+	partitions, err := o.optimizer.MembershipPartitions(ctx, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list membership partitions: %w", err)
+	}
+
+	o.mu.Lock()
+	o.lastRun = now
+	o.mu.Unlock()
+
+	for _, partition := range partitions {
+		if err := o.optimizer.OptimizeMembershipPartition(ctx, partition); err != nil {
+			return nil, fmt.Errorf("failed to optimize partition %s: %w", partition, err)
+		}
+	}
+
+	if partitions == nil {
+		partitions = []string{}
+	}
+	return &OptimizeReport{
+		CohortID:   c.ID,
+		Partitions: partitions,
+		StartedAt:  now,
+		DurationMs: o.clock.Now().Sub(now).Milliseconds(),
+	}, nil
+}
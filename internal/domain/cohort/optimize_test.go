@@ -0,0 +1,81 @@
+package cohort_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+// fakePartitionOptimizer blocks each optimize until release is closed
+type fakePartitionOptimizer struct {
+	started   chan struct{}
+	release   chan struct{}
+	mu        sync.Mutex
+	optimized []string
+}
+
+func (f *fakePartitionOptimizer) MembershipPartitions(ctx context.Context, cohortID uuid.UUID) ([]string, error) {
+	return []string{"all"}, nil
+}
+
+func (f *fakePartitionOptimizer) OptimizeMembershipPartition(ctx context.Context, partitionID string) error {
+	f.started <- struct{}{}
+	<-f.release
+	f.mu.Lock()
+	f.optimized = append(f.optimized, partitionID)
+	f.mu.Unlock()
+	return nil
+}
+
+func TestMembershipOptimizer_Optimize(t *testing.T) {
+	c := &cohort.Cohort{ID: uuid.New(), ProjectID: uuid.New(), Status: cohort.CohortStatusActive}
+	getter := &fakeCohortGetter{cohorts: map[uuid.UUID]*cohort.Cohort{c.ID: c}}
+	fake := &fakePartitionOptimizer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	optimizer := cohort.NewMembershipOptimizer(fake, getter, 10*time.Minute)
+	optimizer.SetClock(clock)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := optimizer.Optimize(context.Background(), c.ID)
+		done <- err
+	}()
+	<-fake.started
+
+	t.Run("refuses a concurrent optimize", func(t *testing.T) {
+		if _, err := optimizer.Optimize(context.Background(), c.ID); err != cohort.ErrOptimizeInProgress {
+			t.Errorf("Optimize() error = %v, expected %v", err, cohort.ErrOptimizeInProgress)
+		}
+	})
+
+	close(fake.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if len(fake.optimized) != 1 || fake.optimized[0] != "all" {
+		t.Errorf("optimized = %v, expected [all]", fake.optimized)
+	}
+
+	t.Run("throttles back-to-back optimizes", func(t *testing.T) {
+		clock.Advance(time.Minute)
+		if _, err := optimizer.Optimize(context.Background(), c.ID); err != cohort.ErrOptimizeThrottled {
+			t.Errorf("Optimize() error = %v, expected %v", err, cohort.ErrOptimizeThrottled)
+		}
+	})
+
+	t.Run("runs again after the minimum interval", func(t *testing.T) {
+		clock.Advance(10 * time.Minute)
+		report, err := optimizer.Optimize(context.Background(), c.ID)
+		if err != nil {
+			t.Fatalf("Optimize() error = %v", err)
+		}
+		if report.CohortID != c.ID || len(report.Partitions) != 1 {
+			t.Errorf("report = %+v, expected one partition of %v", report, c.ID)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package cohort
+
+import "strings"
+
+// propertyOnly reports whether the rules can be decided from single events:
+// the rules have no nested groups or excluded users, and every condition is
+// an untimed, unnegated property condition with a scalar comparison. Such a
+// condition holds once any of the user's events matches it, so an event
+// matching it is proof on its own and no event history is needed.
+func propertyOnly(rules Rules) bool {
+	if len(rules.Conditions) == 0 || len(rules.Groups) > 0 || len(rules.ExcludeUserIDs) > 0 {
+		return false
+	}
+	for _, cond := range rules.ResolveTimeWindows().Conditions {
+		if cond.Type != ConditionTypeProperty || cond.Negate || cond.TimeWindow != nil || len(cond.PropertyFilters) > 0 {
+			return false
+		}
+		switch cond.Operator {
+		case ComparisonEQ, ComparisonNE, ComparisonGT, ComparisonGTE, ComparisonLT, ComparisonLTE:
+		default:
+			return false
+		}
+		if _, ok := propertyKind(cond); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAnyEvent reports whether a property-only cohort has a condition
+// without an event name, which any event can satisfy
+func matchesAnyEvent(rules Rules) bool {
+	for _, cond := range rules.Conditions {
+		if cond.EventName == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchProperties evaluates property-only rules against a single event.
+// decided is false when the event alone can't settle the rules, which happens
+// under AND when the event matches some conditions but not all of them: the
+// rest may have been matched by earlier events.
+func matchProperties(rules Rules, evt LiveEvent) (qualifies, decided bool) {
+	matched := 0
+	for _, cond := range rules.Conditions {
+		if matchProperty(cond, evt) {
+			matched++
+		}
+	}
+
+	if rules.Operator == OperatorOR {
+		return matched > 0, true
+	}
+	switch matched {
+	case len(rules.Conditions):
+		return true, true
+	case 0:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// matchProperty evaluates a property condition against an event the way
+// buildPropertyConditionQuery does in ClickHouse, where a missing or
+// mistyped property extracts as the zero value
+func matchProperty(cond Condition, evt LiveEvent) bool {
+	if cond.EventName != "" && cond.EventName != evt.EventName {
+		return false
+	}
+
+	kind, _ := propertyKind(cond)
+	raw := evt.Properties[cond.PropertyName]
+
+	if kind == ValueTypeString {
+		s, _ := raw.(string)
+		want, _ := cond.Value.(string)
+		return compareOrdered(strings.Compare(s, want), cond.Operator)
+	}
+
+	got := extractNumber(kind, raw)
+	want := extractNumber(kind, cond.Value)
+	switch {
+	case got < want:
+		return compareOrdered(-1, cond.Operator)
+	case got > want:
+		return compareOrdered(1, cond.Operator)
+	default:
+		return compareOrdered(0, cond.Operator)
+	}
+}
+
+// propertyKind mirrors propertyExtractor, returning the value type a condition
+// is compared as. It reports false for conditions the fast path can't mirror
+// exactly, such as dates or a value of a different type than its extractor.
+func propertyKind(cond Condition) (ValueType, bool) {
+	switch cond.ValueType {
+	case ValueTypeString:
+		_, ok := cond.Value.(string)
+		return ValueTypeString, ok
+	case ValueTypeInt, ValueTypeFloat:
+		_, ok := numericValue(cond.Value)
+		return cond.ValueType, ok
+	case ValueTypeBool:
+		_, ok := cond.Value.(bool)
+		return ValueTypeBool, ok
+	case "":
+	default:
+		return "", false
+	}
+
+	switch cond.Value.(type) {
+	case float64:
+		return ValueTypeFloat, true
+	case int, int64:
+		return ValueTypeInt, true
+	case string:
+		return ValueTypeString, true
+	default:
+		return "", false
+	}
+}
+
+// extractNumber converts a property to the number ClickHouse extracts for kind
+func extractNumber(kind ValueType, v any) float64 {
+	if kind == ValueTypeBool {
+		if b, _ := v.(bool); b {
+			return 1
+		}
+		return 0
+	}
+
+	f, ok := numericValue(v)
+	if !ok {
+		return 0
+	}
+	if kind == ValueTypeInt && f != float64(int64(f)) {
+		return 0
+	}
+	return f
+}
+
+// compareOrdered applies op to the result of comparing a property to a value
+func compareOrdered(cmp int, op ComparisonOperator) bool {
+	switch op {
+	case ComparisonEQ:
+		return cmp == 0
+	case ComparisonNE:
+		return cmp != 0
+	case ComparisonGT:
+		return cmp > 0
+	case ComparisonGTE:
+		return cmp >= 0
+	case ComparisonLT:
+		return cmp < 0
+	case ComparisonLTE:
+		return cmp <= 0
+	default:
+		return false
+	}
+}
@@ -1,8 +1,11 @@
 package cohort
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,7 +13,39 @@ import (
 
 // QueryBuilder translates cohort rules into ClickHouse SQL queries
 type QueryBuilder struct {
-	now time.Time
+	now        time.Time
+	source     string
+	sourceArgs []any
+	aggFuncs   map[AggregationType]string
+}
+
+// DefaultAggregateFunctions are the ClickHouse functions used for
+// aggregations that have more than one implementation
+var DefaultAggregateFunctions = map[AggregationType]string{
+	AggregationDistinctCount: "uniqExact",
+}
+
+// aggregateFunctionChoices lists the functions each aggregation may be
+// overridden with, trading accuracy for speed
+var aggregateFunctionChoices = map[AggregationType][]string{
+	AggregationDistinctCount: {"uniqExact", "uniq", "uniqCombined", "uniqCombined64", "uniqHLL12", "uniqTheta"},
+}
+
+// ParseAggregateFunctions validates aggregate function overrides keyed by
+// aggregation type, e.g. {"distinct_count": "uniq"}
+func ParseAggregateFunctions(overrides map[string]string) (map[AggregationType]string, error) {
+	funcs := make(map[AggregationType]string, len(overrides))
+	for agg, fn := range overrides {
+		choices, ok := aggregateFunctionChoices[AggregationType(agg)]
+		if !ok {
+			return nil, fmt.Errorf("aggregation %q has no overridable function", agg)
+		}
+		if !slices.Contains(choices, fn) {
+			return nil, fmt.Errorf("unsupported function %q for %s, expected one of %s", fn, agg, strings.Join(choices, ", "))
+		}
+		funcs[AggregationType(agg)] = fn
+	}
+	return funcs, nil
 }
 
 // NewQueryBuilder creates a new query builder
@@ -27,38 +62,331 @@ func NewQueryBuilderWithTime(now time.Time) *QueryBuilder {
 	}
 }
 
-// BuildQuery generates a ClickHouse SQL query that returns user_ids matching the cohort rules
+// SetEventSource replaces the events_raw table read by every condition with
+// the given table expression. The args bind placeholders in the expression and
+// are repeated for each condition.
+func (qb *QueryBuilder) SetEventSource(source string, args ...any) {
+	qb.source = source
+	qb.sourceArgs = args
+}
+
+// SetAggregateFunctions overrides the ClickHouse functions used for
+// aggregations listed in DefaultAggregateFunctions
+func (qb *QueryBuilder) SetAggregateFunctions(funcs map[AggregationType]string) {
+	qb.aggFuncs = funcs
+}
+
+// aggregateFunction returns the ClickHouse function used for agg
+func (qb *QueryBuilder) aggregateFunction(agg AggregationType) string {
+	if fn, ok := qb.aggFuncs[agg]; ok {
+		return fn
+	}
+	return DefaultAggregateFunctions[agg]
+}
+
+// ErrUnsafeRules is returned for rules whose generated query would not match
+// the users the rules describe
+var ErrUnsafeRules = errors.New("rules cannot be evaluated safely")
+
+// BuildQuery generates a ClickHouse SQL query that returns user_ids matching the cohort rules.
+//
+// Subqueries are combined in a fixed order: event and property conditions,
+// then aggregate, sequence and growth conditions, each in definition order. Conditions
+// that users with no matching events would satisfy, such as count < 3, cannot
+// be found by scanning events. Under AND they are evaluated last, as EXCEPT
+// the users matching the negated condition. They are rejected under OR or when
+// no other condition selects the users to keep. Conditions without a time
+// window use the rules' default window, if any.
+//
+// ExcludeUserIDs are removed from the combined result of every condition and
+// group, so no condition can bring an excluded user back.
+//
+// Nested groups follow the conditions in definition order. Each is built the
+// same way under its own operator and wrapped in a subquery, so it combines
+// with its siblings as a single parenthesized set, e.g. (A INTERSECT B)
+// UNION C.
+//
+// A negated condition matches users with at least one event who don't
+// satisfy the condition. Under AND it is evaluated last, as EXCEPT the users
+// satisfying it; under OR it contributes every user with an event NOT IN the
+// users satisfying it. When only negated conditions remain under AND, every
+// user with an event is the starting set. Negating a condition that users
+// without events satisfy, e.g. count < 3, inverts its operator instead.
 func (qb *QueryBuilder) BuildQuery(rules Rules) (string, []any, error) {
-	if len(rules.Conditions) == 0 {
+	if len(rules.Conditions) == 0 && len(rules.Groups) == 0 {
 		return "", nil, fmt.Errorf("cohort has no conditions")
 	}
+	query, args, err := qb.buildGroupQuery(rules.ResolveTimeWindows().Group())
+	if err != nil || len(rules.ExcludeUserIDs) == 0 {
+		return query, args, err
+	}
 
-	var subqueries []string
-	var allArgs []any
+	placeholders := make([]string, len(rules.ExcludeUserIDs))
+	for i, userID := range rules.ExcludeUserIDs {
+		placeholders[i] = "?"
+		args = append(args, userID)
+	}
+	query = "SELECT user_id FROM (" + query + ") WHERE user_id NOT IN (" + strings.Join(placeholders, ", ") + ")"
+	return query, args, nil
+}
+
+// BuildIncrementalQuery generates a query for the users matching the rules
+// among those with events at or after since, the only users whose membership
+// an incremental recompute re-evaluates
+func (qb *QueryBuilder) BuildIncrementalQuery(rules Rules, since time.Time) (string, []any, error) {
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		return "", nil, err
+	}
+	affected, affectedArgs := qb.BuildAffectedUsersQuery(since)
+	return "SELECT user_id FROM (" + query + ") WHERE user_id IN (" + affected + ")", append(args, affectedArgs...), nil
+}
+
+// BuildAffectedUsersQuery generates a query for the users with events at or
+// after since
+func (qb *QueryBuilder) BuildAffectedUsersQuery(since time.Time) (string, []any) {
+	return qb.withEventSource(`SELECT DISTINCT user_id FROM events_raw WHERE timestamp >= ?`, []any{since})
+}
+
+// buildGroupQuery generates the query for one group of the rules, recursing
+// into its nested groups
+func (qb *QueryBuilder) buildGroupQuery(group RuleGroup) (string, []any, error) {
+	if len(group.Conditions) == 0 && len(group.Groups) == 0 {
+		return "", nil, fmt.Errorf("rule group has no conditions")
+	}
+
+	var subqueries, exclusions []string
+	var allArgs, exclusionArgs []any
+	negated := false
+
+	for _, cond := range orderConditions(group.Conditions) {
+		exclude := matchesNoEvents(cond)
+		if cond.Negate && exclude {
+			// NOT count < 3 is count >= 3, which only users with events satisfy
+			cond.Negate, exclude = false, false
+			cond.Operator = negateOperator(cond.Operator)
+		}
+		if exclude {
+			if group.Operator != OperatorAND {
+				return "", nil, fmt.Errorf("%w: %s %s condition on %q also matches users without events, which OR cannot include", ErrUnsafeRules, cond.Aggregation, cond.Operator, cond.EventName)
+			}
+			cond.Operator = negateOperator(cond.Operator)
+		}
+		if cond.Negate {
+			negated = true
+			if group.Operator == OperatorAND {
+				cond.Negate, exclude = false, true
+			}
+		}
 
-	for _, cond := range rules.Conditions {
 		subquery, args, err := qb.buildConditionQuery(cond)
 		if err != nil {
 			return "", nil, fmt.Errorf("failed to build condition query: %w", err)
 		}
+		subquery, args = qb.withEventSource(subquery, args)
+
+		if exclude {
+			exclusions = append(exclusions, subquery)
+			exclusionArgs = append(exclusionArgs, args...)
+			continue
+		}
+		subqueries = append(subqueries, subquery)
+		allArgs = append(allArgs, args...)
+	}
+
+	for _, sub := range group.Groups {
+		subquery, args, err := qb.buildGroupQuery(sub)
+		if err != nil {
+			return "", nil, err
+		}
+		subqueries = append(subqueries, "SELECT user_id FROM ("+subquery+")")
+		allArgs = append(allArgs, args...)
+	}
+
+	if len(subqueries) == 0 {
+		if !negated {
+			return "", nil, fmt.Errorf("%w: every condition also matches users without events, so no condition selects the users to keep", ErrUnsafeRules)
+		}
+		subquery, args := qb.withEventSource(allUsersQuery, nil)
 		subqueries = append(subqueries, subquery)
 		allArgs = append(allArgs, args...)
 	}
 
 	// Combine subqueries based on operator
 	var combiner string
-	if rules.Operator == OperatorAND {
+	if group.Operator == OperatorAND {
 		combiner = " INTERSECT "
 	} else {
 		combiner = " UNION "
 	}
 
 	finalQuery := strings.Join(subqueries, combiner)
+	if len(exclusions) > 0 {
+		if len(subqueries) > 1 {
+			finalQuery = "SELECT user_id FROM (" + finalQuery + ")"
+		}
+		finalQuery += " EXCEPT " + strings.Join(exclusions, " EXCEPT ")
+		allArgs = append(allArgs, exclusionArgs...)
+	}
+
 	return finalQuery, allArgs, nil
 }
 
-// buildConditionQuery generates a subquery for a single condition
+// allUsersQuery selects every user with at least one event, the set negated
+// conditions are taken relative to
+const allUsersQuery = `SELECT DISTINCT user_id FROM events_raw`
+
+// withEventSource replaces each events_raw read in query with the event
+// source, if one is set. Every read precedes the placeholders of its own
+// query, so the source args are bound once per read, in front.
+func (qb *QueryBuilder) withEventSource(query string, args []any) (string, []any) {
+	n := strings.Count(query, "FROM events_raw")
+	if qb.source == "" || n == 0 {
+		return query, args
+	}
+	query = strings.ReplaceAll(query, "FROM events_raw", "FROM "+qb.source)
+	sourced := make([]any, 0, n*len(qb.sourceArgs)+len(args))
+	for i := 0; i < n; i++ {
+		sourced = append(sourced, qb.sourceArgs...)
+	}
+	return query, append(sourced, args...)
+}
+
+// conditionRank is the position of a condition type in the combined query
+var conditionRank = map[ConditionType]int{
+	ConditionTypeEvent:         0,
+	ConditionTypeProperty:      1,
+	ConditionTypeUserAttribute: 1,
+	ConditionTypeScore:         1,
+	ConditionTypeAggregate:     2,
+	ConditionTypeSequence:      2,
+	ConditionTypeGrowth:        3,
+}
+
+// orderConditions returns the conditions sorted by type, keeping definition
+// order within a type
+func orderConditions(conditions []Condition) []Condition {
+	ordered := append([]Condition(nil), conditions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return conditionRank[ordered[i].Type] < conditionRank[ordered[j].Type]
+	})
+	return ordered
+}
+
+// matchesNoEvents reports whether a user with no events matching the
+// condition would satisfy it, e.g. count < 3 or this month's sum >= last
+// month's
+func matchesNoEvents(cond Condition) bool {
+	switch cond.Aggregation {
+	case AggregationCount, AggregationSum, AggregationDistinctCount:
+	default:
+		return false
+	}
+
+	switch cond.Type {
+	case ConditionTypeAggregate:
+		return compareZero(cond.Operator, cond.Value)
+	case ConditionTypeGrowth:
+		// Both windows aggregate to zero
+		return cond.Operator == ComparisonEQ || cond.Operator == ComparisonGTE || cond.Operator == ComparisonLTE
+	default:
+		return false
+	}
+}
+
+// compareZero reports whether 0 satisfies the comparison against value.
+// Non-numeric values are treated as not matching.
+func compareZero(op ComparisonOperator, value any) bool {
+	if op == ComparisonIN || op == ComparisonNIN {
+		values, ok := value.([]any)
+		if !ok {
+			return false
+		}
+		hasZero := false
+		for _, v := range values {
+			if f, ok := numericValue(v); ok && f == 0 {
+				hasZero = true
+			}
+		}
+		return hasZero == (op == ComparisonIN)
+	}
+
+	f, ok := numericValue(value)
+	if !ok {
+		return false
+	}
+	switch op {
+	case ComparisonEQ:
+		return f == 0
+	case ComparisonNE:
+		return f != 0
+	case ComparisonGT:
+		return 0 > f
+	case ComparisonGTE:
+		return 0 >= f
+	case ComparisonLT:
+		return 0 < f
+	case ComparisonLTE:
+		return 0 <= f
+	default:
+		return false
+	}
+}
+
+// numericValue converts a JSON or Go number to float64
+func numericValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// negateOperator returns the comparison matching exactly the values op rejects
+func negateOperator(op ComparisonOperator) ComparisonOperator {
+	switch op {
+	case ComparisonEQ:
+		return ComparisonNE
+	case ComparisonNE:
+		return ComparisonEQ
+	case ComparisonGT:
+		return ComparisonLTE
+	case ComparisonGTE:
+		return ComparisonLT
+	case ComparisonLT:
+		return ComparisonGTE
+	case ComparisonLTE:
+		return ComparisonGT
+	case ComparisonIN:
+		return ComparisonNIN
+	case ComparisonNIN:
+		return ComparisonIN
+	default:
+		return op
+	}
+}
+
+// buildConditionQuery generates a subquery for a single condition. A negated
+// condition selects the users with events NOT IN the users satisfying it.
 func (qb *QueryBuilder) buildConditionQuery(cond Condition) (string, []any, error) {
+	if cond.Negate {
+		cond.Negate = false
+		query, args, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			return "", nil, err
+		}
+		return allUsersQuery + " WHERE user_id NOT IN (" + query + ")", args, nil
+	}
+
 	switch cond.Type {
 	case ConditionTypeEvent:
 		return qb.buildEventConditionQuery(cond)
@@ -66,6 +394,14 @@ func (qb *QueryBuilder) buildConditionQuery(cond Condition) (string, []any, erro
 		return qb.buildAggregateConditionQuery(cond)
 	case ConditionTypeProperty:
 		return qb.buildPropertyConditionQuery(cond)
+	case ConditionTypeGrowth:
+		return qb.buildGrowthConditionQuery(cond)
+	case ConditionTypeUserAttribute:
+		return qb.buildUserAttributeConditionQuery(cond)
+	case ConditionTypeScore:
+		return qb.buildScoreConditionQuery(cond)
+	case ConditionTypeSequence:
+		return qb.buildSequenceConditionQuery(cond)
 	default:
 		return "", nil, fmt.Errorf("unsupported condition type: %s", cond.Type)
 	}
@@ -100,6 +436,10 @@ func (qb *QueryBuilder) buildEventConditionQuery(cond Condition) (string, []any,
 	return query, args, nil
 }
 
+// eventOrder orders a user's events by time, breaking ties between events
+// with the same timestamp by the sequence stamped at ingest
+const eventOrder = "(timestamp, sequence)"
+
 // buildAggregateConditionQuery generates a query for aggregate-based conditions
 func (qb *QueryBuilder) buildAggregateConditionQuery(cond Condition) (string, []any, error) {
 	startTime, endTime, err := qb.resolveTimeWindow(cond.TimeWindow)
@@ -136,11 +476,20 @@ func (qb *QueryBuilder) buildAggregateConditionQuery(cond Condition) (string, []
 		if cond.AggregationField == "" {
 			return "", nil, fmt.Errorf("aggregation_field required for distinct_count")
 		}
-		aggFunc = fmt.Sprintf("uniqExact(JSONExtractString(properties, '%s'))", cond.AggregationField)
+		aggFunc = fmt.Sprintf("%s(JSONExtractString(properties, '%s'))", qb.aggregateFunction(AggregationDistinctCount), cond.AggregationField)
+	case AggregationLast:
+		if cond.AggregationField == "" {
+			return "", nil, fmt.Errorf("aggregation_field required for last")
+		}
+		aggFunc = fmt.Sprintf("argMax(JSONExtractFloat(properties, '%s'), %s)", cond.AggregationField, eventOrder)
 	default:
 		return "", nil, fmt.Errorf("unsupported aggregation type: %s", cond.Aggregation)
 	}
 
+	if cond.DedupEvents {
+		aggFunc = dedupedAggregate(cond, aggFunc)
+	}
+
 	// Build the comparison operator
 	compOp, err := qb.getComparisonOperator(cond.Operator)
 	if err != nil {
@@ -167,12 +516,146 @@ func (qb *QueryBuilder) buildAggregateConditionQuery(cond Condition) (string, []
 	}
 
 	// Add GROUP BY and HAVING
-	query += fmt.Sprintf(` GROUP BY user_id HAVING %s %s ?`, aggFunc, compOp)
-	args = append(args, cond.Value)
+	placeholder, values, err := comparisonValue(cond.Operator, "", cond.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	query += fmt.Sprintf(` GROUP BY user_id HAVING %s %s %s`, aggFunc, compOp, placeholder)
+	args = append(args, values...)
 
 	return query, args, nil
 }
 
+// buildGrowthConditionQuery generates a query comparing an aggregate over two
+// time windows per user using conditional aggregation
+func (qb *QueryBuilder) buildGrowthConditionQuery(cond Condition) (string, []any, error) {
+	if cond.TimeWindow == nil || cond.CompareWindow == nil {
+		return "", nil, fmt.Errorf("growth condition requires time_window and compare_window")
+	}
+
+	startA, endA, err := qb.resolveTimeWindow(cond.TimeWindow)
+	if err != nil {
+		return "", nil, err
+	}
+	startB, endB, err := qb.resolveTimeWindow(cond.CompareWindow)
+	if err != nil {
+		return "", nil, err
+	}
+
+	compOp, err := qb.getComparisonOperator(cond.Operator)
+	if err != nil {
+		return "", nil, err
+	}
+	if cond.Operator == ComparisonIN || cond.Operator == ComparisonNIN {
+		return "", nil, fmt.Errorf("unsupported comparison operator for growth condition: %s", cond.Operator)
+	}
+
+	windowA, argsA := windowPredicate(startA, endA)
+	windowB, argsB := windowPredicate(startB, endB)
+
+	aggA, err := qb.conditionalAggregate(cond, windowA)
+	if err != nil {
+		return "", nil, err
+	}
+	aggB, err := qb.conditionalAggregate(cond, windowB)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT user_id FROM events_raw WHERE event_name = ? AND ((%s) OR (%s))`, windowA, windowB)
+	args := []any{cond.EventName}
+	args = append(args, argsA...)
+	args = append(args, argsB...)
+
+	// Add property filters
+	filterClause, filterArgs := qb.buildPropertyFilters(cond.PropertyFilters)
+	if filterClause != "" {
+		query += " AND " + filterClause
+		args = append(args, filterArgs...)
+	}
+
+	query += fmt.Sprintf(` GROUP BY user_id HAVING %s %s %s`, aggA, compOp, aggB)
+	args = append(args, argsA...)
+	args = append(args, argsB...)
+
+	return query, args, nil
+}
+
+// windowPredicate generates a timestamp predicate for a resolved time window
+func windowPredicate(start, end *time.Time) (string, []any) {
+	var clauses []string
+	var args []any
+
+	if start != nil {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, *start)
+	}
+	if end != nil {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, *end)
+	}
+
+	if len(clauses) == 0 {
+		return "1", nil
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// conditionalAggregate generates the -If combinator form of a condition's aggregation
+func (qb *QueryBuilder) conditionalAggregate(cond Condition, predicate string) (string, error) {
+	if cond.Aggregation == AggregationCount {
+		if cond.DedupEvents {
+			return fmt.Sprintf("uniqExactIf(id, %s)", predicate), nil
+		}
+		return fmt.Sprintf("countIf(%s)", predicate), nil
+	}
+
+	if cond.AggregationField == "" {
+		return "", fmt.Errorf("aggregation_field required for %s", cond.Aggregation)
+	}
+
+	if cond.DedupEvents {
+		switch cond.Aggregation {
+		case AggregationSum:
+			return fmt.Sprintf("arraySum(arrayMap(x -> x.2, groupUniqArrayIf((id, JSONExtractFloat(properties, '%s')), %s)))", cond.AggregationField, predicate), nil
+		case AggregationAvg:
+			return fmt.Sprintf("arrayAvg(arrayMap(x -> x.2, groupUniqArrayIf((id, JSONExtractFloat(properties, '%s')), %s)))", cond.AggregationField, predicate), nil
+		}
+	}
+
+	switch cond.Aggregation {
+	case AggregationSum:
+		return fmt.Sprintf("sumIf(JSONExtractFloat(properties, '%s'), %s)", cond.AggregationField, predicate), nil
+	case AggregationAvg:
+		return fmt.Sprintf("avgIf(JSONExtractFloat(properties, '%s'), %s)", cond.AggregationField, predicate), nil
+	case AggregationMin:
+		return fmt.Sprintf("minIf(JSONExtractFloat(properties, '%s'), %s)", cond.AggregationField, predicate), nil
+	case AggregationMax:
+		return fmt.Sprintf("maxIf(JSONExtractFloat(properties, '%s'), %s)", cond.AggregationField, predicate), nil
+	case AggregationDistinctCount:
+		return fmt.Sprintf("%sIf(JSONExtractString(properties, '%s'), %s)", qb.aggregateFunction(AggregationDistinctCount), cond.AggregationField, predicate), nil
+	case AggregationLast:
+		return fmt.Sprintf("argMaxIf(JSONExtractFloat(properties, '%s'), %s, %s)", cond.AggregationField, eventOrder, predicate), nil
+	default:
+		return "", fmt.Errorf("unsupported aggregation type: %s", cond.Aggregation)
+	}
+}
+
+// dedupedAggregate returns the aggregate counting each event id once.
+// Min, max, last and distinct counts are unaffected by duplicates and keep agg.
+func dedupedAggregate(cond Condition, agg string) string {
+	switch cond.Aggregation {
+	case AggregationCount:
+		return "count(DISTINCT id)"
+	case AggregationSum:
+		return fmt.Sprintf("arraySum(arrayMap(x -> x.2, groupUniqArray((id, JSONExtractFloat(properties, '%s')))))", cond.AggregationField)
+	case AggregationAvg:
+		return fmt.Sprintf("arrayAvg(arrayMap(x -> x.2, groupUniqArray((id, JSONExtractFloat(properties, '%s')))))", cond.AggregationField)
+	default:
+		return agg
+	}
+}
+
 // buildPropertyConditionQuery generates a query for property-based conditions
 func (qb *QueryBuilder) buildPropertyConditionQuery(cond Condition) (string, []any, error) {
 	startTime, endTime, err := qb.resolveTimeWindow(cond.TimeWindow)
@@ -186,21 +669,16 @@ func (qb *QueryBuilder) buildPropertyConditionQuery(cond Condition) (string, []a
 	}
 
 	// For property conditions, we check if the user has any event with the matching property
-	var valueExtractor string
-	switch v := cond.Value.(type) {
-	case float64:
-		valueExtractor = fmt.Sprintf("JSONExtractFloat(properties, '%s')", cond.PropertyName)
-	case int, int64:
-		valueExtractor = fmt.Sprintf("JSONExtractInt(properties, '%s')", cond.PropertyName)
-	case string:
-		valueExtractor = fmt.Sprintf("JSONExtractString(properties, '%s')", cond.PropertyName)
-	default:
-		_ = v
-		valueExtractor = fmt.Sprintf("JSONExtractString(properties, '%s')", cond.PropertyName)
+	valueExtractor, err := propertyExtractor(cond.PropertyName, cond.ValueType, cond.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	placeholder, args, err := comparisonValue(cond.Operator, cond.ValueType, cond.Value)
+	if err != nil {
+		return "", nil, err
 	}
 
-	query := fmt.Sprintf(`SELECT DISTINCT user_id FROM events_raw WHERE %s %s ?`, valueExtractor, compOp)
-	args := []any{cond.Value}
+	query := fmt.Sprintf(`SELECT DISTINCT user_id FROM events_raw WHERE %s %s %s`, valueExtractor, compOp, placeholder)
 
 	if cond.EventName != "" {
 		query += ` AND event_name = ?`
@@ -219,6 +697,137 @@ func (qb *QueryBuilder) buildPropertyConditionQuery(cond Condition) (string, []a
 	return query, args, nil
 }
 
+// buildUserAttributeConditionQuery generates a query for conditions on user
+// profile attributes, read from the latest user_attributes row per user.
+// Event source overrides don't apply since no events are read.
+func (qb *QueryBuilder) buildUserAttributeConditionQuery(cond Condition) (string, []any, error) {
+	if cond.PropertyName == "" {
+		return "", nil, fmt.Errorf("user attribute condition requires property_name")
+	}
+
+	compOp, err := qb.getComparisonOperator(cond.Operator)
+	if err != nil {
+		return "", nil, err
+	}
+
+	valueExtractor, err := jsonExtractor("attributes", cond.PropertyName, cond.ValueType, cond.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	placeholder, args, err := comparisonValue(cond.Operator, cond.ValueType, cond.Value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT user_id FROM user_attributes FINAL WHERE %s %s %s`, valueExtractor, compOp, placeholder)
+	return query, args, nil
+}
+
+// buildScoreConditionQuery generates a query comparing a user's latest
+// precomputed score against a threshold
+func (qb *QueryBuilder) buildScoreConditionQuery(cond Condition) (string, []any, error) {
+	if cond.Score == "" {
+		return "", nil, fmt.Errorf("score condition requires score")
+	}
+
+	switch cond.Operator {
+	case ComparisonIN, ComparisonNIN:
+		return "", nil, fmt.Errorf("score conditions do not support operator: %s", cond.Operator)
+	}
+	compOp, err := qb.getComparisonOperator(cond.Operator)
+	if err != nil {
+		return "", nil, err
+	}
+
+	threshold, ok := numericValue(cond.Value)
+	if !ok {
+		return "", nil, fmt.Errorf("score condition requires a numeric value, got %v", cond.Value)
+	}
+
+	query := fmt.Sprintf(`SELECT user_id FROM user_scores FINAL WHERE score_name = ? AND score %s ?`, compOp)
+	return query, []any{cond.Score, threshold}, nil
+}
+
+// sequenceTieSlots is how many events with the same millisecond timestamp a
+// user's sequence key orders by sequence; later ones share the last slot
+const sequenceTieSlots = 1000
+
+// sequenceEventOrder is the timestamp sequenceMatch orders a user's events by:
+// milliseconds scaled by sequenceTieSlots plus the event's rank by sequence
+// among the user's events at the same timestamp, so ties follow ingest order
+var sequenceEventOrder = fmt.Sprintf(
+	"toUInt64(toUnixTimestamp64Milli(timestamp)) * %d + least(row_number() OVER (PARTITION BY user_id, timestamp ORDER BY sequence), %d) - 1",
+	sequenceTieSlots, sequenceTieSlots)
+
+// buildSequenceConditionQuery generates a query for users who did the steps
+// of a sequence condition in order, each within the sequence window of the
+// step before it. sequenceMatch's (?t<=N) bounds the gap between consecutive
+// steps and allows other events between them.
+func (qb *QueryBuilder) buildSequenceConditionQuery(cond Condition) (string, []any, error) {
+	if len(cond.Steps) < 2 {
+		return "", nil, fmt.Errorf("sequence condition requires at least two steps, got %d", len(cond.Steps))
+	}
+	for i, step := range cond.Steps {
+		if step.EventName == "" {
+			return "", nil, fmt.Errorf("sequence step %d requires event_name", i)
+		}
+	}
+	if cond.SequenceWindow == "" {
+		return "", nil, fmt.Errorf("sequence condition requires sequence_window")
+	}
+	window, err := parseDuration(cond.SequenceWindow)
+	if err != nil {
+		return "", nil, err
+	}
+	if window < time.Second {
+		return "", nil, fmt.Errorf("sequence_window must be at least 1s, got %s", cond.SequenceWindow)
+	}
+
+	startTime, endTime, err := qb.resolveTimeWindow(cond.TimeWindow)
+	if err != nil {
+		return "", nil, err
+	}
+
+	placeholders := make([]string, len(cond.Steps))
+	var args []any
+	for i, step := range cond.Steps {
+		placeholders[i] = "?"
+		args = append(args, step.EventName)
+	}
+	events := fmt.Sprintf(`SELECT user_id, event_name, properties, %s AS event_order FROM events_raw WHERE event_name IN (%s)`,
+		sequenceEventOrder, strings.Join(placeholders, ", "))
+
+	if startTime != nil {
+		events += ` AND timestamp >= ?`
+		args = append(args, *startTime)
+	}
+	if endTime != nil {
+		events += ` AND timestamp <= ?`
+		args = append(args, *endTime)
+	}
+
+	// A gap of the whole window in milliseconds plus any difference in rank
+	maxGap := window.Milliseconds()*sequenceTieSlots + sequenceTieSlots - 1
+	pattern := make([]string, len(cond.Steps))
+	steps := make([]string, len(cond.Steps))
+	for i, step := range cond.Steps {
+		pattern[i] = fmt.Sprintf("(?%d)", i+1)
+		steps[i] = "event_name = ?"
+		args = append(args, step.EventName)
+
+		filterClause, filterArgs := qb.buildPropertyFilters(step.PropertyFilters)
+		if filterClause != "" {
+			steps[i] += " AND " + filterClause
+			args = append(args, filterArgs...)
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT user_id FROM (%s) GROUP BY user_id HAVING sequenceMatch('%s')(event_order, %s)`,
+		events, strings.Join(pattern, fmt.Sprintf("(?t<=%d)", maxGap)), strings.Join(steps, ", "))
+
+	return query, args, nil
+}
+
 // buildPropertyFilters generates WHERE clause conditions for property filters
 func (qb *QueryBuilder) buildPropertyFilters(filters []PropertyFilter) (string, []any) {
 	if len(filters) == 0 {
@@ -234,19 +843,22 @@ func (qb *QueryBuilder) buildPropertyFilters(filters []PropertyFilter) (string,
 			continue
 		}
 
-		var valueExtractor string
-		switch v := f.Value.(type) {
-		case float64:
-			valueExtractor = fmt.Sprintf("JSONExtractFloat(properties, '%s')", f.Key)
-		case int, int64:
-			valueExtractor = fmt.Sprintf("JSONExtractInt(properties, '%s')", f.Key)
-		default:
-			_ = v
-			valueExtractor = fmt.Sprintf("JSONExtractString(properties, '%s')", f.Key)
+		valueExtractor, err := propertyExtractor(f.Key, f.ValueType, f.Value)
+		if err != nil {
+			continue
+		}
+		placeholder, values, err := comparisonValue(f.Operator, f.ValueType, f.Value)
+		if err != nil {
+			continue
+		}
+
+		clause, err := guardMissingProperty(fmt.Sprintf("%s %s %s", valueExtractor, compOp, placeholder), f.Key, f.Missing)
+		if err != nil {
+			continue
 		}
 
-		clauses = append(clauses, fmt.Sprintf("%s %s ?", valueExtractor, compOp))
-		args = append(args, f.Value)
+		clauses = append(clauses, clause)
+		args = append(args, values...)
 	}
 
 	if len(clauses) == 0 {
@@ -256,6 +868,117 @@ func (qb *QueryBuilder) buildPropertyFilters(filters []PropertyFilter) (string,
 	return strings.Join(clauses, " AND "), args
 }
 
+// guardMissingProperty wraps a property filter clause with a JSONHas check
+// deciding whether events without the property match
+func guardMissingProperty(clause, key string, missing MissingProperty) (string, error) {
+	switch missing {
+	case "":
+		return clause, nil
+	case MissingPropertyExclude:
+		return fmt.Sprintf("(JSONHas(properties, '%s') AND %s)", key, clause), nil
+	case MissingPropertyInclude:
+		return fmt.Sprintf("(NOT JSONHas(properties, '%s') OR %s)", key, clause), nil
+	default:
+		return "", fmt.Errorf("unsupported missing property mode: %s", missing)
+	}
+}
+
+// propertyExtractor returns the expression extracting an event property. An
+// explicit value type selects the extractor; otherwise it's inferred from the value.
+func propertyExtractor(key string, valueType ValueType, value any) (string, error) {
+	return jsonExtractor("properties", key, valueType, value)
+}
+
+// jsonExtractor returns the expression extracting key from the JSON in column
+func jsonExtractor(column, key string, valueType ValueType, value any) (string, error) {
+	switch valueType {
+	case ValueTypeString:
+		return fmt.Sprintf("JSONExtractString(%s, '%s')", column, key), nil
+	case ValueTypeInt:
+		return fmt.Sprintf("JSONExtractInt(%s, '%s')", column, key), nil
+	case ValueTypeFloat:
+		return fmt.Sprintf("JSONExtractFloat(%s, '%s')", column, key), nil
+	case ValueTypeBool:
+		return fmt.Sprintf("JSONExtractBool(%s, '%s')", column, key), nil
+	case ValueTypeDate:
+		return fmt.Sprintf("parseDateTimeBestEffortOrNull(JSONExtractString(%s, '%s'))", column, key), nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported value type: %s", valueType)
+	}
+
+	// IN lists are extracted as the type of their first element
+	if values, ok := value.([]any); ok && len(values) > 0 {
+		value = values[0]
+	}
+	switch value.(type) {
+	case float64:
+		return fmt.Sprintf("JSONExtractFloat(%s, '%s')", column, key), nil
+	case int, int64:
+		return fmt.Sprintf("JSONExtractInt(%s, '%s')", column, key), nil
+	default:
+		return fmt.Sprintf("JSONExtractString(%s, '%s')", column, key), nil
+	}
+}
+
+// propertyValue returns the placeholder and argument comparing against a
+// property. Date values are normalized to RFC3339 and parsed by ClickHouse so
+// they order as dates rather than strings.
+func propertyValue(valueType ValueType, value any) (string, any, error) {
+	if valueType != ValueTypeDate {
+		return "?", value, nil
+	}
+
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339, v); err != nil {
+			if t, err = time.Parse(time.DateOnly, v); err != nil {
+				return "", nil, fmt.Errorf("invalid date value: %q", v)
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid date value: %v", value)
+	}
+
+	return "parseDateTimeBestEffort(?)", t.UTC().Format(time.RFC3339), nil
+}
+
+// comparisonValue returns the placeholder and arguments comparing against
+// value with op. IN and NOT IN take an array value and bind one placeholder
+// per element.
+func comparisonValue(op ComparisonOperator, valueType ValueType, value any) (string, []any, error) {
+	if op != ComparisonIN && op != ComparisonNIN {
+		placeholder, v, err := propertyValue(valueType, value)
+		if err != nil {
+			return "", nil, err
+		}
+		return placeholder, []any{v}, nil
+	}
+
+	values, ok := value.([]any)
+	if !ok {
+		return "", nil, fmt.Errorf("%s requires an array value, got %v", op, value)
+	}
+	if len(values) == 0 {
+		return "", nil, fmt.Errorf("%s requires at least one value", op)
+	}
+
+	placeholders := make([]string, len(values))
+	args := make([]any, len(values))
+	for i, v := range values {
+		placeholder, arg, err := propertyValue(valueType, v)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholders[i], args[i] = placeholder, arg
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")", args, nil
+}
+
 // resolveTimeWindow calculates the actual start and end times from a time window
 func (qb *QueryBuilder) resolveTimeWindow(tw *TimeWindow) (*time.Time, *time.Time, error) {
 	if tw == nil {
@@ -271,8 +994,15 @@ func (qb *QueryBuilder) resolveTimeWindow(tw *TimeWindow) (*time.Time, *time.Tim
 		if err != nil {
 			return nil, nil, err
 		}
-		startTime := qb.now.Add(-duration)
 		endTime := qb.now
+		if tw.Offset != "" {
+			offset, err := parseDuration(tw.Offset)
+			if err != nil {
+				return nil, nil, err
+			}
+			endTime = endTime.Add(-offset)
+		}
+		startTime := endTime.Add(-duration)
 		return &startTime, &endTime, nil
 
 	case TimeWindowAbsolute:
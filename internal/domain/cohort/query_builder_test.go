@@ -1,6 +1,9 @@
 package cohort
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -266,6 +269,26 @@ func TestBuildPropertyFilters(t *testing.T) {
 		}
 	})
 
+	t.Run("value type overrides inference", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "plan_id", Operator: ComparisonIN, Value: []any{"1", "2"}, ValueType: ValueTypeInt},
+		}
+		clause, _ := qb.buildPropertyFilters(filters)
+		if !strings.Contains(clause, "JSONExtractInt(properties, 'plan_id')") {
+			t.Errorf("clause should contain JSONExtractInt, got %q", clause)
+		}
+	})
+
+	t.Run("filter with invalid value type is skipped", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "country", Operator: ComparisonEQ, Value: "US", ValueType: ValueType("invalid")},
+		}
+		clause, _ := qb.buildPropertyFilters(filters)
+		if clause != "" {
+			t.Errorf("clause = %q, expected empty for invalid value type", clause)
+		}
+	})
+
 	t.Run("filter with invalid operator is skipped", func(t *testing.T) {
 		filters := []PropertyFilter{
 			{Key: "country", Operator: ComparisonOperator("invalid"), Value: "US"},
@@ -278,6 +301,76 @@ func TestBuildPropertyFilters(t *testing.T) {
 			t.Errorf("args = %v, expected empty", args)
 		}
 	})
+
+	t.Run("IN filter binds each value", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "quantity", Operator: ComparisonIN, Value: []any{1, 2, 3}},
+			{Key: "country", Operator: ComparisonNIN, Value: []any{"US"}},
+		}
+		clause, args := qb.buildPropertyFilters(filters)
+		expected := "JSONExtractInt(properties, 'quantity') IN (?, ?, ?) AND JSONExtractString(properties, 'country') NOT IN (?)"
+		if clause != expected {
+			t.Errorf("clause = %q, expected %q", clause, expected)
+		}
+		if !reflect.DeepEqual(args, []any{1, 2, 3, "US"}) {
+			t.Errorf("args = %v, expected [1 2 3 US]", args)
+		}
+	})
+
+	t.Run("missing property modes guard with JSONHas", func(t *testing.T) {
+		tests := []struct {
+			missing  MissingProperty
+			expected string
+		}{
+			{"", "JSONExtractString(properties, 'plan') != ?"},
+			{MissingPropertyExclude, "(JSONHas(properties, 'plan') AND JSONExtractString(properties, 'plan') != ?)"},
+			{MissingPropertyInclude, "(NOT JSONHas(properties, 'plan') OR JSONExtractString(properties, 'plan') != ?)"},
+		}
+		for _, tt := range tests {
+			filters := []PropertyFilter{
+				{Key: "plan", Operator: ComparisonNE, Value: "", Missing: tt.missing},
+			}
+			clause, args := qb.buildPropertyFilters(filters)
+			if clause != tt.expected {
+				t.Errorf("missing %q: clause = %q, expected %q", tt.missing, clause, tt.expected)
+			}
+			if !reflect.DeepEqual(args, []any{""}) {
+				t.Errorf("missing %q: args = %v, expected one empty string", tt.missing, args)
+			}
+		}
+	})
+
+	t.Run("guards apply per filter", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "amount", Operator: ComparisonGT, Value: 0.0, Missing: MissingPropertyExclude},
+			{Key: "country", Operator: ComparisonEQ, Value: "US"},
+		}
+		clause, _ := qb.buildPropertyFilters(filters)
+		expected := "(JSONHas(properties, 'amount') AND JSONExtractFloat(properties, 'amount') > ?) AND JSONExtractString(properties, 'country') = ?"
+		if clause != expected {
+			t.Errorf("clause = %q, expected %q", clause, expected)
+		}
+	})
+
+	t.Run("filter with invalid missing mode is skipped", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "plan", Operator: ComparisonEQ, Value: "pro", Missing: MissingProperty("ignore")},
+		}
+		clause, args := qb.buildPropertyFilters(filters)
+		if clause != "" || len(args) != 0 {
+			t.Errorf("clause = %q with args %v, expected the filter skipped", clause, args)
+		}
+	})
+
+	t.Run("IN filter without an array is skipped", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "country", Operator: ComparisonIN, Value: "US"},
+		}
+		clause, args := qb.buildPropertyFilters(filters)
+		if clause != "" || len(args) != 0 {
+			t.Errorf("clause = %q with args %v, expected the filter skipped", clause, args)
+		}
+	})
 }
 
 func TestBuildQuery(t *testing.T) {
@@ -342,6 +435,259 @@ func TestBuildQuery(t *testing.T) {
 	})
 }
 
+func TestBuildQuery_EvaluationOrder(t *testing.T) {
+	qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	month := &TimeWindow{Type: TimeWindowSliding, Duration: "30d"}
+
+	type kind struct {
+		name string
+		cond Condition
+		// excluded conditions are also met by users without events
+		excluded bool
+	}
+	kinds := []kind{
+		{name: "event", cond: Condition{Type: ConditionTypeEvent, EventName: "signup"}},
+		{name: "property", cond: Condition{Type: ConditionTypeProperty, PropertyName: "plan", Operator: ComparisonEQ, Value: "pro"}},
+		{name: "aggregate", cond: Condition{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonGTE, Value: float64(3)}},
+		{name: "zero aggregate", cond: Condition{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonLT, Value: float64(3)}, excluded: true},
+		{name: "growth", cond: Condition{Type: ConditionTypeGrowth, EventName: "purchase", Aggregation: AggregationSum, AggregationField: "amount", Operator: ComparisonGT, TimeWindow: month, CompareWindow: month}},
+		{name: "zero growth", cond: Condition{Type: ConditionTypeGrowth, EventName: "purchase", Aggregation: AggregationSum, AggregationField: "amount", Operator: ComparisonGTE, TimeWindow: month, CompareWindow: month}, excluded: true},
+	}
+
+	for _, a := range kinds {
+		for _, b := range kinds {
+			for _, op := range []Operator{OperatorAND, OperatorOR} {
+				t.Run(fmt.Sprintf("%s %s %s", a.name, op, b.name), func(t *testing.T) {
+					query, _, err := qb.BuildQuery(Rules{Operator: op, Conditions: []Condition{a.cond, b.cond}})
+
+					wantErr := (a.excluded && b.excluded) || (op == OperatorOR && (a.excluded || b.excluded))
+					if wantErr {
+						if !errors.Is(err, ErrUnsafeRules) {
+							t.Fatalf("BuildQuery() error = %v, expected ErrUnsafeRules", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("BuildQuery() unexpected error: %v", err)
+					}
+
+					if a.name != b.name {
+						swapped, _, err := qb.BuildQuery(Rules{Operator: op, Conditions: []Condition{b.cond, a.cond}})
+						if err != nil {
+							t.Fatalf("BuildQuery() swapped unexpected error: %v", err)
+						}
+						if swapped != query {
+							t.Errorf("query depends on condition order:\n%s\n%s", query, swapped)
+						}
+					}
+
+					excluded := 0
+					if a.excluded {
+						excluded++
+					}
+					if b.excluded {
+						excluded++
+					}
+					if count := strings.Count(query, " EXCEPT "); count != excluded {
+						t.Errorf("EXCEPT count = %d, expected %d in %q", count, excluded, query)
+					}
+					if excluded > 0 && strings.LastIndex(query, " INTERSECT ") > strings.Index(query, " EXCEPT ") {
+						t.Errorf("exclusions should be applied last, got %q", query)
+					}
+				})
+			}
+		}
+	}
+
+	sub := func(cond Condition) string {
+		query, _, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		return query
+	}
+	signup, plan, frequent, infrequent := kinds[0].cond, kinds[1].cond, kinds[2].cond, kinds[3].cond
+	fewerThanThree := infrequent
+	fewerThanThree.Operator = ComparisonGTE
+
+	tests := []struct {
+		name     string
+		rules    Rules
+		expected string
+	}{
+		{
+			name:     "events and properties come before aggregates",
+			rules:    Rules{Operator: OperatorAND, Conditions: []Condition{frequent, plan, signup}},
+			expected: sub(signup) + " INTERSECT " + sub(plan) + " INTERSECT " + sub(frequent),
+		},
+		{
+			name:     "same type keeps definition order",
+			rules:    Rules{Operator: OperatorOR, Conditions: []Condition{frequent, {Type: ConditionTypeAggregate, EventName: "refund", Aggregation: AggregationCount, Operator: ComparisonGT, Value: float64(1)}}},
+			expected: sub(frequent) + " UNION " + sub(Condition{Type: ConditionTypeAggregate, EventName: "refund", Aggregation: AggregationCount, Operator: ComparisonGT, Value: float64(1)}),
+		},
+		{
+			name:     "condition met without events excludes its negation",
+			rules:    Rules{Operator: OperatorAND, Conditions: []Condition{infrequent, signup}},
+			expected: sub(signup) + " EXCEPT " + sub(fewerThanThree),
+		},
+		{
+			name:     "exclusion applies to the whole intersection",
+			rules:    Rules{Operator: OperatorAND, Conditions: []Condition{infrequent, signup, plan}},
+			expected: "SELECT user_id FROM (" + sub(signup) + " INTERSECT " + sub(plan) + ") EXCEPT " + sub(fewerThanThree),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := qb.BuildQuery(tt.rules)
+			if err != nil {
+				t.Fatalf("BuildQuery() unexpected error: %v", err)
+			}
+			if query != tt.expected {
+				t.Errorf("query = %q, expected %q", query, tt.expected)
+			}
+		})
+	}
+
+	t.Run("exclusion args follow the kept conditions", func(t *testing.T) {
+		_, args, err := qb.BuildQuery(Rules{Operator: OperatorAND, Conditions: []Condition{infrequent, signup}})
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		expected := []any{"signup", "purchase", float64(3)}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("args = %v, expected %v", args, expected)
+		}
+	})
+}
+
+func TestBuildQuery_Negate(t *testing.T) {
+	qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	sub := func(cond Condition) string {
+		query, _, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		return query
+	}
+	signup := Condition{Type: ConditionTypeEvent, EventName: "signup"}
+	churned := Condition{Type: ConditionTypeEvent, EventName: "cancel", Negate: true}
+	cancel := Condition{Type: ConditionTypeEvent, EventName: "cancel"}
+
+	t.Run("negated conditions select users with events not satisfying them", func(t *testing.T) {
+		conds := []Condition{
+			{Type: ConditionTypeEvent, EventName: "cancel"},
+			{Type: ConditionTypeProperty, PropertyName: "plan", Operator: ComparisonEQ, Value: "pro"},
+			{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonGTE, Value: float64(3)},
+		}
+		for _, cond := range conds {
+			positive, positiveArgs, err := qb.buildConditionQuery(cond)
+			if err != nil {
+				t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+			}
+			cond.Negate = true
+			query, args, err := qb.buildConditionQuery(cond)
+			if err != nil {
+				t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+			}
+			expected := "SELECT DISTINCT user_id FROM events_raw WHERE user_id NOT IN (" + positive + ")"
+			if query != expected {
+				t.Errorf("%s query = %q, expected %q", cond.Type, query, expected)
+			}
+			if !reflect.DeepEqual(args, positiveArgs) {
+				t.Errorf("%s args = %v, expected %v", cond.Type, args, positiveArgs)
+			}
+		}
+	})
+
+	tests := []struct {
+		name     string
+		rules    Rules
+		expected string
+	}{
+		{
+			name:     "AND excepts the users satisfying the condition",
+			rules:    Rules{Operator: OperatorAND, Conditions: []Condition{churned, signup}},
+			expected: sub(signup) + " EXCEPT " + sub(cancel),
+		},
+		{
+			name:     "OR adds the users with events not satisfying the condition",
+			rules:    Rules{Operator: OperatorOR, Conditions: []Condition{signup, churned}},
+			expected: sub(signup) + " UNION " + sub(churned),
+		},
+		{
+			name:     "negation alone starts from every user with an event",
+			rules:    Rules{Operator: OperatorAND, Conditions: []Condition{churned}},
+			expected: allUsersQuery + " EXCEPT " + sub(cancel),
+		},
+		{
+			name: "negating a condition met without events inverts it",
+			rules: Rules{Operator: OperatorOR, Conditions: []Condition{
+				{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonLT, Value: float64(3), Negate: true},
+			}},
+			expected: sub(Condition{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonGTE, Value: float64(3)}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := qb.BuildQuery(tt.rules)
+			if err != nil {
+				t.Fatalf("BuildQuery() unexpected error: %v", err)
+			}
+			if query != tt.expected {
+				t.Errorf("query = %q, expected %q", query, tt.expected)
+			}
+		})
+	}
+
+	t.Run("event source replaces every events_raw read", func(t *testing.T) {
+		sourced := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		sourced.SetEventSource("events_raw SAMPLE ?", 0.5)
+
+		query, args, err := sourced.BuildQuery(Rules{Operator: OperatorOR, Conditions: []Condition{signup, churned}})
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		if count := strings.Count(query, "FROM events_raw SAMPLE ?"); count != 3 {
+			t.Errorf("sourced reads = %d, expected 3 in %q", count, query)
+		}
+		expected := []any{0.5, "signup", 0.5, 0.5, "cancel"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("args = %v, expected %v", args, expected)
+		}
+	})
+}
+
+func TestCompareZero(t *testing.T) {
+	tests := []struct {
+		op       ComparisonOperator
+		value    any
+		expected bool
+	}{
+		{op: ComparisonEQ, value: float64(0), expected: true},
+		{op: ComparisonEQ, value: float64(1), expected: false},
+		{op: ComparisonNE, value: float64(1), expected: true},
+		{op: ComparisonGT, value: float64(0), expected: false},
+		{op: ComparisonGTE, value: 0, expected: true},
+		{op: ComparisonLT, value: float64(1), expected: true},
+		{op: ComparisonLTE, value: float64(-1), expected: false},
+		{op: ComparisonIN, value: []any{float64(0), float64(1)}, expected: true},
+		{op: ComparisonNIN, value: []any{float64(0)}, expected: false},
+		{op: ComparisonNIN, value: []any{float64(5)}, expected: true},
+		{op: ComparisonLT, value: "3", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.op, tt.value), func(t *testing.T) {
+			if got := compareZero(tt.op, tt.value); got != tt.expected {
+				t.Errorf("compareZero(%s, %v) = %v, expected %v", tt.op, tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestBuildEventConditionQuery(t *testing.T) {
 	fixedTime := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
 	qb := NewQueryBuilderWithTime(fixedTime)
@@ -527,6 +873,24 @@ func TestBuildAggregateConditionQuery(t *testing.T) {
 		}
 	})
 
+	t.Run("last aggregation breaks timestamp ties by sequence", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeAggregate,
+			EventName:        "checkout",
+			Aggregation:      AggregationLast,
+			AggregationField: "cart_value",
+			Operator:         ComparisonGT,
+			Value:            100,
+		}
+		query, _, err := qb.buildAggregateConditionQuery(cond)
+		if err != nil {
+			t.Errorf("buildAggregateConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "argMax(JSONExtractFloat(properties, 'cart_value'), (timestamp, sequence))") {
+			t.Errorf("query should order events by timestamp then sequence, got %q", query)
+		}
+	})
+
 	t.Run("sum without aggregation_field returns error", func(t *testing.T) {
 		cond := Condition{
 			Type:        ConditionTypeAggregate,
@@ -554,6 +918,83 @@ func TestBuildAggregateConditionQuery(t *testing.T) {
 			t.Error("buildAggregateConditionQuery() expected error for unsupported aggregation")
 		}
 	})
+	t.Run("dedup count uses distinct event ids", func(t *testing.T) {
+		cond := Condition{
+			Type:        ConditionTypeAggregate,
+			EventName:   "purchase",
+			Aggregation: AggregationCount,
+			Operator:    ComparisonGTE,
+			Value:       5,
+			DedupEvents: true,
+		}
+		query, _, err := qb.buildAggregateConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildAggregateConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "HAVING count(DISTINCT id) >= ?") {
+			t.Errorf("query should contain count(DISTINCT id), got %q", query)
+		}
+		if strings.Contains(query, "count()") {
+			t.Errorf("query should not contain count(), got %q", query)
+		}
+	})
+
+	t.Run("dedup sum sums each event id once", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeAggregate,
+			EventName:        "purchase",
+			Aggregation:      AggregationSum,
+			AggregationField: "amount",
+			Operator:         ComparisonGTE,
+			Value:            1000,
+			DedupEvents:      true,
+		}
+		query, _, err := qb.buildAggregateConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildAggregateConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "arraySum(arrayMap(x -> x.2, groupUniqArray((id, JSONExtractFloat(properties, 'amount')))))") {
+			t.Errorf("query should sum deduplicated values, got %q", query)
+		}
+	})
+
+	t.Run("dedup leaves max unchanged", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeAggregate,
+			EventName:        "purchase",
+			Aggregation:      AggregationMax,
+			AggregationField: "amount",
+			Operator:         ComparisonGTE,
+			Value:            100,
+			DedupEvents:      true,
+		}
+		query, _, err := qb.buildAggregateConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildAggregateConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "max(JSONExtractFloat(properties, 'amount'))") {
+			t.Errorf("query should contain max function, got %q", query)
+		}
+	})
+
+	t.Run("dedup growth counts distinct event ids per window", func(t *testing.T) {
+		cond := Condition{
+			Type:          ConditionTypeGrowth,
+			EventName:     "purchase",
+			Aggregation:   AggregationCount,
+			Operator:      ComparisonGT,
+			TimeWindow:    &TimeWindow{Type: TimeWindowSliding, Duration: "7d"},
+			CompareWindow: &TimeWindow{Type: TimeWindowSliding, Duration: "7d", Offset: "7d"},
+			DedupEvents:   true,
+		}
+		query, _, err := qb.buildGrowthConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildGrowthConditionQuery() unexpected error: %v", err)
+		}
+		if strings.Count(query, "uniqExactIf(id, ") != 2 || strings.Contains(query, "countIf") {
+			t.Errorf("query should count distinct ids in both windows, got %q", query)
+		}
+	})
 }
 
 func TestBuildConditionQuery(t *testing.T) {
@@ -725,4 +1166,772 @@ func TestBuildPropertyConditionQuery(t *testing.T) {
 			t.Errorf("args length = %d, expected 3", len(args))
 		}
 	})
+
+	t.Run("value type overrides inference", func(t *testing.T) {
+		tests := []struct {
+			valueType ValueType
+			value     any
+			expected  string
+		}{
+			{ValueTypeString, 42.0, "JSONExtractString(properties, 'code')"},
+			{ValueTypeInt, "42", "JSONExtractInt(properties, 'code')"},
+			{ValueTypeFloat, []any{1.0, 2.0}, "JSONExtractFloat(properties, 'code')"},
+			{ValueTypeBool, true, "JSONExtractBool(properties, 'code')"},
+		}
+
+		for _, tt := range tests {
+			t.Run(string(tt.valueType), func(t *testing.T) {
+				cond := Condition{
+					Type:         ConditionTypeProperty,
+					PropertyName: "code",
+					Operator:     ComparisonEQ,
+					Value:        tt.value,
+					ValueType:    tt.valueType,
+				}
+				query, _, err := qb.buildPropertyConditionQuery(cond)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !strings.Contains(query, tt.expected+" = ?") {
+					t.Errorf("query should contain %s, got %q", tt.expected, query)
+				}
+			})
+		}
+	})
+
+	t.Run("date value is parsed on both sides", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeProperty,
+			PropertyName: "signup_date",
+			Operator:     ComparisonGTE,
+			Value:        "2024-01-15",
+			ValueType:    ValueTypeDate,
+		}
+		query, args, err := qb.buildPropertyConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "parseDateTimeBestEffortOrNull(JSONExtractString(properties, 'signup_date')) >= parseDateTimeBestEffort(?)"
+		if !strings.Contains(query, expected) {
+			t.Errorf("query should contain %s, got %q", expected, query)
+		}
+		if len(args) != 1 || args[0] != "2024-01-15T00:00:00Z" {
+			t.Errorf("args = %v, expected [2024-01-15T00:00:00Z]", args)
+		}
+	})
+
+	t.Run("date filter normalizes to RFC3339", func(t *testing.T) {
+		filters := []PropertyFilter{
+			{Key: "renewal", Operator: ComparisonLT, Value: "2024-06-01T12:00:00+02:00", ValueType: ValueTypeDate},
+		}
+		clause, args := qb.buildPropertyFilters(filters)
+		if !strings.Contains(clause, "parseDateTimeBestEffortOrNull(JSONExtractString(properties, 'renewal')) < parseDateTimeBestEffort(?)") {
+			t.Errorf("clause should parse dates, got %q", clause)
+		}
+		if len(args) != 1 || args[0] != "2024-06-01T10:00:00Z" {
+			t.Errorf("args = %v, expected [2024-06-01T10:00:00Z]", args)
+		}
+	})
+
+	t.Run("unparseable date returns error", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeProperty,
+			PropertyName: "signup_date",
+			Operator:     ComparisonGT,
+			Value:        "last tuesday",
+			ValueType:    ValueTypeDate,
+		}
+		_, _, err := qb.buildPropertyConditionQuery(cond)
+		if err == nil {
+			t.Error("expected error for unparseable date")
+		}
+	})
+
+	t.Run("unsupported value type returns error", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeProperty,
+			PropertyName: "code",
+			Operator:     ComparisonEQ,
+			Value:        "x",
+			ValueType:    ValueType("uuid"),
+		}
+		_, _, err := qb.buildPropertyConditionQuery(cond)
+		if err == nil {
+			t.Error("expected error for unsupported value type")
+		}
+	})
+
+	t.Run("IN with string array", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeProperty,
+			PropertyName: "country",
+			Operator:     ComparisonIN,
+			Value:        []any{"US", "CA", "MX"},
+		}
+		query, args, err := qb.buildPropertyConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildPropertyConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "JSONExtractString(properties, 'country') IN (?, ?, ?)") {
+			t.Errorf("query should bind one placeholder per value, got %q", query)
+		}
+		if !reflect.DeepEqual(args, []any{"US", "CA", "MX"}) {
+			t.Errorf("args = %v, expected [US CA MX]", args)
+		}
+	})
+
+	t.Run("NOT IN with numeric array", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeProperty,
+			PropertyName: "plan_tier",
+			EventName:    "subscription",
+			Operator:     ComparisonNIN,
+			Value:        []any{1.0, 2.0},
+		}
+		query, args, err := qb.buildPropertyConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildPropertyConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "JSONExtractFloat(properties, 'plan_tier') NOT IN (?, ?)") {
+			t.Errorf("query should bind one placeholder per value, got %q", query)
+		}
+		if !reflect.DeepEqual(args, []any{1.0, 2.0, "subscription"}) {
+			t.Errorf("args = %v, expected [1 2 subscription]", args)
+		}
+	})
+
+	t.Run("IN without an array returns error", func(t *testing.T) {
+		for _, value := range []any{"US", []any{}} {
+			cond := Condition{
+				Type:         ConditionTypeProperty,
+				PropertyName: "country",
+				Operator:     ComparisonIN,
+				Value:        value,
+			}
+			if _, _, err := qb.buildPropertyConditionQuery(cond); err == nil {
+				t.Errorf("expected error for IN value %v", value)
+			}
+		}
+	})
+}
+
+func TestBuildGrowthConditionQuery(t *testing.T) {
+	now := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	qb := NewQueryBuilderWithTime(now)
+
+	thisMonth := &TimeWindow{Type: TimeWindowSliding, Duration: "30d"}
+	lastMonth := &TimeWindow{Type: TimeWindowSliding, Duration: "30d", Offset: "30d"}
+
+	t.Run("sum comparison uses sumIf per window", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeGrowth,
+			EventName:        "purchase",
+			Aggregation:      AggregationSum,
+			AggregationField: "amount",
+			Operator:         ComparisonGT,
+			TimeWindow:       thisMonth,
+			CompareWindow:    lastMonth,
+		}
+		query, args, err := qb.buildGrowthConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildGrowthConditionQuery() unexpected error: %v", err)
+		}
+
+		expectedHaving := "HAVING sumIf(JSONExtractFloat(properties, 'amount'), timestamp >= ? AND timestamp <= ?) > " +
+			"sumIf(JSONExtractFloat(properties, 'amount'), timestamp >= ? AND timestamp <= ?)"
+		if !strings.Contains(query, expectedHaving) {
+			t.Errorf("query should contain %q, got %q", expectedHaving, query)
+		}
+		if !strings.Contains(query, "GROUP BY user_id") {
+			t.Errorf("query should contain GROUP BY user_id, got %q", query)
+		}
+
+		startA, endA := now.Add(-30*24*time.Hour), now
+		startB, endB := now.Add(-60*24*time.Hour), now.Add(-30*24*time.Hour)
+		expectedArgs := []any{"purchase", startA, endA, startB, endB, startA, endA, startB, endB}
+		if len(args) != len(expectedArgs) {
+			t.Fatalf("args length = %d, expected %d", len(args), len(expectedArgs))
+		}
+		for i := range expectedArgs {
+			if args[i] != expectedArgs[i] {
+				t.Errorf("args[%d] = %v, expected %v", i, args[i], expectedArgs[i])
+			}
+		}
+	})
+
+	t.Run("count comparison uses countIf", func(t *testing.T) {
+		cond := Condition{
+			Type:          ConditionTypeGrowth,
+			EventName:     "login",
+			Aggregation:   AggregationCount,
+			Operator:      ComparisonLT,
+			TimeWindow:    thisMonth,
+			CompareWindow: lastMonth,
+		}
+		query, _, err := qb.buildGrowthConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildGrowthConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "countIf(timestamp >= ? AND timestamp <= ?) < countIf(") {
+			t.Errorf("query should compare countIf aggregates, got %q", query)
+		}
+	})
+
+	t.Run("property filters are applied", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeGrowth,
+			EventName:        "purchase",
+			Aggregation:      AggregationSum,
+			AggregationField: "amount",
+			Operator:         ComparisonGT,
+			TimeWindow:       thisMonth,
+			CompareWindow:    lastMonth,
+			PropertyFilters:  []PropertyFilter{{Key: "currency", Operator: ComparisonEQ, Value: "USD"}},
+		}
+		query, args, err := qb.buildGrowthConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildGrowthConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "JSONExtractString(properties, 'currency') = ?") {
+			t.Errorf("query should contain property filter, got %q", query)
+		}
+		if args[5] != "USD" {
+			t.Errorf("args[5] = %v, expected USD", args[5])
+		}
+	})
+
+	t.Run("missing compare window", func(t *testing.T) {
+		cond := Condition{
+			Type:        ConditionTypeGrowth,
+			EventName:   "purchase",
+			Aggregation: AggregationCount,
+			Operator:    ComparisonGT,
+			TimeWindow:  thisMonth,
+		}
+		if _, _, err := qb.buildGrowthConditionQuery(cond); err == nil {
+			t.Error("buildGrowthConditionQuery() expected error for missing compare_window")
+		}
+	})
+
+	t.Run("missing aggregation field", func(t *testing.T) {
+		cond := Condition{
+			Type:          ConditionTypeGrowth,
+			EventName:     "purchase",
+			Aggregation:   AggregationSum,
+			Operator:      ComparisonGT,
+			TimeWindow:    thisMonth,
+			CompareWindow: lastMonth,
+		}
+		if _, _, err := qb.buildGrowthConditionQuery(cond); err == nil {
+			t.Error("buildGrowthConditionQuery() expected error for missing aggregation_field")
+		}
+	})
+}
+
+func TestQueryBuilder_SetEventSource(t *testing.T) {
+	qb := NewQueryBuilder()
+	qb.SetEventSource("(SELECT * FROM events_raw WHERE user_id = ?)", "user-1")
+
+	rules := Rules{
+		Operator: OperatorAND,
+		Conditions: []Condition{
+			{Type: ConditionTypeEvent, EventName: "purchase"},
+			{Type: ConditionTypeEvent, EventName: "signup"},
+		},
+	}
+
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		t.Fatalf("BuildQuery() unexpected error: %v", err)
+	}
+	if count := strings.Count(query, "FROM (SELECT * FROM events_raw WHERE user_id = ?)"); count != 2 {
+		t.Errorf("source count = %d, expected 2 in %q", count, query)
+	}
+
+	expected := []any{"user-1", "purchase", "user-1", "signup"}
+	if len(args) != len(expected) {
+		t.Fatalf("args = %v, expected %v", args, expected)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("args[%d] = %v, expected %v", i, args[i], expected[i])
+		}
+	}
+}
+
+func TestQueryBuilder_SetAggregateFunctions(t *testing.T) {
+	now := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	funcs, err := ParseAggregateFunctions(map[string]string{"distinct_count": "uniq"})
+	if err != nil {
+		t.Fatalf("ParseAggregateFunctions() unexpected error: %v", err)
+	}
+
+	qb := NewQueryBuilderWithTime(now)
+	qb.SetAggregateFunctions(funcs)
+
+	t.Run("aggregate condition", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeAggregate,
+			EventName:        "page_view",
+			Aggregation:      AggregationDistinctCount,
+			AggregationField: "page",
+			Operator:         ComparisonGTE,
+			Value:            3,
+		}
+		query, _, err := qb.buildAggregateConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildAggregateConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "uniq(JSONExtractString(properties, 'page'))") || strings.Contains(query, "uniqExact") {
+			t.Errorf("query should use the overridden uniq function, got %q", query)
+		}
+	})
+
+	t.Run("growth condition", func(t *testing.T) {
+		cond := Condition{
+			Type:             ConditionTypeGrowth,
+			EventName:        "page_view",
+			Aggregation:      AggregationDistinctCount,
+			AggregationField: "page",
+			Operator:         ComparisonGT,
+			TimeWindow:       &TimeWindow{Type: TimeWindowSliding, Duration: "30d"},
+			CompareWindow:    &TimeWindow{Type: TimeWindowSliding, Duration: "30d", Offset: "30d"},
+		}
+		query, _, err := qb.buildGrowthConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildGrowthConditionQuery() unexpected error: %v", err)
+		}
+		if strings.Count(query, "uniqIf(JSONExtractString(properties, 'page'), ") != 2 || strings.Contains(query, "uniqExact") {
+			t.Errorf("query should use the overridden uniqIf function, got %q", query)
+		}
+	})
+
+	t.Run("invalid overrides", func(t *testing.T) {
+		for _, overrides := range []map[string]string{
+			{"distinct_count": "count"},
+			{"sum": "uniq"},
+		} {
+			if _, err := ParseAggregateFunctions(overrides); err == nil {
+				t.Errorf("ParseAggregateFunctions(%v) expected error", overrides)
+			}
+		}
+	})
+}
+
+func TestBuildUserAttributeConditionQuery(t *testing.T) {
+	qb := NewQueryBuilder()
+
+	t.Run("queries the attribute table", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeUserAttribute,
+			PropertyName: "plan",
+			Operator:     ComparisonEQ,
+			Value:        "enterprise",
+		}
+		query, args, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		expected := "SELECT user_id FROM user_attributes FINAL WHERE JSONExtractString(attributes, 'plan') = ?"
+		if query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		if strings.Contains(query, "events_raw") {
+			t.Errorf("query should not read events, got %q", query)
+		}
+		if !reflect.DeepEqual(args, []any{"enterprise"}) {
+			t.Errorf("args = %v, expected [enterprise]", args)
+		}
+	})
+
+	t.Run("date attribute", func(t *testing.T) {
+		cond := Condition{
+			Type:         ConditionTypeUserAttribute,
+			PropertyName: "signup_date",
+			Operator:     ComparisonGTE,
+			Value:        "2024-01-01",
+			ValueType:    ValueTypeDate,
+		}
+		query, args, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, "parseDateTimeBestEffortOrNull(JSONExtractString(attributes, 'signup_date')) >= parseDateTimeBestEffort(?)") {
+			t.Errorf("query should compare the attribute as a date, got %q", query)
+		}
+		if !reflect.DeepEqual(args, []any{"2024-01-01T00:00:00Z"}) {
+			t.Errorf("args = %v, expected [2024-01-01T00:00:00Z]", args)
+		}
+	})
+
+	t.Run("requires an attribute name", func(t *testing.T) {
+		cond := Condition{Type: ConditionTypeUserAttribute, Operator: ComparisonEQ, Value: "pro"}
+		if _, _, err := qb.buildConditionQuery(cond); err == nil {
+			t.Error("buildConditionQuery() expected error for missing property_name")
+		}
+	})
+
+	t.Run("combined with event conditions", func(t *testing.T) {
+		qb := NewQueryBuilder()
+		qb.SetEventSource("(SELECT * FROM events_raw WHERE user_id = ?)", "user-1")
+
+		rules := Rules{
+			Operator: OperatorAND,
+			Conditions: []Condition{
+				{Type: ConditionTypeUserAttribute, PropertyName: "plan", Operator: ComparisonEQ, Value: "pro"},
+				{Type: ConditionTypeEvent, EventName: "purchase"},
+			},
+		}
+		query, args, err := qb.BuildQuery(rules)
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, " INTERSECT SELECT user_id FROM user_attributes FINAL") {
+			t.Errorf("attribute subquery should follow the event subquery, got %q", query)
+		}
+		expected := []any{"user-1", "purchase", "pro"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("args = %v, expected %v", args, expected)
+		}
+	})
+}
+
+func TestBuildScoreConditionQuery(t *testing.T) {
+	qb := NewQueryBuilder()
+
+	t.Run("compares against a threshold", func(t *testing.T) {
+		cond := Condition{Type: ConditionTypeScore, Score: "rfm", Operator: ComparisonGTE, Value: float64(8)}
+		query, args, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		expected := "SELECT user_id FROM user_scores FINAL WHERE score_name = ? AND score >= ?"
+		if query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		if !reflect.DeepEqual(args, []any{"rfm", float64(8)}) {
+			t.Errorf("args = %v, expected [rfm 8]", args)
+		}
+	})
+
+	t.Run("rejects invalid conditions", func(t *testing.T) {
+		for name, cond := range map[string]Condition{
+			"missing score":     {Type: ConditionTypeScore, Operator: ComparisonGTE, Value: float64(8)},
+			"non-numeric value": {Type: ConditionTypeScore, Score: "rfm", Operator: ComparisonGTE, Value: "high"},
+			"in operator":       {Type: ConditionTypeScore, Score: "rfm", Operator: ComparisonIN, Value: []any{float64(8)}},
+		} {
+			if _, _, err := qb.buildConditionQuery(cond); err == nil {
+				t.Errorf("%s: buildConditionQuery() expected error", name)
+			}
+		}
+	})
+
+	t.Run("combined with event conditions", func(t *testing.T) {
+		qb := NewQueryBuilder()
+		qb.SetEventSource("(SELECT * FROM events_raw WHERE user_id = ?)", "user-1")
+
+		rules := Rules{
+			Operator: OperatorAND,
+			Conditions: []Condition{
+				{Type: ConditionTypeScore, Score: "rfm", Operator: ComparisonGTE, Value: float64(8)},
+				{Type: ConditionTypeEvent, EventName: "purchase"},
+			},
+		}
+		query, args, err := qb.BuildQuery(rules)
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		if !strings.Contains(query, " INTERSECT SELECT user_id FROM user_scores FINAL") {
+			t.Errorf("score subquery should follow the event subquery, got %q", query)
+		}
+		expected := []any{"user-1", "purchase", "rfm", float64(8)}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("args = %v, expected %v", args, expected)
+		}
+	})
+}
+
+func TestBuildQuery_DefaultTimeWindow(t *testing.T) {
+	fixedTime := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	qb := NewQueryBuilderWithTime(fixedTime)
+
+	week := fixedTime.Add(-7 * 24 * time.Hour)
+	day := fixedTime.Add(-24 * time.Hour)
+
+	rules := Rules{
+		Operator: OperatorAND,
+		Conditions: []Condition{
+			{Type: ConditionTypeEvent, EventName: "login"},
+			{
+				Type:       ConditionTypeEvent,
+				EventName:  "purchase",
+				TimeWindow: &TimeWindow{Type: TimeWindowSliding, Duration: "1d"},
+			},
+			{Type: ConditionTypeUserAttribute, PropertyName: "plan", Operator: ComparisonEQ, Value: "pro"},
+		},
+		DefaultTimeWindow: &TimeWindow{Type: TimeWindowSliding, Duration: "7d"},
+	}
+
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		t.Fatalf("BuildQuery() unexpected error: %v", err)
+	}
+
+	t.Run("conditions without a window inherit the default", func(t *testing.T) {
+		if !reflect.DeepEqual(args[:3], []any{"login", week, fixedTime}) {
+			t.Errorf("login args = %v, expected the 7d default window", args[:3])
+		}
+	})
+
+	t.Run("explicit windows take precedence", func(t *testing.T) {
+		if !reflect.DeepEqual(args[3:6], []any{"purchase", day, fixedTime}) {
+			t.Errorf("purchase args = %v, expected its own 1d window", args[3:6])
+		}
+	})
+
+	t.Run("conditions that take no window are unchanged", func(t *testing.T) {
+		if !strings.HasSuffix(query, "SELECT user_id FROM user_attributes FINAL WHERE JSONExtractString(attributes, 'plan') = ?") {
+			t.Errorf("attribute subquery should have no window, got %q", query)
+		}
+		if !reflect.DeepEqual(args[6:], []any{"pro"}) {
+			t.Errorf("attribute args = %v, expected [pro]", args[6:])
+		}
+	})
+
+	t.Run("rules are not modified", func(t *testing.T) {
+		if rules.Conditions[0].TimeWindow != nil {
+			t.Errorf("TimeWindow = %+v, expected the caller's rules to be left as is", rules.Conditions[0].TimeWindow)
+		}
+	})
+
+	t.Run("without a default the query is unbounded", func(t *testing.T) {
+		rules := Rules{Operator: OperatorAND, Conditions: []Condition{{Type: ConditionTypeEvent, EventName: "login"}}}
+		_, args, err := qb.BuildQuery(rules)
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(args, []any{"login"}) {
+			t.Errorf("args = %v, expected [login]", args)
+		}
+	})
+}
+
+func TestBuildQuery_NestedGroups(t *testing.T) {
+	qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	sub := func(cond Condition) string {
+		query, _, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		return query
+	}
+	signup := Condition{Type: ConditionTypeEvent, EventName: "signup"}
+	purchase := Condition{Type: ConditionTypeEvent, EventName: "purchase"}
+	upgrade := Condition{Type: ConditionTypeEvent, EventName: "upgrade"}
+
+	t.Run("(A AND B) OR C nests the INTERSECT inside the UNION", func(t *testing.T) {
+		rules := Rules{
+			Operator:   OperatorOR,
+			Conditions: []Condition{upgrade},
+			Groups:     []RuleGroup{{Operator: OperatorAND, Conditions: []Condition{signup, purchase}}},
+		}
+
+		query, args, err := qb.BuildQuery(rules)
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		expected := sub(upgrade) + " UNION SELECT user_id FROM (" + sub(signup) + " INTERSECT " + sub(purchase) + ")"
+		if query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		union := strings.Index(query, " UNION ")
+		intersect := strings.Index(query, " INTERSECT ")
+		if union < 0 || intersect < union || !strings.HasSuffix(query, ")") {
+			t.Errorf("query = %q, expected the INTERSECT inside a subquery of the UNION", query)
+		}
+		if expectedArgs := []any{"upgrade", "signup", "purchase"}; !reflect.DeepEqual(args, expectedArgs) {
+			t.Errorf("args = %v, expected %v", args, expectedArgs)
+		}
+	})
+
+	t.Run("groups nest more than one level", func(t *testing.T) {
+		rules := Rules{
+			Operator: OperatorAND,
+			Groups: []RuleGroup{{
+				Operator:   OperatorOR,
+				Conditions: []Condition{upgrade},
+				Groups:     []RuleGroup{{Operator: OperatorAND, Conditions: []Condition{signup, purchase}}},
+			}},
+			DefaultTimeWindow: &TimeWindow{Type: TimeWindowSliding, Duration: "7d"},
+		}
+
+		query, _, err := qb.BuildQuery(rules)
+		if err != nil {
+			t.Fatalf("BuildQuery() unexpected error: %v", err)
+		}
+		resolved := rules.ResolveTimeWindows().Groups[0]
+		inner := "SELECT user_id FROM (" + sub(resolved.Groups[0].Conditions[0]) + " INTERSECT " + sub(resolved.Groups[0].Conditions[1]) + ")"
+		expected := "SELECT user_id FROM (" + sub(resolved.Conditions[0]) + " UNION " + inner + ")"
+		if query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		if !strings.Contains(query, "timestamp >= ?") {
+			t.Errorf("query = %q, expected nested conditions to inherit the default time window", query)
+		}
+	})
+
+	t.Run("unsafe conditions are rejected inside groups", func(t *testing.T) {
+		rules := Rules{
+			Operator:   OperatorAND,
+			Conditions: []Condition{signup},
+			Groups: []RuleGroup{{Operator: OperatorOR, Conditions: []Condition{
+				upgrade,
+				{Type: ConditionTypeAggregate, EventName: "purchase", Aggregation: AggregationCount, Operator: ComparisonLT, Value: float64(3)},
+			}}},
+		}
+		if _, _, err := qb.BuildQuery(rules); !errors.Is(err, ErrUnsafeRules) {
+			t.Errorf("BuildQuery() error = %v, expected %v", err, ErrUnsafeRules)
+		}
+	})
+
+	t.Run("empty groups are rejected", func(t *testing.T) {
+		rules := Rules{Operator: OperatorAND, Conditions: []Condition{signup}, Groups: []RuleGroup{{Operator: OperatorOR}}}
+		if _, _, err := qb.BuildQuery(rules); err == nil {
+			t.Error("BuildQuery() expected error for an empty group")
+		}
+	})
+}
+
+func TestBuildSequenceConditionQuery(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	qb := NewQueryBuilderWithTime(now)
+
+	t.Run("matches users completing each step within the window of the last", func(t *testing.T) {
+		cond := Condition{
+			Type: ConditionTypeSequence,
+			Steps: []SequenceStep{
+				{EventName: "signup"},
+				{EventName: "trial"},
+				{EventName: "purchase", PropertyFilters: []PropertyFilter{{Key: "plan", Operator: ComparisonEQ, Value: "pro"}}},
+			},
+			SequenceWindow: "7d",
+			TimeWindow:     &TimeWindow{Type: TimeWindowSliding, Duration: "30d"},
+		}
+		query, args, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		expected := "SELECT user_id FROM (SELECT user_id, event_name, properties, " +
+			"toUInt64(toUnixTimestamp64Milli(timestamp)) * 1000 + least(row_number() OVER (PARTITION BY user_id, timestamp ORDER BY sequence), 1000) - 1 AS event_order" +
+			" FROM events_raw WHERE event_name IN (?, ?, ?) AND timestamp >= ? AND timestamp <= ?)" +
+			" GROUP BY user_id HAVING sequenceMatch('(?1)(?t<=604800000999)(?2)(?t<=604800000999)(?3)')" +
+			"(event_order, event_name = ?, event_name = ?, event_name = ? AND JSONExtractString(properties, 'plan') = ?)"
+		if query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		expectedArgs := []any{"signup", "trial", "purchase", now.Add(-30 * 24 * time.Hour), now, "signup", "trial", "purchase", "pro"}
+		if !reflect.DeepEqual(args, expectedArgs) {
+			t.Errorf("args = %v, expected %v", args, expectedArgs)
+		}
+	})
+
+	t.Run("rejects invalid conditions", func(t *testing.T) {
+		for name, cond := range map[string]Condition{
+			"one step":          {Type: ConditionTypeSequence, Steps: []SequenceStep{{EventName: "signup"}}, SequenceWindow: "7d"},
+			"unnamed step":      {Type: ConditionTypeSequence, Steps: []SequenceStep{{EventName: "signup"}, {}}, SequenceWindow: "7d"},
+			"missing window":    {Type: ConditionTypeSequence, Steps: []SequenceStep{{EventName: "signup"}, {EventName: "purchase"}}},
+			"sub-second window": {Type: ConditionTypeSequence, Steps: []SequenceStep{{EventName: "signup"}, {EventName: "purchase"}}, SequenceWindow: "10ms"},
+		} {
+			if _, _, err := qb.buildConditionQuery(cond); err == nil {
+				t.Errorf("%s: buildConditionQuery() expected error", name)
+			}
+		}
+	})
+}
+
+func TestBuildQuery_ExcludeUserIDs(t *testing.T) {
+	qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	sub := func(cond Condition) string {
+		query, _, err := qb.buildConditionQuery(cond)
+		if err != nil {
+			t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+		}
+		return query
+	}
+	signup := Condition{Type: ConditionTypeEvent, EventName: "signup"}
+	purchase := Condition{Type: ConditionTypeEvent, EventName: "purchase"}
+
+	rules := Rules{
+		Operator:       OperatorOR,
+		Conditions:     []Condition{signup, purchase},
+		ExcludeUserIDs: []string{"qa-1", "internal-2"},
+	}
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		t.Fatalf("BuildQuery() unexpected error: %v", err)
+	}
+
+	expected := "SELECT user_id FROM (" + sub(signup) + " UNION " + sub(purchase) + ") WHERE user_id NOT IN (?, ?)"
+	if query != expected {
+		t.Errorf("query = %q, expected the exclusion applied to the combined result %q", query, expected)
+	}
+	if expectedArgs := []any{"signup", "purchase", "qa-1", "internal-2"}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("args = %v, expected %v", args, expectedArgs)
+	}
+
+	if propertyOnly(Rules{
+		Operator:       OperatorAND,
+		Conditions:     []Condition{{Type: ConditionTypeProperty, PropertyName: "plan", Operator: ComparisonEQ, Value: "pro"}},
+		ExcludeUserIDs: []string{"qa-1"},
+	}) {
+		t.Error("propertyOnly() = true, expected rules excluding users to skip the fast path")
+	}
+
+	limits := RuleLimits{MaxExcludedUserIDs: 1}
+	if err := rules.Validate(limits); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("Validate() error = %v, expected %v for too many excluded users", err, ErrInvalidRules)
+	}
+	rules.ExcludeUserIDs = rules.ExcludeUserIDs[:1]
+	if err := rules.Validate(limits); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+}
+
+func TestBuildIncrementalQuery(t *testing.T) {
+	qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	since := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+
+	purchase := Condition{Type: ConditionTypeEvent, EventName: "purchase"}
+	full, _, err := qb.buildConditionQuery(purchase)
+	if err != nil {
+		t.Fatalf("buildConditionQuery() unexpected error: %v", err)
+	}
+
+	query, args, err := qb.BuildIncrementalQuery(Rules{Operator: OperatorAND, Conditions: []Condition{purchase}}, since)
+	if err != nil {
+		t.Fatalf("BuildIncrementalQuery() unexpected error: %v", err)
+	}
+
+	expected := "SELECT user_id FROM (" + full + ") WHERE user_id IN (SELECT DISTINCT user_id FROM events_raw WHERE timestamp >= ?)"
+	if query != expected {
+		t.Errorf("query = %q, expected %q", query, expected)
+	}
+	if expectedArgs := []any{"purchase", since}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("args = %v, expected %v", args, expectedArgs)
+	}
+
+	t.Run("event source applies to the affected users", func(t *testing.T) {
+		qb := NewQueryBuilderWithTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		qb.SetEventSource("events_raw SAMPLE 0.1")
+
+		query, args := qb.BuildAffectedUsersQuery(since)
+		if expected := "SELECT DISTINCT user_id FROM events_raw SAMPLE 0.1 WHERE timestamp >= ?"; query != expected {
+			t.Errorf("query = %q, expected %q", query, expected)
+		}
+		if expectedArgs := []any{since}; !reflect.DeepEqual(args, expectedArgs) {
+			t.Errorf("args = %v, expected %v", args, expectedArgs)
+		}
+	})
 }
@@ -16,6 +16,28 @@ const (
 	RecomputeStatusFailed    RecomputeStatus = "failed"
 )
 
+// RecomputePriority determines the order in which queued recompute jobs run
+type RecomputePriority string
+
+const (
+	// RecomputePriorityHigh is used for manually triggered recomputes
+	RecomputePriorityHigh RecomputePriority = "high"
+	// RecomputePriorityLow is used for scheduled and bulk recomputes
+	RecomputePriorityLow RecomputePriority = "low"
+)
+
+// ChangeReason records which write path produced a membership change
+type ChangeReason string
+
+const (
+	ChangeReasonRecompute  ChangeReason = "recompute"
+	ChangeReasonEvent      ChangeReason = "event"
+	ChangeReasonRuleChange ChangeReason = "rule_change"
+	ChangeReasonMerge      ChangeReason = "merge"
+	ChangeReasonManual     ChangeReason = "manual"
+	ChangeReasonExpired    ChangeReason = "expired"
+)
+
 // RecomputeProgress tracks the progress of a recompute job
 type RecomputeProgress struct {
 	TotalUsers     int64 `json:"total_users"`
@@ -23,6 +45,15 @@ type RecomputeProgress struct {
 	MembersFound   int64 `json:"members_found"`
 	MembersAdded   int64 `json:"members_added"`
 	MembersRemoved int64 `json:"members_removed"`
+	// BatchesSent counts membership and changelog batches written so far, so a
+	// failed job shows how much of its diff was applied
+	BatchesSent int64 `json:"batches_sent"`
+	// MembersDeferred counts joins and leaves held back by hysteresis until
+	// more consecutive recomputes find them
+	MembersDeferred int64 `json:"members_deferred"`
+	// Since is the start of the events an incremental recompute evaluated;
+	// only users with events from then on were re-evaluated
+	Since *time.Time `json:"since,omitempty"`
 }
 
 // RecomputeJob represents a cohort membership recompute job
@@ -30,23 +61,59 @@ type RecomputeJob struct {
 	ID          uuid.UUID         `json:"id"`
 	CohortID    uuid.UUID         `json:"cohort_id"`
 	Status      RecomputeStatus   `json:"status"`
+	Priority    RecomputePriority `json:"priority"`
+	Reason      ChangeReason      `json:"reason"`
 	Progress    RecomputeProgress `json:"progress"`
 	StartedAt   time.Time         `json:"started_at"`
 	CompletedAt *time.Time        `json:"completed_at,omitempty"`
 	Error       string            `json:"error,omitempty"`
+	// IgnoreOverrides lets the job revert manual membership overrides, which
+	// are then cleared
+	IgnoreOverrides bool `json:"ignore_overrides,omitempty"`
+	// CohortVersion is the version of the cohort the job computed membership
+	// for
+	CohortVersion int64 `json:"cohort_version,omitempty"`
+	// SQL is the generated membership query, recorded only when SQL debugging
+	// is enabled with AttachToJob
+	SQL *QueryTrace `json:"sql,omitempty"`
+
+	// variants are the cohort's experiment variants, assigned to the users
+	// the job writes
+	variants []Variant
+}
+
+// QueryTrace is a generated query and its bound args as logged for debugging
+type QueryTrace struct {
+	Query string   `json:"query"`
+	Args  []string `json:"args"`
 }
 
-// NewRecomputeJob creates a new recompute job for a cohort
+// variant returns the experiment variant the job writes for a user
+func (j *RecomputeJob) variant(userID string) string {
+	return AssignVariant(j.CohortID, userID, j.variants)
+}
+
+// NewRecomputeJob creates a new high priority recompute job for a cohort
 func NewRecomputeJob(cohortID uuid.UUID) *RecomputeJob {
+	return NewRecomputeJobWithPriority(cohortID, RecomputePriorityHigh)
+}
+
+// NewRecomputeJobWithPriority creates a new recompute job for a cohort with the given priority
+func NewRecomputeJobWithPriority(cohortID uuid.UUID, priority RecomputePriority) *RecomputeJob {
 	return &RecomputeJob{
 		ID:        uuid.New(),
 		CohortID:  cohortID,
 		Status:    RecomputeStatusPending,
+		Priority:  priority,
+		Reason:    ChangeReasonRecompute,
 		Progress:  RecomputeProgress{},
 		StartedAt: time.Now().UTC(),
 	}
 }
 
+// recomputeCancelledError is the error recorded on cancelled jobs
+const recomputeCancelledError = "cancelled"
+
 // MarkRunning sets the job status to running
 func (j *RecomputeJob) MarkRunning() {
 	j.Status = RecomputeStatusRunning
@@ -72,9 +139,46 @@ func (j *RecomputeJob) UpdateProgress(progress RecomputeProgress) {
 	j.Progress = progress
 }
 
+// RulesPreview is what a set of rules would match now, without saving a cohort
+type RulesPreview struct {
+	Count int64 `json:"count"`
+	// SampleUserIDs lists some of the matching users, at most the configured
+	// preview sample size
+	SampleUserIDs []string `json:"sample_user_ids"`
+	// Truncated is set when more users match than the sample lists
+	Truncated bool `json:"truncated"`
+}
+
+// SizeEstimate is the number of users currently matching a cohort's rules
+type SizeEstimate struct {
+	CohortID    uuid.UUID `json:"cohort_id"`
+	Size        int64     `json:"size"`
+	Approximate bool      `json:"approximate"`
+	SampleRate  float64   `json:"sample_rate,omitempty"`
+	// ErrorBound is the half-width of the 95% confidence interval around an
+	// approximate Size
+	ErrorBound int64 `json:"error_bound,omitempty"`
+	// Warnings explain a size that may be unexpectedly small, e.g. rules on
+	// an event that has never been ingested
+	Warnings []string `json:"warnings,omitempty"`
+}
+
 // RecomputeRequest represents a request to trigger a recompute
 type RecomputeRequest struct {
 	Force bool `json:"force"`
+	// RespectOverrides keeps manually added and removed users in place.
+	// Defaults to true.
+	RespectOverrides *bool `json:"respect_overrides,omitempty"`
+	// Since makes the recompute incremental, re-evaluating only users with
+	// events from then on
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// newJob creates a recompute job for the request
+func (r RecomputeRequest) newJob(cohortID uuid.UUID, priority RecomputePriority) *RecomputeJob {
+	job := NewRecomputeJobWithPriority(cohortID, priority)
+	job.IgnoreOverrides = r.RespectOverrides != nil && !*r.RespectOverrides
+	return job
 }
 
 // RecomputeResponse represents the response when triggering a recompute
@@ -83,4 +187,6 @@ type RecomputeResponse struct {
 	CohortID uuid.UUID       `json:"cohort_id"`
 	Status   RecomputeStatus `json:"status"`
 	Message  string          `json:"message,omitempty"`
+	// Result is set when the recompute ran synchronously
+	Result *RecomputeProgress `json:"result,omitempty"`
 }
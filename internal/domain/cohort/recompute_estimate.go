@@ -0,0 +1,58 @@
+package cohort
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recomputeEstimateHistory is how many recent jobs duration estimates use
+const recomputeEstimateHistory = 10
+
+// RecomputeEstimate is how long a recompute of a cohort is expected to take
+type RecomputeEstimate struct {
+	CohortID uuid.UUID `json:"cohort_id"`
+	// EstimatedSize is the approximate number of users the rules match now
+	EstimatedSize       int64 `json:"estimated_size"`
+	EstimatedDurationMs int64 `json:"estimated_duration_ms"`
+	// BasedOnJobs is how many past recomputes the estimate was drawn from
+	BasedOnJobs int `json:"based_on_jobs"`
+}
+
+// EstimateRecomputeDuration scales the time past recomputes took per member
+// found to size. Recomputes have a fixed cost for scanning events however few
+// users match, so the estimate is never below the fastest past run. It returns
+// the estimate and how many completed jobs it used; failed jobs are ignored.
+func EstimateRecomputeDuration(history []*RecomputeJob, size int64) (time.Duration, int) {
+	var (
+		total    time.Duration
+		fastest  time.Duration
+		members  int64
+		finished int
+	)
+	for _, job := range history {
+		if job.Status != RecomputeStatusCompleted || job.CompletedAt == nil {
+			continue
+		}
+		d := job.CompletedAt.Sub(job.StartedAt)
+		if finished == 0 || d < fastest {
+			fastest = d
+		}
+		total += d
+		members += job.Progress.MembersFound
+		finished++
+	}
+
+	if finished == 0 {
+		return 0, 0
+	}
+	if members == 0 {
+		return total / time.Duration(finished), finished
+	}
+
+	estimate := time.Duration(float64(total) / float64(members) * float64(size))
+	if estimate < fastest {
+		estimate = fastest
+	}
+	return estimate, finished
+}
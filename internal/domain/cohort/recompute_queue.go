@@ -0,0 +1,84 @@
+package cohort
+
+import "sync"
+
+// DefaultRecomputeQueueCapacity is the default number of pending recompute jobs
+const DefaultRecomputeQueueCapacity = 100
+
+// DefaultMaxHighPriorityStreak is how many high priority jobs run back to back
+// before a waiting low priority job is let through
+const DefaultMaxHighPriorityStreak = 4
+
+// recomputeQueue orders pending recompute jobs by priority, FIFO within a
+// priority. Low priority jobs are guaranteed a turn after every
+// maxHighStreak consecutive high priority jobs so they cannot starve.
+type recomputeQueue struct {
+	mu            sync.Mutex
+	high          []*RecomputeJob
+	low           []*RecomputeJob
+	highStreak    int
+	maxHighStreak int
+	capacity      int
+	ready         chan struct{}
+}
+
+func newRecomputeQueue(capacity, maxHighStreak int) *recomputeQueue {
+	return &recomputeQueue{
+		capacity:      capacity,
+		maxHighStreak: maxHighStreak,
+		ready:         make(chan struct{}, 1),
+	}
+}
+
+// setCapacity changes the maximum number of pending jobs
+func (q *recomputeQueue) setCapacity(capacity int) {
+	q.mu.Lock()
+	q.capacity = capacity
+	q.mu.Unlock()
+}
+
+// push adds a job and wakes the consumer. It never blocks and returns
+// ErrRecomputeQueueFull when the queue is at capacity.
+func (q *recomputeQueue) push(job *RecomputeJob) error {
+	q.mu.Lock()
+	if len(q.high)+len(q.low) >= q.capacity {
+		q.mu.Unlock()
+		return ErrRecomputeQueueFull
+	}
+	if job.Priority == RecomputePriorityHigh {
+		q.high = append(q.high, job)
+	} else {
+		q.low = append(q.low, job)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes the next job to run, if any
+func (q *recomputeQueue) pop() (*RecomputeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.high) > 0 && (len(q.low) == 0 || q.highStreak < q.maxHighStreak) {
+		job := q.high[0]
+		q.high[0] = nil
+		q.high = q.high[1:]
+		q.highStreak++
+		return job, true
+	}
+
+	if len(q.low) > 0 {
+		job := q.low[0]
+		q.low[0] = nil
+		q.low = q.low[1:]
+		q.highStreak = 0
+		return job, true
+	}
+
+	return nil, false
+}
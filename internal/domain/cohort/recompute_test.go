@@ -243,3 +243,57 @@ func TestRecomputeJob_ProgressUpdatesAreCumulative(t *testing.T) {
 		t.Errorf("Progress.MembersRemoved = %d, expected 5", job.Progress.MembersRemoved)
 	}
 }
+
+func TestEstimateRecomputeDuration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	job := func(status RecomputeStatus, took time.Duration, members int64) *RecomputeJob {
+		completed := start.Add(took)
+		return &RecomputeJob{
+			ID:          uuid.New(),
+			Status:      status,
+			Progress:    RecomputeProgress{MembersFound: members},
+			StartedAt:   start,
+			CompletedAt: &completed,
+		}
+	}
+
+	// Past runs took about a millisecond per member
+	history := []*RecomputeJob{
+		job(RecomputeStatusCompleted, 10*time.Second, 10_000),
+		job(RecomputeStatusCompleted, 22*time.Second, 20_000),
+		job(RecomputeStatusCompleted, 28*time.Second, 30_000),
+		job(RecomputeStatusFailed, time.Hour, 0),
+	}
+
+	t.Run("scales past durations to the current size", func(t *testing.T) {
+		estimate, jobs := EstimateRecomputeDuration(history, 120_000)
+		if jobs != 3 {
+			t.Errorf("jobs = %d, expected 3 completed jobs", jobs)
+		}
+		if estimate != 2*time.Minute {
+			t.Errorf("estimate = %v, expected 2m", estimate)
+		}
+	})
+
+	t.Run("never estimates below the fastest run", func(t *testing.T) {
+		if estimate, _ := EstimateRecomputeDuration(history, 100); estimate != 10*time.Second {
+			t.Errorf("estimate = %v, expected 10s", estimate)
+		}
+	})
+
+	t.Run("averages runs that found no members", func(t *testing.T) {
+		empty := []*RecomputeJob{
+			job(RecomputeStatusCompleted, 4*time.Second, 0),
+			job(RecomputeStatusCompleted, 6*time.Second, 0),
+		}
+		if estimate, _ := EstimateRecomputeDuration(empty, 1000); estimate != 5*time.Second {
+			t.Errorf("estimate = %v, expected 5s", estimate)
+		}
+	})
+
+	t.Run("no completed jobs", func(t *testing.T) {
+		if _, jobs := EstimateRecomputeDuration(history[3:], 1000); jobs != 0 {
+			t.Errorf("jobs = %d, expected 0", jobs)
+		}
+	})
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
 )
 
 // ClickHouseClient interface for ClickHouse operations needed by the recompute worker
@@ -29,14 +34,106 @@ type Batch interface {
 	Send() error
 }
 
+// ChangelogExporter publishes changelog entries to external consumers
+type ChangelogExporter interface {
+	ExportChangelog(ctx context.Context, entries []ChangelogEntry) error
+}
+
+// MembershipChangeBatchProducer publishes the membership changes written by
+// recomputes
+type MembershipChangeBatchProducer interface {
+	ProduceMembershipChanges(ctx context.Context, cohortName string, changes []ChangelogEntry) error
+}
+
+// ChangelogEntry is a single membership change written to the changelog
+type ChangelogEntry struct {
+	CohortID   uuid.UUID
+	UserID     string
+	PrevStatus int8
+	NewStatus  int8
+	ChangedAt  time.Time
+	Reason     ChangeReason
+	// Variant is the user's experiment variant in cohorts with variants
+	Variant string
+}
+
+// BatchWriteError reports a batch insert that failed after earlier batches
+// for the same write were already sent
+type BatchWriteError struct {
+	Table       string
+	SentBatches int
+	SentRows    int
+	Err         error
+}
+
+func (e *BatchWriteError) Error() string {
+	return fmt.Sprintf("%s batch %d failed after %d batches (%d rows) sent: %v",
+		e.Table, e.SentBatches+1, e.SentBatches, e.SentRows, e.Err)
+}
+
+func (e *BatchWriteError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultApproxSampleRate is the fraction of users sampled for approximate counts
+const DefaultApproxSampleRate = 0.1
+
+// DefaultPreviewSampleSize is how many matching user IDs a rules preview lists
+const DefaultPreviewSampleSize = 20
+
 // RecomputeWorker handles background cohort membership recomputation
 type RecomputeWorker struct {
 	chClient     ClickHouseClient
 	cohortGetter CohortGetter
-	jobs         chan *RecomputeJob
+	exporter     ChangelogExporter
+	producer     MembershipChangeBatchProducer
+	completer    RecomputeCompleter
+	recorder     RecomputeJobRecorder
+	overrides    MembershipOverrideSource
+	queue        *recomputeQueue
 	jobStore     map[uuid.UUID]*RecomputeJob
 	mu           sync.RWMutex
 	batchSize    int
+	// produceBatchSize is how many changes are produced per Kafka write;
+	// 0 uses batchSize
+	produceBatchSize int
+
+	// cancels stops each running job's queries; cancelled holds the jobs
+	// cancellation was requested for until they stop
+	cancels   map[uuid.UUID]context.CancelFunc
+	cancelled map[uuid.UUID]struct{}
+
+	clock         Clock
+	lastChangedAt time.Time
+
+	// hysteresis is how many consecutive recomputes must find a join or leave
+	// before it's applied; pending tracks the changes still short of it
+	hysteresis int
+	pending    map[uuid.UUID]map[string]pendingChange
+
+	approxSampleRate float64
+	samplingKnown    bool
+	sampled          bool
+
+	previewSampleSize int
+
+	// aggFuncs overrides the ClickHouse functions used for aggregations
+	aggFuncs map[AggregationType]string
+
+	sqlDebug SQLDebug
+
+	// jobRetention is how long finished jobs are kept; 0 keeps them forever
+	jobRetention time.Duration
+}
+
+// SQLDebug controls logging of the SQL generated for recomputes and previews.
+// It is off by default since the args may hold user data.
+type SQLDebug struct {
+	Enabled bool
+	// RedactArgs logs a placeholder in place of each bound value
+	RedactArgs bool
+	// AttachToJob also records the SQL on the recompute job
+	AttachToJob bool
 }
 
 // CohortGetter interface for getting cohort definitions
@@ -44,28 +141,490 @@ type CohortGetter interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*Cohort, error)
 }
 
+// MembershipOverrideSource provides the manual membership overrides that
+// recomputes keep in place
+type MembershipOverrideSource interface {
+	// GetOverrides returns the forced status of each overridden user, 1 for in
+	// and -1 for out
+	GetOverrides(ctx context.Context, cohortID uuid.UUID) (map[string]int8, error)
+	ClearOverrides(ctx context.Context, cohortID uuid.UUID) error
+}
+
+// RecomputeCompleter is notified when a recompute of a cohort version completes
+type RecomputeCompleter interface {
+	MarkRecomputed(ctx context.Context, cohortID uuid.UUID, version int64) error
+}
+
+// RecomputeJobRecorder persists finished recompute jobs
+type RecomputeJobRecorder interface {
+	RecordRecomputeJob(ctx context.Context, job *RecomputeJob) error
+}
+
 // NewRecomputeWorker creates a new recompute worker
 func NewRecomputeWorker(chClient ClickHouseClient, cohortGetter CohortGetter) *RecomputeWorker {
 	return &RecomputeWorker{
 		chClient:     chClient,
 		cohortGetter: cohortGetter,
-		jobs:         make(chan *RecomputeJob, 100),
+		queue:        newRecomputeQueue(DefaultRecomputeQueueCapacity, DefaultMaxHighPriorityStreak),
 		jobStore:     make(map[uuid.UUID]*RecomputeJob),
+		cancels:      make(map[uuid.UUID]context.CancelFunc),
+		cancelled:    make(map[uuid.UUID]struct{}),
+		pending:      make(map[uuid.UUID]map[string]pendingChange),
 		batchSize:    1000,
+		clock:        systemClock{},
+
+		approxSampleRate:  DefaultApproxSampleRate,
+		previewSampleSize: DefaultPreviewSampleSize,
 	}
 }
 
+// SetClock replaces the clock used to timestamp membership changes
+func (w *RecomputeWorker) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// nextChangeTime returns the timestamp for a job's membership changes. It is
+// truncated to the changelog's millisecond precision and strictly later than
+// any previous job's, so a user's changelog entries are totally ordered even
+// when jobs run within the same millisecond or the wall clock steps back.
+func (w *RecomputeWorker) nextChangeTime() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.clock.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(w.lastChangedAt) {
+		now = w.lastChangedAt.Add(time.Millisecond)
+	}
+	w.lastChangedAt = now
+	return now
+}
+
+// SetSQLDebug sets how generated SQL is traced
+func (w *RecomputeWorker) SetSQLDebug(debug SQLDebug) {
+	w.sqlDebug = debug
+}
+
+// traceQuery logs a generated query when SQL debugging is enabled and returns
+// the trace, or nil when disabled
+func (w *RecomputeWorker) traceQuery(label, query string, args []any) *QueryTrace {
+	if !w.sqlDebug.Enabled {
+		return nil
+	}
+
+	trace := &QueryTrace{Query: query, Args: make([]string, len(args))}
+	for i, arg := range args {
+		if w.sqlDebug.RedactArgs {
+			trace.Args[i] = "<redacted>"
+		} else {
+			trace.Args[i] = fmt.Sprint(arg)
+		}
+	}
+
+	log.Printf("%s sql: query=%q args=%q", label, trace.Query, trace.Args)
+	return trace
+}
+
+// SetBatchSize sets how many rows are written per ClickHouse batch
+func (w *RecomputeWorker) SetBatchSize(size int) {
+	w.batchSize = size
+}
+
+// SetRecomputeCompleter sets the completer notified after successful jobs
+func (w *RecomputeWorker) SetRecomputeCompleter(completer RecomputeCompleter) {
+	w.completer = completer
+}
+
+// SetJobRecorder sets the recorder finished jobs are persisted to
+func (w *RecomputeWorker) SetJobRecorder(recorder RecomputeJobRecorder) {
+	w.recorder = recorder
+}
+
+// recordJob persists a finished job if a recorder is set
+func (w *RecomputeWorker) recordJob(ctx context.Context, job *RecomputeJob) {
+	if w.recorder == nil {
+		return
+	}
+	if err := w.recorder.RecordRecomputeJob(ctx, job); err != nil {
+		log.Printf("recompute job %s: failed to record job history: %v", job.ID, err)
+	}
+}
+
+// SetMembershipOverrideSource makes recomputes keep manually overridden users
+// where they were put
+func (w *RecomputeWorker) SetMembershipOverrideSource(source MembershipOverrideSource) {
+	w.overrides = source
+}
+
+// SetChangelogExporter enables exporting every changelog entry the worker writes
+func (w *RecomputeWorker) SetChangelogExporter(exporter ChangelogExporter) {
+	w.exporter = exporter
+}
+
+// SetApproxSampleRate sets the fraction of users sampled for approximate
+// counts. A rate outside (0, 1) disables sampling.
+func (w *RecomputeWorker) SetApproxSampleRate(rate float64) {
+	w.approxSampleRate = rate
+}
+
+// SetPreviewSampleSize caps how many matching user IDs a preview lists; 0
+// lists none
+func (w *RecomputeWorker) SetPreviewSampleSize(size int) {
+	w.previewSampleSize = size
+}
+
+// SetAggregateFunctions overrides the ClickHouse functions used for
+// aggregations such as distinct_count in recompute and preview queries
+func (w *RecomputeWorker) SetAggregateFunctions(funcs map[AggregationType]string) {
+	w.aggFuncs = funcs
+}
+
+// SetChangeProducer enables producing every membership change a recompute
+// writes, batchSize changes per Kafka write. A batchSize of 0 matches the
+// ClickHouse batch size.
+func (w *RecomputeWorker) SetChangeProducer(producer MembershipChangeBatchProducer, batchSize int) {
+	w.producer = producer
+	w.produceBatchSize = batchSize
+}
+
+// SetHysteresis makes a join or leave apply only once that many consecutive
+// recomputes found it, so users hovering around a threshold don't flap in and
+// out of the cohort. 1 or less applies changes on the first recompute.
+func (w *RecomputeWorker) SetHysteresis(recomputes int) {
+	w.hysteresis = recomputes
+}
+
+// jobPurgeInterval is how often finished jobs past the retention are purged
+const jobPurgeInterval = time.Hour
+
+// SetJobRetention sets how long finished jobs are kept after completing. The
+// latest job of each cohort is always kept. 0 keeps jobs forever.
+func (w *RecomputeWorker) SetJobRetention(retention time.Duration) {
+	w.jobRetention = retention
+}
+
 // Start begins processing recompute jobs
 func (w *RecomputeWorker) Start(ctx context.Context) {
 	go w.processJobs(ctx)
+	if w.jobRetention > 0 {
+		go w.purgeJobsPeriodically(ctx)
+	}
 }
 
-// SubmitJob submits a recompute job for processing
-func (w *RecomputeWorker) SubmitJob(job *RecomputeJob) {
+// purgeJobsPeriodically purges old jobs every jobPurgeInterval until ctx is canceled
+func (w *RecomputeWorker) purgeJobsPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(jobPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if purged := w.PurgeJobs(); purged > 0 {
+				log.Printf("purged %d recompute jobs older than %s", purged, w.jobRetention)
+			}
+		}
+	}
+}
+
+// PurgeJobs removes finished jobs that completed longer ago than the job
+// retention, keeping each cohort's latest job, and returns how many were
+// removed. Pending and running jobs are never purged.
+func (w *RecomputeWorker) PurgeJobs() int {
+	if w.jobRetention <= 0 {
+		return 0
+	}
+	cutoff := w.clock.Now().Add(-w.jobRetention)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	latest := make(map[uuid.UUID]*RecomputeJob)
+	for _, job := range w.jobStore {
+		if current, ok := latest[job.CohortID]; !ok || job.StartedAt.After(current.StartedAt) {
+			latest[job.CohortID] = job
+		}
+	}
+
+	purged := 0
+	for id, job := range w.jobStore {
+		if job.CompletedAt == nil || !job.CompletedAt.Before(cutoff) || latest[job.CohortID] == job {
+			continue
+		}
+		delete(w.jobStore, id)
+		purged++
+	}
+	return purged
+}
+
+// SetQueueCapacity sets the maximum number of pending jobs
+func (w *RecomputeWorker) SetQueueCapacity(capacity int) {
+	w.queue.setCapacity(capacity)
+}
+
+// SubmitJob queues a recompute job for processing. High priority jobs run
+// ahead of low priority ones already waiting. It never blocks and returns
+// ErrRecomputeQueueFull when too many jobs are pending.
+func (w *RecomputeWorker) SubmitJob(job *RecomputeJob) error {
 	w.mu.Lock()
 	w.jobStore[job.ID] = job
 	w.mu.Unlock()
-	w.jobs <- job
+
+	if err := w.queue.push(job); err != nil {
+		w.mu.Lock()
+		delete(w.jobStore, job.ID)
+		w.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// RunJob executes a recompute job inline, returning once it has finished
+func (w *RecomputeWorker) RunJob(ctx context.Context, job *RecomputeJob) {
+	w.updateJob(job)
+	w.executeJob(ctx, job)
+}
+
+// CancelJob cancels a pending or running job. A pending job is failed right
+// away and skipped once dequeued. A running job's queries are interrupted and
+// it fails before applying any membership changes; a job already applying
+// them runs to completion. Finished jobs return ErrRecomputeJobFinished.
+func (w *RecomputeWorker) CancelJob(jobID uuid.UUID) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	job, ok := w.jobStore[jobID]
+	if !ok {
+		return ErrRecomputeJobNotFound
+	}
+	switch job.Status {
+	case RecomputeStatusPending:
+		job.MarkFailed(recomputeCancelledError)
+	case RecomputeStatusRunning:
+	default:
+		return ErrRecomputeJobFinished
+	}
+
+	w.cancelled[jobID] = struct{}{}
+	if cancel, ok := w.cancels[jobID]; ok {
+		cancel()
+	}
+	return nil
+}
+
+// startJob marks a job running and returns the context its queries run
+// under, or false if the job was cancelled while pending
+func (w *RecomputeWorker) startJob(ctx context.Context, job *RecomputeJob) (context.Context, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.cancelled[job.ID]; ok {
+		delete(w.cancelled, job.ID)
+		return ctx, false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.cancels[job.ID] = cancel
+	job.MarkRunning()
+	w.jobStore[job.ID] = job
+	return ctx, true
+}
+
+// finishJob releases a job's cancellation state
+func (w *RecomputeWorker) finishJob(job *RecomputeJob) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if cancel, ok := w.cancels[job.ID]; ok {
+		cancel()
+		delete(w.cancels, job.ID)
+	}
+	delete(w.cancelled, job.ID)
+}
+
+// stopIfCancelled fails a job cancellation was requested for, reporting
+// whether it did
+func (w *RecomputeWorker) stopIfCancelled(job *RecomputeJob) bool {
+	w.mu.RLock()
+	_, cancelled := w.cancelled[job.ID]
+	w.mu.RUnlock()
+	if !cancelled {
+		return false
+	}
+
+	job.MarkFailed(recomputeCancelledError)
+	w.updateJob(job)
+	log.Printf("recompute job %s cancelled", job.ID)
+	return true
+}
+
+// PreviewCount returns the number of users currently matching the rules.
+// Rules no query can be built for return an error wrapping ErrInvalidRules.
+func (w *RecomputeWorker) PreviewCount(ctx context.Context, rules Rules) (int64, error) {
+	qb := NewQueryBuilder()
+	qb.SetAggregateFunctions(w.aggFuncs)
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+
+	query = "SELECT count() FROM (" + query + ")"
+	w.traceQuery("preview", query, args)
+
+	rows, err := w.chClient.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(count), nil
+}
+
+// Preview returns the number of users currently matching the rules and a
+// sample of their IDs capped at the preview sample size. Rules no query can be
+// built for return an error wrapping ErrInvalidRules.
+func (w *RecomputeWorker) Preview(ctx context.Context, rules Rules) (*RulesPreview, error) {
+	if w.previewSampleSize <= 0 {
+		count, err := w.PreviewCount(ctx, rules)
+		if err != nil {
+			return nil, err
+		}
+		return &RulesPreview{Count: count, SampleUserIDs: []string{}, Truncated: count > 0}, nil
+	}
+
+	qb := NewQueryBuilder()
+	qb.SetAggregateFunctions(w.aggFuncs)
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+
+	query = fmt.Sprintf("SELECT count(), groupArray(%d)(user_id) FROM (%s)", w.previewSampleSize, query)
+	w.traceQuery("preview", query, args)
+
+	rows, err := w.chClient.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	var sample []string
+	if rows.Next() {
+		if err := rows.Scan(&count, &sample); err != nil {
+			return nil, err
+		}
+	}
+	if sample == nil {
+		sample = []string{}
+	}
+
+	return &RulesPreview{
+		Count:         int64(count),
+		SampleUserIDs: sample,
+		Truncated:     int64(count) > int64(len(sample)),
+	}, nil
+}
+
+// EstimateCount returns the number of users matching the rules. With approx,
+// the rules are evaluated over a sample of users when events_raw has a user
+// based sampling key, and the count is scaled up with a 95% error bound. It
+// falls back to an exact count when the table cannot be sampled.
+func (w *RecomputeWorker) EstimateCount(ctx context.Context, rules Rules, approx bool) (*SizeEstimate, error) {
+	rate := w.approxSampleRate
+	if approx && rate > 0 && rate < 1 {
+		sampled, err := w.sampledByUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		approx = sampled
+	} else {
+		approx = false
+	}
+
+	if !approx {
+		count, err := w.PreviewCount(ctx, rules)
+		if err != nil {
+			return nil, err
+		}
+		return &SizeEstimate{Size: count}, nil
+	}
+
+	qb := NewQueryBuilder()
+	qb.SetAggregateFunctions(w.aggFuncs)
+	qb.SetEventSource(fmt.Sprintf("events_raw SAMPLE %s", strconv.FormatFloat(rate, 'f', -1, 64)))
+	query, args, err := qb.BuildQuery(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	query = "SELECT count() FROM (" + query + ")"
+	w.traceQuery("approximate preview", query, args)
+
+	rows, err := w.chClient.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return nil, err
+		}
+	}
+
+	// Each matching user is sampled independently with probability rate
+	n := float64(count)
+	return &SizeEstimate{
+		Size:        int64(math.Round(n / rate)),
+		Approximate: true,
+		SampleRate:  rate,
+		ErrorBound:  int64(math.Ceil(1.96 * math.Sqrt(n*(1-rate)) / rate)),
+	}, nil
+}
+
+// sampledByUser reports whether events_raw has a sampling key derived from
+// user_id. Sampling by anything else would sample each condition's users
+// differently and break INTERSECT. The result is cached once looked up.
+func (w *RecomputeWorker) sampledByUser(ctx context.Context) (bool, error) {
+	w.mu.RLock()
+	known, sampled := w.samplingKnown, w.sampled
+	w.mu.RUnlock()
+	if known {
+		return sampled, nil
+	}
+
+	rows, err := w.chClient.Query(ctx, `
+		SELECT sampling_key
+		FROM system.tables
+		WHERE database = currentDatabase() AND name = 'events_raw'
+	`)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up sampling key: %w", err)
+	}
+	defer rows.Close()
+
+	var key string
+	if rows.Next() {
+		if err := rows.Scan(&key); err != nil {
+			return false, fmt.Errorf("failed to look up sampling key: %w", err)
+		}
+	}
+
+	sampled = strings.Contains(key, "user_id")
+	w.mu.Lock()
+	w.samplingKnown, w.sampled = true, sampled
+	w.mu.Unlock()
+	return sampled, nil
 }
 
 // GetJob retrieves the current state of a job
@@ -89,22 +648,58 @@ func (w *RecomputeWorker) HasRunningJob(cohortID uuid.UUID) bool {
 	return false
 }
 
+// FailedJobs returns up to limit jobs that failed at or after since, across
+// all cohorts, newest first
+func (w *RecomputeWorker) FailedJobs(since time.Time, limit int) []*RecomputeJob {
+	w.mu.RLock()
+	var failed []*RecomputeJob
+	for _, job := range w.jobStore {
+		if job.Status == RecomputeStatusFailed && job.CompletedAt != nil && !job.CompletedAt.Before(since) {
+			copied := *job
+			failed = append(failed, &copied)
+		}
+	}
+	w.mu.RUnlock()
+
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].CompletedAt.After(*failed[j].CompletedAt)
+	})
+	if limit > 0 && len(failed) > limit {
+		failed = failed[:limit]
+	}
+	return failed
+}
+
 // processJobs continuously processes jobs from the queue
 func (w *RecomputeWorker) processJobs(ctx context.Context) {
 	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if job, ok := w.queue.pop(); ok {
+			w.executeJob(ctx, job)
+			continue
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case job := <-w.jobs:
-			w.executeJob(ctx, job)
+		case <-w.queue.ready:
 		}
 	}
 }
 
 // executeJob runs a single recompute job
 func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
-	job.MarkRunning()
-	w.updateJob(job)
+	defer w.recordJob(ctx, job)
+
+	jobCtx, ok := w.startJob(ctx, job)
+	if !ok {
+		log.Printf("skipping cancelled recompute job %s", job.ID)
+		return
+	}
+	defer w.finishJob(job)
 
 	log.Printf("starting recompute job %s for cohort %s", job.ID, job.CohortID)
 
@@ -116,10 +711,35 @@ func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
 		log.Printf("recompute job %s failed: %v", job.ID, err)
 		return
 	}
+	if cohort.Type == CohortTypeStatic {
+		job.MarkFailed(ErrStaticCohort.Error())
+		w.updateJob(job)
+		log.Printf("recompute job %s skipped: cohort %s is static", job.ID, job.CohortID)
+		return
+	}
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, cohort.ProjectID), cohort.ID)
+	jobCtx = tenant.WithCohort(tenant.WithProject(jobCtx, cohort.ProjectID), cohort.ID)
+	job.variants = cohort.Variants
+	job.CohortVersion = cohort.Version
+
+	// The first recompute after a rules edit is what applies the edit. An
+	// incremental recompute only re-evaluates some users, so it can't.
+	since := job.Progress.Since
+	if cohort.NeedsRecompute && since == nil {
+		job.Reason = ChangeReasonRuleChange
+		w.updateJob(job)
+	}
 
 	// Build query from rules
 	qb := NewQueryBuilder()
-	query, args, err := qb.BuildQuery(cohort.Rules)
+	qb.SetAggregateFunctions(w.aggFuncs)
+	var query string
+	var args []any
+	if since != nil {
+		query, args, err = qb.BuildIncrementalQuery(cohort.Rules, *since)
+	} else {
+		query, args, err = qb.BuildQuery(cohort.Rules)
+	}
 	if err != nil {
 		job.MarkFailed(fmt.Sprintf("failed to build query: %v", err))
 		w.updateJob(job)
@@ -127,8 +747,16 @@ func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
 		return
 	}
 
+	if trace := w.traceQuery(fmt.Sprintf("recompute job %s", job.ID), query, args); trace != nil && w.sqlDebug.AttachToJob {
+		job.SQL = trace
+		w.updateJob(job)
+	}
+
 	// Get matching users from events
-	matchingUsers, err := w.getMatchingUsers(ctx, query, args)
+	matchingUsers, err := w.getMatchingUsers(jobCtx, query, args)
+	if w.stopIfCancelled(job) {
+		return
+	}
 	if err != nil {
 		job.MarkFailed(fmt.Sprintf("failed to query matching users: %v", err))
 		w.updateJob(job)
@@ -136,11 +764,18 @@ func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
 		return
 	}
 
-	job.Progress.MembersFound = int64(len(matchingUsers))
-	w.updateJob(job)
+	if err := w.applyOverrides(jobCtx, job, matchingUsers); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to get membership overrides: %v", err))
+		w.updateJob(job)
+		log.Printf("recompute job %s failed: %v", job.ID, err)
+		return
+	}
 
 	// Get current members
-	currentMembers, err := w.getCurrentMembers(ctx, job.CohortID)
+	currentMembers, err := w.getCurrentMembers(jobCtx, job.CohortID)
+	if w.stopIfCancelled(job) {
+		return
+	}
 	if err != nil {
 		job.MarkFailed(fmt.Sprintf("failed to get current members: %v", err))
 		w.updateJob(job)
@@ -148,13 +783,39 @@ func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
 		return
 	}
 
+	// Users without recent events keep their membership as it is
+	if since != nil {
+		affectedQuery, affectedArgs := qb.BuildAffectedUsersQuery(*since)
+		affected, err := w.getMatchingUsers(jobCtx, affectedQuery, affectedArgs)
+		if w.stopIfCancelled(job) {
+			return
+		}
+		if err != nil {
+			job.MarkFailed(fmt.Sprintf("failed to query affected users: %v", err))
+			w.updateJob(job)
+			log.Printf("recompute job %s failed: %v", job.ID, err)
+			return
+		}
+		restrictUsers(matchingUsers, affected)
+		restrictUsers(currentMembers, affected)
+	}
+
+	job.Progress.MembersFound = int64(len(matchingUsers))
+	w.updateJob(job)
+
 	// Calculate diff
 	toAdd, toRemove := w.CalculateDiff(matchingUsers, currentMembers)
+	if w.hysteresis > 1 {
+		var deferred int
+		toAdd, toRemove, deferred = w.applyHysteresis(job, toAdd, toRemove)
+		job.Progress.MembersDeferred = int64(deferred)
+	}
 	job.Progress.TotalUsers = int64(len(toAdd) + len(toRemove))
 	w.updateJob(job)
 
-	// Apply changes
-	now := time.Now().UTC()
+	// Apply changes. A user appears in at most one of toAdd and toRemove, so
+	// one timestamp per job still gives each user a single ordered entry.
+	now := w.nextChangeTime()
 	if err := w.applyMembershipChanges(ctx, job, toAdd, toRemove, now); err != nil {
 		job.MarkFailed(fmt.Sprintf("failed to apply membership changes: %v", err))
 		w.updateJob(job)
@@ -162,16 +823,141 @@ func (w *RecomputeWorker) executeJob(ctx context.Context, job *RecomputeJob) {
 		return
 	}
 
-	job.Progress.MembersAdded = int64(len(toAdd))
-	job.Progress.MembersRemoved = int64(len(toRemove))
-	job.Progress.ProcessedUsers = job.Progress.TotalUsers
+	if err := w.produceChanges(ctx, job, cohort.Name, toAdd, toRemove, now); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to produce membership changes: %v", err))
+		w.updateJob(job)
+		log.Printf("recompute job %s failed: %v", job.ID, err)
+		return
+	}
+
 	job.MarkCompleted()
 	w.updateJob(job)
 
+	if w.completer != nil && since == nil {
+		if err := w.completer.MarkRecomputed(ctx, cohort.ID, cohort.Version); err != nil {
+			log.Printf("recompute job %s: failed to clear needs_recompute: %v", job.ID, err)
+		}
+	}
+
+	// Overrides reverted by this job would otherwise be reapplied by the next
+	if job.IgnoreOverrides && w.overrides != nil {
+		if err := w.overrides.ClearOverrides(ctx, cohort.ID); err != nil {
+			log.Printf("recompute job %s: failed to clear membership overrides: %v", job.ID, err)
+		}
+	}
+
 	log.Printf("recompute job %s completed: found=%d, added=%d, removed=%d",
 		job.ID, len(matchingUsers), len(toAdd), len(toRemove))
 }
 
+// ExpireMembers writes a leave for every member of the cohort whose membership
+// lifetime has passed since they joined, keeping users manually placed in the
+// cohort. The leaves are recorded as a low priority job with reason expired.
+// Cohorts with a job pending or running are skipped until the next sweep. It
+// returns the number of members expired.
+func (w *RecomputeWorker) ExpireMembers(ctx context.Context, c *Cohort) (int, error) {
+	ttl := c.MembershipLifetime()
+	if ttl <= 0 || w.HasRunningJob(c.ID) {
+		return 0, nil
+	}
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, c.ProjectID), c.ID)
+
+	now := w.nextChangeTime()
+	expired, err := w.getExpiredMembers(ctx, c.ID, now.Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired members: %w", err)
+	}
+	if w.overrides != nil && len(expired) > 0 {
+		overrides, err := w.overrides.GetOverrides(ctx, c.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get membership overrides: %w", err)
+		}
+		kept := expired[:0]
+		for _, userID := range expired {
+			if overrides[userID] <= 0 {
+				kept = append(kept, userID)
+			}
+		}
+		expired = kept
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	job := NewRecomputeJobWithPriority(c.ID, RecomputePriorityLow)
+	job.Reason = ChangeReasonExpired
+	job.variants = c.Variants
+	job.MarkRunning()
+	job.Progress.TotalUsers = int64(len(expired))
+	w.updateJob(job)
+
+	if err := w.applyMembershipChanges(ctx, job, nil, expired, now); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to apply membership changes: %v", err))
+		w.updateJob(job)
+		return 0, err
+	}
+	if err := w.produceChanges(ctx, job, c.Name, nil, expired, now); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to produce membership changes: %v", err))
+		w.updateJob(job)
+		return 0, err
+	}
+
+	job.MarkCompleted()
+	w.updateJob(job)
+
+	return len(expired), nil
+}
+
+// getExpiredMembers gets the members of a cohort whose latest join is at or
+// before cutoff, sorted
+func (w *RecomputeWorker) getExpiredMembers(ctx context.Context, cohortID uuid.UUID, cutoff time.Time) ([]string, error) {
+	rows, err := w.chClient.Query(ctx, `
+		SELECT user_id
+		FROM cohort_membership_current
+		WHERE cohort_id = ?
+		GROUP BY user_id
+		HAVING sum(sign) > 0 AND maxIf(joined_at, sign > 0) <= ?
+	`, cohortID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		expired = append(expired, userID)
+	}
+
+	sort.Strings(expired)
+	return expired, nil
+}
+
+// applyOverrides adds users forced into the cohort to the matching users and
+// drops users forced out of it
+func (w *RecomputeWorker) applyOverrides(ctx context.Context, job *RecomputeJob, matchingUsers map[string]struct{}) error {
+	if w.overrides == nil || job.IgnoreOverrides {
+		return nil
+	}
+
+	overrides, err := w.overrides.GetOverrides(ctx, job.CohortID)
+	if err != nil {
+		return err
+	}
+	for userID, status := range overrides {
+		if status > 0 {
+			matchingUsers[userID] = struct{}{}
+		} else {
+			delete(matchingUsers, userID)
+		}
+	}
+
+	return nil
+}
+
 // getMatchingUsers executes the query and returns matching user IDs
 func (w *RecomputeWorker) getMatchingUsers(ctx context.Context, query string, args []any) (map[string]struct{}, error) {
 	rows, err := w.chClient.Query(ctx, query, args...)
@@ -192,6 +978,15 @@ func (w *RecomputeWorker) getMatchingUsers(ctx context.Context, query string, ar
 	return users, nil
 }
 
+// restrictUsers removes the users not in keep from users
+func restrictUsers(users, keep map[string]struct{}) {
+	for userID := range users {
+		if _, ok := keep[userID]; !ok {
+			delete(users, userID)
+		}
+	}
+}
+
 // getCurrentMembers gets the current members of a cohort from ClickHouse
 func (w *RecomputeWorker) getCurrentMembers(ctx context.Context, cohortID uuid.UUID) (map[string]struct{}, error) {
 	query := `
@@ -219,7 +1014,8 @@ func (w *RecomputeWorker) getCurrentMembers(ctx context.Context, cohortID uuid.U
 	return members, nil
 }
 
-// CalculateDiff calculates which users need to be added or removed
+// CalculateDiff calculates which users need to be added or removed. Both
+// slices are sorted so batches are written in a deterministic order.
 func (w *RecomputeWorker) CalculateDiff(matchingUsers, currentMembers map[string]struct{}) (toAdd, toRemove []string) {
 	// Users to add: in matchingUsers but not in currentMembers
 	for userID := range matchingUsers {
@@ -235,27 +1031,78 @@ func (w *RecomputeWorker) CalculateDiff(matchingUsers, currentMembers map[string
 		}
 	}
 
+	sort.Strings(toAdd)
+	sort.Strings(toRemove)
 	return toAdd, toRemove
 }
 
+// pendingChange is a join (1) or leave (-1) found by streak consecutive
+// recomputes and not applied yet
+type pendingChange struct {
+	direction int8
+	streak    int
+}
+
+// applyHysteresis holds back the joins and leaves not yet found by enough
+// consecutive recomputes and returns the ones to apply and how many were held
+// back. A held back change not found by the next recompute starts over. The
+// first recompute after a rules edit applies everything since its changes come
+// from the edit rather than users flapping.
+func (w *RecomputeWorker) applyHysteresis(job *RecomputeJob, toAdd, toRemove []string) (add, remove []string, deferred int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if job.Reason == ChangeReasonRuleChange {
+		delete(w.pending, job.CohortID)
+		return toAdd, toRemove, 0
+	}
+
+	prev := w.pending[job.CohortID]
+	next := make(map[string]pendingChange)
+	hold := func(userIDs []string, direction int8) []string {
+		var apply []string
+		for _, userID := range userIDs {
+			change := pendingChange{direction: direction, streak: 1}
+			if p, ok := prev[userID]; ok && p.direction == direction {
+				change.streak = p.streak + 1
+			}
+			if change.streak >= w.hysteresis {
+				apply = append(apply, userID)
+				continue
+			}
+			next[userID] = change
+		}
+		return apply
+	}
+	add = hold(toAdd, 1)
+	remove = hold(toRemove, -1)
+
+	if len(next) == 0 {
+		delete(w.pending, job.CohortID)
+	} else {
+		w.pending[job.CohortID] = next
+	}
+	return add, remove, len(next)
+}
+
 // applyMembershipChanges inserts membership changes to ClickHouse
 func (w *RecomputeWorker) applyMembershipChanges(ctx context.Context, job *RecomputeJob, toAdd, toRemove []string, now time.Time) error {
 	// Insert additions
 	if len(toAdd) > 0 {
-		if err := w.insertMembershipBatch(ctx, job.CohortID, toAdd, 1, now); err != nil {
+		if err := w.insertMembershipBatch(ctx, job, toAdd, 1, now); err != nil {
 			return fmt.Errorf("failed to insert additions: %w", err)
 		}
-		if err := w.insertChangelogBatch(ctx, job.CohortID, toAdd, -1, 1, now); err != nil {
+		if err := w.insertChangelogBatch(ctx, job, toAdd, -1, 1, now); err != nil {
 			return fmt.Errorf("failed to insert addition changelog: %w", err)
 		}
 	}
 
 	// Insert removals
 	if len(toRemove) > 0 {
-		if err := w.insertMembershipBatch(ctx, job.CohortID, toRemove, -1, now); err != nil {
+		if err := w.insertMembershipBatch(ctx, job, toRemove, -1, now); err != nil {
 			return fmt.Errorf("failed to insert removals: %w", err)
 		}
-		if err := w.insertChangelogBatch(ctx, job.CohortID, toRemove, 1, -1, now); err != nil {
+		if err := w.insertChangelogBatch(ctx, job, toRemove, 1, -1, now); err != nil {
 			return fmt.Errorf("failed to insert removal changelog: %w", err)
 		}
 	}
@@ -263,52 +1110,112 @@ func (w *RecomputeWorker) applyMembershipChanges(ctx context.Context, job *Recom
 	return nil
 }
 
-// insertMembershipBatch inserts membership records in batches
-func (w *RecomputeWorker) insertMembershipBatch(ctx context.Context, cohortID uuid.UUID, userIDs []string, sign int8, now time.Time) error {
+// produceChanges produces the job's applied joins and leaves in batches
+func (w *RecomputeWorker) produceChanges(ctx context.Context, job *RecomputeJob, cohortName string, toAdd, toRemove []string, now time.Time) error {
+	if w.producer == nil {
+		return nil
+	}
+
+	changes := make([]ChangelogEntry, 0, len(toAdd)+len(toRemove))
+	for _, userID := range toAdd {
+		changes = append(changes, ChangelogEntry{CohortID: job.CohortID, UserID: userID, PrevStatus: -1, NewStatus: 1, ChangedAt: now, Reason: job.Reason, Variant: job.variant(userID)})
+	}
+	for _, userID := range toRemove {
+		changes = append(changes, ChangelogEntry{CohortID: job.CohortID, UserID: userID, PrevStatus: 1, NewStatus: -1, ChangedAt: now, Reason: job.Reason, Variant: job.variant(userID)})
+	}
+
+	size := w.produceBatchSize
+	if size <= 0 {
+		size = w.batchSize
+	}
+	for i := 0; i < len(changes); i += size {
+		end := min(i+size, len(changes))
+		if err := w.producer.ProduceMembershipChanges(ctx, cohortName, changes[i:end]); err != nil {
+			return fmt.Errorf("batch at offset %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// insertMembershipBatch inserts membership records in batches, recording
+// progress on the job after each batch is sent
+func (w *RecomputeWorker) insertMembershipBatch(ctx context.Context, job *RecomputeJob, userIDs []string, sign int8, now time.Time) error {
 	for i := 0; i < len(userIDs); i += w.batchSize {
 		end := min(i+w.batchSize, len(userIDs))
 
 		batch, err := w.chClient.PrepareBatch(ctx, `
-			INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at)
+			INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at, variant)
 		`)
 		if err != nil {
-			return err
+			return &BatchWriteError{Table: "cohort_membership_current", SentBatches: i / w.batchSize, SentRows: i, Err: err}
 		}
 
 		for _, userID := range userIDs[i:end] {
-			if err := batch.Append(cohortID, userID, sign, now); err != nil {
-				return err
+			if err := batch.Append(job.CohortID, userID, sign, now, job.variant(userID)); err != nil {
+				return &BatchWriteError{Table: "cohort_membership_current", SentBatches: i / w.batchSize, SentRows: i, Err: err}
 			}
 		}
 
 		if err := batch.Send(); err != nil {
-			return err
+			return &BatchWriteError{Table: "cohort_membership_current", SentBatches: i / w.batchSize, SentRows: i, Err: err}
 		}
+
+		rows := int64(end - i)
+		job.Progress.BatchesSent++
+		job.Progress.ProcessedUsers += rows
+		if sign > 0 {
+			job.Progress.MembersAdded += rows
+		} else {
+			job.Progress.MembersRemoved += rows
+		}
+		w.updateJob(job)
 	}
 
 	return nil
 }
 
 // insertChangelogBatch inserts changelog records in batches
-func (w *RecomputeWorker) insertChangelogBatch(ctx context.Context, cohortID uuid.UUID, userIDs []string, prevStatus, newStatus int8, now time.Time) error {
+func (w *RecomputeWorker) insertChangelogBatch(ctx context.Context, job *RecomputeJob, userIDs []string, prevStatus, newStatus int8, now time.Time) error {
+	cohortID := job.CohortID
 	for i := 0; i < len(userIDs); i += w.batchSize {
 		end := min(i+w.batchSize, len(userIDs))
 
 		batch, err := w.chClient.PrepareBatch(ctx, `
-			INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id)
+			INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id, reason, variant)
 		`)
 		if err != nil {
-			return err
+			return &BatchWriteError{Table: "cohort_membership_changelog", SentBatches: i / w.batchSize, SentRows: i, Err: err}
 		}
 
 		for _, userID := range userIDs[i:end] {
-			if err := batch.Append(cohortID, userID, prevStatus, newStatus, now, nil); err != nil {
-				return err
+			if err := batch.Append(cohortID, userID, prevStatus, newStatus, now, nil, string(job.Reason), job.variant(userID)); err != nil {
+				return &BatchWriteError{Table: "cohort_membership_changelog", SentBatches: i / w.batchSize, SentRows: i, Err: err}
 			}
 		}
 
 		if err := batch.Send(); err != nil {
-			return err
+			return &BatchWriteError{Table: "cohort_membership_changelog", SentBatches: i / w.batchSize, SentRows: i, Err: err}
+		}
+		job.Progress.BatchesSent++
+		w.updateJob(job)
+
+		if w.exporter != nil {
+			entries := make([]ChangelogEntry, 0, end-i)
+			for _, userID := range userIDs[i:end] {
+				entries = append(entries, ChangelogEntry{
+					CohortID:   cohortID,
+					UserID:     userID,
+					PrevStatus: prevStatus,
+					NewStatus:  newStatus,
+					ChangedAt:  now,
+					Reason:     job.Reason,
+					Variant:    job.variant(userID),
+				})
+			}
+			if err := w.exporter.ExportChangelog(ctx, entries); err != nil {
+				return fmt.Errorf("failed to export changelog: %w", err)
+			}
 		}
 	}
 
@@ -1,9 +1,21 @@
 package cohort_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pjhul/intent/internal/db"
 	"github.com/pjhul/intent/internal/domain/cohort"
 	"github.com/pjhul/intent/internal/mocks"
 	"go.uber.org/mock/gomock"
@@ -179,6 +191,46 @@ func TestRecomputeWorker_SubmitAndGetJob(t *testing.T) {
 	})
 }
 
+func TestRecomputeWorker_SubmitJob_QueueFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+	worker.SetQueueCapacity(2)
+
+	// The worker is not started, so submitted jobs stay queued
+	for i := 0; i < 2; i++ {
+		if err := worker.SubmitJob(cohort.NewRecomputeJob(uuid.New())); err != nil {
+			t.Fatalf("SubmitJob() unexpected error: %v", err)
+		}
+	}
+
+	overflow := cohort.NewRecomputeJob(uuid.New())
+	done := make(chan error, 1)
+	go func() {
+		done <- worker.SubmitJob(overflow)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, cohort.ErrRecomputeQueueFull) {
+			t.Errorf("SubmitJob() error = %v, expected ErrRecomputeQueueFull", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitJob() blocked on a full queue")
+	}
+
+	if _, ok := worker.GetJob(overflow.ID); ok {
+		t.Error("GetJob() should not return a rejected job")
+	}
+	if worker.HasRunningJob(overflow.CohortID) {
+		t.Error("HasRunningJob() should be false for a rejected job")
+	}
+}
+
 func TestNewRecomputeWorker(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -192,3 +244,1181 @@ func TestNewRecomputeWorker(t *testing.T) {
 		t.Error("NewRecomputeWorker() returned nil")
 	}
 }
+
+func TestRecomputeWorker_RunJob_ExportsChangelog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	mockExporter := mocks.NewMockChangelogExporter(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+	worker.SetChangelogExporter(mockExporter)
+
+	cohortID := uuid.New()
+	rulesJSON, _ := json.Marshal(cohort.Rules{
+		Operator:   cohort.OperatorAND,
+		Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+	})
+	mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(db.GetCohortRow{
+		ID:    pgtype.UUID{Bytes: cohortID, Valid: true},
+		Rules: rulesJSON,
+	}, nil)
+
+	// user1 and user2 now match; user3 is a stale member
+	gomock.InOrder(
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user1", "user2"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user3"), nil),
+	)
+
+	batch := mocks.NewMockBatch(ctrl)
+	batch.EXPECT().Append(gomock.Any()).Return(nil).AnyTimes()
+	batch.EXPECT().Send().Return(nil).AnyTimes()
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(batch, nil).AnyTimes()
+
+	var exported []cohort.ChangelogEntry
+	mockExporter.EXPECT().
+		ExportChangelog(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, entries []cohort.ChangelogEntry) error {
+			exported = append(exported, entries...)
+			return nil
+		}).
+		Times(2)
+
+	job := cohort.NewRecomputeJob(cohortID)
+	worker.RunJob(context.Background(), job)
+
+	if job.Status != cohort.RecomputeStatusCompleted {
+		t.Fatalf("Status = %v, expected completed (error: %s)", job.Status, job.Error)
+	}
+	if len(exported) != 3 {
+		t.Fatalf("exported entries = %d, expected 3", len(exported))
+	}
+	for _, e := range exported {
+		if e.CohortID != cohortID {
+			t.Errorf("CohortID = %v, expected %v", e.CohortID, cohortID)
+		}
+		if e.UserID == "user3" && e.NewStatus != -1 {
+			t.Errorf("user3 NewStatus = %d, expected -1", e.NewStatus)
+		}
+		if e.UserID != "user3" && e.NewStatus != 1 {
+			t.Errorf("%s NewStatus = %d, expected 1", e.UserID, e.NewStatus)
+		}
+	}
+}
+
+func TestRecomputeWorker_RunJob_PartialBatchFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+	worker.SetBatchSize(2)
+
+	cohortID := uuid.New()
+	rulesJSON, _ := json.Marshal(cohort.Rules{
+		Operator:   cohort.OperatorAND,
+		Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+	})
+	mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(db.GetCohortRow{
+		ID:    pgtype.UUID{Bytes: cohortID, Valid: true},
+		Rules: rulesJSON,
+	}, nil)
+
+	// Three new members split into chunks of two and one
+	gomock.InOrder(
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user1", "user2", "user3"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl), nil),
+	)
+
+	batch := mocks.NewMockBatch(ctrl)
+	batch.EXPECT().Append(gomock.Any()).Return(nil).AnyTimes()
+	gomock.InOrder(
+		batch.EXPECT().Send().Return(nil),
+		batch.EXPECT().Send().Return(errors.New("connection reset")),
+	)
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(batch, nil).Times(2)
+
+	job := cohort.NewRecomputeJob(cohortID)
+	worker.RunJob(context.Background(), job)
+
+	if job.Status != cohort.RecomputeStatusFailed {
+		t.Fatalf("Status = %v, expected failed", job.Status)
+	}
+	if job.Progress.BatchesSent != 1 {
+		t.Errorf("BatchesSent = %d, expected 1", job.Progress.BatchesSent)
+	}
+	if job.Progress.ProcessedUsers != 2 {
+		t.Errorf("ProcessedUsers = %d, expected 2", job.Progress.ProcessedUsers)
+	}
+	if job.Progress.MembersAdded != 2 {
+		t.Errorf("MembersAdded = %d, expected 2", job.Progress.MembersAdded)
+	}
+	if job.Progress.TotalUsers != 3 {
+		t.Errorf("TotalUsers = %d, expected 3", job.Progress.TotalUsers)
+	}
+	if !strings.Contains(job.Error, "batch 2 failed after 1 batches (2 rows) sent: connection reset") {
+		t.Errorf("Error = %q, expected partial batch details", job.Error)
+	}
+}
+
+func TestRecomputeWorker_Priority(t *testing.T) {
+	// runOrder submits jobs before the worker starts and returns the order their cohorts were processed in
+	runOrder := func(t *testing.T, jobs []*cohort.RecomputeJob) []uuid.UUID {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		processed := make(chan uuid.UUID, len(jobs))
+		mockGetter := mocks.NewMockCohortGetter(ctrl)
+		mockGetter.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, id uuid.UUID) (*cohort.Cohort, error) {
+				processed <- id
+				return nil, errors.New("not found")
+			},
+		).Times(len(jobs))
+
+		worker := cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), mockGetter)
+		for _, job := range jobs {
+			worker.SubmitJob(job)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		worker.Start(ctx)
+
+		order := make([]uuid.UUID, 0, len(jobs))
+		for range jobs {
+			select {
+			case id := <-processed:
+				order = append(order, id)
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for jobs, processed %d of %d", len(order), len(jobs))
+			}
+		}
+		return order
+	}
+
+	t.Run("high priority job submitted later runs first", func(t *testing.T) {
+		scheduled := cohort.NewRecomputeJobWithPriority(uuid.New(), cohort.RecomputePriorityLow)
+		manual := cohort.NewRecomputeJobWithPriority(uuid.New(), cohort.RecomputePriorityHigh)
+
+		order := runOrder(t, []*cohort.RecomputeJob{scheduled, manual})
+
+		if order[0] != manual.CohortID {
+			t.Errorf("first job = %v, expected manual job %v", order[0], manual.CohortID)
+		}
+		if order[1] != scheduled.CohortID {
+			t.Errorf("second job = %v, expected scheduled job %v", order[1], scheduled.CohortID)
+		}
+	})
+
+	t.Run("low priority job is not starved", func(t *testing.T) {
+		scheduled := cohort.NewRecomputeJobWithPriority(uuid.New(), cohort.RecomputePriorityLow)
+		jobs := []*cohort.RecomputeJob{scheduled}
+		for i := 0; i < cohort.DefaultMaxHighPriorityStreak+2; i++ {
+			jobs = append(jobs, cohort.NewRecomputeJob(uuid.New()))
+		}
+
+		order := runOrder(t, jobs)
+
+		if order[cohort.DefaultMaxHighPriorityStreak] != scheduled.CohortID {
+			t.Errorf("scheduled job ran at position %d, expected %d",
+				indexOf(order, scheduled.CohortID), cohort.DefaultMaxHighPriorityStreak)
+		}
+		for i, id := range order[:cohort.DefaultMaxHighPriorityStreak] {
+			if id != jobs[i+1].CohortID {
+				t.Errorf("order[%d] = %v, expected %v", i, id, jobs[i+1].CohortID)
+			}
+		}
+	})
+}
+
+func indexOf(ids []uuid.UUID, target uuid.UUID) int {
+	for i, id := range ids {
+		if id == target {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRecomputeWorker_MonotonicChangelog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cohortID := uuid.New()
+	mockGetter := mocks.NewMockCohortGetter(ctrl)
+	mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+		ID: cohortID,
+		Rules: cohort.Rules{
+			Operator:   cohort.OperatorAND,
+			Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+		},
+	}, nil).Times(2)
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	// First job: user1 qualifies and joins; second job: user1 no longer qualifies
+	gomock.InOrder(
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user2", "user1"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user2"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user1", "user2"), nil),
+	)
+
+	batch := &recordingBatch{}
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+			return batch, nil
+		}).AnyTimes()
+
+	// Both jobs observe the same wall clock time
+	worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+	worker.SetClock(&fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+
+	worker.RunJob(context.Background(), cohort.NewRecomputeJob(cohortID))
+	worker.RunJob(context.Background(), cohort.NewRecomputeJob(cohortID))
+
+	var user1 [][]any
+	for _, row := range batch.changelogRows {
+		if row[1] == "user1" {
+			user1 = append(user1, row)
+		}
+	}
+	if len(user1) != 2 || user1[0][3] != int8(1) || user1[1][3] != int8(-1) {
+		t.Fatalf("user1 changelog = %v, expected a join then a leave", user1)
+	}
+	joinedAt, leftAt := user1[0][4].(time.Time), user1[1][4].(time.Time)
+	if !leftAt.After(joinedAt) {
+		t.Errorf("leave changed_at = %v, expected after join at %v", leftAt, joinedAt)
+	}
+
+	if batch.changelogRows[0][1] != "user1" || batch.changelogRows[1][1] != "user2" {
+		t.Errorf("first job changelog order = %v, %v, expected sorted user IDs", batch.changelogRows[0][1], batch.changelogRows[1][1])
+	}
+}
+
+func TestRecomputeWorker_ChangeReason(t *testing.T) {
+	tests := []struct {
+		name           string
+		needsRecompute bool
+		expected       cohort.ChangeReason
+	}{
+		{name: "scheduled recompute", needsRecompute: false, expected: cohort.ChangeReasonRecompute},
+		{name: "first recompute after a rules edit", needsRecompute: true, expected: cohort.ChangeReasonRuleChange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cohortID := uuid.New()
+			mockGetter := mocks.NewMockCohortGetter(ctrl)
+			mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+				ID: cohortID,
+				Rules: cohort.Rules{
+					Operator:   cohort.OperatorAND,
+					Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+				},
+				NeedsRecompute: tt.needsRecompute,
+			}, nil)
+
+			mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+			gomock.InOrder(
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "user1"), nil),
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "user2"), nil),
+			)
+
+			batch := &recordingBatch{}
+			mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, query string) (cohort.Batch, error) {
+					batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+					return batch, nil
+				}).AnyTimes()
+
+			mockExporter := mocks.NewMockChangelogExporter(ctrl)
+			var exported []cohort.ChangelogEntry
+			mockExporter.EXPECT().
+				ExportChangelog(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, entries []cohort.ChangelogEntry) error {
+					exported = append(exported, entries...)
+					return nil
+				}).Times(2)
+
+			worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+			worker.SetChangelogExporter(mockExporter)
+
+			job := cohort.NewRecomputeJob(cohortID)
+			worker.RunJob(context.Background(), job)
+
+			if job.Reason != tt.expected {
+				t.Errorf("job reason = %v, expected %v", job.Reason, tt.expected)
+			}
+			if len(batch.changelogRows) != 2 {
+				t.Fatalf("changelog rows = %d, expected 2", len(batch.changelogRows))
+			}
+			for _, row := range batch.changelogRows {
+				if row[6] != string(tt.expected) {
+					t.Errorf("changelog reason for %v = %v, expected %v", row[1], row[6], tt.expected)
+				}
+			}
+			for _, e := range exported {
+				if e.Reason != tt.expected {
+					t.Errorf("exported reason for %v = %v, expected %v", e.UserID, e.Reason, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+// fakeOverrideSource serves fixed membership overrides
+type fakeOverrideSource struct {
+	overrides map[string]int8
+	cleared   []uuid.UUID
+}
+
+func (s *fakeOverrideSource) GetOverrides(ctx context.Context, cohortID uuid.UUID) (map[string]int8, error) {
+	return s.overrides, nil
+}
+
+func (s *fakeOverrideSource) ClearOverrides(ctx context.Context, cohortID uuid.UUID) error {
+	s.cleared = append(s.cleared, cohortID)
+	return nil
+}
+
+func TestRecomputeWorker_MembershipOverrides(t *testing.T) {
+	tests := []struct {
+		name            string
+		ignoreOverrides bool
+		expected        map[string]int8
+		expectCleared   bool
+	}{
+		{
+			name:     "overrides are preserved",
+			expected: map[string]int8{},
+		},
+		{
+			name:            "ignoring overrides reverts and clears them",
+			ignoreOverrides: true,
+			expected:        map[string]int8{"forced-in": -1, "forced-out": 1},
+			expectCleared:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cohortID := uuid.New()
+			mockGetter := mocks.NewMockCohortGetter(ctrl)
+			mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+				ID: cohortID,
+				Rules: cohort.Rules{
+					Operator:   cohort.OperatorAND,
+					Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+				},
+			}, nil)
+
+			// The rules match forced-out but not forced-in, and both overrides
+			// were applied by an earlier manual change
+			mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+			gomock.InOrder(
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "buyer", "forced-out"), nil),
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "buyer", "forced-in"), nil),
+			)
+
+			batch := &recordingBatch{}
+			mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, query string) (cohort.Batch, error) {
+					batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+					return batch, nil
+				}).AnyTimes()
+
+			source := &fakeOverrideSource{overrides: map[string]int8{"forced-in": 1, "forced-out": -1}}
+			worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+			worker.SetMembershipOverrideSource(source)
+
+			job := cohort.NewRecomputeJob(cohortID)
+			job.IgnoreOverrides = tt.ignoreOverrides
+			worker.RunJob(context.Background(), job)
+
+			if job.Status != cohort.RecomputeStatusCompleted {
+				t.Fatalf("job status = %v, expected completed: %s", job.Status, job.Error)
+			}
+			changes := make(map[string]int8)
+			for _, row := range batch.changelogRows {
+				changes[row[1].(string)] = row[3].(int8)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("changes = %v, expected %v", changes, tt.expected)
+			}
+			if cleared := len(source.cleared) == 1; cleared != tt.expectCleared {
+				t.Errorf("cleared = %v, expected %v", source.cleared, tt.expectCleared)
+			}
+		})
+	}
+}
+
+// batchRecordingProducer records each batch of produced membership changes
+type batchRecordingProducer struct {
+	cohortNames []string
+	batches     [][]cohort.ChangelogEntry
+}
+
+func (p *batchRecordingProducer) ProduceMembershipChanges(ctx context.Context, cohortName string, changes []cohort.ChangelogEntry) error {
+	p.cohortNames = append(p.cohortNames, cohortName)
+	p.batches = append(p.batches, append([]cohort.ChangelogEntry(nil), changes...))
+	return nil
+}
+
+func TestRecomputeWorker_ProduceChangesInBatches(t *testing.T) {
+	tests := []struct {
+		name             string
+		produceBatchSize int
+		expected         []int
+	}{
+		{name: "configured batch size", produceBatchSize: 2, expected: []int{2, 2, 1}},
+		{name: "defaults to the ClickHouse batch size", produceBatchSize: 0, expected: []int{3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cohortID := uuid.New()
+			mockGetter := mocks.NewMockCohortGetter(ctrl)
+			mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+				ID:   cohortID,
+				Name: "buyers",
+				Rules: cohort.Rules{
+					Operator:   cohort.OperatorAND,
+					Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+				},
+			}, nil)
+
+			// Three users join and two leave
+			mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+			gomock.InOrder(
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "user1", "user2", "user3"), nil),
+				mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(newRowScanner(ctrl, "user4", "user5"), nil),
+			)
+			mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, query string) (cohort.Batch, error) {
+					return &recordingBatch{}, nil
+				}).AnyTimes()
+
+			producer := &batchRecordingProducer{}
+			worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+			worker.SetBatchSize(3)
+			worker.SetChangeProducer(producer, tt.produceBatchSize)
+
+			job := cohort.NewRecomputeJob(cohortID)
+			worker.RunJob(context.Background(), job)
+
+			if job.Status != cohort.RecomputeStatusCompleted {
+				t.Fatalf("job status = %v, expected completed: %s", job.Status, job.Error)
+			}
+			sizes := make([]int, len(producer.batches))
+			var joins, leaves int
+			for i, batch := range producer.batches {
+				sizes[i] = len(batch)
+				for _, change := range batch {
+					if change.NewStatus == 1 {
+						joins++
+					} else {
+						leaves++
+					}
+				}
+			}
+			if !reflect.DeepEqual(sizes, tt.expected) {
+				t.Errorf("batch sizes = %v, expected %v", sizes, tt.expected)
+			}
+			if joins != 3 || leaves != 2 {
+				t.Errorf("joins = %d, leaves = %d, expected 3 and 2", joins, leaves)
+			}
+			for _, name := range producer.cohortNames {
+				if name != "buyers" {
+					t.Errorf("cohort name = %q, expected buyers", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRecomputeWorker_AssignsVariants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cohortID := uuid.New()
+	variants := []cohort.Variant{{Name: "control", Weight: 1}, {Name: "treatment", Weight: 1}}
+	mockGetter := mocks.NewMockCohortGetter(ctrl)
+	mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+		ID:       cohortID,
+		Name:     "buyers",
+		Variants: variants,
+		Rules: cohort.Rules{
+			Operator:   cohort.OperatorAND,
+			Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+		},
+	}, nil)
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	gomock.InOrder(
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user1", "user2", "user3"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl), nil),
+	)
+	batch := &recordingBatch{}
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+			return batch, nil
+		}).AnyTimes()
+
+	producer := &batchRecordingProducer{}
+	worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+	worker.SetChangeProducer(producer, 0)
+
+	job := cohort.NewRecomputeJob(cohortID)
+	worker.RunJob(context.Background(), job)
+	if job.Status != cohort.RecomputeStatusCompleted {
+		t.Fatalf("job status = %v, expected completed: %s", job.Status, job.Error)
+	}
+
+	if len(batch.changelogRows) != 3 {
+		t.Fatalf("changelog rows = %d, expected 3", len(batch.changelogRows))
+	}
+	for _, row := range batch.changelogRows {
+		userID := row[1].(string)
+		expected := cohort.AssignVariant(cohortID, userID, variants)
+		if variant := row[len(row)-1]; variant != expected {
+			t.Errorf("%s logged in variant %v, expected %q", userID, variant, expected)
+		}
+	}
+	for _, changes := range producer.batches {
+		for _, change := range changes {
+			expected := cohort.AssignVariant(cohortID, change.UserID, variants)
+			if change.Variant != expected {
+				t.Errorf("%s produced in variant %q, expected %q", change.UserID, change.Variant, expected)
+			}
+		}
+	}
+}
+
+func TestRecomputeWorker_Hysteresis(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cohortID := uuid.New()
+	mockGetter := mocks.NewMockCohortGetter(ctrl)
+	mockGetter.EXPECT().GetByID(gomock.Any(), cohortID).Return(&cohort.Cohort{
+		ID: cohortID,
+		Rules: cohort.Rules{
+			Operator:   cohort.OperatorAND,
+			Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+		},
+	}, nil).AnyTimes()
+
+	// Each recompute's matching users; steady and flapper stay members
+	// throughout since no leave is applied before the last run
+	runs := []struct {
+		name     string
+		matching []any
+		expected map[string]int8
+		deferred int64
+	}{
+		{name: "a single miss does not emit a leave", matching: []any{"steady"}, expected: map[string]int8{}, deferred: 1},
+		{name: "matching again resets the miss", matching: []any{"steady", "flapper"}, expected: map[string]int8{}},
+		{name: "the miss count starts over", matching: []any{"steady", "newcomer"}, expected: map[string]int8{}, deferred: 2},
+		{name: "a second consecutive miss emits the leave and join", matching: []any{"steady", "newcomer"}, expected: map[string]int8{"flapper": -1, "newcomer": 1}},
+	}
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	var calls []any
+	for _, run := range runs {
+		calls = append(calls,
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(newRowScanner(ctrl, run.matching...), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(newRowScanner(ctrl, "steady", "flapper"), nil),
+		)
+	}
+	gomock.InOrder(calls...)
+
+	batch := &recordingBatch{}
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+			return batch, nil
+		}).AnyTimes()
+
+	worker := cohort.NewRecomputeWorker(mockCHClient, mockGetter)
+	worker.SetHysteresis(2)
+
+	for _, run := range runs {
+		batch.changelogRows = nil
+		job := cohort.NewRecomputeJob(cohortID)
+		worker.RunJob(context.Background(), job)
+
+		if job.Status != cohort.RecomputeStatusCompleted {
+			t.Fatalf("%s: job status = %v, expected completed: %s", run.name, job.Status, job.Error)
+		}
+		changes := make(map[string]int8)
+		for _, row := range batch.changelogRows {
+			changes[row[1].(string)] = row[3].(int8)
+		}
+		if !reflect.DeepEqual(changes, run.expected) {
+			t.Errorf("%s: changes = %v, expected %v", run.name, changes, run.expected)
+		}
+		if job.Progress.MembersDeferred != run.deferred {
+			t.Errorf("%s: deferred = %d, expected %d", run.name, job.Progress.MembersDeferred, run.deferred)
+		}
+	}
+}
+
+func TestRecomputeWorker_ExpireMembers(t *testing.T) {
+	now := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	t.Run("members past the TTL leave", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		c := &cohort.Cohort{ID: uuid.New(), Name: "recent-buyers", MembershipTTL: "7d"}
+
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), c.ID, now.Add(-7*24*time.Hour)).
+			Return(newRowScanner(ctrl, "lapsed", "forced-in"), nil)
+		batch := &recordingBatch{}
+		mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, query string) (cohort.Batch, error) {
+				batch.changelog = strings.Contains(query, "cohort_membership_changelog")
+				return batch, nil
+			}).Times(2)
+
+		producer := &batchRecordingProducer{}
+		worker := cohort.NewRecomputeWorker(mockCHClient, mocks.NewMockCohortGetter(ctrl))
+		worker.SetClock(&fakeClock{now: now})
+		worker.SetChangeProducer(producer, 0)
+		worker.SetMembershipOverrideSource(&fakeOverrideSource{overrides: map[string]int8{"forced-in": 1}})
+
+		n, err := worker.ExpireMembers(context.Background(), c)
+		if err != nil {
+			t.Fatalf("ExpireMembers() error = %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expired = %d, expected 1", n)
+		}
+		if len(batch.changelogRows) != 1 {
+			t.Fatalf("changelog rows = %v, expected one leave", batch.changelogRows)
+		}
+		row := batch.changelogRows[0]
+		if row[1] != "lapsed" || row[3] != int8(-1) || row[6] != string(cohort.ChangeReasonExpired) {
+			t.Errorf("changelog row = %v, expected lapsed leaving with reason expired", row)
+		}
+		if len(producer.batches) != 1 || producer.batches[0][0].Reason != cohort.ChangeReasonExpired {
+			t.Errorf("produced = %+v, expected the expired leave", producer.batches)
+		}
+	})
+
+	t.Run("cohort without a TTL is skipped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		worker := cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), mocks.NewMockCohortGetter(ctrl))
+		n, err := worker.ExpireMembers(context.Background(), &cohort.Cohort{
+			ID: uuid.New(),
+			Rules: cohort.Rules{
+				Operator:   cohort.OperatorAND,
+				Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+			},
+		})
+		if err != nil || n != 0 {
+			t.Errorf("ExpireMembers() = %d, %v, expected nothing expired", n, err)
+		}
+	})
+}
+
+func TestRecomputeWorker_Preview(t *testing.T) {
+	rules := cohort.Rules{
+		Operator:   cohort.OperatorAND,
+		Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+	}
+
+	// serve answers the preview query with count matches and sample
+	serve := func(ctrl *gomock.Controller, client *mocks.MockClickHouseClient, count uint64, sample []string, queried *string) {
+		rows := mocks.NewMockRowScanner(ctrl)
+		rows.EXPECT().Next().Return(true)
+		rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*uint64) = count
+			*dest[1].(*[]string) = sample
+			return nil
+		})
+		rows.EXPECT().Close().Return(nil)
+		client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+				*queried = query
+				return rows, nil
+			})
+	}
+
+	t.Run("caps and flags the sample", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var queried string
+		client := mocks.NewMockClickHouseClient(ctrl)
+		serve(ctrl, client, 50, []string{"user-1", "user-2", "user-3"}, &queried)
+
+		worker := cohort.NewRecomputeWorker(client, nil)
+		worker.SetPreviewSampleSize(3)
+		preview, err := worker.Preview(context.Background(), rules)
+		if err != nil {
+			t.Fatalf("Preview() error = %v", err)
+		}
+		if !strings.Contains(queried, "groupArray(3)(user_id)") {
+			t.Errorf("query = %q, expected the sample capped at 3", queried)
+		}
+		if preview.Count != 50 || len(preview.SampleUserIDs) != 3 || !preview.Truncated {
+			t.Errorf("preview = %+v, expected 50 users with a truncated sample of 3", preview)
+		}
+	})
+
+	t.Run("lists small matches in full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var queried string
+		client := mocks.NewMockClickHouseClient(ctrl)
+		serve(ctrl, client, 2, []string{"user-1", "user-2"}, &queried)
+
+		worker := cohort.NewRecomputeWorker(client, nil)
+		worker.SetPreviewSampleSize(3)
+		preview, err := worker.Preview(context.Background(), rules)
+		if err != nil {
+			t.Fatalf("Preview() error = %v", err)
+		}
+		if preview.Count != 2 || len(preview.SampleUserIDs) != 2 || preview.Truncated {
+			t.Errorf("preview = %+v, expected 2 users listed in full", preview)
+		}
+	})
+}
+
+func TestRecomputeWorker_EstimateCount(t *testing.T) {
+	rules := cohort.Rules{
+		Operator: cohort.OperatorAND,
+		Conditions: []cohort.Condition{
+			{Type: cohort.ConditionTypeEvent, EventName: "purchase"},
+			{Type: cohort.ConditionTypeEvent, EventName: "signup"},
+		},
+	}
+
+	// serve answers the sampling key lookup with samplingKey and the count
+	// query with count, recording the count query
+	serve := func(ctrl *gomock.Controller, client *mocks.MockClickHouseClient, samplingKey string, count uint64, counted *string) {
+		client.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+				if strings.Contains(query, "system.tables") {
+					return newRowScanner(ctrl, samplingKey), nil
+				}
+				*counted = query
+				return newRowScanner(ctrl, count), nil
+			}).AnyTimes()
+	}
+
+	t.Run("approximate mode samples every condition by user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var counted string
+		client := mocks.NewMockClickHouseClient(ctrl)
+		serve(ctrl, client, "cityHash64(user_id)", 100, &counted)
+
+		worker := cohort.NewRecomputeWorker(client, nil)
+		estimate, err := worker.EstimateCount(context.Background(), rules, true)
+		if err != nil {
+			t.Fatalf("EstimateCount() error = %v", err)
+		}
+
+		if n := strings.Count(counted, "FROM events_raw SAMPLE 0.1 WHERE"); n != 2 {
+			t.Errorf("sampled subqueries = %d, expected 2 in %q", n, counted)
+		}
+		if !estimate.Approximate || estimate.SampleRate != 0.1 {
+			t.Errorf("estimate = %+v, expected approximate at rate 0.1", estimate)
+		}
+		if estimate.Size != 1000 {
+			t.Errorf("Size = %d, expected 1000", estimate.Size)
+		}
+		// 1.96 * sqrt(100 * 0.9) / 0.1
+		if estimate.ErrorBound != 186 {
+			t.Errorf("ErrorBound = %d, expected 186", estimate.ErrorBound)
+		}
+	})
+
+	t.Run("falls back to exact without a user sampling key", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var counted string
+		client := mocks.NewMockClickHouseClient(ctrl)
+		serve(ctrl, client, "", 42, &counted)
+
+		worker := cohort.NewRecomputeWorker(client, nil)
+		estimate, err := worker.EstimateCount(context.Background(), rules, true)
+		if err != nil {
+			t.Fatalf("EstimateCount() error = %v", err)
+		}
+
+		if strings.Contains(counted, "SAMPLE") {
+			t.Errorf("query should not sample, got %q", counted)
+		}
+		if estimate.Approximate || estimate.Size != 42 || estimate.ErrorBound != 0 {
+			t.Errorf("estimate = %+v, expected an exact size of 42", estimate)
+		}
+	})
+
+	t.Run("exact mode does not sample", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var counted string
+		client := mocks.NewMockClickHouseClient(ctrl)
+		serve(ctrl, client, "cityHash64(user_id)", 42, &counted)
+
+		worker := cohort.NewRecomputeWorker(client, nil)
+		estimate, err := worker.EstimateCount(context.Background(), rules, false)
+		if err != nil {
+			t.Fatalf("EstimateCount() error = %v", err)
+		}
+		if strings.Contains(counted, "SAMPLE") || estimate.Approximate {
+			t.Errorf("estimate = %+v from %q, expected an exact count", estimate, counted)
+		}
+	})
+}
+
+// recordingBatch records the rows appended to changelog batches
+type recordingBatch struct {
+	changelog     bool
+	changelogRows [][]any
+}
+
+func (b *recordingBatch) Append(args ...any) error {
+	if b.changelog {
+		b.changelogRows = append(b.changelogRows, args)
+	}
+	return nil
+}
+
+func (b *recordingBatch) Send() error { return nil }
+
+func TestRecomputeWorker_SQLDebug(t *testing.T) {
+	rules := cohort.Rules{
+		Operator: cohort.OperatorAND,
+		Conditions: []cohort.Condition{{
+			Type:         cohort.ConditionTypeProperty,
+			PropertyName: "plan",
+			Operator:     cohort.ComparisonEQ,
+			Value:        "enterprise",
+		}},
+	}
+
+	preview := func(t *testing.T, debug cohort.SQLDebug) string {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, uint64(3)), nil)
+
+		worker := cohort.NewRecomputeWorker(mockCHClient, nil)
+		worker.SetSQLDebug(debug)
+
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		if _, err := worker.PreviewCount(context.Background(), rules); err != nil {
+			t.Fatalf("PreviewCount() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		if out := preview(t, cohort.SQLDebug{}); strings.Contains(out, "sql:") {
+			t.Errorf("log = %q, expected no SQL", out)
+		}
+	})
+
+	t.Run("debug logs the query and args", func(t *testing.T) {
+		out := preview(t, cohort.SQLDebug{Enabled: true})
+		if !strings.Contains(out, "preview sql:") || !strings.Contains(out, "JSONExtractString(properties, 'plan')") {
+			t.Errorf("log = %q, expected the preview query", out)
+		}
+		if !strings.Contains(out, "enterprise") {
+			t.Errorf("log = %q, expected the bound value", out)
+		}
+	})
+
+	t.Run("redaction hides bound values", func(t *testing.T) {
+		out := preview(t, cohort.SQLDebug{Enabled: true, RedactArgs: true})
+		if strings.Contains(out, "enterprise") || !strings.Contains(out, "<redacted>") {
+			t.Errorf("log = %q, expected redacted args", out)
+		}
+	})
+
+	t.Run("recompute job records the SQL when attached", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		worker := cohort.NewRecomputeWorker(mockCHClient, cohort.NewService(mockQuerier, nil))
+		worker.SetSQLDebug(cohort.SQLDebug{Enabled: true, RedactArgs: true, AttachToJob: true})
+
+		cohortID := uuid.New()
+		rulesJSON, _ := json.Marshal(rules)
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(db.GetCohortRow{
+			ID:    pgtype.UUID{Bytes: cohortID, Valid: true},
+			Rules: rulesJSON,
+		}, nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl), nil).Times(2)
+
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+
+		job := cohort.NewRecomputeJob(cohortID)
+		worker.RunJob(context.Background(), job)
+
+		if job.SQL == nil || !strings.Contains(job.SQL.Query, "JSONExtractString(properties, 'plan')") {
+			t.Fatalf("SQL = %+v, expected the recompute query", job.SQL)
+		}
+		if len(job.SQL.Args) != 1 || job.SQL.Args[0] != "<redacted>" {
+			t.Errorf("Args = %v, expected [<redacted>]", job.SQL.Args)
+		}
+	})
+}
+
+func TestRecomputeWorker_PurgeJobs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	worker.SetClock(&fakeClock{now: now})
+	worker.SetJobRetention(7 * 24 * time.Hour)
+
+	job := func(cohortID uuid.UUID, status cohort.RecomputeStatus, age time.Duration) *cohort.RecomputeJob {
+		j := cohort.NewRecomputeJob(cohortID)
+		j.Status = status
+		j.StartedAt = now.Add(-age - time.Minute)
+		if status == cohort.RecomputeStatusCompleted || status == cohort.RecomputeStatusFailed {
+			completedAt := now.Add(-age)
+			j.CompletedAt = &completedAt
+		}
+		if err := worker.SubmitJob(j); err != nil {
+			t.Fatalf("SubmitJob() error = %v", err)
+		}
+		return j
+	}
+
+	busyCohort := uuid.New()
+	quietCohort := uuid.New()
+
+	oldCompleted := job(busyCohort, cohort.RecomputeStatusCompleted, 30*24*time.Hour)
+	oldFailed := job(busyCohort, cohort.RecomputeStatusFailed, 8*24*time.Hour)
+	recent := job(busyCohort, cohort.RecomputeStatusCompleted, 24*time.Hour)
+	quietLatest := job(quietCohort, cohort.RecomputeStatusCompleted, 60*24*time.Hour)
+
+	if purged := worker.PurgeJobs(); purged != 2 {
+		t.Errorf("PurgeJobs() = %d, expected 2", purged)
+	}
+
+	for _, tc := range []struct {
+		name string
+		job  *cohort.RecomputeJob
+		kept bool
+	}{
+		{"old completed job", oldCompleted, false},
+		{"old failed job", oldFailed, false},
+		{"recent job", recent, true},
+		{"latest job of a quiet cohort", quietLatest, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := worker.GetJob(tc.job.ID); ok != tc.kept {
+				t.Errorf("GetJob() found = %v, expected %v", ok, tc.kept)
+			}
+		})
+	}
+
+	t.Run("disabled retention keeps jobs", func(t *testing.T) {
+		worker.SetJobRetention(0)
+		job(quietCohort, cohort.RecomputeStatusCompleted, 90*24*time.Hour)
+		if purged := worker.PurgeJobs(); purged != 0 {
+			t.Errorf("PurgeJobs() = %d, expected 0", purged)
+		}
+	})
+}
+
+func TestRecomputeWorker_CancelJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The mock ClickHouse client expects no calls, so the cancelled job
+	// reaching the query or apply phase fails the test
+	processed := make(chan uuid.UUID, 2)
+	mockGetter := mocks.NewMockCohortGetter(ctrl)
+	mockGetter.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id uuid.UUID) (*cohort.Cohort, error) {
+			processed <- id
+			return nil, errors.New("not found")
+		},
+	).Times(1)
+
+	worker := cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), mockGetter)
+
+	cancelled := cohort.NewRecomputeJob(uuid.New())
+	next := cohort.NewRecomputeJob(uuid.New())
+	for _, job := range []*cohort.RecomputeJob{cancelled, next} {
+		if err := worker.SubmitJob(job); err != nil {
+			t.Fatalf("SubmitJob() error = %v", err)
+		}
+	}
+
+	if err := worker.CancelJob(cancelled.ID); err != nil {
+		t.Fatalf("CancelJob() error = %v", err)
+	}
+	if err := worker.CancelJob(uuid.New()); !errors.Is(err, cohort.ErrRecomputeJobNotFound) {
+		t.Errorf("CancelJob() of unknown job error = %v, expected %v", err, cohort.ErrRecomputeJobNotFound)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	worker.Start(ctx)
+
+	// Jobs of equal priority run in order, so the next job running means the
+	// cancelled one was skipped
+	select {
+	case id := <-processed:
+		if id != next.CohortID {
+			t.Errorf("processed cohort = %v, expected %v", id, next.CohortID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the next job")
+	}
+
+	job, ok := worker.GetJob(cancelled.ID)
+	if !ok {
+		t.Fatal("GetJob() found no cancelled job")
+	}
+	if job.Status != cohort.RecomputeStatusFailed || job.Error != "cancelled" {
+		t.Errorf("cancelled job status = %s (%q), expected %s (%q)", job.Status, job.Error, cohort.RecomputeStatusFailed, "cancelled")
+	}
+	if err := worker.CancelJob(cancelled.ID); !errors.Is(err, cohort.ErrRecomputeJobFinished) {
+		t.Errorf("CancelJob() of finished job error = %v, expected %v", err, cohort.ErrRecomputeJobFinished)
+	}
+}
+
+func TestRecomputeWorker_IncrementalRecompute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	mockExporter := mocks.NewMockChangelogExporter(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+	worker.SetChangelogExporter(mockExporter)
+
+	cohortID := uuid.New()
+	rulesJSON, _ := json.Marshal(cohort.Rules{
+		Operator:   cohort.OperatorAND,
+		Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+	})
+	mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(db.GetCohortRow{
+		ID:             pgtype.UUID{Bytes: cohortID, Valid: true},
+		Rules:          rulesJSON,
+		NeedsRecompute: true,
+	}, nil)
+
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var matchingQuery string
+	var matchingArgs []any
+
+	// user1 matches among the users with recent events; user2 had recent
+	// events and no longer matches; user3 had none and is left alone
+	gomock.InOrder(
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, query string, args ...any) (cohort.RowScanner, error) {
+				matchingQuery, matchingArgs = query, args
+				return newRowScanner(ctrl, "user1"), nil
+			}),
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, "user2", "user3"), nil),
+		mockCHClient.EXPECT().Query(gomock.Any(), "SELECT DISTINCT user_id FROM events_raw WHERE timestamp >= ?", since).
+			Return(newRowScanner(ctrl, "user1", "user2"), nil),
+	)
+
+	batch := mocks.NewMockBatch(ctrl)
+	batch.EXPECT().Append(gomock.Any()).Return(nil).AnyTimes()
+	batch.EXPECT().Send().Return(nil).AnyTimes()
+	mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(batch, nil).AnyTimes()
+
+	changes := make(map[string]int8)
+	mockExporter.EXPECT().
+		ExportChangelog(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, entries []cohort.ChangelogEntry) error {
+			for _, e := range entries {
+				changes[e.UserID] = e.NewStatus
+			}
+			return nil
+		}).
+		AnyTimes()
+
+	job := cohort.NewRecomputeJob(cohortID)
+	job.Progress.Since = &since
+	worker.RunJob(context.Background(), job)
+
+	if job.Status != cohort.RecomputeStatusCompleted {
+		t.Fatalf("Status = %v, expected completed (error: %s)", job.Status, job.Error)
+	}
+	if !strings.HasSuffix(matchingQuery, "WHERE user_id IN (SELECT DISTINCT user_id FROM events_raw WHERE timestamp >= ?)") {
+		t.Errorf("matching query = %q, expected it restricted to users with events since %v", matchingQuery, since)
+	}
+	if len(matchingArgs) == 0 || matchingArgs[len(matchingArgs)-1] != since {
+		t.Errorf("matching query args = %v, expected to end with %v", matchingArgs, since)
+	}
+	if expected := map[string]int8{"user1": 1, "user2": -1}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("changes = %v, expected %v", changes, expected)
+	}
+	if job.Progress.Since == nil || !job.Progress.Since.Equal(since) {
+		t.Errorf("Progress.Since = %v, expected %v", job.Progress.Since, since)
+	}
+	if job.Reason != cohort.ChangeReasonRecompute {
+		t.Errorf("Reason = %s, expected %s since incremental recomputes don't apply rule edits", job.Reason, cohort.ChangeReasonRecompute)
+	}
+}
@@ -0,0 +1,56 @@
+package cohort
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventRetentionSource reports how long a project's events are kept
+type EventRetentionSource interface {
+	EventRetention(ctx context.Context, projectID uuid.UUID) (time.Duration, error)
+}
+
+// SetEventRetentionSource makes rules whose time windows reach back past
+// their project's event retention invalid
+func (s *Service) SetEventRetentionSource(source EventRetentionSource) {
+	s.retention = source
+}
+
+// checkEventRetention validates rules against the project's event retention
+func (s *Service) checkEventRetention(ctx context.Context, projectID uuid.UUID, rules Rules) error {
+	if s.retention == nil {
+		return nil
+	}
+	retention, err := s.retention.EventRetention(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to look up event retention: %w", err)
+	}
+	return rules.ValidateRetention(retention, time.Now().UTC())
+}
+
+// ValidateRetention checks that no condition's time window starts before
+// now less retention, since the events it would count have been deleted and
+// the condition would silently match on part of its window. Windows that
+// can't be resolved are left to fail when the query is built.
+func (r Rules) ValidateRetention(retention time.Duration, now time.Time) error {
+	if retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-retention)
+	qb := NewQueryBuilderWithTime(now)
+
+	for i, cond := range r.ResolveTimeWindows().Group().allConditions() {
+		for _, window := range []*TimeWindow{cond.TimeWindow, cond.CompareWindow} {
+			start, _, err := qb.resolveTimeWindow(window)
+			if err != nil || start == nil || !start.Before(cutoff) {
+				continue
+			}
+			return fmt.Errorf("%w: condition %d reaches back to %s, past the event retention of %d days",
+				ErrInvalidRules, i, start.Format(time.DateOnly), int(retention/(24*time.Hour)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package cohort
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMinRecomputeInterval is the shortest per-cohort recompute interval accepted by default
+const DefaultMinRecomputeInterval = 5 * time.Minute
+
+// Clock abstracts time for the scheduler and recompute worker
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// ActiveCohortLister lists the cohorts eligible for scheduled recomputes and
+// live evaluation
+type ActiveCohortLister interface {
+	ListAllActive(ctx context.Context) ([]*Cohort, error)
+}
+
+// RecomputeTrigger submits scheduled recompute jobs
+type RecomputeTrigger interface {
+	TriggerScheduledRecompute(ctx context.Context, cohortID uuid.UUID) (*RecomputeResponse, error)
+}
+
+// RecomputeHistory returns a cohort's most recent finished recompute jobs,
+// newest first
+type RecomputeHistory interface {
+	RecomputeJobHistory(ctx context.Context, cohortID uuid.UUID, limit int) ([]*RecomputeJob, error)
+}
+
+// recomputeHistoryDepth is how many finished jobs are searched for the last
+// completed recompute when seeding a cohort's schedule
+const recomputeHistoryDepth = 20
+
+// MembershipExpirer removes members whose membership lifetime has passed
+type MembershipExpirer interface {
+	ExpireMembers(ctx context.Context, c *Cohort) (int, error)
+}
+
+// RecomputeScheduler enqueues recomputes for active cohorts on their own cadence
+type RecomputeScheduler struct {
+	lister  ActiveCohortLister
+	trigger RecomputeTrigger
+	expirer MembershipExpirer
+	history RecomputeHistory
+	clock   Clock
+	tick    time.Duration
+	lastRun map[uuid.UUID]time.Time
+	mu      sync.Mutex
+}
+
+// NewRecomputeScheduler creates a new recompute scheduler that checks for due cohorts every tick
+func NewRecomputeScheduler(lister ActiveCohortLister, trigger RecomputeTrigger, tick time.Duration) *RecomputeScheduler {
+	return &RecomputeScheduler{
+		lister:  lister,
+		trigger: trigger,
+		clock:   systemClock{},
+		tick:    tick,
+		lastRun: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// SetClock replaces the scheduler's clock
+func (s *RecomputeScheduler) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// SetMembershipExpirer enables sweeping expired members of cohorts with a
+// membership TTL on every tick
+func (s *RecomputeScheduler) SetMembershipExpirer(expirer MembershipExpirer) {
+	s.expirer = expirer
+}
+
+// SetRecomputeHistory seeds each cohort's schedule from its last completed
+// recompute, so restarts don't push back cohorts' next scheduled runs
+func (s *RecomputeScheduler) SetRecomputeHistory(history RecomputeHistory) {
+	s.history = history
+}
+
+// Start begins checking for due cohorts
+func (s *RecomputeScheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Tick(ctx)
+			}
+		}
+	}()
+}
+
+// Tick enqueues a recompute for every active cohort whose interval has elapsed.
+// A cohort is first scheduled one interval after its last completed recompute,
+// or straight away if it has none; without a recompute history it is first
+// scheduled one interval after the scheduler observes it. Cohorts with a job
+// already pending or running are retried on the next tick.
+func (s *RecomputeScheduler) Tick(ctx context.Context) {
+	cohorts, err := s.lister.ListAllActive(ctx)
+	if err != nil {
+		log.Printf("recompute scheduler: failed to list active cohorts: %v", err)
+		return
+	}
+
+	s.expireMembers(ctx, cohorts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	seen := make(map[uuid.UUID]struct{}, len(cohorts))
+
+	for _, c := range cohorts {
+		seen[c.ID] = struct{}{}
+
+		if c.RecomputeInterval == "" {
+			delete(s.lastRun, c.ID)
+			continue
+		}
+		interval, err := parseDuration(c.RecomputeInterval)
+		if err != nil || interval <= 0 {
+			continue
+		}
+
+		last, ok := s.lastRun[c.ID]
+		if !ok {
+			last = s.lastCompleted(ctx, c.ID, now)
+			s.lastRun[c.ID] = last
+		}
+		if now.Sub(last) < interval {
+			continue
+		}
+
+		if _, err := s.trigger.TriggerScheduledRecompute(ctx, c.ID); err != nil {
+			if err != ErrRecomputeInProgress {
+				log.Printf("recompute scheduler: failed to enqueue cohort %s: %v", c.ID, err)
+			}
+			continue
+		}
+		s.lastRun[c.ID] = now
+	}
+
+	// Forget cohorts that are no longer active
+	for id := range s.lastRun {
+		if _, ok := seen[id]; !ok {
+			delete(s.lastRun, id)
+		}
+	}
+}
+
+// lastCompleted returns when the cohort's last recompute completed, the zero
+// time if it never completed one, or now if there is no history to consult
+func (s *RecomputeScheduler) lastCompleted(ctx context.Context, cohortID uuid.UUID, now time.Time) time.Time {
+	if s.history == nil {
+		return now
+	}
+
+	jobs, err := s.history.RecomputeJobHistory(ctx, cohortID, recomputeHistoryDepth)
+	if err != nil {
+		log.Printf("recompute scheduler: failed to load job history of cohort %s: %v", cohortID, err)
+		return now
+	}
+	for _, job := range jobs {
+		if job.Status == RecomputeStatusCompleted && job.CompletedAt != nil {
+			return *job.CompletedAt
+		}
+	}
+	return time.Time{}
+}
+
+// expireMembers sweeps the expired members of cohorts with a membership lifetime
+func (s *RecomputeScheduler) expireMembers(ctx context.Context, cohorts []*Cohort) {
+	if s.expirer == nil {
+		return
+	}
+
+	for _, c := range cohorts {
+		if c.MembershipLifetime() <= 0 {
+			continue
+		}
+		n, err := s.expirer.ExpireMembers(ctx, c)
+		if err != nil {
+			log.Printf("recompute scheduler: failed to expire members of cohort %s: %v", c.ID, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("recompute scheduler: expired %d members of cohort %s", n, c.ID)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package cohort_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+type fakeCohortLister struct {
+	cohorts []*cohort.Cohort
+}
+
+func (l *fakeCohortLister) ListAllActive(ctx context.Context) ([]*cohort.Cohort, error) {
+	return l.cohorts, nil
+}
+
+type fakeRecomputeTrigger struct {
+	clock    *fakeClock
+	running  map[uuid.UUID]bool
+	enqueued map[uuid.UUID][]time.Time
+}
+
+func (f *fakeRecomputeTrigger) TriggerScheduledRecompute(ctx context.Context, cohortID uuid.UUID) (*cohort.RecomputeResponse, error) {
+	if f.running[cohortID] {
+		return nil, cohort.ErrRecomputeInProgress
+	}
+	f.enqueued[cohortID] = append(f.enqueued[cohortID], f.clock.Now())
+	return &cohort.RecomputeResponse{CohortID: cohortID, Status: cohort.RecomputeStatusPending}, nil
+}
+
+func TestRecomputeScheduler_Tick(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	hourly := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive, RecomputeInterval: "1h"}
+	daily := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive, RecomputeInterval: "1d"}
+	unscheduled := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive}
+
+	t.Run("different cadences", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		trigger := &fakeRecomputeTrigger{
+			clock:    clock,
+			running:  map[uuid.UUID]bool{},
+			enqueued: map[uuid.UUID][]time.Time{},
+		}
+		lister := &fakeCohortLister{cohorts: []*cohort.Cohort{hourly, daily, unscheduled}}
+
+		scheduler := cohort.NewRecomputeScheduler(lister, trigger, time.Minute)
+		scheduler.SetClock(clock)
+
+		// Tick every 15 minutes for two days
+		for i := 0; i <= 48*4; i++ {
+			scheduler.Tick(context.Background())
+			clock.Advance(15 * time.Minute)
+		}
+
+		if got := len(trigger.enqueued[hourly.ID]); got != 48 {
+			t.Errorf("hourly enqueues = %d, expected 48", got)
+		}
+		if got := len(trigger.enqueued[daily.ID]); got != 2 {
+			t.Errorf("daily enqueues = %d, expected 2", got)
+		}
+		if got := len(trigger.enqueued[unscheduled.ID]); got != 0 {
+			t.Errorf("unscheduled enqueues = %d, expected 0", got)
+		}
+
+		if got := trigger.enqueued[hourly.ID][0]; !got.Equal(start.Add(time.Hour)) {
+			t.Errorf("first hourly enqueue at %v, expected %v", got, start.Add(time.Hour))
+		}
+		if got := trigger.enqueued[daily.ID][0]; !got.Equal(start.Add(24 * time.Hour)) {
+			t.Errorf("first daily enqueue at %v, expected %v", got, start.Add(24*time.Hour))
+		}
+		if got := trigger.enqueued[daily.ID][1]; !got.Equal(start.Add(48 * time.Hour)) {
+			t.Errorf("second daily enqueue at %v, expected %v", got, start.Add(48*time.Hour))
+		}
+	})
+
+	t.Run("running job defers enqueue", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		trigger := &fakeRecomputeTrigger{
+			clock:    clock,
+			running:  map[uuid.UUID]bool{hourly.ID: true},
+			enqueued: map[uuid.UUID][]time.Time{},
+		}
+		lister := &fakeCohortLister{cohorts: []*cohort.Cohort{hourly}}
+
+		scheduler := cohort.NewRecomputeScheduler(lister, trigger, time.Minute)
+		scheduler.SetClock(clock)
+
+		scheduler.Tick(context.Background())
+		clock.Advance(time.Hour)
+		scheduler.Tick(context.Background())
+		if got := len(trigger.enqueued[hourly.ID]); got != 0 {
+			t.Errorf("enqueues while running = %d, expected 0", got)
+		}
+
+		// Once the job finishes the cohort is enqueued on the next tick
+		trigger.running[hourly.ID] = false
+		clock.Advance(time.Minute)
+		scheduler.Tick(context.Background())
+		if got := trigger.enqueued[hourly.ID]; len(got) != 1 || !got[0].Equal(start.Add(61*time.Minute)) {
+			t.Errorf("enqueued = %v, expected one enqueue at %v", got, start.Add(61*time.Minute))
+		}
+	})
+}
+
+// fakeRecomputeHistory returns a fixed job history for every cohort
+type fakeRecomputeHistory struct {
+	jobs map[uuid.UUID][]*cohort.RecomputeJob
+}
+
+func (h *fakeRecomputeHistory) RecomputeJobHistory(ctx context.Context, cohortID uuid.UUID, limit int) ([]*cohort.RecomputeJob, error) {
+	return h.jobs[cohortID], nil
+}
+
+func TestRecomputeScheduler_SeedsFromHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	completed := start.Add(-50 * time.Minute)
+	failed := start.Add(-5 * time.Minute)
+
+	recent := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive, RecomputeInterval: "1h"}
+	never := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive, RecomputeInterval: "1h"}
+
+	clock := &fakeClock{now: start}
+	trigger := &fakeRecomputeTrigger{clock: clock, running: map[uuid.UUID]bool{}, enqueued: map[uuid.UUID][]time.Time{}}
+	history := &fakeRecomputeHistory{jobs: map[uuid.UUID][]*cohort.RecomputeJob{
+		recent.ID: {
+			{CohortID: recent.ID, Status: cohort.RecomputeStatusFailed, CompletedAt: &failed},
+			{CohortID: recent.ID, Status: cohort.RecomputeStatusCompleted, CompletedAt: &completed},
+		},
+	}}
+
+	scheduler := cohort.NewRecomputeScheduler(&fakeCohortLister{cohorts: []*cohort.Cohort{recent, never}}, trigger, time.Minute)
+	scheduler.SetClock(clock)
+	scheduler.SetRecomputeHistory(history)
+
+	// A restart shortly before a cohort is due keeps its schedule
+	for i := 0; i <= 10; i++ {
+		scheduler.Tick(context.Background())
+		clock.Advance(time.Minute)
+	}
+
+	if got := trigger.enqueued[recent.ID]; len(got) != 1 || !got[0].Equal(start.Add(10*time.Minute)) {
+		t.Errorf("recent enqueues = %v, expected one at %v", got, start.Add(10*time.Minute))
+	}
+	if got := trigger.enqueued[never.ID]; len(got) != 1 || !got[0].Equal(start) {
+		t.Errorf("never recomputed enqueues = %v, expected one at %v", got, start)
+	}
+}
+
+// fakeExpirer records the cohorts swept for expired members
+type fakeExpirer struct {
+	swept []uuid.UUID
+}
+
+func (e *fakeExpirer) ExpireMembers(ctx context.Context, c *cohort.Cohort) (int, error) {
+	e.swept = append(e.swept, c.ID)
+	return 0, nil
+}
+
+func TestRecomputeScheduler_ExpireMembers(t *testing.T) {
+	withTTL := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive, MembershipTTL: "7d"}
+	withoutTTL := &cohort.Cohort{ID: uuid.New(), Status: cohort.CohortStatusActive}
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	trigger := &fakeRecomputeTrigger{clock: clock, running: map[uuid.UUID]bool{}, enqueued: map[uuid.UUID][]time.Time{}}
+	expirer := &fakeExpirer{}
+
+	scheduler := cohort.NewRecomputeScheduler(&fakeCohortLister{cohorts: []*cohort.Cohort{withTTL, withoutTTL}}, trigger, time.Minute)
+	scheduler.SetClock(clock)
+	scheduler.SetMembershipExpirer(expirer)
+
+	scheduler.Tick(context.Background())
+	scheduler.Tick(context.Background())
+
+	if len(expirer.swept) != 2 || expirer.swept[0] != withTTL.ID || expirer.swept[1] != withTTL.ID {
+		t.Errorf("swept = %v, expected %v on every tick", expirer.swept, withTTL.ID)
+	}
+}
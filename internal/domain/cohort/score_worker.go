@@ -0,0 +1,166 @@
+package cohort
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// RFMScore defines a recency, frequency and monetary score computed from one
+// event. Each user scores 1-5 on each dimension by quintile, so the combined
+// score ranges from 3 to 15.
+type RFMScore struct {
+	// Name is the score_name score conditions reference
+	Name string
+	// EventName is the event counted, e.g. purchase
+	EventName string
+	// ValueProperty is the numeric event property summed for the monetary score
+	ValueProperty string
+	// Window bounds how far back events are considered
+	Window time.Duration
+}
+
+// ScoreWorker periodically computes per-user scores into user_scores
+type ScoreWorker struct {
+	chClient ClickHouseClient
+	clock    Clock
+	interval time.Duration
+	rfm      []RFMScore
+}
+
+// NewScoreWorker creates a new score worker that recomputes scores every interval
+func NewScoreWorker(chClient ClickHouseClient, interval time.Duration) *ScoreWorker {
+	return &ScoreWorker{
+		chClient: chClient,
+		clock:    systemClock{},
+		interval: interval,
+	}
+}
+
+// AddRFMScore registers an RFM score to compute on each tick
+func (w *ScoreWorker) AddRFMScore(def RFMScore) {
+	w.rfm = append(w.rfm, def)
+}
+
+// SetClock replaces the worker's clock
+func (w *ScoreWorker) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// Start computes scores immediately and then every interval
+func (w *ScoreWorker) Start(ctx context.Context) {
+	go func() {
+		w.Tick(ctx)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.Tick(ctx)
+			}
+		}
+	}()
+}
+
+// Tick recomputes every registered score
+func (w *ScoreWorker) Tick(ctx context.Context) {
+	for _, def := range w.rfm {
+		n, err := w.ComputeRFM(ctx, def)
+		if err != nil {
+			log.Printf("score worker: failed to compute score %s: %v", def.Name, err)
+			continue
+		}
+		log.Printf("score worker: computed score %s for %d users", def.Name, n)
+	}
+}
+
+// rfmRow holds one user's raw RFM metrics
+type rfmRow struct {
+	userID    string
+	recency   int64
+	frequency uint64
+	monetary  float64
+}
+
+// ComputeRFM computes an RFM score for every user with a matching event in
+// the window and writes it to user_scores. It returns the number of users
+// scored.
+func (w *ScoreWorker) ComputeRFM(ctx context.Context, def RFMScore) (int, error) {
+	now := w.clock.Now()
+
+	query := `
+		SELECT
+			user_id,
+			dateDiff('day', max(timestamp), ?) AS recency,
+			count() AS frequency,
+			sum(JSONExtractFloat(properties, ?)) AS monetary
+		FROM events_raw
+		WHERE event_name = ? AND timestamp >= ?
+		GROUP BY user_id
+	`
+
+	rows, err := w.chClient.Query(ctx, query, now, def.ValueProperty, def.EventName, now.Add(-def.Window))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query RFM metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []rfmRow
+	for rows.Next() {
+		var r rfmRow
+		if err := rows.Scan(&r.userID, &r.recency, &r.frequency, &r.monetary); err != nil {
+			return 0, fmt.Errorf("failed to scan RFM metrics: %w", err)
+		}
+		metrics = append(metrics, r)
+	}
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+
+	// Fewer days since the last event is better, so recency is ranked descending
+	recency := quintiles(len(metrics), func(i, j int) bool { return metrics[i].recency > metrics[j].recency })
+	frequency := quintiles(len(metrics), func(i, j int) bool { return metrics[i].frequency < metrics[j].frequency })
+	monetary := quintiles(len(metrics), func(i, j int) bool { return metrics[i].monetary < metrics[j].monetary })
+
+	batch, err := w.chClient.PrepareBatch(ctx, "INSERT INTO user_scores (user_id, score_name, score, computed_at)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare batch: %w", err)
+	}
+	for i, r := range metrics {
+		score := float64(recency[i] + frequency[i] + monetary[i])
+		if err := batch.Append(r.userID, def.Name, score, now); err != nil {
+			return 0, fmt.Errorf("failed to append score: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return 0, fmt.Errorf("failed to send scores: %w", err)
+	}
+
+	return len(metrics), nil
+}
+
+// quintiles ranks n items with less and returns each item's quintile from 1
+// to 5. Equal items share the quintile of the first of them.
+func quintiles(n int, less func(i, j int) bool) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return less(order[a], order[b]) })
+
+	scores := make([]int, n)
+	rank := 0
+	for pos, i := range order {
+		if pos > 0 && less(order[pos-1], i) {
+			rank = pos
+		}
+		scores[i] = 1 + rank*5/n
+	}
+	return scores
+}
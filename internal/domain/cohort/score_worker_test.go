@@ -0,0 +1,87 @@
+package cohort_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestScoreWorker_ComputeRFM(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	def := cohort.RFMScore{Name: "rfm", EventName: "purchase", ValueProperty: "amount", Window: 90 * 24 * time.Hour}
+
+	type metrics struct {
+		userID    string
+		recency   int64
+		frequency uint64
+		monetary  float64
+	}
+	// u4 and u5 tie on frequency and share its quintile
+	users := []metrics{
+		{"u1", 1, 10, 500},
+		{"u2", 30, 1, 10},
+		{"u3", 5, 5, 100},
+		{"u4", 10, 3, 50},
+		{"u5", 20, 3, 20},
+	}
+	expected := map[string]float64{"u1": 15, "u2": 3, "u3": 12, "u4": 8, "u5": 6}
+
+	client := mocks.NewMockClickHouseClient(ctrl)
+	rows := mocks.NewMockRowScanner(ctrl)
+	client.EXPECT().Query(gomock.Any(), gomock.Any(), now, "amount", "purchase", now.Add(-def.Window)).Return(rows, nil)
+
+	next := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool { return next < len(users) }).Times(len(users) + 1)
+	rows.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...any) error {
+		u := users[next]
+		*dest[0].(*string) = u.userID
+		*dest[1].(*int64) = u.recency
+		*dest[2].(*uint64) = u.frequency
+		*dest[3].(*float64) = u.monetary
+		next++
+		return nil
+	}).Times(len(users))
+	rows.EXPECT().Close().Return(nil)
+
+	scores := make(map[string]float64)
+	batch := mocks.NewMockBatch(ctrl)
+	client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			if !strings.Contains(query, "INSERT INTO user_scores") {
+				t.Errorf("query = %q, expected insert into user_scores", query)
+			}
+			return batch, nil
+		})
+	batch.EXPECT().Append(gomock.Any()).DoAndReturn(func(args ...any) error {
+		if args[1] != "rfm" {
+			t.Errorf("score_name = %v, expected rfm", args[1])
+		}
+		scores[args[0].(string)] = args[2].(float64)
+		return nil
+	}).Times(len(users))
+	batch.EXPECT().Send().Return(nil)
+
+	worker := cohort.NewScoreWorker(client, time.Hour)
+	worker.SetClock(&fakeClock{now: now})
+
+	n, err := worker.ComputeRFM(context.Background(), def)
+	if err != nil {
+		t.Fatalf("ComputeRFM() error = %v", err)
+	}
+	if n != len(users) {
+		t.Errorf("scored = %d, expected %d", n, len(users))
+	}
+	for userID, score := range expected {
+		if scores[userID] != score {
+			t.Errorf("score for %s = %v, expected %v", userID, scores[userID], score)
+		}
+	}
+}
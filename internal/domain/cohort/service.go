@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pjhul/intent/internal/db"
+	"github.com/pjhul/intent/internal/tenant"
 )
 
 var (
@@ -15,13 +20,73 @@ var (
 	ErrInvalidRules         = errors.New("invalid cohort rules")
 	ErrRecomputeInProgress  = errors.New("recompute already in progress")
 	ErrRecomputeJobNotFound = errors.New("recompute job not found")
+	ErrRecomputeJobFinished = errors.New("recompute job already finished")
+	ErrRecomputeQueueFull   = errors.New("recompute queue full")
+	ErrNoRecomputeHistory   = errors.New("no completed recomputes to estimate from")
+	ErrVersionNotRecomputed = errors.New("cohort version was never recomputed")
+	ErrCohortLimitReached   = errors.New("cohort limit reached")
+	ErrDuplicateCohortName  = errors.New("cohort name already exists in this project")
+	ErrCohortNotArchived    = errors.New("cohort is not archived")
+
+	ErrInvalidRecomputeInterval = errors.New("invalid recompute interval")
+	ErrInvalidRecomputeSince    = errors.New("invalid incremental recompute start")
+	ErrInvalidMembershipTTL     = errors.New("invalid membership ttl")
+	ErrInvalidVariants          = errors.New("invalid cohort variants")
+
+	ErrTemplateNotFound            = errors.New("cohort template not found")
+	ErrDuplicateTemplateName       = errors.New("template name already exists in this project")
+	ErrMissingTemplateParameter    = errors.New("missing required template parameter")
+	ErrUndeclaredTemplateParameter = errors.New("template references undeclared parameter")
+
+	ErrExportScheduleNotFound   = errors.New("export schedule not found")
+	ErrInvalidCronExpression    = errors.New("invalid cron expression")
+	ErrInvalidExportDestination = errors.New("invalid export destination")
 )
 
+// CohortLimitError reports a cohort creation rejected by the project's limit
+type CohortLimitError struct {
+	Limit int
+}
+
+func (e *CohortLimitError) Error() string {
+	return fmt.Sprintf("%v: project allows at most %d cohorts", ErrCohortLimitReached, e.Limit)
+}
+
+func (e *CohortLimitError) Unwrap() error {
+	return ErrCohortLimitReached
+}
+
 // Service handles cohort business logic
 type Service struct {
 	queries         db.Querier
 	kafkaProducer   CohortProducer
 	recomputeWorker *RecomputeWorker
+
+	syncRecomputeThreshold int64
+	minRecomputeInterval   time.Duration
+
+	maxCohortsPerProject int
+	projectMaxCohorts    map[uuid.UUID]int
+
+	uniqueNames        bool
+	projectUniqueNames map[uuid.UUID]bool
+
+	lowercaseKeys        bool
+	projectLowercaseKeys map[uuid.UUID]bool
+
+	ruleLimits   RuleLimits
+	exportTopics ExportTopicPolicy
+	eventNames   EventNameCatalog
+	retention    EventRetentionSource
+
+	debouncer *RecomputeDebouncer
+
+	requireProject bool
+
+	// producedDefinitions holds the hash of the last definition produced per
+	// cohort when definition dedup is enabled
+	producedDefinitions map[uuid.UUID]string
+	producedMu          sync.Mutex
 }
 
 // CohortProducer interface for publishing cohort updates
@@ -33,31 +98,276 @@ type CohortProducer interface {
 // NewService creates a new cohort service
 func NewService(queries db.Querier, producer CohortProducer) *Service {
 	return &Service{
-		queries:       queries,
-		kafkaProducer: producer,
+		queries:              queries,
+		kafkaProducer:        producer,
+		minRecomputeInterval: DefaultMinRecomputeInterval,
+	}
+}
+
+// SetRequireProjectScope makes methods taking a project ID fail unless their
+// context acts for that project
+func (s *Service) SetRequireProjectScope(required bool) {
+	s.requireProject = required
+}
+
+// checkScope verifies the context acts for projectID when the scope is required
+func (s *Service) checkScope(ctx context.Context, projectID uuid.UUID) error {
+	if !s.requireProject {
+		return nil
+	}
+	return tenant.CheckProject(ctx, projectID)
+}
+
+// checkCohortProject verifies a cohort belongs to the project the context
+// acts for, returning ErrCohortNotFound if it doesn't. Contexts without a
+// project, as used by background jobs, pass.
+func (s *Service) checkCohortProject(ctx context.Context, id uuid.UUID) error {
+	if _, ok := tenant.ProjectFromContext(ctx); !ok {
+		return nil
 	}
+	_, err := s.GetByID(ctx, id)
+	return err
 }
 
 // SetRecomputeWorker sets the recompute worker for the service
 // This is called after service creation to avoid circular dependencies
 func (s *Service) SetRecomputeWorker(worker *RecomputeWorker) {
 	s.recomputeWorker = worker
+	worker.SetRecomputeCompleter(s)
+}
+
+// MarkRecomputed clears the needs_recompute flag of a cohort once a recompute
+// of the given version completes. Later rule edits bump the version and keep
+// the flag set.
+func (s *Service) MarkRecomputed(ctx context.Context, cohortID uuid.UUID, version int64) error {
+	return s.queries.ClearCohortNeedsRecompute(ctx, db.ClearCohortNeedsRecomputeParams{
+		ID:      pgtype.UUID{Bytes: cohortID, Valid: true},
+		Version: version,
+	})
+}
+
+// SetDefinitionDedup makes writes that leave a cohort's definition unchanged,
+// such as activating an already active cohort, skip producing it again
+func (s *Service) SetDefinitionDedup(enabled bool) {
+	s.producedMu.Lock()
+	defer s.producedMu.Unlock()
+
+	if !enabled {
+		s.producedDefinitions = nil
+		return
+	}
+	if s.producedDefinitions == nil {
+		s.producedDefinitions = make(map[uuid.UUID]string)
+	}
+}
+
+// produceDefinition publishes the cohort definition to Kafka, skipping it when
+// dedup is enabled and the same definition was the last one produced. Static
+// cohorts have no rules for Flink to evaluate and aren't published.
+func (s *Service) produceDefinition(ctx context.Context, c *Cohort) {
+	if s.kafkaProducer == nil || c.Type == CohortTypeStatic {
+		return
+	}
+
+	hash := c.DefinitionHash()
+	s.producedMu.Lock()
+	dedup := s.producedDefinitions != nil
+	duplicate := dedup && s.producedDefinitions[c.ID] == hash
+	s.producedMu.Unlock()
+	if duplicate {
+		return
+	}
+
+	// A failed produce isn't recorded so the next write retries it
+	if err := s.kafkaProducer.ProduceCohortDefinition(ctx, c); err != nil || !dedup {
+		return
+	}
+
+	s.producedMu.Lock()
+	if s.producedDefinitions != nil {
+		s.producedDefinitions[c.ID] = hash
+	}
+	s.producedMu.Unlock()
+}
+
+// SetMinRecomputeInterval sets the shortest per-cohort recompute interval accepted
+func (s *Service) SetMinRecomputeInterval(d time.Duration) {
+	s.minRecomputeInterval = d
+}
+
+// SetRecomputeDebouncer enables recomputing cohorts after their rules are
+// updated, once edits have paused
+func (s *Service) SetRecomputeDebouncer(debouncer *RecomputeDebouncer) {
+	s.debouncer = debouncer
+}
+
+// SetRuleLimits sets the limits rules are validated against when a cohort is
+// created or its rules are updated
+func (s *Service) SetRuleLimits(limits RuleLimits) {
+	s.ruleLimits = limits
+}
+
+// SetMaxCohortsPerProject sets how many cohorts a project may hold. The
+// overrides replace the limit for individual projects. Zero means unlimited.
+func (s *Service) SetMaxCohortsPerProject(limit int, overrides map[uuid.UUID]int) {
+	s.maxCohortsPerProject = limit
+	s.projectMaxCohorts = overrides
+}
+
+// checkCohortLimit returns a CohortLimitError if the project is at its limit
+func (s *Service) checkCohortLimit(ctx context.Context, projectID uuid.UUID) error {
+	limit := s.maxCohortsPerProject
+	if override, ok := s.projectMaxCohorts[projectID]; ok {
+		limit = override
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	// Archived cohorts don't count until restored
+	count, err := s.queries.CountCohorts(ctx, pgtype.UUID{Bytes: projectID, Valid: true})
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return &CohortLimitError{Limit: limit}
+	}
+	return nil
+}
+
+// SetExportTopicPolicy restricts the topics export schedules may write to
+func (s *Service) SetExportTopicPolicy(policy ExportTopicPolicy) {
+	s.exportTopics = policy
+}
+
+// SetUniqueNames sets whether cohort names must be unique within a project.
+// The overrides replace the setting for individual projects.
+func (s *Service) SetUniqueNames(enabled bool, overrides map[uuid.UUID]bool) {
+	s.uniqueNames = enabled
+	s.projectUniqueNames = overrides
+}
+
+// SetLowercasePropertyKeys sets whether property keys in rules are lowercased
+// when saved, for projects whose events are ingested with lowercased keys.
+// The overrides replace the setting for individual projects.
+func (s *Service) SetLowercasePropertyKeys(enabled bool, overrides map[uuid.UUID]bool) {
+	s.lowercaseKeys = enabled
+	s.projectLowercaseKeys = overrides
+}
+
+// normalizeRules lowercases the property keys in rules if the project does
+func (s *Service) normalizeRules(projectID uuid.UUID, rules Rules) Rules {
+	enabled := s.lowercaseKeys
+	if override, ok := s.projectLowercaseKeys[projectID]; ok {
+		enabled = override
+	}
+	if !enabled {
+		return rules
+	}
+	return rules.LowercaseKeys()
+}
+
+// checkUniqueName returns ErrDuplicateCohortName if the project enforces
+// unique names and another cohort than excludeID already uses name
+func (s *Service) checkUniqueName(ctx context.Context, projectID uuid.UUID, name string, excludeID uuid.UUID) error {
+	enabled := s.uniqueNames
+	if override, ok := s.projectUniqueNames[projectID]; ok {
+		enabled = override
+	}
+	if !enabled {
+		return nil
+	}
+
+	count, err := s.queries.CountCohortsByName(ctx, db.CountCohortsByNameParams{
+		ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:      name,
+		ID:        pgtype.UUID{Bytes: excludeID, Valid: excludeID != uuid.Nil},
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrDuplicateCohortName, name)
+	}
+	return nil
+}
+
+// ListNameCollisions returns the cohort names used more than once in a
+// project, e.g. before enabling unique names for it
+func (s *Service) ListNameCollisions(ctx context.Context, projectID uuid.UUID) ([]NameCollision, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	rows, err := s.queries.ListCohortNameCollisions(ctx, pgtype.UUID{Bytes: projectID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	collisions := make([]NameCollision, len(rows))
+	for i, r := range rows {
+		collisions[i] = NameCollision{Name: r.Name, Count: r.Count}
+	}
+	return collisions, nil
+}
+
+// SetSyncRecomputeThreshold sets the largest expected cohort size for which
+// TriggerRecomputeAndWait runs the recompute inline. Zero disables inline runs.
+func (s *Service) SetSyncRecomputeThreshold(threshold int64) {
+	s.syncRecomputeThreshold = threshold
 }
 
 // Create creates a new cohort within a project
 func (s *Service) Create(ctx context.Context, projectID uuid.UUID, req CreateCohortRequest) (*Cohort, error) {
-	rulesJSON, err := json.Marshal(req.Rules)
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	if err := req.Rules.Validate(s.ruleLimits); err != nil {
+		return nil, err
+	}
+	if err := s.checkEventRetention(ctx, projectID, req.Rules); err != nil {
+		return nil, err
+	}
+	rulesJSON, err := json.Marshal(s.normalizeRules(projectID, req.Rules))
 	if err != nil {
 		return nil, ErrInvalidRules
 	}
 
+	interval, err := s.parseRecomputeInterval(req.RecomputeInterval)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := parseMembershipTTL(req.MembershipTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVariants(req.Variants); err != nil {
+		return nil, err
+	}
+	variantsJSON, err := marshalVariants(req.Variants)
+	if err != nil {
+		return nil, ErrInvalidVariants
+	}
+
+	if err := s.checkCohortLimit(ctx, projectID); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUniqueName(ctx, projectID, req.Name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
 	pgProjectID := pgtype.UUID{Bytes: projectID, Valid: true}
 	dbCohort, err := s.queries.CreateCohort(ctx, db.CreateCohortParams{
-		ProjectID:   pgProjectID,
-		Name:        req.Name,
-		Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
-		Rules:       rulesJSON,
-		Status:      string(CohortStatusDraft),
+		ProjectID:         pgProjectID,
+		Name:              req.Name,
+		Description:       pgtype.Text{String: req.Description, Valid: req.Description != ""},
+		Rules:             rulesJSON,
+		Status:            string(CohortStatusDraft),
+		RecomputeInterval: interval,
+		MembershipTtl:     ttl,
+		StreamEnabled:     req.StreamEnabled == nil || *req.StreamEnabled,
+		Variants:          variantsJSON,
+		CohortType:        string(CohortTypeRules),
 	})
 	if err != nil {
 		return nil, err
@@ -66,29 +376,73 @@ func (s *Service) Create(ctx context.Context, projectID uuid.UUID, req CreateCoh
 	cohort := dbCohortRowToDomain(dbCohort)
 
 	// Publish to Kafka for Flink
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.ProduceCohortDefinition(ctx, cohort)
-	}
+	s.produceDefinition(ctx, cohort)
 
 	return cohort, nil
 }
 
-// GetByID retrieves a cohort by ID
+// GetByID retrieves a cohort by ID. Archived cohorts and cohorts of projects
+// other than the one the context acts for are reported as not found.
 func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (*Cohort, error) {
+	cohort, err := s.GetByIDIncludingArchived(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cohort.Status == CohortStatusArchived {
+		return nil, ErrCohortNotFound
+	}
+	return cohort, nil
+}
+
+// GetByIDIncludingArchived retrieves a cohort by ID like GetByID, archived
+// cohorts included
+func (s *Service) GetByIDIncludingArchived(ctx context.Context, id uuid.UUID) (*Cohort, error) {
 	pgID := pgtype.UUID{Bytes: id, Valid: true}
 	dbCohort, err := s.queries.GetCohort(ctx, pgID)
 	if err != nil {
 		return nil, ErrCohortNotFound
 	}
 
-	return dbGetCohortRowToDomain(dbCohort), nil
+	cohort := dbGetCohortRowToDomain(dbCohort)
+	if projectID, ok := tenant.ProjectFromContext(ctx); ok && cohort.ProjectID != projectID {
+		return nil, ErrCohortNotFound
+	}
+	return cohort, nil
 }
 
-// List retrieves cohorts for a project with pagination
-func (s *Service) List(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*Cohort, error) {
+// List retrieves cohorts for a project with pagination. Archived cohorts are
+// left out unless includeArchived is set.
+func (s *Service) List(ctx context.Context, projectID uuid.UUID, limit, offset int, includeArchived bool) ([]*Cohort, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
 	pgProjectID := pgtype.UUID{Bytes: projectID, Valid: true}
 	dbCohorts, err := s.queries.ListCohorts(ctx, db.ListCohortsParams{
-		ProjectID: pgProjectID,
+		ProjectID:       pgProjectID,
+		Limit:           int32(limit),
+		Offset:          int32(offset),
+		IncludeArchived: includeArchived,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cohorts := make([]*Cohort, len(dbCohorts))
+	for i, c := range dbCohorts {
+		cohorts[i] = dbListCohortsRowToDomain(c)
+	}
+
+	return cohorts, nil
+}
+
+// ListArchived retrieves a project's archived cohorts with pagination
+func (s *Service) ListArchived(ctx context.Context, projectID uuid.UUID, limit, offset int) ([]*Cohort, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	dbCohorts, err := s.queries.ListCohortsByStatus(ctx, db.ListCohortsByStatusParams{
+		ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+		Status:    string(CohortStatusArchived),
 		Limit:     int32(limit),
 		Offset:    int32(offset),
 	})
@@ -98,7 +452,7 @@ func (s *Service) List(ctx context.Context, projectID uuid.UUID, limit, offset i
 
 	cohorts := make([]*Cohort, len(dbCohorts))
 	for i, c := range dbCohorts {
-		cohorts[i] = dbListCohortsRowToDomain(c)
+		cohorts[i] = dbListCohortsByStatusRowToDomain(c)
 	}
 
 	return cohorts, nil
@@ -106,6 +460,9 @@ func (s *Service) List(ctx context.Context, projectID uuid.UUID, limit, offset i
 
 // ListActive retrieves all active cohorts for a project
 func (s *Service) ListActive(ctx context.Context, projectID uuid.UUID) ([]*Cohort, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
 	pgProjectID := pgtype.UUID{Bytes: projectID, Valid: true}
 	dbCohorts, err := s.queries.ListActiveCohorts(ctx, pgProjectID)
 	if err != nil {
@@ -142,8 +499,15 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateCohortRequ
 		return nil, err
 	}
 
+	if existing.Type == CohortTypeStatic && (req.Rules != nil || (req.RecomputeInterval != nil && *req.RecomputeInterval != "")) {
+		return nil, ErrStaticCohort
+	}
+
 	name := existing.Name
-	if req.Name != "" {
+	if req.Name != "" && req.Name != existing.Name {
+		if err := s.checkUniqueName(ctx, existing.ProjectID, req.Name, id); err != nil {
+			return nil, err
+		}
 		name = req.Name
 	}
 
@@ -154,7 +518,13 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateCohortRequ
 
 	rules := existing.Rules
 	if req.Rules != nil {
-		rules = *req.Rules
+		if err := req.Rules.Validate(s.ruleLimits); err != nil {
+			return nil, err
+		}
+		if err := s.checkEventRetention(ctx, existing.ProjectID, *req.Rules); err != nil {
+			return nil, err
+		}
+		rules = s.normalizeRules(existing.ProjectID, *req.Rules)
 	}
 
 	rulesJSON, err := json.Marshal(rules)
@@ -162,12 +532,60 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateCohortRequ
 		return nil, ErrInvalidRules
 	}
 
+	// Membership reflects the old rules until a recompute of the new version completes
+	needsRecompute := existing.NeedsRecompute
+	rulesChanged := false
+	if existingJSON, err := json.Marshal(existing.Rules); err != nil || string(existingJSON) != string(rulesJSON) {
+		needsRecompute = true
+		rulesChanged = true
+	}
+
+	recomputeInterval := existing.RecomputeInterval
+	if req.RecomputeInterval != nil {
+		recomputeInterval = *req.RecomputeInterval
+	}
+	interval, err := s.parseRecomputeInterval(recomputeInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	membershipTTL := existing.MembershipTTL
+	if req.MembershipTTL != nil {
+		membershipTTL = *req.MembershipTTL
+	}
+	ttl, err := parseMembershipTTL(membershipTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	streamEnabled := existing.StreamEnabled
+	if req.StreamEnabled != nil {
+		streamEnabled = *req.StreamEnabled
+	}
+
+	variants := existing.Variants
+	if req.Variants != nil {
+		variants = *req.Variants
+	}
+	if err := validateVariants(variants); err != nil {
+		return nil, err
+	}
+	variantsJSON, err := marshalVariants(variants)
+	if err != nil {
+		return nil, ErrInvalidVariants
+	}
+
 	pgID := pgtype.UUID{Bytes: id, Valid: true}
 	dbCohort, err := s.queries.UpdateCohort(ctx, db.UpdateCohortParams{
-		ID:          pgID,
-		Name:        name,
-		Description: pgtype.Text{String: description, Valid: description != ""},
-		Rules:       rulesJSON,
+		ID:                pgID,
+		Name:              name,
+		Description:       pgtype.Text{String: description, Valid: description != ""},
+		Rules:             rulesJSON,
+		RecomputeInterval: interval,
+		NeedsRecompute:    needsRecompute,
+		MembershipTtl:     ttl,
+		StreamEnabled:     streamEnabled,
+		Variants:          variantsJSON,
 	})
 	if err != nil {
 		return nil, err
@@ -188,8 +606,10 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateCohortRequ
 	}
 
 	// Publish update to Kafka
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.ProduceCohortDefinition(ctx, cohort)
+	s.produceDefinition(ctx, cohort)
+
+	if rulesChanged && s.debouncer != nil {
+		s.debouncer.RulesChanged(cohort.ID)
 	}
 
 	return cohort, nil
@@ -215,13 +635,11 @@ func (s *Service) Activate(ctx context.Context, id uuid.UUID) (*Cohort, error) {
 
 	cohort := dbUpdateCohortStatusRowToDomain(dbCohort)
 
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.ProduceCohortDefinition(ctx, cohort)
-	}
+	s.produceDefinition(ctx, cohort)
 
 	// Trigger recompute on first activation
 	if isFirstActivation && s.recomputeWorker != nil {
-		go s.TriggerRecompute(context.Background(), id, false)
+		go s.TriggerRecompute(context.Background(), id, RecomputeRequest{})
 	}
 
 	return cohort, nil
@@ -229,6 +647,10 @@ func (s *Service) Activate(ctx context.Context, id uuid.UUID) (*Cohort, error) {
 
 // Deactivate deactivates a cohort
 func (s *Service) Deactivate(ctx context.Context, id uuid.UUID) (*Cohort, error) {
+	if err := s.checkCohortProject(ctx, id); err != nil {
+		return nil, err
+	}
+
 	pgID := pgtype.UUID{Bytes: id, Valid: true}
 	dbCohort, err := s.queries.UpdateCohortStatus(ctx, db.UpdateCohortStatusParams{
 		ID:     pgID,
@@ -240,20 +662,27 @@ func (s *Service) Deactivate(ctx context.Context, id uuid.UUID) (*Cohort, error)
 
 	cohort := dbUpdateCohortStatusRowToDomain(dbCohort)
 
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.ProduceCohortDefinition(ctx, cohort)
-	}
+	s.produceDefinition(ctx, cohort)
 
 	return cohort, nil
 }
 
-// Delete deletes a cohort
+// Delete archives a cohort. Archived cohorts are hidden from reads and are
+// no longer evaluated, but keep their definition so Restore can bring them back.
 func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := s.checkCohortProject(ctx, id); err != nil {
+		return err
+	}
+
 	pgID := pgtype.UUID{Bytes: id, Valid: true}
-	if err := s.queries.DeleteCohort(ctx, pgID); err != nil {
+	if err := s.queries.ArchiveCohort(ctx, pgID); err != nil {
 		return ErrCohortNotFound
 	}
 
+	s.producedMu.Lock()
+	delete(s.producedDefinitions, id)
+	s.producedMu.Unlock()
+
 	if s.kafkaProducer != nil {
 		s.kafkaProducer.ProduceCohortDeletion(ctx, id.String())
 	}
@@ -261,21 +690,389 @@ func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// Conversion functions for different row types
+// Restore brings back an archived cohort as inactive, to be activated again
+// when wanted. The cohort counts toward the project's limit and unique names
+// again, so restoring can be rejected like creating.
+func (s *Service) Restore(ctx context.Context, id uuid.UUID) (*Cohort, error) {
+	existing, err := s.GetByIDIncludingArchived(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != CohortStatusArchived {
+		return nil, ErrCohortNotArchived
+	}
+	if err := s.checkCohortLimit(ctx, existing.ProjectID); err != nil {
+		return nil, err
+	}
+	if err := s.checkUniqueName(ctx, existing.ProjectID, existing.Name, id); err != nil {
+		return nil, err
+	}
+
+	if err := s.queries.RestoreCohort(ctx, pgtype.UUID{Bytes: id, Valid: true}); err != nil {
+		return nil, err
+	}
+
+	cohort, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.produceDefinition(ctx, cohort)
+
+	return cohort, nil
+}
+
+// CreateTemplate creates a new reusable rule template within a project
+func (s *Service) CreateTemplate(ctx context.Context, projectID uuid.UUID, req CreateTemplateRequest) (*Template, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	if !json.Valid(req.Rules) {
+		return nil, ErrInvalidRules
+	}
+
+	declared := make(map[string]struct{}, len(req.Parameters))
+	for _, p := range req.Parameters {
+		declared[p.Name] = struct{}{}
+	}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(string(req.Rules), -1) {
+		if _, ok := declared[m[1]]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUndeclaredTemplateParameter, m[1])
+		}
+	}
+	if err := s.validateTemplateRules(req); err != nil {
+		return nil, err
+	}
+
+	params := req.Parameters
+	if params == nil {
+		params = []TemplateParameter{}
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	dbTemplate, err := s.queries.CreateCohortTemplate(ctx, db.CreateCohortTemplateParams{
+		ProjectID:   pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:        req.Name,
+		Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
+		Rules:       req.Rules,
+		Parameters:  paramsJSON,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateTemplateName, req.Name)
+		}
+		return nil, err
+	}
+
+	return dbTemplateToDomain(dbTemplate), nil
+}
+
+// validateTemplateRules checks a template's rules by substituting a sample
+// value for every parameter, its default when it has one, and validating the
+// result as a cohort's rules would be
+func (s *Service) validateTemplateRules(req CreateTemplateRequest) error {
+	samples := make(map[string]any, len(req.Parameters))
+	for _, p := range req.Parameters {
+		samples[p.Name] = "1"
+		if p.Default != nil {
+			samples[p.Name] = p.Default
+		}
+	}
+
+	tmpl := Template{Rules: req.Rules, Parameters: req.Parameters}
+	rules, err := tmpl.Substitute(samples)
+	if err != nil {
+		return err
+	}
+	return rules.Validate(s.ruleLimits)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// GetTemplate retrieves a template by ID. Templates of other projects are
+// reported as ErrTemplateNotFound.
+func (s *Service) GetTemplate(ctx context.Context, projectID, id uuid.UUID) (*Template, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	dbTemplate, err := s.queries.GetCohortTemplate(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		return nil, ErrTemplateNotFound
+	}
+
+	tmpl := dbTemplateToDomain(dbTemplate)
+	if tmpl.ProjectID != projectID {
+		return nil, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// ListTemplates retrieves all templates for a project
+func (s *Service) ListTemplates(ctx context.Context, projectID uuid.UUID) ([]*Template, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	dbTemplates, err := s.queries.ListCohortTemplates(ctx, pgtype.UUID{Bytes: projectID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*Template, len(dbTemplates))
+	for i, t := range dbTemplates {
+		templates[i] = dbTemplateToDomain(t)
+	}
+
+	return templates, nil
+}
+
+// DeleteTemplate deletes a template of the project
+func (s *Service) DeleteTemplate(ctx context.Context, projectID, id uuid.UUID) error {
+	if _, err := s.GetTemplate(ctx, projectID, id); err != nil {
+		return err
+	}
+	if err := s.queries.DeleteCohortTemplate(ctx, pgtype.UUID{Bytes: id, Valid: true}); err != nil {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// CreateFromTemplate substitutes the supplied parameters into a template and creates a cohort
+func (s *Service) CreateFromTemplate(ctx context.Context, projectID uuid.UUID, req CreateFromTemplateRequest) (*Cohort, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	tmpl, err := s.GetTemplate(ctx, projectID, req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := tmpl.Substitute(req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Create(ctx, projectID, CreateCohortRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Rules:       rules,
+	})
+}
+
+// CreateExportSchedule schedules a recurring export of a cohort's members
+func (s *Service) CreateExportSchedule(ctx context.Context, cohortID uuid.UUID, req CreateExportScheduleRequest) (*ExportSchedule, error) {
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	if _, err := ParseCron(req.Cron); err != nil {
+		return nil, err
+	}
+	if err := s.exportTopics.validateExportDestination(req.Destination); err != nil {
+		return nil, err
+	}
+
+	dbSchedule, err := s.queries.CreateCohortExportSchedule(ctx, db.CreateCohortExportScheduleParams{
+		CohortID:    pgtype.UUID{Bytes: cohortID, Valid: true},
+		Destination: req.Destination,
+		Cron:        req.Cron,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dbExportScheduleToDomain(dbSchedule), nil
+}
+
+// ListExportSchedules retrieves a cohort's export schedules with their last run status
+func (s *Service) ListExportSchedules(ctx context.Context, cohortID uuid.UUID) ([]*ExportSchedule, error) {
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return nil, err
+	}
+
+	dbSchedules, err := s.queries.ListCohortExportSchedules(ctx, pgtype.UUID{Bytes: cohortID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]*ExportSchedule, len(dbSchedules))
+	for i, sch := range dbSchedules {
+		schedules[i] = dbExportScheduleToDomain(sch)
+	}
+
+	return schedules, nil
+}
+
+// ListAllExportSchedules retrieves every export schedule across projects
+func (s *Service) ListAllExportSchedules(ctx context.Context) ([]*ExportSchedule, error) {
+	dbSchedules, err := s.queries.ListAllCohortExportSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]*ExportSchedule, len(dbSchedules))
+	for i, sch := range dbSchedules {
+		schedules[i] = dbExportScheduleToDomain(sch)
+	}
+
+	return schedules, nil
+}
+
+// DeleteExportSchedule deletes one of a cohort's export schedules
+func (s *Service) DeleteExportSchedule(ctx context.Context, cohortID, scheduleID uuid.UUID) error {
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return err
+	}
+
+	pgID := pgtype.UUID{Bytes: scheduleID, Valid: true}
+	dbSchedule, err := s.queries.GetCohortExportSchedule(ctx, pgID)
+	if err != nil || uuid.UUID(dbSchedule.CohortID.Bytes) != cohortID {
+		return ErrExportScheduleNotFound
+	}
+
+	if err := s.queries.DeleteCohortExportSchedule(ctx, pgID); err != nil {
+		return ErrExportScheduleNotFound
+	}
+	return nil
+}
+
+// RecordExportRun stores the outcome of a scheduled export
+func (s *Service) RecordExportRun(ctx context.Context, id uuid.UUID, run ExportRun) error {
+	return s.queries.RecordCohortExportRun(ctx, db.RecordCohortExportRunParams{
+		ID:                pgtype.UUID{Bytes: id, Valid: true},
+		LastRunAt:         pgtype.Timestamptz{Time: run.At, Valid: true},
+		LastStatus:        pgtype.Text{String: run.Status, Valid: true},
+		LastError:         pgtype.Text{String: run.Error, Valid: run.Error != ""},
+		LastExportedCount: run.Exported,
+	})
+}
+
+func dbExportScheduleToDomain(sch db.CohortExportSchedule) *ExportSchedule {
+	schedule := &ExportSchedule{
+		ID:                uuid.UUID(sch.ID.Bytes),
+		CohortID:          uuid.UUID(sch.CohortID.Bytes),
+		Destination:       sch.Destination,
+		Cron:              sch.Cron,
+		LastStatus:        sch.LastStatus.String,
+		LastError:         sch.LastError.String,
+		LastExportedCount: sch.LastExportedCount,
+		CreatedAt:         sch.CreatedAt.Time,
+		UpdatedAt:         sch.UpdatedAt.Time,
+	}
+	if sch.LastRunAt.Valid {
+		lastRun := sch.LastRunAt.Time
+		schedule.LastRunAt = &lastRun
+	}
+	if next, err := schedule.nextRun(); err == nil && !next.IsZero() {
+		schedule.NextRunAt = &next
+	}
+	return schedule
+}
+
+func dbTemplateToDomain(t db.CohortTemplate) *Template {
+	var params []TemplateParameter
+	json.Unmarshal(t.Parameters, &params)
+
+	return &Template{
+		ID:          uuid.UUID(t.ID.Bytes),
+		ProjectID:   uuid.UUID(t.ProjectID.Bytes),
+		Name:        t.Name,
+		Description: t.Description.String,
+		Rules:       json.RawMessage(t.Rules),
+		Parameters:  params,
+		CreatedAt:   t.CreatedAt.Time,
+		UpdatedAt:   t.UpdatedAt.Time,
+	}
+}
+
+// parseRecomputeInterval validates a recompute interval against the minimum floor.
+// An empty interval disables scheduled recomputes.
+func (s *Service) parseRecomputeInterval(interval string) (pgtype.Interval, error) {
+	if interval == "" {
+		return pgtype.Interval{}, nil
+	}
+
+	d, err := parseDuration(interval)
+	if err != nil || d <= 0 {
+		return pgtype.Interval{}, fmt.Errorf("%w: %q", ErrInvalidRecomputeInterval, interval)
+	}
+	if d < s.minRecomputeInterval {
+		return pgtype.Interval{}, fmt.Errorf("%w: must be at least %s", ErrInvalidRecomputeInterval, s.minRecomputeInterval)
+	}
+
+	return pgtype.Interval{Microseconds: d.Microseconds(), Valid: true}, nil
+}
+
+// parseMembershipTTL validates a membership TTL. An empty TTL derives the
+// lifetime from the rules.
+func parseMembershipTTL(ttl string) (pgtype.Interval, error) {
+	if ttl == "" {
+		return pgtype.Interval{}, nil
+	}
+
+	d, err := parseDuration(ttl)
+	if err != nil || d <= 0 {
+		return pgtype.Interval{}, fmt.Errorf("%w: %q", ErrInvalidMembershipTTL, ttl)
+	}
+
+	return pgtype.Interval{Microseconds: d.Microseconds(), Valid: true}, nil
+}
+
+// formatInterval renders a stored interval in the shortest duration notation
+func formatInterval(i pgtype.Interval) string {
+	if !i.Valid {
+		return ""
+	}
+
+	d := time.Duration(i.Microseconds)*time.Microsecond +
+		time.Duration(i.Days)*24*time.Hour +
+		time.Duration(i.Months)*30*24*time.Hour
+
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// deletedAt returns when an archived cohort was deleted, or nil
+func deletedAt(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
 func dbCohortRowToDomain(c db.CreateCohortRow) *Cohort {
 	var rules Rules
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
 	}
 }
 
@@ -284,15 +1081,22 @@ func dbGetCohortRowToDomain(c db.GetCohortRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
+		DeletedAt:         deletedAt(c.DeletedAt),
 	}
 }
 
@@ -301,15 +1105,46 @@ func dbListCohortsRowToDomain(c db.ListCohortsRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
+		DeletedAt:         deletedAt(c.DeletedAt),
+	}
+}
+
+func dbListCohortsByStatusRowToDomain(c db.ListCohortsByStatusRow) *Cohort {
+	var rules Rules
+	json.Unmarshal(c.Rules, &rules)
+
+	return &Cohort{
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
+		DeletedAt:         deletedAt(c.DeletedAt),
 	}
 }
 
@@ -318,15 +1153,21 @@ func dbListActiveCohortsRowToDomain(c db.ListActiveCohortsRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
 	}
 }
 
@@ -335,15 +1176,21 @@ func dbListAllActiveCohortsRowToDomain(c db.ListAllActiveCohortsRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
 	}
 }
 
@@ -352,15 +1199,21 @@ func dbUpdateCohortRowToDomain(c db.UpdateCohortRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
 	}
 }
 
@@ -369,22 +1222,28 @@ func dbUpdateCohortStatusRowToDomain(c db.UpdateCohortStatusRow) *Cohort {
 	json.Unmarshal(c.Rules, &rules)
 
 	return &Cohort{
-		ID:          uuid.UUID(c.ID.Bytes),
-		ProjectID:   uuid.UUID(c.ProjectID.Bytes),
-		Name:        c.Name,
-		Description: c.Description.String,
-		Rules:       rules,
-		Status:      CohortStatus(c.Status),
-		Version:     c.Version,
-		CreatedAt:   c.CreatedAt.Time,
-		UpdatedAt:   c.UpdatedAt.Time,
+		ID:                uuid.UUID(c.ID.Bytes),
+		ProjectID:         uuid.UUID(c.ProjectID.Bytes),
+		Name:              c.Name,
+		Description:       c.Description.String,
+		Rules:             rules,
+		Status:            CohortStatus(c.Status),
+		Type:              CohortType(c.CohortType),
+		Version:           c.Version,
+		CreatedAt:         c.CreatedAt.Time,
+		UpdatedAt:         c.UpdatedAt.Time,
+		RecomputeInterval: formatInterval(c.RecomputeInterval),
+		MembershipTTL:     formatInterval(c.MembershipTtl),
+		NeedsRecompute:    c.NeedsRecompute,
+		StreamEnabled:     c.StreamEnabled,
+		Variants:          parseVariants(c.Variants),
 	}
 }
 
 // TriggerRecompute triggers a recompute job for a cohort
-func (s *Service) TriggerRecompute(ctx context.Context, cohortID uuid.UUID, force bool) (*RecomputeResponse, error) {
+func (s *Service) TriggerRecompute(ctx context.Context, cohortID uuid.UUID, req RecomputeRequest) (*RecomputeResponse, error) {
 	// Verify cohort exists
-	cohort, err := s.GetByID(ctx, cohortID)
+	cohort, err := s.getRuleCohort(ctx, cohortID)
 	if err != nil {
 		return nil, err
 	}
@@ -395,32 +1254,317 @@ func (s *Service) TriggerRecompute(ctx context.Context, cohortID uuid.UUID, forc
 	}
 
 	// Check if there's already a running job for this cohort (unless force is set)
-	if !force && s.recomputeWorker.HasRunningJob(cohortID) {
+	if !req.Force && s.recomputeWorker.HasRunningJob(cohortID) {
 		return nil, ErrRecomputeInProgress
 	}
 
-	// Create and submit the job
-	job := NewRecomputeJob(cohortID)
-	s.recomputeWorker.SubmitJob(job)
+	return s.submitRecompute(req.newJob(cohort.ID, RecomputePriorityHigh))
+}
+
+// TriggerIncrementalRecompute queues a recompute that re-evaluates only the
+// users with events at or after since, leaving everyone else's membership as
+// it is. It is cheaper than a full recompute but misses users who stopped
+// matching without new events, e.g. by aging out of a sliding window, and
+// doesn't apply a pending rules edit.
+func (s *Service) TriggerIncrementalRecompute(ctx context.Context, cohortID uuid.UUID, since time.Time) (*RecomputeResponse, error) {
+	if since.IsZero() || since.After(time.Now()) {
+		return nil, fmt.Errorf("%w: must be in the past", ErrInvalidRecomputeSince)
+	}
+
+	cohort, err := s.getRuleCohort(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+	if s.recomputeWorker.HasRunningJob(cohortID) {
+		return nil, ErrRecomputeInProgress
+	}
+
+	job := NewRecomputeJob(cohort.ID)
+	since = since.UTC()
+	job.Progress.Since = &since
+	return s.submitRecompute(job)
+}
+
+// TriggerScheduledRecompute queues a low priority recompute job for a cohort.
+// Manually triggered recomputes run ahead of it.
+func (s *Service) TriggerScheduledRecompute(ctx context.Context, cohortID uuid.UUID) (*RecomputeResponse, error) {
+	cohort, err := s.getRuleCohort(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+
+	if s.recomputeWorker.HasRunningJob(cohortID) {
+		return nil, ErrRecomputeInProgress
+	}
+
+	return s.submitRecompute(NewRecomputeJobWithPriority(cohort.ID, RecomputePriorityLow))
+}
+
+// PreviewCount returns how many users the rules would match now, without
+// saving a cohort. The rules are normalized as they would be when saved to
+// the project the context acts for.
+func (s *Service) PreviewCount(ctx context.Context, rules Rules) (int64, error) {
+	rules, err := s.previewRules(ctx, rules)
+	if err != nil {
+		return 0, err
+	}
+	return s.recomputeWorker.PreviewCount(ctx, rules)
+}
+
+// Preview returns how many users the rules would match now along with a
+// capped sample of them, normalizing the rules as PreviewCount does
+func (s *Service) Preview(ctx context.Context, rules Rules) (*RulesPreview, error) {
+	rules, err := s.previewRules(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	return s.recomputeWorker.Preview(ctx, rules)
+}
+
+// previewRules validates rules for a preview and normalizes them for the
+// context's project
+func (s *Service) previewRules(ctx context.Context, rules Rules) (Rules, error) {
+	if s.recomputeWorker == nil {
+		return Rules{}, errors.New("recompute worker not available")
+	}
+	if len(rules.Conditions) == 0 && len(rules.Groups) == 0 {
+		return Rules{}, fmt.Errorf("%w: no conditions", ErrInvalidRules)
+	}
+	if err := rules.Validate(s.ruleLimits); err != nil {
+		return Rules{}, err
+	}
+
+	projectID, ok := tenant.ProjectFromContext(ctx)
+	if ok {
+		if err := s.checkEventRetention(ctx, projectID, rules); err != nil {
+			return Rules{}, err
+		}
+	}
+	return s.normalizeRules(projectID, rules), nil
+}
+
+// TriggerRecomputeAndWait recomputes a cohort inline when its preview count is
+// within the sync threshold, and falls back to an async job otherwise
+func (s *Service) TriggerRecomputeAndWait(ctx context.Context, cohortID uuid.UUID, req RecomputeRequest) (*RecomputeResponse, error) {
+	cohort, err := s.getRuleCohort(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+
+	if !req.Force && s.recomputeWorker.HasRunningJob(cohortID) {
+		return nil, ErrRecomputeInProgress
+	}
+
+	if s.syncRecomputeThreshold <= 0 {
+		return s.submitRecompute(req.newJob(cohort.ID, RecomputePriorityHigh))
+	}
+
+	expected, err := s.recomputeWorker.PreviewCount(ctx, cohort.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate cohort size: %w", err)
+	}
+	if expected > s.syncRecomputeThreshold {
+		return s.submitRecompute(req.newJob(cohort.ID, RecomputePriorityHigh))
+	}
+
+	job := req.newJob(cohort.ID, RecomputePriorityHigh)
+	s.recomputeWorker.RunJob(ctx, job)
+
+	message := "Recompute completed"
+	if job.Status == RecomputeStatusFailed {
+		message = job.Error
+	}
+	result := job.Progress
 
 	return &RecomputeResponse{
 		JobID:    job.ID,
 		CohortID: cohort.ID,
 		Status:   job.Status,
+		Message:  message,
+		Result:   &result,
+	}, nil
+}
+
+// EstimateSize counts the users currently matching a cohort's rules, over a
+// sample of users when approx is set and sampling is available
+func (s *Service) EstimateSize(ctx context.Context, cohortID uuid.UUID, approx bool) (*SizeEstimate, error) {
+	cohort, err := s.getRuleCohort(ctx, cohortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+
+	estimate, err := s.recomputeWorker.EstimateCount(ctx, cohort.Rules, approx)
+	if err != nil {
+		return nil, err
+	}
+	estimate.CohortID = cohort.ID
+	estimate.Warnings = s.RuleWarnings(ctx, cohort.Rules)
+	return estimate, nil
+}
+
+// RecordRecomputeJob persists a finished recompute job to the job history
+func (s *Service) RecordRecomputeJob(ctx context.Context, job *RecomputeJob) error {
+	if job.CompletedAt == nil {
+		return nil
+	}
+	return s.queries.RecordRecomputeJob(ctx, db.RecordRecomputeJobParams{
+		ID:             pgtype.UUID{Bytes: job.ID, Valid: true},
+		CohortID:       pgtype.UUID{Bytes: job.CohortID, Valid: true},
+		Status:         string(job.Status),
+		Reason:         string(job.Reason),
+		MembersFound:   job.Progress.MembersFound,
+		MembersAdded:   job.Progress.MembersAdded,
+		MembersRemoved: job.Progress.MembersRemoved,
+		Error:          pgtype.Text{String: job.Error, Valid: job.Error != ""},
+		StartedAt:      pgtype.Timestamptz{Time: job.StartedAt, Valid: true},
+		CompletedAt:    pgtype.Timestamptz{Time: *job.CompletedAt, Valid: true},
+		CohortVersion:  job.CohortVersion,
+	})
+}
+
+// RecomputeJobHistory returns a cohort's most recent finished recompute jobs,
+// newest first
+func (s *Service) RecomputeJobHistory(ctx context.Context, cohortID uuid.UUID, limit int) ([]*RecomputeJob, error) {
+	rows, err := s.queries.ListRecomputeJobHistory(ctx, db.ListRecomputeJobHistoryParams{
+		CohortID: pgtype.UUID{Bytes: cohortID, Valid: true},
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*RecomputeJob, len(rows))
+	for i, row := range rows {
+		completedAt := row.CompletedAt.Time
+		jobs[i] = &RecomputeJob{
+			ID:       uuid.UUID(row.ID.Bytes),
+			CohortID: uuid.UUID(row.CohortID.Bytes),
+			Status:   RecomputeStatus(row.Status),
+			Reason:   ChangeReason(row.Reason),
+			Progress: RecomputeProgress{
+				MembersFound:   row.MembersFound,
+				MembersAdded:   row.MembersAdded,
+				MembersRemoved: row.MembersRemoved,
+			},
+			StartedAt:     row.StartedAt.Time,
+			CompletedAt:   &completedAt,
+			Error:         row.Error.String,
+			CohortVersion: row.CohortVersion,
+		}
+	}
+	return jobs, nil
+}
+
+// VersionRecomputedAt returns when the latest completed recompute of a cohort
+// version finished, the point its membership reflected that version. It
+// returns ErrVersionNotRecomputed if no recompute of the version completed.
+func (s *Service) VersionRecomputedAt(ctx context.Context, cohortID uuid.UUID, version int64) (time.Time, error) {
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return time.Time{}, err
+	}
+
+	completedAt, err := s.queries.GetVersionRecomputedAt(ctx, db.GetVersionRecomputedAtParams{
+		CohortID:      pgtype.UUID{Bytes: cohortID, Valid: true},
+		CohortVersion: version,
+	})
+	if err != nil {
+		return time.Time{}, ErrVersionNotRecomputed
+	}
+	return completedAt.Time, nil
+}
+
+// EstimateRecomputeDuration estimates how long recomputing a cohort would
+// take from its recent recompute durations and its current approximate size.
+// It returns ErrNoRecomputeHistory if the cohort has never been recomputed.
+func (s *Service) EstimateRecomputeDuration(ctx context.Context, cohortID uuid.UUID) (*RecomputeEstimate, error) {
+	size, err := s.EstimateSize(ctx, cohortID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.RecomputeJobHistory(ctx, cohortID, recomputeEstimateHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, jobs := EstimateRecomputeDuration(history, size.Size)
+	if jobs == 0 {
+		return nil, ErrNoRecomputeHistory
+	}
+
+	return &RecomputeEstimate{
+		CohortID:            cohortID,
+		EstimatedSize:       size.Size,
+		EstimatedDurationMs: duration.Milliseconds(),
+		BasedOnJobs:         jobs,
+	}, nil
+}
+
+// submitRecompute queues an async recompute job
+func (s *Service) submitRecompute(job *RecomputeJob) (*RecomputeResponse, error) {
+	if err := s.recomputeWorker.SubmitJob(job); err != nil {
+		return nil, err
+	}
+
+	return &RecomputeResponse{
+		JobID:    job.ID,
+		CohortID: job.CohortID,
+		Status:   job.Status,
 		Message:  "Recompute job started",
 	}, nil
 }
 
-// GetRecomputeJob retrieves the status of a recompute job
-func (s *Service) GetRecomputeJob(ctx context.Context, jobID uuid.UUID) (*RecomputeJob, error) {
+// GetRecomputeJob retrieves the status of a cohort's recompute job. Jobs of
+// cohorts outside the context's project are reported as not found.
+func (s *Service) GetRecomputeJob(ctx context.Context, cohortID, jobID uuid.UUID) (*RecomputeJob, error) {
 	if s.recomputeWorker == nil {
 		return nil, errors.New("recompute worker not available")
 	}
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return nil, err
+	}
 
 	job, ok := s.recomputeWorker.GetJob(jobID)
-	if !ok {
+	if !ok || job.CohortID != cohortID {
 		return nil, ErrRecomputeJobNotFound
 	}
 
 	return job, nil
 }
+
+// CancelRecompute cancels a cohort's pending or running recompute job and
+// returns it. Jobs of cohorts outside the context's project are reported as
+// not found.
+func (s *Service) CancelRecompute(ctx context.Context, cohortID, jobID uuid.UUID) (*RecomputeJob, error) {
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+	if _, err := s.GetByID(ctx, cohortID); err != nil {
+		return nil, err
+	}
+
+	job, ok := s.recomputeWorker.GetJob(jobID)
+	if !ok || job.CohortID != cohortID {
+		return nil, ErrRecomputeJobNotFound
+	}
+	if err := s.recomputeWorker.CancelJob(jobID); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
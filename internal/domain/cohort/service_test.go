@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pjhul/intent/internal/db"
 	"github.com/pjhul/intent/internal/domain/cohort"
 	"github.com/pjhul/intent/internal/mocks"
+	"github.com/pjhul/intent/internal/tenant"
 	"go.uber.org/mock/gomock"
 )
 
@@ -91,6 +96,159 @@ func TestService_Create(t *testing.T) {
 	})
 }
 
+func TestService_UniqueNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	projectID := uuid.New()
+	relaxedProjectID := uuid.New()
+	svc.SetUniqueNames(true, map[uuid.UUID]bool{relaxedProjectID: false})
+
+	req := cohort.CreateCohortRequest{
+		Name: "Buyers",
+		Rules: cohort.Rules{
+			Operator:   cohort.OperatorAND,
+			Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+		},
+	}
+
+	t.Run("duplicate name rejected on create", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CountCohortsByName(gomock.Any(), db.CountCohortsByNameParams{
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Name:      "Buyers",
+			}).
+			Return(int64(1), nil)
+
+		_, err := svc.Create(context.Background(), projectID, req)
+		if !errors.Is(err, cohort.ErrDuplicateCohortName) {
+			t.Errorf("Create() error = %v, expected ErrDuplicateCohortName", err)
+		}
+	})
+
+	t.Run("unique name accepted on create", func(t *testing.T) {
+		mockQuerier.EXPECT().CountCohortsByName(gomock.Any(), gomock.Any()).Return(int64(0), nil)
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{ProjectID: pgtype.UUID{Bytes: projectID, Valid: true}, Name: req.Name}, nil)
+
+		if _, err := svc.Create(context.Background(), projectID, req); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("project override allows duplicates", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{ProjectID: pgtype.UUID{Bytes: relaxedProjectID, Valid: true}, Name: req.Name}, nil)
+
+		if _, err := svc.Create(context.Background(), relaxedProjectID, req); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rename to a taken name rejected on update", func(t *testing.T) {
+		cohortID := uuid.New()
+		rulesJSON, _ := json.Marshal(req.Rules)
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(db.GetCohortRow{
+			ID:        pgtype.UUID{Bytes: cohortID, Valid: true},
+			ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+			Name:      "Browsers",
+			Rules:     rulesJSON,
+		}, nil)
+		mockQuerier.EXPECT().
+			CountCohortsByName(gomock.Any(), db.CountCohortsByNameParams{
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Name:      "Buyers",
+				ID:        pgtype.UUID{Bytes: cohortID, Valid: true},
+			}).
+			Return(int64(1), nil)
+
+		_, err := svc.Update(context.Background(), cohortID, cohort.UpdateCohortRequest{Name: "Buyers"})
+		if !errors.Is(err, cohort.ErrDuplicateCohortName) {
+			t.Errorf("Update() error = %v, expected ErrDuplicateCohortName", err)
+		}
+	})
+
+	t.Run("name collisions are listed", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			ListCohortNameCollisions(gomock.Any(), pgtype.UUID{Bytes: projectID, Valid: true}).
+			Return([]db.ListCohortNameCollisionsRow{{Name: "Buyers", Count: 2}}, nil)
+
+		collisions, err := svc.ListNameCollisions(context.Background(), projectID)
+		if err != nil {
+			t.Fatalf("ListNameCollisions() unexpected error: %v", err)
+		}
+		if len(collisions) != 1 || collisions[0].Name != "Buyers" || collisions[0].Count != 2 {
+			t.Errorf("collisions = %+v, expected Buyers x2", collisions)
+		}
+	})
+}
+
+func TestService_Create_CohortLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	projectID := uuid.New()
+	largeProjectID := uuid.New()
+	svc.SetMaxCohortsPerProject(3, map[uuid.UUID]int{largeProjectID: 5})
+
+	req := cohort.CreateCohortRequest{
+		Name: "Buyers",
+		Rules: cohort.Rules{
+			Operator:   cohort.OperatorAND,
+			Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}},
+		},
+	}
+
+	t.Run("blocked at the limit", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CountCohorts(gomock.Any(), pgtype.UUID{Bytes: projectID, Valid: true}).
+			Return(int64(3), nil)
+
+		_, err := svc.Create(context.Background(), projectID, req)
+		if !errors.Is(err, cohort.ErrCohortLimitReached) {
+			t.Fatalf("Create() error = %v, expected ErrCohortLimitReached", err)
+		}
+		var limitErr *cohort.CohortLimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != 3 {
+			t.Errorf("Create() error = %v, expected limit 3", err)
+		}
+	})
+
+	t.Run("allowed below the limit", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CountCohorts(gomock.Any(), gomock.Any()).
+			Return(int64(2), nil)
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{ProjectID: pgtype.UUID{Bytes: projectID, Valid: true}, Name: req.Name}, nil)
+
+		if _, err := svc.Create(context.Background(), projectID, req); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("per-project override", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CountCohorts(gomock.Any(), gomock.Any()).
+			Return(int64(4), nil)
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{ProjectID: pgtype.UUID{Bytes: largeProjectID, Valid: true}, Name: req.Name}, nil)
+
+		if _, err := svc.Create(context.Background(), largeProjectID, req); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+}
+
 func TestService_GetByID(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -142,6 +300,130 @@ func TestService_GetByID(t *testing.T) {
 	})
 }
 
+func TestService_RequireProjectScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	svc.SetRequireProjectScope(true)
+
+	projectID := uuid.New()
+	otherProjectID := uuid.New()
+	cohortID := uuid.New()
+
+	t.Run("project methods error without a project in context", func(t *testing.T) {
+		if _, err := svc.List(context.Background(), projectID, 10, 0, false); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("List() error = %v, expected ErrNoProject", err)
+		}
+	})
+
+	t.Run("project methods error for another project", func(t *testing.T) {
+		ctx := tenant.WithProject(context.Background(), otherProjectID)
+		if _, err := svc.List(ctx, projectID, 10, 0, false); !errors.Is(err, tenant.ErrProjectMismatch) {
+			t.Errorf("List() error = %v, expected ErrProjectMismatch", err)
+		}
+	})
+
+	t.Run("lookups hide cohorts of other projects", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
+			Return(db.GetCohortRow{
+				ID:        pgtype.UUID{Bytes: cohortID, Valid: true},
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Rules:     []byte(`{"conditions":[]}`),
+			}, nil).
+			Times(3)
+
+		ctx := tenant.WithProject(context.Background(), otherProjectID)
+		if _, err := svc.GetByID(ctx, cohortID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("GetByID() error = %v, expected ErrCohortNotFound", err)
+		}
+		if _, err := svc.GetByID(tenant.WithProject(context.Background(), projectID), cohortID); err != nil {
+			t.Errorf("GetByID() error = %v for the cohort's own project", err)
+		}
+		if _, err := svc.GetByID(context.Background(), cohortID); err != nil {
+			t.Errorf("GetByID() error = %v without a project, expected background lookups to pass", err)
+		}
+	})
+}
+
+func TestService_ProjectIsolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Isolation doesn't depend on SetRequireProjectScope
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	projectID := uuid.New()
+	otherProjectID := uuid.New()
+	cohortID := uuid.New()
+	pgID := pgtype.UUID{Bytes: cohortID, Valid: true}
+
+	mockQuerier.EXPECT().
+		GetCohort(gomock.Any(), pgID).
+		Return(db.GetCohortRow{
+			ID:        pgID,
+			ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+			Rules:     []byte(`{"conditions":[]}`),
+		}, nil).
+		AnyTimes()
+
+	otherCtx := tenant.WithProject(context.Background(), otherProjectID)
+
+	t.Run("lookups from another project don't find the cohort", func(t *testing.T) {
+		if _, err := svc.GetByID(otherCtx, cohortID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("GetByID() error = %v, expected ErrCohortNotFound", err)
+		}
+		c, err := svc.GetByID(tenant.WithProject(context.Background(), projectID), cohortID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v for the cohort's own project", err)
+		}
+		if c.ProjectID != projectID {
+			t.Errorf("ProjectID = %v, expected %v", c.ProjectID, projectID)
+		}
+	})
+
+	t.Run("another project can't deactivate or delete the cohort", func(t *testing.T) {
+		// No UpdateCohortStatus or ArchiveCohort calls are expected
+		if _, err := svc.Deactivate(otherCtx, cohortID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("Deactivate() error = %v, expected ErrCohortNotFound", err)
+		}
+		if err := svc.Delete(otherCtx, cohortID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("Delete() error = %v, expected ErrCohortNotFound", err)
+		}
+	})
+
+	t.Run("another project can't read or cancel the cohort's recompute jobs", func(t *testing.T) {
+		worker := cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), svc)
+		svc.SetRecomputeWorker(worker)
+		job := cohort.NewRecomputeJob(cohortID)
+		worker.SubmitJob(job)
+
+		if _, err := svc.GetRecomputeJob(otherCtx, cohortID, job.ID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("GetRecomputeJob() error = %v, expected ErrCohortNotFound", err)
+		}
+		if _, err := svc.CancelRecompute(otherCtx, cohortID, job.ID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("CancelRecompute() error = %v, expected ErrCohortNotFound", err)
+		}
+		if job.Status != cohort.RecomputeStatusPending {
+			t.Errorf("Status = %v, expected the job left pending", job.Status)
+		}
+		if _, err := svc.GetRecomputeJob(tenant.WithProject(context.Background(), projectID), cohortID, job.ID); err != nil {
+			t.Errorf("GetRecomputeJob() error = %v for the cohort's own project", err)
+		}
+	})
+
+	t.Run("the owning project can delete the cohort", func(t *testing.T) {
+		mockQuerier.EXPECT().ArchiveCohort(gomock.Any(), pgID).Return(nil)
+
+		if err := svc.Delete(tenant.WithProject(context.Background(), projectID), cohortID); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+	})
+}
+
 func TestService_List(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -183,7 +465,7 @@ func TestService_List(t *testing.T) {
 				},
 			}, nil)
 
-		cohorts, err := svc.List(context.Background(), projectID, 10, 0)
+		cohorts, err := svc.List(context.Background(), projectID, 10, 0, false)
 		if err != nil {
 			t.Errorf("List() unexpected error: %v", err)
 		}
@@ -197,7 +479,7 @@ func TestService_List(t *testing.T) {
 			ListCohorts(gomock.Any(), gomock.Any()).
 			Return([]db.ListCohortsRow{}, nil)
 
-		cohorts, err := svc.List(context.Background(), projectID, 10, 100)
+		cohorts, err := svc.List(context.Background(), projectID, 10, 100, false)
 		if err != nil {
 			t.Errorf("List() unexpected error: %v", err)
 		}
@@ -487,6 +769,55 @@ func TestService_Activate(t *testing.T) {
 	})
 }
 
+func TestService_DefinitionDedup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	mockProducer := mocks.NewMockCohortProducer(ctrl)
+	svc := cohort.NewService(mockQuerier, mockProducer)
+	svc.SetDefinitionDedup(true)
+
+	cohortID := uuid.New()
+	pgID := pgtype.UUID{Bytes: cohortID, Valid: true}
+	projectID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	now := pgtype.Timestamptz{Time: time.Now().UTC(), Valid: true}
+	rules := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}}}
+	rulesJSON, _ := json.Marshal(rules)
+
+	// The update bumps the version while the rules stay the same
+	mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(db.GetCohortRow{
+		ID: pgID, ProjectID: projectID, Name: "buyers", Rules: rulesJSON,
+		Status: string(cohort.CohortStatusDraft), Version: 1, CreatedAt: now, UpdatedAt: now,
+	}, nil)
+	mockQuerier.EXPECT().UpdateCohort(gomock.Any(), gomock.Any()).Return(db.UpdateCohortRow{
+		ID: pgID, ProjectID: projectID, Name: "buyers", Rules: rulesJSON,
+		Status: string(cohort.CohortStatusDraft), Version: 2, CreatedAt: now, UpdatedAt: now,
+	}, nil)
+	mockQuerier.EXPECT().UpdateCohortStatus(gomock.Any(), gomock.Any()).Return(db.UpdateCohortStatusRow{
+		ID: pgID, ProjectID: projectID, Name: "buyers", Rules: rulesJSON,
+		Status: string(cohort.CohortStatusActive), Version: 2, CreatedAt: now, UpdatedAt: now,
+	}, nil).Times(2)
+
+	// Activating the now active cohort again produces the same definition
+	mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(db.GetCohortRow{
+		ID: pgID, ProjectID: projectID, Name: "buyers", Rules: rulesJSON,
+		Status: string(cohort.CohortStatusActive), Version: 2, CreatedAt: now, UpdatedAt: now,
+	}, nil)
+
+	mockProducer.EXPECT().
+		ProduceCohortDefinition(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	if _, err := svc.Update(context.Background(), cohortID, cohort.UpdateCohortRequest{Status: cohort.CohortStatusActive}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := svc.Activate(context.Background(), cohortID); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+}
+
 func TestService_Deactivate(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -555,7 +886,7 @@ func TestService_Delete(t *testing.T) {
 		cohortID := uuid.New()
 
 		mockQuerier.EXPECT().
-			DeleteCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
+			ArchiveCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
 			Return(nil)
 
 		mockProducer.EXPECT().
@@ -572,7 +903,7 @@ func TestService_Delete(t *testing.T) {
 		cohortID := uuid.New()
 
 		mockQuerier.EXPECT().
-			DeleteCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
+			ArchiveCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
 			Return(errors.New("not found"))
 
 		err := svc.Delete(context.Background(), cohortID)
@@ -582,6 +913,131 @@ func TestService_Delete(t *testing.T) {
 	})
 }
 
+func TestService_Archival(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	mockProducer := mocks.NewMockCohortProducer(ctrl)
+	svc := cohort.NewService(mockQuerier, mockProducer)
+
+	projectID := uuid.New()
+	cohortID := uuid.New()
+	pgID := pgtype.UUID{Bytes: cohortID, Valid: true}
+	ctx := tenant.WithProject(context.Background(), projectID)
+
+	cohortRow := func(status cohort.CohortStatus, deletedAt pgtype.Timestamptz) db.GetCohortRow {
+		return db.GetCohortRow{
+			ID:        pgID,
+			ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+			Name:      "Churned",
+			Rules:     []byte(`{"conditions":[]}`),
+			Status:    string(status),
+			DeletedAt: deletedAt,
+		}
+	}
+	archivedAt := pgtype.Timestamptz{Time: time.Now().UTC(), Valid: true}
+
+	t.Run("delete then restore", func(t *testing.T) {
+		gomock.InOrder(
+			mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusActive, pgtype.Timestamptz{}), nil),
+			mockQuerier.EXPECT().ArchiveCohort(gomock.Any(), pgID).Return(nil),
+			mockProducer.EXPECT().ProduceCohortDeletion(gomock.Any(), cohortID.String()).Return(nil),
+		)
+		if err := svc.Delete(ctx, cohortID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusArchived, archivedAt), nil).Times(2)
+		if _, err := svc.GetByID(ctx, cohortID); !errors.Is(err, cohort.ErrCohortNotFound) {
+			t.Errorf("GetByID() error = %v, expected ErrCohortNotFound for an archived cohort", err)
+		}
+		archived, err := svc.GetByIDIncludingArchived(ctx, cohortID)
+		if err != nil {
+			t.Fatalf("GetByIDIncludingArchived() error = %v", err)
+		}
+		if archived.Status != cohort.CohortStatusArchived || archived.DeletedAt == nil {
+			t.Errorf("status/deleted_at = %s/%v, expected archived with a deletion time", archived.Status, archived.DeletedAt)
+		}
+
+		gomock.InOrder(
+			mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusArchived, archivedAt), nil),
+			mockQuerier.EXPECT().RestoreCohort(gomock.Any(), pgID).Return(nil),
+			mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusInactive, pgtype.Timestamptz{}), nil),
+			mockProducer.EXPECT().ProduceCohortDefinition(gomock.Any(), gomock.Any()).Return(nil),
+		)
+		restored, err := svc.Restore(ctx, cohortID)
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if restored.Status != cohort.CohortStatusInactive || restored.DeletedAt != nil {
+			t.Errorf("status/deleted_at = %s/%v, expected inactive and not deleted", restored.Status, restored.DeletedAt)
+		}
+	})
+
+	t.Run("restoring a cohort that isn't archived", func(t *testing.T) {
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusActive, pgtype.Timestamptz{}), nil)
+
+		if _, err := svc.Restore(ctx, cohortID); !errors.Is(err, cohort.ErrCohortNotArchived) {
+			t.Errorf("Restore() error = %v, expected ErrCohortNotArchived", err)
+		}
+	})
+
+	t.Run("restoring counts toward the cohort limit", func(t *testing.T) {
+		svc.SetMaxCohortsPerProject(1, nil)
+		defer svc.SetMaxCohortsPerProject(0, nil)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(cohortRow(cohort.CohortStatusArchived, archivedAt), nil)
+		mockQuerier.EXPECT().CountCohorts(gomock.Any(), pgtype.UUID{Bytes: projectID, Valid: true}).Return(int64(1), nil)
+
+		if _, err := svc.Restore(ctx, cohortID); !errors.Is(err, cohort.ErrCohortLimitReached) {
+			t.Errorf("Restore() error = %v, expected ErrCohortLimitReached", err)
+		}
+	})
+
+	t.Run("lists hide archived cohorts by default", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			ListCohorts(gomock.Any(), db.ListCohortsParams{
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Limit:     10,
+			}).
+			Return([]db.ListCohortsRow{}, nil)
+		if _, err := svc.List(ctx, projectID, 10, 0, false); err != nil {
+			t.Errorf("List() error = %v", err)
+		}
+
+		mockQuerier.EXPECT().
+			ListCohorts(gomock.Any(), db.ListCohortsParams{
+				ProjectID:       pgtype.UUID{Bytes: projectID, Valid: true},
+				Limit:           10,
+				IncludeArchived: true,
+			}).
+			Return([]db.ListCohortsRow{{ID: pgID, Status: string(cohort.CohortStatusArchived), DeletedAt: archivedAt}}, nil)
+		cohorts, err := svc.List(ctx, projectID, 10, 0, true)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(cohorts) != 1 || cohorts[0].Status != cohort.CohortStatusArchived {
+			t.Errorf("List() = %v, expected the archived cohort", cohorts)
+		}
+
+		mockQuerier.EXPECT().
+			ListCohortsByStatus(gomock.Any(), db.ListCohortsByStatusParams{
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Status:    string(cohort.CohortStatusArchived),
+				Limit:     10,
+			}).
+			Return([]db.ListCohortsByStatusRow{{ID: pgID, Status: string(cohort.CohortStatusArchived), DeletedAt: archivedAt}}, nil)
+		archived, err := svc.ListArchived(ctx, projectID, 10, 0)
+		if err != nil {
+			t.Fatalf("ListArchived() error = %v", err)
+		}
+		if len(archived) != 1 || archived[0].ID != cohortID {
+			t.Errorf("ListArchived() = %v, expected the archived cohort", archived)
+		}
+	})
+}
+
 func TestService_TriggerRecompute(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -613,7 +1069,7 @@ func TestService_TriggerRecompute(t *testing.T) {
 				UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
 			}, nil)
 
-		resp, err := svc.TriggerRecompute(context.Background(), cohortID, false)
+		resp, err := svc.TriggerRecompute(context.Background(), cohortID, cohort.RecomputeRequest{})
 		if err != nil {
 			t.Errorf("TriggerRecompute() unexpected error: %v", err)
 		}
@@ -625,13 +1081,45 @@ func TestService_TriggerRecompute(t *testing.T) {
 		}
 	})
 
+	t.Run("incremental", func(t *testing.T) {
+		otherID := uuid.New()
+		mockQuerier.EXPECT().
+			GetCohort(gomock.Any(), pgtype.UUID{Bytes: otherID, Valid: true}).
+			Return(db.GetCohortRow{
+				ID:        pgtype.UUID{Bytes: otherID, Valid: true},
+				ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+				Name:      "Other Cohort",
+				Rules:     rulesJSON,
+				Status:    string(cohort.CohortStatusActive),
+				Version:   1,
+			}, nil).
+			Times(2)
+
+		since := now.Add(-time.Hour)
+		resp, err := svc.TriggerIncrementalRecompute(context.Background(), otherID, since)
+		if err != nil {
+			t.Fatalf("TriggerIncrementalRecompute() unexpected error: %v", err)
+		}
+		job, err := svc.GetRecomputeJob(context.Background(), otherID, resp.JobID)
+		if err != nil {
+			t.Fatalf("GetRecomputeJob() unexpected error: %v", err)
+		}
+		if job.Progress.Since == nil || !job.Progress.Since.Equal(since) {
+			t.Errorf("Progress.Since = %v, expected %v", job.Progress.Since, since)
+		}
+
+		if _, err := svc.TriggerIncrementalRecompute(context.Background(), otherID, now.Add(time.Hour)); !errors.Is(err, cohort.ErrInvalidRecomputeSince) {
+			t.Errorf("TriggerIncrementalRecompute() error = %v, expected ErrInvalidRecomputeSince for a future start", err)
+		}
+	})
+
 	t.Run("cohort not found", func(t *testing.T) {
 		notFoundID := uuid.New()
 		mockQuerier.EXPECT().
 			GetCohort(gomock.Any(), pgtype.UUID{Bytes: notFoundID, Valid: true}).
 			Return(db.GetCohortRow{}, errors.New("not found"))
 
-		_, err := svc.TriggerRecompute(context.Background(), notFoundID, false)
+		_, err := svc.TriggerRecompute(context.Background(), notFoundID, cohort.RecomputeRequest{})
 		if !errors.Is(err, cohort.ErrCohortNotFound) {
 			t.Errorf("TriggerRecompute() error = %v, expected ErrCohortNotFound", err)
 		}
@@ -652,7 +1140,7 @@ func TestService_TriggerRecompute(t *testing.T) {
 				UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
 			}, nil)
 
-		_, err := svcNoWorker.TriggerRecompute(context.Background(), cohortID, false)
+		_, err := svcNoWorker.TriggerRecompute(context.Background(), cohortID, cohort.RecomputeRequest{})
 		if err == nil {
 			t.Error("TriggerRecompute() expected error when worker not available")
 		}
@@ -734,8 +1222,18 @@ func TestService_GetRecomputeJob(t *testing.T) {
 	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
 	svc := cohort.NewService(mockQuerier, nil)
 
+	cohortID := uuid.New()
+	mockQuerier.EXPECT().
+		GetCohort(gomock.Any(), pgtype.UUID{Bytes: cohortID, Valid: true}).
+		Return(db.GetCohortRow{
+			ID:        pgtype.UUID{Bytes: cohortID, Valid: true},
+			ProjectID: pgtype.UUID{Bytes: uuid.New(), Valid: true},
+			Rules:     []byte(`{"conditions":[]}`),
+		}, nil).
+		AnyTimes()
+
 	t.Run("no worker available", func(t *testing.T) {
-		_, err := svc.GetRecomputeJob(context.Background(), uuid.New())
+		_, err := svc.GetRecomputeJob(context.Background(), cohortID, uuid.New())
 		if err == nil {
 			t.Error("GetRecomputeJob() expected error when worker not available")
 		}
@@ -745,7 +1243,7 @@ func TestService_GetRecomputeJob(t *testing.T) {
 		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
 		svc.SetRecomputeWorker(worker)
 
-		_, err := svc.GetRecomputeJob(context.Background(), uuid.New())
+		_, err := svc.GetRecomputeJob(context.Background(), cohortID, uuid.New())
 		if !errors.Is(err, cohort.ErrRecomputeJobNotFound) {
 			t.Errorf("GetRecomputeJob() error = %v, expected ErrRecomputeJobNotFound", err)
 		}
@@ -755,16 +1253,780 @@ func TestService_GetRecomputeJob(t *testing.T) {
 		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
 		svc.SetRecomputeWorker(worker)
 
-		cohortID := uuid.New()
 		job := cohort.NewRecomputeJob(cohortID)
 		worker.SubmitJob(job)
 
-		retrievedJob, err := svc.GetRecomputeJob(context.Background(), job.ID)
+		retrievedJob, err := svc.GetRecomputeJob(context.Background(), cohortID, job.ID)
 		if err != nil {
-			t.Errorf("GetRecomputeJob() unexpected error: %v", err)
+			t.Fatalf("GetRecomputeJob() unexpected error: %v", err)
 		}
 		if retrievedJob.ID != job.ID {
 			t.Errorf("Job ID = %v, expected %v", retrievedJob.ID, job.ID)
 		}
 	})
+
+	t.Run("job of another cohort", func(t *testing.T) {
+		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+		svc.SetRecomputeWorker(worker)
+
+		job := cohort.NewRecomputeJob(uuid.New())
+		worker.SubmitJob(job)
+
+		if _, err := svc.GetRecomputeJob(context.Background(), cohortID, job.ID); !errors.Is(err, cohort.ErrRecomputeJobNotFound) {
+			t.Errorf("GetRecomputeJob() error = %v, expected ErrRecomputeJobNotFound", err)
+		}
+	})
+}
+
+func TestService_CreateFromTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	projectID := uuid.New()
+	templateID := uuid.New()
+	now := time.Now().UTC()
+
+	templateRules := `{
+		"operator": "AND",
+		"conditions": [{
+			"type": "aggregate",
+			"event_name": "purchase",
+			"aggregation": "sum",
+			"aggregation_field": "amount",
+			"operator": "gte",
+			"value": "{{min_amount}}",
+			"time_window": {"type": "sliding", "duration": "{{days}}d"}
+		}]
+	}`
+	params, _ := json.Marshal([]cohort.TemplateParameter{
+		{Name: "min_amount", Required: true},
+		{Name: "days", Required: true},
+	})
+	templateRow := db.CohortTemplate{
+		ID:         pgtype.UUID{Bytes: templateID, Valid: true},
+		ProjectID:  pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:       "Big spenders",
+		Rules:      []byte(templateRules),
+		Parameters: params,
+		CreatedAt:  pgtype.Timestamptz{Time: now, Valid: true},
+		UpdatedAt:  pgtype.Timestamptz{Time: now, Valid: true},
+	}
+
+	t.Run("substitutes parameters", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+
+		var created db.CreateCohortParams
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateCohortParams) (db.CreateCohortRow, error) {
+				created = arg
+				return db.CreateCohortRow{
+					ID:        pgtype.UUID{Bytes: uuid.New(), Valid: true},
+					ProjectID: arg.ProjectID,
+					Name:      arg.Name,
+					Rules:     arg.Rules,
+					Status:    arg.Status,
+					Version:   1,
+					CreatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+					UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+				}, nil
+			})
+
+		c, err := svc.CreateFromTemplate(context.Background(), projectID, cohort.CreateFromTemplateRequest{
+			TemplateID: templateID,
+			Name:       "Spent 100 in 30 days",
+			Parameters: map[string]any{"min_amount": 100.0, "days": 30},
+		})
+		if err != nil {
+			t.Fatalf("CreateFromTemplate() unexpected error: %v", err)
+		}
+		if created.Name != "Spent 100 in 30 days" {
+			t.Errorf("Name = %q, expected %q", created.Name, "Spent 100 in 30 days")
+		}
+
+		cond := c.Rules.Conditions[0]
+		if cond.Value != 100.0 {
+			t.Errorf("Value = %v (%T), expected 100 as a number", cond.Value, cond.Value)
+		}
+		if cond.TimeWindow == nil || cond.TimeWindow.Duration != "30d" {
+			t.Errorf("TimeWindow = %+v, expected duration 30d", cond.TimeWindow)
+		}
+	})
+
+	t.Run("missing required parameter is rejected", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+
+		_, err := svc.CreateFromTemplate(context.Background(), projectID, cohort.CreateFromTemplateRequest{
+			TemplateID: templateID,
+			Name:       "Incomplete",
+			Parameters: map[string]any{"min_amount": 100.0},
+		})
+		if !errors.Is(err, cohort.ErrMissingTemplateParameter) {
+			t.Errorf("CreateFromTemplate() error = %v, expected ErrMissingTemplateParameter", err)
+		}
+	})
+
+	t.Run("template from another project", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+
+		_, err := svc.CreateFromTemplate(context.Background(), uuid.New(), cohort.CreateFromTemplateRequest{
+			TemplateID: templateID,
+			Name:       "Other project",
+			Parameters: map[string]any{"min_amount": 100.0, "days": 30},
+		})
+		if !errors.Is(err, cohort.ErrTemplateNotFound) {
+			t.Errorf("CreateFromTemplate() error = %v, expected ErrTemplateNotFound", err)
+		}
+	})
+}
+
+func TestService_CreateTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	t.Run("undeclared parameter is rejected", func(t *testing.T) {
+		_, err := svc.CreateTemplate(context.Background(), uuid.New(), cohort.CreateTemplateRequest{
+			Name:  "Broken",
+			Rules: json.RawMessage(`{"operator":"AND","conditions":[{"type":"event","event_name":"{{event}}"}]}`),
+		})
+		if !errors.Is(err, cohort.ErrUndeclaredTemplateParameter) {
+			t.Errorf("CreateTemplate() error = %v, expected ErrUndeclaredTemplateParameter", err)
+		}
+	})
+
+	t.Run("rules that aren't cohort rules are rejected", func(t *testing.T) {
+		_, err := svc.CreateTemplate(context.Background(), uuid.New(), cohort.CreateTemplateRequest{
+			Name:  "Broken",
+			Rules: json.RawMessage(`{"operator":"AND","conditions":{"type":"event"}}`),
+		})
+		if !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Errorf("CreateTemplate() error = %v, expected ErrInvalidRules", err)
+		}
+	})
+
+	t.Run("substituted rules are validated", func(t *testing.T) {
+		_, err := svc.CreateTemplate(context.Background(), uuid.New(), cohort.CreateTemplateRequest{
+			Name: "Broken",
+			Rules: json.RawMessage(`{"operator":"AND","conditions":[{"type":"event","event_name":"{{event}}",
+				"property_filters":[{"key":"plan","operator":"eq","value":"pro","missing":"sometimes"}]}]}`),
+			Parameters: []cohort.TemplateParameter{{Name: "event", Required: true}},
+		})
+		if !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Errorf("CreateTemplate() error = %v, expected ErrInvalidRules", err)
+		}
+	})
+
+	t.Run("valid template", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohortTemplate(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateCohortTemplateParams) (db.CohortTemplate, error) {
+				return db.CohortTemplate{
+					ID:         pgtype.UUID{Bytes: uuid.New(), Valid: true},
+					ProjectID:  arg.ProjectID,
+					Name:       arg.Name,
+					Rules:      arg.Rules,
+					Parameters: arg.Parameters,
+				}, nil
+			})
+
+		_, err := svc.CreateTemplate(context.Background(), uuid.New(), cohort.CreateTemplateRequest{
+			Name: "Big spenders",
+			Rules: json.RawMessage(`{"operator":"AND","conditions":[{"type":"aggregate","event_name":"{{event}}",
+				"aggregation":"sum","aggregation_field":"amount","operator":"gte","value":"{{min_amount}}",
+				"time_window":{"type":"sliding","duration":"{{days}}d"}}]}`),
+			Parameters: []cohort.TemplateParameter{
+				{Name: "event", Required: true},
+				{Name: "min_amount", Required: true},
+				{Name: "days", Default: 30.0},
+			},
+		})
+		if err != nil {
+			t.Errorf("CreateTemplate() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohortTemplate(gomock.Any(), gomock.Any()).
+			Return(db.CohortTemplate{}, &pgconn.PgError{Code: "23505", ConstraintName: "cohort_templates_project_id_name_key"})
+
+		_, err := svc.CreateTemplate(context.Background(), uuid.New(), cohort.CreateTemplateRequest{
+			Name:  "Active users",
+			Rules: json.RawMessage(`{"operator":"AND","conditions":[{"type":"event","event_name":"login"}]}`),
+		})
+		if !errors.Is(err, cohort.ErrDuplicateTemplateName) {
+			t.Errorf("CreateTemplate() error = %v, expected ErrDuplicateTemplateName", err)
+		}
+	})
+}
+
+func TestService_TemplateProjectScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+
+	projectID := uuid.New()
+	templateID := uuid.New()
+	templateRow := db.CohortTemplate{
+		ID:         pgtype.UUID{Bytes: templateID, Valid: true},
+		ProjectID:  pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:       "Active users",
+		Rules:      []byte(`{"operator":"AND","conditions":[]}`),
+		Parameters: []byte(`[]`),
+	}
+
+	t.Run("get from another project", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+
+		_, err := svc.GetTemplate(context.Background(), uuid.New(), templateID)
+		if !errors.Is(err, cohort.ErrTemplateNotFound) {
+			t.Errorf("GetTemplate() error = %v, expected ErrTemplateNotFound", err)
+		}
+	})
+
+	t.Run("delete from another project leaves the template", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+		mockQuerier.EXPECT().DeleteCohortTemplate(gomock.Any(), gomock.Any()).Times(0)
+
+		err := svc.DeleteTemplate(context.Background(), uuid.New(), templateID)
+		if !errors.Is(err, cohort.ErrTemplateNotFound) {
+			t.Errorf("DeleteTemplate() error = %v, expected ErrTemplateNotFound", err)
+		}
+	})
+
+	t.Run("delete within the project", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			GetCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(templateRow, nil)
+		mockQuerier.EXPECT().
+			DeleteCohortTemplate(gomock.Any(), pgtype.UUID{Bytes: templateID, Valid: true}).
+			Return(nil)
+
+		if err := svc.DeleteTemplate(context.Background(), projectID, templateID); err != nil {
+			t.Errorf("DeleteTemplate() unexpected error: %v", err)
+		}
+	})
+}
+
+// newRowScanner returns a mock result set yielding one single-column row per value
+func newRowScanner(ctrl *gomock.Controller, values ...any) *mocks.MockRowScanner {
+	rows := mocks.NewMockRowScanner(ctrl)
+	i := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool {
+		i++
+		return i <= len(values)
+	}).AnyTimes()
+	rows.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...any) error {
+		switch d := dest[0].(type) {
+		case *string:
+			*d = values[i-1].(string)
+		case *uint64:
+			*d = values[i-1].(uint64)
+		}
+		return nil
+	}).AnyTimes()
+	rows.EXPECT().Close().Return(nil).AnyTimes()
+	return rows
+}
+
+func TestService_PreviewCount(t *testing.T) {
+	rules := cohort.Rules{
+		Operator: cohort.OperatorAND,
+		Conditions: []cohort.Condition{
+			{Type: cohort.ConditionTypeEvent, EventName: "purchase"},
+		},
+	}
+
+	t.Run("counts the users the rules match", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mocks.NewMockQuerier(ctrl), nil)
+		svc.SetRecomputeWorker(cohort.NewRecomputeWorker(mockCHClient, svc))
+
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), "purchase").
+			DoAndReturn(func(ctx context.Context, query string, args ...any) (cohort.RowScanner, error) {
+				if !strings.HasPrefix(query, "SELECT count() FROM (") {
+					t.Errorf("query = %q, expected a count over the rules' query", query)
+				}
+				return newRowScanner(ctrl, uint64(42)), nil
+			})
+
+		count, err := svc.PreviewCount(context.Background(), rules)
+		if err != nil {
+			t.Fatalf("PreviewCount() unexpected error: %v", err)
+		}
+		if count != 42 {
+			t.Errorf("PreviewCount() = %d, expected 42", count)
+		}
+	})
+
+	t.Run("rejects rules without conditions", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc := cohort.NewService(mocks.NewMockQuerier(ctrl), nil)
+		svc.SetRecomputeWorker(cohort.NewRecomputeWorker(mocks.NewMockClickHouseClient(ctrl), svc))
+
+		if _, err := svc.PreviewCount(context.Background(), cohort.Rules{Operator: cohort.OperatorAND}); !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Errorf("PreviewCount() error = %v, expected %v", err, cohort.ErrInvalidRules)
+		}
+	})
+
+	t.Run("propagates ClickHouse errors", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mocks.NewMockQuerier(ctrl), nil)
+		svc.SetRecomputeWorker(cohort.NewRecomputeWorker(mockCHClient, svc))
+
+		chErr := errors.New("connection refused")
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, chErr)
+
+		_, err := svc.PreviewCount(context.Background(), rules)
+		if !errors.Is(err, chErr) || errors.Is(err, cohort.ErrInvalidRules) {
+			t.Errorf("PreviewCount() error = %v, expected %v", err, chErr)
+		}
+	})
+}
+
+func TestService_TriggerRecomputeAndWait(t *testing.T) {
+	cohortID := uuid.New()
+	projectID := uuid.New()
+	now := time.Now().UTC()
+
+	rulesJSON, _ := json.Marshal(cohort.Rules{
+		Operator: cohort.OperatorAND,
+		Conditions: []cohort.Condition{
+			{Type: cohort.ConditionTypeEvent, EventName: "purchase"},
+		},
+	})
+	cohortRow := db.GetCohortRow{
+		ID:        pgtype.UUID{Bytes: cohortID, Valid: true},
+		ProjectID: pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:      "Buyers",
+		Rules:     rulesJSON,
+		Status:    string(cohort.CohortStatusActive),
+		Version:   1,
+		CreatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+		UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+	}
+
+	t.Run("runs inline below threshold", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mockQuerier, nil)
+		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+		svc.SetRecomputeWorker(worker)
+		svc.SetSyncRecomputeThreshold(10)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil).Times(2)
+		gomock.InOrder(
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(newRowScanner(ctrl, uint64(2)), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(newRowScanner(ctrl, "user1", "user2"), nil),
+			mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(newRowScanner(ctrl), nil),
+		)
+
+		batch := mocks.NewMockBatch(ctrl)
+		batch.EXPECT().Append(gomock.Any()).Return(nil).Times(4)
+		batch.EXPECT().Send().Return(nil).Times(2)
+		mockCHClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(batch, nil).Times(2)
+		mockQuerier.EXPECT().ClearCohortNeedsRecompute(gomock.Any(), gomock.Any()).Return(nil)
+
+		resp, err := svc.TriggerRecomputeAndWait(context.Background(), cohortID, cohort.RecomputeRequest{})
+		if err != nil {
+			t.Fatalf("TriggerRecomputeAndWait() unexpected error: %v", err)
+		}
+		if resp.Status != cohort.RecomputeStatusCompleted {
+			t.Errorf("Status = %v, expected %v", resp.Status, cohort.RecomputeStatusCompleted)
+		}
+		if resp.Result == nil || resp.Result.MembersAdded != 2 || resp.Result.MembersRemoved != 0 {
+			t.Errorf("Result = %+v, expected 2 added and 0 removed", resp.Result)
+		}
+	})
+
+	t.Run("falls back to async above threshold", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mockQuerier, nil)
+		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+		svc.SetRecomputeWorker(worker)
+		svc.SetSyncRecomputeThreshold(10)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(cohortRow, nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl, uint64(500)), nil)
+
+		resp, err := svc.TriggerRecomputeAndWait(context.Background(), cohortID, cohort.RecomputeRequest{})
+		if err != nil {
+			t.Fatalf("TriggerRecomputeAndWait() unexpected error: %v", err)
+		}
+		if resp.Status != cohort.RecomputeStatusPending {
+			t.Errorf("Status = %v, expected %v", resp.Status, cohort.RecomputeStatusPending)
+		}
+		if resp.Result != nil {
+			t.Errorf("Result = %+v, expected nil for async recompute", resp.Result)
+		}
+		if !worker.HasRunningJob(cohortID) {
+			t.Error("HasRunningJob() should return true after falling back to async")
+		}
+	})
+}
+
+func TestService_Create_RecomputeInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	svc.SetMinRecomputeInterval(time.Hour)
+
+	rules := cohort.Rules{
+		Operator:   cohort.OperatorAND,
+		Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "login"}},
+	}
+
+	tests := []struct {
+		name     string
+		interval string
+	}{
+		{name: "below minimum", interval: "30m"},
+		{name: "unparseable", interval: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Create(context.Background(), uuid.New(), cohort.CreateCohortRequest{
+				Name:              "Engaged",
+				Rules:             rules,
+				RecomputeInterval: tt.interval,
+			})
+			if !errors.Is(err, cohort.ErrInvalidRecomputeInterval) {
+				t.Errorf("Create() error = %v, expected ErrInvalidRecomputeInterval", err)
+			}
+		})
+	}
+
+	t.Run("round trips interval", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateCohortParams) (db.CreateCohortRow, error) {
+				if want := (24 * time.Hour).Microseconds(); arg.RecomputeInterval.Microseconds != want {
+					t.Errorf("RecomputeInterval = %d us, expected %d", arg.RecomputeInterval.Microseconds, want)
+				}
+				return db.CreateCohortRow{
+					ID:                pgtype.UUID{Bytes: uuid.New(), Valid: true},
+					Name:              arg.Name,
+					Rules:             arg.Rules,
+					Status:            arg.Status,
+					RecomputeInterval: arg.RecomputeInterval,
+				}, nil
+			})
+
+		c, err := svc.Create(context.Background(), uuid.New(), cohort.CreateCohortRequest{
+			Name:              "Billing",
+			Rules:             rules,
+			RecomputeInterval: "1d",
+		})
+		if err != nil {
+			t.Fatalf("Create() unexpected error: %v", err)
+		}
+		if c.RecomputeInterval != "1d" {
+			t.Errorf("RecomputeInterval = %q, expected %q", c.RecomputeInterval, "1d")
+		}
+	})
+}
+
+func TestService_NeedsRecompute(t *testing.T) {
+	cohortID := uuid.New()
+	rules := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "purchase"}}}
+	rulesJSON, _ := json.Marshal(rules)
+	existing := db.GetCohortRow{
+		ID:      pgtype.UUID{Bytes: cohortID, Valid: true},
+		Name:    "Buyers",
+		Rules:   rulesJSON,
+		Status:  string(cohort.CohortStatusActive),
+		Version: 1,
+	}
+
+	// update runs Update and returns the needs_recompute value written
+	update := func(t *testing.T, req cohort.UpdateCohortRequest) bool {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		svc := cohort.NewService(mockQuerier, nil)
+
+		var written bool
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(existing, nil)
+		mockQuerier.EXPECT().UpdateCohort(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, arg db.UpdateCohortParams) (db.UpdateCohortRow, error) {
+				written = arg.NeedsRecompute
+				return db.UpdateCohortRow{ID: arg.ID, Rules: arg.Rules, Version: 2, NeedsRecompute: arg.NeedsRecompute}, nil
+			})
+
+		c, err := svc.Update(context.Background(), cohortID, req)
+		if err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+		if c.NeedsRecompute != written {
+			t.Errorf("NeedsRecompute = %v, expected %v", c.NeedsRecompute, written)
+		}
+		return written
+	}
+
+	t.Run("set on rule change", func(t *testing.T) {
+		newRules := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "signup"}}}
+		if !update(t, cohort.UpdateCohortRequest{Rules: &newRules}) {
+			t.Error("needs_recompute = false, expected true after rule change")
+		}
+	})
+
+	t.Run("not set on rename", func(t *testing.T) {
+		if update(t, cohort.UpdateCohortRequest{Name: "Big Buyers"}) {
+			t.Error("needs_recompute = true, expected false after rename")
+		}
+	})
+
+	t.Run("cleared after job completion", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mockQuerier, nil)
+		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+		svc.SetRecomputeWorker(worker)
+
+		flagged := existing
+		flagged.Version = 3
+		flagged.NeedsRecompute = true
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(flagged, nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(newRowScanner(ctrl), nil).Times(2)
+		mockQuerier.EXPECT().ClearCohortNeedsRecompute(gomock.Any(), db.ClearCohortNeedsRecomputeParams{
+			ID:      pgtype.UUID{Bytes: cohortID, Valid: true},
+			Version: 3,
+		}).Return(nil)
+
+		job := cohort.NewRecomputeJob(cohortID)
+		worker.RunJob(context.Background(), job)
+		if job.Status != cohort.RecomputeStatusCompleted {
+			t.Errorf("Status = %v, expected completed", job.Status)
+		}
+	})
+
+	t.Run("kept after failed job", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockQuerier := mocks.NewMockQuerier(ctrl)
+		mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+		svc := cohort.NewService(mockQuerier, nil)
+		worker := cohort.NewRecomputeWorker(mockCHClient, svc)
+		svc.SetRecomputeWorker(worker)
+
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), gomock.Any()).Return(existing, nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("clickhouse down"))
+
+		job := cohort.NewRecomputeJob(cohortID)
+		worker.RunJob(context.Background(), job)
+		if job.Status != cohort.RecomputeStatusFailed {
+			t.Errorf("Status = %v, expected failed", job.Status)
+		}
+	})
+}
+
+func TestService_Create_RuleLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	svc.SetRuleLimits(cohort.RuleLimits{MaxPropertyFilters: 2})
+
+	requestWithFilters := func(n int) cohort.CreateCohortRequest {
+		filters := make([]cohort.PropertyFilter, n)
+		for i := range filters {
+			filters[i] = cohort.PropertyFilter{Key: fmt.Sprintf("prop_%d", i), Operator: cohort.ComparisonEQ, Value: "x"}
+		}
+		return cohort.CreateCohortRequest{
+			Name: "Filtered",
+			Rules: cohort.Rules{
+				Operator: cohort.OperatorAND,
+				Conditions: []cohort.Condition{
+					{Type: cohort.ConditionTypeEvent, EventName: "page_view"},
+					{Type: cohort.ConditionTypeEvent, EventName: "purchase", PropertyFilters: filters},
+				},
+			},
+		}
+	}
+
+	t.Run("over the limit is rejected", func(t *testing.T) {
+		_, err := svc.Create(context.Background(), uuid.New(), requestWithFilters(3))
+		if !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Fatalf("Create() error = %v, expected ErrInvalidRules", err)
+		}
+		if !strings.Contains(err.Error(), "condition 1 has 3 property filters, more than the limit of 2") {
+			t.Errorf("Create() error = %q, expected it to name the condition and limit", err)
+		}
+	})
+
+	t.Run("unknown missing property mode is rejected", func(t *testing.T) {
+		req := requestWithFilters(1)
+		req.Rules.Conditions[1].PropertyFilters[0].Missing = "ignore"
+
+		_, err := svc.Create(context.Background(), uuid.New(), req)
+		if !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Fatalf("Create() error = %v, expected ErrInvalidRules", err)
+		}
+		if !strings.Contains(err.Error(), `filter on "prop_0" has missing mode "ignore"`) {
+			t.Errorf("Create() error = %q, expected it to name the filter", err)
+		}
+	})
+
+	t.Run("at the limit is allowed", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{Name: "Filtered"}, nil)
+
+		if _, err := svc.Create(context.Background(), uuid.New(), requestWithFilters(2)); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+}
+
+type fakeEventRetention map[uuid.UUID]time.Duration
+
+func (f fakeEventRetention) EventRetention(ctx context.Context, projectID uuid.UUID) (time.Duration, error) {
+	return f[projectID], nil
+}
+
+func TestService_Create_EventRetention(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	shortRetention := uuid.New()
+	longRetention := uuid.New()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	svc := cohort.NewService(mockQuerier, nil)
+	svc.SetEventRetentionSource(fakeEventRetention{
+		shortRetention: 30 * 24 * time.Hour,
+		longRetention:  365 * 24 * time.Hour,
+	})
+
+	req := cohort.CreateCohortRequest{
+		Name: "Quarterly buyers",
+		Rules: cohort.Rules{
+			Operator: cohort.OperatorAND,
+			Conditions: []cohort.Condition{
+				{Type: cohort.ConditionTypeEvent, EventName: "page_view"},
+				{
+					Type:       cohort.ConditionTypeEvent,
+					EventName:  "purchase",
+					TimeWindow: &cohort.TimeWindow{Type: cohort.TimeWindowSliding, Duration: "90d"},
+				},
+			},
+		},
+	}
+
+	t.Run("window past the project's retention is rejected", func(t *testing.T) {
+		_, err := svc.Create(context.Background(), shortRetention, req)
+		if !errors.Is(err, cohort.ErrInvalidRules) {
+			t.Fatalf("Create() error = %v, expected ErrInvalidRules", err)
+		}
+		if !strings.Contains(err.Error(), "condition 1 reaches back to") || !strings.Contains(err.Error(), "event retention of 30 days") {
+			t.Errorf("Create() error = %q, expected it to name the condition and retention", err)
+		}
+	})
+
+	t.Run("window within the project's retention is allowed", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			Return(db.CreateCohortRow{Name: req.Name}, nil)
+
+		if _, err := svc.Create(context.Background(), longRetention, req); err != nil {
+			t.Errorf("Create() unexpected error: %v", err)
+		}
+	})
+}
+
+type fakeEventNameCatalog struct {
+	existing []string
+	err      error
+	queried  []string
+}
+
+func (c *fakeEventNameCatalog) ExistingEventNames(ctx context.Context, names []string) ([]string, error) {
+	c.queried = names
+	return c.existing, c.err
+}
+
+func TestService_RuleWarnings(t *testing.T) {
+	rules := cohort.Rules{
+		Operator: cohort.OperatorAND,
+		Conditions: []cohort.Condition{
+			{Type: cohort.ConditionTypeEvent, EventName: "purchase"},
+			{Type: cohort.ConditionTypeEvent, EventName: "signup_compelted"},
+			{Type: cohort.ConditionTypeAggregate, EventName: "purchase", Aggregation: cohort.AggregationSum},
+		},
+	}
+
+	t.Run("warns about unknown event names", func(t *testing.T) {
+		catalog := &fakeEventNameCatalog{existing: []string{"purchase"}}
+		svc := cohort.NewService(nil, nil)
+		svc.SetEventNameCatalog(catalog)
+
+		warnings := svc.RuleWarnings(context.Background(), rules)
+		expected := []string{`event "signup_compelted" has never been ingested, so conditions on it see no events`}
+		if !reflect.DeepEqual(warnings, expected) {
+			t.Errorf("RuleWarnings() = %q, expected %q", warnings, expected)
+		}
+		if !reflect.DeepEqual(catalog.queried, []string{"purchase", "signup_compelted"}) {
+			t.Errorf("queried = %v, expected each event name once", catalog.queried)
+		}
+	})
+
+	t.Run("no warnings when the catalog fails or is unset", func(t *testing.T) {
+		svc := cohort.NewService(nil, nil)
+		if warnings := svc.RuleWarnings(context.Background(), rules); warnings != nil {
+			t.Errorf("RuleWarnings() = %q, expected none without a catalog", warnings)
+		}
+
+		svc.SetEventNameCatalog(&fakeEventNameCatalog{err: errors.New("clickhouse unavailable")})
+		if warnings := svc.RuleWarnings(context.Background(), rules); warnings != nil {
+			t.Errorf("RuleWarnings() = %q, expected none when the lookup fails", warnings)
+		}
+	})
 }
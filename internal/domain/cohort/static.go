@@ -0,0 +1,207 @@
+package cohort
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pjhul/intent/internal/db"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// MaxStaticCohortUsers bounds the users listed in one static cohort write
+const MaxStaticCohortUsers = 100_000
+
+var (
+	ErrStaticCohort         = errors.New("static cohorts have no rules to compute membership from")
+	ErrNotStaticCohort      = errors.New("cohort is not static")
+	ErrInvalidStaticMembers = errors.New("invalid static cohort members")
+)
+
+// CreateStatic creates an active static cohort holding the listed users. Its
+// membership is written directly rather than computed from rules, so it is
+// never recomputed and changes only through UpdateStaticMembers. If the
+// members can't be written the cohort is archived, so it neither lingers
+// empty nor blocks a retry under the same name.
+func (s *Service) CreateStatic(ctx context.Context, projectID uuid.UUID, req CreateStaticCohortRequest) (*Cohort, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	if err := checkStaticUserCount(len(req.UserIDs)); err != nil {
+		return nil, err
+	}
+	userIDs, err := staticUserIDs(req.UserIDs)
+	if err != nil {
+		return nil, err
+	}
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+
+	if err := s.checkCohortLimit(ctx, projectID); err != nil {
+		return nil, err
+	}
+	if err := s.checkUniqueName(ctx, projectID, req.Name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	rulesJSON, err := json.Marshal(Rules{Operator: OperatorAND, Conditions: []Condition{}})
+	if err != nil {
+		return nil, ErrInvalidRules
+	}
+	variantsJSON, err := marshalVariants(nil)
+	if err != nil {
+		return nil, ErrInvalidVariants
+	}
+
+	dbCohort, err := s.queries.CreateCohort(ctx, db.CreateCohortParams{
+		ProjectID:     pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:          req.Name,
+		Description:   pgtype.Text{String: req.Description, Valid: req.Description != ""},
+		Rules:         rulesJSON,
+		Status:        string(CohortStatusActive),
+		StreamEnabled: true,
+		Variants:      variantsJSON,
+		CohortType:    string(CohortTypeStatic),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cohort := dbCohortRowToDomain(dbCohort)
+
+	if _, err := s.recomputeWorker.WriteStaticMembers(ctx, cohort, userIDs, nil); err != nil {
+		if archiveErr := s.queries.ArchiveCohort(ctx, dbCohort.ID); archiveErr != nil {
+			return nil, fmt.Errorf("failed to write static cohort members: %w (archiving the cohort also failed: %v)", err, archiveErr)
+		}
+		return nil, fmt.Errorf("failed to write static cohort members: %w", err)
+	}
+
+	return cohort, nil
+}
+
+// UpdateStaticMembers adds and removes users of a static cohort
+func (s *Service) UpdateStaticMembers(ctx context.Context, id uuid.UUID, req StaticMembersRequest) (*StaticMembersResponse, error) {
+	cohort, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cohort.Type != CohortTypeStatic {
+		return nil, ErrNotStaticCohort
+	}
+	if err := checkStaticUserCount(len(req.Add) + len(req.Remove)); err != nil {
+		return nil, err
+	}
+	add, err := staticUserIDs(req.Add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := staticUserIDs(req.Remove)
+	if err != nil {
+		return nil, err
+	}
+	if s.recomputeWorker == nil {
+		return nil, errors.New("recompute worker not available")
+	}
+
+	return s.recomputeWorker.WriteStaticMembers(ctx, cohort, add, remove)
+}
+
+// getRuleCohort retrieves a cohort whose membership is computed from its
+// rules, returning ErrStaticCohort for static cohorts
+func (s *Service) getRuleCohort(ctx context.Context, id uuid.UUID) (*Cohort, error) {
+	cohort, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cohort.Type == CohortTypeStatic {
+		return nil, ErrStaticCohort
+	}
+	return cohort, nil
+}
+
+// checkStaticUserCount checks that a static cohort write lists between one
+// and MaxStaticCohortUsers users
+func checkStaticUserCount(n int) error {
+	if n == 0 {
+		return fmt.Errorf("%w: no users listed", ErrInvalidStaticMembers)
+	}
+	if n > MaxStaticCohortUsers {
+		return fmt.Errorf("%w: at most %d users can be listed, got %d", ErrInvalidStaticMembers, MaxStaticCohortUsers, n)
+	}
+	return nil
+}
+
+// staticUserIDs rejects empty user IDs and drops repeated ones
+func staticUserIDs(userIDs []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(userIDs))
+	unique := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == "" {
+			return nil, fmt.Errorf("%w: empty user ID", ErrInvalidStaticMembers)
+		}
+		if _, ok := seen[userID]; ok {
+			continue
+		}
+		seen[userID] = struct{}{}
+		unique = append(unique, userID)
+	}
+	return unique, nil
+}
+
+// WriteStaticMembers writes joins for the users in add and leaves for those
+// in remove to a static cohort's membership, skipping users already in the
+// state asked for. A user in both is removed. The changes are recorded as a
+// job with reason manual.
+func (w *RecomputeWorker) WriteStaticMembers(ctx context.Context, c *Cohort, add, remove []string) (*StaticMembersResponse, error) {
+	ctx = tenant.WithCohort(tenant.WithProject(ctx, c.ProjectID), c.ID)
+
+	currentMembers, err := w.getCurrentMembers(ctx, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current members: %w", err)
+	}
+
+	removed := make(map[string]struct{}, len(remove))
+	var toRemove []string
+	for _, userID := range remove {
+		removed[userID] = struct{}{}
+		if _, ok := currentMembers[userID]; ok {
+			toRemove = append(toRemove, userID)
+		}
+	}
+	var toAdd []string
+	for _, userID := range add {
+		_, member := currentMembers[userID]
+		_, leaving := removed[userID]
+		if !member && !leaving {
+			toAdd = append(toAdd, userID)
+		}
+	}
+
+	job := NewRecomputeJob(c.ID)
+	job.Reason = ChangeReasonManual
+	job.variants = c.Variants
+	job.MarkRunning()
+	job.Progress.TotalUsers = int64(len(toAdd) + len(toRemove))
+	w.updateJob(job)
+
+	now := w.nextChangeTime()
+	if err := w.applyMembershipChanges(ctx, job, toAdd, toRemove, now); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to apply membership changes: %v", err))
+		w.updateJob(job)
+		return nil, err
+	}
+	if err := w.produceChanges(ctx, job, c.Name, toAdd, toRemove, now); err != nil {
+		job.MarkFailed(fmt.Sprintf("failed to produce membership changes: %v", err))
+		w.updateJob(job)
+		return nil, err
+	}
+
+	job.MarkCompleted()
+	w.updateJob(job)
+
+	return &StaticMembersResponse{CohortID: c.ID, Added: len(toAdd), Removed: len(toRemove)}, nil
+}
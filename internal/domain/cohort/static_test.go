@@ -0,0 +1,175 @@
+package cohort_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pjhul/intent/internal/db"
+	"github.com/pjhul/intent/internal/domain/cohort"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// membershipBatch records the users appended to the membership table by sign
+type membershipBatch struct {
+	changelog bool
+	written   map[int8][]string
+}
+
+func (b *membershipBatch) Append(args ...any) error {
+	if !b.changelog {
+		sign := args[2].(int8)
+		b.written[sign] = append(b.written[sign], args[1].(string))
+	}
+	return nil
+}
+
+func (b *membershipBatch) Send() error { return nil }
+
+// expectMembershipWrites records the users written to the membership table,
+// keyed by sign, over the given number of batches
+func expectMembershipWrites(client *mocks.MockClickHouseClient, batches int) map[int8][]string {
+	written := make(map[int8][]string)
+	client.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, query string) (cohort.Batch, error) {
+			return &membershipBatch{changelog: strings.Contains(query, "cohort_membership_changelog"), written: written}, nil
+		}).Times(batches)
+	return written
+}
+
+func TestService_StaticCohorts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mocks.NewMockQuerier(ctrl)
+	mockCHClient := mocks.NewMockClickHouseClient(ctrl)
+	// No definitions are produced for static cohorts
+	mockProducer := mocks.NewMockCohortProducer(ctrl)
+	svc := cohort.NewService(mockQuerier, mockProducer)
+	svc.SetRecomputeWorker(cohort.NewRecomputeWorker(mockCHClient, svc))
+
+	projectID := uuid.New()
+	cohortID := uuid.New()
+	pgID := pgtype.UUID{Bytes: cohortID, Valid: true}
+	staticRow := db.GetCohortRow{
+		ID:         pgID,
+		ProjectID:  pgtype.UUID{Bytes: projectID, Valid: true},
+		Name:       "Beta testers",
+		Rules:      []byte(`{"operator":"AND","conditions":[]}`),
+		Status:     string(cohort.CohortStatusActive),
+		CohortType: string(cohort.CohortTypeStatic),
+	}
+
+	t.Run("membership matches the uploaded list", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateCohortParams) (db.CreateCohortRow, error) {
+				if arg.CohortType != string(cohort.CohortTypeStatic) || arg.Status != string(cohort.CohortStatusActive) {
+					t.Errorf("type/status = %s/%s, expected an active static cohort", arg.CohortType, arg.Status)
+				}
+				return db.CreateCohortRow{
+					ID:         pgID,
+					ProjectID:  arg.ProjectID,
+					Name:       arg.Name,
+					Rules:      arg.Rules,
+					Status:     arg.Status,
+					CohortType: arg.CohortType,
+				}, nil
+			})
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID).Return(newRowScanner(ctrl), nil)
+		written := expectMembershipWrites(mockCHClient, 2)
+
+		c, err := svc.CreateStatic(context.Background(), projectID, cohort.CreateStaticCohortRequest{
+			Name:    "Beta testers",
+			UserIDs: []string{"user-1", "user-2", "user-1", "user-3"},
+		})
+		if err != nil {
+			t.Fatalf("CreateStatic() error = %v", err)
+		}
+		if c.Type != cohort.CohortTypeStatic {
+			t.Errorf("Type = %s, expected %s", c.Type, cohort.CohortTypeStatic)
+		}
+		expected := []string{"user-1", "user-2", "user-3"}
+		if !reflect.DeepEqual(written[1], expected) || len(written[-1]) != 0 {
+			t.Errorf("written = %v, expected joins for %v", written, expected)
+		}
+	})
+
+	t.Run("a failed member write archives the cohort", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			CreateCohort(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateCohortParams) (db.CreateCohortRow, error) {
+				return db.CreateCohortRow{ID: pgID, ProjectID: arg.ProjectID, Name: arg.Name, Rules: arg.Rules, Status: arg.Status, CohortType: arg.CohortType}, nil
+			})
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID).Return(nil, errors.New("connection refused"))
+		mockQuerier.EXPECT().ArchiveCohort(gomock.Any(), pgID).Return(nil)
+
+		_, err := svc.CreateStatic(context.Background(), projectID, cohort.CreateStaticCohortRequest{
+			Name:    "Beta testers",
+			UserIDs: []string{"user-1"},
+		})
+		if err == nil {
+			t.Fatal("CreateStatic() expected an error when the members can't be written")
+		}
+	})
+
+	t.Run("users are added and removed incrementally", func(t *testing.T) {
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(staticRow, nil)
+		mockCHClient.EXPECT().Query(gomock.Any(), gomock.Any(), cohortID).Return(newRowScanner(ctrl, "user-1", "user-2"), nil)
+		written := expectMembershipWrites(mockCHClient, 4)
+
+		resp, err := svc.UpdateStaticMembers(context.Background(), cohortID, cohort.StaticMembersRequest{
+			Add:    []string{"user-2", "user-4", "user-5"},
+			Remove: []string{"user-1", "user-5", "user-6"},
+		})
+		if err != nil {
+			t.Fatalf("UpdateStaticMembers() error = %v", err)
+		}
+		if resp.Added != 1 || resp.Removed != 1 {
+			t.Errorf("added/removed = %d/%d, expected 1/1", resp.Added, resp.Removed)
+		}
+		if !reflect.DeepEqual(written[1], []string{"user-4"}) || !reflect.DeepEqual(written[-1], []string{"user-1"}) {
+			t.Errorf("written = %v, expected user-4 to join and user-1 to leave", written)
+		}
+	})
+
+	t.Run("recompute is skipped", func(t *testing.T) {
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(staticRow, nil).Times(3)
+
+		if _, err := svc.TriggerRecompute(context.Background(), cohortID, cohort.RecomputeRequest{}); !errors.Is(err, cohort.ErrStaticCohort) {
+			t.Errorf("TriggerRecompute() error = %v, expected ErrStaticCohort", err)
+		}
+		if _, err := svc.TriggerScheduledRecompute(context.Background(), cohortID); !errors.Is(err, cohort.ErrStaticCohort) {
+			t.Errorf("TriggerScheduledRecompute() error = %v, expected ErrStaticCohort", err)
+		}
+		rules := cohort.Rules{Operator: cohort.OperatorAND, Conditions: []cohort.Condition{{Type: cohort.ConditionTypeEvent, EventName: "signup"}}}
+		if _, err := svc.Update(context.Background(), cohortID, cohort.UpdateCohortRequest{Rules: &rules}); !errors.Is(err, cohort.ErrStaticCohort) {
+			t.Errorf("Update() error = %v, expected ErrStaticCohort when setting rules", err)
+		}
+	})
+
+	t.Run("rule cohorts can't be written to", func(t *testing.T) {
+		rulesRow := staticRow
+		rulesRow.CohortType = string(cohort.CohortTypeRules)
+		mockQuerier.EXPECT().GetCohort(gomock.Any(), pgID).Return(rulesRow, nil)
+
+		_, err := svc.UpdateStaticMembers(context.Background(), cohortID, cohort.StaticMembersRequest{Add: []string{"user-1"}})
+		if !errors.Is(err, cohort.ErrNotStaticCohort) {
+			t.Errorf("UpdateStaticMembers() error = %v, expected ErrNotStaticCohort", err)
+		}
+	})
+
+	t.Run("invalid user lists", func(t *testing.T) {
+		if _, err := svc.CreateStatic(context.Background(), projectID, cohort.CreateStaticCohortRequest{Name: "Empty"}); !errors.Is(err, cohort.ErrInvalidStaticMembers) {
+			t.Errorf("CreateStatic() error = %v, expected ErrInvalidStaticMembers for no users", err)
+		}
+		if _, err := svc.CreateStatic(context.Background(), projectID, cohort.CreateStaticCohortRequest{Name: "Blank", UserIDs: []string{"user-1", ""}}); !errors.Is(err, cohort.ErrInvalidStaticMembers) {
+			t.Errorf("CreateStatic() error = %v, expected ErrInvalidStaticMembers for an empty user ID", err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package cohort
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StreamSettings reports which cohorts stream membership changes to
+// subscribers. Settings are cached for a TTL so the broadcaster doesn't look
+// up the cohort of every change.
+type StreamSettings struct {
+	cohortGetter CohortGetter
+	clock        Clock
+	ttl          time.Duration
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]streamSetting
+}
+
+type streamSetting struct {
+	enabled   bool
+	fetchedAt time.Time
+}
+
+// NewStreamSettings creates stream settings that re-read a cohort's setting
+// once it's older than ttl
+func NewStreamSettings(cohortGetter CohortGetter, ttl time.Duration) *StreamSettings {
+	return &StreamSettings{
+		cohortGetter: cohortGetter,
+		clock:        systemClock{},
+		ttl:          ttl,
+		entries:      make(map[uuid.UUID]streamSetting),
+	}
+}
+
+// SetClock replaces the settings' clock
+func (s *StreamSettings) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// StreamEnabled reports whether the cohort's membership changes are streamed.
+// Changes of cohorts that can't be looked up are streamed.
+func (s *StreamSettings) StreamEnabled(ctx context.Context, cohortID uuid.UUID) bool {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[cohortID]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < s.ttl {
+		return entry.enabled
+	}
+
+	c, err := s.cohortGetter.GetByID(ctx, cohortID)
+	if err != nil {
+		return true
+	}
+
+	s.mu.Lock()
+	s.entries[cohortID] = streamSetting{enabled: c.StreamEnabled, fetchedAt: now}
+	s.mu.Unlock()
+	return c.StreamEnabled
+}
@@ -0,0 +1,41 @@
+package cohort_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+func TestStreamSettings_StreamEnabled(t *testing.T) {
+	batchOnly := &cohort.Cohort{ID: uuid.New(), StreamEnabled: false}
+	streamed := &cohort.Cohort{ID: uuid.New(), StreamEnabled: true}
+	getter := &fakeCohortGetter{cohorts: map[uuid.UUID]*cohort.Cohort{batchOnly.ID: batchOnly, streamed.ID: streamed}}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	settings := cohort.NewStreamSettings(getter, time.Minute)
+	settings.SetClock(clock)
+	ctx := context.Background()
+
+	if settings.StreamEnabled(ctx, batchOnly.ID) {
+		t.Error("StreamEnabled(batch-only) = true, expected false")
+	}
+	if !settings.StreamEnabled(ctx, streamed.ID) {
+		t.Error("StreamEnabled(streamed) = false, expected true")
+	}
+	if !settings.StreamEnabled(ctx, uuid.New()) {
+		t.Error("StreamEnabled(unknown) = false, expected unknown cohorts to stream")
+	}
+
+	// The cached setting is kept until the TTL passes
+	batchOnly.StreamEnabled = true
+	if settings.StreamEnabled(ctx, batchOnly.ID) {
+		t.Error("StreamEnabled() = true within the TTL, expected the cached setting")
+	}
+	clock.Advance(time.Minute)
+	if !settings.StreamEnabled(ctx, batchOnly.ID) {
+		t.Error("StreamEnabled() = false after the TTL, expected the updated setting")
+	}
+}
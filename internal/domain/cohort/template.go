@@ -0,0 +1,146 @@
+package cohort
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// templatePlaceholder matches parameter references like {{min_amount}} inside template rules
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// TemplateParameter describes a named parameter accepted by a template
+type TemplateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Default     any    `json:"default,omitempty"`
+}
+
+// Template is a reusable cohort rule definition with named parameters.
+// Rules are stored as raw JSON where any string value may reference a
+// parameter as {{name}}. A value consisting solely of a placeholder is
+// replaced by the parameter value with its type preserved (so numbers stay
+// numbers); placeholders embedded in longer strings are substituted textually.
+type Template struct {
+	ID          uuid.UUID           `json:"id"`
+	ProjectID   uuid.UUID           `json:"project_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Rules       json.RawMessage     `json:"rules"`
+	Parameters  []TemplateParameter `json:"parameters"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// Substitute resolves the template's parameters and returns the concrete rules
+func (t *Template) Substitute(params map[string]any) (Rules, error) {
+	values := make(map[string]any, len(t.Parameters))
+	var missing []string
+	for _, p := range t.Parameters {
+		if v, ok := params[p.Name]; ok {
+			values[p.Name] = v
+			continue
+		}
+		if p.Default != nil {
+			values[p.Name] = p.Default
+			continue
+		}
+		if p.Required {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return Rules{}, fmt.Errorf("%w: %v", ErrMissingTemplateParameter, missing)
+	}
+
+	var tree any
+	if err := json.Unmarshal(t.Rules, &tree); err != nil {
+		return Rules{}, ErrInvalidRules
+	}
+
+	resolved, err := substituteValue(tree, values)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return Rules{}, ErrInvalidRules
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, ErrInvalidRules
+	}
+	return rules, nil
+}
+
+// substituteValue walks a decoded JSON tree replacing parameter placeholders
+func substituteValue(v any, values map[string]any) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			resolved, err := substituteValue(child, values)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = resolved
+		}
+		return val, nil
+	case []any:
+		for i, child := range val {
+			resolved, err := substituteValue(child, values)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = resolved
+		}
+		return val, nil
+	case string:
+		// Whole-value placeholder keeps the parameter's type
+		if m := templatePlaceholder.FindStringSubmatch(val); m != nil && m[0] == val {
+			pv, ok := values[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("%w: [%s]", ErrMissingTemplateParameter, m[1])
+			}
+			return pv, nil
+		}
+
+		var substErr error
+		out := templatePlaceholder.ReplaceAllStringFunc(val, func(match string) string {
+			name := templatePlaceholder.FindStringSubmatch(match)[1]
+			pv, ok := values[name]
+			if !ok {
+				substErr = fmt.Errorf("%w: [%s]", ErrMissingTemplateParameter, name)
+				return match
+			}
+			return fmt.Sprint(pv)
+		})
+		if substErr != nil {
+			return nil, substErr
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// CreateTemplateRequest represents the request to create a new cohort template
+type CreateTemplateRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Rules       json.RawMessage     `json:"rules" binding:"required"`
+	Parameters  []TemplateParameter `json:"parameters"`
+}
+
+// CreateFromTemplateRequest represents the request to create a cohort from a template
+type CreateFromTemplateRequest struct {
+	TemplateID  uuid.UUID      `json:"template_id" binding:"required"`
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
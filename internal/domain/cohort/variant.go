@@ -0,0 +1,83 @@
+package cohort
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// maxVariantWeight bounds a single variant's weight so the total can't overflow
+const maxVariantWeight = 1_000_000
+
+// Variant is an experiment arm members of a cohort are split into
+type Variant struct {
+	Name string `json:"name"`
+	// Weight is the variant's share of members relative to the other variants
+	Weight int `json:"weight"`
+}
+
+// AssignVariant returns the variant a user is assigned within a cohort, or ""
+// for cohorts without variants. The assignment hashes the cohort and user, so
+// it is stable across recomputes, rejoins and writers, and changes only when
+// the variants do.
+func AssignVariant(cohortID uuid.UUID, userID string, variants []Variant) string {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+
+	// A cryptographic hash keeps the low bits the modulo reads well mixed,
+	// which FNV's don't
+	sum := sha256.Sum256(append(cohortID[:], userID...))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v.Name
+		}
+		bucket -= v.Weight
+	}
+	return ""
+}
+
+// validateVariants checks that variants have unique names and positive weights
+func validateVariants(variants []Variant) error {
+	seen := make(map[string]struct{}, len(variants))
+	for i, v := range variants {
+		if v.Name == "" {
+			return fmt.Errorf("%w: variant %d has no name", ErrInvalidVariants, i)
+		}
+		if _, ok := seen[v.Name]; ok {
+			return fmt.Errorf("%w: variant %q is listed twice", ErrInvalidVariants, v.Name)
+		}
+		seen[v.Name] = struct{}{}
+		if v.Weight <= 0 || v.Weight > maxVariantWeight {
+			return fmt.Errorf("%w: variant %q weight must be between 1 and %d, got %d", ErrInvalidVariants, v.Name, maxVariantWeight, v.Weight)
+		}
+	}
+	return nil
+}
+
+// marshalVariants encodes variants for storage, storing none as an empty list
+func marshalVariants(variants []Variant) ([]byte, error) {
+	if variants == nil {
+		variants = []Variant{}
+	}
+	return json.Marshal(variants)
+}
+
+// parseVariants decodes stored variants, returning nil for none
+func parseVariants(data []byte) []Variant {
+	var variants []Variant
+	json.Unmarshal(data, &variants)
+	if len(variants) == 0 {
+		return nil
+	}
+	return variants
+}
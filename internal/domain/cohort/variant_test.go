@@ -0,0 +1,65 @@
+package cohort_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/cohort"
+)
+
+func TestAssignVariant(t *testing.T) {
+	cohortID := uuid.New()
+	variants := []cohort.Variant{{Name: "control", Weight: 1}, {Name: "treatment", Weight: 1}}
+
+	t.Run("assignment is stable", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			userID := fmt.Sprintf("user-%d", i)
+			first := cohort.AssignVariant(cohortID, userID, variants)
+			if first != "control" && first != "treatment" {
+				t.Fatalf("AssignVariant(%s) = %q, expected a listed variant", userID, first)
+			}
+			if again := cohort.AssignVariant(cohortID, userID, variants); again != first {
+				t.Errorf("AssignVariant(%s) = %q, then %q", userID, first, again)
+			}
+		}
+	})
+
+	t.Run("weights split users", func(t *testing.T) {
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			counts[cohort.AssignVariant(cohortID, fmt.Sprintf("user-%d", i), variants)]++
+		}
+		for _, v := range variants {
+			if counts[v.Name] < 4500 || counts[v.Name] > 5500 {
+				t.Errorf("%s got %d of 10000 users, expected about half", v.Name, counts[v.Name])
+			}
+		}
+
+		counts = make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			counts[cohort.AssignVariant(cohortID, fmt.Sprintf("user-%d", i), []cohort.Variant{{Name: "only", Weight: 3}})]++
+		}
+		if counts["only"] != 1000 {
+			t.Errorf("single variant got %d of 1000 users, expected all", counts["only"])
+		}
+	})
+
+	t.Run("cohort is part of the assignment", func(t *testing.T) {
+		other := uuid.New()
+		differs := false
+		for i := 0; i < 100 && !differs; i++ {
+			userID := fmt.Sprintf("user-%d", i)
+			differs = cohort.AssignVariant(cohortID, userID, variants) != cohort.AssignVariant(other, userID, variants)
+		}
+		if !differs {
+			t.Error("every user got the same variant in two cohorts, expected independent assignments")
+		}
+	})
+
+	t.Run("no variants assigns none", func(t *testing.T) {
+		if v := cohort.AssignVariant(cohortID, "user-1", nil); v != "" {
+			t.Errorf("AssignVariant() = %q, expected empty", v)
+		}
+	})
+}
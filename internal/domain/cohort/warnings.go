@@ -0,0 +1,60 @@
+package cohort
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// EventNameCatalog reports which event names have been ingested
+type EventNameCatalog interface {
+	ExistingEventNames(ctx context.Context, names []string) ([]string, error)
+}
+
+// SetEventNameCatalog enables warnings for rules that reference event names
+// that have never been ingested
+func (s *Service) SetEventNameCatalog(catalog EventNameCatalog) {
+	s.eventNames = catalog
+}
+
+// RuleWarnings returns non-fatal problems with rules, such as conditions on
+// an event that has never been ingested, which silently match no events. A
+// failed catalog lookup is logged and yields no warnings.
+func (s *Service) RuleWarnings(ctx context.Context, rules Rules) []string {
+	if s.eventNames == nil {
+		return nil
+	}
+
+	var names []string
+	seen := make(map[string]struct{})
+	for _, cond := range rules.Group().allConditions() {
+		for _, name := range cond.eventNames() {
+			if _, ok := seen[name]; ok || name == "" {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	existing, err := s.eventNames.ExistingEventNames(ctx, names)
+	if err != nil {
+		log.Printf("failed to look up event names for rule warnings: %v", err)
+		return nil
+	}
+	found := make(map[string]struct{}, len(existing))
+	for _, name := range existing {
+		found[name] = struct{}{}
+	}
+
+	var warnings []string
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			warnings = append(warnings, fmt.Sprintf("event %q has never been ingested, so conditions on it see no events", name))
+		}
+	}
+	return warnings
+}
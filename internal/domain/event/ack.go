@@ -0,0 +1,91 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidAckMode = errors.New("invalid ack mode")
+	ErrPersistTimeout = errors.New("event was not confirmed persisted before the ack timeout")
+)
+
+// AckMode selects when Ingest acknowledges an event
+type AckMode string
+
+const (
+	// AckModeProduced acknowledges once the event is produced to Kafka
+	AckModeProduced AckMode = "produced"
+	// AckModePersisted acknowledges once the event can be read back from
+	// ClickHouse, waiting at most the ack timeout
+	AckModePersisted AckMode = "persisted"
+)
+
+// PersistenceChecker reports whether an ingested event has reached ClickHouse
+type PersistenceChecker interface {
+	EventPersisted(ctx context.Context, userID, eventName string, id uuid.UUID) (bool, error)
+}
+
+// SetAckMode sets the ack mode used by requests that don't choose one
+func (s *Service) SetAckMode(mode AckMode) {
+	s.ackMode = mode
+}
+
+// SetPersistenceChecker enables the persisted ack mode. Persisted ingests
+// poll checker every pollInterval for up to timeout.
+func (s *Service) SetPersistenceChecker(checker PersistenceChecker, timeout, pollInterval time.Duration) {
+	s.persistence = checker
+	s.persistTimeout = timeout
+	s.persistPollInterval = pollInterval
+}
+
+// resolveAckMode returns the ack mode for a request, falling back to the
+// service's default
+func (s *Service) resolveAckMode(requested AckMode) (AckMode, error) {
+	mode := requested
+	if mode == "" {
+		mode = s.ackMode
+	}
+	switch mode {
+	case "", AckModeProduced:
+		return AckModeProduced, nil
+	case AckModePersisted:
+		if s.persistence == nil {
+			return "", fmt.Errorf("%w: persisted acks are not enabled", ErrInvalidAckMode)
+		}
+		return AckModePersisted, nil
+	default:
+		return "", fmt.Errorf("%w: %q, expected %s or %s", ErrInvalidAckMode, mode, AckModeProduced, AckModePersisted)
+	}
+}
+
+// awaitPersisted polls until the event can be read back from ClickHouse,
+// returning ErrPersistTimeout if it isn't within the ack timeout. Failed
+// checks are retried until the timeout.
+func (s *Service) awaitPersisted(ctx context.Context, evt *Event) error {
+	ctx, cancel := context.WithTimeout(ctx, s.persistTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(s.persistPollInterval)
+	defer ticker.Stop()
+
+	for {
+		persisted, err := s.persistence.EventPersisted(ctx, evt.UserID, evt.EventName, evt.ID)
+		if err == nil && persisted {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrPersistTimeout, err)
+			}
+			return ErrPersistTimeout
+		case <-ticker.C:
+		}
+	}
+}
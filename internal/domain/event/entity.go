@@ -10,11 +10,17 @@ import (
 // Event represents a tracked user event
 type Event struct {
 	ID         uuid.UUID              `json:"id"`
+	ProjectID  uuid.UUID              `json:"project_id"`
 	UserID     string                 `json:"user_id"`
 	EventName  string                 `json:"event_name"`
 	Properties map[string]interface{} `json:"properties,omitempty"`
 	Timestamp  time.Time              `json:"timestamp"`
+	// ReceivedAt overrides when the event was received. NewEvent leaves it
+	// zero so ClickHouse stamps received_at at insert time.
 	ReceivedAt time.Time              `json:"received_at"`
+	// Sequence orders events with the same timestamp. It is stamped at
+	// ingest when sequencing is enabled and zero otherwise.
+	Sequence   uint64                 `json:"sequence,omitempty"`
 }
 
 // NewEvent creates a new event with the given parameters
@@ -28,7 +34,6 @@ func NewEvent(userID, eventName string, properties map[string]interface{}, times
 		EventName:  eventName,
 		Properties: properties,
 		Timestamp:  timestamp,
-		ReceivedAt: time.Now().UTC(),
 	}
 }
 
@@ -79,10 +84,13 @@ func (e *Event) GetPropertyFloat64(key string) (float64, bool) {
 
 // IngestEventRequest represents the request to ingest a single event
 type IngestEventRequest struct {
-	UserID     string                 `json:"user_id" binding:"required"`
+	UserID     string                 `json:"user_id"`
 	EventName  string                 `json:"event_name" binding:"required"`
 	Properties map[string]interface{} `json:"properties"`
 	Timestamp  *time.Time             `json:"timestamp"`
+	// Ack overrides the service's ack mode for this event. Batches are
+	// always acknowledged once produced.
+	Ack AckMode `json:"ack,omitempty"`
 }
 
 // IngestBatchRequest represents the request to ingest multiple events
@@ -94,6 +102,8 @@ type IngestBatchRequest struct {
 type IngestEventResponse struct {
 	EventID   uuid.UUID `json:"event_id"`
 	Timestamp time.Time `json:"timestamp"`
+	// StrippedProperties counts keys removed by the project's property policy
+	StrippedProperties int `json:"stripped_properties,omitempty"`
 }
 
 // IngestBatchResponse represents the response after batch ingestion
@@ -101,6 +111,8 @@ type IngestBatchResponse struct {
 	Ingested int       `json:"ingested"`
 	Failed   int       `json:"failed"`
 	Errors   []string  `json:"errors,omitempty"`
+	// StrippedProperties counts keys removed by the project's property policy
+	StrippedProperties int `json:"stripped_properties,omitempty"`
 }
 
 // EventQuery represents parameters for querying events
@@ -0,0 +1,255 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+const (
+	// maxImportLineBytes is the longest line an import accepts
+	maxImportLineBytes = 1 << 20
+	// maxImportErrors bounds the errors kept per import; later ones are
+	// only counted
+	maxImportErrors = 100
+)
+
+var ErrImportNotFound = errors.New("import not found")
+
+// ImportStatus is the state of a bulk event import
+type ImportStatus string
+
+const (
+	ImportStatusRunning   ImportStatus = "running"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+)
+
+// Import reports the progress of a bulk event import
+type Import struct {
+	ID        uuid.UUID    `json:"id"`
+	ProjectID uuid.UUID    `json:"project_id"`
+	Source    string       `json:"source"`
+	Status    ImportStatus `json:"status"`
+	// Lines counts the non-empty lines read so far
+	Lines    int `json:"lines"`
+	Ingested int `json:"ingested"`
+	Failed   int `json:"failed"`
+	// Errors holds the first rejected lines' errors, labeled by line number
+	Errors      []string   `json:"errors,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Importer loads historical events from newline-delimited JSON, one
+// IngestEventRequest per line, through the batch ingest path. Batches are
+// spaced out so an import doesn't starve live ingestion.
+type Importer struct {
+	service       *Service
+	httpClient    *http.Client
+	batchSize     int
+	batchInterval time.Duration
+
+	mu      sync.Mutex
+	imports map[uuid.UUID]*Import
+}
+
+// NewImporter creates a new importer publishing batchSize events at a time,
+// at most one batch per batchInterval
+func NewImporter(service *Service, batchSize int, batchInterval time.Duration) *Importer {
+	return &Importer{
+		service:       service,
+		httpClient:    http.DefaultClient,
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		imports:       make(map[uuid.UUID]*Import),
+	}
+}
+
+// SetHTTPClient replaces the client imports from URLs are downloaded with
+func (i *Importer) SetHTTPClient(client *http.Client) {
+	i.httpClient = client
+}
+
+// Start imports the events read from r in the background and returns the
+// import, whose progress Get reports. r is closed when the import ends.
+func (i *Importer) Start(ctx context.Context, projectID uuid.UUID, source string, r io.ReadCloser) *Import {
+	imp := i.newImport(projectID, source)
+
+	// The import outlives the request that started it
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer r.Close()
+		if err := i.execute(ctx, imp, r); err != nil {
+			log.Printf("Import %s of %s failed: %v", imp.ID, source, err)
+		}
+	}()
+
+	snapshot, _ := i.Get(imp.ID)
+	return snapshot
+}
+
+// Run imports the events read from r and returns the finished import.
+// Malformed and rejected lines are counted as failed without stopping the
+// import; read errors end it.
+func (i *Importer) Run(ctx context.Context, projectID uuid.UUID, source string, r io.Reader) (*Import, error) {
+	imp := i.newImport(projectID, source)
+	err := i.execute(ctx, imp, r)
+	snapshot, _ := i.Get(imp.ID)
+	return snapshot, err
+}
+
+// newImport registers a running import
+func (i *Importer) newImport(projectID uuid.UUID, source string) *Import {
+	imp := &Import{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		Source:    source,
+		Status:    ImportStatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	i.mu.Lock()
+	i.imports[imp.ID] = imp
+	i.mu.Unlock()
+	return imp
+}
+
+// StartURL downloads newline-delimited JSON events from url, such as a
+// presigned object storage URL, and imports them in the background
+func (i *Importer) StartURL(ctx context.Context, projectID uuid.UUID, url string) (*Import, error) {
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid import URL: %w", err)
+	}
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download import: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download import: %s", resp.Status)
+	}
+	return i.Start(ctx, projectID, url, resp.Body), nil
+}
+
+// Get returns the progress of an import
+func (i *Importer) Get(id uuid.UUID) (*Import, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	imp, ok := i.imports[id]
+	if !ok {
+		return nil, ErrImportNotFound
+	}
+	snapshot := *imp
+	snapshot.Errors = append([]string(nil), imp.Errors...)
+	return &snapshot, nil
+}
+
+// execute imports the events read from r, updating imp as each batch is
+// published, and marks imp finished
+func (i *Importer) execute(ctx context.Context, imp *Import, r io.Reader) error {
+	ctx = tenant.WithProject(ctx, imp.ProjectID)
+	err := i.run(ctx, imp, r)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := time.Now().UTC()
+	imp.CompletedAt = &now
+	imp.Status = ImportStatusCompleted
+	if err != nil {
+		imp.Status = ImportStatusFailed
+		imp.Error = err.Error()
+	}
+	return err
+}
+
+func (i *Importer) run(ctx context.Context, imp *Import, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	batch := make([]IngestEventRequest, 0, i.batchSize)
+	lines := make([]int, 0, i.batchSize)
+	published := false
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if published && i.batchInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(i.batchInterval):
+			}
+		}
+		published = true
+
+		resp := i.service.ingestBatch(ctx, imp.ProjectID, batch, func(n int) string {
+			return fmt.Sprintf("line %d", lines[n])
+		})
+		i.record(imp, 0, resp.Ingested, resp.Failed, resp.Errors)
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var req IngestEventRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			i.record(imp, 1, 0, 1, []string{fmt.Sprintf("line %d: malformed JSON: %v", line, err)})
+			continue
+		}
+		if req.EventName == "" {
+			i.record(imp, 1, 0, 1, []string{fmt.Sprintf("line %d: event_name is required", line)})
+			continue
+		}
+		i.record(imp, 1, 0, 0, nil)
+		batch = append(batch, req)
+		lines = append(lines, line)
+
+		if len(batch) >= i.batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read line %d: %w", line+1, err)
+	}
+	return flush()
+}
+
+// record adds progress to an import, keeping at most maxImportErrors errors
+func (i *Importer) record(imp *Import, lines, ingested, failed int, errs []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	imp.Lines += lines
+	imp.Ingested += ingested
+	imp.Failed += failed
+	for _, e := range errs {
+		if len(imp.Errors) >= maxImportErrors {
+			break
+		}
+		imp.Errors = append(imp.Errors, e)
+	}
+}
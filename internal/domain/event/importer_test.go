@@ -0,0 +1,73 @@
+package event_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/event"
+	"github.com/pjhul/intent/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestImporter_Run(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var produced []string
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	mockProducer.EXPECT().
+		ProduceEvents(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, events []*event.Event) error {
+			for _, e := range events {
+				produced = append(produced, e.UserID+":"+e.EventName)
+			}
+			return nil
+		}).
+		Times(2)
+
+	svc := event.NewService(nil, mockProducer)
+	importer := event.NewImporter(svc, 2, 0)
+
+	payload := strings.Join([]string{
+		`{"user_id": "user-1", "event_name": "signup", "timestamp": "2023-01-01T00:00:00Z"}`,
+		`{"user_id": "user-1", "event_name": "purchase", "properties": {"amount": 20}}`,
+		`{"user_id": "user-2", "event_name": `,
+		``,
+		`{"user_id": "user-2"}`,
+		`{"user_id": "user-2", "event_name": "signup"}`,
+	}, "\n")
+
+	projectID := uuid.New()
+	imp, err := importer.Run(context.Background(), projectID, "events.jsonl", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	expected := []string{"user-1:signup", "user-1:purchase", "user-2:signup"}
+	if !reflect.DeepEqual(produced, expected) {
+		t.Errorf("produced = %v, expected %v", produced, expected)
+	}
+	if imp.Status != event.ImportStatusCompleted {
+		t.Errorf("Status = %s, expected %s", imp.Status, event.ImportStatusCompleted)
+	}
+	if imp.Lines != 5 || imp.Ingested != 3 || imp.Failed != 2 {
+		t.Errorf("lines/ingested/failed = %d/%d/%d, expected 5/3/2", imp.Lines, imp.Ingested, imp.Failed)
+	}
+	if len(imp.Errors) != 2 || !strings.HasPrefix(imp.Errors[0], "line 3: malformed JSON") || imp.Errors[1] != "line 5: event_name is required" {
+		t.Errorf("Errors = %v, expected lines 3 and 5 reported", imp.Errors)
+	}
+
+	got, err := importer.Get(imp.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Ingested != 3 || got.CompletedAt == nil {
+		t.Errorf("Get() = %+v, expected the finished import", got)
+	}
+	if _, err := importer.Get(uuid.New()); err != event.ErrImportNotFound {
+		t.Errorf("Get() error = %v, expected %v", err, event.ErrImportNotFound)
+	}
+}
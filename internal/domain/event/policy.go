@@ -0,0 +1,105 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPropertyNotAllowed    = errors.New("property not allowed")
+	ErrInvalidPropertyPolicy = errors.New("invalid property policy")
+)
+
+// PropertyPolicyMode selects whether a policy's keys are allowed or denied
+type PropertyPolicyMode string
+
+const (
+	PropertyPolicyAllow PropertyPolicyMode = "allow"
+	PropertyPolicyDeny  PropertyPolicyMode = "deny"
+)
+
+// PropertyPolicyAction selects what happens to an event with disallowed keys
+type PropertyPolicyAction string
+
+const (
+	PropertyPolicyStrip  PropertyPolicyAction = "strip"
+	PropertyPolicyReject PropertyPolicyAction = "reject"
+)
+
+// PropertyPolicy restricts the top-level property keys a project may store
+type PropertyPolicy struct {
+	Mode   PropertyPolicyMode   `json:"mode"`
+	Keys   []string             `json:"keys"`
+	Action PropertyPolicyAction `json:"action"`
+}
+
+// Validate checks the policy mode and action
+func (p *PropertyPolicy) Validate() error {
+	if p.Mode != PropertyPolicyAllow && p.Mode != PropertyPolicyDeny {
+		return fmt.Errorf("%w: mode must be allow or deny", ErrInvalidPropertyPolicy)
+	}
+	if p.Action != PropertyPolicyStrip && p.Action != PropertyPolicyReject {
+		return fmt.Errorf("%w: action must be strip or reject", ErrInvalidPropertyPolicy)
+	}
+	return nil
+}
+
+// allowed reports whether the policy permits the key
+func (p *PropertyPolicy) allowed(key string) bool {
+	listed := slices.Contains(p.Keys, key)
+	if p.Mode == PropertyPolicyAllow {
+		return listed
+	}
+	return !listed
+}
+
+// Apply returns the properties with disallowed keys removed and how many keys
+// were removed. In reject mode any disallowed key fails the event instead.
+// The input map is not modified.
+func (p *PropertyPolicy) Apply(properties map[string]any) (map[string]any, int, error) {
+	var disallowed []string
+	for key := range properties {
+		if !p.allowed(key) {
+			disallowed = append(disallowed, key)
+		}
+	}
+	if len(disallowed) == 0 {
+		return properties, 0, nil
+	}
+
+	if p.Action == PropertyPolicyReject {
+		sort.Strings(disallowed)
+		return nil, 0, fmt.Errorf("%w: %v", ErrPropertyNotAllowed, disallowed)
+	}
+
+	kept := make(map[string]any, len(properties)-len(disallowed))
+	for key, val := range properties {
+		if p.allowed(key) {
+			kept[key] = val
+		}
+	}
+	return kept, len(disallowed), nil
+}
+
+// ParsePropertyPolicies decodes a JSON object of project ID to policy
+func ParsePropertyPolicies(data string) (map[uuid.UUID]*PropertyPolicy, error) {
+	policies := make(map[uuid.UUID]*PropertyPolicy)
+	if data == "" {
+		return policies, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), &policies); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPropertyPolicy, err)
+	}
+	for projectID, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return policies, nil
+}
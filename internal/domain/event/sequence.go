@@ -0,0 +1,34 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Sequencer stamps events with increasing sequence numbers so events with
+// the same timestamp have a deterministic order. Sequences follow the wall
+// clock in nanoseconds and are strictly increasing across all users, and so
+// for each user, even when the clock stalls or steps back.
+type Sequencer struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	last uint64
+}
+
+// NewSequencer creates a new sequencer
+func NewSequencer() *Sequencer {
+	return &Sequencer{now: time.Now}
+}
+
+// Next returns the next sequence number
+func (s *Sequencer) Next() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := uint64(s.now().UnixNano())
+	if next <= s.last {
+		next = s.last + 1
+	}
+	s.last = next
+	return next
+}
@@ -2,9 +2,34 @@ package event
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+var (
+	ErrMissingUserID      = errors.New("user_id is required")
+	ErrPropertiesTooDeep  = errors.New("properties exceed maximum nesting depth")
+	ErrPropertiesTooLarge = errors.New("properties exceed maximum size")
+	ErrTooManyProperties  = errors.New("properties exceed maximum key count")
+)
+
+const (
+	// DefaultMaxPropertyDepth is the default maximum nesting depth of event properties
+	DefaultMaxPropertyDepth = 10
+	// DefaultMaxPropertyBytes is the default maximum serialized size of event properties
+	DefaultMaxPropertyBytes = 32 * 1024
+	// DefaultMaxPropertyCount is the default maximum number of top-level event property keys
+	DefaultMaxPropertyCount = 500
 )
 
 // EventRepository interface for event storage
@@ -20,11 +45,13 @@ type EventRepository interface {
 // ClickHouseEvent represents an event in ClickHouse format
 type ClickHouseEvent struct {
 	ID         uuid.UUID      `json:"id"`
+	ProjectID  uuid.UUID      `json:"project_id"`
 	UserID     string         `json:"user_id"`
 	EventName  string         `json:"event_name"`
 	Properties map[string]any `json:"properties,omitempty"`
 	Timestamp  time.Time      `json:"timestamp"`
 	ReceivedAt time.Time      `json:"received_at"`
+	Sequence   uint64         `json:"sequence,omitempty"`
 }
 
 // AggregateResult holds aggregation results
@@ -43,28 +70,262 @@ type EventProducer interface {
 	ProduceEvents(ctx context.Context, events []*Event) error
 }
 
+// LiveEvaluator evaluates a just-ingested event against the cohorts it affects
+type LiveEvaluator interface {
+	EvaluateEvent(ctx context.Context, e *Event) error
+}
+
 // Service handles event business logic
 type Service struct {
-	repo          EventRepository
-	kafkaProducer EventProducer
+	repo            EventRepository
+	kafkaProducer   EventProducer
+	liveEvaluator   LiveEvaluator
+	sequencer       *Sequencer
+	anonymousUserID string
+	policies        map[uuid.UUID]*PropertyPolicy
+
+	lowercaseKeys        bool
+	projectLowercaseKeys map[uuid.UUID]bool
+
+	maxPropertyDepth int
+	maxPropertyBytes int
+	maxPropertyCount int
+
+	maxValueLength  int
+	keyValueLengths map[string]int
+	oversizedValues OversizedValueAction
+	truncatedValues atomic.Int64
+	rejectedEvents  atomic.Int64
+
+	ackMode             AckMode
+	persistence         PersistenceChecker
+	persistTimeout      time.Duration
+	persistPollInterval time.Duration
+
+	requireProject bool
 }
 
 // NewService creates a new event service
 func NewService(repo EventRepository, producer EventProducer) *Service {
 	return &Service{
-		repo:          repo,
-		kafkaProducer: producer,
+		repo:             repo,
+		kafkaProducer:    producer,
+		maxPropertyDepth: DefaultMaxPropertyDepth,
+		maxPropertyBytes: DefaultMaxPropertyBytes,
+		maxPropertyCount: DefaultMaxPropertyCount,
+		maxValueLength:   DefaultMaxPropertyValueLength,
+		oversizedValues:  OversizedValueReject,
 	}
 }
 
-// Ingest ingests a single event
-func (s *Service) Ingest(ctx context.Context, req IngestEventRequest) (*IngestEventResponse, error) {
+// SetRequireProjectScope makes ingestion fail unless its context acts for the
+// project ingested into, and event reads fail unless it acts for any project
+func (s *Service) SetRequireProjectScope(required bool) {
+	s.requireProject = required
+}
+
+// checkScope verifies the context acts for projectID, or any project when
+// projectID is nil, when the scope is required
+func (s *Service) checkScope(ctx context.Context, projectID uuid.UUID) error {
+	if !s.requireProject {
+		return nil
+	}
+	if projectID == uuid.Nil {
+		_, err := tenant.RequireProject(ctx)
+		return err
+	}
+	return tenant.CheckProject(ctx, projectID)
+}
+
+// SetPropertyLimits sets the maximum nesting depth and serialized size in bytes
+// of event properties. A non-positive value disables the corresponding check.
+func (s *Service) SetPropertyLimits(maxDepth, maxBytes int) {
+	s.maxPropertyDepth = maxDepth
+	s.maxPropertyBytes = maxBytes
+}
+
+// SetMaxPropertyCount sets the maximum number of top-level property keys per
+// event. A non-positive count disables the check.
+func (s *Service) SetMaxPropertyCount(count int) {
+	s.maxPropertyCount = count
+}
+
+// SetAnonymousUserID buckets events with a missing user_id under the given ID
+// instead of rejecting them. An empty ID restores the default rejecting behavior.
+func (s *Service) SetAnonymousUserID(id string) {
+	s.anonymousUserID = strings.TrimSpace(id)
+}
+
+// SetLiveEvaluator enables synchronous cohort evaluation of single ingested
+// events. Evaluation failures are logged and don't fail the ingest.
+func (s *Service) SetLiveEvaluator(evaluator LiveEvaluator) {
+	s.liveEvaluator = evaluator
+}
+
+// SetSequencer stamps ingested events with sequence numbers from sequencer,
+// so conditions can order events with the same timestamp. A nil sequencer
+// leaves events unsequenced.
+func (s *Service) SetSequencer(sequencer *Sequencer) {
+	s.sequencer = sequencer
+}
+
+// SetPropertyPolicies sets the property allow/deny policy of each project.
+// Projects without a policy store all properties.
+func (s *Service) SetPropertyPolicies(policies map[uuid.UUID]*PropertyPolicy) {
+	s.policies = policies
+}
+
+// SetLowercaseKeys sets whether top-level property keys are lowercased at
+// ingest, so Country and country are stored as the same property. The
+// overrides replace the setting for individual projects.
+func (s *Service) SetLowercaseKeys(enabled bool, overrides map[uuid.UUID]bool) {
+	s.lowercaseKeys = enabled
+	s.projectLowercaseKeys = overrides
+}
+
+// lowercasesKeys reports whether the project normalizes property keys
+func (s *Service) lowercasesKeys(projectID uuid.UUID) bool {
+	if override, ok := s.projectLowercaseKeys[projectID]; ok {
+		return override
+	}
+	return s.lowercaseKeys
+}
+
+// resolveUserID validates the user ID of an incoming event
+func (s *Service) resolveUserID(userID string) (string, error) {
+	if strings.TrimSpace(userID) != "" {
+		return userID, nil
+	}
+	if s.anonymousUserID != "" {
+		return s.anonymousUserID, nil
+	}
+	return "", ErrMissingUserID
+}
+
+// validateProperties enforces the property depth and size limits
+func (s *Service) validateProperties(properties map[string]any) error {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	if s.maxPropertyCount > 0 && len(properties) > s.maxPropertyCount {
+		return fmt.Errorf("%w of %d", ErrTooManyProperties, s.maxPropertyCount)
+	}
+
+	if s.maxPropertyDepth > 0 && propertyDepth(properties) > s.maxPropertyDepth {
+		return fmt.Errorf("%w of %d", ErrPropertiesTooDeep, s.maxPropertyDepth)
+	}
+
+	if s.maxPropertyBytes > 0 {
+		data, err := json.Marshal(properties)
+		if err != nil {
+			return err
+		}
+		if len(data) > s.maxPropertyBytes {
+			return fmt.Errorf("%w of %d bytes", ErrPropertiesTooLarge, s.maxPropertyBytes)
+		}
+	}
+
+	return nil
+}
+
+// propertyDepth returns the nesting depth of a decoded JSON value
+func propertyDepth(v any) int {
+	deepest := 0
+	switch val := v.(type) {
+	case map[string]any:
+		for _, child := range val {
+			if d := propertyDepth(child); d > deepest {
+				deepest = d
+			}
+		}
+		return deepest + 1
+	case []any:
+		for _, child := range val {
+			if d := propertyDepth(child); d > deepest {
+				deepest = d
+			}
+		}
+		return deepest + 1
+	default:
+		return 0
+	}
+}
+
+// lowercaseKeys returns a copy of properties with top-level keys lowercased.
+// When keys differ only by case, the one already lowercase wins, then the
+// first in sorted order, so the result doesn't depend on map iteration.
+func lowercaseKeys(properties map[string]any) map[string]any {
+	if len(properties) == 0 {
+		return properties
+	}
+
+	normalized := make(map[string]any, len(properties))
+	for _, key := range slices.Sorted(maps.Keys(properties)) {
+		lower := strings.ToLower(key)
+		if _, taken := normalized[lower]; taken && key != lower {
+			continue
+		}
+		normalized[lower] = properties[key]
+	}
+	return normalized
+}
+
+// newEvent validates an ingest request and builds the event to publish. It
+// also returns the number of property keys stripped by the project's policy.
+func (s *Service) newEvent(projectID uuid.UUID, req IngestEventRequest) (*Event, int, error) {
+	userID, err := s.resolveUserID(req.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	properties := req.Properties
+	if s.lowercasesKeys(projectID) {
+		properties = lowercaseKeys(properties)
+	}
+	stripped := 0
+	if policy, ok := s.policies[projectID]; ok {
+		properties, stripped, err = policy.Apply(properties)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	properties, err = s.limitValueLengths(properties)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.validateProperties(properties); err != nil {
+		return nil, 0, err
+	}
+
 	timestamp := time.Now().UTC()
 	if req.Timestamp != nil {
 		timestamp = *req.Timestamp
 	}
 
-	evt := NewEvent(req.UserID, req.EventName, req.Properties, timestamp)
+	evt := NewEvent(userID, req.EventName, properties, timestamp)
+	evt.ProjectID = projectID
+	if s.sequencer != nil {
+		evt.Sequence = s.sequencer.Next()
+	}
+	return evt, stripped, nil
+}
+
+// Ingest ingests a single event. It returns once the event is produced to
+// Kafka, or under the persisted ack mode once it's readable from ClickHouse.
+func (s *Service) Ingest(ctx context.Context, projectID uuid.UUID, req IngestEventRequest) (*IngestEventResponse, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	ackMode, err := s.resolveAckMode(req.Ack)
+	if err != nil {
+		return nil, err
+	}
+	evt, stripped, err := s.newEvent(projectID, req)
+	if err != nil {
+		return nil, err
+	}
 
 	// Publish to Kafka - inserter-service will consume and write to ClickHouse
 	if s.kafkaProducer != nil {
@@ -73,24 +334,58 @@ func (s *Service) Ingest(ctx context.Context, req IngestEventRequest) (*IngestEv
 		}
 	}
 
+	if s.liveEvaluator != nil {
+		if err := s.liveEvaluator.EvaluateEvent(ctx, evt); err != nil {
+			log.Printf("Live evaluation of event %s failed: %v", evt.ID, err)
+		}
+	}
+
+	if ackMode == AckModePersisted {
+		if err := s.awaitPersisted(ctx, evt); err != nil {
+			return nil, err
+		}
+	}
+
 	return &IngestEventResponse{
-		EventID:   evt.ID,
-		Timestamp: evt.Timestamp,
+		EventID:            evt.ID,
+		Timestamp:          evt.Timestamp,
+		StrippedProperties: stripped,
 	}, nil
 }
 
 // IngestBatch ingests multiple events
-func (s *Service) IngestBatch(ctx context.Context, req IngestBatchRequest) (*IngestBatchResponse, error) {
-	events := make([]*Event, 0, len(req.Events))
+func (s *Service) IngestBatch(ctx context.Context, projectID uuid.UUID, req IngestBatchRequest) (*IngestBatchResponse, error) {
+	if err := s.checkScope(ctx, projectID); err != nil {
+		return nil, err
+	}
+	return s.ingestBatch(ctx, projectID, req.Events, func(i int) string {
+		return fmt.Sprintf("events[%d]", i)
+	}), nil
+}
 
-	for _, e := range req.Events {
-		timestamp := time.Now().UTC()
-		if e.Timestamp != nil {
-			timestamp = *e.Timestamp
-		}
+// ingestBatch validates and publishes a batch of events, labeling each
+// rejected event's error with label
+func (s *Service) ingestBatch(ctx context.Context, projectID uuid.UUID, reqs []IngestEventRequest, label func(i int) string) *IngestBatchResponse {
+	events := make([]*Event, 0, len(reqs))
+	var errs []string
+	stripped := 0
 
-		evt := NewEvent(e.UserID, e.EventName, e.Properties, timestamp)
+	for i, e := range reqs {
+		evt, n, err := s.newEvent(projectID, e)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", label(i), err))
+			continue
+		}
 		events = append(events, evt)
+		stripped += n
+	}
+
+	if len(events) == 0 {
+		return &IngestBatchResponse{
+			Ingested: 0,
+			Failed:   len(errs),
+			Errors:   errs,
+		}
 	}
 
 	// Publish batch to Kafka - inserter-service will consume and write to ClickHouse
@@ -98,20 +393,25 @@ func (s *Service) IngestBatch(ctx context.Context, req IngestBatchRequest) (*Ing
 		if err := s.kafkaProducer.ProduceEvents(ctx, events); err != nil {
 			return &IngestBatchResponse{
 				Ingested: 0,
-				Failed:   len(events),
-				Errors:   []string{err.Error()},
-			}, nil
+				Failed:   len(reqs),
+				Errors:   append(errs, err.Error()),
+			}
 		}
 	}
 
 	return &IngestBatchResponse{
-		Ingested: len(events),
-		Failed:   0,
-	}, nil
+		Ingested:           len(events),
+		Failed:             len(errs),
+		Errors:             errs,
+		StrippedProperties: stripped,
+	}
 }
 
 // GetByUserID retrieves events for a user
 func (s *Service) GetByUserID(ctx context.Context, userID string, limit, offset int) ([]*Event, error) {
+	if err := s.checkScope(ctx, uuid.Nil); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 100
 	}
@@ -129,6 +429,7 @@ func (s *Service) GetByUserID(ctx context.Context, userID string, limit, offset
 			Properties: e.Properties,
 			Timestamp:  e.Timestamp,
 			ReceivedAt: e.ReceivedAt,
+			Sequence:   e.Sequence,
 		}
 	}
 	return events, nil
@@ -136,6 +437,9 @@ func (s *Service) GetByUserID(ctx context.Context, userID string, limit, offset
 
 // HasEventInWindow checks if a user has performed an event in a time window
 func (s *Service) HasEventInWindow(ctx context.Context, userID, eventName string, window time.Duration) (bool, error) {
+	if err := s.checkScope(ctx, uuid.Nil); err != nil {
+		return false, err
+	}
 	endTime := time.Now().UTC()
 	startTime := endTime.Add(-window)
 	return s.repo.HasEventInWindow(ctx, userID, eventName, startTime, endTime)
@@ -143,6 +447,9 @@ func (s *Service) HasEventInWindow(ctx context.Context, userID, eventName string
 
 // GetAggregates retrieves aggregates for a user's events
 func (s *Service) GetAggregates(ctx context.Context, userID, eventName, propertyPath string, window time.Duration) (*AggregateResult, error) {
+	if err := s.checkScope(ctx, uuid.Nil); err != nil {
+		return nil, err
+	}
 	endTime := time.Now().UTC()
 	startTime := endTime.Add(-window)
 	return s.repo.GetAggregates(ctx, userID, eventName, propertyPath, startTime, endTime)
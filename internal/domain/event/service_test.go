@@ -0,0 +1,781 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/event"
+	"github.com/pjhul/intent/internal/mocks"
+	"github.com/pjhul/intent/internal/tenant"
+	"go.uber.org/mock/gomock"
+)
+
+func TestService_Ingest_MissingUserID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+
+	tests := []struct {
+		name   string
+		userID string
+	}{
+		{name: "rejects empty", userID: ""},
+		{name: "rejects blank", userID: "   "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+				UserID:    tt.userID,
+				EventName: "page_view",
+			})
+			if !errors.Is(err, event.ErrMissingUserID) {
+				t.Errorf("Ingest() error = %v, expected ErrMissingUserID", err)
+			}
+		})
+	}
+
+	t.Run("anonymous bucketing", func(t *testing.T) {
+		anonSvc := event.NewService(nil, mockProducer)
+		anonSvc.SetAnonymousUserID("anon")
+
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				if e.UserID != "anon" {
+					t.Errorf("UserID = %q, expected %q", e.UserID, "anon")
+				}
+				return nil
+			})
+
+		if _, err := anonSvc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:    " ",
+			EventName: "page_view",
+		}); err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestService_IngestBatch_MissingUserID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+
+	req := event.IngestBatchRequest{
+		Events: []event.IngestEventRequest{
+			{UserID: "user1", EventName: "page_view"},
+			{UserID: "", EventName: "page_view"},
+			{UserID: "user2", EventName: "purchase"},
+		},
+	}
+
+	t.Run("rejects per event", func(t *testing.T) {
+		svc := event.NewService(nil, mockProducer)
+
+		mockProducer.EXPECT().
+			ProduceEvents(gomock.Any(), gomock.Len(2)).
+			Return(nil)
+
+		resp, err := svc.IngestBatch(context.Background(), uuid.Nil, req)
+		if err != nil {
+			t.Fatalf("IngestBatch() unexpected error: %v", err)
+		}
+		if resp.Ingested != 2 {
+			t.Errorf("Ingested = %d, expected 2", resp.Ingested)
+		}
+		if resp.Failed != 1 {
+			t.Errorf("Failed = %d, expected 1", resp.Failed)
+		}
+		if len(resp.Errors) != 1 || resp.Errors[0] != "events[1]: user_id is required" {
+			t.Errorf("Errors = %v, expected one error for events[1]", resp.Errors)
+		}
+	})
+
+	t.Run("anonymous bucketing", func(t *testing.T) {
+		svc := event.NewService(nil, mockProducer)
+		svc.SetAnonymousUserID("anon")
+
+		mockProducer.EXPECT().
+			ProduceEvents(gomock.Any(), gomock.Len(3)).
+			DoAndReturn(func(_ context.Context, events []*event.Event) error {
+				if events[1].UserID != "anon" {
+					t.Errorf("UserID = %q, expected %q", events[1].UserID, "anon")
+				}
+				return nil
+			})
+
+		resp, err := svc.IngestBatch(context.Background(), uuid.Nil, req)
+		if err != nil {
+			t.Fatalf("IngestBatch() unexpected error: %v", err)
+		}
+		if resp.Ingested != 3 || resp.Failed != 0 {
+			t.Errorf("Ingested = %d, Failed = %d, expected 3 and 0", resp.Ingested, resp.Failed)
+		}
+	})
+}
+
+func TestService_Ingest_PropertyLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetPropertyLimits(3, 256)
+
+	t.Run("deeply nested payload", func(t *testing.T) {
+		props := map[string]any{"leaf": "value"}
+		for i := 0; i < 5; i++ {
+			props = map[string]any{"nested": props}
+		}
+
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: props,
+		})
+		if !errors.Is(err, event.ErrPropertiesTooDeep) {
+			t.Errorf("Ingest() error = %v, expected ErrPropertiesTooDeep", err)
+		}
+	})
+
+	t.Run("nested arrays count towards depth", func(t *testing.T) {
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: map[string]any{"items": []any{[]any{[]any{"x"}}}},
+		})
+		if !errors.Is(err, event.ErrPropertiesTooDeep) {
+			t.Errorf("Ingest() error = %v, expected ErrPropertiesTooDeep", err)
+		}
+	})
+
+	t.Run("oversized payload", func(t *testing.T) {
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: map[string]any{"blob": strings.Repeat("x", 512)},
+		})
+		if !errors.Is(err, event.ErrPropertiesTooLarge) {
+			t.Errorf("Ingest() error = %v, expected ErrPropertiesTooLarge", err)
+		}
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "purchase",
+			Properties: map[string]any{"cart": map[string]any{"total": 42.0}},
+		})
+		if err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejected per event in batch", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvents(gomock.Any(), gomock.Len(1)).Return(nil)
+
+		resp, err := svc.IngestBatch(context.Background(), uuid.Nil, event.IngestBatchRequest{
+			Events: []event.IngestEventRequest{
+				{UserID: "user1", EventName: "page_view"},
+				{UserID: "user2", EventName: "page_view", Properties: map[string]any{"blob": strings.Repeat("x", 512)}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("IngestBatch() unexpected error: %v", err)
+		}
+		if resp.Ingested != 1 || resp.Failed != 1 {
+			t.Errorf("Ingested = %d, Failed = %d, expected 1 and 1", resp.Ingested, resp.Failed)
+		}
+	})
+}
+
+func TestService_Ingest_MaxPropertyCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetMaxPropertyCount(3)
+
+	props := func(n int) map[string]any {
+		m := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			m[fmt.Sprintf("key_%d", i)] = i
+		}
+		return m
+	}
+
+	t.Run("over the limit", func(t *testing.T) {
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: props(4),
+		})
+		if !errors.Is(err, event.ErrTooManyProperties) {
+			t.Errorf("Ingest() error = %v, expected ErrTooManyProperties", err)
+		}
+	})
+
+	t.Run("nested keys don't count", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: map[string]any{"cart": props(10)},
+		})
+		if err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("at the limit", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: props(3),
+		})
+		if err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestService_Ingest_PropertyValueLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	oversized := func() map[string]any {
+		return map[string]any{
+			"title": strings.Repeat("x", 20),
+			"tags":  []any{"short", strings.Repeat("é", 10)},
+			"notes": strings.Repeat("y", 40),
+		}
+	}
+	overrides := map[string]int{"notes": 50}
+
+	t.Run("reject mode fails the event", func(t *testing.T) {
+		mockProducer := mocks.NewMockEventProducer(ctrl)
+		svc := event.NewService(nil, mockProducer)
+		svc.SetPropertyValueLimits(9, overrides, event.OversizedValueReject)
+
+		_, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: oversized(),
+		})
+		if !errors.Is(err, event.ErrPropertyValueTooLong) {
+			t.Errorf("Ingest() error = %v, expected ErrPropertyValueTooLong", err)
+		}
+		if stats := svc.PropertyValueLimitStats(); stats.RejectedEvents != 1 || stats.TruncatedValues != 0 {
+			t.Errorf("stats = %+v, expected 1 rejected event", stats)
+		}
+	})
+
+	t.Run("truncate mode cuts values to their key's limit", func(t *testing.T) {
+		mockProducer := mocks.NewMockEventProducer(ctrl)
+		svc := event.NewService(nil, mockProducer)
+		svc.SetPropertyValueLimits(9, overrides, event.OversizedValueTruncate)
+
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				expected := map[string]any{
+					"title": strings.Repeat("x", 9),
+					// Cut before the character straddling the limit
+					"tags":  []any{"short", strings.Repeat("é", 4)},
+					"notes": strings.Repeat("y", 40),
+				}
+				if !reflect.DeepEqual(e.Properties, expected) {
+					t.Errorf("Properties = %v, expected %v", e.Properties, expected)
+				}
+				return nil
+			})
+
+		props := oversized()
+		if _, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{
+			UserID:     "user1",
+			EventName:  "page_view",
+			Properties: props,
+		}); err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(props, oversized()) {
+			t.Errorf("request properties = %v, expected them unmodified", props)
+		}
+		if stats := svc.PropertyValueLimitStats(); stats.TruncatedValues != 2 || stats.RejectedEvents != 0 {
+			t.Errorf("stats = %+v, expected 2 truncated values", stats)
+		}
+	})
+}
+
+func TestService_Ingest_LiveEvaluation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	mockEvaluator := mocks.NewMockLiveEvaluator(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetLiveEvaluator(mockEvaluator)
+
+	t.Run("evaluates the produced event", func(t *testing.T) {
+		var produced *event.Event
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				produced = e
+				return nil
+			})
+		mockEvaluator.EXPECT().EvaluateEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				if e != produced {
+					t.Errorf("evaluated %v, expected the produced event", e.ID)
+				}
+				return nil
+			})
+
+		if _, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{UserID: "user-1", EventName: "purchase"}); err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("evaluation failure does not fail ingest", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+		mockEvaluator.EXPECT().EvaluateEvent(gomock.Any(), gomock.Any()).Return(errors.New("clickhouse down"))
+
+		if _, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{UserID: "user-1", EventName: "purchase"}); err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejected event is not evaluated", func(t *testing.T) {
+		if _, err := svc.Ingest(context.Background(), uuid.Nil, event.IngestEventRequest{EventName: "purchase"}); !errors.Is(err, event.ErrMissingUserID) {
+			t.Errorf("Ingest() error = %v, expected ErrMissingUserID", err)
+		}
+	})
+}
+
+func TestService_Ingest_PropertyPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stripProject := uuid.New()
+	rejectProject := uuid.New()
+	allowProject := uuid.New()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetPropertyPolicies(map[uuid.UUID]*event.PropertyPolicy{
+		stripProject:  {Mode: event.PropertyPolicyDeny, Keys: []string{"email", "phone"}, Action: event.PropertyPolicyStrip},
+		rejectProject: {Mode: event.PropertyPolicyDeny, Keys: []string{"email", "phone"}, Action: event.PropertyPolicyReject},
+		allowProject:  {Mode: event.PropertyPolicyAllow, Keys: []string{"plan"}, Action: event.PropertyPolicyStrip},
+	})
+
+	mixed := func() map[string]any {
+		return map[string]any{"email": "a@example.com", "phone": "555", "plan": "pro"}
+	}
+
+	t.Run("strip mode removes denied keys", func(t *testing.T) {
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				if len(e.Properties) != 1 || e.Properties["plan"] != "pro" {
+					t.Errorf("Properties = %v, expected only plan", e.Properties)
+				}
+				return nil
+			})
+
+		props := mixed()
+		resp, err := svc.Ingest(context.Background(), stripProject, event.IngestEventRequest{
+			UserID:     "user-1",
+			EventName:  "signup",
+			Properties: props,
+		})
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if resp.StrippedProperties != 2 {
+			t.Errorf("StrippedProperties = %d, expected 2", resp.StrippedProperties)
+		}
+		if len(props) != 3 {
+			t.Errorf("request properties = %v, expected them unmodified", props)
+		}
+	})
+
+	t.Run("allow list strips unlisted keys", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		resp, err := svc.Ingest(context.Background(), allowProject, event.IngestEventRequest{
+			UserID:     "user-1",
+			EventName:  "signup",
+			Properties: mixed(),
+		})
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if resp.StrippedProperties != 2 {
+			t.Errorf("StrippedProperties = %d, expected 2", resp.StrippedProperties)
+		}
+	})
+
+	t.Run("reject mode fails the event", func(t *testing.T) {
+		_, err := svc.Ingest(context.Background(), rejectProject, event.IngestEventRequest{
+			UserID:     "user-1",
+			EventName:  "signup",
+			Properties: mixed(),
+		})
+		if !errors.Is(err, event.ErrPropertyNotAllowed) {
+			t.Fatalf("Ingest() error = %v, expected ErrPropertyNotAllowed", err)
+		}
+		if !strings.Contains(err.Error(), "email") || !strings.Contains(err.Error(), "phone") {
+			t.Errorf("error = %v, expected denied keys listed", err)
+		}
+	})
+
+	t.Run("reject mode accepts allowed keys", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvent(gomock.Any(), gomock.Any()).Return(nil)
+
+		resp, err := svc.Ingest(context.Background(), rejectProject, event.IngestEventRequest{
+			UserID:     "user-1",
+			EventName:  "signup",
+			Properties: map[string]any{"plan": "pro"},
+		})
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if resp.StrippedProperties != 0 {
+			t.Errorf("StrippedProperties = %d, expected 0", resp.StrippedProperties)
+		}
+	})
+
+	t.Run("batch counts stripped keys and rejects per event", func(t *testing.T) {
+		mockProducer.EXPECT().ProduceEvents(gomock.Any(), gomock.Any()).Return(nil)
+
+		resp, err := svc.IngestBatch(context.Background(), stripProject, event.IngestBatchRequest{
+			Events: []event.IngestEventRequest{
+				{UserID: "user-1", EventName: "signup", Properties: mixed()},
+				{UserID: "user-2", EventName: "signup", Properties: map[string]any{"email": "b@example.com"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("IngestBatch() unexpected error: %v", err)
+		}
+		if resp.Ingested != 2 || resp.StrippedProperties != 3 {
+			t.Errorf("Ingested = %d, StrippedProperties = %d, expected 2 and 3", resp.Ingested, resp.StrippedProperties)
+		}
+
+		resp, err = svc.IngestBatch(context.Background(), rejectProject, event.IngestBatchRequest{
+			Events: []event.IngestEventRequest{
+				{UserID: "user-1", EventName: "signup", Properties: mixed()},
+			},
+		})
+		if err != nil {
+			t.Fatalf("IngestBatch() unexpected error: %v", err)
+		}
+		if resp.Ingested != 0 || resp.Failed != 1 {
+			t.Errorf("Ingested = %d, Failed = %d, expected 0 and 1", resp.Ingested, resp.Failed)
+		}
+	})
+}
+
+func TestService_Ingest_LowercaseKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	normalizedProject := uuid.New()
+	caseSensitiveProject := uuid.New()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetLowercaseKeys(true, map[uuid.UUID]bool{caseSensitiveProject: false})
+
+	ingest := func(t *testing.T, projectID uuid.UUID, properties map[string]any) map[string]any {
+		t.Helper()
+		var produced map[string]any
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				produced = e.Properties
+				return nil
+			})
+		if _, err := svc.Ingest(context.Background(), projectID, event.IngestEventRequest{
+			UserID:     "user-1",
+			EventName:  "signup",
+			Properties: properties,
+		}); err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		return produced
+	}
+
+	t.Run("lowercases keys when enabled", func(t *testing.T) {
+		props := map[string]any{"Country": "US", "PLAN": "pro", "Address": map[string]any{"City": "Austin"}}
+		got := ingest(t, normalizedProject, props)
+
+		expected := map[string]any{"country": "US", "plan": "pro", "address": map[string]any{"City": "Austin"}}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Properties = %v, expected %v", got, expected)
+		}
+		if _, ok := props["Country"]; !ok {
+			t.Errorf("request properties = %v, expected them unmodified", props)
+		}
+	})
+
+	t.Run("lowercase key wins a collision", func(t *testing.T) {
+		got := ingest(t, normalizedProject, map[string]any{"Country": "us", "country": "US", "COUNTRY": "usa"})
+
+		if !reflect.DeepEqual(got, map[string]any{"country": "US"}) {
+			t.Errorf("Properties = %v, expected the value of the lowercase key", got)
+		}
+	})
+
+	t.Run("project override keeps keys as sent", func(t *testing.T) {
+		got := ingest(t, caseSensitiveProject, map[string]any{"Country": "US"})
+
+		if !reflect.DeepEqual(got, map[string]any{"Country": "US"}) {
+			t.Errorf("Properties = %v, expected keys unchanged", got)
+		}
+	})
+}
+
+func TestService_Ingest_Sequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ingest := func(t *testing.T) uint64 {
+		t.Helper()
+		var produced uint64
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				produced = e.Sequence
+				return nil
+			})
+		if _, err := svc.Ingest(context.Background(), uuid.New(), event.IngestEventRequest{
+			UserID:    "user-1",
+			EventName: "checkout",
+			Timestamp: &timestamp,
+		}); err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		return produced
+	}
+
+	t.Run("unsequenced by default", func(t *testing.T) {
+		if got := ingest(t); got != 0 {
+			t.Errorf("Sequence = %d, expected 0", got)
+		}
+	})
+
+	t.Run("events sharing a timestamp get increasing sequences", func(t *testing.T) {
+		svc.SetSequencer(event.NewSequencer())
+
+		var last uint64
+		for i := 0; i < 100; i++ {
+			got := ingest(t)
+			if got <= last {
+				t.Fatalf("Sequence = %d after %d, expected it to increase", got, last)
+			}
+			last = got
+		}
+	})
+}
+
+// fakePersistence reports produced events persisted once they've been
+// checked lag times, like an inserter catching up
+type fakePersistence struct {
+	mu       sync.Mutex
+	lag      int
+	produced map[uuid.UUID]bool
+	checks   map[uuid.UUID]int
+}
+
+func newFakePersistence(lag int) *fakePersistence {
+	return &fakePersistence{lag: lag, produced: make(map[uuid.UUID]bool), checks: make(map[uuid.UUID]int)}
+}
+
+func (f *fakePersistence) ProduceEvent(_ context.Context, e *event.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.produced[e.ID] = true
+	return nil
+}
+
+func (f *fakePersistence) ProduceEvents(ctx context.Context, events []*event.Event) error {
+	for _, e := range events {
+		f.ProduceEvent(ctx, e)
+	}
+	return nil
+}
+
+func (f *fakePersistence) EventPersisted(_ context.Context, _, _ string, id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks[id]++
+	return f.produced[id] && f.checks[id] > f.lag, nil
+}
+
+func TestService_Ingest_AckMode(t *testing.T) {
+	req := event.IngestEventRequest{UserID: "user-1", EventName: "purchase"}
+
+	t.Run("produced acks without checking ClickHouse", func(t *testing.T) {
+		fake := newFakePersistence(2)
+		svc := event.NewService(nil, fake)
+		svc.SetPersistenceChecker(fake, time.Second, time.Millisecond)
+
+		resp, err := svc.Ingest(context.Background(), uuid.New(), req)
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if checks := fake.checks[resp.EventID]; checks != 0 {
+			t.Errorf("checks = %d, expected 0", checks)
+		}
+	})
+
+	t.Run("persisted waits for the event to reach ClickHouse", func(t *testing.T) {
+		fake := newFakePersistence(2)
+		svc := event.NewService(nil, fake)
+		svc.SetAckMode(event.AckModePersisted)
+		svc.SetPersistenceChecker(fake, time.Second, time.Millisecond)
+
+		resp, err := svc.Ingest(context.Background(), uuid.New(), req)
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if checks := fake.checks[resp.EventID]; checks != 3 {
+			t.Errorf("checks = %d, expected 3", checks)
+		}
+	})
+
+	t.Run("requests choose persisted over the default", func(t *testing.T) {
+		fake := newFakePersistence(0)
+		svc := event.NewService(nil, fake)
+		svc.SetPersistenceChecker(fake, time.Second, time.Millisecond)
+
+		persisted := req
+		persisted.Ack = event.AckModePersisted
+		resp, err := svc.Ingest(context.Background(), uuid.New(), persisted)
+		if err != nil {
+			t.Fatalf("Ingest() unexpected error: %v", err)
+		}
+		if checks := fake.checks[resp.EventID]; checks != 1 {
+			t.Errorf("checks = %d, expected 1", checks)
+		}
+	})
+
+	t.Run("persisted times out", func(t *testing.T) {
+		fake := newFakePersistence(1 << 30)
+		svc := event.NewService(nil, fake)
+		svc.SetAckMode(event.AckModePersisted)
+		svc.SetPersistenceChecker(fake, 20*time.Millisecond, time.Millisecond)
+
+		if _, err := svc.Ingest(context.Background(), uuid.New(), req); !errors.Is(err, event.ErrPersistTimeout) {
+			t.Errorf("Ingest() error = %v, expected %v", err, event.ErrPersistTimeout)
+		}
+	})
+
+	t.Run("rejects unknown and unavailable modes", func(t *testing.T) {
+		fake := newFakePersistence(0)
+		svc := event.NewService(nil, fake)
+
+		for _, mode := range []event.AckMode{"durable", event.AckModePersisted} {
+			invalid := req
+			invalid.Ack = mode
+			if _, err := svc.Ingest(context.Background(), uuid.New(), invalid); !errors.Is(err, event.ErrInvalidAckMode) {
+				t.Errorf("Ingest() with ack %q error = %v, expected %v", mode, err, event.ErrInvalidAckMode)
+			}
+		}
+		if len(fake.produced) != 0 {
+			t.Errorf("produced %d events, expected invalid requests to be rejected before producing", len(fake.produced))
+		}
+	})
+}
+
+func TestService_Ingest_RequireProjectScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProducer := mocks.NewMockEventProducer(ctrl)
+	svc := event.NewService(nil, mockProducer)
+	svc.SetRequireProjectScope(true)
+
+	projectID := uuid.New()
+	req := event.IngestEventRequest{UserID: "user-1", EventName: "page_view"}
+
+	t.Run("errors without a project in context", func(t *testing.T) {
+		if _, err := svc.Ingest(context.Background(), projectID, req); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("Ingest() error = %v, expected ErrNoProject", err)
+		}
+		if _, err := svc.GetByUserID(context.Background(), "user-1", 10, 0); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("GetByUserID() error = %v, expected ErrNoProject", err)
+		}
+	})
+
+	t.Run("errors for another project", func(t *testing.T) {
+		ctx := tenant.WithProject(context.Background(), uuid.New())
+		if _, err := svc.IngestBatch(ctx, projectID, event.IngestBatchRequest{Events: []event.IngestEventRequest{req}}); !errors.Is(err, tenant.ErrProjectMismatch) {
+			t.Errorf("IngestBatch() error = %v, expected ErrProjectMismatch", err)
+		}
+	})
+
+	t.Run("ingests for the context's project", func(t *testing.T) {
+		mockProducer.EXPECT().
+			ProduceEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *event.Event) error {
+				if e.ProjectID != projectID {
+					t.Errorf("ProjectID = %v, expected %v", e.ProjectID, projectID)
+				}
+				return nil
+			})
+
+		if _, err := svc.Ingest(tenant.WithProject(context.Background(), projectID), projectID, req); err != nil {
+			t.Errorf("Ingest() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestParsePropertyPolicies(t *testing.T) {
+	projectID := uuid.New()
+
+	t.Run("valid", func(t *testing.T) {
+		policies, err := event.ParsePropertyPolicies(`{"` + projectID.String() + `": {"mode": "deny", "keys": ["email"], "action": "strip"}}`)
+		if err != nil {
+			t.Fatalf("ParsePropertyPolicies() unexpected error: %v", err)
+		}
+		if p := policies[projectID]; p == nil || p.Mode != event.PropertyPolicyDeny || p.Keys[0] != "email" {
+			t.Errorf("policy = %+v, expected deny email", p)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		policies, err := event.ParsePropertyPolicies("")
+		if err != nil || len(policies) != 0 {
+			t.Errorf("ParsePropertyPolicies() = %v, %v, expected no policies", policies, err)
+		}
+	})
+
+	t.Run("invalid action", func(t *testing.T) {
+		_, err := event.ParsePropertyPolicies(`{"` + projectID.String() + `": {"mode": "deny", "keys": ["email"], "action": "drop"}}`)
+		if !errors.Is(err, event.ErrInvalidPropertyPolicy) {
+			t.Errorf("ParsePropertyPolicies() error = %v, expected ErrInvalidPropertyPolicy", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"unicode/utf8"
+)
+
+// DefaultMaxPropertyValueLength is the default maximum length in bytes of a
+// string property value
+const DefaultMaxPropertyValueLength = 8192
+
+var ErrPropertyValueTooLong = errors.New("property value exceeds maximum length")
+
+// OversizedValueAction selects what happens to an event with string property
+// values over their length limit
+type OversizedValueAction string
+
+const (
+	OversizedValueReject   OversizedValueAction = "reject"
+	OversizedValueTruncate OversizedValueAction = "truncate"
+)
+
+// PropertyValueLimitStats counts the string property values caught by the
+// value length limits since the service started
+type PropertyValueLimitStats struct {
+	// TruncatedValues counts values cut to their limit in truncate mode
+	TruncatedValues int64 `json:"truncated_values"`
+	// RejectedEvents counts events failed for an oversized value in reject mode
+	RejectedEvents int64 `json:"rejected_events"`
+}
+
+// SetPropertyValueLimits sets the maximum length in bytes of string property
+// values, including those nested under a key, and what happens to longer
+// ones. The overrides replace the limit for individual top-level keys. A
+// non-positive limit disables the check.
+func (s *Service) SetPropertyValueLimits(maxLength int, overrides map[string]int, action OversizedValueAction) {
+	s.maxValueLength = maxLength
+	s.keyValueLengths = overrides
+	s.oversizedValues = action
+}
+
+// PropertyValueLimitStats returns how many property values the value length
+// limits have caught
+func (s *Service) PropertyValueLimitStats() PropertyValueLimitStats {
+	return PropertyValueLimitStats{
+		TruncatedValues: s.truncatedValues.Load(),
+		RejectedEvents:  s.rejectedEvents.Load(),
+	}
+}
+
+// valueLengthLimit returns the value length limit of a top-level key
+func (s *Service) valueLengthLimit(key string) int {
+	if limit, ok := s.keyValueLengths[key]; ok {
+		return limit
+	}
+	return s.maxValueLength
+}
+
+// limitValueLengths enforces the value length limits, returning the
+// properties with oversized values truncated in truncate mode. The input map
+// is not modified.
+func (s *Service) limitValueLengths(properties map[string]any) (map[string]any, error) {
+	truncate := s.oversizedValues == OversizedValueTruncate
+
+	var limited map[string]any
+	truncated := 0
+	for _, key := range slices.Sorted(maps.Keys(properties)) {
+		limit := s.valueLengthLimit(key)
+		if limit <= 0 {
+			continue
+		}
+
+		value, n := limitValue(properties[key], limit, truncate)
+		if n == 0 {
+			continue
+		}
+		if !truncate {
+			s.rejectedEvents.Add(1)
+			return nil, fmt.Errorf("%w: %q is over %d bytes", ErrPropertyValueTooLong, key, limit)
+		}
+		if limited == nil {
+			limited = maps.Clone(properties)
+		}
+		limited[key] = value
+		truncated += n
+	}
+
+	if limited == nil {
+		return properties, nil
+	}
+	s.truncatedValues.Add(int64(truncated))
+	return limited, nil
+}
+
+// limitValue returns v with strings over limit bytes truncated when truncate
+// is set, and how many strings were over the limit. Nested maps and arrays
+// are copied rather than modified.
+func limitValue(v any, limit int, truncate bool) (any, int) {
+	switch val := v.(type) {
+	case string:
+		if len(val) <= limit {
+			return val, 0
+		}
+		if !truncate {
+			return val, 1
+		}
+		return truncateUTF8(val, limit), 1
+	case map[string]any:
+		var copied map[string]any
+		over := 0
+		for key, child := range val {
+			limited, n := limitValue(child, limit, truncate)
+			if n == 0 {
+				continue
+			}
+			if copied == nil {
+				copied = maps.Clone(val)
+			}
+			copied[key] = limited
+			over += n
+		}
+		if copied == nil {
+			return val, 0
+		}
+		return copied, over
+	case []any:
+		var copied []any
+		over := 0
+		for i, child := range val {
+			limited, n := limitValue(child, limit, truncate)
+			if n == 0 {
+				continue
+			}
+			if copied == nil {
+				copied = slices.Clone(val)
+			}
+			copied[i] = limited
+			over += n
+		}
+		if copied == nil {
+			return val, 0
+		}
+		return copied, over
+	default:
+		return v, 0
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
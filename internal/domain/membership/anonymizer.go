@@ -0,0 +1,173 @@
+package membership
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAnonymizationDisabled = errors.New("user ID anonymization is not configured")
+	ErrRawUserIDsForbidden   = errors.New("project requires anonymized user IDs")
+)
+
+// CohortProjectResolver resolves the project a cohort belongs to
+type CohortProjectResolver interface {
+	GetCohortProjectID(ctx context.Context, cohortID uuid.UUID) (uuid.UUID, error)
+}
+
+// Anonymizer replaces user IDs with stable HMAC tokens for consumers that must
+// not see raw IDs. Each project hashes with its own key derived from the
+// service secret, so tokens can't be correlated across projects.
+type Anonymizer struct {
+	secret   []byte
+	resolver CohortProjectResolver
+	projects map[uuid.UUID]uuid.UUID
+	mu       sync.RWMutex
+
+	required         bool
+	projectsRequired map[uuid.UUID]bool
+}
+
+// NewAnonymizer creates a new anonymizer. The resolver is used to find the
+// project of a membership change and may be nil if changes aren't anonymized.
+func NewAnonymizer(secret []byte, resolver CohortProjectResolver) *Anonymizer {
+	return &Anonymizer{
+		secret:   secret,
+		resolver: resolver,
+		projects: make(map[uuid.UUID]uuid.UUID),
+	}
+}
+
+// SetRequired sets whether user IDs are always anonymized, whatever the
+// consumer asks for. The overrides replace the setting for individual projects.
+func (a *Anonymizer) SetRequired(enabled bool, overrides map[uuid.UUID]bool) {
+	a.required = enabled
+	a.projectsRequired = overrides
+}
+
+// Required reports whether every output of a project's user IDs must be
+// anonymized. A nil anonymizer requires nothing.
+func (a *Anonymizer) Required(projectID uuid.UUID) bool {
+	if a == nil {
+		return false
+	}
+	if override, ok := a.projectsRequired[projectID]; ok {
+		return override
+	}
+	return a.required
+}
+
+// anyRequired reports whether some project may require anonymization
+func (a *Anonymizer) anyRequired() bool {
+	if a.required {
+		return true
+	}
+	for _, enabled := range a.projectsRequired {
+		if enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// projectKey derives the HMAC key for a project
+func (a *Anonymizer) projectKey(projectID uuid.UUID) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(projectID[:])
+	return mac.Sum(nil)
+}
+
+// Token returns the anonymized token for a user within a project
+func (a *Anonymizer) Token(projectID uuid.UUID, userID string) string {
+	mac := hmac.New(sha256.New, a.projectKey(projectID))
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Tokens returns the anonymized tokens for a list of users within a project
+func (a *Anonymizer) Tokens(projectID uuid.UUID, userIDs []string) []string {
+	tokens := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		tokens[i] = a.Token(projectID, userID)
+	}
+	return tokens
+}
+
+// AnonymizeMembers returns a copy of the response with user IDs replaced
+func (a *Anonymizer) AnonymizeMembers(projectID uuid.UUID, resp *CohortMembersResponse) *CohortMembersResponse {
+	anonymized := *resp
+	anonymized.Members = make([]Member, len(resp.Members))
+	for i, m := range resp.Members {
+		anonymized.Members[i] = Member{
+			UserID:       a.Token(projectID, m.UserID),
+			JoinedAt:     m.JoinedAt,
+			LastActiveAt: m.LastActiveAt,
+		}
+	}
+	return &anonymized
+}
+
+// AnonymizeCohortSet returns a copy of the response with user IDs replaced
+func (a *Anonymizer) AnonymizeCohortSet(projectID uuid.UUID, resp *CohortSetResponse) *CohortSetResponse {
+	anonymized := *resp
+	anonymized.UserIDs = a.Tokens(projectID, resp.UserIDs)
+	return &anonymized
+}
+
+// AnonymizeChange returns a copy of the change with the user ID replaced,
+// using the project of the change's cohort
+func (a *Anonymizer) AnonymizeChange(ctx context.Context, change *MembershipChange) (*MembershipChange, error) {
+	return a.ProtectChange(ctx, change, true)
+}
+
+// ProtectChange returns the change anonymized when requested is set or the
+// project of its cohort requires anonymization, and the change as is
+// otherwise. A nil anonymizer returns the change as is.
+func (a *Anonymizer) ProtectChange(ctx context.Context, change *MembershipChange, requested bool) (*MembershipChange, error) {
+	if a == nil || (!requested && !a.anyRequired()) {
+		return change, nil
+	}
+
+	projectID, err := a.cohortProject(ctx, change.CohortID)
+	if err != nil {
+		return nil, err
+	}
+	if !requested && !a.Required(projectID) {
+		return change, nil
+	}
+
+	anonymized := *change
+	anonymized.UserID = a.Token(projectID, change.UserID)
+	return &anonymized, nil
+}
+
+// cohortProject resolves and caches the project of a cohort
+func (a *Anonymizer) cohortProject(ctx context.Context, cohortID uuid.UUID) (uuid.UUID, error) {
+	a.mu.RLock()
+	projectID, ok := a.projects[cohortID]
+	a.mu.RUnlock()
+	if ok {
+		return projectID, nil
+	}
+
+	if a.resolver == nil {
+		return uuid.Nil, ErrAnonymizationDisabled
+	}
+
+	projectID, err := a.resolver.GetCohortProjectID(ctx, cohortID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	a.mu.Lock()
+	a.projects[cohortID] = projectID
+	a.mu.Unlock()
+
+	return projectID, nil
+}
@@ -0,0 +1,176 @@
+package membership_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+type fakeProjectResolver struct {
+	projects map[uuid.UUID]uuid.UUID
+	calls    int
+}
+
+func (r *fakeProjectResolver) GetCohortProjectID(ctx context.Context, cohortID uuid.UUID) (uuid.UUID, error) {
+	r.calls++
+	return r.projects[cohortID], nil
+}
+
+func TestAnonymizer(t *testing.T) {
+	projectA := uuid.New()
+	projectB := uuid.New()
+	cohortID := uuid.New()
+	rawIDs := []string{"alice@example.com", "bob@example.com"}
+
+	resolver := &fakeProjectResolver{projects: map[uuid.UUID]uuid.UUID{cohortID: projectA}}
+	anonymizer := membership.NewAnonymizer([]byte("secret"), resolver)
+
+	t.Run("hashing is stable", func(t *testing.T) {
+		first := anonymizer.Token(projectA, "alice@example.com")
+		second := membership.NewAnonymizer([]byte("secret"), nil).Token(projectA, "alice@example.com")
+		if first != second {
+			t.Errorf("Token() = %v, expected %v", second, first)
+		}
+		if other := anonymizer.Token(projectA, "bob@example.com"); other == first {
+			t.Errorf("Token() for different users both = %v", first)
+		}
+	})
+
+	t.Run("projects use different keys", func(t *testing.T) {
+		if anonymizer.Token(projectA, "alice@example.com") == anonymizer.Token(projectB, "alice@example.com") {
+			t.Error("Token() matched across projects")
+		}
+	})
+
+	t.Run("secret changes tokens", func(t *testing.T) {
+		other := membership.NewAnonymizer([]byte("other"), nil)
+		if anonymizer.Token(projectA, "alice@example.com") == other.Token(projectA, "alice@example.com") {
+			t.Error("Token() matched across secrets")
+		}
+	})
+
+	t.Run("members response does not leak raw IDs", func(t *testing.T) {
+		resp := &membership.CohortMembersResponse{
+			CohortID: cohortID,
+			Members: []membership.Member{
+				{UserID: rawIDs[0], JoinedAt: time.Now()},
+				{UserID: rawIDs[1], JoinedAt: time.Now()},
+			},
+			Total: 2,
+		}
+
+		anonymized := anonymizer.AnonymizeMembers(projectA, resp)
+		assertNoRawIDs(t, anonymized, rawIDs)
+
+		if anonymized.Members[0].UserID != anonymizer.Token(projectA, rawIDs[0]) {
+			t.Errorf("UserID = %v, expected token", anonymized.Members[0].UserID)
+		}
+		if resp.Members[0].UserID != rawIDs[0] {
+			t.Errorf("original UserID = %v, expected raw ID kept", resp.Members[0].UserID)
+		}
+	})
+
+	t.Run("cohort set response does not leak raw IDs", func(t *testing.T) {
+		resp := &membership.CohortSetResponse{
+			Operation: membership.SetOperationAllOf,
+			CohortIDs: []uuid.UUID{cohortID},
+			UserIDs:   rawIDs,
+			Total:     2,
+		}
+
+		assertNoRawIDs(t, anonymizer.AnonymizeCohortSet(projectA, resp), rawIDs)
+	})
+
+	t.Run("changes are hashed with the cohort's project key", func(t *testing.T) {
+		change := &membership.MembershipChange{
+			CohortID:   cohortID,
+			UserID:     rawIDs[0],
+			PrevStatus: membership.MembershipStatusOut,
+			NewStatus:  membership.MembershipStatusIn,
+			ChangedAt:  time.Now(),
+		}
+
+		anonymized, err := anonymizer.AnonymizeChange(context.Background(), change)
+		if err != nil {
+			t.Fatalf("AnonymizeChange() error = %v", err)
+		}
+		assertNoRawIDs(t, anonymized, rawIDs)
+		if anonymized.UserID != anonymizer.Token(projectA, rawIDs[0]) {
+			t.Errorf("UserID = %v, expected project A token", anonymized.UserID)
+		}
+
+		// Project lookups are cached per cohort
+		if _, err := anonymizer.AnonymizeChange(context.Background(), change); err != nil {
+			t.Fatalf("AnonymizeChange() error = %v", err)
+		}
+		if resolver.calls != 1 {
+			t.Errorf("resolver calls = %d, expected 1", resolver.calls)
+		}
+	})
+}
+
+func TestAnonymizer_Required(t *testing.T) {
+	required := uuid.New()
+	optional := uuid.New()
+	requiredCohort := uuid.New()
+	optionalCohort := uuid.New()
+
+	resolver := &fakeProjectResolver{projects: map[uuid.UUID]uuid.UUID{
+		requiredCohort: required,
+		optionalCohort: optional,
+	}}
+	anonymizer := membership.NewAnonymizer([]byte("secret"), resolver)
+	anonymizer.SetRequired(false, map[uuid.UUID]bool{required: true})
+
+	if !anonymizer.Required(required) {
+		t.Error("Required() = false for overridden project")
+	}
+	if anonymizer.Required(optional) {
+		t.Error("Required() = true for project using the default")
+	}
+	var disabled *membership.Anonymizer
+	if disabled.Required(required) {
+		t.Error("Required() = true for nil anonymizer")
+	}
+
+	tests := []struct {
+		name      string
+		cohortID  uuid.UUID
+		requested bool
+		hashed    bool
+	}{
+		{"required project is always hashed", requiredCohort, false, true},
+		{"optional project is kept raw", optionalCohort, false, false},
+		{"optional project is hashed on request", optionalCohort, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := &membership.MembershipChange{CohortID: tt.cohortID, UserID: "alice@example.com"}
+			got, err := anonymizer.ProtectChange(context.Background(), change, tt.requested)
+			if err != nil {
+				t.Fatalf("ProtectChange() error = %v", err)
+			}
+			if hashed := got.UserID != "alice@example.com"; hashed != tt.hashed {
+				t.Errorf("ProtectChange() UserID = %v, expected hashed = %v", got.UserID, tt.hashed)
+			}
+		})
+	}
+}
+
+func assertNoRawIDs(t *testing.T, v any, rawIDs []string) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, id := range rawIDs {
+		if strings.Contains(string(data), id) {
+			t.Errorf("payload %s leaks raw ID %q", data, id)
+		}
+	}
+}
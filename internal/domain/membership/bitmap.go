@@ -0,0 +1,105 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidIDMapping = errors.New("invalid id mapping")
+
+// IDMapping selects how user IDs are mapped onto the 32-bit bitmap space.
+// Both sides of a sync must use the same mapping to interpret a bitmap.
+type IDMapping string
+
+const (
+	// IDMappingInteger uses user IDs that are decimal integers in the uint32
+	// range as-is. Other user IDs are left out of the bitmap and counted as
+	// skipped.
+	IDMappingInteger IDMapping = "integer"
+	// IDMappingHash uses the 32-bit FNV-1a hash of the user ID. Every user is
+	// included, but distinct users may collide on the same value, so clients
+	// must hash their own IDs with HashUserID to test membership and should
+	// expect rare false positives on very large cohorts.
+	IDMappingHash IDMapping = "hash"
+)
+
+// HashUserID returns the bitmap value of a user ID under IDMappingHash
+func HashUserID(userID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return h.Sum32()
+}
+
+// BitmapValue returns the bitmap value of a user ID under the mapping, and
+// false when the user can't be represented
+func (m IDMapping) BitmapValue(userID string) (uint32, bool) {
+	if m == IDMappingHash {
+		return HashUserID(userID), true
+	}
+	n, err := strconv.ParseUint(userID, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// MembersBitmap is a cohort's current members serialized as a portable
+// roaring bitmap
+type MembersBitmap struct {
+	CohortID  uuid.UUID
+	IDMapping IDMapping
+	// Members is the number of members added, which may exceed the bitmap
+	// cardinality when hashed IDs collide
+	Members int64
+	// Skipped is the number of members that couldn't be mapped
+	Skipped int64
+	Data    []byte
+}
+
+// GetCohortMembersBitmap builds a roaring bitmap of a cohort's current members
+func (s *Service) GetCohortMembersBitmap(ctx context.Context, cohortID uuid.UUID, mapping IDMapping) (*MembersBitmap, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	if mapping != IDMappingInteger && mapping != IDMappingHash {
+		return nil, fmt.Errorf("%w: %q must be integer or hash", ErrInvalidIDMapping, mapping)
+	}
+
+	result := &MembersBitmap{CohortID: cohortID, IDMapping: mapping}
+	bitmap := roaring.New()
+	err := s.membershipRepo.ForEachCohortMember(ctx, cohortID, func(userID string) error {
+		value, ok := mapping.BitmapValue(userID)
+		if !ok {
+			result.Skipped++
+			return nil
+		}
+		bitmap.Add(value)
+		result.Members++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap.RunOptimize()
+	if result.Data, err = bitmap.ToBytes(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DecodeMembersBitmap returns the sorted values of a serialized members bitmap
+func DecodeMembersBitmap(data []byte) ([]uint32, error) {
+	bitmap := roaring.New()
+	if err := bitmap.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("failed to decode members bitmap: %w", err)
+	}
+	return bitmap.ToArray(), nil
+}
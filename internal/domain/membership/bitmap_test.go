@@ -0,0 +1,91 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+// rosterRepository serves a fixed member roster
+type rosterRepository struct {
+	membership.MembershipRepository
+	userIDs []string
+}
+
+func (r *rosterRepository) ForEachCohortMember(ctx context.Context, cohortID uuid.UUID, fn func(userID string) error) error {
+	for _, userID := range r.userIDs {
+		if err := fn(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestService_GetCohortMembersBitmap(t *testing.T) {
+	repo := &rosterRepository{userIDs: []string{"42", "7", "4000000000", "alice", "7"}}
+	svc := membership.NewService(repo, nil, nil)
+	cohortID := uuid.New()
+
+	t.Run("integer mapping round trips numeric IDs", func(t *testing.T) {
+		bitmap, err := svc.GetCohortMembersBitmap(context.Background(), cohortID, membership.IDMappingInteger)
+		if err != nil {
+			t.Fatalf("GetCohortMembersBitmap() error = %v", err)
+		}
+
+		values, err := membership.DecodeMembersBitmap(bitmap.Data)
+		if err != nil {
+			t.Fatalf("DecodeMembersBitmap() error = %v", err)
+		}
+		expected := []uint32{7, 42, 4000000000}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("values = %v, expected %v", values, expected)
+		}
+		if bitmap.Skipped != 1 {
+			t.Errorf("Skipped = %d, expected 1 for the non-numeric ID", bitmap.Skipped)
+		}
+	})
+
+	t.Run("hash mapping includes every member", func(t *testing.T) {
+		bitmap, err := svc.GetCohortMembersBitmap(context.Background(), cohortID, membership.IDMappingHash)
+		if err != nil {
+			t.Fatalf("GetCohortMembersBitmap() error = %v", err)
+		}
+
+		values, err := membership.DecodeMembersBitmap(bitmap.Data)
+		if err != nil {
+			t.Fatalf("DecodeMembersBitmap() error = %v", err)
+		}
+		if len(values) != 4 {
+			t.Errorf("values = %v, expected 4 distinct users", values)
+		}
+		found := false
+		for _, v := range values {
+			if v == membership.HashUserID("alice") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("values = %v, expected the hash of alice", values)
+		}
+		if bitmap.Skipped != 0 {
+			t.Errorf("Skipped = %d, expected 0", bitmap.Skipped)
+		}
+	})
+
+	t.Run("unknown mapping is rejected", func(t *testing.T) {
+		_, err := svc.GetCohortMembersBitmap(context.Background(), cohortID, membership.IDMapping("uuid"))
+		if !errors.Is(err, membership.ErrInvalidIDMapping) {
+			t.Errorf("GetCohortMembersBitmap() error = %v, expected ErrInvalidIDMapping", err)
+		}
+	})
+
+	t.Run("corrupt data fails to decode", func(t *testing.T) {
+		if _, err := membership.DecodeMembersBitmap([]byte{1, 2, 3}); err == nil {
+			t.Error("DecodeMembersBitmap() expected error for corrupt data")
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBreakdownProperty = errors.New("property is required")
+	ErrInvalidBucketBoundaries  = errors.New("bucket boundaries must be 1 to 50 strictly increasing numbers")
+)
+
+// MaxBucketBoundaries is the most boundaries a range breakdown may use
+const MaxBucketBoundaries = 50
+
+// PropertyValueCount is the number of members whose latest event carries a value
+type PropertyValueCount struct {
+	Value   string `json:"value"`
+	Members int64  `json:"members"`
+}
+
+// PropertyBreakdown segments a cohort's current members by a property
+type PropertyBreakdown struct {
+	CohortID uuid.UUID            `json:"cohort_id"`
+	Property string               `json:"property"`
+	Values   []PropertyValueCount `json:"values"`
+}
+
+// CountMembersByProperty groups a cohort's current members by the value of
+// property on their most recent event, returning at most limit values with
+// the largest groups first. Members without the property count under "".
+func (s *Service) CountMembersByProperty(ctx context.Context, cohortID uuid.UUID, property string, limit int) (*PropertyBreakdown, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(property) == "" {
+		return nil, ErrInvalidBreakdownProperty
+	}
+
+	values, err := s.membershipRepo.CountMembersByProperty(ctx, cohortID, property, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PropertyBreakdown{
+		CohortID: cohortID,
+		Property: property,
+		Values:   values,
+	}, nil
+}
+
+// BucketCount is the number of members in a repository bucket; bucket -1 holds
+// members without a numeric value
+type BucketCount struct {
+	Bucket  int
+	Members int64
+}
+
+// ValueBucket is a range of property values and the members whose latest
+// value falls in it. Min is inclusive and Max exclusive; an open end is omitted.
+type ValueBucket struct {
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Members int64    `json:"members"`
+}
+
+// RangeBreakdown segments a cohort's current members into ranges of a numeric property
+type RangeBreakdown struct {
+	CohortID uuid.UUID     `json:"cohort_id"`
+	Property string        `json:"property"`
+	Buckets  []ValueBucket `json:"buckets"`
+	// Missing counts members whose events carry no numeric value for the property
+	Missing int64 `json:"missing"`
+}
+
+// CountMembersByPropertyRange buckets a cohort's current members by the
+// numeric value of property on their most recent event carrying it. The
+// boundaries split values into len(boundaries)+1 buckets, e.g. 0, 100 and
+// 1000 give below 0, 0 to 100, 100 to 1000 and 1000 and up. Every bucket is
+// returned, empty or not.
+func (s *Service) CountMembersByPropertyRange(ctx context.Context, cohortID uuid.UUID, property string, boundaries []float64) (*RangeBreakdown, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(property) == "" {
+		return nil, ErrInvalidBreakdownProperty
+	}
+	if len(boundaries) == 0 || len(boundaries) > MaxBucketBoundaries {
+		return nil, ErrInvalidBucketBoundaries
+	}
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] <= boundaries[i-1] {
+			return nil, ErrInvalidBucketBoundaries
+		}
+	}
+
+	counts, err := s.membershipRepo.CountMembersByPropertyRange(ctx, cohortID, property, boundaries)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := &RangeBreakdown{
+		CohortID: cohortID,
+		Property: property,
+		Buckets:  make([]ValueBucket, len(boundaries)+1),
+	}
+	for i := range breakdown.Buckets {
+		if i > 0 {
+			breakdown.Buckets[i].Min = &boundaries[i-1]
+		}
+		if i < len(boundaries) {
+			breakdown.Buckets[i].Max = &boundaries[i]
+		}
+	}
+	for _, bc := range counts {
+		switch {
+		case bc.Bucket < 0:
+			breakdown.Missing += bc.Members
+		case bc.Bucket < len(breakdown.Buckets):
+			breakdown.Buckets[bc.Bucket].Members += bc.Members
+		}
+	}
+
+	return breakdown, nil
+}
@@ -0,0 +1,87 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+// bucketedRepository serves fixed bucket counts
+type bucketedRepository struct {
+	membership.MembershipRepository
+	counts []membership.BucketCount
+}
+
+func (r *bucketedRepository) CountMembersByPropertyRange(ctx context.Context, cohortID uuid.UUID, property string, boundaries []float64) ([]membership.BucketCount, error) {
+	return r.counts, nil
+}
+
+func TestService_CountMembersByPropertyRange(t *testing.T) {
+	repo := &bucketedRepository{counts: []membership.BucketCount{
+		{Bucket: -1, Members: 4},
+		{Bucket: 1, Members: 10},
+		{Bucket: 3, Members: 2},
+	}}
+	svc := membership.NewService(repo, nil, nil)
+	cohortID := uuid.New()
+
+	t.Run("labels every bucket with its range", func(t *testing.T) {
+		breakdown, err := svc.CountMembersByPropertyRange(context.Background(), cohortID, "ltv", []float64{0, 100, 1000})
+		if err != nil {
+			t.Fatalf("CountMembersByPropertyRange() error = %v", err)
+		}
+		if breakdown.Missing != 4 {
+			t.Errorf("Missing = %d, expected 4", breakdown.Missing)
+		}
+		if len(breakdown.Buckets) != 4 {
+			t.Fatalf("buckets = %d, expected 4", len(breakdown.Buckets))
+		}
+
+		expected := []struct {
+			min, max *float64
+			members  int64
+		}{
+			{nil, ptr(0), 0},
+			{ptr(0), ptr(100), 10},
+			{ptr(100), ptr(1000), 0},
+			{ptr(1000), nil, 2},
+		}
+		for i, want := range expected {
+			got := breakdown.Buckets[i]
+			if !sameBound(got.Min, want.min) || !sameBound(got.Max, want.max) || got.Members != want.members {
+				t.Errorf("bucket %d = [%v, %v) %d, expected [%v, %v) %d",
+					i, bound(got.Min), bound(got.Max), got.Members, bound(want.min), bound(want.max), want.members)
+			}
+		}
+	})
+
+	t.Run("rejects invalid boundaries", func(t *testing.T) {
+		for _, boundaries := range [][]float64{nil, {100, 100}, {1000, 100}} {
+			if _, err := svc.CountMembersByPropertyRange(context.Background(), cohortID, "ltv", boundaries); !errors.Is(err, membership.ErrInvalidBucketBoundaries) {
+				t.Errorf("boundaries %v: error = %v, expected ErrInvalidBucketBoundaries", boundaries, err)
+			}
+		}
+	})
+
+	t.Run("requires a property", func(t *testing.T) {
+		if _, err := svc.CountMembersByPropertyRange(context.Background(), cohortID, " ", []float64{0}); !errors.Is(err, membership.ErrInvalidBreakdownProperty) {
+			t.Errorf("error = %v, expected ErrInvalidBreakdownProperty", err)
+		}
+	})
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func sameBound(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func bound(v *float64) any {
+	if v == nil {
+		return "open"
+	}
+	return *v
+}
@@ -14,6 +14,25 @@ const (
 	MembershipStatusIn  MembershipStatus = 1
 )
 
+// ChangeReason records which write path produced a membership change
+type ChangeReason string
+
+const (
+	// ChangeReasonRecompute is a change found by a full recompute of the cohort
+	ChangeReasonRecompute ChangeReason = "recompute"
+	// ChangeReasonEvent is a join written by live evaluation of an ingested event
+	ChangeReasonEvent ChangeReason = "event"
+	// ChangeReasonRuleChange is a change found by the first recompute after the
+	// cohort's rules were edited
+	ChangeReasonRuleChange ChangeReason = "rule_change"
+	// ChangeReasonMerge is a change caused by merging one user into another
+	ChangeReasonMerge ChangeReason = "merge"
+	// ChangeReasonManual is a change made directly by an operator
+	ChangeReasonManual ChangeReason = "manual"
+	// ChangeReasonExpired is a leave written once a member's membership TTL passed
+	ChangeReasonExpired ChangeReason = "expired"
+)
+
 // MembershipChange represents a change in cohort membership
 type MembershipChange struct {
 	CohortID     uuid.UUID        `json:"cohort_id"`
@@ -23,6 +42,9 @@ type MembershipChange struct {
 	NewStatus    MembershipStatus `json:"new_status"`
 	ChangedAt    time.Time        `json:"changed_at"`
 	TriggerEvent *uuid.UUID       `json:"trigger_event,omitempty"`
+	Reason       ChangeReason     `json:"reason,omitempty"`
+	// Variant is the user's experiment variant in cohorts with variants
+	Variant string `json:"variant,omitempty"`
 }
 
 // IsEntry returns true if this change represents entering a cohort
@@ -41,6 +63,13 @@ type UserCohortsResponse struct {
 	Cohorts []CohortMembership `json:"cohorts"`
 }
 
+// SharedCohortsResponse represents the cohorts every one of a set of users
+// belongs to
+type SharedCohortsResponse struct {
+	UserIDs []string           `json:"user_ids"`
+	Cohorts []CohortMembership `json:"cohorts"`
+}
+
 // CohortMembership represents a cohort membership entry for a user
 type CohortMembership struct {
 	CohortID   uuid.UUID `json:"cohort_id"`
@@ -51,28 +80,79 @@ type CohortMembership struct {
 // CohortMembersResponse represents the members of a cohort
 type CohortMembersResponse struct {
 	CohortID uuid.UUID `json:"cohort_id"`
+	Variant  string    `json:"variant,omitempty"`
 	Members  []Member  `json:"members"`
 	Total    int64     `json:"total"`
 	Limit    int       `json:"limit"`
 	Offset   int       `json:"offset"`
 }
 
+// SetOperation is a set operation over cohort memberships
+type SetOperation string
+
+const (
+	SetOperationAllOf  SetOperation = "all_of"
+	SetOperationAnyOf  SetOperation = "any_of"
+	SetOperationNoneOf SetOperation = "none_of"
+)
+
+// CohortSetResponse represents the users matching a set operation over cohorts
+type CohortSetResponse struct {
+	Operation SetOperation `json:"operation"`
+	CohortIDs []uuid.UUID  `json:"cohort_ids"`
+	UserIDs   []string     `json:"user_ids"`
+	Total     int64        `json:"total"`
+	Limit     int          `json:"limit"`
+	Offset    int          `json:"offset"`
+}
+
 // Member represents a cohort member
 type Member struct {
 	UserID   string    `json:"user_id"`
 	JoinedAt time.Time `json:"joined_at"`
+	Variant  string    `json:"variant,omitempty"`
+	// LastActiveAt is the time of the member's latest event, when requested
+	LastActiveAt *time.Time `json:"last_active_at,omitempty"`
 }
 
+// ChangeDirection filters membership changes by entries or exits
+type ChangeDirection string
+
+const (
+	ChangeDirectionEntry ChangeDirection = "entry"
+	ChangeDirectionExit  ChangeDirection = "exit"
+)
+
 // StreamSubscription represents a subscription to cohort change events
 type StreamSubscription struct {
 	ID        string      `json:"id"`
 	CohortIDs []uuid.UUID `json:"cohort_ids,omitempty"`
 	UserIDs   []string    `json:"user_ids,omitempty"`
-	CreatedAt time.Time   `json:"created_at"`
+	// Direction limits the subscription to entries or exits; empty matches both
+	Direction ChangeDirection `json:"direction,omitempty"`
+	// Variant limits the subscription to changes in one experiment variant
+	Variant   string    `json:"variant,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // MatchesChange returns true if the subscription matches the given change
 func (s *StreamSubscription) MatchesChange(change *MembershipChange) bool {
+	// Check direction filter
+	switch s.Direction {
+	case ChangeDirectionEntry:
+		if !change.IsEntry() {
+			return false
+		}
+	case ChangeDirectionExit:
+		if !change.IsExit() {
+			return false
+		}
+	}
+
+	if s.Variant != "" && change.Variant != s.Variant {
+		return false
+	}
+
 	// If no filters, match everything
 	if len(s.CohortIDs) == 0 && len(s.UserIDs) == 0 {
 		return true
@@ -0,0 +1,90 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+var ErrErasureDisabled = errors.New("user erasure is not configured")
+
+// ErasureStatusPending marks an erasure whose event deletion is still running
+const ErasureStatusPending = "pending"
+
+// UserEventDeleter deletes a user's stored events
+type UserEventDeleter interface {
+	// DeleteUserEvents submits the deletion of the user's events in a project
+	DeleteUserEvents(ctx context.Context, projectID uuid.UUID, userID string) error
+}
+
+// ErasureJob is the handle for a submitted user erasure. The project and user
+// identify the event deletion, which is done once none of the user's events
+// in the project remain.
+type ErasureJob struct {
+	ProjectID        uuid.UUID `json:"project_id"`
+	UserID           string    `json:"user_id"`
+	Status           string    `json:"status"`
+	CancelledCohorts int       `json:"cancelled_cohorts"`
+	SubmittedAt      time.Time `json:"submitted_at"`
+}
+
+// SetUserEventDeleter enables EraseUser
+func (s *Service) SetUserEventDeleter(deleter UserEventDeleter) {
+	s.eventDeleter = deleter
+}
+
+// EraseUser removes a user from every cohort of the context's project and
+// deletes their events in it. The memberships are cancelled immediately; the
+// event deletion runs in the background, so a recompute before it finishes
+// may briefly re-add the user.
+func (s *Service) EraseUser(ctx context.Context, userID string) (*ErasureJob, error) {
+	projectID, err := tenant.RequireProject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.eventDeleter == nil {
+		return nil, ErrErasureDisabled
+	}
+
+	projectCohorts, err := s.projectCohortIDs(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project cohorts: %w", err)
+	}
+
+	userCohorts, err := s.membershipRepo.GetUserCohorts(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user cohorts: %w", err)
+	}
+	cohortIDs := slices.DeleteFunc(userCohorts, func(id uuid.UUID) bool {
+		return !slices.Contains(projectCohorts, id)
+	})
+
+	if err := s.membershipRepo.DeleteUserMemberships(ctx, userID, projectCohorts); err != nil {
+		return nil, fmt.Errorf("failed to cancel memberships: %w", err)
+	}
+
+	if err := s.eventDeleter.DeleteUserEvents(ctx, projectID, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete events: %w", err)
+	}
+
+	if s.cache != nil {
+		for _, cohortID := range cohortIDs {
+			s.cache.InvalidateMembership(ctx, cohortID, userID)
+			s.cache.InvalidateCohort(ctx, cohortID)
+		}
+		s.cache.InvalidateUserCohorts(ctx, userID)
+	}
+
+	return &ErasureJob{
+		ProjectID:        projectID,
+		UserID:           userID,
+		Status:           ErasureStatusPending,
+		CancelledCohorts: len(cohortIDs),
+		SubmittedAt:      time.Now().UTC(),
+	}, nil
+}
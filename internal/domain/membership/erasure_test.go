@@ -0,0 +1,74 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// erasureRepository holds the cohorts each user is a member of
+type erasureRepository struct {
+	membership.MembershipRepository
+	members map[string][]uuid.UUID
+}
+
+func (r *erasureRepository) GetUserCohorts(ctx context.Context, userID string) ([]uuid.UUID, error) {
+	return slices.Clone(r.members[userID]), nil
+}
+
+func (r *erasureRepository) DeleteUserMemberships(ctx context.Context, userID string, cohortIDs []uuid.UUID) error {
+	r.members[userID] = slices.DeleteFunc(r.members[userID], func(id uuid.UUID) bool {
+		return slices.Contains(cohortIDs, id)
+	})
+	return nil
+}
+
+// projectEvents holds the users with stored events in each project
+type projectEvents map[uuid.UUID][]string
+
+func (e projectEvents) DeleteUserEvents(ctx context.Context, projectID uuid.UUID, userID string) error {
+	e[projectID] = slices.DeleteFunc(e[projectID], func(id string) bool { return id == userID })
+	return nil
+}
+
+func TestService_EraseUser(t *testing.T) {
+	projectA, projectB := uuid.New(), uuid.New()
+	cohortA, cohortB := uuid.New(), uuid.New()
+
+	repo := &erasureRepository{members: map[string][]uuid.UUID{"user-1": {cohortA, cohortB}}}
+	events := projectEvents{projectA: {"user-1"}, projectB: {"user-1"}}
+
+	svc := membership.NewService(repo, nil, nil)
+	svc.SetProjectCohortLister(projectCohorts{projectA: {cohortA}, projectB: {cohortB}})
+	svc.SetUserEventDeleter(events)
+
+	t.Run("requires a project", func(t *testing.T) {
+		if _, err := svc.EraseUser(context.Background(), "user-1"); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("EraseUser() error = %v, expected ErrNoProject", err)
+		}
+	})
+
+	t.Run("other projects keep their memberships and events", func(t *testing.T) {
+		job, err := svc.EraseUser(tenant.WithProject(context.Background(), projectA), "user-1")
+		if err != nil {
+			t.Fatalf("EraseUser() error = %v", err)
+		}
+		if job.ProjectID != projectA || job.UserID != "user-1" || job.CancelledCohorts != 1 {
+			t.Errorf("job = %+v, expected one cancelled cohort of project %v", job, projectA)
+		}
+		if got := repo.members["user-1"]; !slices.Equal(got, []uuid.UUID{cohortB}) {
+			t.Errorf("memberships = %v, expected only %v left", got, cohortB)
+		}
+		if len(events[projectA]) != 0 {
+			t.Errorf("project A events = %v, expected none", events[projectA])
+		}
+		if !slices.Equal(events[projectB], []string{"user-1"}) {
+			t.Errorf("project B events = %v, expected them kept", events[projectB])
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrCohortNotFound = errors.New("cohort not found")
+
+// MembershipOverride is a user manually placed in or removed from a cohort.
+// Recomputes keep overridden users where they were put unless run with
+// respect_overrides=false.
+type MembershipOverride struct {
+	CohortID  uuid.UUID        `json:"cohort_id"`
+	UserID    string           `json:"user_id"`
+	Status    MembershipStatus `json:"status"`
+	IsMember  bool             `json:"is_member"`
+	Changed   bool             `json:"changed"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// AddMember forces a user into a cohort regardless of its rules
+func (s *Service) AddMember(ctx context.Context, cohortID uuid.UUID, userID string) (*MembershipOverride, error) {
+	return s.override(ctx, cohortID, userID, MembershipStatusIn)
+}
+
+// RemoveMember forces a user out of a cohort regardless of its rules
+func (s *Service) RemoveMember(ctx context.Context, cohortID uuid.UUID, userID string) (*MembershipOverride, error) {
+	return s.override(ctx, cohortID, userID, MembershipStatusOut)
+}
+
+// override records the override and, if the user's membership differs from
+// it, writes the membership change with reason manual
+func (s *Service) override(ctx context.Context, cohortID uuid.UUID, userID string, status MembershipStatus) (*MembershipOverride, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
+	var cohortName string
+	if s.cohortGetter != nil {
+		name, err := s.cohortGetter.GetCohortName(ctx, cohortID)
+		if err != nil {
+			return nil, ErrCohortNotFound
+		}
+		cohortName = name
+	}
+
+	isMember := false
+	if stored, err := s.membershipRepo.GetByCohortAndUser(ctx, cohortID, userID, s.membershipTTL(ctx, cohortID)); err == nil {
+		isMember = stored.IsMember()
+	}
+
+	now := time.Now().UTC()
+	if err := s.membershipRepo.SetOverride(ctx, cohortID, userID, int8(status), now); err != nil {
+		return nil, fmt.Errorf("failed to record override: %w", err)
+	}
+
+	changed := isMember != (status == MembershipStatusIn)
+	if changed {
+		prev := MembershipStatusOut
+		if isMember {
+			prev = MembershipStatusIn
+		}
+		var variant string
+		if status == MembershipStatusIn && s.variants != nil {
+			assigned, err := s.variants.AssignVariant(ctx, cohortID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to assign variant: %w", err)
+			}
+			variant = assigned
+		}
+		if err := s.membershipRepo.ApplyChange(ctx, &MembershipChange{
+			CohortID:   cohortID,
+			CohortName: cohortName,
+			UserID:     userID,
+			PrevStatus: prev,
+			NewStatus:  status,
+			ChangedAt:  now,
+			Reason:     ChangeReasonManual,
+			Variant:    variant,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to apply membership change: %w", err)
+		}
+
+		if s.cache != nil {
+			s.cache.InvalidateMembership(ctx, cohortID, userID)
+			s.cache.InvalidateUserCohorts(ctx, userID)
+			s.cache.InvalidateCohort(ctx, cohortID)
+		}
+	}
+
+	return &MembershipOverride{
+		CohortID:  cohortID,
+		UserID:    userID,
+		Status:    status,
+		IsMember:  status == MembershipStatusIn,
+		Changed:   changed,
+		CreatedAt: now,
+	}, nil
+}
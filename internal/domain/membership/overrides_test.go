@@ -0,0 +1,131 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+// overrideRepository tracks one user's membership and records the overrides
+// and changes written for it
+type overrideRepository struct {
+	membership.MembershipRepository
+	member    bool
+	overrides []int8
+	changes   []*membership.MembershipChange
+}
+
+func (r *overrideRepository) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*membership.StoredMembership, error) {
+	if !r.member {
+		return nil, membership.ErrMembershipNotFound
+	}
+	return &membership.StoredMembership{CohortID: cohortID, UserID: userID, Status: 1}, nil
+}
+
+func (r *overrideRepository) SetOverride(ctx context.Context, cohortID uuid.UUID, userID string, status int8, at time.Time) error {
+	r.overrides = append(r.overrides, status)
+	return nil
+}
+
+func (r *overrideRepository) ApplyChange(ctx context.Context, change *membership.MembershipChange) error {
+	r.changes = append(r.changes, change)
+	r.member = change.NewStatus == membership.MembershipStatusIn
+	return nil
+}
+
+type namedCohorts struct {
+	names map[uuid.UUID]string
+}
+
+func (g *namedCohorts) GetCohortName(ctx context.Context, id uuid.UUID) (string, error) {
+	name, ok := g.names[id]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return name, nil
+}
+
+func (g *namedCohorts) GetCohortSummary(ctx context.Context, id uuid.UUID) (*membership.CohortSummary, error) {
+	name, err := g.GetCohortName(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &membership.CohortSummary{ID: id, Name: name, Status: "active", Version: 3}, nil
+}
+
+func TestService_MembershipOverrides(t *testing.T) {
+	cohortID := uuid.New()
+	cohorts := &namedCohorts{names: map[uuid.UUID]string{cohortID: "vip"}}
+
+	t.Run("adding a non-member writes a manual join", func(t *testing.T) {
+		repo := &overrideRepository{}
+		svc := membership.NewService(repo, cohorts, nil)
+
+		override, err := svc.AddMember(context.Background(), cohortID, "user-1")
+		if err != nil {
+			t.Fatalf("AddMember() error = %v", err)
+		}
+		if !override.IsMember || !override.Changed {
+			t.Errorf("override = %+v, expected a changed membership", override)
+		}
+		if len(repo.overrides) != 1 || repo.overrides[0] != 1 {
+			t.Errorf("overrides = %v, expected [1]", repo.overrides)
+		}
+		if len(repo.changes) != 1 {
+			t.Fatalf("changes = %d, expected 1", len(repo.changes))
+		}
+		change := repo.changes[0]
+		if !change.IsEntry() || change.Reason != membership.ChangeReasonManual || change.CohortName != "vip" {
+			t.Errorf("change = %+v, expected a manual entry into vip", change)
+		}
+	})
+
+	t.Run("removing a member writes a manual leave", func(t *testing.T) {
+		repo := &overrideRepository{member: true}
+		svc := membership.NewService(repo, cohorts, nil)
+
+		override, err := svc.RemoveMember(context.Background(), cohortID, "user-1")
+		if err != nil {
+			t.Fatalf("RemoveMember() error = %v", err)
+		}
+		if override.IsMember || !override.Changed {
+			t.Errorf("override = %+v, expected a changed membership", override)
+		}
+		if len(repo.changes) != 1 || !repo.changes[0].IsExit() || repo.changes[0].Reason != membership.ChangeReasonManual {
+			t.Errorf("changes = %+v, expected a manual exit", repo.changes)
+		}
+	})
+
+	t.Run("override matching current membership records only the override", func(t *testing.T) {
+		repo := &overrideRepository{member: true}
+		svc := membership.NewService(repo, cohorts, nil)
+
+		override, err := svc.AddMember(context.Background(), cohortID, "user-1")
+		if err != nil {
+			t.Fatalf("AddMember() error = %v", err)
+		}
+		if override.Changed {
+			t.Error("Changed = true, expected false for an existing member")
+		}
+		if len(repo.overrides) != 1 || len(repo.changes) != 0 {
+			t.Errorf("overrides = %v, changes = %d, expected one override and no changes", repo.overrides, len(repo.changes))
+		}
+	})
+
+	t.Run("unknown cohort", func(t *testing.T) {
+		repo := &overrideRepository{}
+		svc := membership.NewService(repo, cohorts, nil)
+
+		_, err := svc.AddMember(context.Background(), uuid.New(), "user-1")
+		if !errors.Is(err, membership.ErrCohortNotFound) {
+			t.Errorf("AddMember() error = %v, expected ErrCohortNotFound", err)
+		}
+		if len(repo.overrides) != 0 {
+			t.Errorf("overrides = %v, expected none", repo.overrides)
+		}
+	})
+}
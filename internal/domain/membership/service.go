@@ -2,19 +2,70 @@ package membership
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
 )
 
 // MembershipRepository interface for membership storage
 type MembershipRepository interface {
-	GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string) (*StoredMembership, error)
+	GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*StoredMembership, error)
 	GetUserCohorts(ctx context.Context, userID string) ([]uuid.UUID, error)
-	GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int) ([]StoredMember, int64, error)
+	GetSharedCohorts(ctx context.Context, userIDs []string) ([]uuid.UUID, error)
+	GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int, ttl time.Duration, lastActive bool, variant string) ([]StoredMember, int64, error)
 	GetCohortMemberCount(ctx context.Context, cohortID uuid.UUID) (int64, error)
+	WasMemberAt(ctx context.Context, cohortID uuid.UUID, userID string, at time.Time) (bool, error)
+	GetCohortMembersAt(ctx context.Context, cohortID uuid.UUID, at time.Time, limit, offset int) ([]string, int64, error)
+	CountMembersByProperty(ctx context.Context, cohortID uuid.UUID, property string, limit int) ([]PropertyValueCount, error)
+	CountMembersByPropertyRange(ctx context.Context, cohortID uuid.UUID, property string, boundaries []float64) ([]BucketCount, error)
+	GetUsersInAllCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error)
+	GetUsersInNoCohorts(ctx context.Context, cohortIDs, universe []uuid.UUID, limit, offset int) ([]string, int64, error)
+	GetMembersInCohorts(ctx context.Context, cohortIDs []uuid.UUID, intersect bool, limit, offset int) ([]string, int64, error)
+	DeleteUserMemberships(ctx context.Context, userID string, cohortIDs []uuid.UUID) error
+	ForEachCohortMember(ctx context.Context, cohortID uuid.UUID, fn func(userID string) error) error
+	SetOverride(ctx context.Context, cohortID uuid.UUID, userID string, status int8, at time.Time) error
+	ApplyChange(ctx context.Context, change *MembershipChange) error
 }
 
+// MaxSetQueryCohorts is the most cohorts accepted by a single set query
+const MaxSetQueryCohorts = 50
+
+var ErrInvalidCohortSet = errors.New("invalid cohort set")
+
+// MaxSharedCohortUsers is the most users accepted by a shared cohorts query
+const MaxSharedCohortUsers = 100
+
+var ErrInvalidUserSet = errors.New("invalid user set")
+
+// ErrProjectCohortsUnavailable is returned by queries spanning a project's
+// cohorts when no ProjectCohortLister is configured
+var ErrProjectCohortsUnavailable = errors.New("project cohorts are not available")
+
+var (
+	// ErrMembershipNotFound is returned by MembershipRepository.GetByCohortAndUser
+	// when the user isn't a member
+	ErrMembershipNotFound = errors.New("membership not found")
+	// ErrStorageUnavailable is returned by membership checks that couldn't
+	// reach storage under the error fallback policy
+	ErrStorageUnavailable = errors.New("membership storage is unavailable")
+)
+
+// FallbackPolicy is how a membership check answers when storage fails:
+// fail_closed reports the user as not a member, fail_open reports the cached
+// membership or a configured default, and error fails the check
+type FallbackPolicy string
+
+const (
+	FallbackFailClosed FallbackPolicy = "fail_closed"
+	FallbackFailOpen   FallbackPolicy = "fail_open"
+	FallbackError      FallbackPolicy = "error"
+)
+
 // StoredMembership represents membership data from storage
 type StoredMembership struct {
 	CohortID  uuid.UUID
@@ -23,6 +74,7 @@ type StoredMembership struct {
 	JoinedAt  time.Time
 	UpdatedAt time.Time
 	Version   int64
+	Variant   string
 }
 
 // IsMember returns true if the user is currently a member
@@ -32,13 +84,41 @@ func (m *StoredMembership) IsMember() bool {
 
 // StoredMember represents a member from storage
 type StoredMember struct {
-	UserID   string
-	JoinedAt time.Time
+	UserID       string
+	JoinedAt     time.Time
+	Variant      string
+	LastActiveAt *time.Time
 }
 
 // CohortGetter interface for getting cohort details
 type CohortGetter interface {
 	GetCohortName(ctx context.Context, id uuid.UUID) (string, error)
+	GetCohortSummary(ctx context.Context, id uuid.UUID) (*CohortSummary, error)
+}
+
+// ProjectCohortLister lists the IDs of a project's cohorts, archived ones
+// included when includeArchived is set
+type ProjectCohortLister interface {
+	ListProjectCohortIDs(ctx context.Context, projectID uuid.UUID, includeArchived bool) ([]uuid.UUID, error)
+}
+
+// CohortSummary is the cohort context embedded in membership responses
+type CohortSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	Version     int64     `json:"version"`
+}
+
+// MembershipTTLGetter resolves how long members stay in a cohort after joining
+type MembershipTTLGetter interface {
+	GetMembershipTTL(ctx context.Context, cohortID uuid.UUID) (time.Duration, error)
+}
+
+// VariantAssigner assigns a user the experiment variant they join a cohort with
+type VariantAssigner interface {
+	AssignVariant(ctx context.Context, cohortID uuid.UUID, userID string) (string, error)
 }
 
 // MembershipCache interface for caching
@@ -58,13 +138,23 @@ type MembershipCache interface {
 type CachedMembership struct {
 	IsMember bool
 	JoinedAt time.Time
+	Variant  string
 }
 
 // Service handles membership business logic
 type Service struct {
 	membershipRepo MembershipRepository
 	cohortGetter   CohortGetter
+	projectCohorts ProjectCohortLister
 	cache          MembershipCache
+	eventDeleter   UserEventDeleter
+	ttlGetter      MembershipTTLGetter
+	variants       VariantAssigner
+	versions       VersionResolver
+	requireProject bool
+
+	fallback        FallbackPolicy
+	fallbackDefault bool
 }
 
 // NewService creates a new membership service
@@ -73,7 +163,91 @@ func NewService(membershipRepo MembershipRepository, cohortGetter CohortGetter,
 		membershipRepo: membershipRepo,
 		cohortGetter:   cohortGetter,
 		cache:          cache,
+		fallback:       FallbackFailClosed,
+	}
+}
+
+// SetMembershipTTLGetter enables expiring members once a cohort's membership
+// TTL has passed since they joined
+func (s *Service) SetMembershipTTLGetter(getter MembershipTTLGetter) {
+	s.ttlGetter = getter
+}
+
+// SetProjectCohortLister enables queries over all of a project's cohorts,
+// such as none-of set queries
+func (s *Service) SetProjectCohortLister(lister ProjectCohortLister) {
+	s.projectCohorts = lister
+}
+
+// SetVariantAssigner enables assigning experiment variants to users joining
+// cohorts through overrides
+func (s *Service) SetVariantAssigner(assigner VariantAssigner) {
+	s.variants = assigner
+}
+
+// SetFallbackPolicy sets how membership checks answer when storage fails.
+// Under fail_open, users without a cached membership get defaultMember.
+func (s *Service) SetFallbackPolicy(policy FallbackPolicy, defaultMember bool) {
+	s.fallback = policy
+	s.fallbackDefault = defaultMember
+}
+
+// SetRequireProjectScope makes every membership read and write fail with
+// tenant.ErrNoProject unless its context acts for a project, so a handler
+// can't query isolated storage without one
+func (s *Service) SetRequireProjectScope(required bool) {
+	s.requireProject = required
+}
+
+// checkScope enforces the project scope when it's required and checks the
+// cohorts belong to the project the context acts for
+func (s *Service) checkScope(ctx context.Context, cohortIDs ...uuid.UUID) error {
+	if s.requireProject {
+		if _, err := tenant.RequireProject(ctx); err != nil {
+			return err
+		}
+	}
+	return s.checkCohorts(ctx, cohortIDs...)
+}
+
+// checkCohorts verifies every cohort exists and belongs to the project the
+// context acts for, returning ErrCohortNotFound otherwise
+func (s *Service) checkCohorts(ctx context.Context, cohortIDs ...uuid.UUID) error {
+	if s.cohortGetter == nil {
+		return nil
+	}
+	for _, id := range cohortIDs {
+		if _, err := s.cohortGetter.GetCohortName(ctx, id); err != nil {
+			return fmt.Errorf("%w: %s", ErrCohortNotFound, id)
+		}
+	}
+	return nil
+}
+
+// projectCohortIDs returns the IDs of the cohorts of the project the context
+// acts for
+func (s *Service) projectCohortIDs(ctx context.Context, includeArchived bool) ([]uuid.UUID, error) {
+	projectID, err := tenant.RequireProject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.projectCohorts == nil {
+		return nil, ErrProjectCohortsUnavailable
+	}
+	return s.projectCohorts.ListProjectCohortIDs(ctx, projectID, includeArchived)
+}
+
+// membershipTTL returns the cohort's membership lifetime, or zero when members
+// don't expire
+func (s *Service) membershipTTL(ctx context.Context, cohortID uuid.UUID) time.Duration {
+	if s.ttlGetter == nil {
+		return 0
+	}
+	ttl, err := s.ttlGetter.GetMembershipTTL(ctx, cohortID)
+	if err != nil {
+		return 0
 	}
+	return ttl
 }
 
 // CheckMembershipResponse represents the response for membership check
@@ -82,29 +256,40 @@ type CheckMembershipResponse struct {
 	CohortID uuid.UUID  `json:"cohort_id"`
 	IsMember bool       `json:"is_member"`
 	JoinedAt *time.Time `json:"joined_at,omitempty"`
+	// Variant is the member's experiment variant in cohorts with variants
+	Variant string `json:"variant,omitempty"`
+	// At is the point in time checked, when not the present
+	At *time.Time `json:"at,omitempty"`
+	// Cohort is set when the cohort was requested with IncludeCohort
+	Cohort *CohortSummary `json:"cohort,omitempty"`
+	// Fallback is set when storage failed and the answer comes from the
+	// fallback policy
+	Fallback bool `json:"fallback,omitempty"`
 }
 
 // CheckMembership checks if a user is a member of a cohort
 func (s *Service) CheckMembership(ctx context.Context, cohortID uuid.UUID, userID string) (*CheckMembershipResponse, error) {
-	// Check cache first
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	ttl := s.membershipTTL(ctx, cohortID)
+
+	// Check cache first. Members cached from before their TTL passed are
+	// looked up again.
+	var cached *CachedMembership
 	if s.cache != nil {
-		if cached, ok := s.cache.GetMembership(ctx, cohortID, userID); ok {
-			var joinedAt *time.Time
-			if cached.IsMember {
-				joinedAt = &cached.JoinedAt
-			}
-			return &CheckMembershipResponse{
-				UserID:   userID,
-				CohortID: cohortID,
-				IsMember: cached.IsMember,
-				JoinedAt: joinedAt,
-			}, nil
+		var ok bool
+		if cached, ok = s.cache.GetMembership(ctx, cohortID, userID); ok && !(cached.IsMember && expired(cached.JoinedAt, ttl)) {
+			return cachedResponse(cohortID, userID, cached), nil
 		}
 	}
 
 	// Query storage
-	membership, err := s.membershipRepo.GetByCohortAndUser(ctx, cohortID, userID)
+	membership, err := s.membershipRepo.GetByCohortAndUser(ctx, cohortID, userID, ttl)
 	if err != nil {
+		if !errors.Is(err, ErrMembershipNotFound) {
+			return s.fallbackResponse(cohortID, userID, cached)
+		}
 		// No membership found
 		if s.cache != nil {
 			s.cache.SetMembership(ctx, cohortID, userID, &CachedMembership{IsMember: false})
@@ -123,24 +308,99 @@ func (s *Service) CheckMembership(ctx context.Context, cohortID uuid.UUID, userI
 		s.cache.SetMembership(ctx, cohortID, userID, &CachedMembership{
 			IsMember: isMember,
 			JoinedAt: membership.JoinedAt,
+			Variant:  membership.Variant,
 		})
 	}
 
-	var joinedAt *time.Time
+	resp := &CheckMembershipResponse{
+		UserID:   userID,
+		CohortID: cohortID,
+		IsMember: isMember,
+	}
 	if isMember {
-		joinedAt = &membership.JoinedAt
+		resp.JoinedAt = &membership.JoinedAt
+		resp.Variant = membership.Variant
+	}
+	return resp, nil
+}
+
+// cachedResponse answers a membership check from a cached membership
+func cachedResponse(cohortID uuid.UUID, userID string, cached *CachedMembership) *CheckMembershipResponse {
+	resp := &CheckMembershipResponse{
+		UserID:   userID,
+		CohortID: cohortID,
+		IsMember: cached.IsMember,
+	}
+	if cached.IsMember {
+		resp.JoinedAt = &cached.JoinedAt
+		resp.Variant = cached.Variant
+	}
+	return resp
+}
+
+// fallbackResponse answers a membership check that storage failed on. Under
+// fail_open the last known cached membership is used when there is one.
+func (s *Service) fallbackResponse(cohortID uuid.UUID, userID string, cached *CachedMembership) (*CheckMembershipResponse, error) {
+	resp := &CheckMembershipResponse{
+		UserID:   userID,
+		CohortID: cohortID,
+	}
+	switch s.fallback {
+	case FallbackError:
+		return nil, ErrStorageUnavailable
+	case FallbackFailOpen:
+		resp.IsMember = s.fallbackDefault
+		if cached != nil {
+			resp = cachedResponse(cohortID, userID, cached)
+		}
+	}
+	resp.Fallback = true
+	return resp, nil
+}
+
+// CheckMembershipAt checks if a user was a member of a cohort at a point in
+// time, from the nearest membership snapshot and the changelog after it
+func (s *Service) CheckMembershipAt(ctx context.Context, cohortID uuid.UUID, userID string, at time.Time) (*CheckMembershipResponse, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	isMember, err := s.membershipRepo.WasMemberAt(ctx, cohortID, userID, at)
+	if err != nil {
+		return nil, err
 	}
 
 	return &CheckMembershipResponse{
 		UserID:   userID,
 		CohortID: cohortID,
 		IsMember: isMember,
-		JoinedAt: joinedAt,
+		At:       &at,
 	}, nil
 }
 
+// IncludeCohort embeds the summary of the checked cohort in resp, saving
+// clients a second call to render it
+func (s *Service) IncludeCohort(ctx context.Context, resp *CheckMembershipResponse) error {
+	if s.cohortGetter == nil {
+		return nil
+	}
+	summary, err := s.cohortGetter.GetCohortSummary(ctx, resp.CohortID)
+	if err != nil {
+		return ErrCohortNotFound
+	}
+	resp.Cohort = summary
+	return nil
+}
+
+// expired reports whether a member who joined at joinedAt is past ttl
+func expired(joinedAt time.Time, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(joinedAt) >= ttl
+}
+
 // GetUserCohorts returns all cohorts a user belongs to
 func (s *Service) GetUserCohorts(ctx context.Context, userID string) (*UserCohortsResponse, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
 	// Check cache
 	if s.cache != nil {
 		if cohortIDs, ok := s.cache.GetUserCohorts(ctx, userID); ok {
@@ -191,13 +451,79 @@ func (s *Service) GetUserCohorts(ctx context.Context, userID string) (*UserCohor
 	}, nil
 }
 
-// GetCohortMembers returns members of a cohort with pagination
-func (s *Service) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int) (*CohortMembersResponse, error) {
+// GetSharedCohorts returns the cohorts of the context's project every given
+// user belongs to
+func (s *Service) GetSharedCohorts(ctx context.Context, userIDs []string) (*SharedCohortsResponse, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
+	userIDs = dedupeUserIDs(userIDs)
+	if len(userIDs) == 0 {
+		return nil, fmt.Errorf("%w: at least one user ID is required", ErrInvalidUserSet)
+	}
+	if len(userIDs) > MaxSharedCohortUsers {
+		return nil, fmt.Errorf("%w: at most %d user IDs are allowed", ErrInvalidUserSet, MaxSharedCohortUsers)
+	}
+
+	projectCohorts, err := s.projectCohortIDs(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cohortIDs, err := s.membershipRepo.GetSharedCohorts(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	cohortIDs = slices.DeleteFunc(cohortIDs, func(id uuid.UUID) bool {
+		return !slices.Contains(projectCohorts, id)
+	})
+
+	cohorts := make([]CohortMembership, 0, len(cohortIDs))
+	for _, id := range cohortIDs {
+		name := ""
+		if s.cohortGetter != nil {
+			if name, err = s.cohortGetter.GetCohortName(ctx, id); err != nil {
+				return nil, fmt.Errorf("failed to get cohort name: %w", err)
+			}
+		}
+		cohorts = append(cohorts, CohortMembership{
+			CohortID:   id,
+			CohortName: name,
+		})
+	}
+
+	return &SharedCohortsResponse{
+		UserIDs: userIDs,
+		Cohorts: cohorts,
+	}, nil
+}
+
+// dedupeUserIDs drops duplicate and blank user IDs, keeping the first
+// occurrence's position
+func dedupeUserIDs(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || strings.TrimSpace(id) == "" {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
+
+// GetCohortMembers returns members of a cohort with pagination. A non-empty
+// variant returns only the members assigned that experiment variant.
+func (s *Service) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int, lastActive bool, variant string) (*CohortMembersResponse, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 100
 	}
 
-	members, total, err := s.membershipRepo.GetCohortMembers(ctx, cohortID, limit, offset)
+	members, total, err := s.membershipRepo.GetCohortMembers(ctx, cohortID, limit, offset, s.membershipTTL(ctx, cohortID), lastActive, variant)
 	if err != nil {
 		return nil, err
 	}
@@ -205,13 +531,16 @@ func (s *Service) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limi
 	memberList := make([]Member, len(members))
 	for i, m := range members {
 		memberList[i] = Member{
-			UserID:   m.UserID,
-			JoinedAt: m.JoinedAt,
+			UserID:       m.UserID,
+			JoinedAt:     m.JoinedAt,
+			Variant:      m.Variant,
+			LastActiveAt: m.LastActiveAt,
 		}
 	}
 
 	return &CohortMembersResponse{
 		CohortID: cohortID,
+		Variant:  variant,
 		Members:  memberList,
 		Total:    total,
 		Limit:    limit,
@@ -219,6 +548,94 @@ func (s *Service) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limi
 	}, nil
 }
 
+// GetUsersInAllCohorts returns users that are members of every given cohort
+func (s *Service) GetUsersInAllCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) (*CohortSetResponse, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
+	return s.queryCohortSet(ctx, SetOperationAllOf, cohortIDs, limit, offset, s.membershipRepo.GetUsersInAllCohorts)
+}
+
+// GetUsersInNoCohorts returns users that are members of none of the given cohorts.
+// Only users currently in at least one of the project's cohorts are considered.
+func (s *Service) GetUsersInNoCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) (*CohortSetResponse, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
+	return s.queryCohortSet(ctx, SetOperationNoneOf, cohortIDs, limit, offset, func(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error) {
+		universe, err := s.projectCohortIDs(ctx, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s.membershipRepo.GetUsersInNoCohorts(ctx, cohortIDs, universe, limit, offset)
+	})
+}
+
+// GetMembersInCohorts returns the members of the given cohorts, either those
+// in every cohort when intersect is set or those in any of them
+func (s *Service) GetMembersInCohorts(ctx context.Context, cohortIDs []uuid.UUID, intersect bool, limit, offset int) (*CohortSetResponse, error) {
+	if err := s.checkScope(ctx); err != nil {
+		return nil, err
+	}
+
+	op := SetOperationAnyOf
+	if intersect {
+		op = SetOperationAllOf
+	}
+	return s.queryCohortSet(ctx, op, cohortIDs, limit, offset, func(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error) {
+		return s.membershipRepo.GetMembersInCohorts(ctx, cohortIDs, intersect, limit, offset)
+	})
+}
+
+func (s *Service) queryCohortSet(
+	ctx context.Context,
+	op SetOperation,
+	cohortIDs []uuid.UUID,
+	limit, offset int,
+	query func(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error),
+) (*CohortSetResponse, error) {
+	cohortIDs = dedupeCohortIDs(cohortIDs)
+	if len(cohortIDs) == 0 {
+		return nil, fmt.Errorf("%w: at least one cohort ID is required", ErrInvalidCohortSet)
+	}
+	if len(cohortIDs) > MaxSetQueryCohorts {
+		return nil, fmt.Errorf("%w: at most %d cohort IDs are allowed", ErrInvalidCohortSet, MaxSetQueryCohorts)
+	}
+	if err := s.checkCohorts(ctx, cohortIDs...); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	userIDs, total, err := query(ctx, cohortIDs, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CohortSetResponse{
+		Operation: op,
+		CohortIDs: cohortIDs,
+		UserIDs:   userIDs,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}, nil
+}
+
+func dedupeCohortIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
+
 // CohortStats represents statistics for a cohort
 type CohortStats struct {
 	CohortID    uuid.UUID `json:"cohort_id"`
@@ -228,6 +645,9 @@ type CohortStats struct {
 
 // GetCohortStats returns statistics for a cohort
 func (s *Service) GetCohortStats(ctx context.Context, cohortID uuid.UUID) (*CohortStats, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
 	// Check cache
 	if s.cache != nil {
 		if count, ok := s.cache.GetCohortMemberCount(ctx, cohortID); ok {
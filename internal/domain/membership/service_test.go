@@ -0,0 +1,460 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// joinedRepository serves members by join time, leaving out the ones whose
+// TTL has passed the way storage does
+type joinedRepository struct {
+	membership.MembershipRepository
+	joined   map[string]time.Time
+	variants map[string]string
+	ttls     []time.Duration
+}
+
+func (r *joinedRepository) live(userID string, ttl time.Duration) bool {
+	joinedAt, ok := r.joined[userID]
+	return ok && (ttl <= 0 || time.Since(joinedAt) < ttl)
+}
+
+func (r *joinedRepository) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*membership.StoredMembership, error) {
+	r.ttls = append(r.ttls, ttl)
+	if !r.live(userID, ttl) {
+		return nil, membership.ErrMembershipNotFound
+	}
+	return &membership.StoredMembership{CohortID: cohortID, UserID: userID, Status: 1, JoinedAt: r.joined[userID], Variant: r.variants[userID]}, nil
+}
+
+func (r *joinedRepository) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int, ttl time.Duration, lastActive bool, variant string) ([]membership.StoredMember, int64, error) {
+	r.ttls = append(r.ttls, ttl)
+	var members []membership.StoredMember
+	for _, userID := range []string{"fresh", "stale"} {
+		if r.live(userID, ttl) && (variant == "" || r.variants[userID] == variant) {
+			members = append(members, membership.StoredMember{UserID: userID, JoinedAt: r.joined[userID], Variant: r.variants[userID]})
+		}
+	}
+	return members, int64(len(members)), nil
+}
+
+// failingRepository fails every membership lookup the way an unreachable
+// store does
+type failingRepository struct {
+	membership.MembershipRepository
+}
+
+func (r *failingRepository) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*membership.StoredMembership, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+type fixedTTL time.Duration
+
+func (f fixedTTL) GetMembershipTTL(ctx context.Context, cohortID uuid.UUID) (time.Duration, error) {
+	return time.Duration(f), nil
+}
+
+// staticCache serves one cached membership
+type staticCache struct {
+	membership.MembershipCache
+	cached *membership.CachedMembership
+}
+
+func (c *staticCache) GetMembership(ctx context.Context, cohortID uuid.UUID, userID string) (*membership.CachedMembership, bool) {
+	return c.cached, c.cached != nil
+}
+
+func (c *staticCache) SetMembership(ctx context.Context, cohortID uuid.UUID, userID string, m *membership.CachedMembership) error {
+	c.cached = m
+	return nil
+}
+
+func TestService_MembershipTTL(t *testing.T) {
+	cohortID := uuid.New()
+	newRepo := func() *joinedRepository {
+		return &joinedRepository{joined: map[string]time.Time{
+			"fresh": time.Now().Add(-24 * time.Hour),
+			"stale": time.Now().Add(-10 * 24 * time.Hour),
+		}}
+	}
+
+	t.Run("expired members are excluded", func(t *testing.T) {
+		repo := newRepo()
+		svc := membership.NewService(repo, nil, nil)
+		svc.SetMembershipTTLGetter(fixedTTL(7 * 24 * time.Hour))
+
+		for userID, expected := range map[string]bool{"fresh": true, "stale": false} {
+			resp, err := svc.CheckMembership(context.Background(), cohortID, userID)
+			if err != nil {
+				t.Fatalf("CheckMembership() error = %v", err)
+			}
+			if resp.IsMember != expected {
+				t.Errorf("IsMember(%s) = %v, expected %v", userID, resp.IsMember, expected)
+			}
+		}
+
+		resp, err := svc.GetCohortMembers(context.Background(), cohortID, 10, 0, false, "")
+		if err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if len(resp.Members) != 1 || resp.Members[0].UserID != "fresh" || resp.Total != 1 {
+			t.Errorf("members = %+v, expected only fresh", resp.Members)
+		}
+		for _, ttl := range repo.ttls {
+			if ttl != 7*24*time.Hour {
+				t.Errorf("ttl = %v, expected 168h", ttl)
+			}
+		}
+	})
+
+	t.Run("without a TTL nobody expires", func(t *testing.T) {
+		repo := newRepo()
+		svc := membership.NewService(repo, nil, nil)
+
+		resp, err := svc.GetCohortMembers(context.Background(), cohortID, 10, 0, false, "")
+		if err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if resp.Total != 2 {
+			t.Errorf("total = %d, expected 2", resp.Total)
+		}
+		if !reflect.DeepEqual(repo.ttls, []time.Duration{0}) {
+			t.Errorf("ttls = %v, expected [0]", repo.ttls)
+		}
+	})
+
+	t.Run("cached member past the TTL is looked up again", func(t *testing.T) {
+		repo := newRepo()
+		cache := &staticCache{cached: &membership.CachedMembership{IsMember: true, JoinedAt: repo.joined["stale"]}}
+		svc := membership.NewService(repo, nil, cache)
+		svc.SetMembershipTTLGetter(fixedTTL(7 * 24 * time.Hour))
+
+		resp, err := svc.CheckMembership(context.Background(), cohortID, "stale")
+		if err != nil {
+			t.Fatalf("CheckMembership() error = %v", err)
+		}
+		if resp.IsMember {
+			t.Error("IsMember = true, expected the expired cache entry to be ignored")
+		}
+		if len(repo.ttls) != 1 {
+			t.Errorf("storage lookups = %d, expected 1", len(repo.ttls))
+		}
+	})
+}
+
+func TestService_Variants(t *testing.T) {
+	cohortID := uuid.New()
+	repo := &joinedRepository{
+		joined:   map[string]time.Time{"fresh": time.Now().Add(-time.Hour), "stale": time.Now().Add(-time.Hour)},
+		variants: map[string]string{"fresh": "control", "stale": "treatment"},
+	}
+	svc := membership.NewService(repo, nil, nil)
+
+	t.Run("membership check reports the variant", func(t *testing.T) {
+		resp, err := svc.CheckMembership(context.Background(), cohortID, "stale")
+		if err != nil {
+			t.Fatalf("CheckMembership() error = %v", err)
+		}
+		if !resp.IsMember || resp.Variant != "treatment" {
+			t.Errorf("membership = %v in %q, expected member in treatment", resp.IsMember, resp.Variant)
+		}
+	})
+
+	t.Run("members are filtered by variant", func(t *testing.T) {
+		resp, err := svc.GetCohortMembers(context.Background(), cohortID, 10, 0, false, "control")
+		if err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if len(resp.Members) != 1 || resp.Members[0].UserID != "fresh" || resp.Members[0].Variant != "control" {
+			t.Errorf("members = %+v, expected only fresh in control", resp.Members)
+		}
+		if resp.Variant != "control" {
+			t.Errorf("Variant = %q, expected control", resp.Variant)
+		}
+	})
+}
+
+func TestService_IncludeCohort(t *testing.T) {
+	cohortID := uuid.New()
+	cohorts := &namedCohorts{names: map[uuid.UUID]string{cohortID: "Power users"}}
+	repo := &joinedRepository{joined: map[string]time.Time{"user-1": time.Now().Add(-time.Hour)}}
+	svc := membership.NewService(repo, cohorts, nil)
+
+	t.Run("embeds the cohort summary when requested", func(t *testing.T) {
+		resp, err := svc.CheckMembership(context.Background(), cohortID, "user-1")
+		if err != nil {
+			t.Fatalf("CheckMembership() unexpected error: %v", err)
+		}
+		if resp.Cohort != nil {
+			t.Fatalf("Cohort = %+v, expected nil unless requested", resp.Cohort)
+		}
+
+		if err := svc.IncludeCohort(context.Background(), resp); err != nil {
+			t.Fatalf("IncludeCohort() unexpected error: %v", err)
+		}
+		expected := &membership.CohortSummary{ID: cohortID, Name: "Power users", Status: "active", Version: 3}
+		if !reflect.DeepEqual(resp.Cohort, expected) {
+			t.Errorf("Cohort = %+v, expected %+v", resp.Cohort, expected)
+		}
+		if !resp.IsMember {
+			t.Error("IsMember = false, expected the membership to be kept")
+		}
+	})
+
+	t.Run("unknown cohort", func(t *testing.T) {
+		resp := &membership.CheckMembershipResponse{CohortID: uuid.New(), UserID: "user-1"}
+		if err := svc.IncludeCohort(context.Background(), resp); !errors.Is(err, membership.ErrCohortNotFound) {
+			t.Errorf("IncludeCohort() = %v, expected ErrCohortNotFound", err)
+		}
+	})
+}
+
+func TestService_RequireProjectScope(t *testing.T) {
+	repo := &joinedRepository{joined: map[string]time.Time{"fresh": time.Now()}}
+	svc := membership.NewService(repo, nil, nil)
+	svc.SetRequireProjectScope(true)
+	cohortID := uuid.New()
+
+	t.Run("errors without a project in context", func(t *testing.T) {
+		if _, err := svc.CheckMembership(context.Background(), cohortID, "fresh"); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("CheckMembership() error = %v, expected ErrNoProject", err)
+		}
+		if _, err := svc.GetCohortMembers(context.Background(), cohortID, 10, 0, false, ""); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("GetCohortMembers() error = %v, expected ErrNoProject", err)
+		}
+		if len(repo.ttls) != 0 {
+			t.Errorf("repository reads = %d, expected 0", len(repo.ttls))
+		}
+	})
+
+	t.Run("reads with a project in context", func(t *testing.T) {
+		ctx := tenant.WithProject(context.Background(), uuid.New())
+		resp, err := svc.CheckMembership(ctx, cohortID, "fresh")
+		if err != nil {
+			t.Fatalf("CheckMembership() error = %v", err)
+		}
+		if !resp.IsMember {
+			t.Error("IsMember = false, expected true")
+		}
+	})
+}
+
+func TestService_CheckMembership_FallbackPolicy(t *testing.T) {
+	cohortID := uuid.New()
+	joinedAt := time.Now().Add(-10 * 24 * time.Hour)
+
+	tests := []struct {
+		name          string
+		policy        membership.FallbackPolicy
+		defaultMember bool
+		cached        *membership.CachedMembership
+		expected      bool
+		expectedErr   error
+	}{
+		{"fail_closed reports non-membership", membership.FallbackFailClosed, true, nil, false, nil},
+		{"fail_closed ignores the cache", membership.FallbackFailClosed, false, &membership.CachedMembership{IsMember: true, JoinedAt: joinedAt}, false, nil},
+		{"fail_open uses the default", membership.FallbackFailOpen, true, nil, true, nil},
+		{"fail_open prefers the last cached membership", membership.FallbackFailOpen, false, &membership.CachedMembership{IsMember: true, JoinedAt: joinedAt}, true, nil},
+		{"error fails the check", membership.FallbackError, true, nil, false, membership.ErrStorageUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The cached member is past the TTL, so storage is consulted
+			cache := &staticCache{cached: tt.cached}
+			svc := membership.NewService(&failingRepository{}, nil, cache)
+			svc.SetMembershipTTLGetter(fixedTTL(7 * 24 * time.Hour))
+			svc.SetFallbackPolicy(tt.policy, tt.defaultMember)
+
+			resp, err := svc.CheckMembership(context.Background(), cohortID, "user-1")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("CheckMembership() error = %v, expected %v", err, tt.expectedErr)
+			}
+			if tt.expectedErr != nil {
+				return
+			}
+			if resp.IsMember != tt.expected {
+				t.Errorf("IsMember = %v, expected %v", resp.IsMember, tt.expected)
+			}
+			if !resp.Fallback {
+				t.Error("Fallback = false, expected true")
+			}
+			if cache.cached != tt.cached {
+				t.Errorf("cached = %+v, expected the failed lookup not to be cached", cache.cached)
+			}
+		})
+	}
+
+	t.Run("missing membership is not a failure", func(t *testing.T) {
+		repo := &joinedRepository{joined: map[string]time.Time{}}
+		svc := membership.NewService(repo, nil, nil)
+		svc.SetFallbackPolicy(membership.FallbackError, true)
+
+		resp, err := svc.CheckMembership(context.Background(), cohortID, "user-1")
+		if err != nil {
+			t.Fatalf("CheckMembership() error = %v", err)
+		}
+		if resp.IsMember || resp.Fallback {
+			t.Errorf("response = %+v, expected a non-member without fallback", resp)
+		}
+	})
+}
+
+// setRepository records the cohorts set queries are run over
+type setRepository struct {
+	membership.MembershipRepository
+	cohortIDs []uuid.UUID
+	universe  []uuid.UUID
+}
+
+func (r *setRepository) GetUsersInAllCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	r.cohortIDs = cohortIDs
+	return []string{"user-1"}, 1, nil
+}
+
+func (r *setRepository) GetUsersInNoCohorts(ctx context.Context, cohortIDs, universe []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	r.cohortIDs, r.universe = cohortIDs, universe
+	return []string{"user-2"}, 1, nil
+}
+
+func (r *setRepository) GetSharedCohorts(ctx context.Context, userIDs []string) ([]uuid.UUID, error) {
+	return r.universe, nil
+}
+
+// projectCohorts lists fixed cohort IDs per project
+type projectCohorts map[uuid.UUID][]uuid.UUID
+
+func (p projectCohorts) ListProjectCohortIDs(ctx context.Context, projectID uuid.UUID, includeArchived bool) ([]uuid.UUID, error) {
+	return p[projectID], nil
+}
+
+func TestService_CohortSetProjectScope(t *testing.T) {
+	projectID := uuid.New()
+	own, other := uuid.New(), uuid.New()
+	// The cohort getter resolves cohorts of the context's project only
+	cohorts := &namedCohorts{names: map[uuid.UUID]string{own: "vip"}}
+	ctx := tenant.WithProject(context.Background(), projectID)
+
+	t.Run("none-of considers only the project's cohorts", func(t *testing.T) {
+		repo := &setRepository{}
+		svc := membership.NewService(repo, cohorts, nil)
+		svc.SetProjectCohortLister(projectCohorts{projectID: {own, uuid.New()}})
+
+		if _, err := svc.GetUsersInNoCohorts(ctx, []uuid.UUID{own}, 10, 0); err != nil {
+			t.Fatalf("GetUsersInNoCohorts() error = %v", err)
+		}
+		if len(repo.universe) != 2 || repo.universe[0] != own {
+			t.Errorf("universe = %v, expected the project's cohorts", repo.universe)
+		}
+	})
+
+	t.Run("none-of without a project lister", func(t *testing.T) {
+		svc := membership.NewService(&setRepository{}, cohorts, nil)
+		if _, err := svc.GetUsersInNoCohorts(ctx, []uuid.UUID{own}, 10, 0); !errors.Is(err, membership.ErrProjectCohortsUnavailable) {
+			t.Errorf("GetUsersInNoCohorts() error = %v, expected ErrProjectCohortsUnavailable", err)
+		}
+	})
+
+	t.Run("shared cohorts leave out other projects' cohorts", func(t *testing.T) {
+		// Users may share cohorts of several projects in storage
+		repo := &setRepository{universe: []uuid.UUID{other, own}}
+		svc := membership.NewService(repo, cohorts, nil)
+		svc.SetProjectCohortLister(projectCohorts{projectID: {own}})
+
+		resp, err := svc.GetSharedCohorts(ctx, []string{"user-1", "user-2"})
+		if err != nil {
+			t.Fatalf("GetSharedCohorts() error = %v", err)
+		}
+		if len(resp.Cohorts) != 1 || resp.Cohorts[0].CohortID != own || resp.Cohorts[0].CohortName != "vip" {
+			t.Errorf("cohorts = %+v, expected only the project's cohort", resp.Cohorts)
+		}
+
+		if _, err := svc.GetSharedCohorts(context.Background(), []string{"user-1"}); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("GetSharedCohorts() error = %v without a project, expected ErrNoProject", err)
+		}
+	})
+
+	t.Run("cohorts of other projects are rejected", func(t *testing.T) {
+		repo := &setRepository{}
+		svc := membership.NewService(repo, cohorts, nil)
+		svc.SetProjectCohortLister(projectCohorts{projectID: {own}})
+
+		if _, err := svc.GetUsersInAllCohorts(ctx, []uuid.UUID{own, other}, 10, 0); !errors.Is(err, membership.ErrCohortNotFound) {
+			t.Errorf("GetUsersInAllCohorts() error = %v, expected ErrCohortNotFound", err)
+		}
+		if _, err := svc.GetUsersInNoCohorts(ctx, []uuid.UUID{other}, 10, 0); !errors.Is(err, membership.ErrCohortNotFound) {
+			t.Errorf("GetUsersInNoCohorts() error = %v, expected ErrCohortNotFound", err)
+		}
+		if repo.cohortIDs != nil {
+			t.Errorf("queried cohorts %v, expected no query", repo.cohortIDs)
+		}
+	})
+}
+
+func TestService_CohortScope(t *testing.T) {
+	own, foreign := uuid.New(), uuid.New()
+	ctx := tenant.WithProject(context.Background(), uuid.New())
+
+	// The embedded nil repository panics if a foreign cohort is queried
+	svc := membership.NewService(&setRepository{}, &namedCohorts{names: map[uuid.UUID]string{own: "buyers"}}, nil)
+	svc.SetRequireProjectScope(true)
+
+	calls := map[string]func() error{
+		"check": func() error {
+			_, err := svc.CheckMembership(ctx, foreign, "user-1")
+			return err
+		},
+		"check at": func() error {
+			_, err := svc.CheckMembershipAt(ctx, foreign, "user-1", time.Now())
+			return err
+		},
+		"members": func() error {
+			_, err := svc.GetCohortMembers(ctx, foreign, 10, 0, false, "")
+			return err
+		},
+		"stats": func() error {
+			_, err := svc.GetCohortStats(ctx, foreign)
+			return err
+		},
+		"bitmap": func() error {
+			_, err := svc.GetCohortMembersBitmap(ctx, foreign, membership.IDMappingHash)
+			return err
+		},
+		"count by property": func() error {
+			_, err := svc.CountMembersByProperty(ctx, foreign, "country", 10)
+			return err
+		},
+		"count by range": func() error {
+			_, err := svc.CountMembersByPropertyRange(ctx, foreign, "ltv", []float64{0, 100})
+			return err
+		},
+		"combined any of": func() error {
+			_, err := svc.GetMembersInCohorts(ctx, []uuid.UUID{own, foreign}, false, 10, 0)
+			return err
+		},
+		"combined all of": func() error {
+			_, err := svc.GetMembersInCohorts(ctx, []uuid.UUID{own, foreign}, true, 10, 0)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name+" rejects another project's cohort", func(t *testing.T) {
+			if err := call(); !errors.Is(err, membership.ErrCohortNotFound) {
+				t.Errorf("error = %v, expected ErrCohortNotFound", err)
+			}
+		})
+	}
+
+	t.Run("none-of requires a project", func(t *testing.T) {
+		if _, err := svc.GetUsersInNoCohorts(context.Background(), []uuid.UUID{foreign}, 10, 0); !errors.Is(err, tenant.ErrNoProject) {
+			t.Errorf("GetUsersInNoCohorts() error = %v, expected ErrNoProject", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package membership
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SnapshotWriter copies current membership into dated snapshots
+type SnapshotWriter interface {
+	SnapshotMembership(ctx context.Context, at time.Time) error
+}
+
+// Snapshotter snapshots membership on a fixed cadence so point-in-time
+// lookups replay only the changelog since the nearest snapshot
+type Snapshotter struct {
+	writer   SnapshotWriter
+	interval time.Duration
+}
+
+// NewSnapshotter creates a snapshotter taking a snapshot every interval
+func NewSnapshotter(writer SnapshotWriter, interval time.Duration) *Snapshotter {
+	return &Snapshotter{writer: writer, interval: interval}
+}
+
+// Start takes snapshots every interval until ctx is canceled
+func (s *Snapshotter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.writer.SnapshotMembership(ctx, time.Now().UTC()); err != nil {
+					log.Printf("membership snapshotter: snapshot failed: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrVersionNotRecomputed is returned by VersionResolver when no
+	// recompute of the cohort version completed
+	ErrVersionNotRecomputed = errors.New("cohort version was never recomputed")
+	// ErrVersionHistoryUnavailable is returned by version lookups when no
+	// VersionResolver is set
+	ErrVersionHistoryUnavailable = errors.New("cohort version history is unavailable")
+)
+
+// VersionResolver finds when a cohort version's membership was computed
+type VersionResolver interface {
+	VersionRecomputedAt(ctx context.Context, cohortID uuid.UUID, version int64) (time.Time, error)
+}
+
+// VersionMembersResponse is a cohort's membership as of a cohort version
+type VersionMembersResponse struct {
+	CohortID uuid.UUID `json:"cohort_id"`
+	Version  int64     `json:"version"`
+	// At is when the version's latest completed recompute finished, the
+	// point membership is read at
+	At      time.Time `json:"at"`
+	UserIDs []string  `json:"user_ids"`
+	Total   int64     `json:"total"`
+	Limit   int       `json:"limit"`
+	Offset  int       `json:"offset"`
+}
+
+// SetVersionResolver enables looking up membership as of a cohort version
+func (s *Service) SetVersionResolver(resolver VersionResolver) {
+	s.versions = resolver
+}
+
+// GetCohortMembersAtVersion returns a page of a cohort's members, and their
+// count, as of the latest completed recompute of a cohort version. Membership
+// is rebuilt from the nearest snapshot before the recompute and the changelog
+// after it, so it reflects overrides and event-driven changes up to then too.
+func (s *Service) GetCohortMembersAtVersion(ctx context.Context, cohortID uuid.UUID, version int64, limit, offset int) (*VersionMembersResponse, error) {
+	if err := s.checkScope(ctx, cohortID); err != nil {
+		return nil, err
+	}
+	if s.versions == nil {
+		return nil, ErrVersionHistoryUnavailable
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	at, err := s.versions.VersionRecomputedAt(ctx, cohortID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs, total, err := s.membershipRepo.GetCohortMembersAt(ctx, cohortID, at, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VersionMembersResponse{
+		CohortID: cohortID,
+		Version:  version,
+		At:       at,
+		UserIDs:  userIDs,
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package membership_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+// versionHistory resolves versions from a fixed map of recompute times
+type versionHistory map[int64]time.Time
+
+func (h versionHistory) VersionRecomputedAt(ctx context.Context, cohortID uuid.UUID, version int64) (time.Time, error) {
+	at, ok := h[version]
+	if !ok {
+		return time.Time{}, membership.ErrVersionNotRecomputed
+	}
+	return at, nil
+}
+
+// pointInTimeRepository serves the roster at each recompute time
+type pointInTimeRepository struct {
+	membership.MembershipRepository
+	rosters map[time.Time][]string
+	readAt  time.Time
+}
+
+func (r *pointInTimeRepository) GetCohortMembersAt(ctx context.Context, cohortID uuid.UUID, at time.Time, limit, offset int) ([]string, int64, error) {
+	r.readAt = at
+	roster := r.rosters[at]
+	return roster, int64(len(roster)), nil
+}
+
+func TestService_GetCohortMembersAtVersion(t *testing.T) {
+	v1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	v2 := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	repo := &pointInTimeRepository{rosters: map[time.Time][]string{
+		v1: {"user-1"},
+		v2: {"user-1", "user-2"},
+	}}
+	svc := membership.NewService(repo, nil, nil)
+	cohortID := uuid.New()
+
+	if _, err := svc.GetCohortMembersAtVersion(context.Background(), cohortID, 1, 10, 0); !errors.Is(err, membership.ErrVersionHistoryUnavailable) {
+		t.Errorf("GetCohortMembersAtVersion() error = %v, expected %v without a resolver", err, membership.ErrVersionHistoryUnavailable)
+	}
+
+	svc.SetVersionResolver(versionHistory{1: v1, 2: v2})
+
+	resp, err := svc.GetCohortMembersAtVersion(context.Background(), cohortID, 1, 10, 0)
+	if err != nil {
+		t.Fatalf("GetCohortMembersAtVersion() error = %v", err)
+	}
+	if !repo.readAt.Equal(v1) || !resp.At.Equal(v1) {
+		t.Errorf("read at %v (reported %v), expected version 1's recompute at %v", repo.readAt, resp.At, v1)
+	}
+	if resp.Version != 1 || resp.Total != 1 || len(resp.UserIDs) != 1 || resp.UserIDs[0] != "user-1" {
+		t.Errorf("response = %+v, expected version 1's single member", resp)
+	}
+
+	resp, err = svc.GetCohortMembersAtVersion(context.Background(), cohortID, 2, 10, 0)
+	if err != nil {
+		t.Fatalf("GetCohortMembersAtVersion() error = %v", err)
+	}
+	if !repo.readAt.Equal(v2) || resp.Total != 2 {
+		t.Errorf("read at %v with total %d, expected version 2's recompute at %v with 2 members", repo.readAt, resp.Total, v2)
+	}
+
+	if _, err := svc.GetCohortMembersAtVersion(context.Background(), cohortID, 3, 10, 0); !errors.Is(err, membership.ErrVersionNotRecomputed) {
+		t.Errorf("GetCohortMembersAtVersion() error = %v, expected %v", err, membership.ErrVersionNotRecomputed)
+	}
+}
@@ -13,8 +13,15 @@ type Project struct {
 	Name           string    `json:"name"`
 	Slug           string    `json:"slug"`
 	Description    string    `json:"description,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	// EventRetentionDays is how many days the project's events are kept,
+	// the service default unless the project sets its own
+	EventRetentionDays int       `json:"event_retention_days"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+
+	// retentionOverride is the project's own retention in days, 0 if it
+	// uses the default
+	retentionOverride int
 }
 
 // NewProject creates a new project with the given organization ID, name, and slug
@@ -51,4 +58,7 @@ type UpdateProjectRequest struct {
 	Name        string `json:"name"`
 	Slug        string `json:"slug"`
 	Description string `json:"description"`
+	// EventRetentionDays sets the project's own event retention; 0 restores
+	// the default and omitting it keeps the current setting
+	EventRetentionDays *int `json:"event_retention_days"`
 }
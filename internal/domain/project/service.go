@@ -3,6 +3,8 @@ package project
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -12,20 +14,59 @@ import (
 var (
 	ErrProjectNotFound   = errors.New("project not found")
 	ErrSlugAlreadyExists = errors.New("project slug already exists in this organization")
+	ErrInvalidRetention  = errors.New("invalid event retention")
 )
 
+// DefaultEventRetentionDays matches the TTL events_raw is created with
+const DefaultEventRetentionDays = 365
+
+// maxEventRetentionDays bounds a project's event retention to ten years
+const maxEventRetentionDays = 3650
+
+// Provisioner sets up the storage a new project needs
+type Provisioner interface {
+	ProvisionProject(ctx context.Context, projectID uuid.UUID) error
+}
+
+// RetentionEnforcer applies a project's event retention to its stored events
+type RetentionEnforcer interface {
+	ApplyEventRetention(ctx context.Context, projectID uuid.UUID, days int) error
+}
+
 // Service handles project business logic
 type Service struct {
-	queries db.Querier
+	queries     db.Querier
+	provisioner Provisioner
+	retention   RetentionEnforcer
+
+	defaultRetentionDays int
 }
 
 // NewService creates a new project service
 func NewService(queries db.Querier) *Service {
 	return &Service{
-		queries: queries,
+		queries:              queries,
+		defaultRetentionDays: DefaultEventRetentionDays,
 	}
 }
 
+// SetDefaultEventRetention sets the event retention of projects that don't
+// set their own
+func (s *Service) SetDefaultEventRetention(days int) {
+	s.defaultRetentionDays = days
+}
+
+// SetRetentionEnforcer sets the enforcer a project's event retention is
+// applied with when it changes
+func (s *Service) SetRetentionEnforcer(enforcer RetentionEnforcer) {
+	s.retention = enforcer
+}
+
+// SetProvisioner sets the provisioner run for each project created
+func (s *Service) SetProvisioner(provisioner Provisioner) {
+	s.provisioner = provisioner
+}
+
 // Create creates a new project within an organization
 func (s *Service) Create(ctx context.Context, organizationID uuid.UUID, req CreateProjectRequest) (*Project, error) {
 	pgOrgID := pgtype.UUID{Bytes: organizationID, Valid: true}
@@ -39,7 +80,14 @@ func (s *Service) Create(ctx context.Context, organizationID uuid.UUID, req Crea
 		return nil, err
 	}
 
-	return dbProjectToDomain(dbProject), nil
+	project := s.dbProjectToDomain(dbProject)
+	if s.provisioner != nil {
+		if err := s.provisioner.ProvisionProject(ctx, project.ID); err != nil {
+			return nil, fmt.Errorf("failed to provision project storage: %w", err)
+		}
+	}
+
+	return project, nil
 }
 
 // GetByID retrieves a project by ID
@@ -50,7 +98,7 @@ func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (*Project, error) {
 		return nil, ErrProjectNotFound
 	}
 
-	return dbProjectToDomain(dbProject), nil
+	return s.dbProjectToDomain(dbProject), nil
 }
 
 // GetBySlug retrieves a project by organization ID and slug
@@ -64,7 +112,7 @@ func (s *Service) GetBySlug(ctx context.Context, organizationID uuid.UUID, slug
 		return nil, ErrProjectNotFound
 	}
 
-	return dbProjectToDomain(dbProject), nil
+	return s.dbProjectToDomain(dbProject), nil
 }
 
 // List retrieves projects for an organization with pagination
@@ -81,7 +129,7 @@ func (s *Service) List(ctx context.Context, organizationID uuid.UUID, limit, off
 
 	projects := make([]*Project, len(dbProjects))
 	for i, p := range dbProjects {
-		projects[i] = dbProjectToDomain(p)
+		projects[i] = s.dbProjectToDomain(p)
 	}
 
 	return projects, nil
@@ -109,18 +157,43 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateProjectReq
 		description = req.Description
 	}
 
+	retention := existing.retentionOverride
+	if req.EventRetentionDays != nil {
+		retention = *req.EventRetentionDays
+		if retention < 0 || retention > maxEventRetentionDays {
+			return nil, fmt.Errorf("%w: must be between 0 and %d days, got %d", ErrInvalidRetention, maxEventRetentionDays, retention)
+		}
+	}
+
 	pgID := pgtype.UUID{Bytes: id, Valid: true}
 	dbProject, err := s.queries.UpdateProject(ctx, db.UpdateProjectParams{
-		ID:          pgID,
-		Name:        name,
-		Slug:        slug,
-		Description: pgtype.Text{String: description, Valid: description != ""},
+		ID:                 pgID,
+		Name:               name,
+		Slug:               slug,
+		Description:        pgtype.Text{String: description, Valid: description != ""},
+		EventRetentionDays: pgtype.Int4{Int32: int32(retention), Valid: retention > 0},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return dbProjectToDomain(dbProject), nil
+	project := s.dbProjectToDomain(dbProject)
+	if s.retention != nil && project.EventRetentionDays != existing.EventRetentionDays {
+		if err := s.retention.ApplyEventRetention(ctx, project.ID, project.EventRetentionDays); err != nil {
+			return nil, fmt.Errorf("failed to apply event retention: %w", err)
+		}
+	}
+
+	return project, nil
+}
+
+// EventRetention returns how long a project's events are kept
+func (s *Service) EventRetention(ctx context.Context, projectID uuid.UUID) (time.Duration, error) {
+	project, err := s.GetByID(ctx, projectID)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(project.EventRetentionDays) * 24 * time.Hour, nil
 }
 
 // Delete deletes a project
@@ -139,14 +212,20 @@ func (s *Service) Count(ctx context.Context, organizationID uuid.UUID) (int64, e
 	return s.queries.CountProjects(ctx, pgOrgID)
 }
 
-func dbProjectToDomain(p db.Project) *Project {
-	return &Project{
-		ID:             uuid.UUID(p.ID.Bytes),
-		OrganizationID: uuid.UUID(p.OrganizationID.Bytes),
-		Name:           p.Name,
-		Slug:           p.Slug,
-		Description:    p.Description.String,
-		CreatedAt:      p.CreatedAt.Time,
-		UpdatedAt:      p.UpdatedAt.Time,
+func (s *Service) dbProjectToDomain(p db.Project) *Project {
+	project := &Project{
+		ID:                 uuid.UUID(p.ID.Bytes),
+		OrganizationID:     uuid.UUID(p.OrganizationID.Bytes),
+		Name:               p.Name,
+		Slug:               p.Slug,
+		Description:        p.Description.String,
+		EventRetentionDays: s.defaultRetentionDays,
+		CreatedAt:          p.CreatedAt.Time,
+		UpdatedAt:          p.UpdatedAt.Time,
+	}
+	if p.EventRetentionDays.Valid {
+		project.retentionOverride = int(p.EventRetentionDays.Int32)
+		project.EventRetentionDays = project.retentionOverride
 	}
+	return project
 }
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMarker prefixes compressed values. JSON never starts with this byte, so
+// values written before compression was enabled still decode as plain JSON.
+const gzipMarker byte = 0x1f
+
+// encodeValue gzips data when it's at least threshold bytes, prefixing the
+// marker byte; a threshold of 0 stores every value uncompressed
+func encodeValue(data []byte, threshold int) ([]byte, error) {
+	if threshold <= 0 || len(data) < threshold {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(gzipMarker)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeValue reverses encodeValue, returning uncompressed values unchanged
+func decodeValue(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != gzipMarker {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEncodeValue_RoundTrip(t *testing.T) {
+	cohortIDs := make([]uuid.UUID, 500)
+	for i := range cohortIDs {
+		cohortIDs[i] = uuid.New()
+	}
+	data, err := json.Marshal(cohortIDs)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %v", err)
+	}
+
+	t.Run("compressed above threshold", func(t *testing.T) {
+		encoded, err := encodeValue(data, 1024)
+		if err != nil {
+			t.Fatalf("encodeValue() returned error: %v", err)
+		}
+		if encoded[0] != gzipMarker {
+			t.Fatalf("encoded[0] = %#x, expected the gzip marker", encoded[0])
+		}
+		if len(encoded) >= len(data) {
+			t.Errorf("len(encoded) = %d, expected less than %d", len(encoded), len(data))
+		}
+
+		decoded, err := decodeValue(encoded)
+		if err != nil {
+			t.Fatalf("decodeValue() returned error: %v", err)
+		}
+		var got []uuid.UUID
+		if err := json.Unmarshal(decoded, &got); err != nil {
+			t.Fatalf("json.Unmarshal() returned error: %v", err)
+		}
+		if !reflect.DeepEqual(got, cohortIDs) {
+			t.Error("decoded cohort IDs differ from the originals")
+		}
+	})
+
+	t.Run("uncompressed below threshold or disabled", func(t *testing.T) {
+		for _, threshold := range []int{0, len(data) + 1} {
+			encoded, err := encodeValue(data, threshold)
+			if err != nil {
+				t.Fatalf("encodeValue() returned error: %v", err)
+			}
+			if !bytes.Equal(encoded, data) {
+				t.Errorf("threshold %d: encoded value was changed", threshold)
+			}
+			decoded, err := decodeValue(encoded)
+			if err != nil || !bytes.Equal(decoded, data) {
+				t.Errorf("threshold %d: decodeValue() = %v, expected the plain JSON", threshold, err)
+			}
+		}
+	})
+}
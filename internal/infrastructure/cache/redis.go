@@ -46,6 +46,8 @@ func (r *RedisClient) Close() error {
 // MembershipCache handles caching of cohort membership
 type MembershipCache struct {
 	client *RedisClient
+	// compressThreshold is the smallest user cohorts value gzipped; 0 disables compression
+	compressThreshold int
 }
 
 // NewMembershipCache creates a new membership cache
@@ -53,6 +55,12 @@ func NewMembershipCache(client *RedisClient) *MembershipCache {
 	return &MembershipCache{client: client}
 }
 
+// SetCompressionThreshold gzips user cohort lists of at least threshold bytes
+// of JSON; 0 disables compression
+func (c *MembershipCache) SetCompressionThreshold(threshold int) {
+	c.compressThreshold = threshold
+}
+
 func membershipKey(cohortID uuid.UUID, userID string) string {
 	return fmt.Sprintf("membership:%s:%s", cohortID.String(), userID)
 }
@@ -69,6 +77,7 @@ func cohortMembersKey(cohortID uuid.UUID) string {
 type CachedMembership struct {
 	IsMember bool      `json:"is_member"`
 	JoinedAt time.Time `json:"joined_at,omitempty"`
+	Variant  string    `json:"variant,omitempty"`
 }
 
 // GetMembership retrieves cached membership status
@@ -107,13 +116,18 @@ func (c *MembershipCache) InvalidateMembership(ctx context.Context, cohortID uui
 // GetUserCohorts retrieves cached cohort IDs for a user
 func (c *MembershipCache) GetUserCohorts(ctx context.Context, userID string) ([]uuid.UUID, bool) {
 	key := userCohortsKey(userID)
-	val, err := c.client.client.Get(ctx, key).Result()
+	val, err := c.client.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := decodeValue(val)
 	if err != nil {
 		return nil, false
 	}
 
 	var cohortIDs []uuid.UUID
-	if err := json.Unmarshal([]byte(val), &cohortIDs); err != nil {
+	if err := json.Unmarshal(data, &cohortIDs); err != nil {
 		return nil, false
 	}
 
@@ -123,7 +137,12 @@ func (c *MembershipCache) GetUserCohorts(ctx context.Context, userID string) ([]
 // SetUserCohorts caches cohort IDs for a user
 func (c *MembershipCache) SetUserCohorts(ctx context.Context, userID string, cohortIDs []uuid.UUID) error {
 	key := userCohortsKey(userID)
-	val, err := json.Marshal(cohortIDs)
+	data, err := json.Marshal(cohortIDs)
+	if err != nil {
+		return err
+	}
+
+	val, err := encodeValue(data, c.compressThreshold)
 	if err != nil {
 		return err
 	}
@@ -2,23 +2,55 @@ package clickhouse
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 	"github.com/pjhul/intent/internal/config"
 )
 
 // Client wraps the ClickHouse connection
 type Client struct {
 	conn driver.Conn
+
+	mu           sync.Mutex
+	isolated     bool
+	connect      ProjectConnector
+	projectConns map[uuid.UUID]driver.Conn
+
+	slowQueryThreshold time.Duration
 }
 
 // NewClient creates a new ClickHouse client
 func NewClient(cfg config.ClickHouseConfig) (*Client, error) {
-	conn, err := clickhouse.Open(&clickhouse.Options{
-		Addr: []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
+	opts, err := NewOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return open(opts)
+}
+
+// NewClientForMigrations creates a ClickHouse client without database for running migrations
+func NewClientForMigrations(cfg config.ClickHouseConfig) (*Client, error) {
+	opts, err := NewOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts.Auth.Database = ""
+	return open(opts)
+}
+
+// NewOptions builds the connection options for the configured protocol and TLS settings
+func NewOptions(cfg config.ClickHouseConfig) (*clickhouse.Options, error) {
+	opts := &clickhouse.Options{
+		Addr:     []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
+		Protocol: clickhouse.Native,
 		Auth: clickhouse.Auth{
 			Database: cfg.Database,
 			Username: cfg.User,
@@ -31,34 +63,39 @@ func NewClient(cfg config.ClickHouseConfig) (*Client, error) {
 		MaxOpenConns:    cfg.MaxOpenConns,
 		MaxIdleConns:    cfg.MaxIdleConns,
 		ConnMaxLifetime: time.Hour,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to ClickHouse: %w", err)
+	}
+	if cfg.Protocol == config.ClickHouseHTTP || cfg.Protocol == config.ClickHouseHTTPS {
+		opts.Protocol = clickhouse.HTTP
 	}
 
-	if err := conn.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to ping ClickHouse: %w", err)
+	if cfg.UseTLS() {
+		tlsConfig := &tls.Config{
+			ServerName:         cfg.TLSServerName,
+			InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		}
+		if cfg.TLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ClickHouse CA file: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in ClickHouse CA file %s", cfg.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		opts.TLS = tlsConfig
 	}
 
-	return &Client{conn: conn}, nil
+	return opts, nil
 }
 
-// NewClientForMigrations creates a ClickHouse client without database for running migrations
-func NewClientForMigrations(cfg config.ClickHouseConfig) (*Client, error) {
-	conn, err := clickhouse.Open(&clickhouse.Options{
-		Addr: []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
-		Auth: clickhouse.Auth{
-			Username: cfg.User,
-			Password: cfg.Password,
-		},
-		Settings: clickhouse.Settings{
-			"max_execution_time": 60,
-		},
-		DialTimeout:     cfg.DialTimeout,
-		MaxOpenConns:    cfg.MaxOpenConns,
-		MaxIdleConns:    cfg.MaxIdleConns,
-		ConnMaxLifetime: time.Hour,
-	})
+// open connects with the options and verifies the connection
+func open(opts *clickhouse.Options) (*Client, error) {
+	conn, err := clickhouse.Open(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to ClickHouse: %w", err)
 	}
@@ -67,35 +104,70 @@ func NewClientForMigrations(cfg config.ClickHouseConfig) (*Client, error) {
 		return nil, fmt.Errorf("failed to ping ClickHouse: %w", err)
 	}
 
-	return &Client{conn: conn}, nil
+	client := NewClientWithConn(conn)
+	client.connect = func(database string) (driver.Conn, error) {
+		projectOpts := *opts
+		projectOpts.Auth.Database = database
+		return clickhouse.Open(&projectOpts)
+	}
+	return client, nil
 }
 
-// Conn returns the underlying connection
+// NewClientWithConn creates a client around an existing connection
+func NewClientWithConn(conn driver.Conn) *Client {
+	return &Client{conn: conn, projectConns: make(map[uuid.UUID]driver.Conn)}
+}
+
+// Conn returns the underlying connection to the shared database
 func (c *Client) Conn() driver.Conn {
 	return c.conn
 }
 
-// Close closes the connection
+// Close closes the connection and any project database connections
 func (c *Client) Close() error {
+	c.mu.Lock()
+	for projectID, conn := range c.projectConns {
+		conn.Close()
+		delete(c.projectConns, projectID)
+	}
+	c.mu.Unlock()
 	return c.conn.Close()
 }
 
 // Exec executes a query without returning rows
 func (c *Client) Exec(ctx context.Context, query string, args ...any) error {
-	return c.conn.Exec(ctx, query, args...)
+	conn, err := c.connFor(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Exec(ctx, query, args...)
 }
 
 // Query executes a query and returns rows
 func (c *Client) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
-	return c.conn.Query(ctx, query, args...)
+	conn, err := c.connFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.logIfSlow(ctx, query, time.Now())
+	return conn.Query(ctx, query, args...)
 }
 
 // QueryRow executes a query and returns a single row
 func (c *Client) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
-	return c.conn.QueryRow(ctx, query, args...)
+	conn, err := c.connFor(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	defer c.logIfSlow(ctx, query, time.Now())
+	return conn.QueryRow(ctx, query, args...)
 }
 
 // PrepareBatch prepares a batch for inserting
 func (c *Client) PrepareBatch(ctx context.Context, query string) (driver.Batch, error) {
-	return c.conn.PrepareBatch(ctx, query)
+	conn, err := c.connFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.PrepareBatch(ctx, query)
 }
@@ -0,0 +1,111 @@
+package clickhouse_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	chgo "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+)
+
+func TestNewOptions(t *testing.T) {
+	base := config.ClickHouseConfig{
+		Host:     "clickhouse",
+		Port:     9000,
+		Database: "cohort",
+		Protocol: config.ClickHouseNative,
+	}
+
+	t.Run("native without TLS by default", func(t *testing.T) {
+		opts, err := clickhouse.NewOptions(base)
+		if err != nil {
+			t.Fatalf("NewOptions() error = %v", err)
+		}
+		if opts.Protocol != chgo.Native {
+			t.Errorf("Protocol = %v, expected native", opts.Protocol)
+		}
+		if opts.TLS != nil {
+			t.Errorf("TLS = %+v, expected nil", opts.TLS)
+		}
+		if opts.Addr[0] != "clickhouse:9000" {
+			t.Errorf("Addr = %v, expected clickhouse:9000", opts.Addr)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		cfg := base
+		cfg.Protocol = config.ClickHouseHTTP
+		cfg.Port = 8123
+
+		opts, err := clickhouse.NewOptions(cfg)
+		if err != nil {
+			t.Fatalf("NewOptions() error = %v", err)
+		}
+		if opts.Protocol != chgo.HTTP {
+			t.Errorf("Protocol = %v, expected http", opts.Protocol)
+		}
+		if opts.TLS != nil {
+			t.Errorf("TLS = %+v, expected nil", opts.TLS)
+		}
+	})
+
+	t.Run("https uses TLS with the configured options", func(t *testing.T) {
+		cfg := base
+		cfg.Protocol = config.ClickHouseHTTPS
+		cfg.TLSServerName = "ch.internal"
+		cfg.TLSInsecureSkipVerify = true
+
+		opts, err := clickhouse.NewOptions(cfg)
+		if err != nil {
+			t.Fatalf("NewOptions() error = %v", err)
+		}
+		if opts.Protocol != chgo.HTTP {
+			t.Errorf("Protocol = %v, expected http", opts.Protocol)
+		}
+		if opts.TLS == nil {
+			t.Fatal("TLS = nil, expected a TLS config")
+		}
+		if opts.TLS.ServerName != "ch.internal" || !opts.TLS.InsecureSkipVerify {
+			t.Errorf("TLS = %+v, expected server name and skip verify", opts.TLS)
+		}
+	})
+
+	t.Run("native with TLS", func(t *testing.T) {
+		cfg := base
+		cfg.TLS = true
+
+		opts, err := clickhouse.NewOptions(cfg)
+		if err != nil {
+			t.Fatalf("NewOptions() error = %v", err)
+		}
+		if opts.Protocol != chgo.Native || opts.TLS == nil {
+			t.Errorf("Protocol, TLS = %v, %+v, expected native with TLS", opts.Protocol, opts.TLS)
+		}
+	})
+
+	t.Run("unreadable CA file returns error", func(t *testing.T) {
+		cfg := base
+		cfg.Protocol = config.ClickHouseHTTPS
+		cfg.TLSCAFile = filepath.Join(t.TempDir(), "missing.pem")
+
+		if _, err := clickhouse.NewOptions(cfg); err == nil {
+			t.Error("NewOptions() expected error for a missing CA file")
+		}
+	})
+
+	t.Run("CA file without certificates returns error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg := base
+		cfg.Protocol = config.ClickHouseHTTPS
+		cfg.TLSCAFile = path
+
+		if _, err := clickhouse.NewOptions(cfg); err == nil {
+			t.Error("NewOptions() expected error for a CA file without certificates")
+		}
+	})
+}
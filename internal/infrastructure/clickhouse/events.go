@@ -11,11 +11,13 @@ import (
 // Event represents a tracked user event (internal to clickhouse package)
 type Event struct {
 	ID         uuid.UUID              `json:"id"`
+	ProjectID  uuid.UUID              `json:"project_id"`
 	UserID     string                 `json:"user_id"`
 	EventName  string                 `json:"event_name"`
 	Properties map[string]any         `json:"properties,omitempty"`
 	Timestamp  time.Time              `json:"timestamp"`
 	ReceivedAt time.Time              `json:"received_at"`
+	Sequence   uint64                 `json:"sequence,omitempty"`
 }
 
 // EventRepository handles event storage in ClickHouse
@@ -28,24 +30,57 @@ func NewEventRepository(client *Client) *EventRepository {
 	return &EventRepository{client: client}
 }
 
-// Insert inserts a single event
+// Insert inserts a single event. received_at is stamped by ClickHouse at
+// insert time unless the event sets ReceivedAt.
 func (r *EventRepository) Insert(ctx context.Context, e *Event) error {
 	props, err := json.Marshal(e.Properties)
 	if err != nil {
 		return err
 	}
 
+	if e.ReceivedAt.IsZero() {
+		return r.client.Exec(ctx, `
+		INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.ProjectID, e.UserID, e.EventName, string(props), e.Timestamp, e.Sequence)
+	}
+
 	return r.client.Exec(ctx, `
-		INSERT INTO events_raw (id, user_id, event_name, properties, timestamp, received_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, e.ID, e.UserID, e.EventName, string(props), e.Timestamp, e.ReceivedAt)
+		INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.ProjectID, e.UserID, e.EventName, string(props), e.Timestamp, e.Sequence, e.ReceivedAt)
 }
 
-// InsertBatch inserts multiple events efficiently
+// InsertBatch inserts multiple events efficiently. Events without ReceivedAt
+// are sent in their own batch so ClickHouse stamps received_at at insert time.
 func (r *EventRepository) InsertBatch(ctx context.Context, events []*Event) error {
-	batch, err := r.client.PrepareBatch(ctx, `
-		INSERT INTO events_raw (id, user_id, event_name, properties, timestamp, received_at)
-	`)
+	var stamped, overridden []*Event
+	for _, e := range events {
+		if e.ReceivedAt.IsZero() {
+			stamped = append(stamped, e)
+		} else {
+			overridden = append(overridden, e)
+		}
+	}
+
+	if err := r.insertBatch(ctx, stamped, false); err != nil {
+		return err
+	}
+	return r.insertBatch(ctx, overridden, true)
+}
+
+// insertBatch inserts events in a single batch, writing received_at only when
+// withReceivedAt is set
+func (r *EventRepository) insertBatch(ctx context.Context, events []*Event, withReceivedAt bool) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence)`
+	if withReceivedAt {
+		query = `INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence, received_at)`
+	}
+	batch, err := r.client.PrepareBatch(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -55,7 +90,11 @@ func (r *EventRepository) InsertBatch(ctx context.Context, events []*Event) erro
 		if err != nil {
 			return err
 		}
-		if err := batch.Append(e.ID, e.UserID, e.EventName, string(props), e.Timestamp, e.ReceivedAt); err != nil {
+		args := []any{e.ID, e.ProjectID, e.UserID, e.EventName, string(props), e.Timestamp, e.Sequence}
+		if withReceivedAt {
+			args = append(args, e.ReceivedAt)
+		}
+		if err := batch.Append(args...); err != nil {
 			return err
 		}
 	}
@@ -63,13 +102,20 @@ func (r *EventRepository) InsertBatch(ctx context.Context, events []*Event) erro
 	return batch.Send()
 }
 
+// DeleteUserEvents submits a mutation deleting a user's events in a project.
+// ClickHouse applies mutations asynchronously, so the events remain readable
+// until the mutation finishes.
+func (r *EventRepository) DeleteUserEvents(ctx context.Context, projectID uuid.UUID, userID string) error {
+	return r.client.Exec(ctx, `ALTER TABLE events_raw DELETE WHERE project_id = ? AND user_id = ?`, projectID, userID)
+}
+
 // GetByUserID retrieves events for a specific user
 func (r *EventRepository) GetByUserID(ctx context.Context, userID string, limit, offset int) ([]*Event, error) {
 	rows, err := r.client.Query(ctx, `
-		SELECT id, user_id, event_name, properties, timestamp, received_at
+		SELECT id, user_id, event_name, properties, timestamp, received_at, sequence
 		FROM events_raw
 		WHERE user_id = ?
-		ORDER BY timestamp DESC
+		ORDER BY timestamp DESC, sequence DESC
 		LIMIT ? OFFSET ?
 	`, userID, limit, offset)
 	if err != nil {
@@ -83,7 +129,7 @@ func (r *EventRepository) GetByUserID(ctx context.Context, userID string, limit,
 // GetByUserIDAndEventName retrieves events for a specific user and event name
 func (r *EventRepository) GetByUserIDAndEventName(ctx context.Context, userID, eventName string, startTime, endTime *time.Time, limit int) ([]*Event, error) {
 	query := `
-		SELECT id, user_id, event_name, properties, timestamp, received_at
+		SELECT id, user_id, event_name, properties, timestamp, received_at, sequence
 		FROM events_raw
 		WHERE user_id = ? AND event_name = ?
 	`
@@ -98,7 +144,7 @@ func (r *EventRepository) GetByUserIDAndEventName(ctx context.Context, userID, e
 		args = append(args, *endTime)
 	}
 
-	query += " ORDER BY timestamp DESC"
+	query += " ORDER BY timestamp DESC, sequence DESC"
 	if limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, limit)
@@ -150,6 +196,23 @@ func (r *EventRepository) HasEventInWindow(ctx context.Context, userID, eventNam
 	return exists == 1, nil
 }
 
+// EventPersisted reports whether the event with id has been written to
+// events_raw. The user and event name narrow the lookup to the sorting key.
+func (r *EventRepository) EventPersisted(ctx context.Context, userID, eventName string, id uuid.UUID) (bool, error) {
+	rows, err := r.client.Query(ctx, `
+		SELECT 1
+		FROM events_raw
+		WHERE user_id = ? AND event_name = ? AND id = ?
+		LIMIT 1
+	`, userID, eventName, id)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
 func scanEvents(rows interface{ Next() bool; Scan(dest ...any) error }) ([]*Event, error) {
 	var events []*Event
 	for rows.Next() {
@@ -157,7 +220,7 @@ func scanEvents(rows interface{ Next() bool; Scan(dest ...any) error }) ([]*Even
 			e        Event
 			propsStr string
 		)
-		if err := rows.Scan(&e.ID, &e.UserID, &e.EventName, &propsStr, &e.Timestamp, &e.ReceivedAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.UserID, &e.EventName, &propsStr, &e.Timestamp, &e.ReceivedAt, &e.Sequence); err != nil {
 			return nil, err
 		}
 		if propsStr != "" {
@@ -222,3 +285,30 @@ func (r *EventRepository) GetDistinctUserIDs(ctx context.Context, eventName stri
 	}
 	return userIDs, nil
 }
+
+// ExistingEventNames returns which of names have been ingested at least once
+func (r *EventRepository) ExistingEventNames(ctx context.Context, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.client.Query(ctx, `
+		SELECT DISTINCT event_name
+		FROM events_raw
+		WHERE event_name IN ?
+	`, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var existing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing = append(existing, name)
+	}
+	return existing, rows.Err()
+}
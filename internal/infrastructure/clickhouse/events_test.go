@@ -0,0 +1,134 @@
+package clickhouse_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+)
+
+// batchConn records prepared batches and their rows
+type batchConn struct {
+	fakeConn
+	batches []*fakeBatch
+}
+
+func (c *batchConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	b := &fakeBatch{query: query}
+	c.batches = append(c.batches, b)
+	return b, nil
+}
+
+type fakeBatch struct {
+	driver.Batch
+	query string
+	rows  [][]any
+	sent  bool
+}
+
+func (b *fakeBatch) Append(v ...any) error {
+	b.rows = append(b.rows, v)
+	return nil
+}
+
+func (b *fakeBatch) Send() error {
+	b.sent = true
+	return nil
+}
+
+func TestEventRepository_ReceivedAt(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	projectID := uuid.New()
+	newEvent := func(receivedAt time.Time) *clickhouse.Event {
+		return &clickhouse.Event{
+			ID:         uuid.New(),
+			ProjectID:  projectID,
+			UserID:     "user-1",
+			EventName:  "purchase",
+			Timestamp:  time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+			ReceivedAt: receivedAt,
+		}
+	}
+
+	t.Run("Insert leaves received_at to the server default", func(t *testing.T) {
+		conn := &fakeConn{}
+		repo := clickhouse.NewEventRepository(clickhouse.NewClientWithConn(conn))
+
+		if err := repo.Insert(context.Background(), newEvent(time.Time{})); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		if strings.Contains(conn.queries[0], "received_at") {
+			t.Errorf("query = %q, expected received_at to be omitted", conn.queries[0])
+		}
+		if len(conn.args[0]) != 7 {
+			t.Errorf("args = %v, expected 7 values", conn.args[0])
+		}
+		if got := conn.args[0][1]; got != projectID {
+			t.Errorf("project_id = %v, expected %v", got, projectID)
+		}
+	})
+
+	t.Run("Insert writes an explicit override", func(t *testing.T) {
+		conn := &fakeConn{}
+		repo := clickhouse.NewEventRepository(clickhouse.NewClientWithConn(conn))
+
+		if err := repo.Insert(context.Background(), newEvent(receivedAt)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		if !strings.Contains(conn.queries[0], "received_at") {
+			t.Errorf("query = %q, expected received_at column", conn.queries[0])
+		}
+		if got := conn.args[0][7]; got != receivedAt {
+			t.Errorf("received_at = %v, expected %v", got, receivedAt)
+		}
+	})
+
+	t.Run("InsertBatch splits stamped and overridden events", func(t *testing.T) {
+		conn := &batchConn{}
+		repo := clickhouse.NewEventRepository(clickhouse.NewClientWithConn(conn))
+
+		events := []*clickhouse.Event{newEvent(time.Time{}), newEvent(receivedAt), newEvent(time.Time{})}
+		if err := repo.InsertBatch(context.Background(), events); err != nil {
+			t.Fatalf("InsertBatch() error = %v", err)
+		}
+		if len(conn.batches) != 2 {
+			t.Fatalf("batches = %d, expected 2", len(conn.batches))
+		}
+
+		stamped, overridden := conn.batches[0], conn.batches[1]
+		if strings.Contains(stamped.query, "received_at") || len(stamped.rows) != 2 || len(stamped.rows[0]) != 7 {
+			t.Errorf("stamped batch = %q with rows %v, expected 2 rows without received_at", stamped.query, stamped.rows)
+		}
+		if !strings.Contains(overridden.query, "received_at") || len(overridden.rows) != 1 || overridden.rows[0][7] != receivedAt {
+			t.Errorf("overridden batch = %q with rows %v, expected 1 row with received_at", overridden.query, overridden.rows)
+		}
+		if !stamped.sent || !overridden.sent {
+			t.Error("expected both batches to be sent")
+		}
+	})
+}
+
+func TestEventRepository_DeleteUserEvents(t *testing.T) {
+	conn := &fakeConn{}
+	repo := clickhouse.NewEventRepository(clickhouse.NewClientWithConn(conn))
+	projectID := uuid.New()
+
+	if err := repo.DeleteUserEvents(context.Background(), projectID, "user-1"); err != nil {
+		t.Fatalf("DeleteUserEvents() error = %v", err)
+	}
+
+	if len(conn.queries) != 1 {
+		t.Fatalf("queries = %d, expected 1", len(conn.queries))
+	}
+	if !strings.Contains(conn.queries[0], "ALTER TABLE events_raw DELETE WHERE project_id = ? AND user_id = ?") {
+		t.Errorf("query = %q, expected a delete mutation scoped to the project", conn.queries[0])
+	}
+	if !reflect.DeepEqual(conn.args[0], []any{projectID, "user-1"}) {
+		t.Errorf("args = %v, expected [%v user-1]", conn.args[0], projectID)
+	}
+}
@@ -2,9 +2,12 @@ package clickhouse
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/config"
 )
 
 // MembershipStatus represents whether a user is in or out of a cohort
@@ -19,6 +22,10 @@ const (
 type Member struct {
 	UserID   string    `json:"user_id"`
 	JoinedAt time.Time `json:"joined_at"`
+	Variant  string    `json:"variant,omitempty"`
+	// LastActiveAt is the time of the member's latest event, when requested
+	// and the member has events
+	LastActiveAt *time.Time `json:"last_active_at,omitempty"`
 }
 
 // Membership represents a user's membership in a cohort
@@ -27,6 +34,7 @@ type Membership struct {
 	UserID    string    `json:"user_id"`
 	IsMember  bool      `json:"is_member"`
 	JoinedAt  time.Time `json:"joined_at"`
+	Variant   string    `json:"variant,omitempty"`
 }
 
 // MembershipChange represents a change in cohort membership
@@ -38,77 +46,190 @@ type MembershipChange struct {
 	NewStatus    MembershipStatus `json:"new_status"`
 	ChangedAt    time.Time        `json:"changed_at"`
 	TriggerEvent *uuid.UUID       `json:"trigger_event,omitempty"`
+	Reason       string           `json:"reason,omitempty"`
+	Variant      string           `json:"variant,omitempty"`
+}
+
+// MembershipOverride is a user manually placed in or removed from a cohort.
+// A zero Status clears an earlier override.
+type MembershipOverride struct {
+	CohortID  uuid.UUID        `json:"cohort_id"`
+	UserID    string           `json:"user_id"`
+	Status    MembershipStatus `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// RawMembershipRow is one row of the current membership table as stored,
+// before CollapsingMergeTree merges cancel it out
+type RawMembershipRow struct {
+	Sign      int8      `json:"sign"`
+	JoinedAt  time.Time `json:"joined_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Variant   string    `json:"variant,omitempty"`
+	// Part is the data part holding the row. Rows in different parts haven't
+	// been merged with each other yet.
+	Part string `json:"part"`
+}
+
+// RawMembershipStateRow is one row of the membership state table as stored,
+// before ReplacingMergeTree merges keep only the latest version
+type RawMembershipStateRow struct {
+	Status   int8      `json:"status"`
+	JoinedAt time.Time `json:"joined_at"`
+	Version  uint64    `json:"version"`
+	Part     string    `json:"part"`
+}
+
+// RawMembership is every stored row of a user's membership in a cohort, for
+// diagnosing unmerged state such as overcounted signs
+type RawMembership struct {
+	CohortID uuid.UUID `json:"cohort_id"`
+	UserID   string    `json:"user_id"`
+	// SignSum is what collapsing reads see; above 1 the user is overcounted
+	SignSum   int64                   `json:"sign_sum"`
+	Rows      []RawMembershipRow      `json:"rows"`
+	StateRows []RawMembershipStateRow `json:"state_rows"`
+}
+
+// membershipReads describes how current membership is read from one storage model
+type membershipReads struct {
+	// table holds current membership
+	table string
+	// isMember is an aggregate that holds for current members of a group
+	isMember string
+	// joinedAt is an aggregate for a member's join time
+	joinedAt string
+	// latestJoin is an aggregate for a member's most recent join
+	latestJoin string
+	// variant is an aggregate for the experiment variant of a member's most
+	// recent join
+	variant string
+}
+
+// collapsingReads sums the signs in the CollapsingMergeTree all writers insert into
+var collapsingReads = membershipReads{
+	table:      "cohort_membership_current",
+	isMember:   "sum(sign) > 0",
+	joinedAt:   "min(joined_at)",
+	latestJoin: "maxIf(joined_at, sign > 0)",
+	variant:    "argMaxIf(variant, joined_at, sign > 0)",
+}
+
+// replacingReads takes the latest status from the ReplacingMergeTree the
+// cohort_membership_state_mv view maintains, which can't overcount before merges
+var replacingReads = membershipReads{
+	table:      "cohort_membership_state",
+	isMember:   "argMax(status, version) > 0",
+	joinedAt:   "argMax(joined_at, version)",
+	latestJoin: "argMax(joined_at, version)",
+	variant:    "argMax(variant, version)",
 }
 
 // MembershipRepository handles membership storage in ClickHouse
 type MembershipRepository struct {
 	client *Client
+	reads  membershipReads
 }
 
 // NewMembershipRepository creates a new membership repository
 func NewMembershipRepository(client *Client) *MembershipRepository {
-	return &MembershipRepository{client: client}
+	return &MembershipRepository{client: client, reads: collapsingReads}
+}
+
+// SetMembershipModel sets the storage model current membership is read from.
+// Writes always go to cohort_membership_current.
+func (r *MembershipRepository) SetMembershipModel(model config.MembershipModel) {
+	if model == config.MembershipModelReplacing {
+		r.reads = replacingReads
+		return
+	}
+	r.reads = collapsingReads
 }
 
-// GetByCohortAndUser retrieves membership for a specific cohort and user
-func (r *MembershipRepository) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string) (*Membership, error) {
+// GetByCohortAndUser retrieves membership for a specific cohort and user. A
+// positive ttl treats members who joined longer ago than it as expired.
+func (r *MembershipRepository) GetByCohortAndUser(ctx context.Context, cohortID uuid.UUID, userID string, ttl time.Duration) (*Membership, error) {
 	var m Membership
-	var signSum int64
+	expiry, expiryArgs := r.reads.expiryClause(ttl)
 	err := r.client.QueryRow(ctx, `
-		SELECT cohort_id, user_id, sum(sign), min(joined_at)
-		FROM cohort_membership_current
+		SELECT cohort_id, user_id, `+r.reads.joinedAt+`, `+r.reads.variant+`
+		FROM `+r.reads.table+`
 		WHERE cohort_id = ? AND user_id = ?
 		GROUP BY cohort_id, user_id
-		HAVING sum(sign) > 0
-	`, cohortID, userID).Scan(&m.CohortID, &m.UserID, &signSum, &m.JoinedAt)
+		HAVING `+r.reads.isMember+expiry+`
+	`, append([]any{cohortID, userID}, expiryArgs...)...).Scan(&m.CohortID, &m.UserID, &m.JoinedAt, &m.Variant)
 	if err != nil {
 		return nil, err
 	}
-	m.IsMember = signSum > 0
+	m.IsMember = true
 	return &m, nil
 }
 
+// expiryClause returns the HAVING condition excluding members whose latest
+// join is older than ttl. A zero ttl keeps every member.
+func (m membershipReads) expiryClause(ttl time.Duration) (string, []any) {
+	if ttl <= 0 {
+		return "", nil
+	}
+	return " AND " + m.latestJoin + " > ?", []any{time.Now().UTC().Add(-ttl)}
+}
+
+// currentMembers selects the current members of a single cohort
+func (m membershipReads) currentMembers() string {
+	return `
+		SELECT user_id
+		FROM ` + m.table + `
+		WHERE cohort_id = ?
+		GROUP BY user_id
+		HAVING ` + m.isMember
+}
+
 // IsMember checks if a user is a member of a cohort
 func (r *MembershipRepository) IsMember(ctx context.Context, cohortID uuid.UUID, userID string) (bool, error) {
-	var signSum int64
+	var isMember uint8
 	err := r.client.QueryRow(ctx, `
-		SELECT sum(sign)
-		FROM cohort_membership_current
+		SELECT `+r.reads.isMember+`
+		FROM `+r.reads.table+`
 		WHERE cohort_id = ? AND user_id = ?
-	`, cohortID, userID).Scan(&signSum)
+	`, cohortID, userID).Scan(&isMember)
 	if err != nil {
 		return false, nil
 	}
-	return signSum > 0, nil
+	return isMember > 0, nil
 }
 
-// GetCohortMembers retrieves all members of a cohort with pagination
-func (r *MembershipRepository) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int) ([]Member, int64, error) {
+// GetCohortMembers retrieves all members of a cohort with pagination. A
+// positive ttl excludes members who joined longer ago than it. lastActive
+// also looks up each member's latest event time, which scans their events. A
+// non-empty variant keeps only the members assigned that variant.
+func (r *MembershipRepository) GetCohortMembers(ctx context.Context, cohortID uuid.UUID, limit, offset int, ttl time.Duration, lastActive bool, variant string) ([]Member, int64, error) {
+	expiry, expiryArgs := r.reads.expiryClause(ttl)
+	if variant != "" {
+		expiry += " AND " + r.reads.variant + " = ?"
+		expiryArgs = append(expiryArgs, variant)
+	}
+
 	// Get total count
 	var total uint64
 	if err := r.client.QueryRow(ctx, `
 		SELECT count()
-		FROM (
-			SELECT user_id
-			FROM cohort_membership_current
-			WHERE cohort_id = ?
-			GROUP BY user_id
-			HAVING sum(sign) > 0
+		FROM (`+r.reads.currentMembers()+expiry+`
 		)
-	`, cohortID).Scan(&total); err != nil {
+	`, append([]any{cohortID}, expiryArgs...)...).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	// Get members
+	args := append([]any{cohortID}, expiryArgs...)
 	rows, err := r.client.Query(ctx, `
-		SELECT user_id, min(joined_at) as joined_at
-		FROM cohort_membership_current
+		SELECT user_id, `+r.reads.joinedAt+` AS first_joined_at, `+r.reads.variant+`
+		FROM `+r.reads.table+`
 		WHERE cohort_id = ?
 		GROUP BY user_id
-		HAVING sum(sign) > 0
-		ORDER BY joined_at DESC
+		HAVING `+r.reads.isMember+expiry+`
+		ORDER BY first_joined_at DESC
 		LIMIT ? OFFSET ?
-	`, cohortID, limit, offset)
+	`, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -117,23 +238,92 @@ func (r *MembershipRepository) GetCohortMembers(ctx context.Context, cohortID uu
 	var members []Member
 	for rows.Next() {
 		var m Member
-		if err := rows.Scan(&m.UserID, &m.JoinedAt); err != nil {
+		if err := rows.Scan(&m.UserID, &m.JoinedAt, &m.Variant); err != nil {
 			return nil, 0, err
 		}
 		members = append(members, m)
 	}
 
+	if lastActive && len(members) > 0 {
+		if err := r.setLastActive(ctx, members); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return members, int64(total), nil
 }
 
+// setLastActive sets each member's latest event time
+func (r *MembershipRepository) setLastActive(ctx context.Context, members []Member) error {
+	userIDs := make([]string, len(members))
+	for i, m := range members {
+		userIDs[i] = m.UserID
+	}
+
+	rows, err := r.client.Query(ctx, `
+		SELECT user_id, max(timestamp) AS last_active_at
+		FROM events_raw
+		WHERE user_id IN ?
+		GROUP BY user_id
+	`, userIDs)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	lastActive := make(map[string]time.Time, len(members))
+	for rows.Next() {
+		var (
+			userID string
+			at     time.Time
+		)
+		if err := rows.Scan(&userID, &at); err != nil {
+			return err
+		}
+		lastActive[userID] = at
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range members {
+		if at, ok := lastActive[members[i].UserID]; ok {
+			members[i].LastActiveAt = &at
+		}
+	}
+	return nil
+}
+
+// ForEachCohortMember calls fn with the user ID of every current member of a
+// cohort, streaming the roster instead of loading it into memory
+func (r *MembershipRepository) ForEachCohortMember(ctx context.Context, cohortID uuid.UUID, fn func(userID string) error) error {
+	rows, err := r.client.Query(ctx, r.reads.currentMembers(), cohortID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return err
+		}
+		if err := fn(userID); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetUserCohorts retrieves all cohorts a user belongs to
 func (r *MembershipRepository) GetUserCohorts(ctx context.Context, userID string) ([]uuid.UUID, error) {
 	rows, err := r.client.Query(ctx, `
 		SELECT cohort_id
-		FROM cohort_membership_current
+		FROM `+r.reads.table+`
 		WHERE user_id = ?
 		GROUP BY cohort_id
-		HAVING sum(sign) > 0
+		HAVING `+r.reads.isMember+`
 	`, userID)
 	if err != nil {
 		return nil, err
@@ -152,17 +342,44 @@ func (r *MembershipRepository) GetUserCohorts(ctx context.Context, userID string
 	return cohortIDs, nil
 }
 
+// GetSharedCohorts returns the cohorts every given user is currently a member
+// of. userIDs must not contain duplicates.
+func (r *MembershipRepository) GetSharedCohorts(ctx context.Context, userIDs []string) ([]uuid.UUID, error) {
+	rows, err := r.client.Query(ctx, `
+		SELECT cohort_id
+		FROM (
+			SELECT cohort_id, user_id
+			FROM `+r.reads.table+`
+			WHERE user_id IN ?
+			GROUP BY cohort_id, user_id
+			HAVING `+r.reads.isMember+`
+		)
+		GROUP BY cohort_id
+		HAVING count() = ?
+	`, userIDs, len(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cohortIDs []uuid.UUID
+	for rows.Next() {
+		var cohortID uuid.UUID
+		if err := rows.Scan(&cohortID); err != nil {
+			return nil, err
+		}
+		cohortIDs = append(cohortIDs, cohortID)
+	}
+
+	return cohortIDs, nil
+}
+
 // GetCohortMemberCount returns the number of members in a cohort
 func (r *MembershipRepository) GetCohortMemberCount(ctx context.Context, cohortID uuid.UUID) (int64, error) {
 	var count uint64
 	err := r.client.QueryRow(ctx, `
 		SELECT count()
-		FROM (
-			SELECT user_id
-			FROM cohort_membership_current
-			WHERE cohort_id = ?
-			GROUP BY user_id
-			HAVING sum(sign) > 0
+		FROM (`+r.reads.currentMembers()+`
 		)
 	`, cohortID).Scan(&count)
 	if err != nil {
@@ -171,18 +388,212 @@ func (r *MembershipRepository) GetCohortMemberCount(ctx context.Context, cohortI
 	return int64(count), nil
 }
 
+// PropertyCount is the number of cohort members whose latest event carries a property value
+type PropertyCount struct {
+	Value   string
+	Members uint64
+}
+
+// CountMembersByProperty groups a cohort's current members by the value of a
+// property on their most recent event, largest groups first. Members whose
+// latest event lacks the property, or who have no events, count under "".
+func (r *MembershipRepository) CountMembersByProperty(ctx context.Context, cohortID uuid.UUID, property string, limit int) ([]PropertyCount, error) {
+	rows, err := r.client.Query(ctx, `
+		SELECT ifNull(e.value, '') AS value, count() AS members
+		FROM (`+r.reads.currentMembers()+`
+		) AS m
+		LEFT JOIN (
+			SELECT user_id, argMax(
+				if(JSONType(properties, ?) = 'String', JSONExtractString(properties, ?), JSONExtractRaw(properties, ?)),
+				timestamp
+			) AS value
+			FROM events_raw
+			WHERE user_id IN (`+r.reads.currentMembers()+`
+			)
+			GROUP BY user_id
+		) AS e ON e.user_id = m.user_id
+		GROUP BY value
+		ORDER BY members DESC, value
+		LIMIT ?
+	`, cohortID, property, property, property, cohortID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []PropertyCount{}
+	for rows.Next() {
+		var pc PropertyCount
+		if err := rows.Scan(&pc.Value, &pc.Members); err != nil {
+			return nil, err
+		}
+		counts = append(counts, pc)
+	}
+
+	return counts, rows.Err()
+}
+
+// BucketCount is the number of cohort members whose latest numeric value of a
+// property falls in a bucket. Bucket -1 holds members without a numeric value.
+type BucketCount struct {
+	Bucket  int32
+	Members uint64
+}
+
+// CountMembersByPropertyRange buckets a cohort's current members by the
+// numeric value of a property on their most recent event carrying it. Bucket
+// 0 holds values below boundaries[0], bucket i values in [boundaries[i-1],
+// boundaries[i]) and bucket len(boundaries) values from the last boundary up.
+// Only non-empty buckets are returned, in bucket order.
+func (r *MembershipRepository) CountMembersByPropertyRange(ctx context.Context, cohortID uuid.UUID, property string, boundaries []float64) ([]BucketCount, error) {
+	branches := make([]string, len(boundaries))
+	args := make([]any, 0, len(boundaries)+3)
+	for i, boundary := range boundaries {
+		branches[i] = fmt.Sprintf("e.value < ?, %d", i)
+		args = append(args, boundary)
+	}
+	args = append(args, cohortID, property, cohortID)
+
+	rows, err := r.client.Query(ctx, `
+		SELECT toInt32(multiIf(e.value IS NULL, -1, `+strings.Join(branches, ", ")+`, `+fmt.Sprint(len(boundaries))+`)) AS bucket, count() AS members
+		FROM (`+r.reads.currentMembers()+`
+		) AS m
+		LEFT JOIN (
+			SELECT user_id, argMax(JSONExtract(properties, ?, 'Nullable(Float64)'), timestamp) AS value
+			FROM events_raw
+			WHERE user_id IN (`+r.reads.currentMembers()+`
+			)
+			GROUP BY user_id
+		) AS e ON e.user_id = m.user_id
+		GROUP BY bucket
+		ORDER BY bucket
+		SETTINGS join_use_nulls = 1
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []BucketCount{}
+	for rows.Next() {
+		var bc BucketCount
+		if err := rows.Scan(&bc.Bucket, &bc.Members); err != nil {
+			return nil, err
+		}
+		counts = append(counts, bc)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetUsersInAllCohorts returns users that are currently members of every given cohort
+func (r *MembershipRepository) GetUsersInAllCohorts(ctx context.Context, cohortIDs []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	parts := make([]string, len(cohortIDs))
+	args := make([]any, len(cohortIDs))
+	for i, id := range cohortIDs {
+		parts[i] = r.reads.currentMembers()
+		args[i] = id
+	}
+
+	return r.queryUserSet(ctx, strings.Join(parts, "\n\t\tINTERSECT"), args, limit, offset)
+}
+
+// GetUsersInNoCohorts returns users that are currently members of at least one
+// of the universe cohorts, normally every cohort of the project, but of none of
+// the given cohorts
+func (r *MembershipRepository) GetUsersInNoCohorts(ctx context.Context, cohortIDs, universe []uuid.UUID, limit, offset int) ([]string, int64, error) {
+	query := `
+		SELECT user_id
+		FROM (
+			SELECT user_id
+			FROM ` + r.reads.table + `
+			WHERE cohort_id IN ?
+			GROUP BY cohort_id, user_id
+			HAVING ` + r.reads.isMember + `
+		)
+		GROUP BY user_id
+		EXCEPT
+		SELECT user_id
+		FROM ` + r.reads.table + `
+		WHERE cohort_id IN ?
+		GROUP BY cohort_id, user_id
+		HAVING ` + r.reads.isMember
+
+	return r.queryUserSet(ctx, query, []any{universe, cohortIDs}, limit, offset)
+}
+
+// GetMembersInCohorts returns users that are currently members of the given
+// cohorts: of every one of them when intersect is set, otherwise of any
+func (r *MembershipRepository) GetMembersInCohorts(ctx context.Context, cohortIDs []uuid.UUID, intersect bool, limit, offset int) ([]string, int64, error) {
+	having := "count(DISTINCT cohort_id) > 0"
+	args := []any{cohortIDs}
+	if intersect {
+		having = "count(DISTINCT cohort_id) = ?"
+		args = append(args, len(cohortIDs))
+	}
+
+	query := `
+		SELECT user_id
+		FROM (
+			SELECT cohort_id, user_id
+			FROM ` + r.reads.table + `
+			WHERE cohort_id IN ?
+			GROUP BY cohort_id, user_id
+			HAVING ` + r.reads.isMember + `
+		)
+		GROUP BY user_id
+		HAVING ` + having
+
+	return r.queryUserSet(ctx, query, args, limit, offset)
+}
+
+// queryUserSet counts and pages the user IDs produced by a set query
+func (r *MembershipRepository) queryUserSet(ctx context.Context, setQuery string, args []any, limit, offset int) ([]string, int64, error) {
+	var total uint64
+	if err := r.client.QueryRow(ctx, `
+		SELECT count()
+		FROM (`+setQuery+`
+		)
+	`, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.client.Query(ctx, `
+		SELECT user_id
+		FROM (`+setQuery+`
+		)
+		ORDER BY user_id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, int64(total), nil
+}
+
 // RecordChange records a membership change in the changelog
 func (r *MembershipRepository) RecordChange(ctx context.Context, change *MembershipChange) error {
 	return r.client.Exec(ctx, `
-		INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, change.CohortID, change.UserID, change.PrevStatus, change.NewStatus, change.ChangedAt, change.TriggerEvent)
+		INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id, reason, variant)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, change.CohortID, change.UserID, change.PrevStatus, change.NewStatus, change.ChangedAt, change.TriggerEvent, change.Reason, change.Variant)
 }
 
 // GetChangeHistory retrieves membership change history
 func (r *MembershipRepository) GetChangeHistory(ctx context.Context, cohortID *uuid.UUID, userID *string, startTime, endTime time.Time, limit int) ([]*MembershipChange, error) {
 	query := `
-		SELECT cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id
+		SELECT cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id, reason, variant
 		FROM cohort_membership_changelog
 		WHERE changed_at >= ? AND changed_at <= ?
 	`
@@ -209,7 +620,7 @@ func (r *MembershipRepository) GetChangeHistory(ctx context.Context, cohortID *u
 	var changes []*MembershipChange
 	for rows.Next() {
 		var c MembershipChange
-		if err := rows.Scan(&c.CohortID, &c.UserID, &c.PrevStatus, &c.NewStatus, &c.ChangedAt, &c.TriggerEvent); err != nil {
+		if err := rows.Scan(&c.CohortID, &c.UserID, &c.PrevStatus, &c.NewStatus, &c.ChangedAt, &c.TriggerEvent, &c.Reason, &c.Variant); err != nil {
 			return nil, err
 		}
 		changes = append(changes, &c)
@@ -218,15 +629,176 @@ func (r *MembershipRepository) GetChangeHistory(ctx context.Context, cohortID *u
 	return changes, nil
 }
 
+// GetRawMembership returns the unmerged rows stored for a user's membership
+// in a cohort, in both the current membership table and the state table,
+// oldest first
+func (r *MembershipRepository) GetRawMembership(ctx context.Context, cohortID uuid.UUID, userID string) (*RawMembership, error) {
+	raw := &RawMembership{
+		CohortID:  cohortID,
+		UserID:    userID,
+		Rows:      []RawMembershipRow{},
+		StateRows: []RawMembershipStateRow{},
+	}
+
+	rows, err := r.client.Query(ctx, `
+		SELECT sign, joined_at, updated_at, variant, _part
+		FROM cohort_membership_current
+		WHERE cohort_id = ? AND user_id = ?
+		ORDER BY updated_at, joined_at
+	`, cohortID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row RawMembershipRow
+		if err := rows.Scan(&row.Sign, &row.JoinedAt, &row.UpdatedAt, &row.Variant, &row.Part); err != nil {
+			return nil, err
+		}
+		raw.SignSum += int64(row.Sign)
+		raw.Rows = append(raw.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stateRows, err := r.client.Query(ctx, `
+		SELECT status, joined_at, version, _part
+		FROM cohort_membership_state
+		WHERE cohort_id = ? AND user_id = ?
+		ORDER BY version
+	`, cohortID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer stateRows.Close()
+
+	for stateRows.Next() {
+		var row RawMembershipStateRow
+		if err := stateRows.Scan(&row.Status, &row.JoinedAt, &row.Version, &row.Part); err != nil {
+			return nil, err
+		}
+		raw.StateRows = append(raw.StateRows, row)
+	}
+	return raw, stateRows.Err()
+}
+
+// MembershipPartitions returns the IDs of the partitions of the current
+// membership table holding a cohort's rows
+func (r *MembershipRepository) MembershipPartitions(ctx context.Context, cohortID uuid.UUID) ([]string, error) {
+	rows, err := r.client.Query(ctx, `
+		SELECT DISTINCT _partition_id
+		FROM `+r.reads.table+`
+		WHERE cohort_id = ?
+	`, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions, rows.Err()
+}
+
+// OptimizeMembershipPartition force-merges a partition of the current
+// membership table, collapsing cancelled rows so reads aggregate fewer parts
+func (r *MembershipRepository) OptimizeMembershipPartition(ctx context.Context, partitionID string) error {
+	return r.client.Exec(ctx, `OPTIMIZE TABLE `+r.reads.table+` PARTITION ID ? FINAL`, partitionID)
+}
+
 // DeleteCohortMemberships removes all memberships for a cohort by inserting cancellation rows
 func (r *MembershipRepository) DeleteCohortMemberships(ctx context.Context, cohortID uuid.UUID) error {
 	// Insert sign=-1 rows for all current members to cancel them out
 	return r.client.Exec(ctx, `
 		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at)
-		SELECT cohort_id, user_id, -1, min(joined_at)
-		FROM cohort_membership_current
+		SELECT cohort_id, user_id, -1, `+r.reads.joinedAt+`
+		FROM `+r.reads.table+`
+		WHERE cohort_id = ?
+		GROUP BY cohort_id, user_id
+		HAVING `+r.reads.isMember+`
+	`, cohortID)
+}
+
+// DeleteUserMemberships removes a user's memberships of the given cohorts by
+// inserting cancellation rows
+func (r *MembershipRepository) DeleteUserMemberships(ctx context.Context, userID string, cohortIDs []uuid.UUID) error {
+	if len(cohortIDs) == 0 {
+		return nil
+	}
+	return r.client.Exec(ctx, `
+		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at)
+		SELECT cohort_id, user_id, -1, `+r.reads.joinedAt+`
+		FROM `+r.reads.table+`
+		WHERE user_id = ? AND cohort_id IN ?
+		GROUP BY cohort_id, user_id
+		HAVING `+r.reads.isMember+`
+	`, userID, cohortIDs)
+}
+
+// ApplyChange writes a single membership change to the current membership
+// table and the changelog
+func (r *MembershipRepository) ApplyChange(ctx context.Context, change *MembershipChange) error {
+	if err := r.client.Exec(ctx, `
+		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at, variant)
+		VALUES (?, ?, ?, ?, ?)
+	`, change.CohortID, change.UserID, int8(change.NewStatus), change.ChangedAt, change.Variant); err != nil {
+		return err
+	}
+	return r.RecordChange(ctx, change)
+}
+
+// SetOverride records a manual membership override
+func (r *MembershipRepository) SetOverride(ctx context.Context, override *MembershipOverride) error {
+	return r.client.Exec(ctx, `
+		INSERT INTO cohort_membership_overrides (cohort_id, user_id, status, created_at)
+		VALUES (?, ?, ?, ?)
+	`, override.CohortID, override.UserID, int8(override.Status), override.CreatedAt)
+}
+
+// GetOverrides returns the active manual overrides for a cohort
+func (r *MembershipRepository) GetOverrides(ctx context.Context, cohortID uuid.UUID) ([]MembershipOverride, error) {
+	rows, err := r.client.Query(ctx, `
+		SELECT user_id, argMax(status, created_at) AS current_status, max(created_at)
+		FROM cohort_membership_overrides
+		WHERE cohort_id = ?
+		GROUP BY user_id
+		HAVING current_status != 0
+	`, cohortID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []MembershipOverride
+	for rows.Next() {
+		o := MembershipOverride{CohortID: cohortID}
+		var status int8
+		if err := rows.Scan(&o.UserID, &status, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		o.Status = MembershipStatus(status)
+		overrides = append(overrides, o)
+	}
+
+	return overrides, nil
+}
+
+// ClearOverrides clears every active manual override for a cohort
+func (r *MembershipRepository) ClearOverrides(ctx context.Context, cohortID uuid.UUID) error {
+	return r.client.Exec(ctx, `
+		INSERT INTO cohort_membership_overrides (cohort_id, user_id, status, created_at)
+		SELECT cohort_id, user_id, 0, now64(3)
+		FROM cohort_membership_overrides
 		WHERE cohort_id = ?
 		GROUP BY cohort_id, user_id
-		HAVING sum(sign) > 0
+		HAVING argMax(status, created_at) != 0
 	`, cohortID)
 }
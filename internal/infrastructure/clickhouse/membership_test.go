@@ -0,0 +1,797 @@
+package clickhouse_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+)
+
+// fakeConn records queries and serves a fixed count, timestamp, status and
+// user ID list
+type fakeConn struct {
+	driver.Conn
+	total   uint64
+	at      time.Time
+	status  int8
+	userIDs []string
+	queries []string
+	args    [][]any
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.queries = append(c.queries, query)
+	c.args = append(c.args, args)
+	return nil
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	c.queries = append(c.queries, query)
+	c.args = append(c.args, args)
+	return &fakeRow{value: c.total, at: c.at, status: c.status}
+}
+
+func (c *fakeConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.queries = append(c.queries, query)
+	c.args = append(c.args, args)
+	return &fakeRows{values: c.userIDs}, nil
+}
+
+type fakeRow struct {
+	driver.Row
+	value  uint64
+	at     time.Time
+	status int8
+}
+
+func (r *fakeRow) Scan(dest ...any) error {
+	for _, dst := range dest {
+		switch d := dst.(type) {
+		case *uint64:
+			*d = r.value
+		case *time.Time:
+			*d = r.at
+		case *int8:
+			*d = r.status
+		}
+	}
+	return nil
+}
+
+type fakeRows struct {
+	driver.Rows
+	values []string
+	i      int
+}
+
+func (r *fakeRows) Next() bool {
+	r.i++
+	return r.i <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	switch d := dest[0].(type) {
+	case *string:
+		*d = r.values[r.i-1]
+	case *uuid.UUID:
+		*d = uuid.MustParse(r.values[r.i-1])
+	}
+	return nil
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+func TestMembershipRepository_GetUsersInAllCohorts(t *testing.T) {
+	cohortA := uuid.New()
+	cohortB := uuid.New()
+	cohortC := uuid.New()
+
+	conn := &fakeConn{total: 2, userIDs: []string{"user-1", "user-2"}}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	userIDs, total, err := repo.GetUsersInAllCohorts(context.Background(), []uuid.UUID{cohortA, cohortB, cohortC}, 10, 20)
+	if err != nil {
+		t.Fatalf("GetUsersInAllCohorts() error = %v", err)
+	}
+
+	t.Run("returns users and total", func(t *testing.T) {
+		if total != 2 {
+			t.Errorf("total = %v, expected 2", total)
+		}
+		if !reflect.DeepEqual(userIDs, []string{"user-1", "user-2"}) {
+			t.Errorf("userIDs = %v, expected [user-1 user-2]", userIDs)
+		}
+	})
+
+	t.Run("intersects one subquery per cohort", func(t *testing.T) {
+		if len(conn.queries) != 2 {
+			t.Fatalf("queries = %d, expected 2", len(conn.queries))
+		}
+		for _, q := range conn.queries {
+			if n := strings.Count(q, "INTERSECT"); n != 2 {
+				t.Errorf("INTERSECT count = %d, expected 2", n)
+			}
+		}
+	})
+
+	t.Run("binds cohort IDs and pagination", func(t *testing.T) {
+		expectedCount := []any{cohortA, cohortB, cohortC}
+		if !reflect.DeepEqual(conn.args[0], expectedCount) {
+			t.Errorf("count args = %v, expected %v", conn.args[0], expectedCount)
+		}
+		expectedPage := []any{cohortA, cohortB, cohortC, 10, 20}
+		if !reflect.DeepEqual(conn.args[1], expectedPage) {
+			t.Errorf("page args = %v, expected %v", conn.args[1], expectedPage)
+		}
+	})
+}
+
+func TestMembershipRepository_GetUsersInNoCohorts(t *testing.T) {
+	cohortIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	universe := append([]uuid.UUID{uuid.New()}, cohortIDs...)
+
+	t.Run("excludes members of the given cohorts", func(t *testing.T) {
+		conn := &fakeConn{total: 1, userIDs: []string{"user-3"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		userIDs, total, err := repo.GetUsersInNoCohorts(context.Background(), cohortIDs, universe, 100, 0)
+		if err != nil {
+			t.Fatalf("GetUsersInNoCohorts() error = %v", err)
+		}
+		if total != 1 {
+			t.Errorf("total = %v, expected 1", total)
+		}
+		if !reflect.DeepEqual(userIDs, []string{"user-3"}) {
+			t.Errorf("userIDs = %v, expected [user-3]", userIDs)
+		}
+		for _, q := range conn.queries {
+			if !strings.Contains(q, "EXCEPT") {
+				t.Errorf("query missing EXCEPT: %s", q)
+			}
+			if strings.Count(q, "cohort_id IN ?") != 2 {
+				t.Errorf("query should filter both the universe and the excluded cohorts: %s", q)
+			}
+		}
+		expectedPage := []any{universe, cohortIDs, 100, 0}
+		if !reflect.DeepEqual(conn.args[1], expectedPage) {
+			t.Errorf("page args = %v, expected %v", conn.args[1], expectedPage)
+		}
+	})
+
+	t.Run("returns empty list when no users match", func(t *testing.T) {
+		conn := &fakeConn{}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		userIDs, total, err := repo.GetUsersInNoCohorts(context.Background(), cohortIDs, universe, 100, 0)
+		if err != nil {
+			t.Fatalf("GetUsersInNoCohorts() error = %v", err)
+		}
+		if total != 0 {
+			t.Errorf("total = %v, expected 0", total)
+		}
+		if userIDs == nil || len(userIDs) != 0 {
+			t.Errorf("userIDs = %v, expected empty slice", userIDs)
+		}
+	})
+}
+
+func TestMembershipRepository_DeleteUserMemberships(t *testing.T) {
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	cohortIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	if err := repo.DeleteUserMemberships(context.Background(), "user-1", cohortIDs); err != nil {
+		t.Fatalf("DeleteUserMemberships() error = %v", err)
+	}
+
+	if len(conn.queries) != 1 {
+		t.Fatalf("queries = %d, expected 1", len(conn.queries))
+	}
+	q := conn.queries[0]
+	if !strings.Contains(q, "INSERT INTO cohort_membership_current") || !strings.Contains(q, "-1") {
+		t.Errorf("query should insert cancellation rows, got %q", q)
+	}
+	if !strings.Contains(q, "HAVING sum(sign) > 0") {
+		t.Errorf("query should only cancel current memberships, got %q", q)
+	}
+	if !strings.Contains(q, "cohort_id IN ?") {
+		t.Errorf("query should only cancel memberships of the given cohorts, got %q", q)
+	}
+	if !reflect.DeepEqual(conn.args[0], []any{"user-1", cohortIDs}) {
+		t.Errorf("args = %v, expected [user-1 %v]", conn.args[0], cohortIDs)
+	}
+}
+
+func TestMembershipRepository_ApplyChange(t *testing.T) {
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	err := repo.ApplyChange(context.Background(), &clickhouse.MembershipChange{
+		CohortID:   uuid.New(),
+		UserID:     "user-1",
+		PrevStatus: clickhouse.MembershipStatusIn,
+		NewStatus:  clickhouse.MembershipStatusOut,
+		Reason:     "manual",
+	})
+	if err != nil {
+		t.Fatalf("ApplyChange() error = %v", err)
+	}
+
+	if len(conn.queries) != 2 {
+		t.Fatalf("queries = %d, expected membership and changelog inserts", len(conn.queries))
+	}
+	if !strings.Contains(conn.queries[0], "INSERT INTO cohort_membership_current") || conn.args[0][2] != int8(-1) {
+		t.Errorf("membership insert = %q %v, expected a cancellation row", conn.queries[0], conn.args[0])
+	}
+	if !strings.Contains(conn.queries[1], "INSERT INTO cohort_membership_changelog") || conn.args[1][6] != "manual" {
+		t.Errorf("changelog insert = %q %v, expected reason manual", conn.queries[1], conn.args[1])
+	}
+}
+
+func TestMembershipRepository_ClearOverrides(t *testing.T) {
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+	cohortID := uuid.New()
+
+	if err := repo.ClearOverrides(context.Background(), cohortID); err != nil {
+		t.Fatalf("ClearOverrides() error = %v", err)
+	}
+
+	q := conn.queries[0]
+	if !strings.Contains(q, "INSERT INTO cohort_membership_overrides") || !strings.Contains(q, "HAVING argMax(status, created_at) != 0") {
+		t.Errorf("query should clear only active overrides, got %q", q)
+	}
+	if !reflect.DeepEqual(conn.args[0], []any{cohortID}) {
+		t.Errorf("args = %v, expected [%v]", conn.args[0], cohortID)
+	}
+}
+
+func TestMembershipRepository_MembershipTTL(t *testing.T) {
+	cohortID := uuid.New()
+	ttl := 7 * 24 * time.Hour
+
+	t.Run("expired members are excluded", func(t *testing.T) {
+		conn := &fakeConn{userIDs: []string{"user-1"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		before := time.Now().UTC().Add(-ttl)
+		if _, _, err := repo.GetCohortMembers(context.Background(), cohortID, 10, 0, ttl, false, ""); err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if _, err := repo.GetByCohortAndUser(context.Background(), cohortID, "user-1", ttl); err != nil {
+			t.Fatalf("GetByCohortAndUser() error = %v", err)
+		}
+		after := time.Now().UTC().Add(-ttl)
+
+		if len(conn.queries) != 3 {
+			t.Fatalf("queries = %d, expected count, page and lookup", len(conn.queries))
+		}
+		for i, q := range conn.queries {
+			if !strings.Contains(q, "AND maxIf(joined_at, sign > 0) > ?") {
+				t.Errorf("query %d should filter expired members, got %q", i, q)
+			}
+		}
+		cutoffs := []any{conn.args[0][1], conn.args[1][1], conn.args[2][2]}
+		for _, c := range cutoffs {
+			cutoff, ok := c.(time.Time)
+			if !ok || cutoff.Before(before) || cutoff.After(after) {
+				t.Errorf("cutoff = %v, expected now minus %v", c, ttl)
+			}
+		}
+		if n := len(conn.args[1]); n != 4 || conn.args[1][2] != 10 || conn.args[1][3] != 0 {
+			t.Errorf("page args = %v, expected the cutoff before pagination", conn.args[1])
+		}
+	})
+
+	t.Run("zero TTL keeps every member", func(t *testing.T) {
+		conn := &fakeConn{}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		if _, _, err := repo.GetCohortMembers(context.Background(), cohortID, 10, 0, 0, false, ""); err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		for _, q := range conn.queries {
+			if strings.Contains(q, "maxIf") {
+				t.Errorf("query should not filter by join time, got %q", q)
+			}
+		}
+		if !reflect.DeepEqual(conn.args[0], []any{cohortID}) {
+			t.Errorf("count args = %v, expected [%v]", conn.args[0], cohortID)
+		}
+	})
+}
+
+func TestMembershipRepository_GetCohortMembers_LastActive(t *testing.T) {
+	cohortID := uuid.New()
+
+	t.Run("skipped by default", func(t *testing.T) {
+		conn := &fakeConn{total: 2, userIDs: []string{"user-1", "user-2"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		members, _, err := repo.GetCohortMembers(context.Background(), cohortID, 10, 0, 0, false, "")
+		if err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if len(conn.queries) != 2 {
+			t.Errorf("queries = %d, expected count and page only", len(conn.queries))
+		}
+		for _, q := range conn.queries {
+			if strings.Contains(q, "events_raw") {
+				t.Errorf("query should not read events, got %q", q)
+			}
+		}
+		for _, m := range members {
+			if m.LastActiveAt != nil {
+				t.Errorf("LastActiveAt = %v for %s, expected nil", m.LastActiveAt, m.UserID)
+			}
+		}
+	})
+
+	t.Run("looks up the page's latest events when requested", func(t *testing.T) {
+		conn := &fakeConn{total: 2, userIDs: []string{"user-1", "user-2"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		members, _, err := repo.GetCohortMembers(context.Background(), cohortID, 10, 0, 0, true, "")
+		if err != nil {
+			t.Fatalf("GetCohortMembers() error = %v", err)
+		}
+		if len(conn.queries) != 3 {
+			t.Fatalf("queries = %d, expected count, page and last activity", len(conn.queries))
+		}
+
+		query := conn.queries[2]
+		for _, fragment := range []string{"max(timestamp) AS last_active_at", "FROM events_raw", "WHERE user_id IN ?", "GROUP BY user_id"} {
+			if !strings.Contains(query, fragment) {
+				t.Errorf("query missing %q: %s", fragment, query)
+			}
+		}
+		expectedArgs := []any{[]string{"user-1", "user-2"}}
+		if !reflect.DeepEqual(conn.args[2], expectedArgs) {
+			t.Errorf("args = %v, expected %v", conn.args[2], expectedArgs)
+		}
+		for _, m := range members {
+			if m.LastActiveAt == nil {
+				t.Errorf("LastActiveAt = nil for %s, expected the latest event time", m.UserID)
+			}
+		}
+	})
+}
+
+func TestMembershipRepository_ReplacingModel(t *testing.T) {
+	cohortID := uuid.New()
+	ctx := context.Background()
+
+	conn := &fakeConn{total: 1, userIDs: []string{"user-1"}}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+	repo.SetMembershipModel(config.MembershipModelReplacing)
+
+	m, err := repo.GetByCohortAndUser(ctx, cohortID, "user-1", time.Hour)
+	if err != nil {
+		t.Fatalf("GetByCohortAndUser() error = %v", err)
+	}
+	if !m.IsMember {
+		t.Error("IsMember = false, expected true for a returned row")
+	}
+	if _, err := repo.IsMember(ctx, cohortID, "user-1"); err != nil {
+		t.Fatalf("IsMember() error = %v", err)
+	}
+	if _, _, err := repo.GetCohortMembers(ctx, cohortID, 10, 0, 0, false, ""); err != nil {
+		t.Fatalf("GetCohortMembers() error = %v", err)
+	}
+	if _, err := repo.GetCohortMemberCount(ctx, cohortID); err != nil {
+		t.Fatalf("GetCohortMemberCount() error = %v", err)
+	}
+	if _, _, err := repo.GetUsersInAllCohorts(ctx, []uuid.UUID{cohortID, uuid.New()}, 10, 0); err != nil {
+		t.Fatalf("GetUsersInAllCohorts() error = %v", err)
+	}
+	if _, _, err := repo.GetUsersInNoCohorts(ctx, []uuid.UUID{cohortID}, []uuid.UUID{cohortID, uuid.New()}, 10, 0); err != nil {
+		t.Fatalf("GetUsersInNoCohorts() error = %v", err)
+	}
+	if err := repo.ForEachCohortMember(ctx, cohortID, func(string) error { return nil }); err != nil {
+		t.Fatalf("ForEachCohortMember() error = %v", err)
+	}
+
+	// fakeRows only scans user IDs, so look up cohorts on a connection without rows
+	cohortsConn := &fakeConn{}
+	cohortsRepo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(cohortsConn))
+	cohortsRepo.SetMembershipModel(config.MembershipModelReplacing)
+	if _, err := cohortsRepo.GetUserCohorts(ctx, "user-1"); err != nil {
+		t.Fatalf("GetUserCohorts() error = %v", err)
+	}
+	queries := append(conn.queries, cohortsConn.queries...)
+
+	t.Run("reads the latest status by version", func(t *testing.T) {
+		for i, q := range queries {
+			if !strings.Contains(q, "FROM cohort_membership_state") || !strings.Contains(q, "argMax(status, version) > 0") {
+				t.Errorf("query %d should read the latest status, got %q", i, q)
+			}
+			if strings.Contains(q, "sign") || strings.Contains(q, "cohort_membership_current") {
+				t.Errorf("query %d should not sum signs, got %q", i, q)
+			}
+		}
+	})
+
+	t.Run("expires members by their latest join", func(t *testing.T) {
+		if !strings.Contains(conn.queries[0], "AND argMax(joined_at, version) > ?") {
+			t.Errorf("lookup should filter expired members, got %q", conn.queries[0])
+		}
+		if len(conn.args[0]) != 3 {
+			t.Errorf("lookup args = %v, expected cohort, user and cutoff", conn.args[0])
+		}
+	})
+
+	t.Run("cancellations are still written to the collapsing table", func(t *testing.T) {
+		conn := &fakeConn{}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+		repo.SetMembershipModel(config.MembershipModelReplacing)
+
+		if err := repo.DeleteCohortMemberships(ctx, cohortID); err != nil {
+			t.Fatalf("DeleteCohortMemberships() error = %v", err)
+		}
+		q := conn.queries[0]
+		if !strings.Contains(q, "INSERT INTO cohort_membership_current") ||
+			!strings.Contains(q, "FROM cohort_membership_state") ||
+			!strings.Contains(q, "HAVING argMax(status, version) > 0") {
+			t.Errorf("query should cancel members found in the state table, got %q", q)
+		}
+	})
+}
+
+func TestMembershipRepository_CountMembersByProperty(t *testing.T) {
+	cohortID := uuid.New()
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	counts, err := repo.CountMembersByProperty(context.Background(), cohortID, "country", 25)
+	if err != nil {
+		t.Fatalf("CountMembersByProperty() error = %v", err)
+	}
+	if counts == nil || len(counts) != 0 {
+		t.Errorf("counts = %v, expected empty slice", counts)
+	}
+	if len(conn.queries) != 1 {
+		t.Fatalf("queries = %d, expected 1", len(conn.queries))
+	}
+
+	query := conn.queries[0]
+	for _, fragment := range []string{
+		"LEFT JOIN",
+		"argMax(",
+		"FROM events_raw",
+		"ON e.user_id = m.user_id",
+		"GROUP BY value",
+		"ORDER BY members DESC",
+	} {
+		if !strings.Contains(query, fragment) {
+			t.Errorf("query missing %q: %s", fragment, query)
+		}
+	}
+	if n := strings.Count(query, "WHERE cohort_id = ?"); n != 2 {
+		t.Errorf("cohort filters = %d, expected 2 (members and their events)", n)
+	}
+
+	expectedArgs := []any{cohortID, "country", "country", "country", cohortID, 25}
+	if !reflect.DeepEqual(conn.args[0], expectedArgs) {
+		t.Errorf("args = %v, expected %v", conn.args[0], expectedArgs)
+	}
+}
+
+func TestMembershipRepository_CountMembersByPropertyRange(t *testing.T) {
+	cohortID := uuid.New()
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	counts, err := repo.CountMembersByPropertyRange(context.Background(), cohortID, "ltv", []float64{0, 100, 1000})
+	if err != nil {
+		t.Fatalf("CountMembersByPropertyRange() error = %v", err)
+	}
+	if counts == nil || len(counts) != 0 {
+		t.Errorf("counts = %v, expected empty slice", counts)
+	}
+	if len(conn.queries) != 1 {
+		t.Fatalf("queries = %d, expected 1", len(conn.queries))
+	}
+
+	query := conn.queries[0]
+	for _, fragment := range []string{
+		"multiIf(e.value IS NULL, -1, e.value < ?, 0, e.value < ?, 1, e.value < ?, 2, 3)",
+		"LEFT JOIN",
+		"argMax(JSONExtract(properties, ?, 'Nullable(Float64)'), timestamp)",
+		"ON e.user_id = m.user_id",
+		"GROUP BY bucket",
+		"join_use_nulls = 1",
+	} {
+		if !strings.Contains(query, fragment) {
+			t.Errorf("query missing %q: %s", fragment, query)
+		}
+	}
+	if n := strings.Count(query, "WHERE cohort_id = ?"); n != 2 {
+		t.Errorf("cohort filters = %d, expected 2 (members and their events)", n)
+	}
+
+	expectedArgs := []any{float64(0), float64(100), float64(1000), cohortID, "ltv", cohortID}
+	if !reflect.DeepEqual(conn.args[0], expectedArgs) {
+		t.Errorf("args = %v, expected %v", conn.args[0], expectedArgs)
+	}
+}
+
+func TestMembershipRepository_GetMembersInCohorts(t *testing.T) {
+	cohortIDs := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	t.Run("intersect keeps users in every cohort", func(t *testing.T) {
+		conn := &fakeConn{total: 2, userIDs: []string{"user-1", "user-2"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		userIDs, total, err := repo.GetMembersInCohorts(context.Background(), cohortIDs, true, 10, 20)
+		if err != nil {
+			t.Fatalf("GetMembersInCohorts() error = %v", err)
+		}
+		if total != 2 {
+			t.Errorf("total = %v, expected 2", total)
+		}
+		if !reflect.DeepEqual(userIDs, []string{"user-1", "user-2"}) {
+			t.Errorf("userIDs = %v, expected [user-1 user-2]", userIDs)
+		}
+		for _, q := range conn.queries {
+			for _, fragment := range []string{"WHERE cohort_id IN ?", "GROUP BY cohort_id, user_id", "GROUP BY user_id", "HAVING count(DISTINCT cohort_id) = ?"} {
+				if !strings.Contains(q, fragment) {
+					t.Errorf("query = %s, expected it to contain %q", q, fragment)
+				}
+			}
+		}
+		if expected := []any{cohortIDs, 3}; !reflect.DeepEqual(conn.args[0], expected) {
+			t.Errorf("count args = %v, expected %v", conn.args[0], expected)
+		}
+		if expected := []any{cohortIDs, 3, 10, 20}; !reflect.DeepEqual(conn.args[1], expected) {
+			t.Errorf("page args = %v, expected %v", conn.args[1], expected)
+		}
+	})
+
+	t.Run("union keeps users in any cohort", func(t *testing.T) {
+		conn := &fakeConn{total: 1, userIDs: []string{"user-3"}}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		userIDs, _, err := repo.GetMembersInCohorts(context.Background(), cohortIDs, false, 100, 0)
+		if err != nil {
+			t.Fatalf("GetMembersInCohorts() error = %v", err)
+		}
+		if !reflect.DeepEqual(userIDs, []string{"user-3"}) {
+			t.Errorf("userIDs = %v, expected [user-3]", userIDs)
+		}
+		for _, q := range conn.queries {
+			if !strings.Contains(q, "HAVING count(DISTINCT cohort_id) > 0") {
+				t.Errorf("query = %s, expected a union over the cohorts", q)
+			}
+		}
+		if expected := []any{cohortIDs, 100, 0}; !reflect.DeepEqual(conn.args[1], expected) {
+			t.Errorf("page args = %v, expected %v", conn.args[1], expected)
+		}
+	})
+}
+
+func TestMembershipRepository_GetSharedCohorts(t *testing.T) {
+	shared := uuid.New()
+	conn := &fakeConn{userIDs: []string{shared.String()}}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	userIDs := []string{"user-1", "user-2", "user-3"}
+	cohortIDs, err := repo.GetSharedCohorts(context.Background(), userIDs)
+	if err != nil {
+		t.Fatalf("GetSharedCohorts() error = %v", err)
+	}
+	if !reflect.DeepEqual(cohortIDs, []uuid.UUID{shared}) {
+		t.Errorf("cohortIDs = %v, expected [%v]", cohortIDs, shared)
+	}
+
+	query := conn.queries[0]
+	// Each user's current memberships, kept for cohorts where all users are members
+	for _, fragment := range []string{"WHERE user_id IN ?", "GROUP BY cohort_id, user_id", "HAVING sum(sign) > 0", "HAVING count() = ?"} {
+		if !strings.Contains(query, fragment) {
+			t.Errorf("query = %s, expected it to contain %q", query, fragment)
+		}
+	}
+	if expected := []any{userIDs, 3}; !reflect.DeepEqual(conn.args[0], expected) {
+		t.Errorf("args = %v, expected %v", conn.args[0], expected)
+	}
+}
+
+func TestMembershipRepository_WasMemberAt(t *testing.T) {
+	cohortID := uuid.New()
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("starts from the nearest snapshot and replays the changelog after it", func(t *testing.T) {
+		snapshotAt := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+		// In the snapshot, then left before at
+		conn := &fakeConn{total: 1, at: snapshotAt, status: -1}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		isMember, err := repo.WasMemberAt(context.Background(), cohortID, "user-1", at)
+		if err != nil {
+			t.Fatalf("WasMemberAt() error = %v", err)
+		}
+		if isMember {
+			t.Error("isMember = true, expected the later leave to override the snapshot")
+		}
+		if len(conn.queries) != 3 {
+			t.Fatalf("queries = %d, expected 3", len(conn.queries))
+		}
+
+		if !strings.Contains(conn.queries[0], "max(snapshot_at)") || !strings.Contains(conn.queries[0], "snapshot_at <= ?") {
+			t.Errorf("nearest snapshot query = %s", conn.queries[0])
+		}
+		if expected := []any{cohortID, at}; !reflect.DeepEqual(conn.args[0], expected) {
+			t.Errorf("nearest snapshot args = %v, expected %v", conn.args[0], expected)
+		}
+
+		if !strings.Contains(conn.queries[1], "FROM cohort_membership_snapshots") {
+			t.Errorf("snapshot membership query = %s", conn.queries[1])
+		}
+		if expected := []any{cohortID, snapshotAt, "user-1"}; !reflect.DeepEqual(conn.args[1], expected) {
+			t.Errorf("snapshot membership args = %v, expected %v", conn.args[1], expected)
+		}
+
+		if !strings.Contains(conn.queries[2], "FROM cohort_membership_changelog") || !strings.Contains(conn.queries[2], "changed_at > ? AND changed_at <= ?") {
+			t.Errorf("changelog query = %s", conn.queries[2])
+		}
+		if expected := []any{cohortID, "user-1", snapshotAt, at}; !reflect.DeepEqual(conn.args[2], expected) {
+			t.Errorf("changelog args = %v, expected only changes since the snapshot %v", conn.args[2], expected)
+		}
+	})
+
+	t.Run("applies a rejoin after the snapshot", func(t *testing.T) {
+		conn := &fakeConn{total: 1, at: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), status: 1}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		isMember, err := repo.WasMemberAt(context.Background(), cohortID, "user-1", at)
+		if err != nil {
+			t.Fatalf("WasMemberAt() error = %v", err)
+		}
+		if !isMember {
+			t.Error("isMember = false, expected true")
+		}
+	})
+
+	t.Run("replays the whole changelog without a snapshot", func(t *testing.T) {
+		// max() over no snapshots is the epoch
+		conn := &fakeConn{total: 1, at: time.Unix(0, 0).UTC(), status: 1}
+		repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+		isMember, err := repo.WasMemberAt(context.Background(), cohortID, "user-1", at)
+		if err != nil {
+			t.Fatalf("WasMemberAt() error = %v", err)
+		}
+		if !isMember {
+			t.Error("isMember = false, expected true from the changelog")
+		}
+		if len(conn.queries) != 2 {
+			t.Fatalf("queries = %d, expected 2 (no snapshot lookup)", len(conn.queries))
+		}
+		if !strings.Contains(conn.queries[1], "FROM cohort_membership_changelog") {
+			t.Errorf("second query = %s, expected the changelog", conn.queries[1])
+		}
+	})
+}
+
+func TestMembershipRepository_GetCohortMembersAt(t *testing.T) {
+	cohortID := uuid.New()
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	snapshotAt := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	conn := &fakeConn{total: 2, at: snapshotAt, userIDs: []string{"user-1", "user-2"}}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	userIDs, total, err := repo.GetCohortMembersAt(context.Background(), cohortID, at, 10, 0)
+	if err != nil {
+		t.Fatalf("GetCohortMembersAt() error = %v", err)
+	}
+	if !reflect.DeepEqual(userIDs, []string{"user-1", "user-2"}) || total != 2 {
+		t.Errorf("members = %v (total %d), expected [user-1 user-2] (total 2)", userIDs, total)
+	}
+	if len(conn.queries) != 3 {
+		t.Fatalf("queries = %d, expected 3", len(conn.queries))
+	}
+
+	if !strings.Contains(conn.queries[0], "max(snapshot_at)") || !reflect.DeepEqual(conn.args[0], []any{cohortID, at}) {
+		t.Errorf("nearest snapshot query = %s with args %v", conn.queries[0], conn.args[0])
+	}
+
+	// Both the count and the page start from the nearest snapshot and replay
+	// the changelog after it
+	expected := []any{cohortID, snapshotAt, cohortID, snapshotAt, at}
+	for i, query := range conn.queries[1:] {
+		if !strings.Contains(query, "FROM cohort_membership_snapshots") || !strings.Contains(query, "FROM cohort_membership_changelog") {
+			t.Errorf("query %d = %s, expected the snapshot and the changelog", i+1, query)
+		}
+		if !reflect.DeepEqual(conn.args[i+1][:len(expected)], expected) {
+			t.Errorf("query %d args = %v, expected %v", i+1, conn.args[i+1], expected)
+		}
+	}
+	if !strings.Contains(conn.queries[2], "LIMIT ? OFFSET ?") {
+		t.Errorf("page query = %s, expected LIMIT and OFFSET", conn.queries[2])
+	}
+}
+
+func TestMembershipRepository_SnapshotMembership(t *testing.T) {
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	at := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	if err := repo.SnapshotMembership(context.Background(), at); err != nil {
+		t.Fatalf("SnapshotMembership() error = %v", err)
+	}
+	if len(conn.queries) != 1 {
+		t.Fatalf("queries = %d, expected 1", len(conn.queries))
+	}
+	if !strings.Contains(conn.queries[0], "INSERT INTO cohort_membership_snapshots") || !strings.Contains(conn.queries[0], "FROM cohort_membership_current") {
+		t.Errorf("query = %s, expected a copy of current membership", conn.queries[0])
+	}
+	if !reflect.DeepEqual(conn.args[0], []any{at}) {
+		t.Errorf("args = %v, expected [%v]", conn.args[0], at)
+	}
+}
+
+func TestMembershipRepository_OptimizeMembershipPartition(t *testing.T) {
+	cohortID := uuid.New()
+	conn := &fakeConn{userIDs: []string{"all"}}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	partitions, err := repo.MembershipPartitions(context.Background(), cohortID)
+	if err != nil {
+		t.Fatalf("MembershipPartitions() error = %v", err)
+	}
+	if !reflect.DeepEqual(partitions, []string{"all"}) {
+		t.Errorf("partitions = %v, expected [all]", partitions)
+	}
+	if !strings.Contains(conn.queries[0], "SELECT DISTINCT _partition_id") || !reflect.DeepEqual(conn.args[0], []any{cohortID}) {
+		t.Errorf("query = %s with args %v, expected the cohort's partitions", conn.queries[0], conn.args[0])
+	}
+
+	if err := repo.OptimizeMembershipPartition(context.Background(), "all"); err != nil {
+		t.Fatalf("OptimizeMembershipPartition() error = %v", err)
+	}
+	if expected := "OPTIMIZE TABLE cohort_membership_current PARTITION ID ? FINAL"; conn.queries[1] != expected {
+		t.Errorf("query = %q, expected %q", conn.queries[1], expected)
+	}
+	if !reflect.DeepEqual(conn.args[1], []any{"all"}) {
+		t.Errorf("args = %v, expected [all]", conn.args[1])
+	}
+}
+
+func TestMembershipRepository_GetRawMembership(t *testing.T) {
+	cohortID := uuid.New()
+	conn := &fakeConn{}
+	repo := clickhouse.NewMembershipRepository(clickhouse.NewClientWithConn(conn))
+
+	raw, err := repo.GetRawMembership(context.Background(), cohortID, "user-1")
+	if err != nil {
+		t.Fatalf("GetRawMembership() error = %v", err)
+	}
+	if len(conn.queries) != 2 {
+		t.Fatalf("queries = %d, expected 2", len(conn.queries))
+	}
+	if q := conn.queries[0]; !strings.Contains(q, "SELECT sign, joined_at, updated_at, variant, _part") || !strings.Contains(q, "FROM cohort_membership_current") || strings.Contains(q, "GROUP BY") {
+		t.Errorf("query = %s, expected the current membership rows unaggregated", q)
+	}
+	if q := conn.queries[1]; !strings.Contains(q, "SELECT status, joined_at, version, _part") || !strings.Contains(q, "FROM cohort_membership_state") {
+		t.Errorf("query = %s, expected the membership state rows", q)
+	}
+	for i, args := range conn.args {
+		if !reflect.DeepEqual(args, []any{cohortID, "user-1"}) {
+			t.Errorf("query %d args = %v, expected [%v user-1]", i, args, cohortID)
+		}
+	}
+	if raw.SignSum != 0 || raw.Rows == nil || raw.StateRows == nil {
+		t.Errorf("GetRawMembership() = %+v, expected empty rows", raw)
+	}
+}
@@ -0,0 +1,82 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// ProjectDatabase returns the database holding a project's tables when
+// project isolation is enabled
+func ProjectDatabase(projectID uuid.UUID) string {
+	return "cohort_" + strings.ReplaceAll(projectID.String(), "-", "")
+}
+
+// ProjectConnector opens a connection whose default database is database
+type ProjectConnector func(database string) (driver.Conn, error)
+
+// SetProjectIsolation routes queries made for a project, as carried by
+// tenant.WithProject, to that project's database. Queries without a project
+// keep using the shared database.
+func (c *Client) SetProjectIsolation(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.isolated = enabled
+}
+
+// SetProjectConnector replaces how connections to project databases are opened
+func (c *Client) SetProjectConnector(connect ProjectConnector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connect = connect
+}
+
+// connFor returns the connection queries made with ctx run on: the project's
+// own when isolation is enabled and ctx acts for a project, otherwise the
+// shared one. A project's connection is dialed without holding c.mu, so a
+// slow dial doesn't stall queries for other projects; when two dials race,
+// the first stored wins and the other connection is closed.
+func (c *Client) connFor(ctx context.Context) (driver.Conn, error) {
+	projectID, ok := tenant.ProjectFromContext(ctx)
+	c.mu.Lock()
+	if !c.isolated || !ok {
+		c.mu.Unlock()
+		return c.conn, nil
+	}
+	if conn, ok := c.projectConns[projectID]; ok {
+		c.mu.Unlock()
+		return conn, nil
+	}
+	connect := c.connect
+	c.mu.Unlock()
+
+	if connect == nil {
+		return nil, fmt.Errorf("no connector for project database %s", ProjectDatabase(projectID))
+	}
+	conn, err := connect(ProjectDatabase(projectID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to project database %s: %w", ProjectDatabase(projectID), err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.projectConns[projectID]; ok {
+		conn.Close()
+		return existing, nil
+	}
+	c.projectConns[projectID] = conn
+	return conn, nil
+}
+
+// errRow is a row whose query could not be run
+type errRow struct {
+	err error
+}
+
+func (r errRow) Err() error                { return r.err }
+func (r errRow) Scan(dest ...any) error    { return r.err }
+func (r errRow) ScanStruct(dest any) error { return r.err }
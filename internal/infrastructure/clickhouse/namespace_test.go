@@ -0,0 +1,229 @@
+package clickhouse_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+func TestProjectDatabase(t *testing.T) {
+	projectID := uuid.MustParse("0b9f3c2e-5a1d-4e8f-9c7b-2d6a4f1e8b3c")
+
+	if got := clickhouse.ProjectDatabase(projectID); got != "cohort_0b9f3c2e5a1d4e8f9c7b2d6a4f1e8b3c" {
+		t.Errorf("ProjectDatabase() = %v, expected cohort_0b9f3c2e5a1d4e8f9c7b2d6a4f1e8b3c", got)
+	}
+}
+
+func TestClient_ProjectIsolation(t *testing.T) {
+	projectID := uuid.New()
+
+	// setup returns a client whose project connections are recorded by database
+	setup := func(isolated bool) (*clickhouse.Client, *fakeConn, map[string]*fakeConn) {
+		shared := &fakeConn{}
+		opened := make(map[string]*fakeConn)
+		client := clickhouse.NewClientWithConn(shared)
+		client.SetProjectIsolation(isolated)
+		client.SetProjectConnector(func(database string) (driver.Conn, error) {
+			conn := &fakeConn{}
+			opened[database] = conn
+			return conn, nil
+		})
+		return client, shared, opened
+	}
+
+	t.Run("queries for a project target its database", func(t *testing.T) {
+		client, shared, opened := setup(true)
+		ctx := tenant.WithProject(context.Background(), projectID)
+
+		if err := clickhouse.NewEventRepository(client).DeleteUserEvents(ctx, projectID, "user-1"); err != nil {
+			t.Fatalf("DeleteUserEvents() error = %v", err)
+		}
+		if _, _, err := clickhouse.NewMembershipRepository(client).GetUsersInAllCohorts(ctx, []uuid.UUID{uuid.New()}, 10, 0); err != nil {
+			t.Fatalf("GetUsersInAllCohorts() error = %v", err)
+		}
+
+		if len(opened) != 1 {
+			t.Fatalf("opened %d project connections, expected 1", len(opened))
+		}
+		conn, ok := opened[clickhouse.ProjectDatabase(projectID)]
+		if !ok {
+			t.Fatalf("opened %v, expected %s", opened, clickhouse.ProjectDatabase(projectID))
+		}
+		if len(conn.queries) != 3 {
+			t.Errorf("project queries = %d, expected 3", len(conn.queries))
+		}
+		if len(shared.queries) != 0 {
+			t.Errorf("shared queries = %d, expected 0", len(shared.queries))
+		}
+	})
+
+	t.Run("queries without a project use the shared database", func(t *testing.T) {
+		client, shared, opened := setup(true)
+
+		if err := clickhouse.NewEventRepository(client).DeleteUserEvents(context.Background(), projectID, "user-1"); err != nil {
+			t.Fatalf("DeleteUserEvents() error = %v", err)
+		}
+		if len(opened) != 0 {
+			t.Errorf("opened %d project connections, expected 0", len(opened))
+		}
+		if len(shared.queries) != 1 {
+			t.Errorf("shared queries = %d, expected 1", len(shared.queries))
+		}
+	})
+
+	t.Run("disabled isolation ignores the project", func(t *testing.T) {
+		client, shared, opened := setup(false)
+		ctx := tenant.WithProject(context.Background(), projectID)
+
+		if err := clickhouse.NewEventRepository(client).DeleteUserEvents(ctx, projectID, "user-1"); err != nil {
+			t.Fatalf("DeleteUserEvents() error = %v", err)
+		}
+		if len(opened) != 0 {
+			t.Errorf("opened %d project connections, expected 0", len(opened))
+		}
+		if len(shared.queries) != 1 {
+			t.Errorf("shared queries = %d, expected 1", len(shared.queries))
+		}
+	})
+
+	t.Run("connection failure returns error", func(t *testing.T) {
+		client := clickhouse.NewClientWithConn(&fakeConn{})
+		client.SetProjectIsolation(true)
+		client.SetProjectConnector(func(database string) (driver.Conn, error) {
+			return nil, errors.New("unknown database")
+		})
+		ctx := tenant.WithProject(context.Background(), projectID)
+
+		if err := clickhouse.NewEventRepository(client).DeleteUserEvents(ctx, projectID, "user-1"); err == nil {
+			t.Error("DeleteUserEvents() expected error when the project database is unreachable")
+		}
+	})
+}
+
+// countingConn counts the statements run on it and whether it was closed,
+// safely across goroutines
+type countingConn struct {
+	driver.Conn
+	mu     sync.Mutex
+	execs  int
+	closed bool
+}
+
+func (c *countingConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execs++
+	return nil
+}
+
+func (c *countingConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestClient_ProjectConnectionDial(t *testing.T) {
+	t.Run("a slow dial doesn't block other projects", func(t *testing.T) {
+		slow, fast := uuid.New(), uuid.New()
+		release := make(chan struct{})
+		dialing := make(chan struct{})
+
+		client := clickhouse.NewClientWithConn(&countingConn{})
+		client.SetProjectIsolation(true)
+		client.SetProjectConnector(func(database string) (driver.Conn, error) {
+			if database == clickhouse.ProjectDatabase(slow) {
+				close(dialing)
+				<-release
+			}
+			return &countingConn{}, nil
+		})
+		repo := clickhouse.NewEventRepository(client)
+
+		slowDone := make(chan error, 1)
+		go func() {
+			slowDone <- repo.DeleteUserEvents(tenant.WithProject(context.Background(), slow), slow, "user-1")
+		}()
+		<-dialing
+
+		fastDone := make(chan error, 1)
+		go func() {
+			fastDone <- repo.DeleteUserEvents(tenant.WithProject(context.Background(), fast), fast, "user-1")
+		}()
+		select {
+		case err := <-fastDone:
+			if err != nil {
+				t.Errorf("DeleteUserEvents() error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("query for another project waited for the slow dial")
+		}
+
+		close(release)
+		if err := <-slowDone; err != nil {
+			t.Errorf("DeleteUserEvents() error = %v", err)
+		}
+	})
+
+	t.Run("racing dials keep one connection", func(t *testing.T) {
+		projectID := uuid.New()
+		var mu sync.Mutex
+		var opened []*countingConn
+		bothDialing := make(chan struct{})
+
+		client := clickhouse.NewClientWithConn(&countingConn{})
+		client.SetProjectIsolation(true)
+		client.SetProjectConnector(func(database string) (driver.Conn, error) {
+			conn := &countingConn{}
+			mu.Lock()
+			opened = append(opened, conn)
+			if len(opened) == 2 {
+				close(bothDialing)
+			}
+			mu.Unlock()
+			<-bothDialing
+			return conn, nil
+		})
+		repo := clickhouse.NewEventRepository(client)
+		ctx := tenant.WithProject(context.Background(), projectID)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := repo.DeleteUserEvents(ctx, projectID, "user-1"); err != nil {
+					t.Errorf("DeleteUserEvents() error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		var kept, closed int
+		for _, conn := range opened {
+			conn.mu.Lock()
+			if conn.closed {
+				closed++
+				if conn.execs != 0 {
+					t.Errorf("closed connection ran %d statements, expected 0", conn.execs)
+				}
+			} else {
+				kept++
+				if conn.execs != 2 {
+					t.Errorf("kept connection ran %d statements, expected 2", conn.execs)
+				}
+			}
+			conn.mu.Unlock()
+		}
+		if kept != 1 || closed != 1 {
+			t.Errorf("kept %d and closed %d connections, expected 1 of each", kept, closed)
+		}
+	})
+}
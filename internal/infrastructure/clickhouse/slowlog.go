@@ -0,0 +1,37 @@
+package clickhouse
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// SetSlowQueryThreshold logs each read that takes longer than threshold,
+// with the project and cohort it ran for. 0 disables the slow query log.
+func (c *Client) SetSlowQueryThreshold(threshold time.Duration) {
+	c.slowQueryThreshold = threshold
+}
+
+// logIfSlow logs query when it has run longer than the slow query threshold
+func (c *Client) logIfSlow(ctx context.Context, query string, start time.Time) {
+	if c.slowQueryThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed <= c.slowQueryThreshold {
+		return
+	}
+
+	project, cohort := "-", "-"
+	if projectID, ok := tenant.ProjectFromContext(ctx); ok {
+		project = projectID.String()
+	}
+	if cohortID, ok := tenant.CohortFromContext(ctx); ok {
+		cohort = cohortID.String()
+	}
+	log.Printf("slow clickhouse query: elapsed=%s threshold=%s project=%s cohort=%s query=%q",
+		elapsed, c.slowQueryThreshold, project, cohort, strings.Join(strings.Fields(query), " "))
+}
@@ -0,0 +1,80 @@
+package clickhouse_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/tenant"
+)
+
+// slowConn takes delay to answer each read
+type slowConn struct {
+	fakeConn
+	delay time.Duration
+}
+
+func (c *slowConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	time.Sleep(c.delay)
+	return c.fakeConn.Query(ctx, query, args...)
+}
+
+func (c *slowConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	time.Sleep(c.delay)
+	return c.fakeConn.QueryRow(ctx, query, args...)
+}
+
+func TestClient_SlowQueryLog(t *testing.T) {
+	projectID := uuid.New()
+	cohortID := uuid.New()
+	ctx := tenant.WithCohort(tenant.WithProject(context.Background(), projectID), cohortID)
+
+	// run counts cohortID's members on a connection taking delay and returns the log
+	run := func(delay, threshold time.Duration) string {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		client := clickhouse.NewClientWithConn(&slowConn{delay: delay})
+		client.SetSlowQueryThreshold(threshold)
+		if _, err := clickhouse.NewMembershipRepository(client).GetCohortMemberCount(ctx, cohortID); err != nil {
+			t.Fatalf("GetCohortMemberCount() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	t.Run("logs reads over the threshold", func(t *testing.T) {
+		out := run(20*time.Millisecond, 5*time.Millisecond)
+
+		for _, want := range []string{
+			"slow clickhouse query:",
+			"threshold=5ms",
+			"project=" + projectID.String(),
+			"cohort=" + cohortID.String(),
+			"cohort_membership",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("log = %q, expected it to contain %q", out, want)
+			}
+		}
+	})
+
+	t.Run("fast reads are not logged", func(t *testing.T) {
+		if out := run(0, time.Second); strings.Contains(out, "slow clickhouse query") {
+			t.Errorf("log = %q, expected no slow query entry", out)
+		}
+	})
+
+	t.Run("zero threshold disables the log", func(t *testing.T) {
+		if out := run(20*time.Millisecond, 0); strings.Contains(out, "slow clickhouse query") {
+			t.Errorf("log = %q, expected no slow query entry", out)
+		}
+	})
+}
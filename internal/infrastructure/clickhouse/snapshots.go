@@ -0,0 +1,100 @@
+package clickhouse
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnapshotMembership copies every cohort's current members into
+// cohort_membership_snapshots, stamped with at
+func (r *MembershipRepository) SnapshotMembership(ctx context.Context, at time.Time) error {
+	return r.client.Exec(ctx, `
+		INSERT INTO cohort_membership_snapshots (snapshot_at, cohort_id, user_id, joined_at)
+		SELECT ?, cohort_id, user_id, `+r.reads.joinedAt+`
+		FROM `+r.reads.table+`
+		GROUP BY cohort_id, user_id
+		HAVING `+r.reads.isMember+`
+	`, at)
+}
+
+// WasMemberAt reports whether a user was a member of a cohort at a point in
+// time. It starts from the cohort's latest snapshot at or before at and
+// applies the user's last changelog entry between the snapshot and at. Without
+// a snapshot the whole changelog is replayed.
+func (r *MembershipRepository) WasMemberAt(ctx context.Context, cohortID uuid.UUID, userID string, at time.Time) (bool, error) {
+	snapshotAt, err := r.nearestSnapshot(ctx, cohortID, at)
+	if err != nil {
+		return false, err
+	}
+
+	isMember := false
+	if snapshotAt.After(time.Unix(0, 0)) {
+		var inSnapshot uint64
+		if err := r.client.QueryRow(ctx, `
+			SELECT count()
+			FROM cohort_membership_snapshots
+			WHERE cohort_id = ? AND snapshot_at = ? AND user_id = ?
+		`, cohortID, snapshotAt, userID).Scan(&inSnapshot); err != nil {
+			return false, err
+		}
+		isMember = inSnapshot > 0
+	}
+
+	var changes uint64
+	var status int8
+	if err := r.client.QueryRow(ctx, `
+		SELECT count(), argMax(new_status, changed_at)
+		FROM cohort_membership_changelog
+		WHERE cohort_id = ? AND user_id = ? AND changed_at > ? AND changed_at <= ?
+	`, cohortID, userID, snapshotAt, at).Scan(&changes, &status); err != nil {
+		return false, err
+	}
+	if changes > 0 {
+		isMember = status > 0
+	}
+
+	return isMember, nil
+}
+
+// GetCohortMembersAt returns a page of the users who were members of a cohort
+// at a point in time, and how many there were. Like WasMemberAt it starts from
+// the cohort's latest snapshot at or before at and applies each user's last
+// changelog entry between the snapshot and at.
+func (r *MembershipRepository) GetCohortMembersAt(ctx context.Context, cohortID uuid.UUID, at time.Time, limit, offset int) ([]string, int64, error) {
+	snapshotAt, err := r.nearestSnapshot(ctx, cohortID, at)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Snapshot rows count as joins at the snapshot so any later change wins
+	query := `
+		SELECT user_id
+		FROM (
+			SELECT user_id, toInt8(1) AS status, snapshot_at AS changed_at
+			FROM cohort_membership_snapshots
+			WHERE cohort_id = ? AND snapshot_at = ?
+			UNION ALL
+			SELECT user_id, new_status AS status, changed_at
+			FROM cohort_membership_changelog
+			WHERE cohort_id = ? AND changed_at > ? AND changed_at <= ?
+		)
+		GROUP BY user_id
+		HAVING argMax(status, changed_at) > 0`
+
+	return r.queryUserSet(ctx, query, []any{cohortID, snapshotAt, cohortID, snapshotAt, at}, limit, offset)
+}
+
+// nearestSnapshot returns when the cohort's latest snapshot at or before at
+// was taken. max() over no rows is the epoch, which replays the changelog
+// from the start.
+func (r *MembershipRepository) nearestSnapshot(ctx context.Context, cohortID uuid.UUID, at time.Time) (time.Time, error) {
+	var snapshotAt time.Time
+	err := r.client.QueryRow(ctx, `
+		SELECT max(snapshot_at)
+		FROM cohort_membership_snapshots
+		WHERE cohort_id = ? AND snapshot_at <= ?
+	`, cohortID, at).Scan(&snapshotAt)
+	return snapshotAt, err
+}
@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrNoBrokerReachable is returned when none of the configured brokers accept a connection
+var ErrNoBrokerReachable = errors.New("no kafka broker reachable")
+
+// DialFunc opens and closes a connection to a broker, reporting whether it succeeded
+type DialFunc func(ctx context.Context, address string) error
+
+// BrokerChecker verifies the configured brokers are reachable at startup
+type BrokerChecker struct {
+	dial DialFunc
+}
+
+// NewBrokerChecker creates a broker checker that gives each broker timeout to accept a connection
+func NewBrokerChecker(timeout time.Duration) *BrokerChecker {
+	dialer := &kafka.Dialer{Timeout: timeout}
+	return NewBrokerCheckerWithDialer(func(ctx context.Context, address string) error {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// NewBrokerCheckerWithDialer creates a broker checker using an existing dial function
+func NewBrokerCheckerWithDialer(dial DialFunc) *BrokerChecker {
+	return &BrokerChecker{dial: dial}
+}
+
+// Check dials every broker and returns ErrNoBrokerReachable when none answer.
+// Unreachable brokers are only logged while another one is up, since writers
+// and readers fail over to the remaining brokers on their own.
+func (c *BrokerChecker) Check(ctx context.Context, brokers []string) error {
+	if len(brokers) == 0 {
+		return fmt.Errorf("%w: no brokers configured", ErrNoBrokerReachable)
+	}
+
+	var errs []error
+	for _, broker := range brokers {
+		if err := c.dial(ctx, broker); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+		}
+	}
+
+	if len(errs) == len(brokers) {
+		return fmt.Errorf("%w: %w", ErrNoBrokerReachable, errors.Join(errs...))
+	}
+	for _, err := range errs {
+		log.Printf("warning: kafka broker unreachable: %v", err)
+	}
+	return nil
+}
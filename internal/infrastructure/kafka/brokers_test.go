@@ -0,0 +1,77 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+)
+
+func TestNewProducer_UsesAllBrokers(t *testing.T) {
+	brokers := []string{"kafka-1:9092", "kafka-2:9092", "kafka-3:9092"}
+	producer := kafka.NewProducer(config.KafkaConfig{
+		Brokers:          brokers,
+		EventsTopic:      "events.raw",
+		CohortsTopic:     "cohort.definitions",
+		ChangesTopic:     "cohort.changes",
+		WriteMaxAttempts: 3,
+	})
+	defer producer.Close()
+
+	got := producer.Brokers()
+	for _, topic := range []string{"events.raw", "cohort.definitions", "cohort.changes"} {
+		if !reflect.DeepEqual(got[topic], brokers) {
+			t.Errorf("Brokers()[%q] = %v, expected %v", topic, got[topic], brokers)
+		}
+	}
+}
+
+func TestBrokerChecker_Check(t *testing.T) {
+	brokers := []string{"kafka-1:9092", "kafka-2:9092"}
+	dialErr := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		reachable map[string]bool
+		expectErr bool
+	}{
+		{"all reachable", map[string]bool{"kafka-1:9092": true, "kafka-2:9092": true}, false},
+		{"one reachable", map[string]bool{"kafka-2:9092": true}, false},
+		{"none reachable", map[string]bool{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialed []string
+			checker := kafka.NewBrokerCheckerWithDialer(func(ctx context.Context, address string) error {
+				dialed = append(dialed, address)
+				if tt.reachable[address] {
+					return nil
+				}
+				return dialErr
+			})
+
+			err := checker.Check(context.Background(), brokers)
+			if tt.expectErr {
+				if !errors.Is(err, kafka.ErrNoBrokerReachable) || !errors.Is(err, dialErr) {
+					t.Errorf("Check() = %v, expected ErrNoBrokerReachable wrapping the dial error", err)
+				}
+			} else if err != nil {
+				t.Errorf("Check() = %v, expected nil", err)
+			}
+			if !reflect.DeepEqual(dialed, brokers) {
+				t.Errorf("dialed = %v, expected %v", dialed, brokers)
+			}
+		})
+	}
+
+	t.Run("no brokers", func(t *testing.T) {
+		checker := kafka.NewBrokerCheckerWithDialer(func(ctx context.Context, address string) error { return nil })
+		if err := checker.Check(context.Background(), nil); !errors.Is(err, kafka.ErrNoBrokerReachable) {
+			t.Errorf("Check() = %v, expected ErrNoBrokerReachable", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageWriter writes messages to a Kafka topic
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// ChangelogEntry is a single membership changelog record exported to external consumers
+type ChangelogEntry struct {
+	CohortID     uuid.UUID  `json:"cohort_id"`
+	UserID       string     `json:"user_id"`
+	PrevStatus   int8       `json:"prev_status"`
+	NewStatus    int8       `json:"new_status"`
+	ChangedAt    time.Time  `json:"changed_at"`
+	TriggerEvent *uuid.UUID `json:"trigger_event,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Variant      string     `json:"variant,omitempty"`
+}
+
+// ChangelogExporter produces every membership changelog entry to a compacted
+// topic keyed by cohort and user, so consumers can rebuild current state
+type ChangelogExporter struct {
+	writer MessageWriter
+}
+
+// NewChangelogExporter creates a new changelog exporter for the given topic
+func NewChangelogExporter(brokers []string, topic string) *ChangelogExporter {
+	return &ChangelogExporter{
+		writer: &kafka.Writer{
+			Addr:            kafka.TCP(brokers...),
+			Topic:           topic,
+			Balancer:        &kafka.Hash{}, // Same cohort+user always lands on the same partition
+			BatchSize:       100,
+			BatchTimeout:    10 * time.Millisecond,
+			RequiredAcks:    kafka.RequireAll,
+			Async:           false,
+			WriteBackoffMin: writeBackoffMin,
+			WriteBackoffMax: writeBackoffMax,
+		},
+	}
+}
+
+// NewChangelogExporterWithWriter creates a changelog exporter with a custom MessageWriter (for testing)
+func NewChangelogExporterWithWriter(writer MessageWriter) *ChangelogExporter {
+	return &ChangelogExporter{writer: writer}
+}
+
+// Export produces one message per changelog entry
+func (e *ChangelogExporter) Export(ctx context.Context, entries []ChangelogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	messages := make([]kafka.Message, len(entries))
+	for i, entry := range entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{
+			Key:   ChangelogKey(entry.CohortID, entry.UserID),
+			Value: value,
+			Time:  entry.ChangedAt,
+		}
+	}
+
+	return e.writer.WriteMessages(ctx, messages...)
+}
+
+// Close closes the underlying writer
+func (e *ChangelogExporter) Close() error {
+	return e.writer.Close()
+}
+
+// ChangelogKey returns the compaction key for a cohort+user pair
+func ChangelogKey(cohortID uuid.UUID, userID string) []byte {
+	return []byte(cohortID.String() + ":" + userID)
+}
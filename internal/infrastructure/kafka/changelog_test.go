@@ -0,0 +1,69 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type recordingWriter struct {
+	messages []kafkago.Message
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+func TestChangelogExporter_Export(t *testing.T) {
+	writer := &recordingWriter{}
+	exporter := kafka.NewChangelogExporterWithWriter(writer)
+
+	cohortID := uuid.New()
+	now := time.Now().UTC()
+	entries := []kafka.ChangelogEntry{
+		{CohortID: cohortID, UserID: "user1", PrevStatus: -1, NewStatus: 1, ChangedAt: now},
+		{CohortID: cohortID, UserID: "user2", PrevStatus: -1, NewStatus: 1, ChangedAt: now},
+		{CohortID: cohortID, UserID: "user1", PrevStatus: 1, NewStatus: -1, ChangedAt: now.Add(time.Second)},
+	}
+
+	if err := exporter.Export(context.Background(), entries); err != nil {
+		t.Fatalf("Export() unexpected error: %v", err)
+	}
+
+	if len(writer.messages) != len(entries) {
+		t.Fatalf("messages = %d, expected %d", len(writer.messages), len(entries))
+	}
+
+	for i, msg := range writer.messages {
+		expectedKey := cohortID.String() + ":" + entries[i].UserID
+		if string(msg.Key) != expectedKey {
+			t.Errorf("messages[%d].Key = %q, expected %q", i, msg.Key, expectedKey)
+		}
+
+		var decoded kafka.ChangelogEntry
+		if err := json.Unmarshal(msg.Value, &decoded); err != nil {
+			t.Fatalf("messages[%d] is not valid JSON: %v", i, err)
+		}
+		if decoded.UserID != entries[i].UserID || decoded.NewStatus != entries[i].NewStatus {
+			t.Errorf("messages[%d] = %+v, expected %+v", i, decoded, entries[i])
+		}
+	}
+
+	t.Run("empty batch writes nothing", func(t *testing.T) {
+		writer.messages = nil
+		if err := exporter.Export(context.Background(), nil); err != nil {
+			t.Fatalf("Export() unexpected error: %v", err)
+		}
+		if len(writer.messages) != 0 {
+			t.Errorf("messages = %d, expected 0", len(writer.messages))
+		}
+	})
+}
@@ -3,36 +3,78 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 	"github.com/pjhul/intent/internal/config"
 	"github.com/pjhul/intent/internal/domain/membership"
 )
 
+// ErrConsumerBlocked is returned from Start under the block policy when a
+// message still fails after every retry; it's left uncommitted
+var ErrConsumerBlocked = errors.New("consumer blocked on a failing message")
+
+// Headers added to messages forwarded to the dead-letter topic
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+)
+
 // MembershipChangeHandler is called when a membership change is received
 type MembershipChangeHandler func(ctx context.Context, change *membership.MembershipChange) error
 
+// MessageReader fetches and commits messages from a consumer group
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 // Consumer handles consuming messages from Kafka
 type Consumer struct {
-	changesReader *kafka.Reader
+	changesReader MessageReader
+	dlq           MessageWriter
 	handler       MembershipChangeHandler
 	cfg           config.KafkaConfig
 }
 
 // NewConsumer creates a new Kafka consumer for membership changes
 func NewConsumer(cfg config.KafkaConfig, handler MembershipChangeHandler) *Consumer {
-	changesReader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        cfg.Brokers,
-		Topic:          cfg.ChangesTopic,
-		GroupID:        cfg.ConsumerGroup,
-		MinBytes:       1,
-		MaxBytes:       10e6, // 10MB
-		CommitInterval: 0,    // Manual commits
-	})
+	readerCfg := NewReaderConfig(cfg.Brokers, cfg.ChangesTopic, cfg.ConsumerGroup, cfg.StartOffset)
+	readerCfg.SessionTimeout = cfg.SessionTimeout
+	readerCfg.HeartbeatInterval = cfg.HeartbeatTimeout
+	changesReader := kafka.NewReader(readerCfg)
 
+	var dlq MessageWriter
+	if cfg.ConsumerErrorPolicy == config.ConsumerErrorDLQ {
+		dlq = &kafka.Writer{
+			Addr:            kafka.TCP(cfg.Brokers...),
+			Topic:           cfg.DLQTopic,
+			Balancer:        &kafka.Hash{},
+			RequiredAcks:    kafka.RequireAll,
+			MaxAttempts:     cfg.WriteMaxAttempts,
+			WriteBackoffMin: writeBackoffMin,
+			WriteBackoffMax: writeBackoffMax,
+		}
+	}
+
+	return NewConsumerWithReader(cfg, changesReader, dlq, handler)
+}
+
+// NewConsumerWithReader creates a consumer over a custom MessageReader and
+// dead-letter MessageWriter (for testing). dlq may be nil unless the error
+// policy is dlq.
+func NewConsumerWithReader(cfg config.KafkaConfig, reader MessageReader, dlq MessageWriter, handler MembershipChangeHandler) *Consumer {
 	return &Consumer{
-		changesReader: changesReader,
+		changesReader: reader,
+		dlq:           dlq,
 		handler:       handler,
 		cfg:           cfg,
 	}
@@ -47,18 +89,20 @@ func (c *Consumer) Start(ctx context.Context) error {
 		default:
 			msg, err := c.changesReader.FetchMessage(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				log.Printf("error fetching message: %v", err)
 				continue
 			}
 
-			var change membership.MembershipChange
-			if err := json.Unmarshal(msg.Value, &change); err != nil {
-				log.Printf("error unmarshaling message: %v", err)
-				continue
-			}
-
-			if err := c.handler(ctx, &change); err != nil {
-				log.Printf("error handling message: %v", err)
+			if err := c.process(ctx, msg); err != nil {
+				if c.cfg.ConsumerErrorPolicy == config.ConsumerErrorBlock || ctx.Err() != nil {
+					return err
+				}
+				// The message couldn't be skipped or dead-lettered; leave it
+				// uncommitted like block would, but keep the partition moving
+				log.Printf("error handling message at %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
 				continue
 			}
 
@@ -69,17 +113,88 @@ func (c *Consumer) Start(ctx context.Context) error {
 	}
 }
 
+// process handles a message, retrying the handler, and applies the error
+// policy once retries are exhausted. A nil return means msg can be committed.
+func (c *Consumer) process(ctx context.Context, msg kafka.Message) error {
+	var change membership.MembershipChange
+	if err := json.Unmarshal(msg.Value, &change); err != nil {
+		// A malformed message fails the same way every time, so don't retry it
+		return c.giveUp(ctx, msg, fmt.Errorf("unmarshaling message: %w", err))
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.cfg.ConsumerMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.cfg.ConsumerRetryBackoff):
+			}
+		}
+		if err = c.handler(ctx, &change); err == nil {
+			return nil
+		}
+		log.Printf("error handling message at %s/%d@%d (attempt %d): %v", msg.Topic, msg.Partition, msg.Offset, attempt+1, err)
+	}
+	return c.giveUp(ctx, msg, err)
+}
+
+// giveUp applies the error policy to a message that can't be handled
+func (c *Consumer) giveUp(ctx context.Context, msg kafka.Message, cause error) error {
+	switch c.cfg.ConsumerErrorPolicy {
+	case config.ConsumerErrorSkip:
+		log.Printf("skipping message at %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, cause)
+		return nil
+	case config.ConsumerErrorDLQ:
+		if err := c.dlq.WriteMessages(ctx, deadLetter(msg, cause)); err != nil {
+			return fmt.Errorf("forwarding to dead-letter topic: %w (handler error: %v)", err, cause)
+		}
+		log.Printf("forwarded message at %s/%d@%d to dead-letter topic: %v", msg.Topic, msg.Partition, msg.Offset, cause)
+		return nil
+	default:
+		return fmt.Errorf("%w at %s/%d@%d: %v", ErrConsumerBlocked, msg.Topic, msg.Partition, msg.Offset, cause)
+	}
+}
+
+// deadLetter copies msg for the dead-letter topic, recording where it came
+// from and why it failed in headers
+func deadLetter(msg kafka.Message, cause error) kafka.Message {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderError, Value: []byte(cause.Error())},
+	)
+	return kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
 // Close closes the consumer
 func (c *Consumer) Close() error {
+	if c.dlq != nil {
+		if err := c.dlq.Close(); err != nil {
+			log.Printf("error closing dead-letter writer: %v", err)
+		}
+	}
 	return c.changesReader.Close()
 }
 
 // ChangesBroadcaster broadcasts membership changes to subscribers
 type ChangesBroadcaster struct {
-	subscribers map[string]chan *membership.MembershipChange
+	subscribers map[string]*subscriber
 	register    chan *subscriberRequest
 	unregister  chan string
 	broadcast   chan *membership.MembershipChange
+
+	// reapThreshold is how long a subscriber's channel may stay full before
+	// it's closed and removed; 0 disables reaping
+	reapThreshold time.Duration
+	streamGate    StreamGate
+}
+
+// StreamGate reports whether a cohort's membership changes are streamed
+type StreamGate interface {
+	StreamEnabled(ctx context.Context, cohortID uuid.UUID) bool
 }
 
 type subscriberRequest struct {
@@ -88,37 +203,89 @@ type subscriberRequest struct {
 	ch           chan *membership.MembershipChange
 }
 
+// subscriber is a registered channel and when it was first found full
+type subscriber struct {
+	ch        chan *membership.MembershipChange
+	fullSince time.Time
+}
+
 // NewChangesBroadcaster creates a new broadcaster
 func NewChangesBroadcaster() *ChangesBroadcaster {
 	return &ChangesBroadcaster{
-		subscribers: make(map[string]chan *membership.MembershipChange),
+		subscribers: make(map[string]*subscriber),
 		register:    make(chan *subscriberRequest),
 		unregister:  make(chan string),
 		broadcast:   make(chan *membership.MembershipChange, 100),
 	}
 }
 
+// SetReapThreshold sets how long a subscriber's channel may stay full before
+// the subscriber is reaped, so handlers that exit without unsubscribing don't
+// stay registered forever. 0 disables reaping. Call before Run.
+func (b *ChangesBroadcaster) SetReapThreshold(threshold time.Duration) {
+	b.reapThreshold = threshold
+}
+
+// SetStreamGate drops changes of cohorts the gate has streaming disabled
+// for before they're broadcast. Call before Run.
+func (b *ChangesBroadcaster) SetStreamGate(gate StreamGate) {
+	b.streamGate = gate
+}
+
 // Run starts the broadcaster
 func (b *ChangesBroadcaster) Run(ctx context.Context) {
+	var reap <-chan time.Time
+	if b.reapThreshold > 0 {
+		ticker := time.NewTicker(b.reapThreshold / 2)
+		defer ticker.Stop()
+		reap = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case req := <-b.register:
-			b.subscribers[req.id] = req.ch
+			b.subscribers[req.id] = &subscriber{ch: req.ch}
 		case id := <-b.unregister:
-			if ch, ok := b.subscribers[id]; ok {
-				close(ch)
+			if sub, ok := b.subscribers[id]; ok {
+				close(sub.ch)
 				delete(b.subscribers, id)
 			}
 		case change := <-b.broadcast:
-			for _, ch := range b.subscribers {
+			for _, sub := range b.subscribers {
 				select {
-				case ch <- change:
+				case sub.ch <- change:
+					sub.fullSince = time.Time{}
 				default:
 					// Skip slow subscribers
+					if sub.fullSince.IsZero() {
+						sub.fullSince = time.Now()
+					}
 				}
 			}
+		case now := <-reap:
+			b.reapStuck(now)
+		}
+	}
+}
+
+// reapStuck closes and removes subscribers whose channel has been full for
+// at least the reap threshold
+func (b *ChangesBroadcaster) reapStuck(now time.Time) {
+	for id, sub := range b.subscribers {
+		if len(sub.ch) < cap(sub.ch) {
+			sub.fullSince = time.Time{}
+			continue
+		}
+		if sub.fullSince.IsZero() {
+			sub.fullSince = now
+			continue
+		}
+		if now.Sub(sub.fullSince) >= b.reapThreshold {
+			log.Printf("reaping stream subscriber %s: channel full for %s", id, now.Sub(sub.fullSince).Round(time.Second))
+			close(sub.ch)
+			delete(b.subscribers, id)
 		}
 	}
 }
@@ -142,6 +309,9 @@ func (b *ChangesBroadcaster) Broadcast(change *membership.MembershipChange) {
 
 // HandleChange is used as the consumer handler to broadcast changes
 func (b *ChangesBroadcaster) HandleChange(ctx context.Context, change *membership.MembershipChange) error {
+	if b.streamGate != nil && !b.streamGate.StreamEnabled(ctx, change.CohortID) {
+		return nil
+	}
 	b.Broadcast(change)
 	return nil
 }
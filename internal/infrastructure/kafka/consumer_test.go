@@ -0,0 +1,230 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/domain/membership"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// fakeReader serves queued messages, then cancels the consumer's context
+type fakeReader struct {
+	messages  []kafkago.Message
+	committed []kafkago.Message
+	cancel    context.CancelFunc
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if len(r.messages) == 0 {
+		r.cancel()
+		return kafkago.Message{}, ctx.Err()
+	}
+	msg := r.messages[0]
+	r.messages = r.messages[1:]
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func TestConsumer_ErrorPolicy(t *testing.T) {
+	value, _ := json.Marshal(membership.MembershipChange{CohortID: uuid.New(), UserID: "user1"})
+	messages := func() []kafkago.Message {
+		return []kafkago.Message{
+			{Topic: "cohort.changes", Partition: 1, Offset: 7, Key: []byte("k1"), Value: value},
+			{Topic: "cohort.changes", Partition: 1, Offset: 8, Key: []byte("k2"), Value: value},
+		}
+	}
+
+	run := func(t *testing.T, policy config.ConsumerErrorPolicy) (*fakeReader, *recordingWriter, int, error) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		reader := &fakeReader{messages: messages(), cancel: cancel}
+		dlq := &recordingWriter{}
+		calls := 0
+		handler := func(ctx context.Context, change *membership.MembershipChange) error {
+			calls++
+			return errors.New("downstream unavailable")
+		}
+
+		cfg := config.KafkaConfig{ConsumerErrorPolicy: policy, ConsumerMaxRetries: 2}
+		err := kafka.NewConsumerWithReader(cfg, reader, dlq, handler).Start(ctx)
+		return reader, dlq, calls, err
+	}
+
+	t.Run("skip commits past failing messages", func(t *testing.T) {
+		reader, dlq, calls, err := run(t, config.ConsumerErrorSkip)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Start() = %v, expected context.Canceled", err)
+		}
+		if calls != 6 {
+			t.Errorf("handler calls = %d, expected 6 (3 attempts per message)", calls)
+		}
+		if len(reader.committed) != 2 {
+			t.Errorf("committed = %d, expected 2", len(reader.committed))
+		}
+		if len(dlq.messages) != 0 {
+			t.Errorf("dead-lettered = %d, expected 0", len(dlq.messages))
+		}
+	})
+
+	t.Run("dlq forwards and commits failing messages", func(t *testing.T) {
+		reader, dlq, calls, err := run(t, config.ConsumerErrorDLQ)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Start() = %v, expected context.Canceled", err)
+		}
+		if calls != 6 {
+			t.Errorf("handler calls = %d, expected 6 (3 attempts per message)", calls)
+		}
+		if len(reader.committed) != 2 {
+			t.Errorf("committed = %d, expected 2", len(reader.committed))
+		}
+		if len(dlq.messages) != 2 {
+			t.Fatalf("dead-lettered = %d, expected 2", len(dlq.messages))
+		}
+
+		headers := map[string]string{}
+		for _, h := range dlq.messages[0].Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		expected := map[string]string{
+			kafka.HeaderOriginalTopic:     "cohort.changes",
+			kafka.HeaderOriginalPartition: "1",
+			kafka.HeaderOriginalOffset:    "7",
+			kafka.HeaderError:             "downstream unavailable",
+		}
+		for key, want := range expected {
+			if headers[key] != want {
+				t.Errorf("header %s = %q, expected %q", key, headers[key], want)
+			}
+		}
+		if string(dlq.messages[0].Key) != "k1" || string(dlq.messages[0].Value) != string(value) {
+			t.Errorf("dead-lettered message = %s/%s, expected the original key and value", dlq.messages[0].Key, dlq.messages[0].Value)
+		}
+	})
+
+	t.Run("block stops without committing", func(t *testing.T) {
+		reader, dlq, calls, err := run(t, config.ConsumerErrorBlock)
+		if !errors.Is(err, kafka.ErrConsumerBlocked) {
+			t.Errorf("Start() = %v, expected ErrConsumerBlocked", err)
+		}
+		if calls != 3 {
+			t.Errorf("handler calls = %d, expected 3 (one message, 3 attempts)", calls)
+		}
+		if len(reader.committed) != 0 {
+			t.Errorf("committed = %d, expected 0", len(reader.committed))
+		}
+		if len(dlq.messages) != 0 {
+			t.Errorf("dead-lettered = %d, expected 0", len(dlq.messages))
+		}
+	})
+}
+
+func TestChangesBroadcaster_ReapsStuckSubscribers(t *testing.T) {
+	threshold := 50 * time.Millisecond
+	b := kafka.NewChangesBroadcaster()
+	b.SetReapThreshold(threshold)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	// The stuck subscriber never reads; the live one keeps draining
+	stuck := b.Subscribe("stuck", &membership.StreamSubscription{})
+	live := b.Subscribe("live", &membership.StreamSubscription{})
+	received := make(chan *membership.MembershipChange, 2*cap(live))
+	go func() {
+		for change := range live {
+			received <- change
+		}
+	}()
+
+	for i := 0; i < cap(stuck)+1; i++ {
+		b.Broadcast(&membership.MembershipChange{UserID: "user-1"})
+	}
+	time.Sleep(4 * threshold)
+
+	t.Run("stuck subscriber is closed", func(t *testing.T) {
+		for i := 0; i < cap(stuck); i++ {
+			<-stuck
+		}
+		select {
+		case _, ok := <-stuck:
+			if ok {
+				t.Error("stuck channel received a change, expected it closed")
+			}
+		case <-time.After(time.Second):
+			t.Error("stuck subscriber was not reaped")
+		}
+	})
+
+	t.Run("live subscriber keeps receiving", func(t *testing.T) {
+		b.Broadcast(&membership.MembershipChange{UserID: "user-2"})
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case change := <-received:
+				if change.UserID == "user-2" {
+					return
+				}
+			case <-timeout:
+				t.Fatal("live subscriber stopped receiving changes")
+			}
+		}
+	})
+
+	b.Unsubscribe("stuck")
+}
+
+// disabledStreams disables streaming for a set of cohorts
+type disabledStreams map[uuid.UUID]bool
+
+func (d disabledStreams) StreamEnabled(ctx context.Context, cohortID uuid.UUID) bool {
+	return !d[cohortID]
+}
+
+func TestChangesBroadcaster_SkipsStreamDisabledCohorts(t *testing.T) {
+	batchOnly, streamed := uuid.New(), uuid.New()
+	b := kafka.NewChangesBroadcaster()
+	b.SetStreamGate(disabledStreams{batchOnly: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	ch := b.Subscribe("sub", &membership.StreamSubscription{})
+	defer b.Unsubscribe("sub")
+
+	for _, cohortID := range []uuid.UUID{batchOnly, streamed} {
+		if err := b.HandleChange(ctx, &membership.MembershipChange{CohortID: cohortID, UserID: "user-1"}); err != nil {
+			t.Fatalf("HandleChange() error = %v", err)
+		}
+	}
+
+	select {
+	case change := <-ch:
+		if change.CohortID != streamed {
+			t.Errorf("received change for cohort %s, expected only %s", change.CohortID, streamed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("streamed cohort's change was not broadcast")
+	}
+	select {
+	case change := <-ch:
+		t.Errorf("received unexpected change for cohort %s", change.CohortID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
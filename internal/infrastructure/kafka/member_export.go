@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// MemberExportRecord is a single cohort member in a scheduled export
+type MemberExportRecord struct {
+	CohortID   uuid.UUID `json:"cohort_id"`
+	CohortName string    `json:"cohort_name"`
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// MemberExporter produces cohort member exports to the topic named by each
+// export's destination
+type MemberExporter struct {
+	writer MessageWriter
+}
+
+// NewMemberExporter creates a new member exporter; the topic is chosen per export
+func NewMemberExporter(brokers []string) *MemberExporter {
+	return &MemberExporter{
+		writer: &kafka.Writer{
+			Addr:            kafka.TCP(brokers...),
+			Balancer:        &kafka.Hash{},
+			BatchSize:       1000,
+			BatchTimeout:    10 * time.Millisecond,
+			RequiredAcks:    kafka.RequireAll,
+			Async:           false,
+			WriteBackoffMin: writeBackoffMin,
+			WriteBackoffMax: writeBackoffMax,
+		},
+	}
+}
+
+// NewMemberExporterWithWriter creates a member exporter with a custom MessageWriter (for testing)
+func NewMemberExporterWithWriter(writer MessageWriter) *MemberExporter {
+	return &MemberExporter{writer: writer}
+}
+
+// Export produces one message per record to topic, keyed by cohort and user
+func (e *MemberExporter) Export(ctx context.Context, topic string, records []MemberExportRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	messages := make([]kafka.Message, len(records))
+	for i, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{
+			Topic: topic,
+			Key:   ChangelogKey(record.CohortID, record.UserID),
+			Value: value,
+			Time:  record.ExportedAt,
+		}
+	}
+
+	return e.writer.WriteMessages(ctx, messages...)
+}
+
+// Close closes the underlying writer
+func (e *MemberExporter) Close() error {
+	return e.writer.Close()
+}
@@ -0,0 +1,249 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrInvalidOffsetReset = errors.New("invalid offset reset")
+	ErrTopicNotFound      = errors.New("topic not found")
+)
+
+// OffsetResetMode selects where a consumer group offset is moved to
+type OffsetResetMode string
+
+const (
+	OffsetResetEarliest  OffsetResetMode = "earliest"
+	OffsetResetLatest    OffsetResetMode = "latest"
+	OffsetResetTimestamp OffsetResetMode = "timestamp"
+	OffsetResetOffset    OffsetResetMode = "offset"
+)
+
+// AdminClient is the subset of the Kafka client used to manage consumer group offsets
+type AdminClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+	OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error)
+}
+
+// OffsetReset describes moving a consumer group's offsets for a topic
+type OffsetReset struct {
+	GroupID string          `json:"group_id"`
+	Topic   string          `json:"topic"`
+	Mode    OffsetResetMode `json:"mode"`
+	// Timestamp is used with OffsetResetTimestamp
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	// Offset is used with OffsetResetOffset
+	Offset int64 `json:"offset,omitempty"`
+	// Partition restricts the reset to one partition; all partitions when nil
+	Partition *int `json:"partition,omitempty"`
+}
+
+// Validate checks the reset mode and its arguments
+func (r *OffsetReset) Validate() error {
+	if r.GroupID == "" || r.Topic == "" {
+		return fmt.Errorf("%w: group and topic are required", ErrInvalidOffsetReset)
+	}
+	switch r.Mode {
+	case OffsetResetEarliest, OffsetResetLatest:
+	case OffsetResetTimestamp:
+		if r.Timestamp.IsZero() {
+			return fmt.Errorf("%w: timestamp is required", ErrInvalidOffsetReset)
+		}
+	case OffsetResetOffset:
+		if r.Offset < 0 {
+			return fmt.Errorf("%w: offset must not be negative", ErrInvalidOffsetReset)
+		}
+	default:
+		return fmt.Errorf("%w: mode must be earliest, latest, timestamp or offset", ErrInvalidOffsetReset)
+	}
+	return nil
+}
+
+// PartitionOffset is the offset committed for a partition
+type PartitionOffset struct {
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// OffsetResetter moves consumer group offsets. Kafka only accepts the commit
+// while the group has no active members, so consumers must be stopped first.
+type OffsetResetter struct {
+	client AdminClient
+}
+
+// NewOffsetResetter creates an offset resetter connected to the brokers
+func NewOffsetResetter(brokers []string) *OffsetResetter {
+	return &OffsetResetter{client: &kafka.Client{Addr: kafka.TCP(brokers...)}}
+}
+
+// NewOffsetResetterWithClient creates an offset resetter using an existing client
+func NewOffsetResetterWithClient(client AdminClient) *OffsetResetter {
+	return &OffsetResetter{client: client}
+}
+
+// Reset commits the requested offsets for the group and returns them
+func (r *OffsetResetter) Reset(ctx context.Context, req OffsetReset) ([]PartitionOffset, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	partitions, err := r.partitions(ctx, req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := r.resolveOffsets(ctx, req, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]kafka.OffsetCommit, len(offsets))
+	for i, o := range offsets {
+		commits[i] = kafka.OffsetCommit{Partition: o.Partition, Offset: o.Offset}
+	}
+
+	resp, err := r.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      req.GroupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{req.Topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	for _, p := range resp.Topics[req.Topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to commit offset for partition %d: %w", p.Partition, p.Error)
+		}
+	}
+
+	return offsets, nil
+}
+
+// partitions returns the topic's partition IDs, or only the requested one
+func (r *OffsetResetter) partitions(ctx context.Context, topic string, only *int) ([]int, error) {
+	meta, err := r.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch topic metadata: %w", err)
+	}
+
+	var partitions []int
+	for _, t := range meta.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTopicNotFound, topic, t.Error)
+		}
+		for _, p := range t.Partitions {
+			if only == nil || p.ID == *only {
+				partitions = append(partitions, p.ID)
+			}
+		}
+	}
+	if len(partitions) == 0 {
+		if only != nil {
+			return nil, fmt.Errorf("%w: %s partition %d", ErrTopicNotFound, topic, *only)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+	}
+
+	sort.Ints(partitions)
+	return partitions, nil
+}
+
+// resolveOffsets looks up the offset each partition is moved to
+func (r *OffsetResetter) resolveOffsets(ctx context.Context, req OffsetReset, partitions []int) ([]PartitionOffset, error) {
+	offsets := make([]PartitionOffset, len(partitions))
+	if req.Mode == OffsetResetOffset {
+		for i, p := range partitions {
+			offsets[i] = PartitionOffset{Partition: p, Offset: req.Offset}
+		}
+		return offsets, nil
+	}
+
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		switch req.Mode {
+		case OffsetResetEarliest:
+			requests[i] = kafka.FirstOffsetOf(p)
+		case OffsetResetLatest:
+			requests[i] = kafka.LastOffsetOf(p)
+		case OffsetResetTimestamp:
+			requests[i] = kafka.TimeOffsetOf(p, req.Timestamp)
+		}
+	}
+
+	listed, err := r.listOffsets(ctx, req.Topic, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	// A timestamp after the newest message has no offset, so those
+	// partitions resolve to the end instead
+	var pastEnd []kafka.OffsetRequest
+	for i, p := range partitions {
+		var offset int64 = -1
+		switch req.Mode {
+		case OffsetResetEarliest:
+			offset = listed[p].FirstOffset
+		case OffsetResetLatest:
+			offset = listed[p].LastOffset
+		case OffsetResetTimestamp:
+			for o := range listed[p].Offsets {
+				if o >= 0 {
+					offset = o
+				}
+			}
+			if offset < 0 {
+				pastEnd = append(pastEnd, kafka.LastOffsetOf(p))
+			}
+		}
+		offsets[i] = PartitionOffset{Partition: p, Offset: offset}
+	}
+
+	if len(pastEnd) > 0 {
+		last, err := r.listOffsets(ctx, req.Topic, pastEnd)
+		if err != nil {
+			return nil, err
+		}
+		for i := range offsets {
+			if offsets[i].Offset < 0 {
+				offsets[i].Offset = last[offsets[i].Partition].LastOffset
+			}
+		}
+	}
+
+	for _, o := range offsets {
+		if o.Offset < 0 {
+			return nil, fmt.Errorf("no offset listed for partition %d", o.Partition)
+		}
+	}
+
+	return offsets, nil
+}
+
+// listOffsets runs the offset requests for a topic, keyed by partition
+func (r *OffsetResetter) listOffsets(ctx context.Context, topic string, requests []kafka.OffsetRequest) (map[int]kafka.PartitionOffsets, error) {
+	resp, err := r.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	byPartition := make(map[int]kafka.PartitionOffsets)
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offset for partition %d: %w", p.Partition, p.Error)
+		}
+		byPartition[p.Partition] = p
+	}
+	return byPartition, nil
+}
@@ -0,0 +1,185 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// fakeAdminClient serves a two partition topic and records offset requests
+type fakeAdminClient struct {
+	first, last map[int]int64
+	// atTime is the offset found by a timestamp lookup; partitions without
+	// one behave as if the timestamp is after the newest message
+	atTime map[int]int64
+
+	listed  [][]kafkago.OffsetRequest
+	commits []*kafkago.OffsetCommitRequest
+}
+
+func (f *fakeAdminClient) Metadata(ctx context.Context, req *kafkago.MetadataRequest) (*kafkago.MetadataResponse, error) {
+	return &kafkago.MetadataResponse{Topics: []kafkago.Topic{{
+		Name:       "events.raw",
+		Partitions: []kafkago.Partition{{ID: 1}, {ID: 0}},
+	}}}, nil
+}
+
+func (f *fakeAdminClient) ListOffsets(ctx context.Context, req *kafkago.ListOffsetsRequest) (*kafkago.ListOffsetsResponse, error) {
+	var partitions []kafkago.PartitionOffsets
+	for topic, requests := range req.Topics {
+		f.listed = append(f.listed, requests)
+		for _, r := range requests {
+			p := kafkago.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1, Offsets: map[int64]time.Time{}}
+			switch r.Timestamp {
+			case kafkago.FirstOffset:
+				p.FirstOffset = f.first[r.Partition]
+			case kafkago.LastOffset:
+				p.LastOffset = f.last[r.Partition]
+			default:
+				if offset, ok := f.atTime[r.Partition]; ok {
+					p.Offsets[offset] = time.UnixMilli(r.Timestamp)
+				}
+			}
+			partitions = append(partitions, p)
+		}
+		return &kafkago.ListOffsetsResponse{Topics: map[string][]kafkago.PartitionOffsets{topic: partitions}}, nil
+	}
+	return &kafkago.ListOffsetsResponse{}, nil
+}
+
+func (f *fakeAdminClient) OffsetCommit(ctx context.Context, req *kafkago.OffsetCommitRequest) (*kafkago.OffsetCommitResponse, error) {
+	f.commits = append(f.commits, req)
+	return &kafkago.OffsetCommitResponse{}, nil
+}
+
+func newFakeAdminClient() *fakeAdminClient {
+	return &fakeAdminClient{
+		first:  map[int]int64{0: 5, 1: 7},
+		last:   map[int]int64{0: 100, 1: 200},
+		atTime: map[int]int64{0: 42},
+	}
+}
+
+func committed(t *testing.T, client *fakeAdminClient) []kafkago.OffsetCommit {
+	t.Helper()
+	if len(client.commits) != 1 {
+		t.Fatalf("commits = %d, expected 1", len(client.commits))
+	}
+	req := client.commits[0]
+	if req.GroupID != "inserter-events" {
+		t.Errorf("GroupID = %q, expected inserter-events", req.GroupID)
+	}
+	if req.GenerationID != -1 {
+		t.Errorf("GenerationID = %d, expected -1 for a group without members", req.GenerationID)
+	}
+	return req.Topics["events.raw"]
+}
+
+func TestOffsetResetter_Reset(t *testing.T) {
+	base := kafka.OffsetReset{GroupID: "inserter-events", Topic: "events.raw"}
+
+	t.Run("earliest commits the first offsets", func(t *testing.T) {
+		client := newFakeAdminClient()
+		req := base
+		req.Mode = kafka.OffsetResetEarliest
+
+		if _, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req); err != nil {
+			t.Fatalf("Reset() error = %v", err)
+		}
+
+		expected := []kafkago.OffsetCommit{{Partition: 0, Offset: 5}, {Partition: 1, Offset: 7}}
+		if got := committed(t, client); !reflect.DeepEqual(got, expected) {
+			t.Errorf("committed = %+v, expected %+v", got, expected)
+		}
+	})
+
+	t.Run("latest commits the last offsets", func(t *testing.T) {
+		client := newFakeAdminClient()
+		req := base
+		req.Mode = kafka.OffsetResetLatest
+
+		offsets, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Reset() error = %v", err)
+		}
+
+		expected := []kafkago.OffsetCommit{{Partition: 0, Offset: 100}, {Partition: 1, Offset: 200}}
+		if got := committed(t, client); !reflect.DeepEqual(got, expected) {
+			t.Errorf("committed = %+v, expected %+v", got, expected)
+		}
+		if len(offsets) != 2 || offsets[1].Offset != 200 {
+			t.Errorf("offsets = %+v, expected the committed offsets", offsets)
+		}
+	})
+
+	t.Run("timestamp past the newest message resolves to the end", func(t *testing.T) {
+		client := newFakeAdminClient()
+		req := base
+		req.Mode = kafka.OffsetResetTimestamp
+		req.Timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		if _, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req); err != nil {
+			t.Fatalf("Reset() error = %v", err)
+		}
+
+		expected := []kafkago.OffsetCommit{{Partition: 0, Offset: 42}, {Partition: 1, Offset: 200}}
+		if got := committed(t, client); !reflect.DeepEqual(got, expected) {
+			t.Errorf("committed = %+v, expected %+v", got, expected)
+		}
+		if len(client.listed) != 2 || client.listed[0][0].Timestamp != req.Timestamp.UnixMilli() {
+			t.Errorf("listed = %+v, expected a timestamp lookup then a latest lookup", client.listed)
+		}
+	})
+
+	t.Run("specific offset on one partition", func(t *testing.T) {
+		client := newFakeAdminClient()
+		partition := 1
+		req := base
+		req.Mode = kafka.OffsetResetOffset
+		req.Offset = 150
+		req.Partition = &partition
+
+		if _, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req); err != nil {
+			t.Fatalf("Reset() error = %v", err)
+		}
+
+		expected := []kafkago.OffsetCommit{{Partition: 1, Offset: 150}}
+		if got := committed(t, client); !reflect.DeepEqual(got, expected) {
+			t.Errorf("committed = %+v, expected %+v", got, expected)
+		}
+		if len(client.listed) != 0 {
+			t.Errorf("listed = %+v, expected no offset lookups", client.listed)
+		}
+	})
+
+	t.Run("invalid mode is rejected without committing", func(t *testing.T) {
+		client := newFakeAdminClient()
+		req := base
+		req.Mode = "beginning"
+
+		_, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req)
+		if !errors.Is(err, kafka.ErrInvalidOffsetReset) {
+			t.Errorf("Reset() error = %v, expected ErrInvalidOffsetReset", err)
+		}
+		if len(client.commits) != 0 {
+			t.Errorf("commits = %d, expected none", len(client.commits))
+		}
+	})
+
+	t.Run("unknown topic is not found", func(t *testing.T) {
+		client := newFakeAdminClient()
+		req := base
+		req.Topic = "missing"
+		req.Mode = kafka.OffsetResetEarliest
+
+		_, err := kafka.NewOffsetResetterWithClient(client).Reset(context.Background(), req)
+		if !errors.Is(err, kafka.ErrTopicNotFound) {
+			t.Errorf("Reset() error = %v, expected ErrTopicNotFound", err)
+		}
+	})
+}
@@ -3,44 +3,72 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/pjhul/intent/internal/config"
 	"github.com/pjhul/intent/internal/domain/cohort"
 	"github.com/pjhul/intent/internal/domain/event"
+	"github.com/pjhul/intent/internal/domain/membership"
+)
+
+const (
+	writeBackoffMin = 100 * time.Millisecond
+	writeBackoffMax = 2 * time.Second
 )
 
 // Producer handles producing messages to Kafka
 type Producer struct {
 	eventsWriter  *kafka.Writer
 	cohortsWriter *kafka.Writer
+	changesWriter *kafka.Writer
 	cfg           config.KafkaConfig
 }
 
 // NewProducer creates a new Kafka producer
 func NewProducer(cfg config.KafkaConfig) *Producer {
+	// Writers retry failed writes with backoff, re-resolving partition leaders
+	// between attempts so writes move to the remaining brokers when one goes down
 	eventsWriter := &kafka.Writer{
-		Addr:         kafka.TCP(cfg.Brokers...),
-		Topic:        cfg.EventsTopic,
-		Balancer:     &kafka.Hash{}, // Partition by key (user_id)
-		BatchSize:    100,
-		BatchTimeout: 10 * time.Millisecond,
-		RequiredAcks: kafka.RequireOne,
-		Async:        false,
+		Addr:            kafka.TCP(cfg.Brokers...),
+		Topic:           cfg.EventsTopic,
+		Balancer:        &kafka.Hash{}, // Partition by key (user_id)
+		BatchSize:       100,
+		BatchTimeout:    10 * time.Millisecond,
+		RequiredAcks:    kafka.RequireOne,
+		Async:           false,
+		MaxAttempts:     cfg.WriteMaxAttempts,
+		WriteBackoffMin: writeBackoffMin,
+		WriteBackoffMax: writeBackoffMax,
 	}
 
 	cohortsWriter := &kafka.Writer{
-		Addr:         kafka.TCP(cfg.Brokers...),
-		Topic:        cfg.CohortsTopic,
-		Balancer:     &kafka.Hash{},
-		RequiredAcks: kafka.RequireAll,
-		Async:        false,
+		Addr:            kafka.TCP(cfg.Brokers...),
+		Topic:           cfg.CohortsTopic,
+		Balancer:        &kafka.Hash{},
+		RequiredAcks:    kafka.RequireAll,
+		Async:           false,
+		MaxAttempts:     cfg.WriteMaxAttempts,
+		WriteBackoffMin: writeBackoffMin,
+		WriteBackoffMax: writeBackoffMax,
+	}
+
+	changesWriter := &kafka.Writer{
+		Addr:            kafka.TCP(cfg.Brokers...),
+		Topic:           cfg.ChangesTopic,
+		Balancer:        &kafka.Hash{},
+		RequiredAcks:    kafka.RequireOne,
+		Async:           false,
+		MaxAttempts:     cfg.WriteMaxAttempts,
+		WriteBackoffMin: writeBackoffMin,
+		WriteBackoffMax: writeBackoffMax,
 	}
 
 	return &Producer{
 		eventsWriter:  eventsWriter,
 		cohortsWriter: cohortsWriter,
+		changesWriter: changesWriter,
 		cfg:           cfg,
 	}
 }
@@ -90,6 +118,8 @@ func (p *Producer) ProduceCohortDefinition(ctx context.Context, c *cohort.Cohort
 		Time:  time.Now(),
 		Headers: []kafka.Header{
 			{Key: "version", Value: []byte(intToBytes(c.Version))},
+			// Consumers can skip a definition whose hash matches the last one seen
+			{Key: "definition_hash", Value: []byte(c.DefinitionHash())},
 		},
 	})
 }
@@ -103,12 +133,56 @@ func (p *Producer) ProduceCohortDeletion(ctx context.Context, cohortID string) e
 	})
 }
 
+// ProduceMembershipChange publishes a membership change to the changes topic
+func (p *Producer) ProduceMembershipChange(ctx context.Context, change *membership.MembershipChange) error {
+	value, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	return p.changesWriter.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(change.UserID),
+		Value: value,
+		Time:  time.Now(),
+	})
+}
+
+// ProduceMembershipChanges publishes multiple membership changes to the changes topic
+func (p *Producer) ProduceMembershipChanges(ctx context.Context, changes []*membership.MembershipChange) error {
+	messages := make([]kafka.Message, len(changes))
+	for i, change := range changes {
+		value, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{
+			Key:   []byte(change.UserID),
+			Value: value,
+			Time:  time.Now(),
+		}
+	}
+
+	return p.changesWriter.WriteMessages(ctx, messages...)
+}
+
+// Brokers returns the broker addresses each topic's writer connects to
+func (p *Producer) Brokers() map[string][]string {
+	brokers := make(map[string][]string, 3)
+	for _, w := range []*kafka.Writer{p.eventsWriter, p.cohortsWriter, p.changesWriter} {
+		brokers[w.Topic] = strings.Split(w.Addr.String(), ",")
+	}
+	return brokers
+}
+
 // Close closes all writers
 func (p *Producer) Close() error {
 	if err := p.eventsWriter.Close(); err != nil {
 		return err
 	}
-	return p.cohortsWriter.Close()
+	if err := p.cohortsWriter.Close(); err != nil {
+		return err
+	}
+	return p.changesWriter.Close()
 }
 
 func intToBytes(i int64) []byte {
@@ -0,0 +1,33 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/pjhul/intent/internal/config"
+	"github.com/segmentio/kafka-go"
+)
+
+// NewReaderConfig returns the configuration for a manually committed consumer
+// group reader starting at startOffset when the group has no commits
+func NewReaderConfig(brokers []string, topic, groupID string, startOffset config.StartOffset) kafka.ReaderConfig {
+	offset := kafka.FirstOffset
+	if startOffset == config.StartOffsetLatest {
+		offset = kafka.LastOffset
+	}
+
+	return kafka.ReaderConfig{
+		Brokers:        brokers,
+		Topic:          topic,
+		GroupID:        groupID,
+		MinBytes:       1,
+		MaxBytes:       10e6, // 10MB
+		CommitInterval: 0,    // Manual commits
+		StartOffset:    offset,
+		// Rejoin the group when partitions are added, and keep retrying
+		// through a broker outage instead of failing the fetch loop
+		WatchPartitionChanges: true,
+		MaxAttempts:           10,
+		ReadBackoffMin:        100 * time.Millisecond,
+		ReadBackoffMax:        5 * time.Second,
+	}
+}
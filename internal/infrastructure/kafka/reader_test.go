@@ -0,0 +1,32 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestNewReaderConfig_StartOffset(t *testing.T) {
+	tests := []struct {
+		name        string
+		startOffset config.StartOffset
+		expected    int64
+	}{
+		{"earliest", config.StartOffsetEarliest, kafkago.FirstOffset},
+		{"latest", config.StartOffsetLatest, kafkago.LastOffset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := kafka.NewReaderConfig([]string{"localhost:9092"}, "events.raw", "inserter-events", tt.startOffset)
+			if cfg.StartOffset != tt.expected {
+				t.Errorf("StartOffset = %d, expected %d", cfg.StartOffset, tt.expected)
+			}
+			if cfg.GroupID != "inserter-events" || cfg.Topic != "events.raw" {
+				t.Errorf("GroupID, Topic = %q, %q, expected inserter-events, events.raw", cfg.GroupID, cfg.Topic)
+			}
+		})
+	}
+}
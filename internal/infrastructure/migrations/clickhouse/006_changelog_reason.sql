@@ -0,0 +1,4 @@
+-- ClickHouse migration: Record why each membership change happened
+-- Rows written before this migration have an empty reason
+
+ALTER TABLE cohort.cohort_membership_changelog ADD COLUMN IF NOT EXISTS reason LowCardinality(String) DEFAULT '' AFTER trigger_event_id;
@@ -0,0 +1,12 @@
+-- ClickHouse migration: cohort_membership_overrides table
+-- Records users manually placed in or removed from a cohort. The latest row
+-- per user wins; status 0 clears the override.
+
+CREATE TABLE IF NOT EXISTS cohort.cohort_membership_overrides (
+    cohort_id UUID,
+    user_id String,
+    status Int8,
+    created_at DateTime64(3, 'UTC')
+) ENGINE = ReplacingMergeTree(created_at)
+ORDER BY (cohort_id, user_id)
+SETTINGS index_granularity = 8192;
@@ -0,0 +1,40 @@
+-- ClickHouse migration: cohort_membership_state table
+-- Current membership as a ReplacingMergeTree keyed by (cohort_id, user_id),
+-- so reads take the latest status with argMax(status, version) instead of
+-- summing signs. It's fed from cohort_membership_current by a materialized
+-- view, so writers don't change; later rows in an insert get higher versions.
+
+CREATE TABLE IF NOT EXISTS cohort.cohort_membership_state (
+    cohort_id UUID,
+    project_id UUID,
+    user_id String,
+    status Int8,
+    joined_at DateTime64(3, 'UTC'),
+    version UInt64
+) ENGINE = ReplacingMergeTree(version)
+ORDER BY (cohort_id, user_id)
+SETTINGS index_granularity = 8192;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS cohort.cohort_membership_state_mv
+TO cohort.cohort_membership_state
+AS SELECT
+    cohort_id,
+    project_id,
+    user_id,
+    sign AS status,
+    joined_at,
+    toUInt64(toUnixTimestamp64Nano(now64(9))) + rowNumberInBlock() AS version
+FROM cohort.cohort_membership_current;
+
+-- Backfill existing memberships at version 0 so rows written through the
+-- view since it was created take precedence
+INSERT INTO cohort.cohort_membership_state (cohort_id, project_id, user_id, status, joined_at, version)
+SELECT
+    cohort_id,
+    any(project_id),
+    user_id,
+    if(sum(sign) > 0, 1, -1),
+    if(sum(sign) > 0, maxIf(joined_at, sign > 0), max(joined_at)),
+    0
+FROM cohort.cohort_membership_current
+GROUP BY cohort_id, user_id;
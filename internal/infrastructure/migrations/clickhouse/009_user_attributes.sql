@@ -0,0 +1,11 @@
+-- ClickHouse migration: user_attributes table
+-- Profile attributes that don't arrive as events, e.g. plan or signup date,
+-- stored as a JSON object per user. The latest row per user wins.
+
+CREATE TABLE IF NOT EXISTS cohort.user_attributes (
+    user_id String,
+    attributes String,
+    updated_at DateTime64(3, 'UTC') DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY user_id
+SETTINGS index_granularity = 8192;
@@ -0,0 +1,15 @@
+-- ClickHouse migration: cohort_membership_snapshots table
+-- Periodic copies of every cohort's current members. Point-in-time lookups
+-- start from the nearest snapshot and replay only the changelog after it,
+-- and can reach back past the changelog's TTL.
+
+CREATE TABLE IF NOT EXISTS cohort.cohort_membership_snapshots (
+    snapshot_at DateTime64(3, 'UTC'),
+    cohort_id UUID,
+    user_id String,
+    joined_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(snapshot_at)
+ORDER BY (cohort_id, snapshot_at, user_id)
+TTL toDate(snapshot_at) + INTERVAL 365 DAY
+SETTINGS index_granularity = 8192;
@@ -0,0 +1,12 @@
+-- ClickHouse migration: user_scores table
+-- Per-user scores such as RFM computed periodically by the score worker and
+-- compared by score conditions. The latest row per user and score wins.
+
+CREATE TABLE IF NOT EXISTS cohort.user_scores (
+    user_id String,
+    score_name LowCardinality(String),
+    score Float64,
+    computed_at DateTime64(3, 'UTC') DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(computed_at)
+ORDER BY (score_name, user_id)
+SETTINGS index_granularity = 8192;
@@ -0,0 +1,5 @@
+-- ClickHouse migration: Order events with identical timestamps deterministically
+-- sequence is stamped at ingest and increases per user. Rows written before
+-- this migration have sequence 0 and tie on timestamp as before.
+
+ALTER TABLE cohort.events_raw ADD COLUMN IF NOT EXISTS sequence UInt64 DEFAULT 0 AFTER received_at;
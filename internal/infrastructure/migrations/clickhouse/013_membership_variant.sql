@@ -0,0 +1,25 @@
+-- ClickHouse migration: Record the experiment variant of each membership
+-- The variant is assigned when a user joins a cohort with variants. Rows
+-- written before this migration, and memberships of cohorts without
+-- variants, have an empty variant.
+
+ALTER TABLE cohort.cohort_membership_current ADD COLUMN IF NOT EXISTS variant LowCardinality(String) DEFAULT '' AFTER user_id;
+
+ALTER TABLE cohort.cohort_membership_state ADD COLUMN IF NOT EXISTS variant LowCardinality(String) DEFAULT '' AFTER user_id;
+
+ALTER TABLE cohort.cohort_membership_changelog ADD COLUMN IF NOT EXISTS variant LowCardinality(String) DEFAULT '' AFTER user_id;
+
+-- Recreate the state view so it carries the variant
+DROP VIEW IF EXISTS cohort.cohort_membership_state_mv;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS cohort.cohort_membership_state_mv
+TO cohort.cohort_membership_state
+AS SELECT
+    cohort_id,
+    project_id,
+    user_id,
+    variant,
+    sign AS status,
+    joined_at,
+    toUInt64(toUnixTimestamp64Nano(now64(9))) + rowNumberInBlock() AS version
+FROM cohort.cohort_membership_current;
@@ -9,9 +9,14 @@ import (
 	"strings"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
 )
 
+// clickhouseDatabase is the shared database the ClickHouse migrations target
+const clickhouseDatabase = "cohort"
+
 //go:embed clickhouse/*.sql
 var clickhouseMigrations embed.FS
 
@@ -120,15 +125,47 @@ func (r *MigrationRunner) runPostgresMigrations(ctx context.Context) error {
 
 func (r *MigrationRunner) runClickHouseMigrations(ctx context.Context) error {
 	log.Println("Running ClickHouse migrations...")
+	if err := r.migrateClickHouseDatabase(ctx, clickhouseDatabase); err != nil {
+		return err
+	}
+	log.Println("ClickHouse migrations complete")
+	return nil
+}
+
+// ProvisionProject creates a project's isolated ClickHouse database and runs
+// the ClickHouse migrations in it
+func (r *MigrationRunner) ProvisionProject(ctx context.Context, projectID uuid.UUID) error {
+	database := clickhouse.ProjectDatabase(projectID)
+	log.Printf("Provisioning ClickHouse database %s...", database)
+	if err := r.migrateClickHouseDatabase(ctx, database); err != nil {
+		return fmt.Errorf("failed to provision %s: %w", database, err)
+	}
+	return nil
+}
 
+// ApplyEventRetention sets the TTL of the events_raw table in a project's
+// isolated ClickHouse database
+func (r *MigrationRunner) ApplyEventRetention(ctx context.Context, projectID uuid.UUID, days int) error {
+	database := clickhouse.ProjectDatabase(projectID)
+	query := fmt.Sprintf("ALTER TABLE %s.events_raw MODIFY TTL event_date + INTERVAL %d DAY", database, days)
+	if err := r.chConn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to set events_raw TTL in %s: %w", database, err)
+	}
+	return nil
+}
+
+// migrateClickHouseDatabase runs the ClickHouse migrations against database.
+// Migrations are written against the shared cohort database and retargeted by
+// rewriting their table qualifiers.
+func (r *MigrationRunner) migrateClickHouseDatabase(ctx context.Context, database string) error {
 	// Create database if not exists
-	if err := r.chConn.Exec(ctx, "CREATE DATABASE IF NOT EXISTS cohort"); err != nil {
+	if err := r.chConn.Exec(ctx, "CREATE DATABASE IF NOT EXISTS "+database); err != nil {
 		return fmt.Errorf("failed to create database: %w", err)
 	}
 
 	// Create migrations table if not exists
 	err := r.chConn.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS cohort.schema_migrations (
+		CREATE TABLE IF NOT EXISTS `+database+`.schema_migrations (
 			version String,
 			applied_at DateTime64(3) DEFAULT now64(3)
 		) ENGINE = MergeTree()
@@ -159,7 +196,7 @@ func (r *MigrationRunner) runClickHouseMigrations(ctx context.Context) error {
 
 		// Check if already applied
 		var count uint64
-		row := r.chConn.QueryRow(ctx, "SELECT count() FROM cohort.schema_migrations WHERE version = ?", version)
+		row := r.chConn.QueryRow(ctx, "SELECT count() FROM "+database+".schema_migrations WHERE version = ?", version)
 		if err := row.Scan(&count); err != nil {
 			return fmt.Errorf("failed to check migration status: %w", err)
 		}
@@ -178,7 +215,7 @@ func (r *MigrationRunner) runClickHouseMigrations(ctx context.Context) error {
 		log.Printf("  [run]  %s", version)
 
 		// Execute each statement (split by semicolons)
-		statements := splitStatements(string(content))
+		statements := splitStatements(retarget(string(content), database))
 		for _, stmt := range statements {
 			stmt = strings.TrimSpace(stmt)
 			if stmt == "" {
@@ -190,16 +227,23 @@ func (r *MigrationRunner) runClickHouseMigrations(ctx context.Context) error {
 		}
 
 		// Record migration
-		err = r.chConn.Exec(ctx, "INSERT INTO cohort.schema_migrations (version) VALUES (?)", version)
+		err = r.chConn.Exec(ctx, "INSERT INTO "+database+".schema_migrations (version) VALUES (?)", version)
 		if err != nil {
 			return fmt.Errorf("failed to record migration %s: %w", file, err)
 		}
 	}
 
-	log.Println("ClickHouse migrations complete")
 	return nil
 }
 
+// retarget rewrites a migration's cohort database qualifiers to database
+func retarget(content, database string) string {
+	if database == clickhouseDatabase {
+		return content
+	}
+	return strings.ReplaceAll(content, clickhouseDatabase+".", database+".")
+}
+
 func splitStatements(content string) []string {
 	var statements []string
 	var current strings.Builder
@@ -0,0 +1,68 @@
+package migrations_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/infrastructure/migrations"
+)
+
+// fakeConn records statements and reports every migration as unapplied
+type fakeConn struct {
+	driver.Conn
+	statements []string
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.statements = append(c.statements, query)
+	return nil
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	c.statements = append(c.statements, query)
+	return fakeRow{}
+}
+
+type fakeRow struct {
+	driver.Row
+}
+
+func (fakeRow) Scan(dest ...any) error {
+	*dest[0].(*uint64) = 0
+	return nil
+}
+
+func TestMigrationRunner_ProvisionProject(t *testing.T) {
+	projectID := uuid.New()
+	database := clickhouse.ProjectDatabase(projectID)
+	conn := &fakeConn{}
+
+	if err := migrations.NewMigrationRunner(nil, conn).ProvisionProject(context.Background(), projectID); err != nil {
+		t.Fatalf("ProvisionProject() error = %v", err)
+	}
+
+	t.Run("creates the project database", func(t *testing.T) {
+		if len(conn.statements) == 0 || conn.statements[0] != "CREATE DATABASE IF NOT EXISTS "+database {
+			t.Errorf("first statement = %q, expected the project database to be created", conn.statements)
+		}
+	})
+
+	t.Run("creates tables in the project database", func(t *testing.T) {
+		created := false
+		for _, stmt := range conn.statements {
+			if strings.Contains(stmt, "cohort.") {
+				t.Errorf("statement %q targets the shared database", stmt)
+			}
+			if strings.Contains(stmt, "CREATE TABLE IF NOT EXISTS "+database+".events_raw") {
+				created = true
+			}
+		}
+		if !created {
+			t.Errorf("no statement created %s.events_raw", database)
+		}
+	})
+}
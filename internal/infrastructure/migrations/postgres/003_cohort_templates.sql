@@ -0,0 +1,22 @@
+-- Reusable cohort rule templates with named parameters
+CREATE TABLE IF NOT EXISTS cohort_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    rules JSONB NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(project_id, name)
+);
+
+-- Index for querying templates by project
+CREATE INDEX IF NOT EXISTS idx_cohort_templates_project_id ON cohort_templates(project_id);
+
+-- Trigger for updated_at on cohort_templates
+DROP TRIGGER IF EXISTS update_cohort_templates_updated_at ON cohort_templates;
+CREATE TRIGGER update_cohort_templates_updated_at
+    BEFORE UPDATE ON cohort_templates
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
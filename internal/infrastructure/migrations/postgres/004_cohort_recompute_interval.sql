@@ -0,0 +1,2 @@
+-- Per-cohort scheduled recompute cadence; NULL disables scheduled recomputes
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS recompute_interval INTERVAL;
@@ -0,0 +1,2 @@
+-- Set when a cohort's rules change and cleared once a recompute of that version completes
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS needs_recompute BOOLEAN NOT NULL DEFAULT FALSE;
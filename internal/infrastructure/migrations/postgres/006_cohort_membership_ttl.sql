@@ -0,0 +1,2 @@
+-- Per-cohort membership lifetime measured from joined_at; NULL derives it from the rules' time windows
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS membership_ttl INTERVAL;
@@ -0,0 +1,23 @@
+-- Recurring exports of a cohort's members to a destination on a cron schedule
+CREATE TABLE IF NOT EXISTS cohort_export_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cohort_id UUID NOT NULL REFERENCES cohorts(id) ON DELETE CASCADE,
+    destination TEXT NOT NULL,
+    cron VARCHAR(100) NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    last_status VARCHAR(20),
+    last_error TEXT,
+    last_exported_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for querying schedules by cohort
+CREATE INDEX IF NOT EXISTS idx_cohort_export_schedules_cohort_id ON cohort_export_schedules(cohort_id);
+
+-- Trigger for updated_at on cohort_export_schedules
+DROP TRIGGER IF EXISTS update_cohort_export_schedules_updated_at ON cohort_export_schedules;
+CREATE TRIGGER update_cohort_export_schedules_updated_at
+    BEFORE UPDATE ON cohort_export_schedules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,18 @@
+-- Finished recompute jobs, kept so durations can be estimated from past runs
+-- after the worker's in-memory jobs are purged or the service restarts
+CREATE TABLE IF NOT EXISTS recompute_job_history (
+    id UUID PRIMARY KEY,
+    cohort_id UUID NOT NULL REFERENCES cohorts(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    members_found BIGINT NOT NULL DEFAULT 0,
+    members_added BIGINT NOT NULL DEFAULT 0,
+    members_removed BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for querying a cohort's most recent jobs
+CREATE INDEX IF NOT EXISTS idx_recompute_job_history_cohort_completed ON recompute_job_history(cohort_id, completed_at DESC);
@@ -0,0 +1,2 @@
+-- Per-cohort switch for streaming membership changes to SSE, WebSocket and gRPC subscribers
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS stream_enabled BOOLEAN NOT NULL DEFAULT TRUE;
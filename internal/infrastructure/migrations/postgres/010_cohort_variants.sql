@@ -0,0 +1,2 @@
+-- Experiment variants members of a cohort are split between, as a JSON array of {name, weight}
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
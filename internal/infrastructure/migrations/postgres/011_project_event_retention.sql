@@ -0,0 +1,2 @@
+-- Days a project's events are kept; NULL uses the service-wide default
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS event_retention_days INTEGER;
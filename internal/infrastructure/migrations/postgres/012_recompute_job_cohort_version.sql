@@ -0,0 +1,6 @@
+-- Cohort version each recompute job computed membership for, so membership
+-- can be looked up as of a version
+ALTER TABLE recompute_job_history ADD COLUMN IF NOT EXISTS cohort_version BIGINT NOT NULL DEFAULT 0;
+
+-- Index for finding a version's recomputes
+CREATE INDEX IF NOT EXISTS idx_recompute_job_history_cohort_version ON recompute_job_history(cohort_id, cohort_version, completed_at DESC);
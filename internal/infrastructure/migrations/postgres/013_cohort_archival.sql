@@ -0,0 +1,3 @@
+-- When a cohort was deleted. Deleted cohorts are archived rather than removed
+-- so they can be restored.
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- Whether a cohort's membership is computed from its rules or uploaded as a
+-- static list of users
+ALTER TABLE cohorts ADD COLUMN IF NOT EXISTS cohort_type VARCHAR(20) NOT NULL DEFAULT 'rules';
@@ -1,6 +1,8 @@
 package inserter
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -11,11 +13,24 @@ import (
 type Config struct {
 	BatchSize                   int                     `envconfig:"BATCH_SIZE" default:"1000"`
 	FlushInterval               time.Duration           `envconfig:"FLUSH_INTERVAL_MS" default:"5000ms"`
+	// EventsInsertWorkers is how many ClickHouse inserts each events batch is split across
+	EventsInsertWorkers int `envconfig:"EVENTS_INSERT_WORKERS" default:"1"`
+	// PreserveUserOrder keeps each user's events in one insert, appended in timestamp order
+	PreserveUserOrder bool `envconfig:"EVENTS_PRESERVE_USER_ORDER" default:"true"`
 	KafkaBrokers                []string                `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
+	// KafkaConnectTimeout bounds the startup check that at least one broker is reachable
+	KafkaConnectTimeout time.Duration `envconfig:"KAFKA_CONNECT_TIMEOUT" default:"10s"`
 	EventsTopic                 string                  `envconfig:"KAFKA_EVENTS_TOPIC" default:"events.raw"`
 	MembershipTopic             string                  `envconfig:"KAFKA_MEMBERSHIP_TOPIC" default:"cohort.membership"`
 	EventsConsumerGroup         string                  `envconfig:"KAFKA_EVENTS_CONSUMER_GROUP" default:"inserter-events"`
 	MembershipConsumerGroup     string                  `envconfig:"KAFKA_MEMBERSHIP_CONSUMER_GROUP" default:"inserter-membership"`
+	// ChangelogExportEnabled exports raw user IDs: the inserter can't resolve
+	// cohort projects to anonymize them, so deployments with
+	// PRIVACY_ANONYMIZE_USER_IDS must export from the cohort service instead
+	ChangelogExportEnabled bool `envconfig:"KAFKA_CHANGELOG_EXPORT_ENABLED" default:"false"`
+	ChangelogExportTopic        string                  `envconfig:"KAFKA_CHANGELOG_EXPORT_TOPIC" default:"cohort.changelog"`
+	// StartOffset is where new consumer groups start; use latest on a fresh deploy to skip history
+	StartOffset config.StartOffset `envconfig:"KAFKA_START_OFFSET" default:"earliest"`
 	ClickHouse                  config.ClickHouseConfig `envconfig:"CLICKHOUSE"`
 }
 
@@ -27,3 +42,42 @@ func Load() (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// Validate checks ranges and required fields, returning a *config.ValidationError
+// listing every problem
+func (c *Config) Validate() error {
+	var problems []string
+	if c.BatchSize <= 0 {
+		problems = append(problems, fmt.Sprintf("BATCH_SIZE must be positive, got %d", c.BatchSize))
+	}
+	if c.FlushInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("FLUSH_INTERVAL_MS must be positive, got %s", c.FlushInterval))
+	}
+	if c.EventsInsertWorkers <= 0 {
+		problems = append(problems, fmt.Sprintf("EVENTS_INSERT_WORKERS must be positive, got %d", c.EventsInsertWorkers))
+	}
+	problems = append(problems, config.ValidateBrokers(c.KafkaBrokers)...)
+	if c.KafkaConnectTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("KAFKA_CONNECT_TIMEOUT must be positive, got %s", c.KafkaConnectTimeout))
+	}
+	required := []struct{ name, value string }{
+		{"KAFKA_EVENTS_TOPIC", c.EventsTopic},
+		{"KAFKA_MEMBERSHIP_TOPIC", c.MembershipTopic},
+		{"KAFKA_EVENTS_CONSUMER_GROUP", c.EventsConsumerGroup},
+		{"KAFKA_MEMBERSHIP_CONSUMER_GROUP", c.MembershipConsumerGroup},
+	}
+	if c.ChangelogExportEnabled {
+		required = append(required, struct{ name, value string }{"KAFKA_CHANGELOG_EXPORT_TOPIC", c.ChangelogExportTopic})
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			problems = append(problems, r.name+" is required")
+		}
+	}
+	problems = append(problems, config.Problems(c.ClickHouse.Validate())...)
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &config.ValidationError{Problems: problems}
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pjhul/intent/internal/config"
 	"github.com/pjhul/intent/internal/inserter"
 )
 
@@ -18,6 +19,7 @@ func TestLoad_Defaults(t *testing.T) {
 		"KAFKA_MEMBERSHIP_TOPIC",
 		"KAFKA_EVENTS_CONSUMER_GROUP",
 		"KAFKA_MEMBERSHIP_CONSUMER_GROUP",
+		"KAFKA_START_OFFSET",
 	}
 	for _, env := range envVars {
 		os.Unsetenv(env)
@@ -55,6 +57,14 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.MembershipConsumerGroup != "inserter-membership" {
 		t.Errorf("MembershipConsumerGroup = %q, expected %q", cfg.MembershipConsumerGroup, "inserter-membership")
 	}
+
+	if cfg.EventsInsertWorkers != 1 || !cfg.PreserveUserOrder {
+		t.Errorf("EventsInsertWorkers/PreserveUserOrder = %d/%t, expected 1/true", cfg.EventsInsertWorkers, cfg.PreserveUserOrder)
+	}
+
+	if cfg.StartOffset != config.StartOffsetEarliest {
+		t.Errorf("StartOffset = %q, expected %q", cfg.StartOffset, config.StartOffsetEarliest)
+	}
 }
 
 func TestLoad_CustomValues(t *testing.T) {
@@ -139,3 +149,107 @@ func TestConfig_FlushIntervalParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_StartOffset(t *testing.T) {
+	t.Run("latest", func(t *testing.T) {
+		os.Setenv("KAFKA_START_OFFSET", "latest")
+		defer os.Unsetenv("KAFKA_START_OFFSET")
+
+		cfg, err := inserter.Load()
+		if err != nil {
+			t.Fatalf("Load() returned error: %v", err)
+		}
+		if cfg.StartOffset != config.StartOffsetLatest {
+			t.Errorf("StartOffset = %q, expected %q", cfg.StartOffset, config.StartOffsetLatest)
+		}
+	})
+
+	t.Run("invalid value is rejected", func(t *testing.T) {
+		os.Setenv("KAFKA_START_OFFSET", "newest")
+		defer os.Unsetenv("KAFKA_START_OFFSET")
+
+		if _, err := inserter.Load(); err == nil {
+			t.Error("Load() expected error for invalid start offset")
+		}
+	})
+}
+
+func TestConfig_ClickHouseProtocol(t *testing.T) {
+	t.Run("defaults to native", func(t *testing.T) {
+		os.Unsetenv("CLICKHOUSE_PROTOCOL")
+
+		cfg, err := inserter.Load()
+		if err != nil {
+			t.Fatalf("Load() returned error: %v", err)
+		}
+		if cfg.ClickHouse.Protocol != config.ClickHouseNative {
+			t.Errorf("Protocol = %q, expected %q", cfg.ClickHouse.Protocol, config.ClickHouseNative)
+		}
+		if cfg.ClickHouse.UseTLS() {
+			t.Error("UseTLS() = true, expected false")
+		}
+	})
+
+	t.Run("https with TLS options", func(t *testing.T) {
+		os.Setenv("CLICKHOUSE_PROTOCOL", "https")
+		os.Setenv("CLICKHOUSE_TLS_SERVER_NAME", "ch.internal")
+		defer func() {
+			os.Unsetenv("CLICKHOUSE_PROTOCOL")
+			os.Unsetenv("CLICKHOUSE_TLS_SERVER_NAME")
+		}()
+
+		cfg, err := inserter.Load()
+		if err != nil {
+			t.Fatalf("Load() returned error: %v", err)
+		}
+		if cfg.ClickHouse.Protocol != config.ClickHouseHTTPS {
+			t.Errorf("Protocol = %q, expected %q", cfg.ClickHouse.Protocol, config.ClickHouseHTTPS)
+		}
+		if !cfg.ClickHouse.UseTLS() {
+			t.Error("UseTLS() = false, expected true for https")
+		}
+		if cfg.ClickHouse.TLSServerName != "ch.internal" {
+			t.Errorf("TLSServerName = %q, expected ch.internal", cfg.ClickHouse.TLSServerName)
+		}
+	})
+
+	t.Run("invalid protocol is rejected", func(t *testing.T) {
+		os.Setenv("CLICKHOUSE_PROTOCOL", "grpc")
+		defer os.Unsetenv("CLICKHOUSE_PROTOCOL")
+
+		if _, err := inserter.Load(); err == nil {
+			t.Error("Load() expected error for invalid protocol")
+		}
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg, err := inserter.Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, expected nil for the defaults", err)
+	}
+
+	cfg.BatchSize = 0
+	cfg.EventsInsertWorkers = 0
+	cfg.KafkaBrokers = []string{}
+	cfg.ClickHouse.Port = -1
+
+	problems := config.Problems(cfg.Validate())
+	expected := []string{
+		"BATCH_SIZE must be positive, got 0",
+		"EVENTS_INSERT_WORKERS must be positive, got 0",
+		"KAFKA_BROKERS must list at least one broker",
+		"CLICKHOUSE_PORT must be between 1 and 65535, got -1",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("problems = %q, expected %q", problems, expected)
+	}
+	for i, want := range expected {
+		if problems[i] != want {
+			t.Errorf("problems[%d] = %q, expected %q", i, problems[i], want)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"log"
 
-	"github.com/segmentio/kafka-go"
+	"github.com/pjhul/intent/internal/config"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
+	kafkago "github.com/segmentio/kafka-go"
 )
 
 // MessageHandler processes a message and returns an error if processing fails
@@ -13,21 +15,14 @@ type MessageHandler[T any] func(ctx context.Context, msg T) error
 
 // Consumer wraps a Kafka consumer with message handling
 type Consumer[T any] struct {
-	reader  *kafka.Reader
+	reader  *kafkago.Reader
 	handler MessageHandler[T]
 	name    string
 }
 
 // NewConsumer creates a new Kafka consumer
-func NewConsumer[T any](brokers []string, topic, groupID, name string, handler MessageHandler[T]) *Consumer[T] {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          topic,
-		GroupID:        groupID,
-		MinBytes:       1,
-		MaxBytes:       10e6, // 10MB
-		CommitInterval: 0,    // Manual commits
-	})
+func NewConsumer[T any](brokers []string, topic, groupID string, startOffset config.StartOffset, name string, handler MessageHandler[T]) *Consumer[T] {
+	reader := kafkago.NewReader(kafka.NewReaderConfig(brokers, topic, groupID, startOffset))
 
 	return &Consumer[T]{
 		reader:  reader,
@@ -1,37 +1,151 @@
 package inserter
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
+	"hash/fnv"
 	"log"
+	"slices"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/tenant"
 )
 
 // EventsInserter handles batch insertion of events into ClickHouse
 type EventsInserter struct {
 	client BatchPreparer
+
+	workers           int
+	preserveUserOrder bool
 }
 
 // NewEventsInserter creates a new events inserter
 func NewEventsInserter(client *clickhouse.Client) *EventsInserter {
-	return &EventsInserter{client: &clickhouseBatchPreparer{client: client}}
+	return &EventsInserter{client: &clickhouseBatchPreparer{client: client}, workers: 1}
 }
 
 // NewEventsInserterWithClient creates a new events inserter with a custom BatchPreparer (for testing)
 func NewEventsInserterWithClient(client BatchPreparer) *EventsInserter {
-	return &EventsInserter{client: client}
+	return &EventsInserter{client: client, workers: 1}
+}
+
+// SetConcurrency splits each batch across up to workers ClickHouse inserts
+// run at once. With preserveUserOrder set, all of a user's events go to the
+// same insert and are appended in timestamp order, so sequence conditions see
+// them in the order they happened. Together with the producer keying events
+// by user and one consumer per partition, a user's events then reach
+// ClickHouse in order.
+func (i *EventsInserter) SetConcurrency(workers int, preserveUserOrder bool) {
+	i.workers = max(workers, 1)
+	i.preserveUserOrder = preserveUserOrder
 }
 
-// InsertBatch inserts a batch of events into ClickHouse
+// InsertBatch inserts a batch of events into ClickHouse, one ClickHouse batch
+// per project so each lands in its project's database when isolated
 func (i *EventsInserter) InsertBatch(ctx context.Context, events []RawEvent) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	batch, err := i.client.PrepareBatch(ctx, `
-		INSERT INTO events_raw (id, user_id, event_name, properties, timestamp, received_at)
-	`)
+	var projects []uuid.UUID
+	byProject := make(map[uuid.UUID][]RawEvent)
+	for _, e := range events {
+		if _, ok := byProject[e.ProjectID]; !ok {
+			projects = append(projects, e.ProjectID)
+		}
+		byProject[e.ProjectID] = append(byProject[e.ProjectID], e)
+	}
+
+	for _, projectID := range projects {
+		if err := i.insertBatch(tenant.WithProject(ctx, projectID), byProject[projectID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertBatch inserts a project's events, running one insert per shard at
+// once
+func (i *EventsInserter) insertBatch(ctx context.Context, events []RawEvent) error {
+	shards := i.shard(events)
+	if len(shards) == 1 {
+		return i.insertShard(ctx, shards[0])
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(shards))
+	for n, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[n] = i.insertShard(ctx, shard)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// shard splits events across the inserter's workers, dropping empty shards.
+// When user order is preserved, events are sorted by timestamp and each user
+// is assigned a shard by hash; otherwise they are dealt round robin.
+func (i *EventsInserter) shard(events []RawEvent) [][]RawEvent {
+	if i.preserveUserOrder {
+		events = slices.Clone(events)
+		slices.SortStableFunc(events, func(a, b RawEvent) int {
+			return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.Sequence, b.Sequence))
+		})
+	}
+	if i.workers <= 1 {
+		return [][]RawEvent{events}
+	}
+
+	shards := make([][]RawEvent, i.workers)
+	for n, e := range events {
+		if i.preserveUserOrder {
+			h := fnv.New32a()
+			h.Write([]byte(e.UserID))
+			n = int(h.Sum32() % uint32(i.workers))
+		}
+		shards[n%i.workers] = append(shards[n%i.workers], e)
+	}
+	return slices.DeleteFunc(shards, func(s []RawEvent) bool { return len(s) == 0 })
+}
+
+// insertShard inserts events in ClickHouse batches. Events without
+// ReceivedAt go in their own batch so ClickHouse stamps received_at at insert
+// time; order is kept within each batch.
+func (i *EventsInserter) insertShard(ctx context.Context, events []RawEvent) error {
+	var stamped, overridden []RawEvent
+	for _, e := range events {
+		if e.ReceivedAt.IsZero() {
+			stamped = append(stamped, e)
+		} else {
+			overridden = append(overridden, e)
+		}
+	}
+
+	if err := i.sendBatch(ctx, stamped, false); err != nil {
+		return err
+	}
+	return i.sendBatch(ctx, overridden, true)
+}
+
+// sendBatch inserts events in a single ClickHouse batch, writing received_at
+// only when withReceivedAt is set
+func (i *EventsInserter) sendBatch(ctx context.Context, events []RawEvent, withReceivedAt bool) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence)`
+	if withReceivedAt {
+		query = `INSERT INTO events_raw (id, project_id, user_id, event_name, properties, timestamp, sequence, received_at)`
+	}
+	batch, err := i.client.PrepareBatch(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -43,7 +157,11 @@ func (i *EventsInserter) InsertBatch(ctx context.Context, events []RawEvent) err
 			props = []byte("{}")
 		}
 
-		if err := batch.Append(e.ID, e.UserID, e.EventName, string(props), e.Timestamp, e.ReceivedAt); err != nil {
+		args := []any{e.ID, e.ProjectID, e.UserID, e.EventName, string(props), e.Timestamp, e.Sequence}
+		if withReceivedAt {
+			args = append(args, e.ReceivedAt)
+		}
+		if err := batch.Append(args...); err != nil {
 			return err
 		}
 	}
@@ -3,6 +3,7 @@ package inserter_test
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -43,7 +44,7 @@ func TestEventsInserter_InsertBatch_Success(t *testing.T) {
 		Return(mockBatch, nil)
 
 	mockBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(2)
 
@@ -128,7 +129,7 @@ func TestEventsInserter_InsertBatch_AppendError(t *testing.T) {
 		Return(mockBatch, nil)
 
 	mockBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(expectedErr)
 
 	inserterSvc := inserter.NewEventsInserterWithClient(mockClient)
@@ -162,7 +163,7 @@ func TestEventsInserter_InsertBatch_SendError(t *testing.T) {
 		Return(mockBatch, nil)
 
 	mockBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockBatch.EXPECT().
@@ -200,7 +201,7 @@ func TestEventsInserter_InsertBatch_NilProperties(t *testing.T) {
 		Return(mockBatch, nil)
 
 	mockBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockBatch.EXPECT().
@@ -247,7 +248,7 @@ func TestEventsInserter_InsertBatch_ComplexProperties(t *testing.T) {
 		Return(mockBatch, nil)
 
 	mockBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockBatch.EXPECT().
@@ -261,3 +262,76 @@ func TestEventsInserter_InsertBatch_ComplexProperties(t *testing.T) {
 		t.Errorf("InsertBatch returned error: %v", err)
 	}
 }
+
+// recordingPreparer records the events appended to each batch it prepares
+type recordingPreparer struct {
+	mu      sync.Mutex
+	batches []*recordingBatch
+}
+
+func (p *recordingPreparer) PrepareBatch(ctx context.Context, query string) (inserter.InserterBatch, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := &recordingBatch{}
+	p.batches = append(p.batches, b)
+	return b, nil
+}
+
+type recordingBatch struct {
+	rows [][]any
+}
+
+func (b *recordingBatch) Append(args ...any) error {
+	b.rows = append(b.rows, args)
+	return nil
+}
+
+func (b *recordingBatch) Send() error { return nil }
+
+func TestEventsInserter_InsertBatch_PreservesUserOrder(t *testing.T) {
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	var events []inserter.RawEvent
+	// Each user's events arrive out of order, interleaved with other users
+	for _, offset := range []int{5, 1, 4, 0, 3, 2} {
+		for _, userID := range []string{"user-1", "user-2", "user-3", "user-4", "user-5"} {
+			events = append(events, inserter.RawEvent{
+				ID:        uuid.New(),
+				UserID:    userID,
+				EventName: "page_view",
+				Timestamp: base.Add(time.Duration(offset) * time.Minute),
+			})
+		}
+	}
+
+	preparer := &recordingPreparer{}
+	inserterSvc := inserter.NewEventsInserterWithClient(preparer)
+	inserterSvc.SetConcurrency(4, true)
+
+	if err := inserterSvc.InsertBatch(context.Background(), events); err != nil {
+		t.Fatalf("InsertBatch returned error: %v", err)
+	}
+
+	batchOf := make(map[string]int)
+	appended := 0
+	for n, batch := range preparer.batches {
+		last := make(map[string]time.Time)
+		for _, row := range batch.rows {
+			userID, timestamp := row[2].(string), row[5].(time.Time)
+			if prev, ok := batchOf[userID]; ok && prev != n {
+				t.Errorf("%s was inserted in batches %d and %d, expected one", userID, prev, n)
+			}
+			batchOf[userID] = n
+			if timestamp.Before(last[userID]) {
+				t.Errorf("%s appended %v after %v, expected timestamp order", userID, timestamp, last[userID])
+			}
+			last[userID] = timestamp
+			appended++
+		}
+	}
+	if appended != len(events) {
+		t.Errorf("appended = %d, expected %d", appended, len(events))
+	}
+	if len(preparer.batches) < 2 {
+		t.Errorf("batches = %d, expected the users spread across concurrent inserts", len(preparer.batches))
+	}
+}
@@ -17,6 +17,11 @@ type InserterBatch interface {
 	Send() error
 }
 
+// ChangelogProducer publishes changelog entries to external consumers
+type ChangelogProducer interface {
+	ProduceChangelog(ctx context.Context, changes []MembershipChange) error
+}
+
 // clickhouseBatchPreparer wraps the ClickHouse client to implement BatchPreparer
 type clickhouseBatchPreparer struct {
 	client *clickhouse.Client
@@ -2,6 +2,8 @@ package inserter
 
 import (
 	"context"
+	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
@@ -9,7 +11,10 @@ import (
 
 // MembershipInserter handles batch insertion of membership changes into ClickHouse
 type MembershipInserter struct {
-	client BatchPreparer
+	client   BatchPreparer
+	exporter ChangelogProducer
+
+	exportFailures atomic.Int64
 }
 
 // NewMembershipInserter creates a new membership inserter
@@ -22,8 +27,21 @@ func NewMembershipInserterWithClient(client BatchPreparer) *MembershipInserter {
 	return &MembershipInserter{client: client}
 }
 
+// SetChangelogProducer enables exporting every inserted changelog entry
+func (i *MembershipInserter) SetChangelogProducer(exporter ChangelogProducer) {
+	i.exporter = exporter
+}
+
+// ExportFailures returns how many inserted batches failed to be exported
+func (i *MembershipInserter) ExportFailures() int64 {
+	return i.exportFailures.Load()
+}
+
 // InsertBatch inserts a batch of membership changes into ClickHouse
-// It writes to both cohort_membership_current and cohort_membership_changelog
+// It writes to both cohort_membership_current and cohort_membership_changelog.
+// A failed changelog export is logged and counted rather than returned: the
+// batch is already written, and retrying it would append its collapsing rows
+// to cohort_membership_current a second time.
 func (i *MembershipInserter) InsertBatch(ctx context.Context, changes []MembershipChange) error {
 	if len(changes) == 0 {
 		return nil
@@ -39,13 +57,21 @@ func (i *MembershipInserter) InsertBatch(ctx context.Context, changes []Membersh
 		return err
 	}
 
+	// Export the changelog for external consumers
+	if i.exporter != nil {
+		if err := i.exporter.ProduceChangelog(ctx, changes); err != nil {
+			i.exportFailures.Add(1)
+			log.Printf("failed to export %d changelog entries: %v", len(changes), err)
+		}
+	}
+
 	return nil
 }
 
 // insertCurrentBatch inserts membership state into cohort_membership_current
 func (i *MembershipInserter) insertCurrentBatch(ctx context.Context, changes []MembershipChange) error {
 	batch, err := i.client.PrepareBatch(ctx, `
-		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at)
+		INSERT INTO cohort_membership_current (cohort_id, user_id, sign, joined_at, variant)
 	`)
 	if err != nil {
 		return err
@@ -54,7 +80,7 @@ func (i *MembershipInserter) insertCurrentBatch(ctx context.Context, changes []M
 	for _, c := range changes {
 		// CollapsingMergeTree: sign = 1 for join, -1 for leave
 		// NewStatus already has the right values: 1 = in, -1 = out
-		if err := batch.Append(c.CohortID, c.UserID, c.NewStatus, c.ChangedAt); err != nil {
+		if err := batch.Append(c.CohortID, c.UserID, c.NewStatus, c.ChangedAt, c.Variant); err != nil {
 			return err
 		}
 	}
@@ -65,7 +91,7 @@ func (i *MembershipInserter) insertCurrentBatch(ctx context.Context, changes []M
 // insertChangelogBatch inserts all membership changes into cohort_membership_changelog
 func (i *MembershipInserter) insertChangelogBatch(ctx context.Context, changes []MembershipChange) error {
 	batch, err := i.client.PrepareBatch(ctx, `
-		INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id)
+		INSERT INTO cohort_membership_changelog (cohort_id, user_id, prev_status, new_status, changed_at, trigger_event_id, reason, variant)
 	`)
 	if err != nil {
 		return err
@@ -77,7 +103,7 @@ func (i *MembershipInserter) insertChangelogBatch(ctx context.Context, changes [
 			changedAt = time.Now().UTC()
 		}
 
-		if err := batch.Append(c.CohortID, c.UserID, c.PrevStatus, c.NewStatus, changedAt, c.TriggerEvent); err != nil {
+		if err := batch.Append(c.CohortID, c.UserID, c.PrevStatus, c.NewStatus, changedAt, c.TriggerEvent, c.Reason, c.Variant); err != nil {
 			return err
 		}
 	}
@@ -54,7 +54,7 @@ func TestMembershipInserter_InsertBatch_Success(t *testing.T) {
 
 	// Current batch expectations
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(2)
 	mockCurrentBatch.EXPECT().
@@ -63,7 +63,7 @@ func TestMembershipInserter_InsertBatch_Success(t *testing.T) {
 
 	// Changelog batch expectations
 	mockChangelogBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(2)
 	mockChangelogBatch.EXPECT().
@@ -149,7 +149,7 @@ func TestMembershipInserter_InsertBatch_CurrentBatchAppendFail(t *testing.T) {
 		Return(mockCurrentBatch, nil)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(expectedErr)
 
 	inserterSvc := inserter.NewMembershipInserterWithClient(mockClient)
@@ -184,7 +184,7 @@ func TestMembershipInserter_InsertBatch_CurrentBatchSendFail(t *testing.T) {
 		Return(mockCurrentBatch, nil)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockCurrentBatch.EXPECT().
@@ -228,7 +228,7 @@ func TestMembershipInserter_InsertBatch_ChangelogBatchPrepareFail(t *testing.T)
 	)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockCurrentBatch.EXPECT().
@@ -273,7 +273,7 @@ func TestMembershipInserter_InsertBatch_ChangelogBatchAppendFail(t *testing.T) {
 	)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockCurrentBatch.EXPECT().
@@ -281,7 +281,7 @@ func TestMembershipInserter_InsertBatch_ChangelogBatchAppendFail(t *testing.T) {
 		Return(nil)
 
 	mockChangelogBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(expectedErr)
 
 	inserterSvc := inserter.NewMembershipInserterWithClient(mockClient)
@@ -322,7 +322,7 @@ func TestMembershipInserter_InsertBatch_ChangelogBatchSendFail(t *testing.T) {
 	)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockCurrentBatch.EXPECT().
@@ -330,7 +330,7 @@ func TestMembershipInserter_InsertBatch_ChangelogBatchSendFail(t *testing.T) {
 		Return(nil)
 
 	mockChangelogBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockChangelogBatch.EXPECT().
@@ -375,7 +375,7 @@ func TestMembershipInserter_InsertBatch_ZeroTimestamp(t *testing.T) {
 	)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil)
 
 	mockCurrentBatch.EXPECT().
@@ -384,7 +384,7 @@ func TestMembershipInserter_InsertBatch_ZeroTimestamp(t *testing.T) {
 
 	// The changelog batch should receive a non-zero timestamp
 	mockChangelogBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		DoAndReturn(func(args ...any) error {
 			// changedAt should be the 5th argument (index 4)
 			if len(args) >= 5 {
@@ -446,7 +446,7 @@ func TestMembershipInserter_InsertBatch_JoinAndLeave(t *testing.T) {
 	)
 
 	mockCurrentBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(2)
 
@@ -455,7 +455,7 @@ func TestMembershipInserter_InsertBatch_JoinAndLeave(t *testing.T) {
 		Return(nil)
 
 	mockChangelogBatch.EXPECT().
-		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Append(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(2)
 
@@ -470,3 +470,58 @@ func TestMembershipInserter_InsertBatch_JoinAndLeave(t *testing.T) {
 		t.Errorf("InsertBatch returned error: %v", err)
 	}
 }
+
+func TestMembershipInserter_InsertBatch_ExportsChangelog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockBatchPreparer(ctrl)
+	mockBatch := mocks.NewMockInserterBatch(ctrl)
+	mockProducer := mocks.NewMockChangelogProducer(ctrl)
+
+	changes := []inserter.MembershipChange{
+		{CohortID: uuid.New(), UserID: "user1", PrevStatus: -1, NewStatus: 1, ChangedAt: time.Now()},
+		{CohortID: uuid.New(), UserID: "user2", PrevStatus: 1, NewStatus: -1, ChangedAt: time.Now()},
+	}
+
+	mockClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(mockBatch, nil).Times(2)
+	mockBatch.EXPECT().Append(gomock.Any()).Return(nil).Times(4)
+	mockBatch.EXPECT().Send().Return(nil).Times(2)
+	mockProducer.EXPECT().ProduceChangelog(gomock.Any(), changes).Return(nil)
+
+	inserterSvc := inserter.NewMembershipInserterWithClient(mockClient)
+	inserterSvc.SetChangelogProducer(mockProducer)
+
+	if err := inserterSvc.InsertBatch(context.Background(), changes); err != nil {
+		t.Errorf("InsertBatch returned error: %v", err)
+	}
+}
+
+func TestMembershipInserter_InsertBatch_ExportFailureKeepsInsert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockBatchPreparer(ctrl)
+	mockBatch := mocks.NewMockInserterBatch(ctrl)
+	mockProducer := mocks.NewMockChangelogProducer(ctrl)
+
+	changes := []inserter.MembershipChange{
+		{CohortID: uuid.New(), UserID: "user1", PrevStatus: -1, NewStatus: 1, ChangedAt: time.Now()},
+	}
+
+	// Both tables are written once; the export failure doesn't fail the batch
+	mockClient.EXPECT().PrepareBatch(gomock.Any(), gomock.Any()).Return(mockBatch, nil).Times(2)
+	mockBatch.EXPECT().Append(gomock.Any()).Return(nil).Times(2)
+	mockBatch.EXPECT().Send().Return(nil).Times(2)
+	mockProducer.EXPECT().ProduceChangelog(gomock.Any(), changes).Return(errors.New("broker unavailable"))
+
+	inserterSvc := inserter.NewMembershipInserterWithClient(mockClient)
+	inserterSvc.SetChangelogProducer(mockProducer)
+
+	if err := inserterSvc.InsertBatch(context.Background(), changes); err != nil {
+		t.Errorf("InsertBatch returned error: %v", err)
+	}
+	if got := inserterSvc.ExportFailures(); got != 1 {
+		t.Errorf("ExportFailures() = %d, expected 1", got)
+	}
+}
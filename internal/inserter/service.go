@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/pjhul/intent/internal/infrastructure/clickhouse"
+	"github.com/pjhul/intent/internal/infrastructure/kafka"
 )
 
 // Service orchestrates the inserter components
@@ -20,6 +21,8 @@ type Service struct {
 
 	eventsInserter     *EventsInserter
 	membershipInserter *MembershipInserter
+
+	changelogExporter *kafka.ChangelogExporter
 }
 
 // NewService creates a new inserter service
@@ -29,6 +32,12 @@ func NewService(cfg *Config, chClient *clickhouse.Client) *Service {
 		eventsInserter:     NewEventsInserter(chClient),
 		membershipInserter: NewMembershipInserter(chClient),
 	}
+	s.eventsInserter.SetConcurrency(cfg.EventsInsertWorkers, cfg.PreserveUserOrder)
+
+	if cfg.ChangelogExportEnabled {
+		s.changelogExporter = kafka.NewChangelogExporter(cfg.KafkaBrokers, cfg.ChangelogExportTopic)
+		s.membershipInserter.SetChangelogProducer(&changelogProducer{exporter: s.changelogExporter})
+	}
 
 	// Create batchers with insert functions
 	s.eventsBatcher = NewBatcher(
@@ -48,6 +57,7 @@ func NewService(cfg *Config, chClient *clickhouse.Client) *Service {
 		cfg.KafkaBrokers,
 		cfg.EventsTopic,
 		cfg.EventsConsumerGroup,
+		cfg.StartOffset,
 		"events",
 		func(ctx context.Context, event RawEvent) error {
 			return s.eventsBatcher.Add(ctx, event)
@@ -58,6 +68,7 @@ func NewService(cfg *Config, chClient *clickhouse.Client) *Service {
 		cfg.KafkaBrokers,
 		cfg.MembershipTopic,
 		cfg.MembershipConsumerGroup,
+		cfg.StartOffset,
 		"membership",
 		func(ctx context.Context, change MembershipChange) error {
 			return s.membershipBatcher.Add(ctx, change)
@@ -72,9 +83,15 @@ func (s *Service) Start(ctx context.Context) error {
 	log.Printf("starting inserter service")
 	log.Printf("  batch_size: %d", s.cfg.BatchSize)
 	log.Printf("  flush_interval: %s", s.cfg.FlushInterval)
+	log.Printf("  events_insert_workers: %d", s.cfg.EventsInsertWorkers)
+	log.Printf("  preserve_user_order: %t", s.cfg.PreserveUserOrder)
 	log.Printf("  kafka_brokers: %v", s.cfg.KafkaBrokers)
 	log.Printf("  events_topic: %s", s.cfg.EventsTopic)
 	log.Printf("  membership_topic: %s", s.cfg.MembershipTopic)
+	log.Printf("  start_offset: %s", s.cfg.StartOffset)
+	if s.cfg.ChangelogExportEnabled {
+		log.Printf("  changelog_export_topic: %s", s.cfg.ChangelogExportTopic)
+	}
 
 	var wg sync.WaitGroup
 	errCh := make(chan error, 2)
@@ -132,6 +149,37 @@ func (s *Service) Stop(ctx context.Context) error {
 		log.Printf("error closing membership consumer: %v", err)
 	}
 
+	if s.changelogExporter != nil {
+		if err := s.changelogExporter.Close(); err != nil {
+			log.Printf("error closing changelog exporter: %v", err)
+		}
+	}
+
 	log.Printf("inserter service stopped")
 	return nil
 }
+
+// changelogProducer adapts the Kafka changelog exporter to ChangelogProducer.
+// User IDs are exported as is; unlike the cohort service's exporter, the
+// inserter has no way to find a cohort's project and apply its anonymization.
+type changelogProducer struct {
+	exporter *kafka.ChangelogExporter
+}
+
+// ProduceChangelog implements ChangelogProducer
+func (p *changelogProducer) ProduceChangelog(ctx context.Context, changes []MembershipChange) error {
+	entries := make([]kafka.ChangelogEntry, len(changes))
+	for i, c := range changes {
+		entries[i] = kafka.ChangelogEntry{
+			CohortID:     c.CohortID,
+			UserID:       c.UserID,
+			PrevStatus:   c.PrevStatus,
+			NewStatus:    c.NewStatus,
+			ChangedAt:    c.ChangedAt,
+			TriggerEvent: c.TriggerEvent,
+			Reason:       c.Reason,
+			Variant:      c.Variant,
+		}
+	}
+	return p.exporter.Export(ctx, entries)
+}
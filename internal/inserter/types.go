@@ -9,11 +9,13 @@ import (
 // RawEvent represents an event from the events.raw Kafka topic
 type RawEvent struct {
 	ID         uuid.UUID      `json:"id"`
+	ProjectID  uuid.UUID      `json:"project_id"`
 	UserID     string         `json:"user_id"`
 	EventName  string         `json:"event_name"`
 	Properties map[string]any `json:"properties,omitempty"`
 	Timestamp  time.Time      `json:"timestamp"`
 	ReceivedAt time.Time      `json:"received_at"`
+	Sequence   uint64         `json:"sequence,omitempty"`
 }
 
 // MembershipChange represents a membership change from the cohort.membership Kafka topic
@@ -26,6 +28,8 @@ type MembershipChange struct {
 	NewStatus    int8       `json:"new_status"`    // -1 = out, 1 = in
 	ChangedAt    time.Time  `json:"changed_at"`
 	TriggerEvent *uuid.UUID `json:"trigger_event,omitempty"`
+	Reason       string     `json:"reason,omitempty"` // recompute, event, rule_change, merge or manual
+	Variant      string     `json:"variant,omitempty"` // experiment variant in cohorts with variants
 }
 
 // IsMember returns true if the user is now a member (new_status = 1)
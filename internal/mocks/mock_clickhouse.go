@@ -203,6 +203,82 @@ func (mr *MockBatchMockRecorder) Send() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockBatch)(nil).Send))
 }
 
+// MockChangelogExporter is a mock of ChangelogExporter interface.
+type MockChangelogExporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockChangelogExporterMockRecorder
+	isgomock struct{}
+}
+
+// MockChangelogExporterMockRecorder is the mock recorder for MockChangelogExporter.
+type MockChangelogExporterMockRecorder struct {
+	mock *MockChangelogExporter
+}
+
+// NewMockChangelogExporter creates a new mock instance.
+func NewMockChangelogExporter(ctrl *gomock.Controller) *MockChangelogExporter {
+	mock := &MockChangelogExporter{ctrl: ctrl}
+	mock.recorder = &MockChangelogExporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChangelogExporter) EXPECT() *MockChangelogExporterMockRecorder {
+	return m.recorder
+}
+
+// ExportChangelog mocks base method.
+func (m *MockChangelogExporter) ExportChangelog(ctx context.Context, entries []cohort.ChangelogEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportChangelog", ctx, entries)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportChangelog indicates an expected call of ExportChangelog.
+func (mr *MockChangelogExporterMockRecorder) ExportChangelog(ctx, entries any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportChangelog", reflect.TypeOf((*MockChangelogExporter)(nil).ExportChangelog), ctx, entries)
+}
+
+// MockMembershipChangeBatchProducer is a mock of MembershipChangeBatchProducer interface.
+type MockMembershipChangeBatchProducer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMembershipChangeBatchProducerMockRecorder
+	isgomock struct{}
+}
+
+// MockMembershipChangeBatchProducerMockRecorder is the mock recorder for MockMembershipChangeBatchProducer.
+type MockMembershipChangeBatchProducerMockRecorder struct {
+	mock *MockMembershipChangeBatchProducer
+}
+
+// NewMockMembershipChangeBatchProducer creates a new mock instance.
+func NewMockMembershipChangeBatchProducer(ctrl *gomock.Controller) *MockMembershipChangeBatchProducer {
+	mock := &MockMembershipChangeBatchProducer{ctrl: ctrl}
+	mock.recorder = &MockMembershipChangeBatchProducerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMembershipChangeBatchProducer) EXPECT() *MockMembershipChangeBatchProducerMockRecorder {
+	return m.recorder
+}
+
+// ProduceMembershipChanges mocks base method.
+func (m *MockMembershipChangeBatchProducer) ProduceMembershipChanges(ctx context.Context, cohortName string, changes []cohort.ChangelogEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProduceMembershipChanges", ctx, cohortName, changes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProduceMembershipChanges indicates an expected call of ProduceMembershipChanges.
+func (mr *MockMembershipChangeBatchProducerMockRecorder) ProduceMembershipChanges(ctx, cohortName, changes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProduceMembershipChanges", reflect.TypeOf((*MockMembershipChangeBatchProducer)(nil).ProduceMembershipChanges), ctx, cohortName, changes)
+}
+
 // MockCohortGetter is a mock of CohortGetter interface.
 type MockCohortGetter struct {
 	ctrl     *gomock.Controller
@@ -241,3 +317,132 @@ func (mr *MockCohortGetterMockRecorder) GetByID(ctx, id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockCohortGetter)(nil).GetByID), ctx, id)
 }
+
+// MockMembershipOverrideSource is a mock of MembershipOverrideSource interface.
+type MockMembershipOverrideSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockMembershipOverrideSourceMockRecorder
+	isgomock struct{}
+}
+
+// MockMembershipOverrideSourceMockRecorder is the mock recorder for MockMembershipOverrideSource.
+type MockMembershipOverrideSourceMockRecorder struct {
+	mock *MockMembershipOverrideSource
+}
+
+// NewMockMembershipOverrideSource creates a new mock instance.
+func NewMockMembershipOverrideSource(ctrl *gomock.Controller) *MockMembershipOverrideSource {
+	mock := &MockMembershipOverrideSource{ctrl: ctrl}
+	mock.recorder = &MockMembershipOverrideSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMembershipOverrideSource) EXPECT() *MockMembershipOverrideSourceMockRecorder {
+	return m.recorder
+}
+
+// ClearOverrides mocks base method.
+func (m *MockMembershipOverrideSource) ClearOverrides(ctx context.Context, cohortID uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearOverrides", ctx, cohortID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearOverrides indicates an expected call of ClearOverrides.
+func (mr *MockMembershipOverrideSourceMockRecorder) ClearOverrides(ctx, cohortID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearOverrides", reflect.TypeOf((*MockMembershipOverrideSource)(nil).ClearOverrides), ctx, cohortID)
+}
+
+// GetOverrides mocks base method.
+func (m *MockMembershipOverrideSource) GetOverrides(ctx context.Context, cohortID uuid.UUID) (map[string]int8, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOverrides", ctx, cohortID)
+	ret0, _ := ret[0].(map[string]int8)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOverrides indicates an expected call of GetOverrides.
+func (mr *MockMembershipOverrideSourceMockRecorder) GetOverrides(ctx, cohortID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOverrides", reflect.TypeOf((*MockMembershipOverrideSource)(nil).GetOverrides), ctx, cohortID)
+}
+
+// MockRecomputeCompleter is a mock of RecomputeCompleter interface.
+type MockRecomputeCompleter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecomputeCompleterMockRecorder
+	isgomock struct{}
+}
+
+// MockRecomputeCompleterMockRecorder is the mock recorder for MockRecomputeCompleter.
+type MockRecomputeCompleterMockRecorder struct {
+	mock *MockRecomputeCompleter
+}
+
+// NewMockRecomputeCompleter creates a new mock instance.
+func NewMockRecomputeCompleter(ctrl *gomock.Controller) *MockRecomputeCompleter {
+	mock := &MockRecomputeCompleter{ctrl: ctrl}
+	mock.recorder = &MockRecomputeCompleterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecomputeCompleter) EXPECT() *MockRecomputeCompleterMockRecorder {
+	return m.recorder
+}
+
+// MarkRecomputed mocks base method.
+func (m *MockRecomputeCompleter) MarkRecomputed(ctx context.Context, cohortID uuid.UUID, version int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRecomputed", ctx, cohortID, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRecomputed indicates an expected call of MarkRecomputed.
+func (mr *MockRecomputeCompleterMockRecorder) MarkRecomputed(ctx, cohortID, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRecomputed", reflect.TypeOf((*MockRecomputeCompleter)(nil).MarkRecomputed), ctx, cohortID, version)
+}
+
+// MockRecomputeJobRecorder is a mock of RecomputeJobRecorder interface.
+type MockRecomputeJobRecorder struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecomputeJobRecorderMockRecorder
+	isgomock struct{}
+}
+
+// MockRecomputeJobRecorderMockRecorder is the mock recorder for MockRecomputeJobRecorder.
+type MockRecomputeJobRecorderMockRecorder struct {
+	mock *MockRecomputeJobRecorder
+}
+
+// NewMockRecomputeJobRecorder creates a new mock instance.
+func NewMockRecomputeJobRecorder(ctrl *gomock.Controller) *MockRecomputeJobRecorder {
+	mock := &MockRecomputeJobRecorder{ctrl: ctrl}
+	mock.recorder = &MockRecomputeJobRecorderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecomputeJobRecorder) EXPECT() *MockRecomputeJobRecorderMockRecorder {
+	return m.recorder
+}
+
+// RecordRecomputeJob mocks base method.
+func (m *MockRecomputeJobRecorder) RecordRecomputeJob(ctx context.Context, job *cohort.RecomputeJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordRecomputeJob", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordRecomputeJob indicates an expected call of RecordRecomputeJob.
+func (mr *MockRecomputeJobRecorderMockRecorder) RecordRecomputeJob(ctx, job any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordRecomputeJob", reflect.TypeOf((*MockRecomputeJobRecorder)(nil).RecordRecomputeJob), ctx, job)
+}
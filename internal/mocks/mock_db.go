@@ -42,6 +42,34 @@ func (m *MockQuerier) EXPECT() *MockQuerierMockRecorder {
 	return m.recorder
 }
 
+// ArchiveCohort mocks base method.
+func (m *MockQuerier) ArchiveCohort(ctx context.Context, id pgtype.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArchiveCohort", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ArchiveCohort indicates an expected call of ArchiveCohort.
+func (mr *MockQuerierMockRecorder) ArchiveCohort(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArchiveCohort", reflect.TypeOf((*MockQuerier)(nil).ArchiveCohort), ctx, id)
+}
+
+// ClearCohortNeedsRecompute mocks base method.
+func (m *MockQuerier) ClearCohortNeedsRecompute(ctx context.Context, arg db.ClearCohortNeedsRecomputeParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearCohortNeedsRecompute", ctx, arg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearCohortNeedsRecompute indicates an expected call of ClearCohortNeedsRecompute.
+func (mr *MockQuerierMockRecorder) ClearCohortNeedsRecompute(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearCohortNeedsRecompute", reflect.TypeOf((*MockQuerier)(nil).ClearCohortNeedsRecompute), ctx, arg)
+}
+
 // CountAllProjects mocks base method.
 func (m *MockQuerier) CountAllProjects(ctx context.Context) (int64, error) {
 	m.ctrl.T.Helper()
@@ -72,6 +100,21 @@ func (mr *MockQuerierMockRecorder) CountCohorts(ctx, projectID any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCohorts", reflect.TypeOf((*MockQuerier)(nil).CountCohorts), ctx, projectID)
 }
 
+// CountCohortsByName mocks base method.
+func (m *MockQuerier) CountCohortsByName(ctx context.Context, arg db.CountCohortsByNameParams) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCohortsByName", ctx, arg)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCohortsByName indicates an expected call of CountCohortsByName.
+func (mr *MockQuerierMockRecorder) CountCohortsByName(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCohortsByName", reflect.TypeOf((*MockQuerier)(nil).CountCohortsByName), ctx, arg)
+}
+
 // CountCohortsByStatus mocks base method.
 func (m *MockQuerier) CountCohortsByStatus(ctx context.Context, arg db.CountCohortsByStatusParams) (int64, error) {
 	m.ctrl.T.Helper()
@@ -132,6 +175,36 @@ func (mr *MockQuerierMockRecorder) CreateCohort(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCohort", reflect.TypeOf((*MockQuerier)(nil).CreateCohort), ctx, arg)
 }
 
+// CreateCohortExportSchedule mocks base method.
+func (m *MockQuerier) CreateCohortExportSchedule(ctx context.Context, arg db.CreateCohortExportScheduleParams) (db.CohortExportSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCohortExportSchedule", ctx, arg)
+	ret0, _ := ret[0].(db.CohortExportSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCohortExportSchedule indicates an expected call of CreateCohortExportSchedule.
+func (mr *MockQuerierMockRecorder) CreateCohortExportSchedule(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCohortExportSchedule", reflect.TypeOf((*MockQuerier)(nil).CreateCohortExportSchedule), ctx, arg)
+}
+
+// CreateCohortTemplate mocks base method.
+func (m *MockQuerier) CreateCohortTemplate(ctx context.Context, arg db.CreateCohortTemplateParams) (db.CohortTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCohortTemplate", ctx, arg)
+	ret0, _ := ret[0].(db.CohortTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCohortTemplate indicates an expected call of CreateCohortTemplate.
+func (mr *MockQuerierMockRecorder) CreateCohortTemplate(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCohortTemplate", reflect.TypeOf((*MockQuerier)(nil).CreateCohortTemplate), ctx, arg)
+}
+
 // CreateOrganization mocks base method.
 func (m *MockQuerier) CreateOrganization(ctx context.Context, arg db.CreateOrganizationParams) (db.Organization, error) {
 	m.ctrl.T.Helper()
@@ -162,18 +235,32 @@ func (mr *MockQuerierMockRecorder) CreateProject(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProject", reflect.TypeOf((*MockQuerier)(nil).CreateProject), ctx, arg)
 }
 
-// DeleteCohort mocks base method.
-func (m *MockQuerier) DeleteCohort(ctx context.Context, id pgtype.UUID) error {
+// DeleteCohortExportSchedule mocks base method.
+func (m *MockQuerier) DeleteCohortExportSchedule(ctx context.Context, id pgtype.UUID) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteCohort", ctx, id)
+	ret := m.ctrl.Call(m, "DeleteCohortExportSchedule", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// DeleteCohort indicates an expected call of DeleteCohort.
-func (mr *MockQuerierMockRecorder) DeleteCohort(ctx, id any) *gomock.Call {
+// DeleteCohortExportSchedule indicates an expected call of DeleteCohortExportSchedule.
+func (mr *MockQuerierMockRecorder) DeleteCohortExportSchedule(ctx, id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCohort", reflect.TypeOf((*MockQuerier)(nil).DeleteCohort), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCohortExportSchedule", reflect.TypeOf((*MockQuerier)(nil).DeleteCohortExportSchedule), ctx, id)
+}
+
+// DeleteCohortTemplate mocks base method.
+func (m *MockQuerier) DeleteCohortTemplate(ctx context.Context, id pgtype.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCohortTemplate", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCohortTemplate indicates an expected call of DeleteCohortTemplate.
+func (mr *MockQuerierMockRecorder) DeleteCohortTemplate(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCohortTemplate", reflect.TypeOf((*MockQuerier)(nil).DeleteCohortTemplate), ctx, id)
 }
 
 // DeleteOrganization mocks base method.
@@ -234,6 +321,36 @@ func (mr *MockQuerierMockRecorder) GetCohortByName(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCohortByName", reflect.TypeOf((*MockQuerier)(nil).GetCohortByName), ctx, arg)
 }
 
+// GetCohortExportSchedule mocks base method.
+func (m *MockQuerier) GetCohortExportSchedule(ctx context.Context, id pgtype.UUID) (db.CohortExportSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCohortExportSchedule", ctx, id)
+	ret0, _ := ret[0].(db.CohortExportSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCohortExportSchedule indicates an expected call of GetCohortExportSchedule.
+func (mr *MockQuerierMockRecorder) GetCohortExportSchedule(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCohortExportSchedule", reflect.TypeOf((*MockQuerier)(nil).GetCohortExportSchedule), ctx, id)
+}
+
+// GetCohortTemplate mocks base method.
+func (m *MockQuerier) GetCohortTemplate(ctx context.Context, id pgtype.UUID) (db.CohortTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCohortTemplate", ctx, id)
+	ret0, _ := ret[0].(db.CohortTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCohortTemplate indicates an expected call of GetCohortTemplate.
+func (mr *MockQuerierMockRecorder) GetCohortTemplate(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCohortTemplate", reflect.TypeOf((*MockQuerier)(nil).GetCohortTemplate), ctx, id)
+}
+
 // GetCohortsUpdatedAfter mocks base method.
 func (m *MockQuerier) GetCohortsUpdatedAfter(ctx context.Context, updatedAt pgtype.Timestamptz) ([]db.GetCohortsUpdatedAfterRow, error) {
 	m.ctrl.T.Helper()
@@ -309,6 +426,21 @@ func (mr *MockQuerierMockRecorder) GetProjectBySlug(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjectBySlug", reflect.TypeOf((*MockQuerier)(nil).GetProjectBySlug), ctx, arg)
 }
 
+// GetVersionRecomputedAt mocks base method.
+func (m *MockQuerier) GetVersionRecomputedAt(ctx context.Context, arg db.GetVersionRecomputedAtParams) (pgtype.Timestamptz, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVersionRecomputedAt", ctx, arg)
+	ret0, _ := ret[0].(pgtype.Timestamptz)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVersionRecomputedAt indicates an expected call of GetVersionRecomputedAt.
+func (mr *MockQuerierMockRecorder) GetVersionRecomputedAt(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersionRecomputedAt", reflect.TypeOf((*MockQuerier)(nil).GetVersionRecomputedAt), ctx, arg)
+}
+
 // ListActiveCohorts mocks base method.
 func (m *MockQuerier) ListActiveCohorts(ctx context.Context, projectID pgtype.UUID) ([]db.ListActiveCohortsRow, error) {
 	m.ctrl.T.Helper()
@@ -339,6 +471,21 @@ func (mr *MockQuerierMockRecorder) ListAllActiveCohorts(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAllActiveCohorts", reflect.TypeOf((*MockQuerier)(nil).ListAllActiveCohorts), ctx)
 }
 
+// ListAllCohortExportSchedules mocks base method.
+func (m *MockQuerier) ListAllCohortExportSchedules(ctx context.Context) ([]db.CohortExportSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAllCohortExportSchedules", ctx)
+	ret0, _ := ret[0].([]db.CohortExportSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAllCohortExportSchedules indicates an expected call of ListAllCohortExportSchedules.
+func (mr *MockQuerierMockRecorder) ListAllCohortExportSchedules(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAllCohortExportSchedules", reflect.TypeOf((*MockQuerier)(nil).ListAllCohortExportSchedules), ctx)
+}
+
 // ListAllProjects mocks base method.
 func (m *MockQuerier) ListAllProjects(ctx context.Context, arg db.ListAllProjectsParams) ([]db.Project, error) {
 	m.ctrl.T.Helper()
@@ -354,6 +501,51 @@ func (mr *MockQuerierMockRecorder) ListAllProjects(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAllProjects", reflect.TypeOf((*MockQuerier)(nil).ListAllProjects), ctx, arg)
 }
 
+// ListCohortExportSchedules mocks base method.
+func (m *MockQuerier) ListCohortExportSchedules(ctx context.Context, cohortID pgtype.UUID) ([]db.CohortExportSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCohortExportSchedules", ctx, cohortID)
+	ret0, _ := ret[0].([]db.CohortExportSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCohortExportSchedules indicates an expected call of ListCohortExportSchedules.
+func (mr *MockQuerierMockRecorder) ListCohortExportSchedules(ctx, cohortID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCohortExportSchedules", reflect.TypeOf((*MockQuerier)(nil).ListCohortExportSchedules), ctx, cohortID)
+}
+
+// ListCohortNameCollisions mocks base method.
+func (m *MockQuerier) ListCohortNameCollisions(ctx context.Context, projectID pgtype.UUID) ([]db.ListCohortNameCollisionsRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCohortNameCollisions", ctx, projectID)
+	ret0, _ := ret[0].([]db.ListCohortNameCollisionsRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCohortNameCollisions indicates an expected call of ListCohortNameCollisions.
+func (mr *MockQuerierMockRecorder) ListCohortNameCollisions(ctx, projectID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCohortNameCollisions", reflect.TypeOf((*MockQuerier)(nil).ListCohortNameCollisions), ctx, projectID)
+}
+
+// ListCohortTemplates mocks base method.
+func (m *MockQuerier) ListCohortTemplates(ctx context.Context, projectID pgtype.UUID) ([]db.CohortTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCohortTemplates", ctx, projectID)
+	ret0, _ := ret[0].([]db.CohortTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCohortTemplates indicates an expected call of ListCohortTemplates.
+func (mr *MockQuerierMockRecorder) ListCohortTemplates(ctx, projectID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCohortTemplates", reflect.TypeOf((*MockQuerier)(nil).ListCohortTemplates), ctx, projectID)
+}
+
 // ListCohorts mocks base method.
 func (m *MockQuerier) ListCohorts(ctx context.Context, arg db.ListCohortsParams) ([]db.ListCohortsRow, error) {
 	m.ctrl.T.Helper()
@@ -414,6 +606,63 @@ func (mr *MockQuerierMockRecorder) ListProjects(ctx, arg any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListProjects", reflect.TypeOf((*MockQuerier)(nil).ListProjects), ctx, arg)
 }
 
+// ListRecomputeJobHistory mocks base method.
+func (m *MockQuerier) ListRecomputeJobHistory(ctx context.Context, arg db.ListRecomputeJobHistoryParams) ([]db.RecomputeJobHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRecomputeJobHistory", ctx, arg)
+	ret0, _ := ret[0].([]db.RecomputeJobHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRecomputeJobHistory indicates an expected call of ListRecomputeJobHistory.
+func (mr *MockQuerierMockRecorder) ListRecomputeJobHistory(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRecomputeJobHistory", reflect.TypeOf((*MockQuerier)(nil).ListRecomputeJobHistory), ctx, arg)
+}
+
+// RecordCohortExportRun mocks base method.
+func (m *MockQuerier) RecordCohortExportRun(ctx context.Context, arg db.RecordCohortExportRunParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordCohortExportRun", ctx, arg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordCohortExportRun indicates an expected call of RecordCohortExportRun.
+func (mr *MockQuerierMockRecorder) RecordCohortExportRun(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordCohortExportRun", reflect.TypeOf((*MockQuerier)(nil).RecordCohortExportRun), ctx, arg)
+}
+
+// RecordRecomputeJob mocks base method.
+func (m *MockQuerier) RecordRecomputeJob(ctx context.Context, arg db.RecordRecomputeJobParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordRecomputeJob", ctx, arg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordRecomputeJob indicates an expected call of RecordRecomputeJob.
+func (mr *MockQuerierMockRecorder) RecordRecomputeJob(ctx, arg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordRecomputeJob", reflect.TypeOf((*MockQuerier)(nil).RecordRecomputeJob), ctx, arg)
+}
+
+// RestoreCohort mocks base method.
+func (m *MockQuerier) RestoreCohort(ctx context.Context, id pgtype.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreCohort", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreCohort indicates an expected call of RestoreCohort.
+func (mr *MockQuerierMockRecorder) RestoreCohort(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCohort", reflect.TypeOf((*MockQuerier)(nil).RestoreCohort), ctx, id)
+}
+
 // UpdateCohort mocks base method.
 func (m *MockQuerier) UpdateCohort(ctx context.Context, arg db.UpdateCohortParams) (db.UpdateCohortRow, error) {
 	m.ctrl.T.Helper()
@@ -111,3 +111,41 @@ func (mr *MockInserterBatchMockRecorder) Send() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockInserterBatch)(nil).Send))
 }
+
+// MockChangelogProducer is a mock of ChangelogProducer interface.
+type MockChangelogProducer struct {
+	ctrl     *gomock.Controller
+	recorder *MockChangelogProducerMockRecorder
+	isgomock struct{}
+}
+
+// MockChangelogProducerMockRecorder is the mock recorder for MockChangelogProducer.
+type MockChangelogProducerMockRecorder struct {
+	mock *MockChangelogProducer
+}
+
+// NewMockChangelogProducer creates a new mock instance.
+func NewMockChangelogProducer(ctrl *gomock.Controller) *MockChangelogProducer {
+	mock := &MockChangelogProducer{ctrl: ctrl}
+	mock.recorder = &MockChangelogProducerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChangelogProducer) EXPECT() *MockChangelogProducerMockRecorder {
+	return m.recorder
+}
+
+// ProduceChangelog mocks base method.
+func (m *MockChangelogProducer) ProduceChangelog(ctx context.Context, changes []inserter.MembershipChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProduceChangelog", ctx, changes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProduceChangelog indicates an expected call of ProduceChangelog.
+func (mr *MockChangelogProducerMockRecorder) ProduceChangelog(ctx, changes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProduceChangelog", reflect.TypeOf((*MockChangelogProducer)(nil).ProduceChangelog), ctx, changes)
+}
@@ -0,0 +1,76 @@
+// Package tenant carries the organization, project and, where there is one,
+// the cohort that a request or job acts for through its context, so storage
+// can be scoped to the project and its queries attributed
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoProject       = errors.New("no project in request context")
+	ErrProjectMismatch = errors.New("project does not match the request context")
+)
+
+type (
+	organizationKey struct{}
+	projectKey      struct{}
+	cohortKey       struct{}
+)
+
+// WithOrganization returns a context acting for the organization
+func WithOrganization(ctx context.Context, organizationID uuid.UUID) context.Context {
+	return context.WithValue(ctx, organizationKey{}, organizationID)
+}
+
+// OrganizationFromContext returns the organization the context acts for, if any
+func OrganizationFromContext(ctx context.Context) (uuid.UUID, bool) {
+	organizationID, ok := ctx.Value(organizationKey{}).(uuid.UUID)
+	return organizationID, ok && organizationID != uuid.Nil
+}
+
+// WithProject returns a context acting for the project
+func WithProject(ctx context.Context, projectID uuid.UUID) context.Context {
+	return context.WithValue(ctx, projectKey{}, projectID)
+}
+
+// ProjectFromContext returns the project the context acts for, if any
+func ProjectFromContext(ctx context.Context) (uuid.UUID, bool) {
+	projectID, ok := ctx.Value(projectKey{}).(uuid.UUID)
+	return projectID, ok && projectID != uuid.Nil
+}
+
+// RequireProject returns the project the context acts for, or ErrNoProject
+func RequireProject(ctx context.Context) (uuid.UUID, error) {
+	projectID, ok := ProjectFromContext(ctx)
+	if !ok {
+		return uuid.Nil, ErrNoProject
+	}
+	return projectID, nil
+}
+
+// CheckProject verifies the context acts for projectID
+func CheckProject(ctx context.Context, projectID uuid.UUID) error {
+	scoped, err := RequireProject(ctx)
+	if err != nil {
+		return err
+	}
+	if scoped != projectID {
+		return ErrProjectMismatch
+	}
+	return nil
+}
+
+// WithCohort returns a context acting for the cohort
+func WithCohort(ctx context.Context, cohortID uuid.UUID) context.Context {
+	return context.WithValue(ctx, cohortKey{}, cohortID)
+}
+
+// CohortFromContext returns the cohort the context acts for, if any
+func CohortFromContext(ctx context.Context) (uuid.UUID, bool) {
+	cohortID, ok := ctx.Value(cohortKey{}).(uuid.UUID)
+	return cohortID, ok && cohortID != uuid.Nil
+}